@@ -0,0 +1,102 @@
+// Package authctx carries the authenticated caller, tenant and request ID of
+// a request through its context.
+package authctx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Principal kinds
+const (
+	KindAdmin  = "admin"
+	KindAPIKey = "api_key"
+)
+
+// Identity is who is calling
+type Identity struct {
+	// Kind is KindAdmin or KindAPIKey
+	Kind string
+	// ID is a stable, non-secret label for the credential
+	ID string
+	// Scopes are what an API key may do; admins may do anything
+	Scopes []string
+	// Brand is the brand an API key sells under, if any
+	Brand string
+}
+
+// Allows reports whether the caller holds scope. "*" grants every scope
+// and "area:*" every scope of the area, e.g. "admin:*" grants "admin:read".
+func (id Identity) Allows(scope string) bool {
+	if id.Kind == KindAdmin {
+		return true
+	}
+	area, _, _ := strings.Cut(scope, ":")
+	for _, s := range id.Scopes {
+		if s == scope || s == "*" || s == area+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (id Identity) String() string {
+	return id.Kind + ":" + id.ID
+}
+
+type principalKey struct{}
+
+type tenantKey struct{}
+
+type requestIDKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying id
+func WithPrincipal(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, principalKey{}, id)
+}
+
+// Principal returns the authenticated caller, if any
+func Principal(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(principalKey{}).(Identity)
+	return id, ok
+}
+
+// WithTenant returns a copy of ctx carrying the merchant the call is for
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant returns the merchant the call is for, if any
+func Tenant(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// WithRequestID returns a copy of ctx carrying the request's correlation ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request's correlation ID, if any
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// LogFields formats the request ID, principal and tenant for log lines, e.g.
+// " request_id=9f3c principal=admin:ops tenant=acme". It is empty when none
+// is set.
+func LogFields(ctx context.Context) string {
+	var b strings.Builder
+	if id, ok := RequestID(ctx); ok {
+		fmt.Fprintf(&b, " request_id=%s", id)
+	}
+	if id, ok := Principal(ctx); ok {
+		fmt.Fprintf(&b, " principal=%s", id)
+	}
+	if tenant, ok := Tenant(ctx); ok {
+		fmt.Fprintf(&b, " tenant=%s", tenant)
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package authctx
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    Identity
+		scope string
+		want  bool
+	}{
+		{"admin", Identity{Kind: KindAdmin}, "orders:create", true},
+		{"exact scope", Identity{Kind: KindAPIKey, Scopes: []string{"orders:read"}}, "orders:read", true},
+		{"other scope", Identity{Kind: KindAPIKey, Scopes: []string{"orders:read"}}, "orders:create", false},
+		{"area wildcard", Identity{Kind: KindAPIKey, Scopes: []string{"orders:*"}}, "orders:verify", true},
+		{"other area wildcard", Identity{Kind: KindAPIKey, Scopes: []string{"admin:*"}}, "orders:read", false},
+		{"wildcard", Identity{Kind: KindAPIKey, Scopes: []string{"*"}}, "admin:write", true},
+		{"no scopes", Identity{Kind: KindAPIKey}, "orders:read", false},
+		{"zero identity", Identity{}, "orders:read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.id.Allows(tt.scope); got != tt.want {
+				t.Fatalf("Allows(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextValues(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := Principal(ctx); ok {
+		t.Fatal("principal on an empty context")
+	}
+	if _, ok := Tenant(WithTenant(ctx, "")); ok {
+		t.Fatal("empty tenant reported as set")
+	}
+	if _, ok := RequestID(WithRequestID(ctx, "")); ok {
+		t.Fatal("empty request ID reported as set")
+	}
+
+	id := Identity{Kind: KindAPIKey, ID: "pos-1", Scopes: []string{"orders:read"}}
+	ctx = WithRequestID(WithTenant(WithPrincipal(ctx, id), "acme"), "9f3c")
+	if got, ok := Principal(ctx); !ok || got.ID != "pos-1" {
+		t.Fatalf("principal = %+v, %v", got, ok)
+	}
+	if got, ok := Tenant(ctx); !ok || got != "acme" {
+		t.Fatalf("tenant = %q, %v", got, ok)
+	}
+	if got, ok := RequestID(ctx); !ok || got != "9f3c" {
+		t.Fatalf("request ID = %q, %v", got, ok)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	admin := Identity{Kind: KindAdmin, ID: "ops"}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"none", context.Background(), ""},
+		{"request ID", WithRequestID(context.Background(), "9f3c"), " request_id=9f3c"},
+		{"principal", WithPrincipal(context.Background(), admin), " principal=admin:ops"},
+		{"all", WithTenant(WithPrincipal(WithRequestID(context.Background(), "9f3c"), admin), "acme"), " request_id=9f3c principal=admin:ops tenant=acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LogFields(tt.ctx); got != tt.want {
+				t.Fatalf("LogFields = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
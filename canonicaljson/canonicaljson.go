@@ -0,0 +1,51 @@
+// Package canonicaljson encodes values as canonical JSON, so the same value
+// always encodes to the same bytes whatever its Go type: a struct and a map
+// holding the same fields encode alike. Signatures, ETags and hashes are
+// computed over this form.
+//
+// Canonical JSON here is what encoding/json writes, with object keys sorted
+// bytewise at every level, no insignificant whitespace and no HTML
+// escaping. Numbers are kept as encoding/json formats them.
+package canonicaljson
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Marshal returns the canonical JSON encoding of v
+func Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// Decoding into interface{} turns every object into a map, which
+	// encoding/json writes with sorted keys; UseNumber keeps numbers as
+	// they were written rather than round-tripping them through float64
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Hash returns the hex SHA-256 of the canonical JSON encoding of v
+func Hash(v interface{}) (string, error) {
+	b, err := Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,134 @@
+package canonicaljson
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+type item struct {
+	Sku      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type order struct {
+	ID     string            `json:"id"`
+	Amount int64             `json:"amount"`
+	Notes  map[string]string `json:"notes,omitempty"`
+	Items  []item            `json:"items"`
+	Paid   bool              `json:"paid"`
+	Note   *string           `json:"note"`
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"sorted map keys", map[string]int{"b": 2, "a": 1, "C": 3, "aa": 4}, `{"C":3,"a":1,"aa":4,"b":2}`},
+		{"nested maps", map[string]interface{}{"z": map[string]interface{}{"y": 1, "x": []interface{}{map[string]int{"b": 1, "a": 2}}}, "a": nil}, `{"a":null,"z":{"x":[{"a":2,"b":1}],"y":1}}`},
+		{
+			"struct fields sorted",
+			order{ID: "order_1", Amount: 50000, Notes: map[string]string{"sku": "tee", "env": "prod"}, Items: []item{{Sku: "tee", Quantity: 2}}},
+			`{"amount":50000,"id":"order_1","items":[{"quantity":2,"sku":"tee"}],"note":null,"notes":{"env":"prod","sku":"tee"},"paid":false}`,
+		},
+		{"arrays keep their order", []int{3, 1, 2}, `[3,1,2]`},
+		{"no HTML escaping", map[string]string{"url": "https://example.com/?a=1&b=<2>"}, `{"url":"https://example.com/?a=1&b=<2>"}`},
+		{"large integers kept", map[string]int64{"n": 9007199254740993}, `{"n":9007199254740993}`},
+		{"numbers as encoding/json writes them", map[string]float64{"f": 1.5, "g": 100}, `{"f":1.5,"g":100}`},
+		{"scalar", "tee", `"tee"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Marshal = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalIsStable(t *testing.T) {
+	notes := map[string]string{}
+	for _, k := range []string{"k", "d", "x", "a", "q", "m", "b", "z", "c", "y"} {
+		notes[k] = k
+	}
+	v := order{ID: "order_1", Amount: 100, Notes: notes, Items: []item{{Sku: "a", Quantity: 1}, {Sku: "b", Quantity: 2}}}
+
+	first, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Map iteration order differs run to run; the output may not
+	for i := 0; i < 50; i++ {
+		again, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != string(first) {
+			t.Fatalf("marshal %d = %s, want %s", i+2, again, first)
+		}
+	}
+}
+
+func TestStructAndMapEncodeAlike(t *testing.T) {
+	s := order{ID: "order_1", Amount: 100, Items: []item{{Sku: "tee", Quantity: 1}}, Paid: true}
+	m := map[string]interface{}{
+		"paid":   true,
+		"note":   nil,
+		"items":  []map[string]interface{}{{"sku": "tee", "quantity": 1}},
+		"id":     "order_1",
+		"amount": 100,
+	}
+	fromStruct, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromMap, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fromStruct) != string(fromMap) {
+		t.Fatalf("struct = %s, map = %s, want the same bytes", fromStruct, fromMap)
+	}
+
+	hs, err := Hash(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm, err := Hash(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs != hm {
+		t.Fatalf("hashes differ: %s and %s", hs, hm)
+	}
+}
+
+func TestHash(t *testing.T) {
+	v := map[string]int{"b": 1, "a": 2}
+	got, err := Hash(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(`{"a":2,"b":1}`))
+	if want := hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("Hash = %s, want the SHA-256 of the canonical form %s", got, want)
+	}
+	if other, _ := Hash(map[string]int{"b": 1, "a": 3}); other == got {
+		t.Fatal("different values hash alike")
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	if _, err := Marshal(map[string]interface{}{"c": make(chan int)}); err == nil {
+		t.Fatal("Marshal of a channel succeeded")
+	}
+	if _, err := Hash(func() {}); err == nil {
+		t.Fatal("Hash of a func succeeded")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// runCheck is the --check mode: with the configuration already loaded, it
+// makes one authenticated Razorpay call, checks the stores and notification
+// channels are reachable and prints a line per check to w. It reports
+// whether every check passed.
+func runCheck(ctx context.Context, svc *service.Service, notifier *notify.Notifier, timeout time.Duration, w io.Writer) bool {
+	fmt.Fprintln(w, "config: ok")
+	passed := true
+
+	report := svc.Health(ctx, timeout)
+	names := make([]string, 0, len(report.Dependencies))
+	for name := range report.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dep := report.Dependencies[name]
+		if dep.Status != service.HealthUp {
+			passed = false
+			fmt.Fprintf(w, "%s: FAILED: %s\n", name, dep.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s: ok (%dms)\n", name, dep.LatencyMS)
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	probes := notifier.Probe(probeCtx)
+	channels := make([]string, 0, len(probes))
+	for name := range probes {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	for _, name := range channels {
+		if err := probes[name]; err != nil {
+			passed = false
+			fmt.Fprintf(w, "notify %s: FAILED: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "notify %s: ok\n", name)
+	}
+
+	if passed {
+		fmt.Fprintln(w, "check passed")
+	} else {
+		fmt.Fprintln(w, "check FAILED")
+	}
+	return passed
+}
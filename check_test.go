@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// pingGateway answers Ping with err; every other call panics
+type pingGateway struct {
+	gateway.Gateway
+	err error
+}
+
+func (g *pingGateway) Ping(ctx context.Context) error { return g.err }
+
+// probedChannel is a notification channel whose probe returns err
+type probedChannel struct {
+	err error
+}
+
+func (c *probedChannel) Name() string                                       { return "webhook" }
+func (c *probedChannel) Deliver(ctx context.Context, ev notify.Event) error { return nil }
+func (c *probedChannel) Probe(ctx context.Context) error                    { return c.err }
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		pingErr  error
+		probeErr error
+		passed   bool
+		want     []string
+	}{
+		{"all up", nil, nil, true, []string{"config: ok", "razorpay: ok", "notify webhook: ok", "check passed"}},
+		{"bad credentials", errors.New("authentication failed"), nil, false, []string{"razorpay: FAILED: authentication failed", "notify webhook: ok", "check FAILED"}},
+		{"channel unreachable", nil, errors.New("connection refused"), false, []string{"razorpay: ok", "notify webhook: FAILED: connection refused", "check FAILED"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RAZORPAY_API_KEY", "rzp_test_key")
+			t.Setenv("RAZORPAY_SECRET_KEY", "test_secret")
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := notify.New(notify.Options{}, &probedChannel{err: tt.probeErr})
+			defer n.Shutdown(context.Background())
+			svc, err := service.New(&pingGateway{err: tt.pingErr}, service.NewMemoryStore(), cfg, service.WithNotifier(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer svc.Shutdown(context.Background())
+
+			var out bytes.Buffer
+			if passed := runCheck(context.Background(), svc, n, time.Second, &out); passed != tt.passed {
+				t.Fatalf("passed = %v, want %v:\n%s", passed, tt.passed, out.String())
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(out.String(), line) {
+					t.Fatalf("output lacks %q:\n%s", line, out.String())
+				}
+			}
+		})
+	}
+}
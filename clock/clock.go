@@ -0,0 +1,76 @@
+// Package clock abstracts the current time so time-dependent behaviour can
+// be reproduced.
+package clock
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Clock tells the time
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the system clock
+type Real struct{}
+
+func (Real) Now() time.Time { return time.Now() }
+
+// Fake is a clock that only moves when told to
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a Fake stopped at t
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set moves the clock to t
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Errors returned by Window.Check
+var (
+	ErrNotYetValid = errors.New("not yet valid")
+	ErrExpired     = errors.New("expired")
+)
+
+// Window is the span in which a token, session or record is valid. A zero
+// bound leaves that side open.
+type Window struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Check reports whether now falls within w, tolerating the clock that set
+// the bounds and the one reading now disagreeing by up to skew either way.
+// Both bounds are inclusive.
+func (w Window) Check(now time.Time, skew time.Duration) error {
+	if !w.NotBefore.IsZero() && now.Before(w.NotBefore.Add(-skew)) {
+		return ErrNotYetValid
+	}
+	if !w.NotAfter.IsZero() && now.After(w.NotAfter.Add(skew)) {
+		return ErrExpired
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 3, 31, 23, 59, 0, 0, time.UTC)
+	c := NewFake(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("Now = %s, want %s", c.Now(), start)
+	}
+	c.Advance(2 * time.Minute)
+	if want := start.Add(2 * time.Minute); !c.Now().Equal(want) {
+		t.Fatalf("after Advance: Now = %s, want %s", c.Now(), want)
+	}
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("after Set: Now = %s, want %s", c.Now(), start)
+	}
+}
+
+func TestWindowCheck(t *testing.T) {
+	at := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	w := Window{NotBefore: at, NotAfter: at.Add(time.Hour)}
+	tests := []struct {
+		name   string
+		window Window
+		now    time.Time
+		skew   time.Duration
+		want   error
+	}{
+		{"inside", w, at.Add(30 * time.Minute), 0, nil},
+		{"at not before", w, at, 0, nil},
+		{"at not after", w, at.Add(time.Hour), 0, nil},
+		{"too early", w, at.Add(-time.Second), 0, ErrNotYetValid},
+		{"too late", w, at.Add(time.Hour + time.Second), 0, ErrExpired},
+		{"early within skew", w, at.Add(-time.Minute), time.Minute, nil},
+		{"late within skew", w, at.Add(time.Hour + time.Minute), time.Minute, nil},
+		{"late beyond skew", w, at.Add(time.Hour + time.Minute + time.Second), time.Minute, ErrExpired},
+		{"open start", Window{NotAfter: at}, at.Add(-1000 * time.Hour), 0, nil},
+		{"open end", Window{NotBefore: at}, at.Add(1000 * time.Hour), 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Check(tt.now, tt.skew); !errors.Is(err, tt.want) {
+				t.Fatalf("Check = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
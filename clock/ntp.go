@@ -0,0 +1,64 @@
+package clock
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds from the NTP epoch, 1900, to the
+// Unix epoch
+const ntpEpochOffset = 2208988800
+
+// NTPOffset estimates how far the system clock is behind server with one
+// SNTP exchange: positive when the local clock is slow. server is a host,
+// with port 123 assumed, or host:port.
+func NTPOffset(ctx context.Context, server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Leap indicator 0, version 4, mode 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0x23
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 || resp[0]&0x07 != 4 {
+		return 0, fmt.Errorf("malformed NTP response from %s", server)
+	}
+	if resp[1] == 0 {
+		return 0, fmt.Errorf("NTP server %s sent a kiss-of-death", server)
+	}
+
+	// Offset is the mean of the server's receive and transmit times minus
+	// the mean of ours, cancelling a symmetric network delay
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(secs, (frac*1e9)>>32)
+}
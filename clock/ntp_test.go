@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ntpServer answers one SNTP request on a local port with reply, given
+// the request and the time it arrived
+func ntpServer(t *testing.T, reply func(req []byte, at time.Time) []byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 48)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		conn.WriteTo(reply(buf[:n], time.Now()), addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+// putNTPTime encodes t as a 64-bit NTP timestamp
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+// answer is a server reply from a clock ahead of ours by offset
+func answer(offset time.Duration) func([]byte, time.Time) []byte {
+	return func(_ []byte, at time.Time) []byte {
+		resp := make([]byte, 48)
+		resp[0], resp[1] = 0x24, 2
+		putNTPTime(resp[32:40], at.Add(offset))
+		putNTPTime(resp[40:48], at.Add(offset))
+		return resp
+	}
+}
+
+func TestNTPOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+	}{
+		{"in step", 0},
+		{"local clock slow", 5 * time.Second},
+		{"local clock fast", -3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			got, err := NTPOffset(ctx, ntpServer(t, answer(tt.offset)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := (got - tt.offset).Abs(); diff > 50*time.Millisecond {
+				t.Fatalf("offset = %s, want about %s", got, tt.offset)
+			}
+		})
+	}
+}
+
+func TestNTPOffsetRefusesBadReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func([]byte, time.Time) []byte
+		want  string
+	}{
+		{"kiss of death", func(req []byte, at time.Time) []byte {
+			resp := answer(0)(req, at)
+			resp[1] = 0
+			return resp
+		}, "kiss-of-death"},
+		{"not a server reply", func(req []byte, at time.Time) []byte { return req }, "malformed"},
+		{"short", func([]byte, time.Time) []byte { return []byte{0x24, 2} }, "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if _, err := NTPOffset(ctx, ntpServer(t, tt.reply)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
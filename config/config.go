@@ -0,0 +1,1062 @@
+// Package config loads the payment service configuration from the environment.
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yash170603/golang_payment/money"
+)
+
+// Notes schema enforcement modes
+const (
+	NotesModeEnforce    = "enforce"
+	NotesModePermissive = "permissive"
+)
+
+// What happens to note values over NoteValueMaxLength
+const (
+	NoteOverflowReject   = "reject"
+	NoteOverflowTruncate = "truncate"
+)
+
+// What refunding a payment with Route transfers does about reversals
+const (
+	ReversalsBlock = "block"
+	ReversalsAuto  = "auto"
+	ReversalsOff   = "off"
+)
+
+// How amounts converted between currencies are rounded to whole minor
+// units, the modes of package money
+const (
+	RoundHalfUp  = string(money.RoundHalfUp)
+	RoundBankers = string(money.RoundBankers)
+	RoundFloor   = string(money.RoundFloor)
+	RoundCeil    = string(money.RoundCeil)
+)
+
+// SMS gateways customers can be texted through
+const (
+	SMSProviderMSG91  = "msg91"
+	SMSProviderTwilio = "twilio"
+)
+
+// What order creation does when the order cannot be saved
+const (
+	StoreWriteBestEffort = "best-effort"
+	StoreWriteStrict     = "strict"
+)
+
+// Where verified payment IDs are remembered
+const (
+	IdempotencyMemory = "memory"
+	IdempotencyRedis  = "redis"
+)
+
+// defaultRecoveryReasons are the Razorpay failure reasons a customer can
+// plausibly get past by trying again. Risk and fraud declines are left out.
+var defaultRecoveryReasons = []string{
+	"insufficient_funds",
+	"payment_timed_out",
+	"payment_cancelled",
+	"bank_technical_error",
+	"gateway_technical_error",
+	"server_error",
+}
+
+// headerName matches the HTTP header names accepted in configuration
+var headerName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// countryCode matches an E.164 country calling code, without the +
+var countryCode = regexp.MustCompile(`^[1-9][0-9]{0,2}$`)
+
+// Gin modes accepted in GIN_MODE
+const (
+	ModeDebug   = "debug"
+	ModeRelease = "release"
+	ModeTest    = "test"
+)
+
+// Config holds all configuration values
+type Config struct {
+	// Mode is the Gin mode; release mode disables development overrides
+	Mode           string
+	APIKey         string
+	SecretKey      string
+	Port           string
+	AllowedOrigins []string
+	// AdminAllowedOrigins enables CORS on admin routes; none when unset
+	AdminAllowedOrigins []string
+	CORSMaxAge          time.Duration
+	SessionTTL          time.Duration
+	OrderTokenTTL       time.Duration
+	// RazorpayTimeout bounds each upstream call including rate-limit retries
+	RazorpayTimeout time.Duration
+	// NotesSchemaFile points at the JSON notes schema, reloaded on SIGHUP
+	NotesSchemaFile string
+	NotesSchemaMode string
+	// NoteValueMaxLength is the longest note value in characters, Razorpay's
+	// 256 by default. NoteValueOverflow is NoteOverflowReject to refuse
+	// longer values from callers or NoteOverflowTruncate to cut them; notes
+	// the service adds itself are always cut.
+	NoteValueMaxLength int
+	NoteValueOverflow  string
+	// VerifyReplayTTL is how long a verified payment ID is remembered
+	VerifyReplayTTL time.Duration
+	// IdempotencyBackend is IdempotencyMemory to remember verified payment
+	// IDs and lock receipts per process, or IdempotencyRedis to share them
+	// through RedisURL
+	IdempotencyBackend string
+	RedisURL           string
+	// ReceiptLockTTL is how long a Redis receipt lock outlives a holder
+	// that never released it, and ReceiptRecordTTL how long Redis
+	// remembers the order created for a receipt
+	ReceiptLockTTL   time.Duration
+	ReceiptRecordTTL time.Duration
+	// StoreWritePolicy is StoreWriteBestEffort to log an order that could
+	// not be saved and return it anyway, or StoreWriteStrict to fail the
+	// request, leaving the Razorpay order orphaned
+	StoreWritePolicy string
+	// RazorpayBaseURL redirects SDK calls, e.g. to a local mock. It is
+	// ignored in release mode.
+	RazorpayBaseURL string
+	// ProviderFailover creates orders on the Razorpay account of
+	// FailoverAPIKey and FailoverSecretKey while the primary one cannot
+	// be reached
+	ProviderFailover  bool
+	FailoverAPIKey    string
+	FailoverSecretKey string
+	// AccountsFile lists further Razorpay accounts and the weights and
+	// rules routing new orders between them and the primary one
+	AccountsFile string
+	// AdminToken authenticates admin endpoints; they are disabled when empty
+	AdminToken string
+	// TenantsFile lists the merchants and their Razorpay key pairs
+	TenantsFile string
+	// BrandsFile lists the branding profiles orders may be sold under
+	BrandsFile string
+	// DefaultBrand is the brand of orders that name none
+	DefaultBrand string
+	// ReceiptMerchantName heads the receipts of orders with no brand
+	ReceiptMerchantName string
+	// APIKeysFile lists the scoped API keys partners call the API with
+	APIKeysFile string
+	// HealthCheckTimeout bounds each dependency check of the detailed health
+	HealthCheckTimeout time.Duration
+	// OrderCacheSize bounds the warm cache of orders served during outages
+	OrderCacheSize int
+	// OrderCacheMaxStaleness is how old a cached non-terminal order may be
+	// when served in place of an upstream read
+	OrderCacheMaxStaleness time.Duration
+	// WebhookSecret verifies X-Razorpay-Signature; webhooks are refused when empty
+	WebhookSecret string
+	// WebhookWorkers and WebhookQueueSize size the asynchronous webhook pool
+	WebhookWorkers   int
+	WebhookQueueSize int
+	// WebhookReorderDelay is how long a webhook event arriving before its
+	// predecessor, such as a refund before the payment's capture, is held
+	// back for it; the payment is then fetched from Razorpay instead. Zero
+	// applies events as they come. At most WebhookReorderMaxParked events
+	// are held at once.
+	WebhookReorderDelay     time.Duration
+	WebhookReorderMaxParked int
+	// WebhookDeadLetterMax caps the dead letters kept, dropping the oldest
+	// first
+	WebhookDeadLetterMax int
+	// WebhookDedupTTL is how long an X-Razorpay-Event-Id is remembered, so
+	// a redelivery within it is acknowledged without being processed again;
+	// zero disables it
+	WebhookDedupTTL time.Duration
+	// Notification channels are enabled by setting their destination
+	NotifySlackWebhookURL string
+	NotifyCallbackURL     string
+	NotifyCallbackSecret  string
+	NotifySMTPAddr        string
+	NotifySMTPUsername    string
+	NotifySMTPPassword    string
+	NotifyEmailFrom       string
+	NotifyEmailTo         []string
+	// NotifyForwardHeaders are the request headers copied onto events
+	NotifyForwardHeaders []string
+	// NotifyQueueSize, NotifyMaxAttempts and NotifyRetryBackoff apply to
+	// each channel independently
+	NotifyQueueSize    int
+	NotifyMaxAttempts  int
+	NotifyRetryBackoff time.Duration
+	// SMSProvider texts customers through SMSProviderMSG91 or
+	// SMSProviderTwilio, for the events SMSTemplatesFile has a text for;
+	// empty disables SMS
+	SMSProvider      string
+	SMSTemplatesFile string
+	// SMSMaxSegments is the most segments a text may take; longer ones are
+	// not sent
+	SMSMaxSegments int
+	// SMSRateLimit is the most texts sent per second
+	SMSRateLimit int
+	// SMSCountryCode is assumed for contacts given without one
+	SMSCountryCode string
+	// SMSSuppressed are the contacts that opted out of texts
+	SMSSuppressed []string
+	// SMSStatusCallbackURL is the public URL of the SMS status callback,
+	// which Twilio is told to call and signs over
+	SMSStatusCallbackURL string
+	// SMSStatusToken authenticates MSG91 delivery reports, which must put
+	// it in the token query parameter
+	SMSStatusToken            string
+	MSG91AuthKey              string
+	MSG91SenderID             string
+	MSG91Route                string
+	TwilioAccountSID          string
+	TwilioAuthToken           string
+	TwilioFrom                string
+	TwilioMessagingServiceSID string
+	// ArchiveS3Bucket enables archiving orders and dead-lettered webhooks
+	// not updated for ArchiveAfter to the S3-compatible ArchiveS3Endpoint,
+	// at most ArchiveBatchSize of each every ArchiveInterval
+	ArchiveS3Bucket    string
+	ArchiveS3Endpoint  string
+	ArchiveS3Region    string
+	ArchiveS3AccessKey string
+	ArchiveS3SecretKey string
+	ArchiveAfter       time.Duration
+	ArchiveInterval    time.Duration
+	ArchiveBatchSize   int
+	// FreezeTime stops the service clock at this instant, for reproducing
+	// time-sensitive bugs. It is refused in release mode.
+	FreezeTime time.Time
+	// MetricsPushgatewayURL receives a final metrics push on shutdown
+	MetricsPushgatewayURL string
+	// MetricsFlushTimeout bounds that final push
+	MetricsFlushTimeout time.Duration
+	// CapturePolicyFile holds the rules applied to authorized payments,
+	// reloaded on SIGHUP; authorized payments are left alone when unset
+	CapturePolicyFile string
+	// FeatureFlagsFile holds the soft-launch flags, reloaded on SIGHUP;
+	// every flag is off when unset
+	FeatureFlagsFile string
+	// CaptureAuthWindow is how long Razorpay keeps an authorization before
+	// releasing it, and CaptureVoidMargin how long before that held
+	// payments are given up on
+	CaptureAuthWindow time.Duration
+	CaptureVoidMargin time.Duration
+	// OrderExpiry is how long an unpaid order stays open before it is
+	// expired; zero never expires orders
+	OrderExpiry time.Duration
+	// LateCaptureGrace is how long after an order expires a payment for it
+	// is still accepted and reverses the expiry
+	LateCaptureGrace time.Duration
+	// EventStreamBuffer is how many recent events the admin stream keeps
+	// for clients resuming with Last-Event-ID
+	EventStreamBuffer int
+	// ListPageDelay is waited between pages when walking Razorpay lists
+	ListPageDelay time.Duration
+	// ListMaxItems caps how many records one list walk returns
+	ListMaxItems int
+	// RequestTimeout bounds each API request end to end
+	RequestTimeout time.Duration
+	// MetricsMerchantLabels adds a merchant label to the request and
+	// verification metrics, with at most MetricsMerchantLabelLimit distinct
+	// values before the rest share "other". Each merchant multiplies the
+	// series of those metrics, so keep the limit modest.
+	MetricsMerchantLabels     bool
+	MetricsMerchantLabelLimit int
+	// FulfillmentAllowedHosts are the hostnames an order's fulfillment_url
+	// may point at; "*.example.com" allows subdomains. Fulfillment URLs are
+	// refused when empty.
+	FulfillmentAllowedHosts []string
+	// FulfillmentSecret signs fulfillment deliveries in X-Signature
+	FulfillmentSecret string
+	// FulfillmentMaxAttempts and FulfillmentRetryBackoff bound the retries
+	// of a fulfillment delivery before it is dead-lettered
+	FulfillmentMaxAttempts  int
+	FulfillmentRetryBackoff time.Duration
+	// Egress* is the policy of every request to a URL taken from config or
+	// from a request: fulfillment, notification callbacks, the archive
+	// store and the Pushgateway. Only EgressAllowedSchemes may be used, and
+	// hosts must resolve to public addresses, unless they are one of
+	// EgressAllowedHosts, which internal services such as a Pushgateway
+	// must be. EgressDeniedHosts are refused outright. Redirects are not
+	// followed unless EgressMaxRedirects allows them.
+	EgressAllowedSchemes   []string
+	EgressAllowedHosts     []string
+	EgressDeniedHosts      []string
+	EgressMaxResponseBytes int
+	EgressMaxRedirects     int
+	// OrderDefaultNotes are added to every order's notes, e.g. env and
+	// service_version, unless the caller sets the same key
+	OrderDefaultNotes map[string]string
+	// DefaultCurrency is the currency of orders that name none, and
+	// AllowedCurrencies those orders may use; both are overridden per
+	// merchant in multi-tenant mode
+	DefaultCurrency   string
+	AllowedCurrencies []string
+	// VerifyBatchTimeout bounds a whole batch verification, and
+	// VerifyBatchConcurrency how many of its items are checked at once
+	VerifyBatchTimeout     time.Duration
+	VerifyBatchConcurrency int
+	// VerifyBatchRateLimit is how many batch verifications one caller may
+	// send per minute
+	VerifyBatchRateLimit int
+	// OrderFetchConcurrency is how many orders of a batch fetch are
+	// fetched at once
+	OrderFetchConcurrency int
+	// BatchConcurrency is how many orders of a batch create are created
+	// at once; 1 creates them one after another
+	BatchConcurrency int
+	// StatusTokenTTL is how long the status token minted on verification
+	// stays valid
+	StatusTokenTTL time.Duration
+	// PublicStatusRateLimit is how many public status lookups one client IP
+	// may make per minute
+	PublicStatusRateLimit int
+	// MerchantRateLimit is how many API requests one merchant may make per
+	// minute unless its tenant sets its own; zero disables the limit
+	MerchantRateLimit int
+	// WebhookPublicURL is where Razorpay reaches this service's webhook
+	// endpoint; webhook provisioning and drift checks need it
+	WebhookPublicURL string
+	// WebhookEvents are the events the provisioned webhook subscribes to;
+	// the events the service handles when unset
+	WebhookEvents []string
+	// WebhookReplayWindow is how old a webhook event's created_at may be;
+	// zero accepts any age
+	WebhookReplayWindow time.Duration
+	// WebhookMaxClockSkew is how far Razorpay's clock may be from ours when
+	// checking created_at, either way
+	WebhookMaxClockSkew time.Duration
+	// WebhookDriftCheckInterval is how often the remote webhook is compared
+	// with the expected one; zero disables the check
+	WebhookDriftCheckInterval time.Duration
+	// RefundTransferReversals is ReversalsBlock to refuse refunds whose
+	// transfers are not yet reversed in proportion, ReversalsAuto to
+	// reverse them along with the refund, or ReversalsOff to not check
+	RefundTransferReversals string
+	// RefundApprovalThreshold is the refund amount, in minor units, above
+	// which a second admin must approve the refund; zero disables approvals
+	RefundApprovalThreshold int
+	// RefundApprovalTTL is how long a refund waits for approval before it
+	// is rejected automatically
+	RefundApprovalTTL time.Duration
+	// ScheduleMaxAttempts is how many times a scheduled refund or capture is
+	// tried, ScheduleRetryBackoff the wait before the first retry, doubling
+	// after each
+	ScheduleMaxAttempts  int
+	ScheduleRetryBackoff time.Duration
+	// OrderDryRunEnabled lets order creation requests set dry_run
+	OrderDryRunEnabled bool
+	// CheckoutMethodsTTL is how long the account's enabled payment methods
+	// are served before being revalidated with Razorpay
+	CheckoutMethodsTTL time.Duration
+	// CheckoutMethodsDefault are the methods advertised when Razorpay has
+	// never answered; none are advertised when unset
+	CheckoutMethodsDefault []string
+	// ClockSkewTolerance is how far apart this and other instances' clocks
+	// may be before time-window checks fail
+	ClockSkewTolerance time.Duration
+	// NTPServer is the reference the admin time diagnostic estimates the
+	// clock's offset against; no estimate is made when unset
+	NTPServer string
+	// CompressionLevel is the gzip level, 1 to 9, responses are compressed
+	// at; zero disables compression
+	CompressionLevel int
+	// CompressionMinSize is the smallest response body compressed, in bytes
+	CompressionMinSize int
+	// V1Deprecation is when the v1 API was deprecated and V1Sunset when it
+	// goes away, announced in response headers; zero when unset
+	V1Deprecation time.Time
+	V1Sunset      time.Time
+	// FunnelRetention is how long an order's funnel events are kept for
+	// analytics, and FunnelMaxOrders how many orders at most
+	FunnelRetention time.Duration
+	FunnelMaxOrders int
+	// FunnelBeaconRateLimit is how many checkout beacons one client IP may
+	// send per minute
+	FunnelBeaconRateLimit int
+	// CreditHoldTTL is how long store credit stays held for an unpaid order
+	CreditHoldTTL time.Duration
+	// ShutdownTimeout bounds request draining and webhook queue draining
+	ShutdownTimeout time.Duration
+	// CheckOnly validates configuration and connectivity and exits instead
+	// of serving, like the --check flag
+	CheckOnly bool
+	// PaymentRecoveryEnabled sends customers a fresh checkout link after a
+	// recoverable payment failure
+	PaymentRecoveryEnabled bool
+	// PaymentRecoveryURL is the checkout page the link opens; order_id and
+	// order_token are added to its query
+	PaymentRecoveryURL string
+	// PaymentRecoveryWindow is how long after an order is created a failed
+	// payment on it is still followed up
+	PaymentRecoveryWindow time.Duration
+	// PaymentRecoveryReasons are the failure reasons, or error codes, that
+	// are followed up; others are left alone
+	PaymentRecoveryReasons []string
+	// PaymentRecoveryQuietStart and PaymentRecoveryQuietEnd are the hours,
+	// in IST, between which no recovery links are sent; those falling due
+	// wait for the end. Equal hours mean no quiet hours.
+	PaymentRecoveryQuietStart int
+	PaymentRecoveryQuietEnd   int
+	// AbandonRecoveryDelay is how long after a checkout is abandoned its
+	// recovery link is sent; zero sends none
+	AbandonRecoveryDelay time.Duration
+	// TagVocabulary are the tags orders may carry
+	TagVocabulary []string
+	// TagRulesFile tags orders automatically on creation, authorization
+	// and status changes
+	TagRulesFile string
+	// StrictJSONFields rejects payment request bodies carrying fields the
+	// endpoint does not take, instead of ignoring them
+	StrictJSONFields bool
+	// RequestIDHeader is the header carrying request IDs in both directions
+	RequestIDHeader string
+	// VerifyClientBinding hands out a client token on order creation and
+	// refuses verifications of the order not presenting it
+	VerifyClientBinding bool
+	// ClientTokenTTL is how long a client token can verify its order
+	ClientTokenTTL time.Duration
+	// VerifyPaymentFetch fetches each verified payment from Razorpay and
+	// refuses it unless it paid the order's stored amount. On by default;
+	// turning it off saves a Razorpay call per verification.
+	VerifyPaymentFetch bool
+	// RoundingMode rounds amounts converted between currencies to whole
+	// minor units, one of the Round* modes. The rounded amount is the one
+	// charged and reconciled: each conversion is off by under one minor
+	// unit, half of one for half-up and bankers. Floor and ceil always err
+	// the same way, so over many orders their differences add up, in the
+	// customer's favour for floor; bankers' rounding evens them out.
+	RoundingMode string
+	// APIContentSecurityPolicy and HTMLContentSecurityPolicy override the
+	// Content-Security-Policy of JSON responses and of HTML pages
+	APIContentSecurityPolicy  string
+	HTMLContentSecurityPolicy string
+	// HSTSMaxAge is the Strict-Transport-Security max-age sent on HTTPS
+	// requests; zero disables the header
+	HSTSMaxAge time.Duration
+	// TrustProxyHTTPS believes X-Forwarded-Proto when deciding whether a
+	// request came over HTTPS; set it only behind a proxy that overwrites it
+	TrustProxyHTTPS bool
+}
+
+// Load reads the configuration from the environment, applying defaults and
+// rejecting malformed values
+func Load() (Config, error) {
+	config := Config{
+		Mode:              os.Getenv("GIN_MODE"),
+		APIKey:            os.Getenv("RAZORPAY_API_KEY"),
+		SecretKey:         os.Getenv("RAZORPAY_SECRET_KEY"),
+		Port:              os.Getenv("PORT"),
+		NotesSchemaFile:   os.Getenv("NOTES_SCHEMA_FILE"),
+		NotesSchemaMode:   os.Getenv("NOTES_SCHEMA_MODE"),
+		NoteValueOverflow: os.Getenv("NOTE_VALUE_OVERFLOW"),
+		RazorpayBaseURL:   os.Getenv("RAZORPAY_BASE_URL"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		TenantsFile:       os.Getenv("TENANTS_FILE"),
+		AccountsFile:      os.Getenv("RAZORPAY_ACCOUNTS_FILE"),
+		BrandsFile:        os.Getenv("BRANDS_FILE"),
+		DefaultBrand:      os.Getenv("DEFAULT_BRAND"),
+		APIKeysFile:       os.Getenv("API_KEYS_FILE"),
+		WebhookSecret:     os.Getenv("RAZORPAY_WEBHOOK_SECRET"),
+
+		MetricsPushgatewayURL: os.Getenv("METRICS_PUSHGATEWAY_URL"),
+		ReceiptMerchantName:   os.Getenv("RECEIPT_MERCHANT_NAME"),
+		TagRulesFile:          os.Getenv("TAG_RULES_FILE"),
+		CapturePolicyFile:     os.Getenv("CAPTURE_POLICY_FILE"),
+		FeatureFlagsFile:      os.Getenv("FEATURE_FLAGS_FILE"),
+
+		NotifySlackWebhookURL: os.Getenv("NOTIFY_SLACK_WEBHOOK_URL"),
+		NotifyCallbackURL:     os.Getenv("NOTIFY_CALLBACK_URL"),
+		NotifyCallbackSecret:  os.Getenv("NOTIFY_CALLBACK_SECRET"),
+		NotifySMTPAddr:        os.Getenv("NOTIFY_SMTP_ADDR"),
+		NotifySMTPUsername:    os.Getenv("NOTIFY_SMTP_USERNAME"),
+		NotifySMTPPassword:    os.Getenv("NOTIFY_SMTP_PASSWORD"),
+		NotifyEmailFrom:       os.Getenv("NOTIFY_EMAIL_FROM"),
+		FulfillmentSecret:     os.Getenv("FULFILLMENT_SECRET"),
+
+		SMSProvider:               os.Getenv("SMS_PROVIDER"),
+		SMSTemplatesFile:          os.Getenv("SMS_TEMPLATES_FILE"),
+		SMSCountryCode:            os.Getenv("SMS_COUNTRY_CODE"),
+		SMSStatusCallbackURL:      os.Getenv("SMS_STATUS_CALLBACK_URL"),
+		SMSStatusToken:            os.Getenv("SMS_STATUS_TOKEN"),
+		MSG91AuthKey:              os.Getenv("MSG91_AUTH_KEY"),
+		MSG91SenderID:             os.Getenv("MSG91_SENDER_ID"),
+		MSG91Route:                os.Getenv("MSG91_ROUTE"),
+		TwilioAccountSID:          os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:           os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioFrom:                os.Getenv("TWILIO_FROM"),
+		TwilioMessagingServiceSID: os.Getenv("TWILIO_MESSAGING_SERVICE_SID"),
+
+		ArchiveS3Bucket:    os.Getenv("ARCHIVE_S3_BUCKET"),
+		ArchiveS3Endpoint:  os.Getenv("ARCHIVE_S3_ENDPOINT"),
+		ArchiveS3Region:    os.Getenv("ARCHIVE_S3_REGION"),
+		ArchiveS3AccessKey: os.Getenv("ARCHIVE_S3_ACCESS_KEY"),
+		ArchiveS3SecretKey: os.Getenv("ARCHIVE_S3_SECRET_KEY"),
+
+		DefaultCurrency: strings.ToUpper(os.Getenv("DEFAULT_CURRENCY")),
+
+		RefundTransferReversals: os.Getenv("REFUND_TRANSFER_REVERSALS"),
+		WebhookPublicURL:        os.Getenv("WEBHOOK_PUBLIC_URL"),
+		IdempotencyBackend:      os.Getenv("IDEMPOTENCY_BACKEND"),
+		RedisURL:                os.Getenv("REDIS_URL"),
+		StoreWritePolicy:        os.Getenv("STORE_WRITE_POLICY"),
+		NTPServer:               os.Getenv("NTP_SERVER"),
+		RequestIDHeader:         os.Getenv("REQUEST_ID_HEADER"),
+		RoundingMode:            os.Getenv("ROUNDING_MODE"),
+
+		APIContentSecurityPolicy:  os.Getenv("API_CONTENT_SECURITY_POLICY"),
+		HTMLContentSecurityPolicy: os.Getenv("HTML_CONTENT_SECURITY_POLICY"),
+	}
+
+	switch config.Mode {
+	case "":
+		config.Mode = ModeTest
+	case ModeDebug, ModeRelease, ModeTest:
+	default:
+		return Config{}, fmt.Errorf("invalid GIN_MODE %q", config.Mode)
+	}
+	if config.RazorpayBaseURL != "" && config.Mode == ModeRelease {
+		log.Printf("Ignoring RAZORPAY_BASE_URL in release mode")
+		config.RazorpayBaseURL = ""
+	}
+
+	var err error
+	if config.AllowedOrigins, err = origins("ALLOWED_ORIGINS", config.Mode == ModeRelease); err != nil {
+		return Config{}, err
+	}
+	if config.AdminAllowedOrigins, err = origins("ADMIN_ALLOWED_ORIGINS", config.Mode == ModeRelease); err != nil {
+		return Config{}, err
+	}
+
+	if v := os.Getenv("NOTIFY_FORWARD_HEADERS"); v != "" {
+		config.NotifyForwardHeaders = list(v)
+	}
+	if v := os.Getenv("NOTIFY_EMAIL_TO"); v != "" {
+		config.NotifyEmailTo = list(v)
+	}
+	if config.NotifySMTPAddr != "" && (config.NotifyEmailFrom == "" || len(config.NotifyEmailTo) == 0) {
+		return Config{}, fmt.Errorf("NOTIFY_SMTP_ADDR requires NOTIFY_EMAIL_FROM and NOTIFY_EMAIL_TO")
+	}
+	if v := os.Getenv("SMS_SUPPRESSED"); v != "" {
+		config.SMSSuppressed = list(v)
+	}
+
+	if config.DefaultCurrency == "" {
+		config.DefaultCurrency = "INR"
+	}
+
+	if config.RequestIDHeader == "" {
+		config.RequestIDHeader = "X-Request-ID"
+	}
+	if !headerName.MatchString(config.RequestIDHeader) {
+		return Config{}, fmt.Errorf("invalid REQUEST_ID_HEADER %q", config.RequestIDHeader)
+	}
+	if v := os.Getenv("ALLOWED_CURRENCIES"); v != "" {
+		config.AllowedCurrencies = list(strings.ToUpper(v))
+	} else {
+		config.AllowedCurrencies = []string{config.DefaultCurrency}
+	}
+
+	if v := os.Getenv("FULFILLMENT_ALLOWED_HOSTS"); v != "" {
+		config.FulfillmentAllowedHosts = list(strings.ToLower(v))
+		if config.FulfillmentSecret == "" {
+			return Config{}, fmt.Errorf("FULFILLMENT_ALLOWED_HOSTS requires FULFILLMENT_SECRET")
+		}
+	}
+
+	config.EgressAllowedSchemes = []string{"https"}
+	if v := os.Getenv("EGRESS_ALLOWED_SCHEMES"); v != "" {
+		config.EgressAllowedSchemes = list(strings.ToLower(v))
+		for _, scheme := range config.EgressAllowedSchemes {
+			if scheme != "https" && scheme != "http" {
+				return Config{}, fmt.Errorf("invalid EGRESS_ALLOWED_SCHEMES entry %q", scheme)
+			}
+		}
+	}
+	config.EgressAllowedHosts = list(strings.ToLower(os.Getenv("EGRESS_ALLOWED_HOSTS")))
+	config.EgressDeniedHosts = list(strings.ToLower(os.Getenv("EGRESS_DENIED_HOSTS")))
+
+	if v := os.Getenv("TAG_VOCABULARY"); v != "" {
+		config.TagVocabulary = list(strings.ToLower(v))
+	}
+	if config.TagRulesFile != "" && len(config.TagVocabulary) == 0 {
+		return Config{}, fmt.Errorf("TAG_RULES_FILE requires TAG_VOCABULARY")
+	}
+
+	if v := os.Getenv("WEBHOOK_EVENTS"); v != "" {
+		config.WebhookEvents = list(v)
+	}
+	if config.WebhookPublicURL != "" && config.WebhookSecret == "" {
+		return Config{}, fmt.Errorf("WEBHOOK_PUBLIC_URL requires RAZORPAY_WEBHOOK_SECRET")
+	}
+	if config.DefaultBrand != "" && config.BrandsFile == "" {
+		return Config{}, fmt.Errorf("DEFAULT_BRAND requires BRANDS_FILE")
+	}
+
+	if v := os.Getenv("CHECKOUT_METHODS_DEFAULT"); v != "" {
+		config.CheckoutMethodsDefault = list(strings.ToLower(v))
+	}
+
+	if v := os.Getenv("ORDER_DEFAULT_NOTES"); v != "" {
+		config.OrderDefaultNotes = make(map[string]string)
+		for _, pair := range list(v) {
+			key, value, ok := strings.Cut(pair, "=")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				return Config{}, fmt.Errorf("invalid ORDER_DEFAULT_NOTES entry %q, want key=value", pair)
+			}
+			config.OrderDefaultNotes[key] = strings.TrimSpace(value)
+		}
+	}
+
+	if config.V1Deprecation, err = date("API_V1_DEPRECATION"); err != nil {
+		return Config{}, err
+	}
+	if config.V1Sunset, err = date("API_V1_SUNSET"); err != nil {
+		return Config{}, err
+	}
+	if !config.V1Sunset.IsZero() && config.V1Sunset.Before(config.V1Deprecation) {
+		return Config{}, fmt.Errorf("API_V1_SUNSET must not be before API_V1_DEPRECATION")
+	}
+
+	if v := os.Getenv("FREEZE_TIME"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid FREEZE_TIME %q", v)
+		}
+		if config.Mode == ModeRelease {
+			return Config{}, fmt.Errorf("FREEZE_TIME is not allowed in release mode")
+		}
+		config.FreezeTime = t
+	}
+
+	if v := os.Getenv("METRICS_MERCHANT_LABELS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid METRICS_MERCHANT_LABELS %q", v)
+		}
+		config.MetricsMerchantLabels = enabled
+	}
+
+	if v := os.Getenv("ORDER_DRY_RUN_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ORDER_DRY_RUN_ENABLED %q", v)
+		}
+		config.OrderDryRunEnabled = enabled
+	}
+
+	if v := os.Getenv("STRICT_JSON_FIELDS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid STRICT_JSON_FIELDS %q", v)
+		}
+		config.StrictJSONFields = enabled
+	}
+
+	if v := os.Getenv("VERIFY_CLIENT_BINDING"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid VERIFY_CLIENT_BINDING %q", v)
+		}
+		config.VerifyClientBinding = enabled
+	}
+
+	config.VerifyPaymentFetch = true
+	if v := os.Getenv("VERIFY_PAYMENT_FETCH"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid VERIFY_PAYMENT_FETCH %q", v)
+		}
+		config.VerifyPaymentFetch = enabled
+	}
+
+	if v := os.Getenv("TRUST_PROXY_HTTPS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRUST_PROXY_HTTPS %q", v)
+		}
+		config.TrustProxyHTTPS = enabled
+	}
+
+	if v := os.Getenv("PAYMENT_RECOVERY_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PAYMENT_RECOVERY_ENABLED %q", v)
+		}
+		config.PaymentRecoveryEnabled = enabled
+	}
+	config.PaymentRecoveryURL = os.Getenv("PAYMENT_RECOVERY_URL")
+	if config.PaymentRecoveryEnabled {
+		if u, err := url.Parse(config.PaymentRecoveryURL); err != nil || !u.IsAbs() || u.Host == "" {
+			return Config{}, fmt.Errorf("PAYMENT_RECOVERY_ENABLED requires PAYMENT_RECOVERY_URL as an absolute URL")
+		}
+	}
+	config.PaymentRecoveryReasons = defaultRecoveryReasons
+	if v := os.Getenv("PAYMENT_RECOVERY_REASONS"); v != "" {
+		config.PaymentRecoveryReasons = list(v)
+	}
+	config.PaymentRecoveryQuietStart, config.PaymentRecoveryQuietEnd = 21, 9
+	if v := os.Getenv("PAYMENT_RECOVERY_QUIET_HOURS"); v != "" {
+		start, end, err := hourRange(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PAYMENT_RECOVERY_QUIET_HOURS %q: %w", v, err)
+		}
+		config.PaymentRecoveryQuietStart, config.PaymentRecoveryQuietEnd = start, end
+	}
+
+	if v := os.Getenv("PROVIDER_FAILOVER_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PROVIDER_FAILOVER_ENABLED %q", v)
+		}
+		config.ProviderFailover = enabled
+	}
+	if config.ProviderFailover {
+		config.FailoverAPIKey = os.Getenv("FAILOVER_RAZORPAY_API_KEY")
+		config.FailoverSecretKey = os.Getenv("FAILOVER_RAZORPAY_SECRET_KEY")
+		if config.FailoverAPIKey == "" || config.FailoverSecretKey == "" {
+			return Config{}, fmt.Errorf("PROVIDER_FAILOVER_ENABLED requires FAILOVER_RAZORPAY_API_KEY and FAILOVER_RAZORPAY_SECRET_KEY")
+		}
+		if config.FailoverAPIKey == config.APIKey {
+			return Config{}, fmt.Errorf("FAILOVER_RAZORPAY_API_KEY must name another account than RAZORPAY_API_KEY")
+		}
+	}
+
+	if config.AccountsFile != "" && config.ProviderFailover {
+		return Config{}, fmt.Errorf("RAZORPAY_ACCOUNTS_FILE cannot be combined with PROVIDER_FAILOVER_ENABLED")
+	}
+
+	if v := os.Getenv("CHECK_ONLY"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CHECK_ONLY %q", v)
+		}
+		config.CheckOnly = enabled
+	}
+
+	if config.Port == "" {
+		config.Port = "8080"
+	}
+
+	durations := []struct {
+		env       string
+		target    *time.Duration
+		def       time.Duration
+		allowZero bool
+	}{
+		{"CORS_MAX_AGE", &config.CORSMaxAge, 12 * time.Hour, true},
+		{"CHECKOUT_SESSION_TTL", &config.SessionTTL, 30 * time.Minute, false},
+		{"ORDER_TOKEN_TTL", &config.OrderTokenTTL, 30 * time.Minute, false},
+		{"CLIENT_TOKEN_TTL", &config.ClientTokenTTL, 24 * time.Hour, false},
+		{"RAZORPAY_TIMEOUT", &config.RazorpayTimeout, 10 * time.Second, false},
+		{"VERIFY_REPLAY_TTL", &config.VerifyReplayTTL, 24 * time.Hour, false},
+		{"RECEIPT_LOCK_TTL", &config.ReceiptLockTTL, time.Minute, false},
+		{"RECEIPT_RECORD_TTL", &config.ReceiptRecordTTL, 24 * time.Hour, false},
+		{"CLOCK_SKEW_TOLERANCE", &config.ClockSkewTolerance, time.Minute, true},
+		{"WEBHOOK_REPLAY_WINDOW", &config.WebhookReplayWindow, 48 * time.Hour, true},
+		{"WEBHOOK_MAX_CLOCK_SKEW", &config.WebhookMaxClockSkew, 30 * time.Second, true},
+		{"WEBHOOK_DEDUP_TTL", &config.WebhookDedupTTL, 24 * time.Hour, true},
+		{"HEALTH_CHECK_TIMEOUT", &config.HealthCheckTimeout, 2 * time.Second, false},
+		{"ORDER_CACHE_MAX_STALENESS", &config.OrderCacheMaxStaleness, 5 * time.Minute, true},
+		{"SHUTDOWN_TIMEOUT", &config.ShutdownTimeout, 15 * time.Second, false},
+		{"REQUEST_TIMEOUT", &config.RequestTimeout, 30 * time.Second, true},
+		{"NOTIFY_RETRY_BACKOFF", &config.NotifyRetryBackoff, time.Second, false},
+		{"METRICS_FLUSH_TIMEOUT", &config.MetricsFlushTimeout, 5 * time.Second, false},
+		{"CAPTURE_AUTH_WINDOW", &config.CaptureAuthWindow, 5 * 24 * time.Hour, false},
+		{"CAPTURE_VOID_MARGIN", &config.CaptureVoidMargin, time.Hour, true},
+		{"ORDER_EXPIRY", &config.OrderExpiry, 0, true},
+		{"LATE_CAPTURE_GRACE", &config.LateCaptureGrace, 30 * time.Minute, true},
+		{"LIST_PAGE_DELAY", &config.ListPageDelay, 200 * time.Millisecond, true},
+		{"STATUS_TOKEN_TTL", &config.StatusTokenTTL, 7 * 24 * time.Hour, false},
+		{"VERIFY_BATCH_TIMEOUT", &config.VerifyBatchTimeout, 20 * time.Second, false},
+		{"FULFILLMENT_RETRY_BACKOFF", &config.FulfillmentRetryBackoff, 2 * time.Second, false},
+		{"CHECKOUT_METHODS_TTL", &config.CheckoutMethodsTTL, 10 * time.Minute, false},
+		{"WEBHOOK_DRIFT_CHECK_INTERVAL", &config.WebhookDriftCheckInterval, time.Hour, true},
+		{"FUNNEL_RETENTION", &config.FunnelRetention, 30 * 24 * time.Hour, false},
+		{"CREDIT_HOLD_TTL", &config.CreditHoldTTL, time.Hour, false},
+		{"REFUND_APPROVAL_TTL", &config.RefundApprovalTTL, 7 * 24 * time.Hour, false},
+		{"SCHEDULE_RETRY_BACKOFF", &config.ScheduleRetryBackoff, time.Minute, false},
+		{"PAYMENT_RECOVERY_WINDOW", &config.PaymentRecoveryWindow, 24 * time.Hour, false},
+		{"ABANDON_RECOVERY_DELAY", &config.AbandonRecoveryDelay, 0, true},
+		{"HSTS_MAX_AGE", &config.HSTSMaxAge, 365 * 24 * time.Hour, true},
+		{"WEBHOOK_REORDER_DELAY", &config.WebhookReorderDelay, 30 * time.Second, true},
+		{"ARCHIVE_AFTER", &config.ArchiveAfter, 2 * 365 * 24 * time.Hour, false},
+		{"ARCHIVE_INTERVAL", &config.ArchiveInterval, time.Hour, false},
+	}
+	for _, d := range durations {
+		v, err := duration(d.env, d.def, d.allowZero)
+		if err != nil {
+			return Config{}, err
+		}
+		*d.target = v
+	}
+
+	ints := []struct {
+		env    string
+		target *int
+		def    int
+		min    int
+	}{
+		{"ORDER_CACHE_SIZE", &config.OrderCacheSize, 10000, 0},
+		{"WEBHOOK_WORKERS", &config.WebhookWorkers, 4, 1},
+		{"WEBHOOK_QUEUE_SIZE", &config.WebhookQueueSize, 256, 1},
+		{"WEBHOOK_REORDER_MAX_PARKED", &config.WebhookReorderMaxParked, 1000, 1},
+		{"WEBHOOK_DEAD_LETTER_MAX", &config.WebhookDeadLetterMax, 1000, 1},
+		{"NOTIFY_QUEUE_SIZE", &config.NotifyQueueSize, 100, 1},
+		{"NOTIFY_MAX_ATTEMPTS", &config.NotifyMaxAttempts, 5, 1},
+		{"LIST_MAX_ITEMS", &config.ListMaxItems, 10000, 1},
+		{"EVENT_STREAM_BUFFER", &config.EventStreamBuffer, 256, 0},
+		{"PUBLIC_STATUS_RATE_LIMIT", &config.PublicStatusRateLimit, 30, 1},
+		{"MERCHANT_RATE_LIMIT", &config.MerchantRateLimit, 600, 0},
+		{"VERIFY_BATCH_CONCURRENCY", &config.VerifyBatchConcurrency, 8, 1},
+		{"VERIFY_BATCH_RATE_LIMIT", &config.VerifyBatchRateLimit, 10, 1},
+		{"ORDER_FETCH_CONCURRENCY", &config.OrderFetchConcurrency, 8, 1},
+		{"BATCH_CONCURRENCY", &config.BatchConcurrency, 4, 1},
+		{"FULFILLMENT_MAX_ATTEMPTS", &config.FulfillmentMaxAttempts, 8, 1},
+		{"METRICS_MERCHANT_LABEL_LIMIT", &config.MetricsMerchantLabelLimit, 50, 1},
+		{"COMPRESSION_LEVEL", &config.CompressionLevel, 6, 0},
+		{"COMPRESSION_MIN_SIZE", &config.CompressionMinSize, 1024, 0},
+		{"FUNNEL_MAX_ORDERS", &config.FunnelMaxOrders, 100000, 1},
+		{"FUNNEL_BEACON_RATE_LIMIT", &config.FunnelBeaconRateLimit, 60, 1},
+		{"REFUND_APPROVAL_THRESHOLD", &config.RefundApprovalThreshold, 500000, 0},
+		{"NOTE_VALUE_MAX_LENGTH", &config.NoteValueMaxLength, 256, 1},
+		{"SCHEDULE_MAX_ATTEMPTS", &config.ScheduleMaxAttempts, 5, 1},
+		{"SMS_MAX_SEGMENTS", &config.SMSMaxSegments, 3, 1},
+		{"SMS_RATE_LIMIT", &config.SMSRateLimit, 10, 1},
+		{"ARCHIVE_BATCH_SIZE", &config.ArchiveBatchSize, 500, 1},
+		{"EGRESS_MAX_RESPONSE_BYTES", &config.EgressMaxResponseBytes, 1 << 20, 1},
+		{"EGRESS_MAX_REDIRECTS", &config.EgressMaxRedirects, 0, 0},
+	}
+	for _, i := range ints {
+		v, err := integer(i.env, i.def, i.min)
+		if err != nil {
+			return Config{}, err
+		}
+		*i.target = v
+	}
+
+	if config.CompressionLevel > 9 {
+		return Config{}, fmt.Errorf("invalid COMPRESSION_LEVEL %d", config.CompressionLevel)
+	}
+
+	// The batch must finish in time to send its partial results
+	if config.RequestTimeout > 0 && config.VerifyBatchTimeout >= config.RequestTimeout {
+		return Config{}, fmt.Errorf("VERIFY_BATCH_TIMEOUT must be shorter than REQUEST_TIMEOUT")
+	}
+
+	if config.CaptureVoidMargin >= config.CaptureAuthWindow {
+		return Config{}, fmt.Errorf("CAPTURE_VOID_MARGIN must be shorter than CAPTURE_AUTH_WINDOW")
+	}
+
+	if config.NotesSchemaMode == "" {
+		config.NotesSchemaMode = NotesModeEnforce
+	}
+	if config.NotesSchemaMode != NotesModeEnforce && config.NotesSchemaMode != NotesModePermissive {
+		return Config{}, fmt.Errorf("invalid NOTES_SCHEMA_MODE %q", config.NotesSchemaMode)
+	}
+
+	switch config.NoteValueOverflow {
+	case "":
+		config.NoteValueOverflow = NoteOverflowReject
+	case NoteOverflowReject, NoteOverflowTruncate:
+	default:
+		return Config{}, fmt.Errorf("invalid NOTE_VALUE_OVERFLOW %q", config.NoteValueOverflow)
+	}
+
+	switch config.RoundingMode {
+	case "":
+		config.RoundingMode = RoundHalfUp
+	case RoundHalfUp, RoundBankers, RoundFloor, RoundCeil:
+	default:
+		return Config{}, fmt.Errorf("invalid ROUNDING_MODE %q", config.RoundingMode)
+	}
+
+	switch config.RefundTransferReversals {
+	case "":
+		config.RefundTransferReversals = ReversalsBlock
+	case ReversalsBlock, ReversalsAuto, ReversalsOff:
+	default:
+		return Config{}, fmt.Errorf("invalid REFUND_TRANSFER_REVERSALS %q", config.RefundTransferReversals)
+	}
+
+	if config.SMSCountryCode == "" {
+		config.SMSCountryCode = "91"
+	}
+	if !countryCode.MatchString(config.SMSCountryCode) {
+		return Config{}, fmt.Errorf("invalid SMS_COUNTRY_CODE %q", config.SMSCountryCode)
+	}
+	switch config.SMSProvider {
+	case "":
+	case SMSProviderMSG91:
+		if config.MSG91AuthKey == "" || config.MSG91SenderID == "" {
+			return Config{}, fmt.Errorf("SMS_PROVIDER=msg91 requires MSG91_AUTH_KEY and MSG91_SENDER_ID")
+		}
+		if config.MSG91Route == "" {
+			config.MSG91Route = "4"
+		}
+	case SMSProviderTwilio:
+		if config.TwilioAccountSID == "" || config.TwilioAuthToken == "" {
+			return Config{}, fmt.Errorf("SMS_PROVIDER=twilio requires TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN")
+		}
+		if config.TwilioFrom == "" && config.TwilioMessagingServiceSID == "" {
+			return Config{}, fmt.Errorf("SMS_PROVIDER=twilio requires TWILIO_FROM or TWILIO_MESSAGING_SERVICE_SID")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid SMS_PROVIDER %q", config.SMSProvider)
+	}
+	if config.SMSProvider != "" && config.SMSTemplatesFile == "" {
+		return Config{}, fmt.Errorf("SMS_PROVIDER requires SMS_TEMPLATES_FILE")
+	}
+
+	switch config.IdempotencyBackend {
+	case "":
+		config.IdempotencyBackend = IdempotencyMemory
+	case IdempotencyMemory:
+	case IdempotencyRedis:
+		if config.RedisURL == "" {
+			return Config{}, fmt.Errorf("IDEMPOTENCY_BACKEND=redis requires REDIS_URL")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid IDEMPOTENCY_BACKEND %q", config.IdempotencyBackend)
+	}
+
+	if config.ArchiveS3Bucket != "" {
+		if config.ArchiveS3Endpoint == "" || config.ArchiveS3AccessKey == "" || config.ArchiveS3SecretKey == "" {
+			return Config{}, fmt.Errorf("ARCHIVE_S3_BUCKET requires ARCHIVE_S3_ENDPOINT, ARCHIVE_S3_ACCESS_KEY and ARCHIVE_S3_SECRET_KEY")
+		}
+		if u, err := url.Parse(config.ArchiveS3Endpoint); err != nil || !u.IsAbs() || u.Host == "" {
+			return Config{}, fmt.Errorf("invalid ARCHIVE_S3_ENDPOINT %q", config.ArchiveS3Endpoint)
+		}
+		if config.ArchiveS3Region == "" {
+			config.ArchiveS3Region = "us-east-1"
+		}
+	}
+
+	switch config.StoreWritePolicy {
+	case "":
+		config.StoreWritePolicy = StoreWriteBestEffort
+	case StoreWriteBestEffort, StoreWriteStrict:
+	default:
+		return Config{}, fmt.Errorf("invalid STORE_WRITE_POLICY %q", config.StoreWritePolicy)
+	}
+
+	return config, nil
+}
+
+// hourRange parses "start-end" hours of the day, e.g. "21-9", which may
+// wrap past midnight
+func hourRange(v string) (int, int, error) {
+	a, b, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("want start-end hours")
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil || start < 0 || start > 23 {
+		return 0, 0, fmt.Errorf("start must be an hour from 0 to 23")
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(b))
+	if err != nil || end < 0 || end > 23 {
+		return 0, 0, fmt.Errorf("end must be an hour from 0 to 23")
+	}
+	return start, end, nil
+}
+
+// list splits a comma-separated value, trimming each entry and dropping
+// empty ones, so "a, b," is [a b]
+func list(v string) []string {
+	var entries []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// origins reads env as a list of CORS origins, each "*" or a scheme and
+// host with no path. Malformed entries fail the load in release mode and
+// are dropped with a warning otherwise, since the CORS middleware would
+// reject them anyway.
+func origins(env string, strict bool) ([]string, error) {
+	var valid []string
+	for _, origin := range list(os.Getenv(env)) {
+		if err := checkOrigin(origin); err != nil {
+			if strict {
+				return nil, fmt.Errorf("invalid %s entry %q: %v", env, origin, err)
+			}
+			log.Printf("WARNING: ignoring %s entry %q: %v", env, origin, err)
+			continue
+		}
+		valid = append(valid, origin)
+	}
+	return valid, nil
+}
+
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("scheme must be http or https")
+	case u.Host == "" || u.Hostname() == "":
+		return fmt.Errorf("no host")
+	case u.User != nil, u.Path != "", u.RawQuery != "", u.Fragment != "", strings.HasSuffix(origin, "?"), strings.HasSuffix(origin, "#"):
+		return fmt.Errorf("an origin is only a scheme, host and port")
+	}
+	return nil
+}
+
+// date parses env as an RFC 3339 time or a 2006-01-02 date at midnight
+// UTC, zero when unset
+func date(env string) (time.Time, error) {
+	v := os.Getenv(env)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q", env, v)
+	}
+	return t, nil
+}
+
+// duration parses env as a Go duration, falling back to def when unset
+func duration(env string, def time.Duration, allowZero bool) (time.Duration, error) {
+	v := os.Getenv(env)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		return 0, fmt.Errorf("invalid %s %q", env, v)
+	}
+	return d, nil
+}
+
+// integer parses env as an int no smaller than min, falling back to def
+// when unset
+func integer(env string, def, min int) (int, error) {
+	v := os.Getenv(env)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min {
+		return 0, fmt.Errorf("invalid %s %q", env, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,677 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load runs Load with the Razorpay keys and env set
+func load(t *testing.T, env map[string]string) (Config, error) {
+	t.Helper()
+	t.Setenv("RAZORPAY_API_KEY", "rzp_test_key")
+	t.Setenv("RAZORPAY_SECRET_KEY", "test_secret")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	return Load()
+}
+
+func TestCORSMaxAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 12 * time.Hour},
+		{value: "5m", want: 5 * time.Minute},
+		{value: "0", want: 0},
+		{value: "-1s", wantErr: true},
+		{value: "600", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"CORS_MAX_AGE": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "CORS_MAX_AGE") {
+					t.Fatalf("err = %v, want one naming CORS_MAX_AGE", err)
+				}
+				return
+			}
+			if err != nil || cfg.CORSMaxAge != tt.want {
+				t.Fatalf("CORSMaxAge = %s, %v, want %s", cfg.CORSMaxAge, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		release bool
+		want    []string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "whitespace", value: " https://a.com ,  https://b.com", want: []string{"https://a.com", "https://b.com"}},
+		{name: "trailing comma", value: "https://a.com,", want: []string{"https://a.com"}},
+		{name: "empty entries", value: ",https://a.com,, ,http://localhost:3000", want: []string{"https://a.com", "http://localhost:3000"}},
+		{name: "wildcard", value: "*", want: []string{"*"}},
+		{name: "path dropped", value: "https://a.com/shop, https://b.com", want: []string{"https://b.com"}},
+		{name: "malformed dropped", value: "a.com, ftp://files.a.com, https://user@a.com, https://b.com/?", want: nil},
+		{name: "path in release", value: "https://a.com/shop", release: true, wantErr: true},
+		{name: "no scheme in release", value: "a.com", release: true, wantErr: true},
+		{name: "valid in release", value: "https://a.com, https://b.com:8443", release: true, want: []string{"https://a.com", "https://b.com:8443"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"ALLOWED_ORIGINS": tt.value}
+			if tt.release {
+				env["GIN_MODE"] = ModeRelease
+			}
+			cfg, err := load(t, env)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "ALLOWED_ORIGINS") {
+					t.Fatalf("err = %v, want one naming ALLOWED_ORIGINS", err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(cfg.AllowedOrigins, tt.want) {
+				t.Fatalf("AllowedOrigins = %q, %v, want %q", cfg.AllowedOrigins, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestV1Dates(t *testing.T) {
+	tests := []struct {
+		name        string
+		deprecation string
+		sunset      string
+		want        time.Time
+		wantErr     string
+	}{
+		{name: "unset"},
+		{name: "date", deprecation: "2026-01-01", sunset: "2026-12-31", want: time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339", sunset: "2026-12-31T18:30:00+05:30", want: time.Date(2026, 12, 31, 13, 0, 0, 0, time.UTC)},
+		{name: "sunset before deprecation", deprecation: "2026-06-01", sunset: "2026-01-01", wantErr: "API_V1_SUNSET"},
+		{name: "malformed", sunset: "next year", wantErr: "API_V1_SUNSET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"API_V1_DEPRECATION": tt.deprecation, "API_V1_SUNSET": tt.sunset})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !cfg.V1Sunset.Equal(tt.want) {
+				t.Fatalf("V1Sunset = %s, %v, want %s", cfg.V1Sunset, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOnly(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "", want: false},
+		{value: "true", want: true},
+		{value: "1", want: true},
+		{value: "false", want: false},
+		{value: "yes please", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"CHECK_ONLY": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "CHECK_ONLY") {
+					t.Fatalf("err = %v, want one naming CHECK_ONLY", err)
+				}
+				return
+			}
+			if err != nil || cfg.CheckOnly != tt.want {
+				t.Fatalf("CheckOnly = %v, %v, want %v", cfg.CheckOnly, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRazorpayBaseURL(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{ModeTest, "http://localhost:9000"},
+		{ModeDebug, "http://localhost:9000"},
+		{ModeRelease, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"GIN_MODE": tt.mode, "RAZORPAY_BASE_URL": "http://localhost:9000"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.RazorpayBaseURL != tt.want {
+				t.Fatalf("RazorpayBaseURL = %q, want %q", cfg.RazorpayBaseURL, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreezeTime(t *testing.T) {
+	tests := []struct {
+		name, mode, value string
+		want              time.Time
+		wantErr           bool
+	}{
+		{"unset", ModeDebug, "", time.Time{}, false},
+		{"frozen", ModeDebug, "2026-03-31T23:59:00+05:30", time.Date(2026, 3, 31, 18, 29, 0, 0, time.UTC), false},
+		{"not RFC 3339", ModeDebug, "2026-03-31", time.Time{}, true},
+		{"release", ModeRelease, "2026-03-31T23:59:00Z", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"GIN_MODE": tt.mode, "FREEZE_TIME": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "FREEZE_TIME") {
+					t.Fatalf("err = %v, want one naming FREEZE_TIME", err)
+				}
+				return
+			}
+			if err != nil || !cfg.FreezeTime.Equal(tt.want) {
+				t.Fatalf("FreezeTime = %s, %v, want %s", cfg.FreezeTime, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsFlushTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 5 * time.Second},
+		{value: "30s", want: 30 * time.Second},
+		{value: "0", wantErr: true},
+		{value: "-1s", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"METRICS_FLUSH_TIMEOUT": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "METRICS_FLUSH_TIMEOUT") {
+					t.Fatalf("err = %v, want one naming METRICS_FLUSH_TIMEOUT", err)
+				}
+				return
+			}
+			if err != nil || cfg.MetricsFlushTimeout != tt.want {
+				t.Fatalf("MetricsFlushTimeout = %s, %v, want %s", cfg.MetricsFlushTimeout, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: 6},
+		{value: "9", want: 9},
+		{value: "0", want: 0},
+		{value: "10", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "best", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"COMPRESSION_LEVEL": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "COMPRESSION_LEVEL") {
+					t.Fatalf("err = %v, want one naming COMPRESSION_LEVEL", err)
+				}
+				return
+			}
+			if err != nil || cfg.CompressionLevel != tt.want {
+				t.Fatalf("CompressionLevel = %d, %v, want %d", cfg.CompressionLevel, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderDefaultNotes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"env=staging, service_version=1.4.0", map[string]string{"env": "staging", "service_version": "1.4.0"}, false},
+		{"build=", map[string]string{"build": ""}, false},
+		{"env", nil, true},
+		{"=staging", nil, true},
+	}
+	for _, tt := range tests {
+		cfg, err := load(t, map[string]string{"ORDER_DEFAULT_NOTES": tt.value})
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "ORDER_DEFAULT_NOTES") {
+				t.Errorf("%q: err = %v, want one naming ORDER_DEFAULT_NOTES", tt.value, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(cfg.OrderDefaultNotes, tt.want) {
+			t.Errorf("%q: OrderDefaultNotes = %v, %v, want %v", tt.value, cfg.OrderDefaultNotes, err, tt.want)
+		}
+	}
+}
+
+func TestNoteValueLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		length   int
+		overflow string
+		wantErr  string
+	}{
+		{"defaults", nil, 256, NoteOverflowReject, ""},
+		{"truncate", map[string]string{"NOTE_VALUE_MAX_LENGTH": "100", "NOTE_VALUE_OVERFLOW": "truncate"}, 100, NoteOverflowTruncate, ""},
+		{"unknown overflow", map[string]string{"NOTE_VALUE_OVERFLOW": "drop"}, 0, "", "NOTE_VALUE_OVERFLOW"},
+		{"zero length", map[string]string{"NOTE_VALUE_MAX_LENGTH": "0"}, 0, "", "NOTE_VALUE_MAX_LENGTH"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || cfg.NoteValueMaxLength != tt.length || cfg.NoteValueOverflow != tt.overflow {
+				t.Fatalf("limit = %d %s, %v, want %d %s", cfg.NoteValueMaxLength, cfg.NoteValueOverflow, err, tt.length, tt.overflow)
+			}
+		})
+	}
+}
+
+func TestPaymentRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		enabled    bool
+		start, end int
+		reasons    []string
+		wantErr    string
+	}{
+		{"defaults", nil, false, 21, 9, defaultRecoveryReasons, ""},
+		{"enabled", map[string]string{"PAYMENT_RECOVERY_ENABLED": "true", "PAYMENT_RECOVERY_URL": "https://shop.example.com/pay"}, true, 21, 9, defaultRecoveryReasons, ""},
+		{"reasons and quiet hours", map[string]string{"PAYMENT_RECOVERY_REASONS": "insufficient_funds, BAD_REQUEST_ERROR", "PAYMENT_RECOVERY_QUIET_HOURS": "22-7"},
+			false, 22, 7, []string{"insufficient_funds", "BAD_REQUEST_ERROR"}, ""},
+		{"no quiet hours", map[string]string{"PAYMENT_RECOVERY_QUIET_HOURS": "0-0"}, false, 0, 0, defaultRecoveryReasons, ""},
+		{"enabled without a URL", map[string]string{"PAYMENT_RECOVERY_ENABLED": "true"}, false, 0, 0, nil, "PAYMENT_RECOVERY_URL"},
+		{"relative URL", map[string]string{"PAYMENT_RECOVERY_ENABLED": "true", "PAYMENT_RECOVERY_URL": "/pay"}, false, 0, 0, nil, "PAYMENT_RECOVERY_URL"},
+		{"bad flag", map[string]string{"PAYMENT_RECOVERY_ENABLED": "sometimes"}, false, 0, 0, nil, "PAYMENT_RECOVERY_ENABLED"},
+		{"bad hour", map[string]string{"PAYMENT_RECOVERY_QUIET_HOURS": "21-24"}, false, 0, 0, nil, "PAYMENT_RECOVERY_QUIET_HOURS"},
+		{"no range", map[string]string{"PAYMENT_RECOVERY_QUIET_HOURS": "21"}, false, 0, 0, nil, "PAYMENT_RECOVERY_QUIET_HOURS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.PaymentRecoveryEnabled != tt.enabled || cfg.PaymentRecoveryQuietStart != tt.start || cfg.PaymentRecoveryQuietEnd != tt.end ||
+				!reflect.DeepEqual(cfg.PaymentRecoveryReasons, tt.reasons) || cfg.PaymentRecoveryWindow != 24*time.Hour {
+				t.Fatalf("recovery = %v %d-%d %v %s, want %v %d-%d %v 24h", cfg.PaymentRecoveryEnabled, cfg.PaymentRecoveryQuietStart,
+					cfg.PaymentRecoveryQuietEnd, cfg.PaymentRecoveryReasons, cfg.PaymentRecoveryWindow, tt.enabled, tt.start, tt.end, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestTagVocabulary(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{"unset", nil, nil, false},
+		{"lowercased", map[string]string{"TAG_VOCABULARY": "VIP, cod-conversion"}, []string{"vip", "cod-conversion"}, false},
+		{"rules without vocabulary", map[string]string{"TAG_RULES_FILE": "/etc/payments/tag_rules.json"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "TAG_VOCABULARY") {
+					t.Fatalf("err = %v, want one naming TAG_VOCABULARY", err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(cfg.TagVocabulary, tt.want) {
+				t.Fatalf("TagVocabulary = %v, %v, want %v", cfg.TagVocabulary, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrictJSONFields(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "", want: false},
+		{value: "true", want: true},
+		{value: "0", want: false},
+		{value: "strict", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"STRICT_JSON_FIELDS": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "STRICT_JSON_FIELDS") {
+					t.Fatalf("err = %v, want one naming STRICT_JSON_FIELDS", err)
+				}
+				return
+			}
+			if err != nil || cfg.StrictJSONFields != tt.want {
+				t.Fatalf("StrictJSONFields = %v, %v, want %v", cfg.StrictJSONFields, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantMaxAge time.Duration
+		wantTrust  bool
+		wantErr    string
+	}{
+		{name: "defaults", env: map[string]string{}, wantMaxAge: 365 * 24 * time.Hour},
+		{name: "max age", env: map[string]string{"HSTS_MAX_AGE": "24h"}, wantMaxAge: 24 * time.Hour},
+		{name: "disabled", env: map[string]string{"HSTS_MAX_AGE": "0"}},
+		{name: "trust proxy", env: map[string]string{"TRUST_PROXY_HTTPS": "true"}, wantMaxAge: 365 * 24 * time.Hour, wantTrust: true},
+		{name: "bad max age", env: map[string]string{"HSTS_MAX_AGE": "forever"}, wantErr: "HSTS_MAX_AGE"},
+		{name: "bad trust", env: map[string]string{"TRUST_PROXY_HTTPS": "maybe"}, wantErr: "TRUST_PROXY_HTTPS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || cfg.HSTSMaxAge != tt.wantMaxAge || cfg.TrustProxyHTTPS != tt.wantTrust {
+				t.Fatalf("HSTSMaxAge = %s, TrustProxyHTTPS = %v, %v, want %s, %v", cfg.HSTSMaxAge, cfg.TrustProxyHTTPS, err, tt.wantMaxAge, tt.wantTrust)
+			}
+		})
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: "X-Request-ID"},
+		{value: "X-Correlation-ID", want: "X-Correlation-ID"},
+		{value: "X Correlation", wantErr: true},
+		{value: "-Leading", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"REQUEST_ID_HEADER": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "REQUEST_ID_HEADER") {
+					t.Fatalf("err = %v, want one naming REQUEST_ID_HEADER", err)
+				}
+				return
+			}
+			if err != nil || cfg.RequestIDHeader != tt.want {
+				t.Fatalf("RequestIDHeader = %q, %v, want %q", cfg.RequestIDHeader, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyClientBinding(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    bool
+		wantTTL time.Duration
+		wantErr string
+	}{
+		{name: "off by default", env: map[string]string{}, wantTTL: 24 * time.Hour},
+		{name: "on", env: map[string]string{"VERIFY_CLIENT_BINDING": "true", "CLIENT_TOKEN_TTL": "1h"}, want: true, wantTTL: time.Hour},
+		{name: "bad flag", env: map[string]string{"VERIFY_CLIENT_BINDING": "yes please"}, wantErr: "VERIFY_CLIENT_BINDING"},
+		{name: "zero TTL", env: map[string]string{"CLIENT_TOKEN_TTL": "0"}, wantErr: "CLIENT_TOKEN_TTL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || cfg.VerifyClientBinding != tt.want || cfg.ClientTokenTTL != tt.wantTTL {
+				t.Fatalf("VerifyClientBinding = %v, ClientTokenTTL = %s, %v, want %v, %s", cfg.VerifyClientBinding, cfg.ClientTokenTTL, err, tt.want, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestSMSProvider(t *testing.T) {
+	msg91 := map[string]string{"SMS_PROVIDER": "msg91", "MSG91_AUTH_KEY": "key", "MSG91_SENDER_ID": "SHOPIN", "SMS_TEMPLATES_FILE": "sms.json"}
+	with := func(base map[string]string, k, v string) map[string]string {
+		env := map[string]string{k: v}
+		for bk, bv := range base {
+			if _, ok := env[bk]; !ok {
+				env[bk] = bv
+			}
+		}
+		return env
+	}
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantRoute string
+		wantErr   string
+	}{
+		{name: "disabled", env: map[string]string{}},
+		{name: "msg91", env: msg91, wantRoute: "4"},
+		{name: "msg91 route", env: with(msg91, "MSG91_ROUTE", "1"), wantRoute: "1"},
+		{name: "msg91 without key", env: with(msg91, "MSG91_AUTH_KEY", ""), wantErr: "MSG91_AUTH_KEY"},
+		{name: "no templates", env: with(msg91, "SMS_TEMPLATES_FILE", ""), wantErr: "SMS_TEMPLATES_FILE"},
+		{name: "twilio", env: map[string]string{"SMS_PROVIDER": "twilio", "TWILIO_ACCOUNT_SID": "AC1", "TWILIO_AUTH_TOKEN": "t", "TWILIO_FROM": "+15550000000", "SMS_TEMPLATES_FILE": "sms.json"}},
+		{name: "twilio without sender", env: map[string]string{"SMS_PROVIDER": "twilio", "TWILIO_ACCOUNT_SID": "AC1", "TWILIO_AUTH_TOKEN": "t", "SMS_TEMPLATES_FILE": "sms.json"}, wantErr: "TWILIO_FROM"},
+		{name: "unknown provider", env: map[string]string{"SMS_PROVIDER": "pigeon"}, wantErr: "SMS_PROVIDER"},
+		{name: "bad country code", env: map[string]string{"SMS_COUNTRY_CODE": "+91"}, wantErr: "SMS_COUNTRY_CODE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || cfg.MSG91Route != tt.wantRoute || cfg.SMSCountryCode != "91" {
+				t.Fatalf("MSG91Route = %q, SMSCountryCode = %q, %v, want %q and 91", cfg.MSG91Route, cfg.SMSCountryCode, err, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestStoreWritePolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: StoreWriteBestEffort},
+		{value: "best-effort", want: StoreWriteBestEffort},
+		{value: "strict", want: StoreWriteStrict},
+		{value: "Strict", wantErr: true},
+		{value: "always", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"STORE_WRITE_POLICY": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "STORE_WRITE_POLICY") {
+					t.Fatalf("err = %v, want one naming STORE_WRITE_POLICY", err)
+				}
+				return
+			}
+			if err != nil || cfg.StoreWritePolicy != tt.want {
+				t.Fatalf("StoreWritePolicy = %q, %v, want %q", cfg.StoreWritePolicy, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveS3(t *testing.T) {
+	full := map[string]string{
+		"ARCHIVE_S3_BUCKET":     "archive",
+		"ARCHIVE_S3_ENDPOINT":   "http://minio:9000",
+		"ARCHIVE_S3_ACCESS_KEY": "minio",
+		"ARCHIVE_S3_SECRET_KEY": "minio-secret",
+	}
+	without := func(k string) map[string]string {
+		env := map[string]string{k: ""}
+		for fk, fv := range full {
+			if fk != k {
+				env[fk] = fv
+			}
+		}
+		return env
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "disabled", env: map[string]string{}},
+		{name: "minio", env: full},
+		{name: "no endpoint", env: without("ARCHIVE_S3_ENDPOINT"), wantErr: "ARCHIVE_S3_ENDPOINT"},
+		{name: "no secret", env: without("ARCHIVE_S3_SECRET_KEY"), wantErr: "ARCHIVE_S3_SECRET_KEY"},
+		{name: "relative endpoint", env: map[string]string{"ARCHIVE_S3_BUCKET": "archive", "ARCHIVE_S3_ENDPOINT": "minio:9000", "ARCHIVE_S3_ACCESS_KEY": "minio", "ARCHIVE_S3_SECRET_KEY": "s"}, wantErr: "ARCHIVE_S3_ENDPOINT"},
+		{name: "zero batch", env: map[string]string{"ARCHIVE_BATCH_SIZE": "0"}, wantErr: "ARCHIVE_BATCH_SIZE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.ArchiveAfter != 2*365*24*time.Hour || cfg.ArchiveBatchSize != 500 {
+				t.Fatalf("ArchiveAfter = %v, ArchiveBatchSize = %d, want the defaults", cfg.ArchiveAfter, cfg.ArchiveBatchSize)
+			}
+			if tt.env["ARCHIVE_S3_BUCKET"] != "" && cfg.ArchiveS3Region != "us-east-1" {
+				t.Fatalf("ArchiveS3Region = %q, want us-east-1", cfg.ArchiveS3Region)
+			}
+		})
+	}
+}
+
+func TestEgressPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantSchemes []string
+		wantAllowed []string
+		wantErr     string
+	}{
+		{name: "defaults", env: map[string]string{}, wantSchemes: []string{"https"}},
+		{name: "http too", env: map[string]string{"EGRESS_ALLOWED_SCHEMES": "HTTPS, http"}, wantSchemes: []string{"https", "http"}},
+		{name: "other scheme", env: map[string]string{"EGRESS_ALLOWED_SCHEMES": "https,ftp"}, wantErr: "EGRESS_ALLOWED_SCHEMES"},
+		{
+			name:        "allowed hosts lowercased",
+			env:         map[string]string{"EGRESS_ALLOWED_HOSTS": "MinIO.internal, *.Example.com"},
+			wantSchemes: []string{"https"},
+			wantAllowed: []string{"minio.internal", "*.example.com"},
+		},
+		{name: "zero response cap", env: map[string]string{"EGRESS_MAX_RESPONSE_BYTES": "0"}, wantErr: "EGRESS_MAX_RESPONSE_BYTES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.EgressAllowedSchemes, tt.wantSchemes) || !reflect.DeepEqual(cfg.EgressAllowedHosts, tt.wantAllowed) {
+				t.Fatalf("schemes %v, allowed hosts %v, want %v and %v", cfg.EgressAllowedSchemes, cfg.EgressAllowedHosts, tt.wantSchemes, tt.wantAllowed)
+			}
+			if cfg.EgressMaxResponseBytes != 1<<20 || cfg.EgressMaxRedirects != 0 {
+				t.Fatalf("response cap %d, redirects %d, want 1 MiB and none", cfg.EgressMaxResponseBytes, cfg.EgressMaxRedirects)
+			}
+		})
+	}
+}
+
+func TestVerifyPaymentFetch(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{"false", false, false},
+		{"true", true, false},
+		{"sometimes", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := load(t, map[string]string{"VERIFY_PAYMENT_FETCH": tt.value})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "VERIFY_PAYMENT_FETCH") {
+					t.Fatalf("err = %v, want one naming VERIFY_PAYMENT_FETCH", err)
+				}
+				return
+			}
+			if err != nil || cfg.VerifyPaymentFetch != tt.want {
+				t.Fatalf("VerifyPaymentFetch = %v, %v, want %v", cfg.VerifyPaymentFetch, err, tt.want)
+			}
+		})
+	}
+}
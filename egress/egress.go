@@ -0,0 +1,221 @@
+// Package egress makes outbound HTTP requests under a policy, so URLs taken
+// from config or requests cannot be pointed at cloud metadata endpoints or
+// internal services.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors of requests the policy refused
+var (
+	ErrDenied = errors.New("destination not allowed")
+	// ErrPrivateAddress is a destination that is, or resolved to, a
+	// loopback, private, link-local or otherwise non-public address
+	ErrPrivateAddress = fmt.Errorf("%w: address is not public", ErrDenied)
+	// ErrResponseTooLarge is a response body past MaxResponseBytes
+	ErrResponseTooLarge = errors.New("response too large")
+)
+
+// Resolver looks up the addresses of a host; *net.Resolver is one
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Policy decides which destinations outbound requests may reach. Host
+// entries are hostnames or "*.example.com", which matches every subdomain
+// of example.com.
+type Policy struct {
+	// Schemes are the URL schemes allowed, only https when empty
+	Schemes []string
+	// AllowedHosts are trusted hosts, such as an internal object store.
+	// Requests to them skip the scheme and address checks.
+	AllowedHosts []string
+	// DeniedHosts are never requested, even when also allowed
+	DeniedHosts []string
+	// MaxResponseBytes caps each response body; zero leaves it unbounded
+	MaxResponseBytes int64
+	// MaxRedirects is how many redirects are followed. The response
+	// redirecting past them is returned as it is.
+	MaxRedirects int
+	// Resolver resolves hostnames, net.DefaultResolver when nil
+	Resolver Resolver
+}
+
+// Check reports whether u may be requested. The addresses a hostname
+// resolves to are only checked when it is dialled.
+func (p Policy) Check(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: %q has no host", ErrDenied, u.Redacted())
+	}
+	if MatchHost(p.DeniedHosts, host) {
+		return fmt.Errorf("%w: host %s is denied", ErrDenied, host)
+	}
+	if MatchHost(p.AllowedHosts, host) {
+		return nil
+	}
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"https"}
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed for %s", ErrDenied, u.Scheme, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !Public(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// Client returns an HTTP client that only makes requests p allows. Every
+// dial resolves the host afresh and connects to an address that passed the
+// check, so a hostname re-pointed at an internal address between attempts
+// is refused rather than trusted from an earlier lookup. Each redirect is
+// checked like the first request. Proxies are not used, as they would dial
+// on the client's behalf.
+func (p Policy) Client(timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy:               nil,
+		DialContext:         p.dialer(timeout),
+		TLSHandshakeTimeout: timeout,
+		ForceAttemptHTTP2:   true,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &guard{policy: p, base: transport},
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) > p.MaxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+func (p Policy) dialer(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	resolver := p.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, portText, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.ParseUint(portText, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %s", addr)
+		}
+		trusted := MatchHost(p.AllowedHosts, strings.ToLower(host))
+
+		var ips []netip.Addr
+		if ip, err := netip.ParseAddr(host); err == nil {
+			ips = []netip.Addr{ip}
+		} else if ips, err = resolver.LookupNetIP(ctx, "ip", host); err != nil {
+			return nil, err
+		}
+
+		err = fmt.Errorf("no addresses for %s", host)
+		for _, ip := range ips {
+			if !trusted && !Public(ip) {
+				err = fmt.Errorf("%w: %s resolved to %s", ErrPrivateAddress, host, ip)
+				continue
+			}
+			conn, dialErr := dialer.DialContext(ctx, network, netip.AddrPortFrom(ip.Unmap(), uint16(port)).String())
+			if dialErr == nil {
+				return conn, nil
+			}
+			err = dialErr
+		}
+		return nil, err
+	}
+}
+
+// guard checks every request, redirects included, before it is sent and
+// caps the body of its response
+type guard struct {
+	policy Policy
+	base   http.RoundTripper
+}
+
+func (g *guard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := g.policy.Check(req.URL); err != nil {
+		return nil, err
+	}
+	resp, err := g.base.RoundTrip(req)
+	limit := g.policy.MaxResponseBytes
+	if err != nil || limit <= 0 {
+		return resp, err
+	}
+	if resp.ContentLength > limit {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s sent %d bytes, at most %d are read", ErrResponseTooLarge, req.URL.Host, resp.ContentLength, limit)
+	}
+	resp.Body = &cappedBody{ReadCloser: resp.Body, left: limit}
+	return resp, nil
+}
+
+// cappedBody fails reads once more than left bytes arrived
+type cappedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *cappedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
+
+// MatchHost reports whether host is one of hosts, where "*.example.com"
+// matches every subdomain of example.com. Entries are lowercase.
+func MatchHost(hosts []string, host string) bool {
+	for _, entry := range hosts {
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// cgnat is the carrier-grade NAT range, shared address space that is not
+// routable on the internet
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// Public reports whether ip is routable on the internet
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() &&
+		!ip.IsPrivate() &&
+		!ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!cgnat.Contains(ip)
+}
@@ -0,0 +1,295 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers each lookup of a host with the next of its
+// answers, repeating the last, and counts the lookups
+type fakeResolver struct {
+	mu      sync.Mutex
+	answers map[string][]string
+	lookups map[string]int
+}
+
+func newFakeResolver(answers map[string][]string) *fakeResolver {
+	return &fakeResolver{answers: answers, lookups: make(map[string]int)}
+}
+
+func (r *fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	answers, ok := r.answers[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	n := min(r.lookups[host], len(answers)-1)
+	r.lookups[host]++
+	return []netip.Addr{netip.MustParseAddr(answers[n])}, nil
+}
+
+func (r *fakeResolver) count(host string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups[host]
+}
+
+// hostURL is the URL of server under host, which a resolver must point at
+// the server
+func hostURL(server *httptest.Server, host, path string) string {
+	u, _ := url.Parse(server.URL)
+	return "http://" + host + ":" + u.Port() + path
+}
+
+func TestCheck(t *testing.T) {
+	p := Policy{
+		AllowedHosts: []string{"minio.internal", "*.trusted.example"},
+		DeniedHosts:  []string{"blocked.example.com", "*.trusted.example"},
+	}
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{"https://hooks.example.com/x", nil},
+		{"http://hooks.example.com/x", ErrDenied},
+		{"https://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"https://10.0.0.5/", ErrPrivateAddress},
+		{"https://[::1]/", ErrPrivateAddress},
+		{"https://100.64.1.1/", ErrPrivateAddress},
+		{"https://93.184.216.34/", nil},
+		{"https://BLOCKED.example.com/", ErrDenied},
+		{"http://minio.internal:9000/", nil},
+		{"https://a.trusted.example/", ErrDenied},
+		{"https:///path", ErrDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.Check(u)
+			if (tt.wantErr == nil) != (err == nil) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("Check = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := Public(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("Public(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	hosts := []string{"minio.internal", "*.example.com"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"minio.internal", true},
+		{"eu.example.com", true},
+		{"a.b.example.com", true},
+		{"example.com", false},
+		{"badexample.com", false},
+		{"minio.internal.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := MatchHost(hosts, tt.host); got != tt.want {
+			t.Errorf("MatchHost(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestClientAllowlistOverride(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	resolver := newFakeResolver(map[string][]string{"hooks.internal": {"127.0.0.1"}})
+
+	tests := []struct {
+		name    string
+		allowed []string
+		wantErr error
+	}{
+		{"not allowed", nil, ErrDenied},
+		{"allowed", []string{"hooks.internal"}, nil},
+		{"allowed by wildcard", []string{"*.internal"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// http is allowed for everyone, so only the address stops it
+			p := Policy{Schemes: []string{"https", "http"}, AllowedHosts: tt.allowed, Resolver: resolver}
+			resp, err := p.Client(time.Second).Get(hostURL(server, "hooks.internal", "/"))
+			if tt.wantErr != nil {
+				if !errors.Is(err, ErrPrivateAddress) {
+					t.Fatalf("err = %v, want ErrPrivateAddress", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestClientDNSRebinding(t *testing.T) {
+	// Public on the first lookup, the metadata endpoint on the next
+	resolver := newFakeResolver(map[string][]string{"rebind.example.com": {"192.0.2.10", "169.254.169.254"}})
+	p := Policy{Schemes: []string{"http"}, Resolver: resolver}
+	client := p.Client(50 * time.Millisecond)
+
+	_, first := client.Get("http://rebind.example.com/")
+	if first == nil || errors.Is(first, ErrPrivateAddress) {
+		t.Fatalf("first attempt: err = %v, want a dial to the public address", first)
+	}
+	_, second := client.Get("http://rebind.example.com/")
+	if !errors.Is(second, ErrPrivateAddress) {
+		t.Fatalf("second attempt: err = %v, want the rebound address refused", second)
+	}
+	if n := resolver.count("rebind.example.com"); n != 2 {
+		t.Fatalf("%d lookups, want the host resolved on every attempt", n)
+	}
+}
+
+func TestClientRedirects(t *testing.T) {
+	var target string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/to-target":
+			http.Redirect(w, r, target, http.StatusFound)
+		case "/hop":
+			http.Redirect(w, r, "/to-target", http.StatusFound)
+		default:
+			io.WriteString(w, "ok")
+		}
+	}))
+	defer server.Close()
+	resolver := newFakeResolver(map[string][]string{
+		"hooks.internal":    {"127.0.0.1"},
+		"metadata.internal": {"169.254.169.254"},
+	})
+
+	tests := []struct {
+		name       string
+		target     string
+		path       string
+		redirects  int
+		wantErr    error
+		wantStatus int
+	}{
+		{"to the metadata address", "http://169.254.169.254/latest/meta-data", "/to-target", 5, ErrPrivateAddress, 0},
+		{"to a name resolving to it", "http://metadata.internal/latest/meta-data", "/to-target", 5, ErrPrivateAddress, 0},
+		{"to a denied host", "http://blocked.example.com/", "/to-target", 5, ErrDenied, 0},
+		{"within the allowed host", hostURL(server, "hooks.internal", "/done"), "/hop", 5, nil, http.StatusOK},
+		{"past the limit", hostURL(server, "hooks.internal", "/done"), "/hop", 1, nil, http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target = tt.target
+			p := Policy{
+				Schemes:      []string{"http"},
+				AllowedHosts: []string{"hooks.internal"},
+				DeniedHosts:  []string{"blocked.example.com"},
+				MaxRedirects: tt.redirects,
+				Resolver:     resolver,
+			}
+			resp, err := p.Client(time.Second).Get(hostURL(server, "hooks.internal", tt.path))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestClientResponseCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 20)
+		if r.URL.Query().Get("chunked") != "" {
+			// Flushed before the end, so no Content-Length is sent
+			io.WriteString(w, body[:10])
+			w.(http.Flusher).Flush()
+			io.WriteString(w, body[10:])
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name  string
+		limit int64
+		query string
+		fails bool
+	}{
+		{"declared length over", 10, "", true},
+		{"streamed over", 10, "?chunked=1", true},
+		{"at the limit", 20, "?chunked=1", false},
+		{"unbounded", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Policy{AllowedHosts: []string{host.Hostname()}, MaxResponseBytes: tt.limit}
+			resp, err := p.Client(time.Second).Get(server.URL + "/" + tt.query)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if tt.fails != errors.Is(err, ErrResponseTooLarge) || (!tt.fails && err != nil) {
+				t.Fatalf("err = %v, want too large %v", err, tt.fails)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package flags decides which branch of a soft-launched change a caller
+// gets. Flags are ramped by percentage and evaluated deterministically, so
+// the same customer always lands on the same branch.
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// Reasons a decision was made
+const (
+	ReasonAllowlist = "allowlist"
+	ReasonRollout   = "rollout"
+	ReasonUnknown   = "unknown"
+	ReasonForced    = "forced"
+)
+
+// Flag is a named change ramped to a percentage of callers
+type Flag struct {
+	Name string `json:"name"`
+	// Rollout is the percentage of callers, 0-100, who get the new branch
+	Rollout int `json:"rollout"`
+	// Allow lists API-key labels and customer IDs that always get it
+	Allow []string `json:"allow,omitempty"`
+}
+
+// Subject is who a flag is evaluated for. The first non-empty of
+// Customer, APIKey and Tenant is the rollout key.
+type Subject struct {
+	Customer string
+	APIKey   string
+	Tenant   string
+}
+
+func (s Subject) key() string {
+	switch {
+	case s.Customer != "":
+		return s.Customer
+	case s.APIKey != "":
+		return s.APIKey
+	}
+	return s.Tenant
+}
+
+// Decision is the branch a subject gets for a flag
+type Decision struct {
+	Flag    string `json:"flag"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Branch is "on" or "off", for notes and logs
+func (d Decision) Branch() string {
+	if d.Enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// Evaluator is what callers consult. Static forces branches in tests.
+type Evaluator interface {
+	// Decide returns the branch subject gets for the named flag; unknown
+	// flags are off
+	Decide(name string, subject Subject) Decision
+	// Flags returns the configured flags sorted by name
+	Flags() []Flag
+}
+
+// Store serves the flags in a JSON file and swaps them on reload
+type Store struct {
+	path    string
+	current atomic.Pointer[map[string]Flag]
+}
+
+// Load reads the flags at path, e.g.
+//
+//	{"flags": [{"name": "async_create", "rollout": 10, "allow": ["pos"]}]}
+func Load(path string) (*Store, error) {
+	set, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path}
+	s.current.Store(&set)
+	return s, nil
+}
+
+// Reload re-reads the file. The previous flags stay in effect when it
+// fails to load.
+func (s *Store) Reload() error {
+	set, err := load(s.path)
+	if err != nil {
+		return err
+	}
+	s.current.Store(&set)
+	return nil
+}
+
+func load(path string) (map[string]Flag, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Flags []Flag `json:"flags"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	set := make(map[string]Flag, len(file.Flags))
+	for i, f := range file.Flags {
+		if f.Name == "" {
+			return nil, fmt.Errorf("flag %d: name is required", i)
+		}
+		if _, dup := set[f.Name]; dup {
+			return nil, fmt.Errorf("flag %q: defined twice", f.Name)
+		}
+		if f.Rollout < 0 || f.Rollout > 100 {
+			return nil, fmt.Errorf("flag %q: rollout must be 0-100, got %d", f.Name, f.Rollout)
+		}
+		set[f.Name] = f
+	}
+	return set, nil
+}
+
+func (s *Store) Decide(name string, subject Subject) Decision {
+	f, ok := (*s.current.Load())[name]
+	if !ok {
+		return Decision{Flag: name, Reason: ReasonUnknown}
+	}
+	for _, v := range f.Allow {
+		if v != "" && (v == subject.Customer || v == subject.APIKey) {
+			return Decision{Flag: name, Enabled: true, Reason: ReasonAllowlist}
+		}
+	}
+	return Decision{Flag: name, Enabled: inRollout(name, subject.key(), f.Rollout), Reason: ReasonRollout}
+}
+
+func (s *Store) Flags() []Flag {
+	set := *s.current.Load()
+	out := make([]Flag, 0, len(set))
+	for _, f := range set {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// inRollout buckets key into 0-99 per flag, so ramping one flag does not
+// move callers on another
+func inRollout(name, key string, rollout int) bool {
+	if rollout >= 100 {
+		return true
+	}
+	if key == "" {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32()%100) < rollout
+}
+
+// Static is an Evaluator with fixed branches: listed flags are on or off
+// for everyone, the rest are unknown and off
+type Static map[string]bool
+
+func (s Static) Decide(name string, _ Subject) Decision {
+	enabled, ok := s[name]
+	if !ok {
+		return Decision{Flag: name, Reason: ReasonUnknown}
+	}
+	return Decision{Flag: name, Enabled: enabled, Reason: ReasonForced}
+}
+
+func (s Static) Flags() []Flag {
+	out := make([]Flag, 0, len(s))
+	for name, enabled := range s {
+		f := Flag{Name: name}
+		if enabled {
+			f.Rollout = 100
+		}
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,161 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFlags(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flags.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", `{"flags":[{"name":"async_create","rollout":10,"allow":["pos"]},{"name":"stripe","rollout":100}]}`, ""},
+		{"no flags", `{}`, ""},
+		{"malformed", `{"flags":`, "parse"},
+		{"no name", `{"flags":[{"rollout":10}]}`, "name is required"},
+		{"duplicate", `{"flags":[{"name":"stripe"},{"name":"stripe"}]}`, "defined twice"},
+		{"negative rollout", `{"flags":[{"name":"stripe","rollout":-1}]}`, "rollout must be 0-100"},
+		{"rollout above 100", `{"flags":[{"name":"stripe","rollout":101}]}`, "rollout must be 0-100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeFlags(t, tt.body))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	store, err := Load(writeFlags(t, `{"flags":[
+		{"name":"off","rollout":0,"allow":["pos","cust_vip"]},
+		{"name":"on","rollout":100}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		flag    string
+		subject Subject
+		want    Decision
+	}{
+		{"allowed API key", "off", Subject{APIKey: "pos"}, Decision{Flag: "off", Enabled: true, Reason: ReasonAllowlist}},
+		{"allowed customer", "off", Subject{Customer: "cust_vip", APIKey: "web"}, Decision{Flag: "off", Enabled: true, Reason: ReasonAllowlist}},
+		{"tenant is not allowlisted", "off", Subject{Tenant: "pos"}, Decision{Flag: "off", Reason: ReasonRollout}},
+		{"outside the rollout", "off", Subject{Customer: "cust_1"}, Decision{Flag: "off", Reason: ReasonRollout}},
+		{"fully rolled out", "on", Subject{}, Decision{Flag: "on", Enabled: true, Reason: ReasonRollout}},
+		{"unknown flag", "missing", Subject{Customer: "cust_1"}, Decision{Flag: "missing", Reason: ReasonUnknown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.Decide(tt.flag, tt.subject); got != tt.want {
+				t.Fatalf("Decide(%s, %+v) = %+v, want %+v", tt.flag, tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolloutIsDeterministic(t *testing.T) {
+	store, err := Load(writeFlags(t, `{"flags":[{"name":"stripe","rollout":30},{"name":"async_create","rollout":30}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	on, differ := 0, 0
+	for i := 0; i < 1000; i++ {
+		customer := fmt.Sprintf("cust_%d", i)
+		d := store.Decide("stripe", Subject{Customer: customer})
+		for j := 0; j < 3; j++ {
+			if again := store.Decide("stripe", Subject{Customer: customer, APIKey: "web", Tenant: "acme"}); again != d {
+				t.Fatalf("%s got %v then %v", customer, d.Enabled, again.Enabled)
+			}
+		}
+		if d.Enabled {
+			on++
+		}
+		if store.Decide("async_create", Subject{Customer: customer}).Enabled != d.Enabled {
+			differ++
+		}
+	}
+	if on < 250 || on > 350 {
+		t.Fatalf("%d of 1000 customers on at 30%%", on)
+	}
+	// Each flag buckets on its own
+	if differ == 0 {
+		t.Fatal("two flags at the same rollout picked the same customers")
+	}
+
+	// Without any key a partial rollout stays off
+	if d := store.Decide("stripe", Subject{}); d.Enabled {
+		t.Fatalf("anonymous subject = %+v, want off", d)
+	}
+}
+
+func TestReloadKeepsPreviousFlags(t *testing.T) {
+	path := writeFlags(t, `{"flags":[{"name":"stripe","rollout":100}]}`)
+	store, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"flags":[{"name":"stripe","rollout":150}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatal("reload of an invalid file succeeded")
+	}
+	if !store.Decide("stripe", Subject{}).Enabled {
+		t.Fatal("failed reload dropped the previous flags")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"flags":[{"name":"stripe","rollout":0},{"name":"async_create","rollout":5}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if store.Decide("stripe", Subject{}).Enabled {
+		t.Fatal("reload left stripe on")
+	}
+	if got := store.Flags(); len(got) != 2 || got[0].Name != "async_create" || got[1].Name != "stripe" {
+		t.Fatalf("flags = %+v, want async_create and stripe by name", got)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	s := Static{"stripe": true, "async_create": false}
+	if d := s.Decide("stripe", Subject{}); !d.Enabled || d.Reason != ReasonForced {
+		t.Fatalf("stripe = %+v, want forced on", d)
+	}
+	if d := s.Decide("async_create", Subject{Customer: "cust_1"}); d.Enabled || d.Reason != ReasonForced {
+		t.Fatalf("async_create = %+v, want forced off", d)
+	}
+	if d := s.Decide("missing", Subject{}); d.Enabled || d.Reason != ReasonUnknown {
+		t.Fatalf("missing = %+v, want unknown", d)
+	}
+	if got := s.Flags(); len(got) != 2 || got[0].Name != "async_create" || got[0].Rollout != 0 || got[1].Name != "stripe" || got[1].Rollout != 100 {
+		t.Fatalf("flags = %+v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// accountKey is the context key of the account a call is routed to
+type accountKey struct{}
+
+// WithAccount routes the calls made with the returned context to the named
+// account of an accounts gateway
+func WithAccount(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, accountKey{}, name)
+}
+
+// AccountFrom returns the account ctx is routed to, if any
+func AccountFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(accountKey{}).(string)
+	return name, ok && name != ""
+}
+
+// accountsGateway holds several Razorpay accounts. Orders, captures and
+// refunds go to the account the context names, the primary by default.
+// Other calls on an existing order or payment go to the named account when
+// there is one, otherwise to each account in turn until one knows the ID.
+// Everything else goes to the primary only.
+type accountsGateway struct {
+	Gateway
+	accounts map[string]Gateway
+	// names are the accounts other than the primary, in the order byID
+	// tries them
+	names []string
+}
+
+// NewAccounts returns a Gateway routing between primary, named
+// ProviderPrimary, and the other accounts by name
+func NewAccounts(primary Gateway, accounts map[string]Gateway) Gateway {
+	g := &accountsGateway{Gateway: primary, accounts: map[string]Gateway{ProviderPrimary: primary}}
+	for name, gw := range accounts {
+		g.accounts[name] = gw
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+	return g
+}
+
+func (g *accountsGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	name, ok := AccountFrom(ctx)
+	if !ok {
+		name = ProviderPrimary
+	}
+	gw, ok := g.accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown Razorpay account %q", name)
+	}
+	order, err := gw.CreateOrder(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	order[ProviderField] = name
+	return order, nil
+}
+
+func (g *accountsGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.byID(ctx, func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchOrder(ctx, id)
+	})
+}
+
+func (g *accountsGateway) UpdateOrder(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.byID(ctx, func(gw Gateway) (map[string]interface{}, error) {
+		return gw.UpdateOrder(ctx, id, data)
+	})
+}
+
+func (g *accountsGateway) FetchOrderPayments(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	return g.byID(ctx, func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchOrderPayments(ctx, orderID)
+	})
+}
+
+func (g *accountsGateway) FetchPayment(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.byID(ctx, func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchPayment(ctx, id)
+	})
+}
+
+func (g *accountsGateway) CapturePayment(ctx context.Context, paymentID string, amount int, currency string) (map[string]interface{}, error) {
+	gw, err := g.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gw.CapturePayment(ctx, paymentID, amount, currency)
+}
+
+func (g *accountsGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	gw, err := g.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gw.RefundPayment(ctx, paymentID, amount, data)
+}
+
+func (g *accountsGateway) FetchPaymentRefunds(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return g.byID(ctx, func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchPaymentRefunds(ctx, paymentID)
+	})
+}
+
+func (g *accountsGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return g.byID(ctx, func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchPaymentTransfers(ctx, paymentID)
+	})
+}
+
+// account is the account ctx names, the primary when it names none. Calls
+// moving money go only there: trying them on each account in turn could
+// capture or refund twice. A failover secondary is not one of the routed
+// accounts, so it is left to the primary, which fails over to it.
+func (g *accountsGateway) account(ctx context.Context) (Gateway, error) {
+	name, ok := AccountFrom(ctx)
+	if !ok {
+		return g.Gateway, nil
+	}
+	if gw, ok := g.accounts[name]; ok {
+		return gw, nil
+	}
+	if name == ProviderSecondary {
+		return g.Gateway, nil
+	}
+	return nil, fmt.Errorf("unknown Razorpay account %q", name)
+}
+
+// byID makes call on the account ctx names or, when it names none, on the
+// primary and then on each other account the previous one rejects it on,
+// as Razorpay does the IDs of another account. The primary's error stands
+// when every account fails.
+func (g *accountsGateway) byID(ctx context.Context, call func(Gateway) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if name, ok := AccountFrom(ctx); ok {
+		gw, ok := g.accounts[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown Razorpay account %q", name)
+		}
+		return call(gw)
+	}
+
+	result, err := call(g.Gateway)
+	for _, name := range g.names {
+		var rejected *RequestError
+		if !errors.As(err, &rejected) {
+			return result, err
+		}
+		if other, otherErr := call(g.accounts[name]); otherErr == nil {
+			return other, nil
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	rzperrors "github.com/razorpay/razorpay-go/errors"
+)
+
+// RequestError is Razorpay rejecting the request itself, such as an
+// unknown ID or invalid field, as opposed to an outage
+type RequestError struct {
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return "razorpay rejected request: " + e.Message
+}
+
+// ErrTimeout is Razorpay not answering within RazorpayOptions.Timeout
+var ErrTimeout = errors.New("razorpay request timed out")
+
+// ErrUnavailable is Razorpay answering with a 5xx, failing the request
+// rather than refusing it
+var ErrUnavailable = errors.New("razorpay unavailable")
+
+// IsOutage reports whether err is Razorpay being down rather than refusing
+// the request: a 5xx, a timeout or no connection. Rate limits are not
+// outages.
+func IsOutage(err error) bool {
+	var rl *RateLimitError
+	if err == nil || errors.As(err, &rl) {
+		return false
+	}
+	var op *net.OpError
+	var dns *net.DNSError
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout) || errors.As(err, &op) || errors.As(err, &dns)
+}
+
+// NotSent reports whether err proves the request never reached Razorpay:
+// the host did not resolve or the connection was not made. A timeout or a
+// 5xx does not, as the request may have been acted on regardless.
+func NotSent(err error) bool {
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return true
+	}
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// classify converts SDK errors into the gateway's error types
+func classify(err error) error {
+	var bad *rzperrors.BadRequestError
+	if errors.As(err, &bad) {
+		return &RequestError{Message: bad.Message}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
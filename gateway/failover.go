@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Accounts a failover gateway creates orders on
+const (
+	ProviderPrimary   = "primary"
+	ProviderSecondary = "secondary"
+)
+
+// ProviderField is set on the orders a failover gateway creates, naming
+// the account that created them
+const ProviderField = "provider"
+
+// failoverGateway creates orders on a secondary account while the primary
+// cannot be reached. Captures and refunds go to the account the context
+// names, the primary by default. Other calls on an existing order or
+// payment go to the primary first, and to the secondary when the primary
+// does not know the ID. Everything else goes to the primary only.
+type failoverGateway struct {
+	Gateway
+	secondary Gateway
+}
+
+// NewFailover returns a Gateway failing over from primary to secondary
+// when creating an order cannot reach the primary
+func NewFailover(primary, secondary Gateway) Gateway {
+	return &failoverGateway{Gateway: primary, secondary: secondary}
+}
+
+func (g *failoverGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	provider := ProviderPrimary
+	order, err := g.Gateway.CreateOrder(ctx, data)
+	// A timeout or 5xx may have created the order on the primary anyway,
+	// so only a request that never left is retried on the secondary
+	if NotSent(err) && ctx.Err() == nil {
+		log.Printf("Creating order on secondary account, primary is unreachable: %v", err)
+		provider = ProviderSecondary
+		order, err = g.secondary.CreateOrder(ctx, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	order[ProviderField] = provider
+	return order, nil
+}
+
+func (g *failoverGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.byID(func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchOrder(ctx, id)
+	})
+}
+
+func (g *failoverGateway) UpdateOrder(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.byID(func(gw Gateway) (map[string]interface{}, error) {
+		return gw.UpdateOrder(ctx, id, data)
+	})
+}
+
+func (g *failoverGateway) FetchOrderPayments(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	return g.byID(func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchOrderPayments(ctx, orderID)
+	})
+}
+
+func (g *failoverGateway) FetchPayment(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.byID(func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchPayment(ctx, id)
+	})
+}
+
+func (g *failoverGateway) CapturePayment(ctx context.Context, paymentID string, amount int, currency string) (map[string]interface{}, error) {
+	gw, err := g.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gw.CapturePayment(ctx, paymentID, amount, currency)
+}
+
+func (g *failoverGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	gw, err := g.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gw.RefundPayment(ctx, paymentID, amount, data)
+}
+
+func (g *failoverGateway) FetchPaymentRefunds(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return g.byID(func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchPaymentRefunds(ctx, paymentID)
+	})
+}
+
+func (g *failoverGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return g.byID(func(gw Gateway) (map[string]interface{}, error) {
+		return gw.FetchPaymentTransfers(ctx, paymentID)
+	})
+}
+
+// account is the account ctx names, the primary when it names none. Calls
+// moving money go only there: trying them on each account in turn could
+// capture or refund twice.
+func (g *failoverGateway) account(ctx context.Context) (Gateway, error) {
+	name, ok := AccountFrom(ctx)
+	switch {
+	case !ok || name == ProviderPrimary:
+		return g.Gateway, nil
+	case name == ProviderSecondary:
+		return g.secondary, nil
+	}
+	return nil, fmt.Errorf("unknown Razorpay account %q", name)
+}
+
+// byID makes call on the primary, and on the secondary when the primary
+// rejects it, as it does the IDs of another account. The primary's error
+// stands when the secondary fails too.
+func (g *failoverGateway) byID(call func(Gateway) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	result, err := call(g.Gateway)
+	var rejected *RequestError
+	if !errors.As(err, &rejected) {
+		return result, err
+	}
+	if second, secondErr := call(g.secondary); secondErr == nil {
+		return second, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+// stubGateway answers with err, or with a result naming itself, and counts
+// the calls made on it. Calls it does not implement panic through the nil
+// embedded Gateway.
+type stubGateway struct {
+	Gateway
+	name  string
+	err   error
+	calls int
+}
+
+func (g *stubGateway) answer() (map[string]interface{}, error) {
+	g.calls++
+	if g.err != nil {
+		return nil, g.err
+	}
+	return map[string]interface{}{"id": "x", "account": g.name}, nil
+}
+
+func (g *stubGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.answer()
+}
+
+func (g *stubGateway) FetchPayment(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.answer()
+}
+
+func (g *stubGateway) CapturePayment(ctx context.Context, paymentID string, amount int, currency string) (map[string]interface{}, error) {
+	return g.answer()
+}
+
+func (g *stubGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.answer()
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestFailoverCreateOrderOnlyWhenPrimaryUnreached(t *testing.T) {
+	dial := &url.Error{Op: "Post", URL: "https://api.razorpay.com/v1/orders", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	dns := &url.Error{Op: "Post", URL: "https://api.razorpay.com/v1/orders", Err: &net.DNSError{Err: "no such host", Name: "api.razorpay.com"}}
+	read := &url.Error{Op: "Post", URL: "https://api.razorpay.com/v1/orders", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+	tests := []struct {
+		name       string
+		err        error
+		wantFrom   string
+		wantErr    bool
+		secondCall bool
+	}{
+		{name: "primary up", wantFrom: ProviderPrimary},
+		{name: "connection refused", err: dial, wantFrom: ProviderSecondary, secondCall: true},
+		{name: "host not resolved", err: dns, wantFrom: ProviderSecondary, secondCall: true},
+		{name: "timed out", err: classify(&url.Error{Op: "Post", Err: timeoutError{}}), wantErr: true},
+		{name: "connection reset mid request", err: read, wantErr: true},
+		{name: "5xx", err: fmt.Errorf("%w: 503", ErrUnavailable), wantErr: true},
+		{name: "rejected", err: &RequestError{Message: "bad amount"}, wantErr: true},
+		{name: "rate limited", err: &RateLimitError{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &stubGateway{name: ProviderPrimary, err: tt.err}
+			secondary := &stubGateway{name: ProviderSecondary}
+			order, err := NewFailover(primary, secondary).CreateOrder(context.Background(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got := secondary.calls > 0; got != tt.secondCall {
+				t.Fatalf("secondary called = %v, want %v", got, tt.secondCall)
+			}
+			if !tt.wantErr && order[ProviderField] != tt.wantFrom {
+				t.Fatalf("provider = %v, want %s", order[ProviderField], tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestFailoverCreateOrderNotRetriedOnceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	primary := &stubGateway{err: &net.OpError{Op: "dial", Err: context.Canceled}}
+	secondary := &stubGateway{}
+	if _, err := NewFailover(primary, secondary).CreateOrder(ctx, nil); err == nil {
+		t.Fatal("cancelled create succeeded")
+	}
+	if secondary.calls != 0 {
+		t.Fatal("cancelled create retried on the secondary")
+	}
+}
+
+func TestMoneyMovementRoutedByAccount(t *testing.T) {
+	rejected := &RequestError{Message: "The id provided does not exist"}
+	tests := []struct {
+		name    string
+		account string
+		want    string
+		wantErr bool
+	}{
+		{name: "no account", want: ProviderPrimary},
+		{name: "primary", account: ProviderPrimary, want: ProviderPrimary},
+		{name: "secondary", account: ProviderSecondary, want: ProviderSecondary},
+		{name: "unknown", account: "other", wantErr: true},
+	}
+	calls := map[string]func(Gateway, context.Context) (map[string]interface{}, error){
+		"capture": func(gw Gateway, ctx context.Context) (map[string]interface{}, error) {
+			return gw.CapturePayment(ctx, "pay_1", 100, "INR")
+		},
+		"refund": func(gw Gateway, ctx context.Context) (map[string]interface{}, error) {
+			return gw.RefundPayment(ctx, "pay_1", 100, nil)
+		},
+	}
+	for call, do := range calls {
+		for _, tt := range tests {
+			t.Run(call+" "+tt.name, func(t *testing.T) {
+				// Each account rejects the payment, as Razorpay does the IDs
+				// of another account, so a call tried in turn would show
+				primary := &stubGateway{name: ProviderPrimary, err: rejected}
+				secondary := &stubGateway{name: ProviderSecondary, err: rejected}
+				want, other := primary, secondary
+				if tt.want == ProviderSecondary {
+					want, other = secondary, primary
+				}
+				want.err = nil
+				ctx := context.Background()
+				if tt.account != "" {
+					ctx = WithAccount(ctx, tt.account)
+				}
+
+				result, err := do(NewFailover(primary, secondary), ctx)
+				if tt.wantErr {
+					if err == nil || primary.calls+secondary.calls != 0 {
+						t.Fatalf("err = %v after %d calls, want an error before any", err, primary.calls+secondary.calls)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result["account"] != tt.want || other.calls != 0 {
+					t.Fatalf("answered by %v with %d calls on the other account, want %s alone", result["account"], other.calls, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestAccountsMoneyMovementNotTriedInTurn(t *testing.T) {
+	rejected := &RequestError{Message: "The id provided does not exist"}
+	primary := &stubGateway{name: ProviderPrimary, err: rejected}
+	brand := &stubGateway{name: "brand"}
+	gw := NewAccounts(primary, map[string]Gateway{"brand": brand})
+
+	if _, err := gw.CapturePayment(context.Background(), "pay_1", 100, "INR"); !errors.As(err, &rejected) {
+		t.Fatalf("err = %v, want the primary's rejection", err)
+	}
+	if _, err := gw.RefundPayment(context.Background(), "pay_1", 100, nil); !errors.As(err, &rejected) {
+		t.Fatalf("err = %v, want the primary's rejection", err)
+	}
+	if brand.calls != 0 {
+		t.Fatalf("unnamed capture or refund tried on another account %d times", brand.calls)
+	}
+
+	result, err := gw.CapturePayment(WithAccount(context.Background(), "brand"), "pay_1", 100, "INR")
+	if err != nil || result["account"] != "brand" {
+		t.Fatalf("capture on brand = %v, %v", result, err)
+	}
+	// Reads still look for the payment on each account
+	if result, err := gw.FetchPayment(context.Background(), "pay_1"); err != nil || result["account"] != "brand" {
+		t.Fatalf("fetch = %v, %v, want found on brand", result, err)
+	}
+}
+
+func TestNotSent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+		{"dial timeout", classify(&url.Error{Err: &net.OpError{Op: "dial", Err: timeoutError{}}}), true},
+		{"dns", &url.Error{Err: &net.DNSError{Name: "api.razorpay.com"}}, true},
+		{"read", &net.OpError{Op: "read", Err: errors.New("reset")}, false},
+		{"timeout", classify(&url.Error{Err: timeoutError{}}), false},
+		{"unavailable", ErrUnavailable, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NotSent(tt.err); got != tt.want {
+				t.Fatalf("NotSent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Package gateway wraps the payment provider behind a small interface so the
+// service can be exercised without reaching Razorpay.
+package gateway
+
+import (
+	"context"
+	"time"
+)
+
+// Gateway is the set of provider calls the payment service relies on.
+// Requests and responses use the provider's JSON field names.
+type Gateway interface {
+	// CreateOrder creates a provider order from data
+	CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error)
+	// FetchOrder returns the provider order with the given ID
+	FetchOrder(ctx context.Context, id string) (map[string]interface{}, error)
+	// ListOrders returns one page of orders selected by the provider's
+	// from, to, count and skip params
+	ListOrders(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error)
+	// UpsertCustomer creates a customer or returns the existing one with the
+	// same email/contact
+	UpsertCustomer(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error)
+	// CreatePaymentLink creates a hosted payment link from data
+	CreatePaymentLink(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error)
+	// UpdateOrder patches an order's mutable fields, i.e. its notes
+	UpdateOrder(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error)
+	// FetchPayment returns the provider payment with the given ID
+	FetchPayment(ctx context.Context, id string) (map[string]interface{}, error)
+	// FetchOrderPayments returns the collection of payments attempted
+	// against the order
+	FetchOrderPayments(ctx context.Context, orderID string) (map[string]interface{}, error)
+	// CapturePayment captures an authorized payment
+	CapturePayment(ctx context.Context, paymentID string, amount int, currency string) (map[string]interface{}, error)
+	// RefundPayment refunds amount of a captured payment
+	RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error)
+	// FetchPaymentRefunds returns the collection of a payment's refunds
+	FetchPaymentRefunds(ctx context.Context, paymentID string) (map[string]interface{}, error)
+	// FetchMethods returns the payment methods enabled on the account
+	FetchMethods(ctx context.Context) (map[string]interface{}, error)
+	// FetchPaymentTransfers returns the collection of Route transfers made
+	// from the payment
+	FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error)
+	// ReverseTransfer reverses data["amount"] of a transfer, or all of it
+	// when no amount is given
+	ReverseTransfer(ctx context.Context, transferID string, data map[string]interface{}) (map[string]interface{}, error)
+	// FetchTransferReversals returns the collection of a transfer's reversals
+	FetchTransferReversals(ctx context.Context, transferID string) (map[string]interface{}, error)
+	// ListWebhooks returns the collection of webhooks configured on the
+	// account
+	ListWebhooks(ctx context.Context) (map[string]interface{}, error)
+	// CreateWebhook configures a new webhook from data
+	CreateWebhook(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error)
+	// UpdateWebhook replaces the configuration of a webhook
+	UpdateWebhook(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error)
+	// ListAll walks a collection page by page, calling fn for each item
+	// until the collection ends, fn fails or ctx is done
+	ListAll(ctx context.Context, entity string, params map[string]interface{}, opts ListOptions, fn func(item map[string]interface{}) error) error
+	// Ping makes a cheap authenticated call to prove the provider is reachable
+	Ping(ctx context.Context) error
+}
+
+// CallContext is the context a provider call runs under: ctx, ended after
+// timeout at the latest. Request contexts carry the client's deadline, but
+// background workers pass context.Background() or nil, which on their own
+// would let a hung call block the worker for good.
+func CallContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithTimeout(ctx, timeout)
+}
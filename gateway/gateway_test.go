@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCallContextAlwaysHasDeadline(t *testing.T) {
+	const timeout = time.Minute
+	soon, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	late, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		// within is how far off the deadline may be at most
+		within time.Duration
+	}{
+		{"nil context", nil, timeout},
+		{"background", context.Background(), timeout},
+		{"caller deadline sooner", soon, time.Second},
+		{"caller deadline later", late, timeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := CallContext(tt.ctx, timeout)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("no deadline")
+			}
+			if left := time.Until(deadline); left > tt.within {
+				t.Fatalf("deadline in %s, want within %s", left, tt.within)
+			}
+		})
+	}
+}
+
+func TestBackgroundCallTimesOut(t *testing.T) {
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	gw, err := NewRazorpay(RazorpayOptions{KeyID: "rzp_test_key", KeySecret: "secret", Timeout: 50 * time.Millisecond, BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	began := time.Now()
+	_, err = gw.FetchOrder(context.Background(), "order_1")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if took := time.Since(began); took > time.Second {
+		t.Fatalf("hung call returned after %s", took)
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Razorpay's count/skip paging limits
+const (
+	maxPageSize     = 100
+	defaultPageSize = 100
+)
+
+// Entities ListAll can walk
+const (
+	EntityOrders      = "orders"
+	EntityPayments    = "payments"
+	EntityRefunds     = "refunds"
+	EntitySettlements = "settlements"
+)
+
+var (
+	// ErrUnknownEntity is a ListAll entity Razorpay cannot list
+	ErrUnknownEntity = errors.New("unknown list entity")
+	// ErrListTruncated is ListAll stopping at ListOptions.MaxItems
+	ErrListTruncated = errors.New("list stopped at the item cap")
+)
+
+// ListOptions controls how ListAll pages through a collection
+type ListOptions struct {
+	// PageSize is the count requested per page, at most 100
+	PageSize int
+	// PageDelay is waited between pages to stay clear of rate limits
+	PageDelay time.Duration
+	// MaxItems stops the walk after this many items; zero means no cap
+	MaxItems int
+}
+
+func (g *razorpayGateway) ListAll(ctx context.Context, entity string, params map[string]interface{}, opts ListOptions, fn func(item map[string]interface{}) error) error {
+	list, err := g.lister(entity)
+	if err != nil {
+		return err
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = defaultPageSize
+	}
+
+	seen := 0
+	for skip := 0; ; skip += pageSize {
+		query := make(map[string]interface{}, len(params)+2)
+		for k, v := range params {
+			query[k] = v
+		}
+		query["count"] = pageSize
+		query["skip"] = skip
+
+		page, err := g.call(ctx, func() (map[string]interface{}, error) {
+			return list(query, nil)
+		})
+		if err != nil {
+			return fmt.Errorf("list %s at offset %d: %w", entity, skip, err)
+		}
+
+		items, _ := page["items"].([]interface{})
+		for _, raw := range items {
+			item, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if opts.MaxItems > 0 && seen == opts.MaxItems {
+				return ErrListTruncated
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+			seen++
+		}
+		if len(items) < pageSize {
+			return nil
+		}
+
+		select {
+		case <-time.After(opts.PageDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// lister returns the SDK's list call for entity
+func (g *razorpayGateway) lister(entity string) (func(map[string]interface{}, map[string]string) (map[string]interface{}, error), error) {
+	switch entity {
+	case EntityOrders:
+		return g.client.Order.All, nil
+	case EntityPayments:
+		return g.client.Payment.All, nil
+	case EntityRefunds:
+		return g.client.Refund.All, nil
+	case EntitySettlements:
+		return g.client.Settlement.All, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEntity, entity)
+	}
+}
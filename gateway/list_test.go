@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listServer serves /v1/orders as total orders paged by count and skip,
+// answering 400 for the page at failAt when it is not negative
+type listServer struct {
+	total, failAt int
+
+	mu    sync.Mutex
+	skips []int
+	sizes []int
+}
+
+func (s *listServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+	s.mu.Lock()
+	s.skips = append(s.skips, skip)
+	s.sizes = append(s.sizes, count)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if s.failAt >= 0 && skip == s.failAt {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":"BAD_REQUEST_ERROR","description":"bad page"}}`))
+		return
+	}
+	items := []map[string]interface{}{}
+	for i := skip; i < skip+count && i < s.total; i++ {
+		items = append(items, map[string]interface{}{"id": fmt.Sprintf("order_%d", i)})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"entity": "collection", "count": len(items), "items": items})
+}
+
+// listGateway returns a gateway pointed at s
+func listGateway(t *testing.T, s *listServer) Gateway {
+	t.Helper()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	gw, err := NewRazorpay(RazorpayOptions{KeyID: "rzp_test_key", KeySecret: "secret", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gw
+}
+
+func TestListAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		failAt    int
+		opts      ListOptions
+		want      int
+		wantSkips []int
+		wantErr   error
+	}{
+		{"one page", 30, -1, ListOptions{}, 30, []int{0}, nil},
+		{"several pages", 250, -1, ListOptions{}, 250, []int{0, 100, 200}, nil},
+		// A full last page needs one more request to show it was the last
+		{"exact pages", 200, -1, ListOptions{}, 200, []int{0, 100, 200}, nil},
+		{"page size", 25, -1, ListOptions{PageSize: 10}, 25, []int{0, 10, 20}, nil},
+		{"page size capped", 150, -1, ListOptions{PageSize: 500}, 150, []int{0, 100}, nil},
+		{"item cap", 250, -1, ListOptions{MaxItems: 120}, 120, []int{0, 100}, ErrListTruncated},
+		{"item cap not reached", 50, -1, ListOptions{MaxItems: 120}, 50, []int{0}, nil},
+		{"error mid-walk", 250, 100, ListOptions{}, 100, []int{0, 100}, &RequestError{}},
+		{"empty", 0, -1, ListOptions{}, 0, []int{0}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &listServer{total: tt.total, failAt: tt.failAt}
+			gw := listGateway(t, server)
+
+			var ids []string
+			err := gw.ListAll(context.Background(), EntityOrders, nil, tt.opts, func(item map[string]interface{}) error {
+				ids = append(ids, item["id"].(string))
+				return nil
+			})
+			var reqErr *RequestError
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("err = %v, want none", err)
+			case errors.As(tt.wantErr, &reqErr):
+				if !errors.As(err, &reqErr) || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", tt.failAt)) {
+					t.Fatalf("err = %v, want a request error at offset %d", err, tt.failAt)
+				}
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(ids) != tt.want {
+				t.Fatalf("got %d items, want %d", len(ids), tt.want)
+			}
+			for i, id := range ids {
+				if id != fmt.Sprintf("order_%d", i) {
+					t.Fatalf("item %d = %s, want items in order", i, id)
+				}
+			}
+			if fmt.Sprint(server.skips) != fmt.Sprint(tt.wantSkips) {
+				t.Fatalf("requested skips %v, want %v", server.skips, tt.wantSkips)
+			}
+		})
+	}
+}
+
+func TestListAllCallbackStops(t *testing.T) {
+	server := &listServer{total: 250, failAt: -1}
+	gw := listGateway(t, server)
+	stop := errors.New("stop")
+	seen := 0
+	err := gw.ListAll(context.Background(), EntityOrders, nil, ListOptions{}, func(map[string]interface{}) error {
+		if seen++; seen == 50 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || seen != 50 || len(server.skips) != 1 {
+		t.Fatalf("err = %v after %d items and %d pages, want the callback's error after 50 on one page", err, seen, len(server.skips))
+	}
+}
+
+func TestListAllCancelled(t *testing.T) {
+	server := &listServer{total: 250, failAt: -1}
+	gw := listGateway(t, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seen := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- gw.ListAll(ctx, EntityOrders, nil, ListOptions{PageDelay: time.Hour}, func(map[string]interface{}) error {
+			if seen++; seen == 100 {
+				// Cancelled while the walk waits out the delay before page two
+				cancel()
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) || seen != 100 {
+			t.Fatalf("err = %v after %d items, want context.Canceled after 100", err, seen)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListAll did not return after cancellation")
+	}
+}
+
+func TestListAllUnknownEntity(t *testing.T) {
+	gw := listGateway(t, &listServer{failAt: -1})
+	err := gw.ListAll(context.Background(), "invoices", nil, ListOptions{}, func(map[string]interface{}) error { return nil })
+	if !errors.Is(err, ErrUnknownEntity) {
+		t.Fatalf("err = %v, want ErrUnknownEntity", err)
+	}
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// maxBackoff caps the default Retry-After when Razorpay sends none
+const maxBackoff = 32 * time.Second
+
+// RateLimitError is returned for any upstream call Razorpay answered with 429
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("razorpay rate limited, retry after %s", e.RetryAfter)
+}
+
+// breakerThreshold is the run of back-to-back 429s that opens the circuit
+// breaker
+const breakerThreshold = 3
+
+// rateLimitTransport turns upstream 429 responses into a RateLimitError,
+// and 5xx responses into ErrUnavailable. The SDK discards status codes and
+// headers, but passes transport errors through untouched, so this is the
+// only place the hint survives.
+//
+// It is also the circuit breaker: after breakerThreshold 429s in a row,
+// calls are refused without being sent until the last Retry-After has
+// passed, so concurrent requests stop adding to the rate limit. The next
+// call then goes through; another 429 opens the breaker again and anything
+// else closes it.
+type rateLimitTransport struct {
+	base http.RoundTripper
+
+	mu          sync.Mutex
+	consecutive int
+	openUntil   time.Time
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	if wait := time.Until(t.openUntil); wait > 0 {
+		t.mu.Unlock()
+		metrics.RazorpayRateLimits.WithLabelValues("short_circuited").Inc()
+		return nil, &RateLimitError{RetryAfter: wait}
+	}
+	t.mu.Unlock()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.consecutive = 0
+		if resp.StatusCode >= http.StatusInternalServerError {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+		}
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	metrics.RazorpayRateLimits.WithLabelValues("upstream").Inc()
+
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		// Exponential default: 1s, 2s, 4s ... for back-to-back rate limits
+		retryAfter = time.Duration(math.Min(
+			float64(time.Second)*math.Pow(2, float64(t.consecutive)),
+			float64(maxBackoff),
+		))
+	}
+	t.consecutive++
+	if t.consecutive >= breakerThreshold {
+		t.openUntil = time.Now().Add(retryAfter)
+	}
+	return nil, &RateLimitError{RetryAfter: retryAfter}
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// callWithRetry runs fn, retrying upstream rate limits only while the wait
+// still fits inside ctx's deadline. Calls without a deadline are not retried.
+func callWithRetry(ctx context.Context, fn func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+
+		var rl *RateLimitError
+		if err == nil || !errors.As(err, &rl) || attempt == 3 {
+			return result, err
+		}
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) <= rl.RetryAfter {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(rl.RetryAfter):
+			metrics.RazorpayRetries.Inc()
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// rateLimitServer answers each request with the next status in statuses,
+// repeating the last, and Retry-After set to retryAfter when not empty. It
+// returns the server and the count of requests that reached it.
+func rateLimitServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(hits.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status == http.StatusTooManyRequests {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"code":"BAD_REQUEST_ERROR","description":"Too many requests"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id":"order_1","entity":"order"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	date := time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name       string
+		retryAfter string
+		// min and max bound the RetryAfter reported to the caller
+		min, max time.Duration
+	}{
+		{"seconds", "7", 7 * time.Second, 7 * time.Second},
+		{"http date", date, 3 * time.Second, 5 * time.Second},
+		{"date passed", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{"missing", "", time.Second, time.Second},
+		{"garbage", "soon", time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hits := rateLimitServer(t, tt.retryAfter, http.StatusTooManyRequests)
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			_, err := (&rateLimitTransport{base: http.DefaultTransport}).RoundTrip(req)
+
+			var rl *RateLimitError
+			if !errors.As(err, &rl) {
+				t.Fatalf("err = %v, want a RateLimitError", err)
+			}
+			if rl.RetryAfter < tt.min || rl.RetryAfter > tt.max {
+				t.Fatalf("RetryAfter = %s, want between %s and %s", rl.RetryAfter, tt.min, tt.max)
+			}
+			if IsOutage(err) {
+				t.Fatal("rate limit reported as an outage")
+			}
+			if hits.Load() != 1 {
+				t.Fatalf("%d requests sent, want 1", hits.Load())
+			}
+		})
+	}
+}
+
+func TestRateLimitDefaultBackoffGrows(t *testing.T) {
+	server, _ := rateLimitServer(t, "", http.StatusTooManyRequests)
+	transport := &rateLimitTransport{base: http.DefaultTransport}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		_, err := transport.RoundTrip(req)
+		var rl *RateLimitError
+		if !errors.As(err, &rl) || rl.RetryAfter != want {
+			t.Fatalf("err = %v, want a rate limit for %s", err, want)
+		}
+		// Keep the breaker closed to see every backoff
+		transport.openUntil = time.Time{}
+	}
+}
+
+func TestRateLimitRetriedWithinDeadline(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		timeout    time.Duration
+		wantHits   int32
+		wantErr    bool
+	}{
+		{"retry fits", "0", 5 * time.Second, 2, false},
+		{"retry past deadline", "60", time.Second, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hits := rateLimitServer(t, tt.retryAfter, http.StatusTooManyRequests, http.StatusOK)
+			gw, err := NewRazorpay(RazorpayOptions{KeyID: "rzp_test_key", KeySecret: "secret", Timeout: tt.timeout, BaseURL: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			retries := testutil.ToFloat64(metrics.RazorpayRetries)
+
+			order, err := gw.FetchOrder(context.Background(), "order_1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && order["id"] != "order_1" {
+				t.Fatalf("order = %v", order)
+			}
+			if hits.Load() != tt.wantHits {
+				t.Fatalf("%d requests sent, want %d", hits.Load(), tt.wantHits)
+			}
+			if got := testutil.ToFloat64(metrics.RazorpayRetries) - retries; got != float64(tt.wantHits-1) {
+				t.Fatalf("retries counted = %v, want %d", got, tt.wantHits-1)
+			}
+		})
+	}
+}
+
+func TestRateLimitBreaker(t *testing.T) {
+	// Three 429s open the breaker; after the wait, one success closes it
+	server, hits := rateLimitServer(t, "60",
+		http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests,
+		http.StatusOK, http.StatusTooManyRequests, http.StatusOK)
+	transport := &rateLimitTransport{base: http.DefaultTransport}
+	roundTrip := func() error {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := transport.RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	upstream := testutil.ToFloat64(metrics.RazorpayRateLimits.WithLabelValues("upstream"))
+	shorted := testutil.ToFloat64(metrics.RazorpayRateLimits.WithLabelValues("short_circuited"))
+
+	for i := 0; i < breakerThreshold+2; i++ {
+		var rl *RateLimitError
+		if err := roundTrip(); !errors.As(err, &rl) {
+			t.Fatalf("call %d: err = %v, want a RateLimitError", i+1, err)
+		}
+	}
+	if hits.Load() != breakerThreshold {
+		t.Fatalf("%d requests sent, want the breaker open after %d", hits.Load(), breakerThreshold)
+	}
+	if got := testutil.ToFloat64(metrics.RazorpayRateLimits.WithLabelValues("upstream")) - upstream; got != breakerThreshold {
+		t.Fatalf("upstream rate limits counted = %v, want %d", got, breakerThreshold)
+	}
+	if got := testutil.ToFloat64(metrics.RazorpayRateLimits.WithLabelValues("short_circuited")) - shorted; got != 2 {
+		t.Fatalf("short-circuited calls counted = %v, want 2", got)
+	}
+
+	transport.mu.Lock()
+	transport.openUntil = time.Now()
+	transport.mu.Unlock()
+	if err := roundTrip(); err != nil {
+		t.Fatalf("call after the wait: %v", err)
+	}
+	var rl *RateLimitError
+	if err := roundTrip(); !errors.As(err, &rl) {
+		t.Fatalf("err = %v, want the upstream rate limit", err)
+	}
+	if err := roundTrip(); err != nil {
+		t.Fatalf("breaker opened by a single 429 after closing: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/razorpay/razorpay-go"
+
+	"github.com/yash170603/golang_payment/authctx"
+)
+
+// RazorpayOptions configures the Razorpay gateway
+type RazorpayOptions struct {
+	KeyID     string
+	KeySecret string
+	// Timeout bounds each call including rate-limit retries, whether or not
+	// the caller's context has a deadline; DefaultTimeout when zero
+	Timeout time.Duration
+	// BaseURL overrides https://api.razorpay.com when set
+	BaseURL string
+}
+
+// DefaultTimeout bounds calls of a gateway built without a Timeout
+const DefaultTimeout = 10 * time.Second
+
+type razorpayGateway struct {
+	client  *razorpay.Client
+	timeout time.Duration
+}
+
+// NewRazorpay returns a Gateway backed by the Razorpay SDK
+func NewRazorpay(opts RazorpayOptions) (Gateway, error) {
+	if opts.KeyID == "" || opts.KeySecret == "" {
+		return nil, fmt.Errorf("missing Razorpay credentials")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	client := razorpay.NewClient(opts.KeyID, opts.KeySecret)
+	// Every SDK resource shares this request, so one transport covers all calls
+	client.Order.Request.HTTPClient = &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: &rateLimitTransport{base: http.DefaultTransport},
+	}
+	if opts.BaseURL != "" {
+		client.Order.Request.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	}
+
+	return &razorpayGateway{client: client, timeout: opts.Timeout}, nil
+}
+
+func (g *razorpayGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Order.Create(data, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Order.Fetch(id, nil, nil)
+	})
+}
+
+func (g *razorpayGateway) UpsertCustomer(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	// fail_existing=0 makes Razorpay return the existing customer instead of failing
+	payload := map[string]interface{}{"fail_existing": "0"}
+	for k, v := range data {
+		payload[k] = v
+	}
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Customer.Create(payload, nil)
+	})
+}
+
+func (g *razorpayGateway) CreatePaymentLink(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.PaymentLink.Create(data, nil)
+	})
+}
+
+func (g *razorpayGateway) UpdateOrder(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Order.Update(id, data, nil)
+	})
+}
+
+func (g *razorpayGateway) ListOrders(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Order.All(params, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchPayment(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Payment.Fetch(id, nil, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchOrderPayments(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Order.Payments(orderID, nil, nil)
+	})
+}
+
+func (g *razorpayGateway) CapturePayment(ctx context.Context, paymentID string, amount int, currency string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Payment.Capture(paymentID, amount, map[string]interface{}{"currency": currency}, nil)
+	})
+}
+
+func (g *razorpayGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Payment.Refund(paymentID, amount, data, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchPaymentRefunds(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Payment.FetchMultipleRefund(paymentID, nil, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Payment.Transfers(paymentID, nil, nil)
+	})
+}
+
+func (g *razorpayGateway) ReverseTransfer(ctx context.Context, transferID string, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Transfer.Reverse(transferID, data, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchTransferReversals(ctx context.Context, transferID string) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Transfer.Reversals(transferID, nil, nil)
+	})
+}
+
+func (g *razorpayGateway) ListWebhooks(ctx context.Context) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Webhook.All("", nil, nil)
+	})
+}
+
+func (g *razorpayGateway) CreateWebhook(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Webhook.Create("", data, nil)
+	})
+}
+
+func (g *razorpayGateway) UpdateWebhook(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	// The SDK's Edit builds the own-account path from the account ID rather
+	// than the webhook ID, so the request is made directly
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Webhook.Request.Put("/v1/webhooks/"+url.PathEscape(id), data, nil)
+	})
+}
+
+func (g *razorpayGateway) FetchMethods(ctx context.Context) (map[string]interface{}, error) {
+	return g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Payment.FetchMethods(nil, nil)
+	})
+}
+
+func (g *razorpayGateway) Ping(ctx context.Context) error {
+	_, err := g.call(ctx, func() (map[string]interface{}, error) {
+		return g.client.Order.All(map[string]interface{}{"count": 1}, nil)
+	})
+	return err
+}
+
+// call runs fn with rate-limit retries under CallContext, returning once
+// its deadline passes even when fn has not
+func (g *razorpayGateway) call(ctx context.Context, fn func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	ctx, cancel := CallContext(ctx, g.timeout)
+	defer cancel()
+
+	type outcome struct {
+		result map[string]interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := callWithRetry(ctx, fn)
+		done <- outcome{result, err}
+	}()
+
+	var result map[string]interface{}
+	var err error
+	select {
+	case o := <-done:
+		result, err = o.result, o.err
+	case <-ctx.Done():
+		// The SDK takes no context, so the abandoned request is left to the
+		// HTTP client's timeout
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+	}
+	if err != nil {
+		err = classify(err)
+		log.Printf("Razorpay call failed%s: %v", authctx.LogFields(ctx), err)
+	}
+	return result, err
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yash170603/golang_payment/authctx"
+)
+
+func TestBaseURLRedirectsCalls(t *testing.T) {
+	type hit struct {
+		method, path string
+		body         map[string]interface{}
+		keyID        string
+	}
+	var mu sync.Mutex
+	var hits []hit
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := hit{method: r.Method, path: r.URL.Path}
+		h.keyID, _, _ = r.BasicAuth()
+		json.NewDecoder(r.Body).Decode(&h.body)
+		mu.Lock()
+		hits = append(hits, h)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"order_stub","entity":"order","amount":500,"currency":"INR","status":"created"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+	}{
+		{"base URL", server.URL},
+		{"trailing slash", server.URL + "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			hits = nil
+			mu.Unlock()
+			gw, err := NewRazorpay(RazorpayOptions{KeyID: "rzp_test_key", KeySecret: "secret", BaseURL: tt.baseURL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			order, err := gw.CreateOrder(context.Background(), map[string]interface{}{"amount": 500, "currency": "INR"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if order["id"] != "order_stub" {
+				t.Fatalf("order = %v, want the stub's", order)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(hits) != 1 {
+				t.Fatalf("%d requests reached the stub, want 1", len(hits))
+			}
+			got := hits[0]
+			if got.method != http.MethodPost || got.path != "/v1/orders" || got.keyID != "rzp_test_key" || got.body["amount"] != float64(500) {
+				t.Fatalf("stub got %+v, want POST /v1/orders for 500 as rzp_test_key", got)
+			}
+		})
+	}
+}
+
+func TestCallFailureLogsCaller(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":"BAD_REQUEST_ERROR","description":"The id provided does not exist"}}`))
+	}))
+	defer server.Close()
+	gw, err := NewRazorpay(RazorpayOptions{KeyID: "rzp_test_key", KeySecret: "secret", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	ctx := authctx.WithRequestID(context.Background(), "req-42")
+	ctx = authctx.WithPrincipal(ctx, authctx.Identity{Kind: authctx.KindAPIKey, ID: "pos-1"})
+	ctx = authctx.WithTenant(ctx, "acme")
+	if _, err := gw.FetchOrder(ctx, "order_missing"); err == nil {
+		t.Fatal("fetch of a missing order succeeded")
+	}
+	line := buf.String()
+	for _, want := range []string{"request_id=req-42", "principal=api_key:pos-1", "tenant=acme", "does not exist"} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("log %q lacks %q", line, want)
+		}
+	}
+}
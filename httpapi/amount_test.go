@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRefundAndCaptureRefuseBadAmounts(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	routes := map[string]string{
+		"capture": "/api/v1/admin/payments/pay_1/capture",
+		"refund":  "/api/v1/admin/refunds",
+	}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"zero", `{"payment_id":"pay_1","amount":0}`},
+		{"negative", `{"payment_id":"pay_1","amount":-100}`},
+		{"below minimum", `{"payment_id":"pay_1","amount":99}`},
+	}
+	for route, path := range routes {
+		for _, tt := range tests {
+			t.Run(route+"/"+tt.name, func(t *testing.T) {
+				w := serve(r, http.MethodPost, path, testAdminToken, tt.body)
+				if w.Code != http.StatusUnprocessableEntity {
+					t.Fatalf("status = %d, want 422: %s", w.Code, w.Body)
+				}
+				var body struct {
+					Code  string `json:"code"`
+					Error string `json:"error"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Code != "invalid_amount" || body.Error != "Invalid amount" {
+					t.Fatalf("body = %+v, want the uniform invalid_amount answer", body)
+				}
+			})
+		}
+	}
+}
+
+func TestCurrenciesEndpoint(t *testing.T) {
+	t.Setenv("ALLOWED_CURRENCIES", "usd,inr")
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+
+	w := serve(r, http.MethodGet, "/api/v1/currencies", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 without credentials: %s", w.Code, w.Body)
+	}
+	var got struct {
+		Default    string `json:"default"`
+		Currencies []struct {
+			Code      string `json:"code"`
+			Exponent  int    `json:"exponent"`
+			MinAmount int    `json:"min_amount"`
+		} `json:"currencies"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Default != "INR" || len(got.Currencies) != 2 || got.Currencies[0].Code != "USD" || got.Currencies[1].Code != "INR" {
+		t.Fatalf("body = %s, want the configured USD and INR", w.Body)
+	}
+	for _, cur := range got.Currencies {
+		if cur.Exponent != 2 || cur.MinAmount != 100 {
+			t.Fatalf("%s = %+v, want 2 minor digits and a minimum of 100", cur.Code, cur)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API key scopes. Admin routes need admin:read for GET and admin:write
+// otherwise, except where a route names its own scope.
+const (
+	ScopeOrdersCreate  = "orders:create"
+	ScopeOrdersRead    = "orders:read"
+	ScopeOrdersVerify  = "orders:verify"
+	ScopeRefundsCreate = "refunds:create"
+	ScopeAdminRead     = "admin:read"
+	ScopeAdminWrite    = "admin:write"
+)
+
+var knownScopes = map[string]bool{
+	ScopeOrdersCreate:  true,
+	ScopeOrdersRead:    true,
+	ScopeOrdersVerify:  true,
+	ScopeRefundsCreate: true,
+	ScopeAdminRead:     true,
+	ScopeAdminWrite:    true,
+	"orders:*":         true,
+	"refunds:*":        true,
+	"admin:*":          true,
+	"*":                true,
+}
+
+// APIKey is a partner credential. Only the SHA-256 of the key is kept, so
+// the key itself never appears in configuration or logs.
+type APIKey struct {
+	Label  string   `json:"label"`
+	SHA256 string   `json:"key_sha256"`
+	Scopes []string `json:"scopes"`
+	// RateLimit caps the key's requests per minute; zero is unlimited
+	RateLimit int `json:"rate_limit"`
+	// Brand is applied to orders the key creates without naming one
+	Brand string `json:"brand,omitempty"`
+	// Merchant is the tenant the key calls for. Its requests are made for
+	// that merchant whatever X-Tenant-ID says, and count against the
+	// merchant's rate limit.
+	Merchant string `json:"merchant,omitempty"`
+}
+
+// KeyUsage counts one key's calls per scope since startup
+type KeyUsage struct {
+	Label  string            `json:"label"`
+	Calls  map[string]uint64 `json:"calls"`
+	Denied map[string]uint64 `json:"denied"`
+}
+
+// APIKeys holds the configured API keys, their rate limits and usage
+type APIKeys struct {
+	byHash   map[string]APIKey
+	limiters map[string]*rateLimiter
+
+	mu    sync.Mutex
+	usage map[string]*KeyUsage
+}
+
+// LoadAPIKeys reads a JSON array of API keys from path
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []APIKey
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	keys := &APIKeys{
+		byHash:   make(map[string]APIKey, len(list)),
+		limiters: make(map[string]*rateLimiter),
+		usage:    make(map[string]*KeyUsage, len(list)),
+	}
+	for _, k := range list {
+		if k.Label == "" {
+			return nil, fmt.Errorf("API key without a label")
+		}
+		if _, dup := keys.usage[k.Label]; dup {
+			return nil, fmt.Errorf("duplicate API key label %q", k.Label)
+		}
+		k.SHA256 = strings.ToLower(k.SHA256)
+		if sum, err := hex.DecodeString(k.SHA256); err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: key_sha256 must be a hex SHA-256", k.Label)
+		}
+		if _, dup := keys.byHash[k.SHA256]; dup {
+			return nil, fmt.Errorf("API key %q: key_sha256 is already used", k.Label)
+		}
+		if len(k.Scopes) == 0 {
+			return nil, fmt.Errorf("API key %q: no scopes", k.Label)
+		}
+		for _, s := range k.Scopes {
+			if !knownScopes[s] {
+				return nil, fmt.Errorf("API key %q: unknown scope %q", k.Label, s)
+			}
+		}
+		if k.RateLimit < 0 {
+			return nil, fmt.Errorf("API key %q: rate_limit must not be negative", k.Label)
+		}
+
+		keys.byHash[k.SHA256] = k
+		if k.RateLimit > 0 {
+			keys.limiters[k.Label] = newRateLimiter(k.RateLimit, time.Minute)
+		}
+		keys.usage[k.Label] = &KeyUsage{Label: k.Label, Calls: map[string]uint64{}, Denied: map[string]uint64{}}
+	}
+	return keys, nil
+}
+
+// lookup returns the key whose hash matches presented
+func (k *APIKeys) lookup(presented string) (APIKey, bool) {
+	if k == nil {
+		return APIKey{}, false
+	}
+	sum := sha256.Sum256([]byte(presented))
+	key, ok := k.byHash[hex.EncodeToString(sum[:])]
+	return key, ok
+}
+
+// merchant returns the merchant of the API key the request bears, if any
+func (k *APIKeys) merchant(c *gin.Context) (string, bool) {
+	bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	key, ok := k.lookup(bearer)
+	return key.Merchant, ok && key.Merchant != ""
+}
+
+// allow counts a request against the key's rate limit, returning how long
+// until the next window when it is exceeded
+func (k *APIKeys) allow(label string, now time.Time) (bool, time.Duration) {
+	rl, ok := k.limiters[label]
+	if !ok {
+		return true, 0
+	}
+	return rl.allow(label, now)
+}
+
+// record counts a call by label under scope
+func (k *APIKeys) record(label, scope string, allowed bool) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	u, ok := k.usage[label]
+	if !ok {
+		return
+	}
+	if allowed {
+		u.Calls[scope]++
+	} else {
+		u.Denied[scope]++
+	}
+}
+
+// Usage returns every key's call counts, sorted by label
+func (k *APIKeys) Usage() []KeyUsage {
+	if k == nil {
+		return []KeyUsage{}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	list := make([]KeyUsage, 0, len(k.usage))
+	for _, u := range k.usage {
+		c := KeyUsage{Label: u.Label, Calls: make(map[string]uint64, len(u.Calls)), Denied: make(map[string]uint64, len(u.Denied))}
+		for s, n := range u.Calls {
+			c.Calls[s] = n
+		}
+		for s, n := range u.Denied {
+			c.Denied[s] = n
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Label < list[j].Label })
+	return list
+}
@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+func TestLoadAPIKeysValidates(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		keys    []APIKey
+		wantErr string
+	}{
+		{"valid", []APIKey{{Label: "partner", SHA256: hash, Scopes: []string{ScopeOrdersCreate, "admin:*"}}}, ""},
+		{"hash in upper case", []APIKey{{Label: "partner", SHA256: strings.ToUpper(hash), Scopes: []string{"*"}}}, ""},
+		{"no label", []APIKey{{SHA256: hash, Scopes: []string{"*"}}}, "without a label"},
+		{"duplicate label", []APIKey{{Label: "p", SHA256: hash, Scopes: []string{"*"}}, {Label: "p", SHA256: strings.Repeat("cd", 32), Scopes: []string{"*"}}}, "duplicate"},
+		{"plaintext key", []APIKey{{Label: "partner", SHA256: "sk_live_123", Scopes: []string{"*"}}}, "hex SHA-256"},
+		{"hash reused", []APIKey{{Label: "a", SHA256: hash, Scopes: []string{"*"}}, {Label: "b", SHA256: hash, Scopes: []string{"*"}}}, "already used"},
+		{"no scopes", []APIKey{{Label: "partner", SHA256: hash}}, "no scopes"},
+		{"unknown scope", []APIKey{{Label: "partner", SHA256: hash, Scopes: []string{"exports:read"}}}, "unknown scope"},
+		{"negative rate limit", []APIKey{{Label: "partner", SHA256: hash, Scopes: []string{"*"}, RateLimit: -1}}, "rate_limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadAPIKeys(writeJSON(t, "keys.json", tt.keys))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScopedKeyAllowedAndForbidden(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{"partner-secret-key": {ScopeOrdersCreate}})
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken, APIKeys: keys})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name, method, path, body string
+		// missing is the scope the key is refused for, empty when allowed
+		missing string
+	}{
+		{"create order", http.MethodPost, "/api/v1/orders", `{"amount":100}`, ""},
+		{"create another", http.MethodPost, "/api/v1/orders", `{"amount":200}`, ""},
+		{"refund", http.MethodPost, "/api/v1/admin/refunds", `{"payment_id":"pay_1","amount":100}`, ScopeRefundsCreate},
+		{"read admin", http.MethodGet, "/api/v1/admin/usage", "", ScopeAdminRead},
+		{"write admin", http.MethodPost, "/api/v1/admin/fulfillments/order_1/replay", "", ScopeAdminWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, tt.path, "partner-secret-key", tt.body)
+			if tt.missing == "" {
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+				}
+				return
+			}
+			var body struct {
+				MissingScope string `json:"missing_scope"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusForbidden || body.MissingScope != tt.missing {
+				t.Fatalf("status = %d: %s, want 403 naming %s", w.Code, w.Body, tt.missing)
+			}
+		})
+	}
+	if strings.Contains(buf.String(), "partner-secret-key") {
+		t.Fatalf("log = %q, the key was printed", buf.String())
+	}
+
+	w := serve(r, http.MethodGet, "/api/v1/admin/usage", testAdminToken, "")
+	var usage struct {
+		Items []KeyUsage `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil || len(usage.Items) != 1 {
+		t.Fatalf("usage: %d %s", w.Code, w.Body)
+	}
+	u := usage.Items[0]
+	if u.Calls[ScopeOrdersCreate] != 2 || u.Denied[ScopeRefundsCreate] != 1 || u.Denied[ScopeAdminRead] != 1 || u.Denied[ScopeAdminWrite] != 1 {
+		t.Fatalf("usage = %+v, want 2 order creates and one refusal per other scope", u)
+	}
+}
+
+func TestAPIKeyRateLimitOnClock(t *testing.T) {
+	keys := loadTestKeys(t, map[string]APIKey{"ops-key": {Scopes: []string{ScopeAdminRead}, RateLimit: 2}})
+	clk := clock.NewFake(time.Date(2026, 3, 2, 10, 0, 30, 0, time.UTC))
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{APIKeys: keys, Clock: clk})
+
+	for i := 0; i < 2; i++ {
+		if w := serve(r, http.MethodGet, "/api/v1/admin/usage", "ops-key", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, w.Code)
+		}
+	}
+	w := serve(r, http.MethodGet, "/api/v1/admin/usage", "ops-key", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "31" {
+		t.Fatalf("third request: status = %d, Retry-After %q, want 429 after 31s", w.Code, w.Header().Get("Retry-After"))
+	}
+	// The window turns on the configured clock, not the system's
+	clk.Advance(30 * time.Second)
+	if w := serve(r, http.MethodGet, "/api/v1/admin/usage", "ops-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("next minute: status = %d, want 200", w.Code)
+	}
+}
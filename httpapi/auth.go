@@ -0,0 +1,195 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// TenantHeader names the merchant a request is made for
+const TenantHeader = "X-Tenant-ID"
+
+// withTenant records the merchant a request is for in the request context:
+// that of the API key it bears or, for other callers, the X-Tenant-ID
+// header. A header naming another merchant than the key's is refused with
+// 403, and one naming an unknown merchant with 400.
+func withTenant(svc *service.Service, keys *APIKeys) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := strings.TrimSpace(c.GetHeader(TenantHeader))
+		if merchant, ok := keys.merchant(c); ok {
+			if tenant != "" && tenant != merchant {
+				respond(c, kindForbidden, gin.H{
+					"error": "API key is not for this merchant",
+				})
+				c.Abort()
+				return
+			}
+			tenant = merchant
+		}
+		if tenant != "" {
+			if err := svc.CheckMerchant(c.Request.Context(), tenant); err != nil {
+				writeError(c, err, "Failed to resolve merchant")
+				c.Abort()
+				return
+			}
+			c.Request = c.Request.WithContext(authctx.WithTenant(c.Request.Context(), tenant))
+		}
+		c.Next()
+	}
+}
+
+// adminAuth admits requests bearing the admin token or an API key and
+// records the caller as the principal. With neither configured every
+// request is refused.
+func adminAuth(opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticate(c, opts) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticate records the caller of the bearer credential as the
+// principal, answering 401 for an unknown one and 429 for a key over its
+// rate limit, counted on opts.Clock. It reports whether the request may go
+// on.
+func authenticate(c *gin.Context, opts Options) bool {
+	bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	token, keys := opts.AdminToken, opts.APIKeys
+	var id authctx.Identity
+	if token != "" && ok && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+		id = authctx.Identity{Kind: authctx.KindAdmin, ID: "admin"}
+	} else if key, found := keys.lookup(bearer); ok && found {
+		if allowed, retry := keys.allow(key.Label, opts.now()); !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			respond(c, kindRateLimited, gin.H{
+				"error": "Too many requests",
+			})
+			c.Abort()
+			return false
+		}
+		id = authctx.Identity{Kind: authctx.KindAPIKey, ID: key.Label, Scopes: key.Scopes, Brand: key.Brand}
+	} else {
+		respond(c, kindUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		c.Abort()
+		return false
+	}
+
+	c.Request = c.Request.WithContext(authctx.WithPrincipal(c.Request.Context(), id))
+	return true
+}
+
+// requireScope answers 403 naming scope when the principal does not hold
+// it, and counts API key calls under scope
+func requireScope(keys *APIKeys, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := principal(c)
+		if !ok {
+			return
+		}
+		if !checkScope(c, keys, id, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminScope is requireScope with admin:read for GET and HEAD requests and
+// admin:write for the rest
+func adminScope(keys *APIKeys) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := principal(c)
+		if !ok {
+			return
+		}
+		scope := ScopeAdminWrite
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			scope = ScopeAdminRead
+		}
+		if !checkScope(c, keys, id, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// keyScope guards the browser-facing routes partners also call. Anonymous
+// requests pass as before; a request presenting a credential must hold
+// scope.
+func keyScope(opts Options, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		if !authenticate(c, opts) {
+			return
+		}
+		id, _ := authctx.Principal(c.Request.Context())
+		if !checkScope(c, opts.APIKeys, id, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// statusTokenOrScope admits the holder of a status token for the :id order,
+// passed as ?token=, as the customer who paid it is. Other requests must
+// authenticate and hold scope, as behind adminAuth and requireScope.
+func statusTokenOrScope(svc *service.Service, opts Options, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := c.Query("token"); t != "" && svc.ValidStatusToken(t, c.Param("id")) {
+			c.Next()
+			return
+		}
+		if !authenticate(c, opts) {
+			return
+		}
+		id, _ := authctx.Principal(c.Request.Context())
+		if !checkScope(c, opts.APIKeys, id, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+func checkScope(c *gin.Context, keys *APIKeys, id authctx.Identity, scope string) bool {
+	allowed := id.Allows(scope)
+	if id.Kind == authctx.KindAPIKey {
+		keys.record(id.ID, scope, allowed)
+	}
+	if !allowed {
+		respond(c, kindForbidden, gin.H{
+			"error":         fmt.Sprintf("API key lacks the %s scope", scope),
+			"missing_scope": scope,
+		})
+		c.Abort()
+	}
+	return allowed
+}
+
+// principal returns the caller of a protected route. A missing principal
+// means the auth middleware was not installed in front of the handler, so
+// it is reported as a server bug rather than an auth failure.
+func principal(c *gin.Context) (authctx.Identity, bool) {
+	id, ok := authctx.Principal(c.Request.Context())
+	if !ok {
+		log.Printf("BUG: no principal on protected route %s %s", c.Request.Method, c.FullPath())
+		respond(c, kindInternal, gin.H{
+			"error": "Internal server error",
+		})
+		c.Abort()
+	}
+	return id, ok
+}
@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yash170603/golang_payment/service"
+)
+
+func TestOrderBrandEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brands.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "acme", "display_name": "Acme"}, {"name": "zed", "display_name": "Zed"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	brands, err := service.LoadBrands(path, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := loadTestKeys(t, map[string]APIKey{
+		"zed-key": {Scopes: []string{ScopeOrdersCreate}, Brand: "zed"},
+	})
+	r := NewRouter(newTestService(t, &fakeGateway{}, service.WithBrands(brands)), Options{APIKeys: keys})
+
+	tests := []struct {
+		name  string
+		key   string
+		body  string
+		want  int
+		brand string
+	}{
+		{"default", "", `{"amount":100}`, http.StatusOK, "acme"},
+		{"requested", "", `{"amount":100,"brand":"zed"}`, http.StatusOK, "zed"},
+		{"from the API key", "zed-key", `{"amount":100}`, http.StatusOK, "zed"},
+		{"unknown", "", `{"amount":100,"brand":"other"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/v1/orders", tt.key, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != http.StatusOK {
+				if body["code"] != "unknown_brand" || !reflect.DeepEqual(body["brands"], []interface{}{"acme", "zed"}) {
+					t.Fatalf("body = %v, want unknown_brand with the valid brands", body)
+				}
+				return
+			}
+			if body["brand"] != tt.brand {
+				t.Fatalf("brand = %v, want %s", body["brand"], tt.brand)
+			}
+		})
+	}
+}
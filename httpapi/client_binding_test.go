@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVerifyClientBinding(t *testing.T) {
+	t.Setenv("VERIFY_CLIENT_BINDING", "true")
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	w := serve(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100}`)
+	var order struct {
+		ID          string `json:"id"`
+		OrderToken  string `json:"order_token"`
+		ClientToken string `json:"client_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil || order.ClientToken == "" {
+		t.Fatalf("create order: %d %s, want a client_token", w.Code, w.Body)
+	}
+	signed := verifyBody(order.ID, "pay_1", order.OrderToken)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+		code  string
+	}{
+		{"missing", "", http.StatusForbidden, "client_mismatch"},
+		{"mismatch", "other", http.StatusForbidden, "client_mismatch"},
+		{"match", order.ClientToken, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.TrimSuffix(signed, "}") + `,"client_token":"` + tt.token + `"}`
+			w := serve(r, http.MethodPost, "/api/v1/verify", "", body)
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.want || tt.code != "" && got["code"] != tt.code {
+				t.Fatalf("%d %v, want %d %s", w.Code, got["code"], tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestVerifyWithoutClientBinding(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	w := serve(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100}`)
+	var order map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := order["client_token"]; ok {
+		t.Fatalf("create order: %s, want no client_token with binding off", w.Body)
+	}
+	orderID, token := order["id"].(string), order["order_token"].(string)
+	if w := serve(r, http.MethodPost, "/api/v1/verify", "", verifyBody(orderID, "pay_1", token)); w.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d, want 200 without a client token: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,235 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uncompressibleTypes are content types sent as they are: already
+// compressed, or streamed and needing every flush to reach the client
+var uncompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"text/event-stream",
+	"application/gzip",
+	"application/zip",
+	"application/zstd",
+	"application/octet-stream",
+}
+
+// withCompression gzips responses of at least minSize bytes for clients
+// accepting it, at level; level zero disables it. Routes whose bytes must
+// reach the client untouched are mounted outside it.
+func withCompression(level, minSize int) gin.HandlerFunc {
+	if level == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	pool := &sync.Pool{New: func() interface{} {
+		// The level is validated when the configuration is loaded
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}}
+	return func(c *gin.Context) {
+		w := c.Writer
+		cw := &compressWriter{
+			ResponseWriter: w,
+			pool:           pool,
+			minSize:        minSize,
+			accepts:        c.Request.Method != http.MethodHead && acceptsGzip(c.GetHeader("Accept-Encoding")),
+		}
+		c.Writer = cw
+		// A panic skips finish, so Recovery answers on the plain writer
+		defer func() { c.Writer = w }()
+		c.Next()
+		cw.finish()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header admits gzip,
+// honouring q=0 exclusions and the * wildcard
+func acceptsGzip(header string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return wildcardQ > 0
+}
+
+// compressWriter holds back the start of a response until it knows
+// whether the response is worth compressing
+type compressWriter struct {
+	gin.ResponseWriter
+	pool    *sync.Pool
+	minSize int
+	accepts bool
+
+	code    int
+	started bool
+	buf     []byte
+	size    int
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.code = code
+	}
+}
+
+// WriteHeaderNow only marks the response started; the body that may
+// follow decides its encoding
+func (w *compressWriter) WriteHeaderNow() {
+	w.started = true
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.size += len(b)
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		w.decide()
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Status() int {
+	if !w.decided && w.code != 0 {
+		return w.code
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *compressWriter) Size() int {
+	if !w.Written() {
+		return -1
+	}
+	return w.size
+}
+
+func (w *compressWriter) Written() bool {
+	return w.decided || w.started || w.code != 0 || len(w.buf) > 0
+}
+
+// Flush sends what is buffered, so streamed responses are never held back
+func (w *compressWriter) Flush() {
+	w.decide()
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide starts the response, compressed when the client accepts gzip,
+// the body is large enough and of a compressible type, and nothing
+// upstream encoded it already
+func (w *compressWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	h := w.ResponseWriter.Header()
+	compressible := h.Get("Content-Encoding") == "" && compressibleType(h.Get("Content-Type"))
+	if compressible {
+		addVary(h, "Accept-Encoding")
+	}
+	code := w.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if compressible && w.accepts && len(w.buf) >= w.minSize && bodyAllowed(code) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	if len(w.buf) > 0 {
+		if w.gz != nil {
+			_, _ = w.gz.Write(w.buf)
+		} else {
+			_, _ = w.ResponseWriter.Write(w.buf)
+		}
+	}
+	w.buf = nil
+}
+
+// finish sends a response that never reached minSize and completes the
+// gzip stream
+func (w *compressWriter) finish() {
+	if !w.Written() {
+		return
+	}
+	w.decide()
+	if w.gz != nil {
+		_ = w.gz.Close()
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+func compressibleType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	for _, prefix := range uncompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func bodyAllowed(code int) bool {
+	return code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified
+}
+
+// addVary adds value to the Vary header unless it is listed already
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
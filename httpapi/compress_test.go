@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"GZIP", true},
+		{"x-gzip", true},
+		{"gzip;q=0", false},
+		{"br", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"gzip;q=0, *", false},
+		{"gzip, *;q=0", true},
+		{"gzip;q=bogus", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat(`{"id":"order_1","status":"paid"},`, 100)
+	r := gin.New()
+	r.Use(withCompression(6, 1024))
+	r.GET("/large", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(large)) })
+	r.GET("/small", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(`{"ok":true}`)) })
+	r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	r.GET("/stream", func(c *gin.Context) { c.Data(http.StatusOK, "text/event-stream", []byte(large)) })
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.Data(http.StatusOK, "application/json", []byte(large))
+	})
+	r.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		encoding string
+		vary     bool
+	}{
+		{"large", "/large", "gzip", "gzip", true},
+		{"large not accepted", "/large", "", "", true},
+		{"large refused", "/large", "gzip;q=0", "", true},
+		{"below the threshold", "/small", "gzip", "", true},
+		{"already compressed type", "/image", "gzip", "", false},
+		{"event stream", "/stream", "gzip", "", false},
+		{"already encoded", "/encoded", "gzip", "br", false},
+		{"no content", "/empty", "gzip", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := w.Header().Get("Vary") == "Accept-Encoding"; got != tt.vary {
+				t.Fatalf("Vary = %q, want Accept-Encoding %v", w.Header().Get("Vary"), tt.vary)
+			}
+			if tt.encoding != "gzip" {
+				return
+			}
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(zr)
+			if err != nil || string(body) != large {
+				t.Fatalf("decompressed %d bytes (%v), want the %d sent", len(body), err, len(large))
+			}
+		})
+	}
+}
+
+func TestCompressionDisabled(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{CompressionMinSize: 1})
+	w := serveWith(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100}`, http.Header{"Accept-Encoding": {"gzip"}})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("status = %d, Content-Encoding = %q, want an uncompressed 200", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestWebhookBodyUntouchedByCompression(t *testing.T) {
+	t.Setenv("RAZORPAY_WEBHOOK_SECRET", "whsec_test")
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{CompressionLevel: 6, CompressionMinSize: 1})
+	gzipped := http.Header{"Accept-Encoding": {"gzip"}}
+
+	// A route behind the middleware is compressed at this threshold
+	if w := serveWith(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100}`, gzipped); w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("order: Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+
+	body := `{"event":"payment.authorized","payload":{"payment":{"entity":{"id":"pay_1","notes":"` + strings.Repeat("x", 2048) + `"}}}}`
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(body))
+	header := http.Header{
+		"Accept-Encoding":      {"gzip"},
+		"X-Razorpay-Signature": {hex.EncodeToString(mac.Sum(nil))},
+		"X-Razorpay-Event-Id":  {"evt_1"},
+	}
+	w := serveWith(r, http.MethodPost, "/api/v1/webhooks/razorpay", "", body, header)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want the signature verified: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("webhook Content-Encoding = %q, want none", got)
+	}
+}
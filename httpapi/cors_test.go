@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// preflightFrom sends a CORS preflight for a POST to path from origin
+func preflightFrom(r http.Handler, path, origin string) http.Header {
+	return serveWith(r, http.MethodOptions, path, "", "", http.Header{
+		"Origin":                        {origin},
+		"Access-Control-Request-Method": {http.MethodPost},
+	}).Header()
+}
+
+func TestCORSMaxAge(t *testing.T) {
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{12 * time.Hour, "43200"},
+		{90 * time.Second, "90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxAge.String(), func(t *testing.T) {
+			r := NewRouter(newTestService(t, &fakeGateway{}), Options{AllowedOrigins: []string{"https://shop.example"}, CORSMaxAge: tt.maxAge})
+			if got := preflightFrom(r, "/api/v1/orders", "https://shop.example").Get("Access-Control-Max-Age"); got != tt.want {
+				t.Fatalf("Access-Control-Max-Age = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSPerGroup(t *testing.T) {
+	const shop, ops, evil = "https://shop.example", "https://ops.example", "https://evil.example"
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{
+		AdminToken:          testAdminToken,
+		AllowedOrigins:      []string{shop},
+		AdminAllowedOrigins: []string{ops},
+	})
+	tests := []struct {
+		name, path, origin string
+		// want is the Access-Control-Allow-Origin expected, empty for none
+		want string
+	}{
+		{"orders", "/api/v1/orders", shop, shop},
+		{"verify", "/api/v1/verify", shop, shop},
+		{"config", "/api/v1/config", shop, shop},
+		{"currencies", "/api/v1/currencies", shop, shop},
+		{"currencies disallowed origin", "/api/v1/currencies", evil, ""},
+		{"checkout", "/api/v1/checkout/sessions", shop, shop},
+		{"public disallowed origin", "/api/v1/orders", evil, ""},
+		{"public admin origin", "/api/v1/verify", ops, ""},
+		{"webhook", "/api/v1/webhooks/razorpay", shop, ""},
+		{"webhook admin origin", "/api/v1/webhooks/razorpay", ops, ""},
+		{"admin", "/api/v1/admin/orders/order_1/notes", ops, ops},
+		{"admin refunds", "/api/v1/admin/refunds", ops, ops},
+		{"admin public origin", "/api/v1/admin/orders/order_1/notes", shop, ""},
+		{"admin disallowed origin", "/api/v1/admin/refunds", evil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := preflightFrom(r, tt.path, tt.origin)
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && h.Get("Access-Control-Allow-Methods") != "" {
+				t.Fatalf("Access-Control-Allow-Methods = %q, want none", h.Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+func TestCORSPreflightAnswered(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AllowedOrigins: []string{"https://shop.example"}})
+	w := serveWith(r, http.MethodOptions, "/api/v1/verify", "", "", http.Header{
+		"Origin":                        {"https://shop.example"},
+		"Access-Control-Request-Method": {http.MethodPost},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, http.MethodPost) {
+		t.Fatalf("Access-Control-Allow-Methods = %q, want POST", got)
+	}
+}
+
+func TestAdminSendsNoCORSWithoutAdminOrigins(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken, AllowedOrigins: []string{"https://shop.example"}})
+	for _, path := range []string{"/api/v1/admin/refunds", "/api/v1/admin/orders/order_1/notes", "/health/detailed"} {
+		if got := preflightFrom(r, path, "https://shop.example").Get("Access-Control-Allow-Origin"); got != "" {
+			t.Fatalf("%s: Access-Control-Allow-Origin = %q, want none", path, got)
+		}
+	}
+	w := serveWith(r, http.MethodPost, "/api/v1/webhooks/razorpay", "", `{}`, http.Header{"Origin": {"https://shop.example"}})
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("webhook POST: Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
@@ -0,0 +1,27 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withDeprecation announces that the routes behind it are deprecated as of
+// deprecated and go away at sunset, with the Deprecation (RFC 9745) and
+// Sunset (RFC 8594) headers. Either may be zero to leave its header out.
+func withDeprecation(deprecated, sunset time.Time) gin.HandlerFunc {
+	if deprecated.IsZero() && sunset.IsZero() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		if !deprecated.IsZero() {
+			c.Header("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+		}
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Next()
+	}
+}
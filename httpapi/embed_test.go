@@ -0,0 +1,110 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/httpapi"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// orderGateway is a gateway another program could supply: it creates
+// orders and nothing else
+type orderGateway struct {
+	gateway.Gateway
+}
+
+func (orderGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": "order_embedded", "amount": data["amount"], "currency": data["currency"], "status": "created"}, nil
+}
+
+// TestEmbeddedRouter mounts the routes the way a host program does, through
+// the exported API only: under its own prefix and behind its own middleware
+func TestEmbeddedRouter(t *testing.T) {
+	t.Setenv("RAZORPAY_API_KEY", "rzp_test_key")
+	t.Setenv("RAZORPAY_SECRET_KEY", "test_secret")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := service.New(orderGateway{}, service.NewMemoryStore(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		svc.Shutdown(ctx)
+	})
+
+	host := gin.New()
+	host.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "host") })
+	mounted := host.Group("/payments/api", func(c *gin.Context) {
+		c.Header("X-Host-Middleware", "ran")
+	})
+	httpapi.Register(mounted, svc, httpapi.Options{})
+
+	tests := []struct {
+		name, method, path, body string
+		want                     int
+		// hosted is whether the host's middleware ran
+		hosted bool
+	}{
+		{"mounted route", http.MethodPost, "/payments/api/orders", `{"amount":500}`, http.StatusOK, true},
+		{"host route", http.MethodGet, "/", "", http.StatusOK, false},
+		{"unprefixed route", http.MethodPost, "/api/v1/orders", `{"amount":500}`, http.StatusNotFound, false},
+		// Probes and metrics belong to the host
+		{"no standalone health route", http.MethodGet, "/payments/api/healthz", "", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			host.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if hosted := w.Header().Get("X-Host-Middleware") == "ran"; hosted != tt.hosted {
+				t.Fatalf("host middleware ran: %v, want %v", hosted, tt.hosted)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	host.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/payments/api/orders", strings.NewReader(`{"amount":500}`)))
+	if !strings.Contains(w.Body.String(), "order_embedded") {
+		t.Fatalf("order not created through the host's gateway: %s", w.Body)
+	}
+}
+
+func TestNewRouterServesStandalone(t *testing.T) {
+	t.Setenv("RAZORPAY_API_KEY", "rzp_test_key")
+	t.Setenv("RAZORPAY_SECRET_KEY", "test_secret")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := service.New(orderGateway{}, service.NewMemoryStore(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Shutdown(context.Background())
+
+	var handler http.Handler = httpapi.NewRouter(svc, httpapi.Options{})
+	for _, path := range []string{"/healthz", "/version"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// Actions a client can take after an error
+const (
+	ActionRetry          = "retry"
+	ActionNewOrder       = "new_order"
+	ActionContactSupport = "contact_support"
+	ActionFixInput       = "fix_input"
+)
+
+// errorKind classifies an error response: its status, its stable code, and
+// whether and how the client may recover
+type errorKind struct {
+	Status    int
+	Code      string
+	Retryable bool
+	Action    string
+}
+
+// Every error response is one of these kinds. Upstream failures and
+// timeouts are retryable; nothing the caller sent can succeed unchanged.
+var (
+	kindInvalidRequest       = errorKind{http.StatusBadRequest, "invalid_request", false, ActionFixInput}
+	kindInvalidAmount        = errorKind{http.StatusUnprocessableEntity, "invalid_amount", false, ActionFixInput}
+	kindNoteTooLong          = errorKind{http.StatusUnprocessableEntity, "note_too_long", false, ActionFixInput}
+	kindUnknownBrand         = errorKind{http.StatusBadRequest, "unknown_brand", false, ActionFixInput}
+	kindUnknownTag           = errorKind{http.StatusBadRequest, "unknown_tag", false, ActionFixInput}
+	kindUnknownField         = errorKind{http.StatusBadRequest, "unknown_field", false, ActionFixInput}
+	kindInvalidOrderToken    = errorKind{http.StatusUnauthorized, "invalid_order_token", false, ActionNewOrder}
+	kindSessionExpired       = errorKind{http.StatusGone, "session_expired", false, ActionNewOrder}
+	kindClientMismatch       = errorKind{http.StatusForbidden, "client_mismatch", false, ActionNewOrder}
+	kindSignatureMismatch    = errorKind{http.StatusUnauthorized, "signature_mismatch", false, ActionContactSupport}
+	kindSignatureMalformed   = errorKind{http.StatusBadRequest, "signature_malformed", false, ActionFixInput}
+	kindAlreadyVerified      = errorKind{http.StatusConflict, "already_verified", false, ActionContactSupport}
+	kindPaymentMismatch      = errorKind{http.StatusConflict, "payment_mismatch", false, ActionContactSupport}
+	kindWebhookSignature     = errorKind{http.StatusUnauthorized, "webhook_signature", false, ActionContactSupport}
+	kindWebhookMalformed     = errorKind{http.StatusBadRequest, "webhook_signature_malformed", false, ActionContactSupport}
+	kindWebhookQueueFull     = errorKind{http.StatusServiceUnavailable, "webhook_queue_full", true, ActionRetry}
+	kindWebhooksDisabled     = errorKind{http.StatusServiceUnavailable, "webhooks_disabled", false, ActionContactSupport}
+	kindWebhookTimestamp     = errorKind{http.StatusBadRequest, "webhook_timestamp", false, ActionContactSupport}
+	kindWebhookURLUnset      = errorKind{http.StatusServiceUnavailable, "webhook_url_unset", false, ActionContactSupport}
+	kindTenantsDisabled      = errorKind{http.StatusNotFound, "tenants_disabled", false, ActionContactSupport}
+	kindSMSDisabled          = errorKind{http.StatusNotFound, "sms_disabled", false, ActionContactSupport}
+	kindSimulationDisabled   = errorKind{http.StatusForbidden, "simulation_disabled", false, ActionContactSupport}
+	kindDryRunDisabled       = errorKind{http.StatusForbidden, "dry_run_disabled", false, ActionContactSupport}
+	kindReviewClosed         = errorKind{http.StatusConflict, "review_closed", false, ActionContactSupport}
+	kindApprovalClosed       = errorKind{http.StatusConflict, "approval_closed", false, ActionFixInput}
+	kindSelfApproval         = errorKind{http.StatusForbidden, "self_approval", false, ActionContactSupport}
+	kindScheduleClosed       = errorKind{http.StatusConflict, "schedule_closed", false, ActionFixInput}
+	kindFulfillmentNotFailed = errorKind{http.StatusConflict, "fulfillment_not_failed", false, ActionFixInput}
+	kindTransitionForbidden  = errorKind{http.StatusConflict, "transition_forbidden", false, ActionFixInput}
+	kindOrderNotPaid         = errorKind{http.StatusConflict, "order_not_paid", false, ActionFixInput}
+	kindReceiptConflict      = errorKind{http.StatusConflict, "receipt_conflict", false, ActionFixInput}
+	kindReversalsRequired    = errorKind{http.StatusConflict, "transfer_reversals_required", false, ActionFixInput}
+	kindInsufficientCredit   = errorKind{http.StatusConflict, "insufficient_credit", false, ActionFixInput}
+	kindCreditConflict       = errorKind{http.StatusConflict, "credit_conflict", true, ActionRetry}
+	kindNotFound             = errorKind{http.StatusNotFound, "not_found", false, ActionFixInput}
+	kindUnauthorized         = errorKind{http.StatusUnauthorized, "unauthorized", false, ActionFixInput}
+	kindForbidden            = errorKind{http.StatusForbidden, "forbidden", false, ActionContactSupport}
+	kindTimeout              = errorKind{http.StatusGatewayTimeout, "timeout", true, ActionRetry}
+	kindRateLimited          = errorKind{http.StatusTooManyRequests, "rate_limited", true, ActionRetry}
+	kindUpstreamRejected     = errorKind{http.StatusBadGateway, "upstream_rejected", false, ActionContactSupport}
+	kindUpstream             = errorKind{http.StatusBadGateway, "upstream_error", true, ActionRetry}
+	kindOrderNotSaved        = errorKind{http.StatusInternalServerError, "order_not_saved", true, ActionRetry}
+	kindInternal             = errorKind{http.StatusInternalServerError, "internal", true, ActionRetry}
+)
+
+// APIError is the error envelope for failures the frontend handles
+// programmatically, keyed by Code rather than the message
+type APIError struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	Retryable bool   `json:"retryable"`
+	Action    string `json:"action"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// timeoutError is the body of every 504, whether the request deadline or
+// the Razorpay timeout fired
+func timeoutError(requestID string) APIError {
+	return APIError{
+		Error:     "The payment provider took too long to respond, please retry",
+		Code:      kindTimeout.Code,
+		Retryable: kindTimeout.Retryable,
+		Action:    kindTimeout.Action,
+		RequestID: requestID,
+	}
+}
+
+// respond writes body with the status of kind, adding its classification
+// and the request ID to the envelope
+func respond(c *gin.Context, kind errorKind, body gin.H) {
+	body["code"] = kind.Code
+	body["retryable"] = kind.Retryable
+	body["action"] = kind.Action
+	if id := requestID(c); id != "" {
+		body["request_id"] = id
+	}
+	c.JSON(kind.Status, body)
+}
+
+// writeBindError answers a request body that failed to bind
+func writeBindError(c *gin.Context, err error) {
+	var unknown *unknownFieldError
+	if errors.As(err, &unknown) {
+		respond(c, kindUnknownField, gin.H{
+			"error":   "Unknown field in request body",
+			"field":   unknown.Field,
+			"details": err.Error(),
+		})
+		return
+	}
+	respond(c, kindInvalidRequest, gin.H{
+		"error":   "Invalid request format",
+		"details": err.Error(),
+	})
+}
+
+// writeError maps a service error onto its response. Anything unrecognised
+// is logged and answered with a 500 carrying fallback as the message.
+func writeError(c *gin.Context, err error, fallback string) {
+	var validation *service.ValidationError
+	var rl *gateway.RateLimitError
+	var receipt *service.ReceiptConflictError
+	var rejected *gateway.RequestError
+	var reversals *service.ReversalsRequiredError
+	var brand *service.UnknownBrandError
+
+	switch {
+	case errors.As(err, &validation):
+		body := gin.H{"error": validation.Message}
+		if validation.Details != "" {
+			body["details"] = validation.Details
+		}
+		if validation.Fields != nil {
+			body["fields"] = validation.Fields
+		}
+		respond(c, kindInvalidRequest, body)
+
+	case errors.As(err, &brand):
+		respond(c, kindUnknownBrand, gin.H{
+			"error":   "Unknown brand",
+			"details": brand.Error(),
+			"brands":  brand.Valid,
+		})
+
+	case errors.Is(err, service.ErrUnknownTag):
+		respond(c, kindUnknownTag, gin.H{
+			"error":   "Unknown tag",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrNoteTooLong):
+		respond(c, kindNoteTooLong, gin.H{
+			"error":   "Note value too long",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrInvalidAmount):
+		respond(c, kindInvalidAmount, gin.H{
+			"error":   "Invalid amount",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrInvalidOrderToken):
+		respond(c, kindInvalidOrderToken, gin.H{
+			"error":   "Invalid order token",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrClientBinding):
+		respond(c, kindClientMismatch, gin.H{
+			"error":   "Payment must be verified by the client that created the order",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrSessionExpired):
+		respond(c, kindSessionExpired, gin.H{
+			"error": "Checkout session expired",
+			"hint":  "Create a new checkout session and retry the payment",
+		})
+
+	case errors.Is(err, service.ErrSignatureMalformed):
+		respond(c, kindSignatureMalformed, gin.H{
+			"error": "Payment signature must be 64 hex digits",
+		})
+
+	case errors.Is(err, service.ErrSignatureMismatch):
+		respond(c, kindSignatureMismatch, gin.H{
+			"error": "Invalid payment signature",
+		})
+
+	case errors.Is(err, service.ErrAlreadyVerified):
+		respond(c, kindAlreadyVerified, gin.H{
+			"error": "Payment already verified",
+		})
+
+	case errors.Is(err, service.ErrPaymentMismatch):
+		respond(c, kindPaymentMismatch, gin.H{
+			"error":   "Payment does not match the order",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrWebhookSignatureMalformed):
+		respond(c, kindWebhookMalformed, gin.H{
+			"error": "Webhook signature must be 64 hex digits",
+		})
+
+	case errors.Is(err, service.ErrWebhookSignature):
+		respond(c, kindWebhookSignature, gin.H{
+			"error": "Invalid webhook signature",
+		})
+
+	case errors.Is(err, service.ErrWebhookQueueFull), errors.Is(err, service.ErrWebhookShuttingDown):
+		// Razorpay redelivers on any non-2xx, so this is our backpressure
+		c.Header("Retry-After", "5")
+		respond(c, kindWebhookQueueFull, gin.H{
+			"error": "Webhook queue is full, please redeliver",
+		})
+
+	case errors.Is(err, service.ErrWebhookStale), errors.Is(err, service.ErrWebhookFromFuture):
+		respond(c, kindWebhookTimestamp, gin.H{
+			"error":   "Webhook event is outside the accepted time window",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrWebhooksDisabled):
+		respond(c, kindWebhooksDisabled, gin.H{
+			"error": "Webhooks are not configured",
+		})
+
+	case errors.Is(err, service.ErrTenantsDisabled):
+		respond(c, kindTenantsDisabled, gin.H{
+			"error": "Tenants are not configured",
+		})
+
+	case errors.Is(err, service.ErrSMSDisabled):
+		respond(c, kindSMSDisabled, gin.H{
+			"error": "SMS is not configured",
+		})
+
+	case errors.Is(err, service.ErrWebhookURLUnset):
+		respond(c, kindWebhookURLUnset, gin.H{
+			"error": "Webhook public URL is not configured",
+		})
+
+	case errors.Is(err, service.ErrOrderNotSaved):
+		log.Printf("%s: %v", fallback, err)
+		respond(c, kindOrderNotSaved, gin.H{
+			"error": "The order could not be saved, please retry",
+		})
+
+	case errors.Is(err, service.ErrDryRunDisabled):
+		respond(c, kindDryRunDisabled, gin.H{
+			"error": "Dry-run orders are disabled",
+		})
+
+	case errors.Is(err, service.ErrSimulationDisabled):
+		respond(c, kindSimulationDisabled, gin.H{
+			"error": "Webhook simulation is disabled in release mode",
+		})
+
+	case errors.Is(err, service.ErrReviewClosed):
+		respond(c, kindReviewClosed, gin.H{
+			"error":   "Payment review already closed",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrFulfillmentNotFailed):
+		respond(c, kindFulfillmentNotFailed, gin.H{
+			"error":   "Fulfillment delivery has not failed",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrOrderNotPaid):
+		respond(c, kindOrderNotPaid, gin.H{
+			"error":   "Order is not paid",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrApprovalClosed):
+		respond(c, kindApprovalClosed, gin.H{
+			"error":   "Refund approval already decided",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrSelfApproval):
+		respond(c, kindSelfApproval, gin.H{
+			"error": "A refund must be approved or rejected by someone other than its requester",
+		})
+
+	case errors.Is(err, service.ErrScheduleClosed):
+		respond(c, kindScheduleClosed, gin.H{
+			"error":   "Scheduled action already started or finished",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrInsufficientCredit):
+		respond(c, kindInsufficientCredit, gin.H{
+			"error":   "Not enough store credit available",
+			"details": err.Error(),
+		})
+
+	case errors.Is(err, service.ErrCreditConflict):
+		respond(c, kindCreditConflict, gin.H{
+			"error": "Store credit changed concurrently, try again",
+		})
+
+	case errors.Is(err, service.ErrTransitionForbidden):
+		respond(c, kindTransitionForbidden, gin.H{
+			"error":   "Status transition not allowed",
+			"details": err.Error(),
+		})
+
+	case errors.As(err, &receipt):
+		respond(c, kindReceiptConflict, gin.H{
+			"error":            "Receipt already used for a different amount",
+			"order_id":         receipt.OrderID,
+			"existing_amount":  receipt.ExistingAmount,
+			"requested_amount": receipt.RequestedAmount,
+		})
+
+	case errors.As(err, &reversals):
+		respond(c, kindReversalsRequired, gin.H{
+			"error":     "Reverse the linked transfers before refunding",
+			"details":   reversals.Error(),
+			"reversals": reversals.Reversals,
+		})
+
+	case errors.Is(err, service.ErrNotFound):
+		respond(c, kindNotFound, gin.H{
+			"error": "Not found",
+		})
+
+	case errors.Is(err, gateway.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		c.JSON(kindTimeout.Status, timeoutError(requestID(c)))
+
+	case errors.As(err, &rl):
+		secs := int(math.Ceil(rl.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(secs))
+		respond(c, kindRateLimited, gin.H{
+			"error":       "Payment provider is busy, please retry later",
+			"retry_after": secs,
+		})
+
+	case errors.As(err, &rejected):
+		// Razorpay refused what we sent, so sending it again cannot help
+		log.Printf("%s: %v", fallback, err)
+		respond(c, kindUpstreamRejected, gin.H{
+			"error": fallback,
+		})
+
+	case gateway.IsOutage(err):
+		log.Printf("%s: %v", fallback, err)
+		respond(c, kindUpstream, gin.H{
+			"error": fallback,
+		})
+
+	default:
+		log.Printf("%s: %v", fallback, err)
+		respond(c, kindInternal, gin.H{
+			"error": fallback,
+		})
+	}
+}
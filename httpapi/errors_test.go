@@ -0,0 +1,306 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// declared returns the package-level names declared in the non-test files
+// of dir that start with prefix: variables, or types when types is set
+func declared(t *testing.T, dir, prefix string, types bool) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || (gen.Tok == token.TYPE) != types || (gen.Tok != token.TYPE && gen.Tok != token.VAR) {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						names = append(names, name.Name)
+					}
+				}
+			}
+		}
+	}
+	var matched []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matched = append(matched, name)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// checkListed fails for every name that is not a key of listed
+func checkListed[V any](t *testing.T, names []string, listed map[string]V, what string) {
+	t.Helper()
+	for _, name := range names {
+		if _, ok := listed[name]; !ok {
+			t.Errorf("%s %s is not listed in the test", what, name)
+		}
+	}
+}
+
+// errorKinds lists every error kind by name
+var errorKinds = map[string]errorKind{
+	"kindInvalidRequest":       kindInvalidRequest,
+	"kindInvalidAmount":        kindInvalidAmount,
+	"kindNoteTooLong":          kindNoteTooLong,
+	"kindUnknownBrand":         kindUnknownBrand,
+	"kindUnknownTag":           kindUnknownTag,
+	"kindUnknownField":         kindUnknownField,
+	"kindInvalidOrderToken":    kindInvalidOrderToken,
+	"kindSessionExpired":       kindSessionExpired,
+	"kindClientMismatch":       kindClientMismatch,
+	"kindSignatureMismatch":    kindSignatureMismatch,
+	"kindSignatureMalformed":   kindSignatureMalformed,
+	"kindAlreadyVerified":      kindAlreadyVerified,
+	"kindPaymentMismatch":      kindPaymentMismatch,
+	"kindWebhookSignature":     kindWebhookSignature,
+	"kindWebhookMalformed":     kindWebhookMalformed,
+	"kindWebhookQueueFull":     kindWebhookQueueFull,
+	"kindWebhooksDisabled":     kindWebhooksDisabled,
+	"kindWebhookTimestamp":     kindWebhookTimestamp,
+	"kindWebhookURLUnset":      kindWebhookURLUnset,
+	"kindTenantsDisabled":      kindTenantsDisabled,
+	"kindSMSDisabled":          kindSMSDisabled,
+	"kindSimulationDisabled":   kindSimulationDisabled,
+	"kindDryRunDisabled":       kindDryRunDisabled,
+	"kindReviewClosed":         kindReviewClosed,
+	"kindApprovalClosed":       kindApprovalClosed,
+	"kindSelfApproval":         kindSelfApproval,
+	"kindScheduleClosed":       kindScheduleClosed,
+	"kindFulfillmentNotFailed": kindFulfillmentNotFailed,
+	"kindTransitionForbidden":  kindTransitionForbidden,
+	"kindOrderNotPaid":         kindOrderNotPaid,
+	"kindReceiptConflict":      kindReceiptConflict,
+	"kindReversalsRequired":    kindReversalsRequired,
+	"kindInsufficientCredit":   kindInsufficientCredit,
+	"kindCreditConflict":       kindCreditConflict,
+	"kindNotFound":             kindNotFound,
+	"kindUnauthorized":         kindUnauthorized,
+	"kindForbidden":            kindForbidden,
+	"kindTimeout":              kindTimeout,
+	"kindRateLimited":          kindRateLimited,
+	"kindUpstreamRejected":     kindUpstreamRejected,
+	"kindUpstream":             kindUpstream,
+	"kindOrderNotSaved":        kindOrderNotSaved,
+	"kindInternal":             kindInternal,
+}
+
+// spec is the part of the OpenAPI spec describing the error envelope
+type spec struct {
+	Components struct {
+		Schemas struct {
+			ErrorCode struct {
+				Enum           []string `json:"enum"`
+				Classification map[string]struct {
+					Status    int    `json:"status"`
+					Retryable bool   `json:"retryable"`
+					Action    string `json:"action"`
+				} `json:"x-classification"`
+			}
+			ErrorAction struct {
+				Enum []string `json:"enum"`
+			}
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	var s spec
+	if err := json.Unmarshal(openAPISpec, &s); err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+	return s
+}
+
+func TestSpecMatchesErrorKinds(t *testing.T) {
+	checkListed(t, declared(t, ".", "kind", false), errorKinds, "error kind")
+	s := loadSpec(t)
+	codes := s.Components.Schemas.ErrorCode
+
+	enum := make(map[string]bool)
+	for _, code := range codes.Enum {
+		enum[code] = true
+	}
+	actions := make(map[string]bool)
+	for _, action := range s.Components.Schemas.ErrorAction.Enum {
+		actions[action] = true
+	}
+	seen := make(map[string]string)
+	for name, kind := range errorKinds {
+		if other, ok := seen[kind.Code]; ok {
+			t.Errorf("%s and %s share the code %s", name, other, kind.Code)
+		}
+		seen[kind.Code] = name
+		if !enum[kind.Code] {
+			t.Errorf("%s: code %s missing from the ErrorCode enum", name, kind.Code)
+		}
+		if !actions[kind.Action] {
+			t.Errorf("%s: action %s missing from the ErrorAction enum", name, kind.Action)
+		}
+		got, ok := codes.Classification[kind.Code]
+		if !ok {
+			t.Errorf("%s: code %s has no x-classification", name, kind.Code)
+			continue
+		}
+		if got.Status != kind.Status || got.Retryable != kind.Retryable || got.Action != kind.Action {
+			t.Errorf("%s: spec classifies %s as %+v, want %d %v %s", name, kind.Code, got, kind.Status, kind.Retryable, kind.Action)
+		}
+	}
+	for _, code := range codes.Enum {
+		if _, ok := seen[code]; !ok {
+			t.Errorf("ErrorCode enum lists %s, which no kind has", code)
+		}
+	}
+	for _, action := range []string{ActionRetry, ActionNewOrder, ActionContactSupport, ActionFixInput} {
+		if !actions[action] {
+			t.Errorf("action %s missing from the ErrorAction enum", action)
+		}
+	}
+}
+
+// serviceErrors lists every error the service and gateway packages declare,
+// by name
+var serviceErrors = map[string]error{
+	"service.ErrAlreadyVerified":           service.ErrAlreadyVerified,
+	"service.ErrApprovalClosed":            service.ErrApprovalClosed,
+	"service.ErrArchiveChecksum":           service.ErrArchiveChecksum,
+	"service.ErrClientBinding":             service.ErrClientBinding,
+	"service.ErrClientTokenExpired":        service.ErrClientTokenExpired,
+	"service.ErrClientTokenMismatch":       service.ErrClientTokenMismatch,
+	"service.ErrClientTokenMissing":        service.ErrClientTokenMissing,
+	"service.ErrClientUnbound":             service.ErrClientUnbound,
+	"service.ErrCreditConflict":            service.ErrCreditConflict,
+	"service.ErrDryRunDisabled":            service.ErrDryRunDisabled,
+	"service.ErrFulfillmentNotFailed":      service.ErrFulfillmentNotFailed,
+	"service.ErrInsufficientCredit":        service.ErrInsufficientCredit,
+	"service.ErrInvalidAmount":             service.ErrInvalidAmount,
+	"service.ErrInvalidOrderToken":         service.ErrInvalidOrderToken,
+	"service.ErrLedgerUnbalanced":          service.ErrLedgerUnbalanced,
+	"service.ErrNotFound":                  service.ErrNotFound,
+	"service.ErrNoteTooLong":               service.ErrNoteTooLong,
+	"service.ErrOrderNotPaid":              service.ErrOrderNotPaid,
+	"service.ErrOrderNotSaved":             service.ErrOrderNotSaved,
+	"service.ErrPaymentMismatch":           service.ErrPaymentMismatch,
+	"service.ErrReviewClosed":              service.ErrReviewClosed,
+	"service.ErrSMSDisabled":               service.ErrSMSDisabled,
+	"service.ErrScheduleClosed":            service.ErrScheduleClosed,
+	"service.ErrSelfApproval":              service.ErrSelfApproval,
+	"service.ErrSessionExpired":            service.ErrSessionExpired,
+	"service.ErrSignatureMalformed":        service.ErrSignatureMalformed,
+	"service.ErrSignatureMismatch":         service.ErrSignatureMismatch,
+	"service.ErrSimulationDisabled":        service.ErrSimulationDisabled,
+	"service.ErrTenantsDisabled":           service.ErrTenantsDisabled,
+	"service.ErrTokenAmount":               service.ErrTokenAmount,
+	"service.ErrTokenExpired":              service.ErrTokenExpired,
+	"service.ErrTokenMalformed":            service.ErrTokenMalformed,
+	"service.ErrTokenOrder":                service.ErrTokenOrder,
+	"service.ErrTokenSignature":            service.ErrTokenSignature,
+	"service.ErrTransitionForbidden":       service.ErrTransitionForbidden,
+	"service.ErrUnknownTag":                service.ErrUnknownTag,
+	"service.ErrWebhookFromFuture":         service.ErrWebhookFromFuture,
+	"service.ErrWebhookQueueFull":          service.ErrWebhookQueueFull,
+	"service.ErrWebhookShuttingDown":       service.ErrWebhookShuttingDown,
+	"service.ErrWebhookSignature":          service.ErrWebhookSignature,
+	"service.ErrWebhookSignatureMalformed": service.ErrWebhookSignatureMalformed,
+	"service.ErrWebhookStale":              service.ErrWebhookStale,
+	"service.ErrWebhookURLUnset":           service.ErrWebhookURLUnset,
+	"service.ErrWebhooksDisabled":          service.ErrWebhooksDisabled,
+	"gateway.ErrTimeout":                   gateway.ErrTimeout,
+	"gateway.ErrUnavailable":               gateway.ErrUnavailable,
+	"gateway.ErrUnknownEntity":             gateway.ErrUnknownEntity,
+	"gateway.ErrListTruncated":             gateway.ErrListTruncated,
+
+	"service.UnknownBrandError":      &service.UnknownBrandError{Brand: "x"},
+	"service.ValidationError":        &service.ValidationError{Message: "bad"},
+	"service.ReceiptConflictError":   &service.ReceiptConflictError{Receipt: "r", OrderID: "order_1"},
+	"service.ReversalsRequiredError": &service.ReversalsRequiredError{PaymentID: "pay_1"},
+	"gateway.RequestError":           &gateway.RequestError{Message: "bad"},
+	"gateway.RateLimitError":         &gateway.RateLimitError{RetryAfter: time.Second},
+}
+
+// unanswered are the errors that never reach writeError as themselves, so
+// are left to the internal kind: store and ledger corruption, and
+// listing errors the service converts or handles before answering
+var unanswered = map[string]bool{
+	"service.ErrArchiveChecksum":  true,
+	"service.ErrLedgerUnbalanced": true,
+	"gateway.ErrUnknownEntity":    true,
+	"gateway.ErrListTruncated":    true,
+}
+
+func TestEveryServiceErrorHasKind(t *testing.T) {
+	for pkg, dir := range map[string]string{"service": "../service", "gateway": "../gateway"} {
+		var names []string
+		for _, name := range declared(t, dir, "Err", false) {
+			names = append(names, pkg+"."+name)
+		}
+		for _, name := range declared(t, dir, "", true) {
+			if strings.HasSuffix(name, "Error") && name[0] >= 'A' && name[0] <= 'Z' {
+				names = append(names, pkg+"."+name)
+			}
+		}
+		checkListed(t, names, serviceErrors, "error")
+	}
+	enum := make(map[string]bool)
+	for _, code := range loadSpec(t).Components.Schemas.ErrorCode.Enum {
+		enum[code] = true
+	}
+
+	for name, err := range serviceErrors {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			// Wrapped as the service returns them
+			writeError(c, errors.Join(err, errors.New("context")), "Failed")
+
+			var body APIError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode %s: %v", w.Body, err)
+			}
+			if !enum[body.Code] {
+				t.Fatalf("code %q is not in the spec", body.Code)
+			}
+			if internal := body.Code == kindInternal.Code; internal != unanswered[name] {
+				t.Fatalf("answered with %s; list a kind for it in writeError", body.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/yash170603/golang_payment/flags"
+	"github.com/yash170603/golang_payment/service"
+)
+
+func TestListFeatureFlags(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{"ops-key": {ScopeAdminRead}, "shop-key": {ScopeOrdersCreate}})
+	svc := newTestService(t, &fakeGateway{}, service.WithFlags(flags.Static{"stripe": true, "async_create": false}))
+	r := NewRouter(svc, Options{AdminToken: testAdminToken, APIKeys: keys})
+
+	if w := serve(r, http.MethodGet, "/api/v1/admin/flags", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: status = %d, want 401", w.Code)
+	}
+	if w := serve(r, http.MethodGet, "/api/v1/admin/flags", "shop-key", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("without admin:read: status = %d, want 403", w.Code)
+	}
+	w := serve(r, http.MethodGet, "/api/v1/admin/flags", "ops-key", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Items []flags.Flag `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Items) != 2 || body.Items[0].Name != "async_create" || body.Items[0].Rollout != 0 || body.Items[1].Name != "stripe" || body.Items[1].Rollout != 100 {
+		t.Fatalf("flags = %+v, want async_create off and stripe on", body.Items)
+	}
+}
@@ -0,0 +1,35 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFulfillmentAdminEndpoints(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		bearer string
+		want   int
+		body   string
+	}{
+		{"list", http.MethodGet, "/api/v1/admin/fulfillments", testAdminToken, http.StatusOK, `{"items":[]}`},
+		{"list by status", http.MethodGet, "/api/v1/admin/fulfillments?status=delivered", testAdminToken, http.StatusOK, `{"items":[]}`},
+		{"list unauthenticated", http.MethodGet, "/api/v1/admin/fulfillments", "", http.StatusUnauthorized, ""},
+		{"replay unknown", http.MethodPost, "/api/v1/admin/fulfillments/order_missing/replay", testAdminToken, http.StatusNotFound, ""},
+		{"replay unauthenticated", http.MethodPost, "/api/v1/admin/fulfillments/order_1/replay", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, tt.path, tt.bearer, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Fatalf("body = %s, want %s", w.Body, tt.body)
+			}
+		})
+	}
+}
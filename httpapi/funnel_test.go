@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/yash170603/golang_payment/service"
+)
+
+func TestCheckoutBeaconAndFunnel(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken, FunnelBeaconRateLimit: 3})
+	orderID, _ := createOrder(t, r, 100)
+	createOrder(t, r, 100)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"opened", `{"event":"checkout_opened"}`, http.StatusAccepted},
+		{"duplicate", `{"event":"checkout_opened"}`, http.StatusAccepted},
+		{"other event", `{"event":"payment_captured"}`, http.StatusBadRequest},
+		{"rate limited", `{"event":"checkout_opened"}`, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, http.MethodPost, "/api/v1/orders/"+orderID+"/events", "", tt.body); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if w := serve(r, http.MethodGet, "/api/v1/admin/analytics/funnel", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("funnel unauthenticated: status = %d, want 401", w.Code)
+	}
+	if w := serve(r, http.MethodGet, "/api/v1/admin/analytics/funnel?from=soon", testAdminToken, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("funnel from=soon: status = %d, want 400", w.Code)
+	}
+	w := serve(r, http.MethodGet, "/api/v1/admin/analytics/funnel", testAdminToken, "")
+	var report service.FunnelReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("funnel: %d %s", w.Code, w.Body)
+	}
+	if len(report.Stages) != 4 || report.Stages[0].Orders != 2 || report.Stages[1].Orders != 1 || report.Stages[1].DropOff != 50 {
+		t.Fatalf("stages = %+v, want 2 created and 1 opened", report.Stages)
+	}
+}
+
+func TestAbandonBeaconWithoutBinding(t *testing.T) {
+	// VERIFY_CLIENT_BINDING is off by default, so the order token stands in
+	// for the client token
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	orderID, orderToken := createOrder(t, r, 100)
+	_, otherToken := createOrder(t, r, 100)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no order token", `{"reason":"dismissed"}`, http.StatusUnauthorized},
+		{"another order's token", `{"reason":"dismissed","order_token":"` + otherToken + `"}`, http.StatusUnauthorized},
+		{"order token", `{"reason":"dismissed","order_token":"` + orderToken + `"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/v1/orders/"+orderID+"/abandon", "", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var result service.AbandonResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != service.OrderAbandoned || !result.Abandoned {
+				t.Fatalf("result = %+v, want the order abandoned", result)
+			}
+		})
+	}
+}
+
+func TestRecoveryReportEndpoint(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"last week", "", http.StatusOK},
+		{"period", "?from=1767225600&to=1767312000", http.StatusOK},
+		{"from not a timestamp", "?from=yesterday", http.StatusBadRequest},
+		{"empty period", "?from=1767312000&to=1767225600", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/api/v1/admin/analytics/recovery"+tt.query, testAdminToken, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var report service.RecoveryReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || report.Sent != 0 || report.Skipped == nil {
+				t.Fatalf("report = %s, want an empty report", w.Body)
+			}
+		})
+	}
+	if w := serve(r, http.MethodGet, "/api/v1/admin/analytics/recovery", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,1424 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/service"
+)
+
+type handlers struct {
+	svc  *service.Service
+	opts Options
+}
+
+func (h *handlers) CreateOrder(c *gin.Context) {
+	var req service.PaymentRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	order, err := h.svc.CreateOrder(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to create order")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *handlers) GetOrder(c *gin.Context) {
+	order, err := h.svc.GetOrder(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeOrderFetchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderV2 serves the typed order of the v2 API
+func (h *handlers) GetOrderV2(c *gin.Context) {
+	order, err := h.svc.OrderView(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeOrderFetchError(c, err)
+		return
+	}
+
+	renderV2(c, http.StatusOK, order)
+}
+
+// writeOrderFetchError answers a failed order fetch. Anything but a missing
+// order or a rate limit is reported as an upstream failure.
+func writeOrderFetchError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrNotFound) {
+		respond(c, kindNotFound, gin.H{
+			"error": "Order not found",
+		})
+		return
+	}
+	var rl *gateway.RateLimitError
+	if errors.As(err, &rl) {
+		writeError(c, err, "Failed to fetch order")
+		return
+	}
+	log.Printf("Error fetching order: %v", err)
+	respond(c, kindUpstream, gin.H{
+		"error": "Failed to fetch order",
+	})
+}
+
+// ListRazorpayOrders returns a page of orders straight from Razorpay,
+// selected by the ?from and ?to Unix timestamps and ?count and ?skip
+func (h *handlers) ListRazorpayOrders(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var from, to, count, skip int64
+	for _, q := range []struct {
+		name   string
+		target *int64
+	}{{"from", &from}, {"to", &to}, {"count", &count}, {"skip", &skip}} {
+		if v := c.Query(q.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				respond(c, kindInvalidRequest, gin.H{
+					"error":   "Invalid request format",
+					"details": q.name + " must be an integer",
+				})
+				return
+			}
+			*q.target = n
+		}
+	}
+
+	page, err := h.svc.ListRazorpayOrders(c.Request.Context(), service.OrderPageRequest{
+		From:  from,
+		To:    to,
+		Count: int(count),
+		Skip:  int(skip),
+	})
+	if err != nil {
+		writeListError(c, err, "Failed to list Razorpay orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchOrders finds local orders by ?note_key and ?note_value and by
+// every ?tag given, paged by ?count and ?skip
+func (h *handlers) SearchOrders(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var count, skip int
+	for _, q := range []struct {
+		name   string
+		target *int
+	}{{"count", &count}, {"skip", &skip}} {
+		if v := c.Query(q.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				respond(c, kindInvalidRequest, gin.H{
+					"error":   "Invalid request format",
+					"details": q.name + " must be an integer",
+				})
+				return
+			}
+			*q.target = n
+		}
+	}
+
+	page, err := h.svc.SearchOrders(c.Request.Context(), service.OrderSearchRequest{
+		NoteKey:   c.Query("note_key"),
+		NoteValue: c.Query("note_value"),
+		Tags:      c.QueryArray("tag"),
+		Count:     count,
+		Skip:      skip,
+	})
+	if err != nil {
+		writeError(c, err, "Failed to search orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// writeListError answers a failed upstream listing: bad parameters are
+// the caller's, and a failure reaching Razorpay is reported as upstream
+// rather than internal
+func writeListError(c *gin.Context, err error, fallback string) {
+	var invalid *service.ValidationError
+	var rl *gateway.RateLimitError
+	var rejected *gateway.RequestError
+	if errors.As(err, &invalid) || errors.As(err, &rl) || errors.As(err, &rejected) ||
+		errors.Is(err, gateway.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		writeError(c, err, fallback)
+		return
+	}
+	log.Printf("%s: %v", fallback, err)
+	respond(c, kindUpstream, gin.H{
+		"error": fallback,
+	})
+}
+
+func (h *handlers) GetOrderPaymentMethod(c *gin.Context) {
+	method, err := h.svc.OrderPaymentMethod(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to fetch order payments")
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+// GetReceipt renders the receipt of a paid order as HTML, or as PDF with
+// ?format=pdf
+func (h *handlers) GetReceipt(c *gin.Context) {
+	format := c.DefaultQuery("format", "html")
+	if format != "html" && format != "pdf" {
+		respond(c, kindInvalidRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": fmt.Sprintf("format must be html or pdf, got %q", format),
+		})
+		return
+	}
+	receipt, err := h.svc.Receipt(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to render receipt")
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "receipt-"+receipt.OrderID+".pdf"))
+		err = receipt.RenderPDF(&buf)
+	} else {
+		err = receipt.RenderHTML(&buf)
+	}
+	if err != nil {
+		writeError(c, err, "Failed to render receipt")
+		return
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+func (h *handlers) GetPayment(c *gin.Context) {
+	payment, err := h.svc.GetPayment(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to fetch payment")
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+func (h *handlers) ListOrderPayments(c *gin.Context) {
+	payments, err := h.svc.OrderPayments(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to fetch order payments")
+		return
+	}
+
+	c.JSON(http.StatusOK, payments)
+}
+
+func (h *handlers) VerifyOrder(c *gin.Context) {
+	var req service.PaymentVerificationRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+
+	verification, err := h.svc.VerifyPayment(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to verify payment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Payment verified successfully",
+		"status_token": verification.StatusToken,
+	})
+}
+
+// FetchOrderBatch returns the orders asked for by ID. The response is 200
+// even when some could not be fetched; each carries its own error.
+func (h *handlers) FetchOrderBatch(c *gin.Context) {
+	var req service.OrderBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	orders, err := h.svc.FetchOrderBatch(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to fetch orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// CreateOrderBatch creates orders for a bulk import, each with its own
+// receipt and notes. The response is 200 whenever the batch is well formed;
+// each item reports whether it was created.
+func (h *handlers) CreateOrderBatch(c *gin.Context) {
+	var req service.OrderCreateBatchRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	results, err := h.svc.CreateOrderBatch(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to create orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// VerifyOrderBatch verifies checkouts synced by offline POS devices. Each
+// item gets its own result, so the response is 200 even when some fail.
+func (h *handlers) VerifyOrderBatch(c *gin.Context) {
+	var req service.BatchVerificationRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+
+	batch, err := h.svc.VerifyPaymentBatch(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to verify payments")
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// PaymentStatus serves the embeddable status widget. Missing parameters,
+// bad tokens and unknown orders all get the same 404.
+func (h *handlers) PaymentStatus(c *gin.Context) {
+	status, err := h.svc.PaymentStatus(c.Request.Context(), c.Query("order_id"), c.Query("token"))
+	if err != nil {
+		respond(c, kindNotFound, gin.H{
+			"error": "Not found",
+		})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *handlers) CreatePaymentLink(c *gin.Context) {
+	var req service.PaymentLinkRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	link, err := h.svc.CreatePaymentLink(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to create payment link")
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// HandleWebhook acknowledges a Razorpay delivery once it is verified and
+// queued; processing happens asynchronously. Deliveries to the URL of a
+// routed account are verified with that account's secret.
+func (h *handlers) HandleWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		respond(c, kindInvalidRequest, gin.H{
+			"error": "Failed to read request body",
+		})
+		return
+	}
+
+	signature, eventID := c.GetHeader("X-Razorpay-Signature"), c.GetHeader("X-Razorpay-Event-Id")
+	if account := c.Param("account"); account != "" {
+		err = h.svc.HandleAccountWebhook(account, body, signature, eventID)
+	} else {
+		err = h.svc.HandleWebhook(body, signature, eventID)
+	}
+	if err != nil {
+		writeError(c, err, "Failed to accept webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "queued"})
+}
+
+// HandleSMSStatus reconciles a delivery report from the SMS provider with
+// the texts sent
+func (h *handlers) HandleSMSStatus(c *gin.Context) {
+	matched, err := h.svc.HandleSMSStatus(c.Request)
+	if err != nil {
+		writeError(c, err, "Failed to accept SMS status")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matched": matched})
+}
+
+func (h *handlers) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.svc.PublicConfig(c.Request.Context()))
+}
+
+// ListCurrencies serves the currencies orders may be created in, so
+// checkout can offer them with their minor units and limits
+func (h *handlers) ListCurrencies(c *gin.Context) {
+	list, err := h.svc.SupportedCurrencies(c.Request.Context())
+	if err != nil {
+		writeError(c, err, "Failed to list currencies")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *handlers) CreateCheckoutSession(c *gin.Context) {
+	var req service.CheckoutSessionRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	session, err := h.svc.CreateCheckoutSession(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to create checkout session")
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+func (h *handlers) GetCheckoutSession(c *gin.Context) {
+	session, err := h.svc.CheckoutSession(c.Param("id"))
+	if errors.Is(err, service.ErrNotFound) {
+		respond(c, kindNotFound, gin.H{
+			"error": "Checkout session not found",
+		})
+		return
+	}
+	if err != nil {
+		writeError(c, err, "Failed to fetch checkout session")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func (h *handlers) Healthz(c *gin.Context) {
+	c.String(http.StatusOK, "ok")
+}
+
+// BuildVersion describes the running build, from the build info the Go
+// toolchain embeds
+type BuildVersion struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildVersion is read once, it cannot change while running
+var buildVersion = sync.OnceValue(func() BuildVersion {
+	v := BuildVersion{Version: "unknown", GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	if info.Main.Version != "" {
+		v.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			v.Revision = s.Value
+		case "vcs.time":
+			v.Time = s.Value
+		case "vcs.modified":
+			v.Modified = s.Value == "true"
+		}
+	}
+	return v
+})
+
+// Version reports the running build
+func (h *handlers) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, buildVersion())
+}
+
+func (h *handlers) DetailedHealth(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	report := h.svc.Health(c.Request.Context(), h.opts.HealthCheckTimeout)
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+func (h *handlers) RunSmokeTest(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req struct {
+		SimulatePayment bool `json:"simulate_payment"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeBindError(c, err)
+			return
+		}
+	}
+
+	report, err := h.svc.RunSmokeTest(c.Request.Context(), c.Param("id"), req.SimulatePayment)
+	if err != nil {
+		writeError(c, err, "Failed to run smoke test")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *handlers) GetSmokeTest(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	report, err := h.svc.SmokeTestResult(c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to fetch smoke test")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// SimulateWebhook signs a fake Razorpay event and feeds it through the real
+// webhook intake. It exists strictly for testing and is refused in release
+// mode.
+func (h *handlers) SimulateWebhook(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req service.WebhookSimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	sim, err := h.svc.SimulateWebhook(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to simulate webhook")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, sim)
+}
+
+// ProvisionWebhook points the Razorpay webhook at this service
+func (h *handlers) ProvisionWebhook(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	result, err := h.svc.ProvisionWebhook(c.Request.Context())
+	if err != nil {
+		writeError(c, err, "Failed to provision webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetWebhookDrift reports how the Razorpay webhook differs from the
+// expected configuration
+func (h *handlers) GetWebhookDrift(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	drift, err := h.svc.WebhookDrift(c.Request.Context())
+	if err != nil {
+		writeError(c, err, "Failed to check webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, drift)
+}
+
+func (h *handlers) ListDeadLetters(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.svc.DeadLetters(),
+	})
+}
+
+func (h *handlers) ListFeatureFlags(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.svc.FeatureFlags(),
+	})
+}
+
+// GetServerTime reports the server's clock for diagnosing skew between
+// instances
+func (h *handlers) GetServerTime(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.svc.TimeReport(c.Request.Context()))
+}
+
+// ListRunners reports the state, last error and restarts of each
+// background worker
+func (h *handlers) ListRunners(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runners": h.svc.Runners()})
+}
+
+// ListSMSMessages reports the recent texts and their delivery status
+func (h *handlers) ListSMSMessages(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	messages, err := h.svc.SMSMessages()
+	if err != nil {
+		writeError(c, err, "Failed to list SMS messages")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": messages})
+}
+
+// ListSMSSuppressions lists the numbers opted out of texts
+func (h *handlers) ListSMSSuppressions(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	numbers, err := h.svc.SMSSuppressions()
+	if err != nil {
+		writeError(c, err, "Failed to list SMS suppressions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": numbers})
+}
+
+// SuppressSMS opts the contact out of texts
+func (h *handlers) SuppressSMS(c *gin.Context) {
+	h.setSMSSuppression(c, true)
+}
+
+// UnsuppressSMS opts the contact back in to texts
+func (h *handlers) UnsuppressSMS(c *gin.Context) {
+	h.setSMSSuppression(c, false)
+}
+
+func (h *handlers) setSMSSuppression(c *gin.Context, suppress bool) {
+	who, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.SuppressSMS(c.Param("contact"), suppress); err != nil {
+		writeError(c, err, "Failed to update SMS suppression")
+		return
+	}
+	log.Printf("SMS suppression of a contact set to %t by %s", suppress, who.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// GetAPIKeyUsage reports each API key's calls per scope since startup
+func (h *handlers) GetAPIKeyUsage(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.opts.APIKeys.Usage(),
+	})
+}
+
+// RecordCheckoutEvent takes a funnel beacon from the checkout page. It
+// answers 202 without checking the order, so beacons stay cheap.
+func (h *handlers) RecordCheckoutEvent(c *gin.Context) {
+	var ev service.CheckoutEvent
+	if err := c.ShouldBindJSON(&ev); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.svc.RecordCheckoutEvent(c.Param("id"), ev); err != nil {
+		writeError(c, err, "Failed to record event")
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// AbandonOrder takes the beacon the checkout page sends when the customer
+// leaves without paying, and answers with the order's status
+func (h *handlers) AbandonOrder(c *gin.Context) {
+	var req service.AbandonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	result, err := h.svc.AbandonOrder(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to abandon order")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetFunnel reports the payment funnel of the orders created between the
+// ?from and ?to Unix timestamps, the last seven days by default
+func (h *handlers) GetFunnel(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	if !timeQuery(c, "from", &from) || !timeQuery(c, "to", &to) {
+		return
+	}
+
+	report, err := h.svc.Funnel(from, to)
+	if err != nil {
+		writeError(c, err, "Failed to build funnel")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetRecoveryReport reports how payment recovery links converted, over
+// the last week unless from and to say otherwise
+func (h *handlers) GetRecoveryReport(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	if !timeQuery(c, "from", &from) || !timeQuery(c, "to", &to) {
+		return
+	}
+
+	report, err := h.svc.RecoveryReport(from, to)
+	if err != nil {
+		writeError(c, err, "Failed to build recovery report")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// timeQuery reads the Unix timestamp ?name into target when it is set,
+// answering 400 and reporting false when it is malformed
+func timeQuery(c *gin.Context, name string, target *time.Time) bool {
+	v := c.Query(name)
+	if v == "" {
+		return true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		respond(c, kindInvalidRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": name + " must be a Unix timestamp",
+		})
+		return false
+	}
+	*target = time.Unix(n, 0)
+	return true
+}
+
+// GetLedger lists the ledger transactions touching ?account, or all of
+// them, posted between the ?from and ?to Unix timestamps
+func (h *handlers) GetLedger(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var from, to time.Time
+	if !timeQuery(c, "from", &from) || !timeQuery(c, "to", &to) {
+		return
+	}
+	report, err := h.svc.Ledger(c.Request.Context(), c.Query("account"), from, to)
+	if err != nil {
+		writeError(c, err, "Failed to read ledger")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetTrialBalance reports every account's balance at the ?at Unix
+// timestamp, now by default
+func (h *handlers) GetTrialBalance(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	at := time.Now()
+	if !timeQuery(c, "at", &at) {
+		return
+	}
+	tb, err := h.svc.TrialBalance(c.Request.Context(), at)
+	if err != nil {
+		writeError(c, err, "Failed to build trial balance")
+		return
+	}
+
+	c.JSON(http.StatusOK, tb)
+}
+
+// CorrectLedgerTransaction reverses a posted ledger transaction with a new
+// one
+func (h *handlers) CorrectLedgerTransaction(c *gin.Context) {
+	caller, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	var req service.LedgerCorrectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	req.Author = caller.String()
+
+	tx, err := h.svc.CorrectLedgerTransaction(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to correct ledger transaction")
+		return
+	}
+
+	c.JSON(http.StatusCreated, tx)
+}
+
+// GetCredit reports a customer's store credit
+func (h *handlers) GetCredit(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	balance, err := h.svc.CreditBalance(c.Request.Context(), c.Param("customer"))
+	if err != nil {
+		writeError(c, err, "Failed to read credit")
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// GrantCredit adds to a customer's store credit
+func (h *handlers) GrantCredit(c *gin.Context) {
+	h.adjustCredit(c, h.svc.GrantCredit, "Failed to grant credit")
+}
+
+// DeductCredit takes from a customer's available store credit
+func (h *handlers) DeductCredit(c *gin.Context) {
+	h.adjustCredit(c, h.svc.DeductCredit, "Failed to deduct credit")
+}
+
+func (h *handlers) adjustCredit(c *gin.Context, adjust func(context.Context, string, service.CreditAdjustment) (service.CreditBalance, error), failure string) {
+	caller, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	var req service.CreditAdjustment
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	req.Author = caller.String()
+
+	balance, err := adjust(c.Request.Context(), c.Param("customer"), req)
+	if err != nil {
+		writeError(c, err, failure)
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// RefreshCheckoutMethods re-reads the account's payment methods from
+// Razorpay instead of waiting for the cached copy to go stale
+func (h *handlers) RefreshCheckoutMethods(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	methods, err := h.svc.RefreshCheckoutMethods(c.Request.Context())
+	if err != nil {
+		writeError(c, err, "Failed to refresh checkout methods")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"methods": methods})
+}
+
+// ListFulfillments lists fulfillment deliveries, pending and failed ones by
+// default or those in the comma-separated ?status
+func (h *handlers) ListFulfillments(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	states := []string{service.FulfillmentPending, service.FulfillmentFailed}
+	if v := c.Query("status"); v != "" {
+		states = strings.Split(v, ",")
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.svc.Fulfillments(states...),
+	})
+}
+
+// ReplayFulfillment retries a dead-lettered fulfillment delivery
+func (h *handlers) ReplayFulfillment(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	delivery, err := h.svc.ReplayFulfillment(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to replay fulfillment")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// OrderByReceipt returns the order for an upstream document number,
+// creating it on the first call: 201 when created, 200 when it existed
+func (h *handlers) OrderByReceipt(c *gin.Context) {
+	var req service.ReceiptOrderRequest
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	order, created, err := h.svc.OrderByReceipt(c.Request.Context(), c.Param("receipt"), req)
+	if err != nil {
+		writeError(c, err, "Failed to create order")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, order)
+}
+
+// UpdateOrderNotes merges notes into an order on Razorpay and locally
+func (h *handlers) UpdateOrderNotes(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req service.OrderNotesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	notes, err := h.svc.UpdateOrderNotes(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to update order notes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notes": notes,
+	})
+}
+
+// ListCaptureReviews lists payments held by the capture policy
+func (h *handlers) ListCaptureReviews(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.svc.CaptureReviews(),
+	})
+}
+
+// ApproveCapture captures a held payment
+func (h *handlers) ApproveCapture(c *gin.Context) {
+	h.decideCapture(c, h.svc.ApproveCapture, "Failed to capture payment")
+}
+
+// RejectCapture leaves a held payment uncaptured
+func (h *handlers) RejectCapture(c *gin.Context) {
+	h.decideCapture(c, h.svc.RejectCapture, "Failed to reject payment")
+}
+
+func (h *handlers) decideCapture(c *gin.Context, decide func(context.Context, string, service.ReviewDecision) (service.HeldPayment, error), fallback string) {
+	caller, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	var req service.ReviewDecision
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	req.Author = caller.String()
+
+	hold, err := decide(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, fallback)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// ListNotificationChannels reports queue depth, last success and failure
+// streak for each notification channel
+func (h *handlers) ListNotificationChannels(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.svc.NotificationChannels(),
+	})
+}
+
+func (h *handlers) GetLocalOrder(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	order, err := h.svc.LocalOrder(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to fetch order")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// TagOrder adds tags from the vocabulary to a local order
+func (h *handlers) TagOrder(c *gin.Context) {
+	h.changeTags(c, h.svc.TagOrder)
+}
+
+// UntagOrder removes tags from a local order
+func (h *handlers) UntagOrder(c *gin.Context) {
+	h.changeTags(c, h.svc.UntagOrder)
+}
+
+// changeTags binds an OrderTagsRequest and applies it with change on
+// behalf of the caller
+func (h *handlers) changeTags(c *gin.Context, change func(context.Context, string, string, service.OrderTagsRequest) (service.Order, error)) {
+	caller, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	var req service.OrderTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	order, err := change(c.Request.Context(), c.Param("id"), caller.String(), req)
+	if err != nil {
+		writeError(c, err, "Failed to update order tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *handlers) AddOperatorNote(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req service.OperatorNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	order, err := h.svc.AddOperatorNote(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to add note")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *handlers) OverrideStatus(c *gin.Context) {
+	caller, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	var req service.StatusOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	req.Author = caller.String()
+
+	order, err := h.svc.OverrideStatus(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to override status")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// Renotify re-sends the verification notification of a paid order
+func (h *handlers) Renotify(c *gin.Context) {
+	caller, ok := principal(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.svc.Renotify(c.Request.Context(), c.Param("id"), caller.String())
+	if err != nil {
+		writeError(c, err, "Failed to renotify")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CapturePayment captures an authorized payment
+func (h *handlers) CapturePayment(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req service.CaptureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if req.CaptureAt != nil {
+		scheduled, err := h.svc.ScheduleCapture(c.Request.Context(), c.Param("id"), req)
+		if err != nil {
+			writeError(c, err, "Failed to schedule capture")
+			return
+		}
+		c.JSON(http.StatusAccepted, scheduled)
+		return
+	}
+
+	payment, err := h.svc.CapturePayment(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to capture payment")
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// CreateRefund refunds a captured payment
+func (h *handlers) CreateRefund(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req service.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	if req.ExecuteAt != nil {
+		scheduled, err := h.svc.ScheduleRefund(c.Request.Context(), req)
+		if err != nil {
+			writeError(c, err, "Failed to schedule refund")
+			return
+		}
+		c.JSON(http.StatusAccepted, scheduled)
+		return
+	}
+
+	refund, approval, err := h.svc.RequestRefund(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err, "Failed to create refund")
+		return
+	}
+	if approval != nil {
+		c.JSON(http.StatusAccepted, approval)
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// ListScheduledActions lists scheduled refunds and captures, optionally
+// filtered by ?kind and ?status
+func (h *handlers) ListScheduledActions(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	actions, err := h.svc.ScheduledActions(c.Request.Context(), c.Query("kind"), c.Query("status"))
+	if err != nil {
+		writeError(c, err, "Failed to list scheduled actions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": actions,
+	})
+}
+
+// GetScheduledAction reports one scheduled refund or capture
+func (h *handlers) GetScheduledAction(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	action, err := h.svc.ScheduledAction(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to read scheduled action")
+		return
+	}
+
+	c.JSON(http.StatusOK, action)
+}
+
+// CancelScheduledAction cancels a scheduled refund or capture that has not
+// started executing
+func (h *handlers) CancelScheduledAction(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	action, err := h.svc.CancelScheduledAction(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to cancel scheduled action")
+		return
+	}
+
+	c.JSON(http.StatusOK, action)
+}
+
+// ListPendingRefunds lists the refunds awaiting a second admin's approval
+func (h *handlers) ListPendingRefunds(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": h.svc.PendingRefunds(),
+	})
+}
+
+// ApproveRefund approves a held refund, creating it with Razorpay
+func (h *handlers) ApproveRefund(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var d service.ReviewDecision
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&d); err != nil {
+			writeBindError(c, err)
+			return
+		}
+	}
+
+	approval, refund, err := h.svc.ApproveRefund(c.Request.Context(), c.Param("id"), d)
+	if err != nil {
+		writeError(c, err, "Failed to approve refund")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"approval": approval, "refund": refund})
+}
+
+// RejectRefund rejects a held refund
+func (h *handlers) RejectRefund(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var d service.ReviewDecision
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&d); err != nil {
+			writeBindError(c, err)
+			return
+		}
+	}
+
+	approval, err := h.svc.RejectRefund(c.Request.Context(), c.Param("id"), d)
+	if err != nil {
+		writeError(c, err, "Failed to reject refund")
+		return
+	}
+
+	c.JSON(http.StatusOK, approval)
+}
+
+func (h *handlers) ReverseTransfer(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var req service.ReversalRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeBindError(c, err)
+			return
+		}
+	}
+
+	reversal, err := h.svc.ReverseTransfer(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		writeError(c, err, "Failed to reverse transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, reversal)
+}
+
+func (h *handlers) ListTransferReversals(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	reversals, err := h.svc.TransferReversals(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, err, "Failed to fetch transfer reversals")
+		return
+	}
+
+	c.JSON(http.StatusOK, reversals)
+}
+
+// ListUpstream streams a Razorpay collection as newline-delimited JSON.
+// Failures after the first record cannot change the status, so they are
+// reported as a final {"error": ...} line; hitting the item cap ends the
+// stream with {"truncated": true}.
+func (h *handlers) ListUpstream(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	req := service.ListRequest{Entity: c.Param("entity")}
+	for _, q := range []struct {
+		name   string
+		target *int64
+	}{{"from", &req.From}, {"to", &req.To}} {
+		if v := c.Query(q.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				respond(c, kindInvalidRequest, gin.H{
+					"error":   "Invalid request format",
+					"details": q.name + " must be a Unix timestamp",
+				})
+				return
+			}
+			*q.target = n
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			respond(c, kindInvalidRequest, gin.H{
+				"error":   "Invalid request format",
+				"details": "limit must be an integer",
+			})
+			return
+		}
+		req.Limit = n
+	}
+
+	started := false
+	start := func() {
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+	}
+	enc := json.NewEncoder(c.Writer)
+	err := h.svc.ListUpstream(c.Request.Context(), req, func(item map[string]interface{}) error {
+		start()
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	truncated := errors.Is(err, gateway.ErrListTruncated)
+	if err != nil && !truncated && !started {
+		writeError(c, err, "Failed to list "+req.Entity)
+		return
+	}
+	start()
+	switch {
+	case truncated:
+		_ = enc.Encode(gin.H{"truncated": true})
+	case err != nil:
+		log.Printf("Listing %s failed mid-stream: %v", req.Entity, err)
+		_ = enc.Encode(gin.H{"error": "Failed to list " + req.Entity})
+	}
+}
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHeadOnReadEndpoints(t *testing.T) {
+	server := httptest.NewServer(NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken, HealthCheckTimeout: time.Second}))
+	defer server.Close()
+	do := func(method, path, bearer string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		path   string
+		bearer string
+		want   int
+	}{
+		{"/healthz", "", http.StatusOK},
+		{"/version", "", http.StatusOK},
+		{"/metrics", "", http.StatusOK},
+		{"/health/detailed", testAdminToken, http.StatusOK},
+		{"/health/detailed", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			get := do(http.MethodGet, tt.path, tt.bearer)
+			get.Body.Close()
+			head := do(http.MethodHead, tt.path, tt.bearer)
+			defer head.Body.Close()
+			body, _ := io.ReadAll(head.Body)
+			if head.StatusCode != tt.want || get.StatusCode != tt.want {
+				t.Fatalf("HEAD %d, GET %d, want %d", head.StatusCode, get.StatusCode, tt.want)
+			}
+			if ct := head.Header.Get("Content-Type"); ct != get.Header.Get("Content-Type") {
+				t.Fatalf("HEAD Content-Type = %q, want GET's %q", ct, get.Header.Get("Content-Type"))
+			}
+			if len(body) != 0 {
+				t.Fatalf("HEAD body = %q, want none", body)
+			}
+		})
+	}
+}
+
+func TestHeadRejectedElsewhere(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	for _, path := range []string{
+		"/api/v1/orders",
+		"/api/v1/orders/order_1",
+		"/api/v1/verify",
+		"/api/v1/config",
+		"/api/v1/webhooks/razorpay",
+		"/api/v1/admin/orders",
+	} {
+		if w := serve(r, http.MethodHead, path, testAdminToken, ""); w.Code != http.StatusNotFound {
+			t.Errorf("HEAD %s = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	w := serve(r, http.MethodGet, "/version", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var v BuildVersion
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version == "" || v.GoVersion != runtime.Version() {
+		t.Fatalf("version = %+v, want the build's with Go %s", v, runtime.Version())
+	}
+}
@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDetailedHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		pingErr error
+		bearer  string
+		want    int
+		status  string
+	}{
+		{"healthy", nil, testAdminToken, http.StatusOK, "healthy"},
+		{"razorpay down", errors.New("dial tcp: connection refused"), testAdminToken, http.StatusServiceUnavailable, "unhealthy"},
+		{"anonymous", nil, "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(newTestService(t, &fakeGateway{pingErr: tt.pingErr}), Options{AdminToken: testAdminToken, HealthCheckTimeout: time.Second})
+			w := serve(r, http.MethodGet, "/health/detailed", tt.bearer, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.status == "" {
+				return
+			}
+			var report struct {
+				Status       string `json:"status"`
+				Dependencies map[string]struct {
+					Status string `json:"status"`
+				} `json:"dependencies"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.status || report.Dependencies["razorpay"].Status == "" {
+				t.Fatalf("report = %s, want %s with razorpay", w.Body, tt.status)
+			}
+		})
+	}
+}
+
+func TestHealthzStaysFlat(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{pingErr: errors.New("down")}), Options{})
+	if w := serve(r, http.MethodGet, "/healthz", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("/healthz = %d with Razorpay down, want 200", w.Code)
+	}
+}
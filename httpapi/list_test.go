@@ -0,0 +1,130 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// listGateway answers ListOrders with count orders, or err, recording the
+// parameters of the last call
+type listGateway struct {
+	*fakeGateway
+
+	count  int
+	err    error
+	params map[string]interface{}
+}
+
+func (g *listGateway) ListOrders(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	g.params = params
+	if g.err != nil {
+		return nil, g.err
+	}
+	items := make([]interface{}, g.count)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": fmt.Sprintf("order_%d", i+1), "entity": "order"}
+	}
+	return map[string]interface{}{"entity": "collection", "count": len(items), "items": items}, nil
+}
+
+func TestListRazorpayOrdersParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		want   int
+		params map[string]interface{}
+	}{
+		{"defaults", "", http.StatusOK, map[string]interface{}{"count": 10, "skip": 0}},
+		{"range and page", "?from=1700000000&to=1700086400&count=25&skip=50", http.StatusOK,
+			map[string]interface{}{"from": int64(1700000000), "to": int64(1700086400), "count": 25, "skip": 50}},
+		{"count capped", "?count=500", http.StatusOK, map[string]interface{}{"count": 100, "skip": 0}},
+		{"from after to", "?from=1700086400&to=1700000000", http.StatusBadRequest, nil},
+		{"negative from", "?from=-1", http.StatusBadRequest, nil},
+		{"negative count", "?count=-1", http.StatusBadRequest, nil},
+		{"negative skip", "?skip=-10", http.StatusBadRequest, nil},
+		{"not a number", "?count=ten", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &listGateway{fakeGateway: &fakeGateway{}, count: 2}
+			r := NewRouter(newTestService(t, gw), Options{AdminToken: testAdminToken})
+			w := serve(r, http.MethodGet, "/api/v1/razorpay/orders"+tt.query, testAdminToken, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if !reflect.DeepEqual(gw.params, tt.params) {
+				t.Fatalf("sent %v to Razorpay, want %v", gw.params, tt.params)
+			}
+		})
+	}
+}
+
+func TestListRazorpayOrdersPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		hasMore  bool
+		nextSkip int
+	}{
+		{"full page", 5, true, 15},
+		{"last page", 3, false, 0},
+		{"empty", 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &listGateway{fakeGateway: &fakeGateway{}, count: tt.count}
+			r := NewRouter(newTestService(t, gw), Options{AdminToken: testAdminToken})
+			w := serve(r, http.MethodGet, "/api/v1/razorpay/orders?count=5&skip=10", testAdminToken, "")
+			var page struct {
+				Items      []map[string]interface{} `json:"items"`
+				Pagination struct {
+					Returned int  `json:"returned"`
+					HasMore  bool `json:"has_more"`
+					NextSkip int  `json:"next_skip"`
+				} `json:"pagination"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if page.Items == nil || len(page.Items) != tt.count || page.Pagination.Returned != tt.count ||
+				page.Pagination.HasMore != tt.hasMore || page.Pagination.NextSkip != tt.nextSkip {
+				t.Fatalf("page = %s, want %d items, more %v from %d", w.Body, tt.count, tt.hasMore, tt.nextSkip)
+			}
+		})
+	}
+}
+
+func TestListRazorpayOrdersUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"unreachable", errors.New("connection refused"), "upstream_error"},
+		{"rejected", &gateway.RequestError{Message: "bad from"}, "upstream_rejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &listGateway{fakeGateway: &fakeGateway{}, err: tt.err}
+			r := NewRouter(newTestService(t, gw), Options{AdminToken: testAdminToken})
+			w := serve(r, http.MethodGet, "/api/v1/razorpay/orders", testAdminToken, "")
+			var body APIError
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusBadGateway || body.Code != tt.code {
+				t.Fatalf("status = %d: %s, want 502 %s", w.Code, w.Body, tt.code)
+			}
+		})
+	}
+
+	r := NewRouter(newTestService(t, &listGateway{fakeGateway: &fakeGateway{}}), Options{AdminToken: testAdminToken})
+	if w := serve(r, http.MethodGet, "/api/v1/razorpay/orders", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: status = %d, want 401", w.Code)
+	}
+}
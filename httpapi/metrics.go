@@ -0,0 +1,27 @@
+package httpapi
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// withMetrics records the count and latency of each request by API
+// version and route pattern, so IDs in paths do not become label values.
+// It must run after withTenant for the merchant label to be set.
+func withMetrics(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		tenant, _ := authctx.Tenant(c.Request.Context())
+		merchant := metrics.Merchant(tenant)
+		route := c.FullPath()
+		metrics.Requests.WithLabelValues(version, c.Request.Method, route, strconv.Itoa(c.Writer.Status()), merchant).Inc()
+		metrics.RequestDuration.WithLabelValues(version, c.Request.Method, route, merchant).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+func TestRequestMetricsLabelledByMerchant(t *testing.T) {
+	// Merchant labels stay on for the rest of the package's tests, which
+	// read no labelled metrics
+	metrics.EnableMerchantLabels(10)
+	r := merchantRouter(t)
+
+	tests := []struct {
+		key      string
+		merchant string
+	}{
+		{"acme-key", "acme"},
+		{"globex-key", "globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.merchant, func(t *testing.T) {
+			requests := metrics.Requests.WithLabelValues("v1", http.MethodPost, "/api/v1/verify/batch", strconv.Itoa(http.StatusOK), tt.merchant)
+			unlabelled := metrics.Requests.WithLabelValues("v1", http.MethodPost, "/api/v1/verify/batch", strconv.Itoa(http.StatusOK), "")
+			before, beforeUnlabelled := testutil.ToFloat64(requests), testutil.ToFloat64(unlabelled)
+
+			if w := serve(r, http.MethodPost, "/api/v1/verify/batch", tt.key, verifyBatchBody); w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := testutil.ToFloat64(requests) - before; got != 1 {
+				t.Fatalf("requests labelled %s rose by %v, want 1", tt.merchant, got)
+			}
+			if got := testutil.ToFloat64(unlabelled) - beforeUnlabelled; got != 0 {
+				t.Fatalf("unlabelled requests rose by %v, want 0", got)
+			}
+		})
+	}
+}
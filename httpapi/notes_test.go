@@ -0,0 +1,36 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNoteTooLong(t *testing.T) {
+	tests := []struct {
+		overflow string
+		want     int
+		code     string
+	}{
+		{"reject", http.StatusUnprocessableEntity, "note_too_long"},
+		{"truncate", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow, func(t *testing.T) {
+			t.Setenv("NOTE_VALUE_OVERFLOW", tt.overflow)
+			r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+			w := serve(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100,"notes":{"memo":"`+strings.Repeat("x", 300)+`"}}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.code != "" && (body["code"] != tt.code || !strings.Contains(body["details"].(string), "memo")) {
+				t.Fatalf("body = %v, want %s naming the note", body, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/service"
+)
+
+func TestNotificationChannelsListed(t *testing.T) {
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer dest.Close()
+	n := notify.New(notify.Options{}, &notify.Callback{URL: dest.URL}, &notify.Slack{WebhookURL: dest.URL})
+	defer n.Shutdown(context.Background())
+	r := NewRouter(newTestService(t, &fakeGateway{}, service.WithNotifier(n)), Options{AdminToken: testAdminToken})
+
+	if w := serve(r, http.MethodGet, "/api/v1/admin/notifications/channels", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: status = %d, want 401", w.Code)
+	}
+	w := serve(r, http.MethodGet, "/api/v1/admin/notifications/channels", testAdminToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var body struct {
+		Items []notify.ChannelHealth `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Items) != 2 || body.Items[0].Name != "callback" || body.Items[1].Name != "slack" || body.Items[0].QueueSize == 0 {
+		t.Fatalf("items = %+v, want callback and slack health", body.Items)
+	}
+}
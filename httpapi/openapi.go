@@ -0,0 +1,20 @@
+package httpapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec documents the error envelope every endpoint answers with,
+// including the code, action and classification enums. It is checked
+// against the error kinds by the tests, so a new kind must be added there.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI serves the OpenAPI spec
+func (h *handlers) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
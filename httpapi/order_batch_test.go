@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFetchOrderBatchEndpoint(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	orderID, _ := createOrder(t, r, 100)
+
+	w := serve(r, http.MethodPost, "/api/v1/orders/fetch-batch", testAdminToken, fmt.Sprintf(`{"ids":[%q,"order_missing"]}`, orderID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 with a miss in the batch: %s", w.Code, w.Body)
+	}
+	var got struct {
+		Orders map[string]struct {
+			Source string `json:"source"`
+			Code   string `json:"code"`
+		} `json:"orders"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Orders[orderID].Source != "store" || got.Orders["order_missing"].Code != "not_found" {
+		t.Fatalf("orders = %+v, want the stored order and the miss", got.Orders)
+	}
+
+	tests := []struct {
+		name   string
+		bearer string
+		body   string
+		want   int
+	}{
+		{"no token", "", `{"ids":["order_1"]}`, http.StatusUnauthorized},
+		{"no IDs", testAdminToken, `{"ids":[]}`, http.StatusBadRequest},
+		{"empty ID", testAdminToken, `{"ids":[""]}`, http.StatusBadRequest},
+		{"over the cap", testAdminToken, `{"ids":["` + strings.Repeat(`o","`, 100) + `o"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, http.MethodPost, "/api/v1/orders/fetch-batch", tt.bearer, tt.body); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
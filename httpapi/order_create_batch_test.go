@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCreateOrderBatchEndpoint(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	w := serve(r, http.MethodPost, "/api/v1/orders/batch", testAdminToken, `{"items":[
+		{"amount":500,"currency":"inr","receipt":"imp-1","notes":{"sku":"a"}},
+		{"amount":700,"receipt":"imp-2","notes":{"sku":"b"}},
+		{"amount":0,"receipt":"imp-3"},
+		{"amount":900,"receipt":"not a receipt"}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 despite the invalid items: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Results []struct {
+			Index   int    `json:"index"`
+			Receipt string `json:"receipt"`
+			Status  string `json:"status"`
+			Error   string `json:"error"`
+			Order   struct {
+				ID string `json:"id"`
+			} `json:"order"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"created", "created", "invalid", "invalid"}
+	if len(body.Results) != len(want) {
+		t.Fatalf("%d results, want %d: %s", len(body.Results), len(want), w.Body)
+	}
+	for i, res := range body.Results {
+		if res.Index != i || res.Status != want[i] || (want[i] == "invalid") != (res.Error != "") {
+			t.Fatalf("result %d = %+v, want %s", i, res, want[i])
+		}
+	}
+
+	for i, want := range []struct{ receipt, sku string }{{"imp-1", "a"}, {"imp-2", "b"}} {
+		w := serve(r, http.MethodGet, "/api/v1/admin/orders/"+body.Results[i].Order.ID, testAdminToken, "")
+		var order struct {
+			Receipt  string            `json:"receipt"`
+			Currency string            `json:"currency"`
+			Notes    map[string]string `json:"notes"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+			t.Fatal(err)
+		}
+		if order.Receipt != want.receipt || order.Notes["sku"] != want.sku || order.Currency != "INR" {
+			t.Fatalf("order %d stored as %s, want its own receipt and notes", i, w.Body)
+		}
+	}
+}
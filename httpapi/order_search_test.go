@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestSearchOrdersEndpoint(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	for _, body := range []string{`{"amount":100,"notes":{"user_id":"u_1"}}`, `{"amount":100,"notes":{"user_id":"u_2"}}`} {
+		if w := serve(r, http.MethodPost, "/api/v1/orders", "", body); w.Code != http.StatusOK {
+			t.Fatalf("create order: %d %s", w.Code, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		bearer string
+		query  string
+		want   int
+		found  int
+	}{
+		{"found", testAdminToken, "?note_key=user_id&note_value=u_1", http.StatusOK, 1},
+		{"none", testAdminToken, "?note_key=user_id&note_value=u_3", http.StatusOK, 0},
+		{"no value", testAdminToken, "?note_key=user_id", http.StatusBadRequest, 0},
+		{"count not a number", testAdminToken, "?note_key=user_id&note_value=u_1&count=ten", http.StatusBadRequest, 0},
+		{"unauthenticated", "", "?note_key=user_id&note_value=u_1", http.StatusUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/api/v1/orders/search"+tt.query, tt.bearer, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var page struct {
+				Items []struct {
+					ID    string            `json:"id"`
+					Notes map[string]string `json:"notes"`
+				} `json:"items"`
+				Pagination struct {
+					Returned int `json:"returned"`
+				} `json:"pagination"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != tt.found || page.Pagination.Returned != tt.found {
+				t.Fatalf("page = %s, want %d orders", w.Body, tt.found)
+			}
+			for _, o := range page.Items {
+				if o.Notes["user_id"] != "u_1" {
+					t.Fatalf("found %s with notes %v, want user_id u_1", o.ID, o.Notes)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderTagsEndpoints(t *testing.T) {
+	t.Setenv("TAG_VOCABULARY", "vip,chargeback-risk")
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	orderID, _ := createOrder(t, r, 100)
+	createOrder(t, r, 100)
+
+	steps := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+		tags   []string
+		code   string
+	}{
+		{"tagged", http.MethodPost, `{"tags":["vip","chargeback-risk"]}`, http.StatusOK, []string{"chargeback-risk", "vip"}, ""},
+		{"untagged", http.MethodDelete, `{"tags":["chargeback-risk"]}`, http.StatusOK, []string{"vip"}, ""},
+		{"typo", http.MethodPost, `{"tags":["vipp"]}`, http.StatusBadRequest, nil, "unknown_tag"},
+		{"no tags", http.MethodPost, `{"tags":[]}`, http.StatusBadRequest, nil, ""},
+	}
+	for _, st := range steps {
+		w := serve(r, st.method, "/api/v1/admin/orders/"+orderID+"/tags", testAdminToken, st.body)
+		if w.Code != st.want {
+			t.Fatalf("%s: status = %d, want %d: %s", st.name, w.Code, st.want, w.Body)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if st.code != "" && body["code"] != st.code {
+			t.Fatalf("%s: code = %v, want %s", st.name, body["code"], st.code)
+		}
+		if st.tags != nil {
+			raw, _ := json.Marshal(body["tags"])
+			want, _ := json.Marshal(st.tags)
+			if string(raw) != string(want) {
+				t.Fatalf("%s: tags = %s, want %s", st.name, raw, want)
+			}
+		}
+	}
+
+	w := serve(r, http.MethodGet, "/api/v1/orders/search?tag=vip", testAdminToken, "")
+	var page struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Items) != 1 || page.Items[0].ID != orderID {
+		t.Fatalf("search by tag: %d %s, want only %s", w.Code, w.Body, orderID)
+	}
+}
@@ -0,0 +1,93 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// statusToken pays a new order through r, returning its ID and the status
+// token the verification minted
+func statusToken(t *testing.T, r http.Handler) (string, string) {
+	t.Helper()
+	orderID, orderToken := createOrder(t, r, 100)
+	w := serve(r, http.MethodPost, "/api/v1/verify", "", verifyBody(orderID, "pay_1", orderToken))
+	var verified struct {
+		StatusToken string `json:"status_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &verified); err != nil || verified.StatusToken == "" {
+		t.Fatalf("verify: %d %s", w.Code, w.Body)
+	}
+	return orderID, verified.StatusToken
+}
+
+func TestPaymentStatusEndpoint(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	orderID, token := statusToken(t, r)
+
+	w := serveWith(r, http.MethodGet, "/api/v1/public/payment-status?order_id="+orderID+"&token="+token, "", "",
+		http.Header{"Origin": {"https://support.example.com"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["status"] != "paid" || got["amount"] != float64(100) || len(got) != 4 {
+		t.Fatalf("body = %v, want only the coarse status and amount", got)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Fatalf("Cache-Control = %q, want no-store", cc)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want any origin", origin)
+	}
+}
+
+func TestPaymentStatusNotFoundAlike(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	orderID, token := statusToken(t, r)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"no parameters", ""},
+		{"no token", "?order_id=" + orderID},
+		{"bad token", "?order_id=" + orderID + "&token=forged"},
+		{"unknown order", "?order_id=order_missing&token=" + token},
+	}
+	var first string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/api/v1/public/payment-status"+tt.query, "", "")
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want 404", w.Code)
+			}
+			// Only the request ID may differ
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			delete(body, "request_id")
+			raw, _ := json.Marshal(body)
+			if first == "" {
+				first = string(raw)
+			}
+			if string(raw) != first {
+				t.Fatalf("body = %s, want the same as every other 404: %s", raw, first)
+			}
+		})
+	}
+}
+
+func TestPaymentStatusRateLimited(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{PublicStatusRateLimit: 2})
+	for i, want := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+		w := serve(r, http.MethodGet, "/api/v1/public/payment-status?order_id=order_1&token=x", "", "")
+		if w.Code != want {
+			t.Fatalf("lookup %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
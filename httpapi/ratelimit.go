@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/service"
+)
+
+// rateLimiter allows each client, an IP or a merchant, limit requests per
+// fixed window
+type rateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, counts: make(map[string]int)}
+}
+
+// allow counts a request from ip, returning how long until the next window
+// when the limit is exceeded
+func (rl *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	return rl.allowLimit(ip, rl.limit, now)
+}
+
+// allowLimit is allow with a limit of the client's own
+func (rl *rateLimiter) allowLimit(client string, limit int, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Starting a new window drops every counter, keeping the map bounded
+	if now.Sub(rl.windowStart) >= rl.window {
+		rl.windowStart = now.Truncate(rl.window)
+		rl.counts = make(map[string]int)
+	}
+	rl.counts[client]++
+	if rl.counts[client] > limit {
+		return false, rl.windowStart.Add(rl.window).Sub(now)
+	}
+	return true, 0
+}
+
+// withRateLimit answers 429 with Retry-After once a client IP exceeds
+// limit requests per minute; zero disables it
+func withRateLimit(limit int) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	rl := newRateLimiter(limit, time.Minute)
+	return func(c *gin.Context) {
+		ok, retry := rl.allow(c.ClientIP(), time.Now())
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			respond(c, kindRateLimited, gin.H{
+				"error": "Too many requests",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// withCallerRateLimit is withRateLimit counting per authenticated caller
+// rather than per IP, for routes behind adminAuth
+func withCallerRateLimit(limit int) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	rl := newRateLimiter(limit, time.Minute)
+	return func(c *gin.Context) {
+		id, ok := principal(c)
+		if !ok {
+			return
+		}
+		ok, retry := rl.allow(id.String(), time.Now())
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			respond(c, kindRateLimited, gin.H{
+				"error": "Too many requests",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// withMerchantRateLimit answers 429 with Retry-After once a merchant
+// exceeds its requests per minute: the limit set on the tenant, or
+// opts.MerchantRateLimit. Only requests bearing an API key of the merchant
+// are counted, as anyone can send X-Tenant-ID; a zero default disables it.
+// It runs independently of the per-IP limits.
+func withMerchantRateLimit(svc *service.Service, opts Options) gin.HandlerFunc {
+	def := opts.MerchantRateLimit
+	if def <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	rl := opts.merchants
+	if rl == nil {
+		rl = newRateLimiter(def, time.Minute)
+	}
+	return func(c *gin.Context) {
+		merchant, ok := opts.APIKeys.merchant(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		limit := def
+		if own := svc.MerchantRateLimit(c.Request.Context(), merchant); own > 0 {
+			limit = own
+		}
+		ok, retry := rl.allowLimit(merchant, limit, opts.now())
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			respond(c, kindRateLimited, gin.H{
+				"error": "Too many requests for this merchant",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// merchantRouter serves two merchants: acme limited to 2 requests a
+// minute, globex to the default of 3. Each has an API key able to verify
+// batches.
+func merchantRouter(t *testing.T) http.Handler {
+	t.Helper()
+	tenants, err := service.LoadTenants(writeJSON(t, "tenants.json", []service.Tenant{
+		{ID: "acme", KeyID: "rzp_test_acme", KeySecret: "acme_secret", RateLimit: 2},
+		{ID: "globex", KeyID: "rzp_test_globex", KeySecret: "globex_secret"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := func(service.Tenant) (gateway.Gateway, error) { return &fakeGateway{}, nil }
+	keys := loadTestKeys(t, map[string]APIKey{
+		"acme-key":   {Scopes: []string{ScopeOrdersVerify}, Merchant: "acme"},
+		"globex-key": {Scopes: []string{ScopeOrdersVerify}, Merchant: "globex"},
+	})
+	svc := newTestService(t, &fakeGateway{}, service.WithTenants(tenants, factory))
+	return NewRouter(svc, Options{AdminToken: testAdminToken, APIKeys: keys, MerchantRateLimit: 3})
+}
+
+// verifyBatchBody is a batch failing its order token, so nothing reaches
+// Razorpay
+var verifyBatchBody = `{"items":[{"order_id":"order_1","razorpay_payment_id":"pay_1","razorpay_signature":"` + strings.Repeat("0", 64) + `","order_token":"x.y"}]}`
+
+func TestMerchantRateLimitPerMerchant(t *testing.T) {
+	r := merchantRouter(t)
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		{"acme-key", []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{"globex-key", []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+	}
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			w := serve(r, http.MethodPost, "/api/v1/verify/batch", tt.key, verifyBatchBody)
+			if w.Code != want {
+				t.Fatalf("request %d with %s: status = %d, want %d: %s", i+1, tt.key, w.Code, want, w.Body)
+			}
+			if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Fatalf("429 without Retry-After")
+			}
+		}
+	}
+}
+
+func TestMerchantRateLimitIgnoresTenantHeader(t *testing.T) {
+	r := merchantRouter(t)
+	tests := []struct {
+		name   string
+		bearer string
+		tenant string
+		want   int
+	}{
+		{name: "key for another merchant", bearer: "acme-key", tenant: "globex", want: http.StatusForbidden},
+		{name: "key for its own merchant", bearer: "acme-key", tenant: "acme", want: http.StatusOK},
+		{name: "unknown merchant", bearer: testAdminToken, tenant: "initech", want: http.StatusBadRequest},
+		{name: "admin for a merchant", bearer: testAdminToken, tenant: "acme", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWith(r, http.MethodPost, "/api/v1/verify/batch", tt.bearer, verifyBatchBody, http.Header{TenantHeader: {tt.tenant}})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// Naming acme in the header spends none of acme's requests: its key
+	// has made one of its two
+	for i := 0; i < 5; i++ {
+		serveWith(r, http.MethodPost, "/api/v1/verify/batch", testAdminToken, verifyBatchBody, http.Header{TenantHeader: {"acme"}})
+	}
+	if w := serve(r, http.MethodPost, "/api/v1/verify/batch", "acme-key", verifyBatchBody); w.Code != http.StatusOK {
+		t.Fatalf("acme limited by requests naming it: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOrderByReceipt(t *testing.T) {
+	gw := &fakeGateway{}
+	r := NewRouter(newTestService(t, gw), Options{AdminToken: testAdminToken})
+	const path = "/api/v1/orders/by-receipt/INV-2026-001"
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"created", `{"amount":5000}`, http.StatusCreated},
+		{"returned", `{"amount":5000}`, http.StatusOK},
+		{"amount mismatch", `{"amount":7000}`, http.StatusConflict},
+	}
+	var id string
+	for _, tt := range tests {
+		w := serve(r, http.MethodPut, path, testAdminToken, tt.body)
+		if w.Code != tt.want {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		switch tt.want {
+		case http.StatusCreated:
+			id = body["id"].(string)
+		case http.StatusOK:
+			if body["id"] != id || body["order_token"] == "" {
+				t.Fatalf("%s: order = %v, want %s with an order token", tt.name, body, id)
+			}
+		case http.StatusConflict:
+			if body["order_id"] != id || body["existing_amount"] != float64(5000) || body["requested_amount"] != float64(7000) {
+				t.Fatalf("%s: body = %v, want both amounts of %s", tt.name, body, id)
+			}
+		}
+	}
+	if gw.created != 1 {
+		t.Fatalf("%d orders created, want 1", gw.created)
+	}
+}
+
+func TestOrderByReceiptRefusesBadReceipts(t *testing.T) {
+	gw := &fakeGateway{}
+	r := NewRouter(newTestService(t, gw), Options{AdminToken: testAdminToken})
+	for _, receipt := range []string{strings.Repeat("a", 41), "inv%20001", "inv%3B001", "%E2%82%B9001"} {
+		if w := serve(r, http.MethodPut, "/api/v1/orders/by-receipt/"+receipt, testAdminToken, `{"amount":5000}`); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", receipt, w.Code)
+		}
+	}
+	if gw.created != 0 {
+		t.Fatalf("%d orders created for invalid receipts", gw.created)
+	}
+}
+
+func TestOrderByReceiptConcurrentPuts(t *testing.T) {
+	gw := &fakeGateway{}
+	r := NewRouter(newTestService(t, gw), Options{AdminToken: testAdminToken})
+
+	codes := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(r, http.MethodPut, "/api/v1/orders/by-receipt/INV-7", testAdminToken, `{"amount":5000}`).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusOK:
+		default:
+			t.Fatalf("PUT %d: status = %d", i, code)
+		}
+	}
+	if created != 1 || gw.created != 1 {
+		t.Fatalf("%d PUTs answered 201 and %d orders created, want 1 of each", created, gw.created)
+	}
+}
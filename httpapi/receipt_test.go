@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReceiptEndpoint(t *testing.T) {
+	t.Setenv("RECEIPT_MERCHANT_NAME", "Acme Payments")
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	paid, token := statusToken(t, r)
+	unpaid, _ := createOrder(t, r, 100)
+
+	tests := []struct {
+		name        string
+		path        string
+		want        int
+		contentType string
+		contains    string
+		code        string
+	}{
+		{"html", "/api/v1/orders/" + paid + "/receipt?token=" + token, http.StatusOK, "text/html; charset=utf-8", "Acme Payments Receipt", ""},
+		{"pdf", "/api/v1/orders/" + paid + "/receipt?format=pdf&token=" + token, http.StatusOK, "application/pdf", "%PDF-1.4", ""},
+		{"unknown format", "/api/v1/orders/" + paid + "/receipt?format=docx&token=" + token, http.StatusBadRequest, "", "", "invalid_request"},
+		{"not paid", "/api/v1/orders/" + unpaid + "/receipt", http.StatusConflict, "", "", "order_not_paid"},
+		{"unknown order", "/api/v1/orders/order_missing/receipt", http.StatusNotFound, "", "", "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bearer := ""
+			if !strings.Contains(tt.path, "token=") {
+				bearer = testAdminToken
+			}
+			w := serve(r, http.MethodGet, tt.path, bearer, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.code != "" {
+				var body map[string]interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["code"] != tt.code {
+					t.Fatalf("body = %s, want code %s", w.Body, tt.code)
+				}
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Fatalf("Content-Type = %q, want %q", ct, tt.contentType)
+			}
+			if !bytes.Contains(w.Body.Bytes(), []byte(tt.contains)) || !bytes.Contains(w.Body.Bytes(), []byte("pay_1")) {
+				t.Fatalf("receipt lacks %q or the payment:\n%s", tt.contains, w.Body)
+			}
+		})
+	}
+
+	w := serve(r, http.MethodGet, "/api/v1/orders/"+paid+"/receipt?format=pdf&token="+token, "", "")
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="receipt-`+paid+`.pdf"` {
+		t.Fatalf("Content-Disposition = %q, want the PDF as an attachment", cd)
+	}
+}
@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// refundGateway refunds payments in memory and has no Route transfers
+type refundGateway struct {
+	*fakeGateway
+}
+
+func (g *refundGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": "rfnd_1", "payment_id": paymentID, "amount": amount, "status": "pending"}, nil
+}
+
+func (g *refundGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"items": []interface{}{}}, nil
+}
+
+func TestRefundApprovalEndpoints(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{
+		"alice-key": {ScopeRefundsCreate, "admin:*"},
+		"bob-key":   {ScopeRefundsCreate, "admin:*"},
+	})
+	r := NewRouter(newTestService(t, &refundGateway{fakeGateway: &fakeGateway{}}), Options{AdminToken: testAdminToken, APIKeys: keys})
+
+	w := serve(r, http.MethodPost, "/api/v1/admin/refunds", "alice-key", `{"payment_id":"pay_1","amount":100000}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refund below the threshold: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	w = serve(r, http.MethodPost, "/api/v1/admin/refunds", "alice-key", `{"payment_id":"pay_1","amount":600000}`)
+	var approval struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &approval); err != nil || w.Code != http.StatusAccepted || approval.Status != "pending_approval" {
+		t.Fatalf("refund above the threshold: %d %s, want 202 pending_approval", w.Code, w.Body)
+	}
+
+	steps := []struct {
+		name string
+		key  string
+		path string
+		want int
+	}{
+		{"listed", "bob-key", "/api/v1/admin/refunds/pending", http.StatusOK},
+		{"approved by the requester", "alice-key", "/api/v1/admin/refunds/" + approval.ID + "/approve", http.StatusForbidden},
+		{"rejected by the requester", "alice-key", "/api/v1/admin/refunds/" + approval.ID + "/reject", http.StatusForbidden},
+		{"approved by another admin", "bob-key", "/api/v1/admin/refunds/" + approval.ID + "/approve", http.StatusOK},
+		{"decided already", "bob-key", "/api/v1/admin/refunds/" + approval.ID + "/reject", http.StatusConflict},
+		{"unknown", "bob-key", "/api/v1/admin/refunds/rfa_missing/approve", http.StatusNotFound},
+	}
+	for _, st := range steps {
+		method := http.MethodPost
+		if st.name == "listed" {
+			method = http.MethodGet
+		}
+		if w := serve(r, method, st.path, st.key, ""); w.Code != st.want {
+			t.Fatalf("%s: status = %d, want %d: %s", st.name, w.Code, st.want, w.Body)
+		}
+	}
+}
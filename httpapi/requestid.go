@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// RequestIDHeader carries the correlation ID of a request in both directions
+// unless Options.RequestIDHeader names another header
+const RequestIDHeader = "X-Request-ID"
+
+// inboundRequestID bounds the IDs accepted from callers so they are safe to
+// log and echo back
+var inboundRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID adopts the caller's ID from header or generates one, records
+// it in the request context and echoes it on the response in the same
+// header. It is a no-op when an outer router already assigned an ID.
+func withRequestID(header string) gin.HandlerFunc {
+	header = requestIDHeader(header)
+	return func(c *gin.Context) {
+		if _, ok := authctx.RequestID(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+
+		id := c.GetHeader(header)
+		if !inboundRequestID.MatchString(id) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				panic(err)
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		c.Request = c.Request.WithContext(authctx.WithRequestID(c.Request.Context(), id))
+		c.Header(header, id)
+		c.Next()
+	}
+}
+
+// withForwardedHeaders records the allow-listed request headers for
+// notification events. The request ID header is taken from the assigned ID
+// so that generated IDs are forwarded too.
+func withForwardedHeaders(names []string, idHeader string) gin.HandlerFunc {
+	idHeader = http.CanonicalHeaderKey(requestIDHeader(idHeader))
+	canonical := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			canonical = append(canonical, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	return func(c *gin.Context) {
+		headers := make(map[string]string)
+		for _, name := range canonical {
+			v := c.GetHeader(name)
+			if name == idHeader {
+				v = requestID(c)
+			}
+			if v != "" {
+				headers[name] = v
+			}
+		}
+		if len(headers) > 0 {
+			c.Request = c.Request.WithContext(notify.WithHeaders(c.Request.Context(), headers))
+		}
+		c.Next()
+	}
+}
+
+// requestIDHeader returns the configured request ID header, RequestIDHeader
+// when none is
+func requestIDHeader(header string) string {
+	if header == "" {
+		return RequestIDHeader
+	}
+	return header
+}
+
+// accessLog is gin's request log line with the request ID appended, so log
+// lines can be matched with the ID callers see in the response header
+func accessLog(param gin.LogFormatterParams) string {
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	id, _ := authctx.RequestID(param.Request.Context())
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v request_id=%s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		id,
+		param.ErrorMessage,
+	)
+}
+
+// requestID returns the correlation ID assigned by withRequestID
+func requestID(c *gin.Context) string {
+	id, _ := authctx.RequestID(c.Request.Context())
+	return id
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// recordingChannel passes every delivered event to events
+type recordingChannel struct {
+	events chan notify.Event
+}
+
+func (c *recordingChannel) Name() string { return "recording" }
+
+func (c *recordingChannel) Deliver(ctx context.Context, ev notify.Event) error {
+	c.events <- ev
+	return nil
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	sent := http.Header{
+		"X-Tenant-Id":   {"acme"},
+		"X-Request-Id":  {"req-123"},
+		"Authorization": {"Bearer secret"},
+		"Cookie":        {"session=secret"},
+	}
+	tests := []struct {
+		name      string
+		allowList []string
+		want      map[string]string
+	}{
+		{"none listed", nil, nil},
+		{"listed", []string{"X-Tenant-ID", "X-Request-ID"}, map[string]string{"X-Tenant-Id": "acme", "X-Request-Id": "req-123"}},
+		{"names canonicalized", []string{" x-tenant-id "}, map[string]string{"X-Tenant-Id": "acme"}},
+		{"listed but not sent", []string{"X-Tenant-ID", "X-Correlation-ID"}, map[string]string{"X-Tenant-Id": "acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]string
+			r := gin.New()
+			r.Use(withRequestID(""), withForwardedHeaders(tt.allowList, ""))
+			r.GET("/", func(c *gin.Context) { got = notify.Headers(c.Request.Context()) })
+			serveWith(r, http.MethodGet, "/", "", "", sent)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("headers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedRequestIDIsGenerated(t *testing.T) {
+	var got map[string]string
+	r := gin.New()
+	r.Use(withRequestID(""), withForwardedHeaders([]string{"X-Request-ID"}, ""))
+	r.GET("/", func(c *gin.Context) { got = notify.Headers(c.Request.Context()) })
+	w := serve(r, http.MethodGet, "/", "", "")
+	if id := w.Header().Get(RequestIDHeader); id == "" || got["X-Request-Id"] != id {
+		t.Fatalf("forwarded %v, want the generated request ID %q", got, id)
+	}
+}
+
+func TestPaymentVerifiedCarriesOnlyListedHeaders(t *testing.T) {
+	ch := &recordingChannel{events: make(chan notify.Event, 10)}
+	n := notify.New(notify.Options{}, ch)
+	defer n.Shutdown(context.Background())
+	r := NewRouter(newTestService(t, &fakeGateway{}, service.WithNotifier(n)), Options{ForwardHeaders: []string{"X-Tenant-ID", "X-Request-ID"}})
+
+	orderID, token := createOrder(t, r, 100)
+	w := serveWith(r, http.MethodPost, "/api/v1/verify", "", verifyBody(orderID, "pay_1", token), http.Header{
+		"X-Tenant-Id":  {"acme"},
+		"X-Request-Id": {"req-123"},
+		"Cookie":       {"session=secret"},
+		"X-Api-Key":    {"secret"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: status %d: %s", w.Code, w.Body)
+	}
+
+	want := map[string]string{"X-Tenant-Id": "acme", "X-Request-Id": "req-123"}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-ch.events:
+			if ev.Type != notify.EventPaymentVerified {
+				continue
+			}
+			if !reflect.DeepEqual(ev.Headers, want) {
+				t.Fatalf("event headers = %v, want %v", ev.Headers, want)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no payment.verified event delivered")
+		}
+	}
+}
+
+func TestCustomRequestIDHeader(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{RequestIDHeader: "X-Correlation-ID"})
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"adopted", http.Header{"X-Correlation-Id": {"corr-123"}}, "corr-123"},
+		{"generated", nil, ""},
+		{"default header ignored", http.Header{"X-Request-Id": {"req-123"}}, ""},
+		{"unsafe value replaced", http.Header{"X-Correlation-Id": {"bad id\n"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWith(r, http.MethodGet, "/api/v1/orders/order_missing", "", "", tt.header)
+			id := w.Header().Get("X-Correlation-ID")
+			if id == "" || tt.want != "" && id != tt.want || tt.want == "" && id == "req-123" {
+				t.Fatalf("X-Correlation-ID = %q, want %q or a generated ID", id, tt.want)
+			}
+			if got := w.Header().Get(RequestIDHeader); got != "" {
+				t.Fatalf("%s = %q, want only the configured header", RequestIDHeader, got)
+			}
+			var body struct {
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.RequestID != id {
+				t.Fatalf("error request_id = %q, want %q: %s", body.RequestID, id, w.Body)
+			}
+		})
+	}
+}
+
+func TestForwardedCustomRequestID(t *testing.T) {
+	var got map[string]string
+	r := gin.New()
+	r.Use(withRequestID("X-Correlation-ID"), withForwardedHeaders([]string{"x-correlation-id"}, "X-Correlation-ID"))
+	r.GET("/", func(c *gin.Context) { got = notify.Headers(c.Request.Context()) })
+	w := serve(r, http.MethodGet, "/", "", "")
+	if id := w.Header().Get("X-Correlation-ID"); id == "" || got["X-Correlation-Id"] != id {
+		t.Fatalf("forwarded %v, want the generated request ID %q", got, id)
+	}
+}
+
+func TestAccessLogCarriesRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/order_1", nil)
+	req = req.WithContext(authctx.WithRequestID(req.Context(), "corr-123"))
+	line := accessLog(gin.LogFormatterParams{Request: req, TimeStamp: time.Now(), StatusCode: 200, Method: http.MethodGet, Path: req.URL.Path})
+	if !strings.Contains(line, `"/api/v1/orders/order_1" request_id=corr-123`) {
+		t.Fatalf("log line = %q, want the request ID after the path", line)
+	}
+}
@@ -0,0 +1,309 @@
+// Package httpapi exposes the payment service over HTTP using Gin.
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// Options configures the router built by NewRouter
+type Options struct {
+	// AllowedOrigins are the web origins allowed on the browser-facing routes
+	AllowedOrigins []string
+	// AdminAllowedOrigins enables CORS on admin routes for these origins
+	// only; admin routes send no CORS headers when it is empty
+	AdminAllowedOrigins []string
+	CORSMaxAge          time.Duration
+	// AdminToken is the bearer token admin routes require
+	AdminToken string
+	// APIKeys are scoped credentials accepted alongside AdminToken; nil
+	// when none are configured
+	APIKeys *APIKeys
+	// ForwardHeaders lists the request headers copied onto notification
+	// events; no others are propagated
+	ForwardHeaders []string
+	// RequestTimeout bounds each API request; zero disables it
+	RequestTimeout time.Duration
+	// HealthCheckTimeout bounds each dependency check of /health/detailed
+	HealthCheckTimeout time.Duration
+	// CompressionLevel is the gzip level of compressed responses; zero
+	// disables compression
+	CompressionLevel int
+	// CompressionMinSize is the smallest response body compressed
+	CompressionMinSize int
+	// V1Deprecation and V1Sunset set the Deprecation and Sunset headers of
+	// v1 routes; zero leaves them out
+	V1Deprecation time.Time
+	V1Sunset      time.Time
+	// PublicStatusRateLimit caps public status lookups per client IP per
+	// minute; zero disables the limit
+	PublicStatusRateLimit int
+	// FunnelBeaconRateLimit caps checkout beacons per client IP per minute;
+	// zero disables the limit
+	FunnelBeaconRateLimit int
+	// VerifyBatchRateLimit caps batch verifications per caller per minute;
+	// zero disables the limit
+	VerifyBatchRateLimit int
+	// MerchantRateLimit caps each merchant's requests per minute unless its
+	// tenant sets its own limit; zero disables the limit
+	MerchantRateLimit int
+	// StrictJSON rejects unknown fields in the bodies of the payment
+	// endpoints; they are ignored otherwise
+	StrictJSON bool
+	// RequestIDHeader is the header request IDs are read from and echoed
+	// in; empty uses RequestIDHeader
+	RequestIDHeader string
+	// APIContentSecurityPolicy and HTMLContentSecurityPolicy are the
+	// Content-Security-Policy of the JSON routes and of the routes rendering
+	// HTML; empty uses DefaultAPIContentSecurityPolicy and
+	// DefaultHTMLContentSecurityPolicy
+	APIContentSecurityPolicy  string
+	HTMLContentSecurityPolicy string
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, sent on HTTPS
+	// requests only; zero disables it
+	HSTSMaxAge time.Duration
+	// TrustProxyHTTPS takes X-Forwarded-Proto: https as the request having
+	// come over HTTPS, for when TLS is terminated by a proxy in front
+	TrustProxyHTTPS bool
+	// Clock is the time API key rate limits are counted on; nil uses the
+	// system clock
+	Clock clock.Clock
+
+	// merchants is the merchant limiter v1 and v2 share when mounted by
+	// NewRouter
+	merchants *rateLimiter
+}
+
+func (o Options) now() time.Time {
+	if o.Clock == nil {
+		return time.Now()
+	}
+	return o.Clock.Now()
+}
+
+// NewRouter returns a standalone engine serving the API under /api/v1, its
+// typed successor under /api/v2, and the health, version, metrics and
+// OpenAPI spec endpoints at the root, with recovery and logging middleware.
+// CORS is applied per route group by Register.
+func NewRouter(svc *service.Service, opts Options) *gin.Engine {
+	r := gin.New()
+
+	// Middleware setup
+	r.Use(gin.Recovery())
+	r.Use(withRequestID(opts.RequestIDHeader))
+	r.Use(gin.LoggerWithFormatter(accessLog))
+	r.Use(withSecurityHeaders(apiSecurity(opts), opts))
+
+	opts.merchants = newRateLimiter(opts.MerchantRateLimit, time.Minute)
+	h := &handlers{svc: svc, opts: opts}
+	// Monitoring probes with HEAD as well as GET. Gin has no automatic HEAD
+	// handling, so other routes keep answering HEAD with 404.
+	getAndHead(r, "/healthz", h.Healthz)
+	getAndHead(r, "/version", h.Version)
+	getAndHead(r, "/openapi.json", h.OpenAPI)
+	getAndHead(r, "/metrics", gin.WrapH(metrics.Handler()))
+	health := r.Group("/health")
+	if policy := corsPolicy(opts.AdminAllowedOrigins, opts.CORSMaxAge); policy != nil {
+		health.Use(policy)
+		health.OPTIONS("/detailed", preflight)
+	}
+	getAndHead(health, "/detailed", adminAuth(opts), requireScope(opts.APIKeys, ScopeAdminRead), h.DetailedHealth)
+
+	Register(r.Group("/api/v1"), svc, opts)
+	RegisterV2(r.Group("/api/v2"), svc, opts)
+	return r
+}
+
+// RegisterV2 mounts the v2 routes on r like Register. v2 responses are
+// typed rather than passed through from Razorpay, and only the transport
+// differs from v1: both versions share the service.
+func RegisterV2(r gin.IRouter, svc *service.Service, opts Options) {
+	h := &handlers{svc: svc, opts: opts}
+	r = r.Group("", withRequestID(opts.RequestIDHeader), withSecurityHeaders(apiSecurity(opts), opts), withTenant(svc, opts.APIKeys), withMerchantRateLimit(svc, opts),
+		withMetrics("v2"), withForwardedHeaders(opts.ForwardHeaders, opts.RequestIDHeader), withCompression(opts.CompressionLevel, opts.CompressionMinSize), withTimeout(opts.RequestTimeout))
+
+	public := r.Group("")
+	if policy := corsPolicy(opts.AllowedOrigins, opts.CORSMaxAge); policy != nil {
+		public.Use(policy)
+	}
+	public.POST("/orders", keyScope(opts, ScopeOrdersCreate), h.CreateOrderV2)
+	public.GET("/orders/:id", keyScope(opts, ScopeOrdersRead), h.GetOrderV2)
+	public.OPTIONS("/orders", preflight)
+	public.OPTIONS("/orders/:id", preflight)
+}
+
+// getAndHead registers a read-only route for GET and HEAD. HEAD responses
+// carry the GET status and headers; net/http drops the body.
+func getAndHead(r gin.IRoutes, path string, handlers ...gin.HandlerFunc) {
+	r.GET(path, handlers...)
+	r.HEAD(path, handlers...)
+}
+
+// Register mounts the API routes on r, leaving the prefix and middleware
+// stack to the caller. This is how the service is embedded in another router.
+//
+// Only the browser-facing routes honor CORS. Webhooks and server-to-server
+// routes send no CORS headers; admin routes do so only for
+// opts.AdminAllowedOrigins. The public status route allows any origin.
+//
+// Responses are gzipped and carry the v1 deprecation headers, except on the
+// webhook receiver and the streaming routes.
+//
+// API keys are held to their scopes on admin and server-to-server routes,
+// which require a credential, and, when presented, on the browser-facing
+// order routes.
+//
+// Every response carries the security headers, with a Content-Security-Policy
+// permitting Razorpay Checkout on the routes rendering HTML.
+func Register(r gin.IRouter, svc *service.Service, opts Options) {
+	h := &handlers{svc: svc, opts: opts}
+	base := r.Group("", withRequestID(opts.RequestIDHeader), withSecurityHeaders(apiSecurity(opts), opts), withTenant(svc, opts.APIKeys), withMerchantRateLimit(svc, opts), withMetrics("v1"),
+		withForwardedHeaders(opts.ForwardHeaders, opts.RequestIDHeader))
+	hooks := base.Group("", withTimeout(opts.RequestTimeout))
+	r = base.Group("", withDeprecation(opts.V1Deprecation, opts.V1Sunset),
+		withCompression(opts.CompressionLevel, opts.CompressionMinSize), withTimeout(opts.RequestTimeout))
+
+	public := r.Group("")
+	if policy := corsPolicy(opts.AllowedOrigins, opts.CORSMaxAge); policy != nil {
+		public.Use(policy)
+	}
+	public.POST("/orders", keyScope(opts, ScopeOrdersCreate), h.CreateOrder)
+	public.GET("/orders/:id", keyScope(opts, ScopeOrdersRead), h.GetOrder)
+	public.POST("/verify", h.VerifyOrder)
+	public.GET("/config", h.GetConfig)
+	public.GET("/currencies", h.ListCurrencies)
+	public.POST("/checkout/sessions", h.CreateCheckoutSession)
+	public.GET("/checkout/sessions/:id", h.GetCheckoutSession)
+	public.POST("/orders/:id/events", withRateLimit(opts.FunnelBeaconRateLimit), h.RecordCheckoutEvent)
+	public.POST("/orders/:id/abandon", withRateLimit(opts.FunnelBeaconRateLimit), h.AbandonOrder)
+	for _, path := range []string{"/orders", "/orders/:id", "/orders/:id/events", "/orders/:id/abandon", "/verify", "/config", "/currencies", "/checkout/sessions", "/checkout/sessions/:id"} {
+		public.OPTIONS(path, preflight)
+	}
+
+	// The status widget is embedded on merchant pages anywhere and reveals
+	// nothing beyond what the token holder already knows
+	status := r.Group("/public", cors.New(cors.Config{
+		AllowAllOrigins: true,
+		AllowMethods:    []string{"GET"},
+		AllowHeaders:    []string{"Origin"},
+		MaxAge:          opts.CORSMaxAge,
+	}))
+	status.OPTIONS("/payment-status", preflight)
+	status.GET("/payment-status", withRateLimit(opts.PublicStatusRateLimit), h.PaymentStatus)
+
+	r.POST("/orders/batch", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersCreate), h.CreateOrderBatch)
+	r.PUT("/orders/by-receipt/:receipt", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersCreate), h.OrderByReceipt)
+	r.GET("/orders/:id/method", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersRead), h.GetOrderPaymentMethod)
+	r.GET("/orders/:id/payments", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersRead), h.ListOrderPayments)
+	r.GET("/orders/:id/receipt", withSecurityHeaders(htmlSecurity(opts), opts), statusTokenOrScope(svc, opts, ScopeOrdersRead), h.GetReceipt)
+	r.GET("/payments/:id", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersRead), h.GetPayment)
+	r.POST("/payment-links", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersCreate), h.CreatePaymentLink)
+	r.POST("/verify/batch", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersVerify),
+		withCallerRateLimit(opts.VerifyBatchRateLimit), h.VerifyOrderBatch)
+	r.GET("/razorpay/orders", adminAuth(opts), adminScope(opts.APIKeys), h.ListRazorpayOrders)
+	r.PATCH("/orders/:id/notes", adminAuth(opts), adminScope(opts.APIKeys), h.UpdateOrderNotes)
+	r.POST("/orders/fetch-batch", adminAuth(opts), requireScope(opts.APIKeys, ScopeOrdersRead), h.FetchOrderBatch)
+	r.GET("/orders/search", adminAuth(opts), adminScope(opts.APIKeys), h.SearchOrders)
+	r.POST("/transfers/:id/reversals", adminAuth(opts), adminScope(opts.APIKeys), h.ReverseTransfer)
+	r.GET("/transfers/:id/reversals", adminAuth(opts), adminScope(opts.APIKeys), h.ListTransferReversals)
+	hooks.POST("/webhooks/razorpay", h.HandleWebhook)
+	hooks.POST("/webhooks/razorpay/:account", h.HandleWebhook)
+	hooks.POST("/webhooks/sms-status", h.HandleSMSStatus)
+
+	adminCORS := corsPolicy(opts.AdminAllowedOrigins, opts.CORSMaxAge)
+	admin := r.Group("/admin")
+	if adminCORS != nil {
+		// Preflights carry no credentials, so they are answered before auth
+		admin.Use(adminCORS)
+		admin.OPTIONS("/*path", preflight)
+	}
+	// Refunds have their own scope, so partners can be allowed them without
+	// admin:write
+	refunds := r.Group("/admin")
+	if adminCORS != nil {
+		refunds.Use(adminCORS)
+	}
+	refunds.POST("/refunds", adminAuth(opts), requireScope(opts.APIKeys, ScopeRefundsCreate), h.CreateRefund)
+
+	admin.Use(adminAuth(opts), adminScope(opts.APIKeys))
+	admin.POST("/tenants/:id/smoke-test", h.RunSmokeTest)
+	admin.GET("/tenants/:id/smoke-test", h.GetSmokeTest)
+	admin.GET("/webhooks/dead-letters", h.ListDeadLetters)
+	admin.POST("/webhooks/provision", h.ProvisionWebhook)
+	admin.GET("/webhooks/provision", h.GetWebhookDrift)
+	admin.POST("/simulate-webhook", h.SimulateWebhook)
+	admin.GET("/notifications/channels", h.ListNotificationChannels)
+	admin.GET("/sms/messages", h.ListSMSMessages)
+	admin.GET("/sms/suppressions", h.ListSMSSuppressions)
+	admin.PUT("/sms/suppressions/:contact", h.SuppressSMS)
+	admin.DELETE("/sms/suppressions/:contact", h.UnsuppressSMS)
+	admin.GET("/flags", h.ListFeatureFlags)
+	admin.GET("/time", h.GetServerTime)
+	admin.GET("/runners", h.ListRunners)
+	admin.GET("/usage", h.GetAPIKeyUsage)
+	admin.GET("/analytics/funnel", h.GetFunnel)
+	admin.GET("/analytics/recovery", h.GetRecoveryReport)
+	admin.GET("/ledger", h.GetLedger)
+	admin.GET("/ledger/trial-balance", h.GetTrialBalance)
+	admin.POST("/ledger/:id/corrections", h.CorrectLedgerTransaction)
+	admin.GET("/credits/:customer", h.GetCredit)
+	admin.POST("/credits/:customer/grant", h.GrantCredit)
+	admin.POST("/credits/:customer/deduct", h.DeductCredit)
+	admin.POST("/checkout/methods/refresh", h.RefreshCheckoutMethods)
+	admin.GET("/orders/:id", h.GetLocalOrder)
+	admin.POST("/orders/:id/notes", h.AddOperatorNote)
+	admin.POST("/orders/:id/override-status", h.OverrideStatus)
+	admin.POST("/orders/:id/renotify", h.Renotify)
+	admin.POST("/orders/:id/tags", h.TagOrder)
+	admin.DELETE("/orders/:id/tags", h.UntagOrder)
+	admin.POST("/payments/:id/capture", h.CapturePayment)
+	admin.GET("/refunds/pending", h.ListPendingRefunds)
+	admin.POST("/refunds/:id/approve", h.ApproveRefund)
+	admin.POST("/refunds/:id/reject", h.RejectRefund)
+	admin.GET("/schedules", h.ListScheduledActions)
+	admin.GET("/schedules/:id", h.GetScheduledAction)
+	admin.POST("/schedules/:id/cancel", h.CancelScheduledAction)
+	admin.GET("/fulfillments", h.ListFulfillments)
+	admin.POST("/fulfillments/:id/replay", h.ReplayFulfillment)
+	admin.GET("/captures/reviews", h.ListCaptureReviews)
+	admin.POST("/captures/reviews/:id/approve", h.ApproveCapture)
+	admin.POST("/captures/reviews/:id/reject", h.RejectCapture)
+
+	// Streaming responses are not buffered or bounded by RequestTimeout
+	stream := base.Group("/admin")
+	if adminCORS != nil {
+		stream.Use(adminCORS)
+	}
+	stream.Use(adminAuth(opts), adminScope(opts.APIKeys))
+	stream.GET("/razorpay/:entity", h.ListUpstream)
+	stream.GET("/events/stream", h.StreamEvents)
+}
+
+// corsPolicy returns the CORS middleware for origins, or nil when origins is
+// empty and the routes should send no CORS headers
+func corsPolicy(origins []string, maxAge time.Duration) gin.HandlerFunc {
+	if len(origins) == 0 {
+		return nil
+	}
+	return cors.New(cors.Config{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+		MaxAge:           maxAge,
+	})
+}
+
+// preflight gives OPTIONS requests a route so the group's CORS middleware
+// runs; the middleware answers CORS preflights before reaching it
+func preflight(c *gin.Context) {
+	c.AbortWithStatus(http.StatusNoContent)
+}
@@ -0,0 +1,449 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/service"
+)
+
+const testAdminToken = "test-admin-token"
+
+// fakeGateway creates orders in memory; other calls panic through the nil
+// embedded Gateway, except those a test stubs
+type fakeGateway struct {
+	gateway.Gateway
+
+	mu      sync.Mutex
+	created int
+	// orders are the orders created, by ID
+	orders map[string]map[string]interface{}
+	// pingErr fails Ping when set
+	pingErr error
+}
+
+func (g *fakeGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.created++
+	order := map[string]interface{}{
+		"id":       fmt.Sprintf("order_%d", g.created),
+		"amount":   data["amount"],
+		"currency": data["currency"],
+		"receipt":  data["receipt"],
+		"status":   "created",
+	}
+	if g.orders == nil {
+		g.orders = make(map[string]map[string]interface{})
+	}
+	g.orders[order["id"].(string)] = order
+	return copyOrder(order), nil
+}
+
+func (g *fakeGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	order, ok := g.orders[id]
+	if !ok {
+		return nil, &gateway.RequestError{Message: "order not found"}
+	}
+	return copyOrder(order), nil
+}
+
+// ListAll lists nothing, as Razorpay's filters do for orders created
+// moments ago
+func (g *fakeGateway) ListAll(ctx context.Context, entity string, params map[string]interface{}, opts gateway.ListOptions, fn func(item map[string]interface{}) error) error {
+	return nil
+}
+
+func copyOrder(order map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(order))
+	for k, v := range order {
+		c[k] = v
+	}
+	return c
+}
+
+func (g *fakeGateway) FetchOrderPayments(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"count": float64(0), "items": []interface{}{}}, nil
+}
+
+func (g *fakeGateway) FetchPayment(ctx context.Context, id string) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": id, "order_id": "order_1", "amount": float64(100), "currency": "INR", "status": "captured"}, nil
+}
+
+func (g *fakeGateway) Ping(ctx context.Context) error {
+	return g.pingErr
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestService returns a service over gw with the default configuration
+func newTestService(t *testing.T, gw gateway.Gateway, opts ...service.Option) *service.Service {
+	t.Helper()
+	t.Setenv("RAZORPAY_API_KEY", "rzp_test_key")
+	t.Setenv("RAZORPAY_SECRET_KEY", "test_secret")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	svc, err := service.New(gw, service.NewMemoryStore(), cfg, opts...)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		svc.Shutdown(ctx)
+	})
+	return svc
+}
+
+// testAPIKeys loads API keys from keys, mapping each raw key to its
+// scopes
+func testAPIKeys(t *testing.T, keys map[string][]string) *APIKeys {
+	t.Helper()
+	full := make(map[string]APIKey, len(keys))
+	for raw, scopes := range keys {
+		full[raw] = APIKey{Scopes: scopes}
+	}
+	return loadTestKeys(t, full)
+}
+
+// loadTestKeys loads API keys from keys, mapping each raw key to its
+// settings; the label and hash are filled in from the raw key
+func loadTestKeys(t *testing.T, keys map[string]APIKey) *APIKeys {
+	t.Helper()
+	var list []APIKey
+	for raw, key := range keys {
+		sum := sha256.Sum256([]byte(raw))
+		key.Label, key.SHA256 = raw, hex.EncodeToString(sum[:])
+		list = append(list, key)
+	}
+	path := writeJSON(t, "keys.json", list)
+	loaded, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("load API keys: %v", err)
+	}
+	return loaded
+}
+
+// writeJSON writes v to a file named name in a temporary directory,
+// returning its path
+func writeJSON(t *testing.T, name string, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serve sends a request to r, with bearer as the Authorization when set
+func serve(r http.Handler, method, path, bearer, body string) *httptest.ResponseRecorder {
+	return serveWith(r, method, path, bearer, body, nil)
+}
+
+// serveWith is serve with extra request headers
+func serveWith(r http.Handler, method, path, bearer, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestVerifyBatchRequiresVerifyScope(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{
+		"pos-key":     {ScopeOrdersVerify},
+		"orders-key":  {"orders:*"},
+		"reader-key":  {ScopeOrdersRead},
+		"creator-key": {ScopeOrdersCreate},
+	})
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken, APIKeys: keys})
+	// Well formed but failing the order token, so nothing reaches Razorpay
+	body := `{"items":[{"order_id":"order_1","razorpay_payment_id":"pay_1","razorpay_signature":"` + strings.Repeat("0", 64) + `","order_token":"x.y"}]}`
+
+	tests := []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"unknown key", "nope", http.StatusUnauthorized},
+		{"read scope", "reader-key", http.StatusForbidden},
+		{"create scope", "creator-key", http.StatusForbidden},
+		{"verify scope", "pos-key", http.StatusOK},
+		{"orders wildcard", "orders-key", http.StatusOK},
+		{"admin token", testAdminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/v1/verify/batch", tt.bearer, body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestVerifyBatchRateLimitedPerCaller(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{"pos-a": {ScopeOrdersVerify}, "pos-b": {ScopeOrdersVerify}})
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{APIKeys: keys, VerifyBatchRateLimit: 2})
+	body := `{"items":[{"order_id":"order_1","razorpay_payment_id":"pay_1","razorpay_signature":"` + strings.Repeat("0", 64) + `","order_token":"x.y"}]}`
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if w := serve(r, http.MethodPost, "/api/v1/verify/batch", "pos-a", body); w.Code != want {
+			t.Fatalf("request %d of pos-a: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+	if w := serve(r, http.MethodPost, "/api/v1/verify/batch", "pos-b", body); w.Code != http.StatusOK {
+		t.Fatalf("pos-b limited by pos-a's requests: status = %d", w.Code)
+	}
+}
+
+func TestVerifyBatchRejectsOversizedBatch(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	item := `{"order_id":"order_1","razorpay_payment_id":"pay_1","razorpay_signature":"s","order_token":"x.y"}`
+	body := `{"items":[` + strings.TrimSuffix(strings.Repeat(item+",", service.MaxVerifyBatch+1), ",") + `]}`
+	if w := serve(r, http.MethodPost, "/api/v1/verify/batch", testAdminToken, body); w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestServerRoutesRequireKey(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{
+		"reader-key":  {ScopeOrdersRead},
+		"creator-key": {ScopeOrdersCreate},
+	})
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken, APIKeys: keys})
+
+	tests := []struct {
+		method, path string
+		// scoped is a key holding the route's scope, other one that does not
+		scoped, other string
+	}{
+		{http.MethodPost, "/api/v1/payment-links", "creator-key", "reader-key"},
+		{http.MethodPost, "/api/v1/orders/batch", "creator-key", "reader-key"},
+		{http.MethodPut, "/api/v1/orders/by-receipt/imp-1", "creator-key", "reader-key"},
+		{http.MethodGet, "/api/v1/orders/order_1/method", "reader-key", "creator-key"},
+		{http.MethodGet, "/api/v1/orders/order_1/payments", "reader-key", "creator-key"},
+		{http.MethodGet, "/api/v1/payments/pay_1", "reader-key", "creator-key"},
+		{http.MethodGet, "/api/v1/orders/order_1/receipt", "reader-key", "creator-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if w := serve(r, tt.method, tt.path, "", `{}`); w.Code != http.StatusUnauthorized {
+				t.Fatalf("anonymous: status = %d, want 401", w.Code)
+			}
+			if w := serve(r, tt.method, tt.path, "nope", `{}`); w.Code != http.StatusUnauthorized {
+				t.Fatalf("unknown key: status = %d, want 401", w.Code)
+			}
+			if w := serve(r, tt.method, tt.path, tt.other, `{}`); w.Code != http.StatusForbidden {
+				t.Fatalf("key without the scope: status = %d, want 403", w.Code)
+			}
+			// The request is empty, so getting past auth ends at validation
+			if w := serve(r, tt.method, tt.path, tt.scoped, `{}`); w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+				t.Fatalf("key with the scope: status = %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestReceiptAdmitsStatusTokenHolder(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	// The fake gateway reports pay_1 as 100 paid on order_1
+	w := serve(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100}`)
+	var order struct {
+		ID         string `json:"id"`
+		OrderToken string `json:"order_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil || order.ID != "order_1" {
+		t.Fatalf("create order: %d %s", w.Code, w.Body)
+	}
+	mac := hmac.New(sha256.New, []byte("test_secret"))
+	mac.Write([]byte(order.ID + "|pay_1"))
+	body, _ := json.Marshal(map[string]string{
+		"order_id":            order.ID,
+		"razorpay_payment_id": "pay_1",
+		"razorpay_signature":  hex.EncodeToString(mac.Sum(nil)),
+		"order_token":         order.OrderToken,
+	})
+	w = serve(r, http.MethodPost, "/api/v1/verify", "", string(body))
+	var verified struct {
+		StatusToken string `json:"status_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &verified); err != nil || verified.StatusToken == "" {
+		t.Fatalf("verify: %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"status token", "/api/v1/orders/order_1/receipt?token=" + verified.StatusToken, http.StatusOK},
+		{"no token", "/api/v1/orders/order_1/receipt", http.StatusUnauthorized},
+		{"forged token", "/api/v1/orders/order_1/receipt?token=" + order.OrderToken, http.StatusUnauthorized},
+		{"token of another order", "/api/v1/orders/order_2/receipt?token=" + verified.StatusToken, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, http.MethodGet, tt.path, "", ""); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// limitedGateway is Razorpay rate limiting every order it is asked for
+type limitedGateway struct {
+	fakeGateway
+	retryAfter time.Duration
+}
+
+func (g *limitedGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return nil, &gateway.RateLimitError{RetryAfter: g.retryAfter}
+}
+
+func TestUpstreamRateLimitAnswered429(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{7 * time.Second, "7"},
+		{1500 * time.Millisecond, "2"},
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.retryAfter.String(), func(t *testing.T) {
+			r := NewRouter(newTestService(t, &limitedGateway{retryAfter: tt.retryAfter}), Options{})
+			w := serve(r, http.MethodPost, "/api/v1/orders", "", `{"amount":100}`)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.want {
+				t.Fatalf("Retry-After = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenotifyEndpoint(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	paid, _ := statusToken(t, r)
+	unpaid, _ := createOrder(t, r, 100)
+
+	tests := []struct {
+		name  string
+		order string
+		want  int
+		code  string
+	}{
+		{"paid", paid, http.StatusOK, ""},
+		{"not paid", unpaid, http.StatusConflict, "order_not_paid"},
+		{"unknown", "order_missing", http.StatusNotFound, "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/v1/admin/orders/"+tt.order+"/renotify", testAdminToken, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var body struct {
+				OrderID string `json:"order_id"`
+				Code    string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code || (tt.want == http.StatusOK && body.OrderID != tt.order) {
+				t.Fatalf("body = %s, want %s renotified or refused as %q", w.Body, tt.order, tt.code)
+			}
+		})
+	}
+}
+
+func TestLedgerEndpoints(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	tests := []struct {
+		name string
+		path string
+		want int
+		body string
+	}{
+		{"ledger", "/api/v1/admin/ledger?account=razorpay_receivable", http.StatusOK, `"transactions":[]`},
+		{"unknown account", "/api/v1/admin/ledger?account=suspense", http.StatusBadRequest, "suspense"},
+		{"bad range", "/api/v1/admin/ledger?from=soon", http.StatusBadRequest, "Unix timestamp"},
+		{"trial balance", "/api/v1/admin/ledger/trial-balance", http.StatusOK, `"balanced":true`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.path, testAdminToken, "")
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.body) {
+				t.Fatalf("status = %d: %s, want %d with %s", w.Code, w.Body, tt.want, tt.body)
+			}
+		})
+	}
+}
+
+func TestCreditEndpoints(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+		// balance is the customer's balance after the step
+		balance int
+	}{
+		{"empty", http.MethodGet, "/api/v1/admin/credits/cust_1", "", http.StatusOK, 0},
+		{"grant", http.MethodPost, "/api/v1/admin/credits/cust_1/grant", `{"amount":5000,"reason":"late delivery"}`, http.StatusOK, 5000},
+		{"grant without reason", http.MethodPost, "/api/v1/admin/credits/cust_1/grant", `{"amount":5000}`, http.StatusBadRequest, 5000},
+		{"deduct", http.MethodPost, "/api/v1/admin/credits/cust_1/deduct", `{"amount":2000,"reason":"correction"}`, http.StatusOK, 3000},
+		{"deduct too much", http.MethodPost, "/api/v1/admin/credits/cust_1/deduct", `{"amount":9000,"reason":"correction"}`, http.StatusConflict, 3000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, tt.method, tt.path, testAdminToken, tt.body); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			w := serve(r, http.MethodGet, "/api/v1/admin/credits/cust_1", testAdminToken, "")
+			var balance service.CreditBalance
+			if err := json.Unmarshal(w.Body.Bytes(), &balance); err != nil || balance.Balance != tt.balance {
+				t.Fatalf("balance = %s, want %d", w.Body, tt.balance)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestScheduleEndpoints(t *testing.T) {
+	r := NewRouter(newTestService(t, &refundGateway{fakeGateway: &fakeGateway{}}), Options{AdminToken: testAdminToken})
+
+	w := serve(r, http.MethodPost, "/api/v1/admin/refunds", testAdminToken, `{"payment_id":"pay_1","amount":1000,"execute_at":"2099-01-01T00:00:00Z"}`)
+	var scheduled struct {
+		ID     string `json:"id"`
+		Kind   string `json:"kind"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &scheduled); err != nil || w.Code != http.StatusAccepted || scheduled.Kind != "refund" || scheduled.Status != "scheduled" {
+		t.Fatalf("schedule: %d %s, want 202 with the scheduled refund", w.Code, w.Body)
+	}
+	if w := serve(r, http.MethodPost, "/api/v1/admin/refunds", testAdminToken, `{"payment_id":"pay_1","amount":1000,"execute_at":"2000-01-01T00:00:00Z"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("schedule in the past: status = %d, want 400: %s", w.Code, w.Body)
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+		code   string
+	}{
+		{"listed", http.MethodGet, "/api/v1/admin/schedules?kind=refund&status=scheduled", http.StatusOK, ""},
+		{"read", http.MethodGet, "/api/v1/admin/schedules/" + scheduled.ID, http.StatusOK, ""},
+		{"canceled", http.MethodPost, "/api/v1/admin/schedules/" + scheduled.ID + "/cancel", http.StatusOK, ""},
+		{"canceled again", http.MethodPost, "/api/v1/admin/schedules/" + scheduled.ID + "/cancel", http.StatusConflict, "schedule_closed"},
+		{"unknown", http.MethodGet, "/api/v1/admin/schedules/sch_missing", http.StatusNotFound, "not_found"},
+	}
+	for _, st := range steps {
+		w := serve(r, st.method, st.path, testAdminToken, "")
+		if w.Code != st.want {
+			t.Fatalf("%s: status = %d, want %d: %s", st.name, w.Code, st.want, w.Body)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if st.code != "" && body["code"] != st.code {
+			t.Fatalf("%s: code = %v, want %s", st.name, body["code"], st.code)
+		}
+		if st.name == "listed" {
+			if items, _ := body["items"].([]interface{}); len(items) != 1 {
+				t.Fatalf("listed %v, want the scheduled refund", body)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAPIContentSecurityPolicy lets JSON responses load and be framed by
+// nothing, should a browser ever render one
+const DefaultAPIContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// DefaultHTMLContentSecurityPolicy is the policy of the pages the API
+// renders. It permits Razorpay Checkout: its script, the frames it opens
+// and the endpoints it calls. Inline styles are allowed for brand receipt
+// templates.
+const DefaultHTMLContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' https://checkout.razorpay.com; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: https:; " +
+	"frame-src https://api.razorpay.com https://checkout.razorpay.com; " +
+	"connect-src 'self' https://api.razorpay.com https://lumberjack.razorpay.com; " +
+	"base-uri 'self'; form-action 'self' https://api.razorpay.com; " +
+	"frame-ancestors 'none'"
+
+// securityPolicy is the set of security headers a route group sends
+type securityPolicy struct {
+	csp      string
+	referrer string
+}
+
+// apiSecurity is the policy of the JSON routes. Referrers are not sent, as
+// API URLs carry order IDs and status tokens.
+func apiSecurity(opts Options) securityPolicy {
+	csp := opts.APIContentSecurityPolicy
+	if csp == "" {
+		csp = DefaultAPIContentSecurityPolicy
+	}
+	return securityPolicy{csp: csp, referrer: "no-referrer"}
+}
+
+// htmlSecurity is the policy of the routes rendering HTML pages
+func htmlSecurity(opts Options) securityPolicy {
+	csp := opts.HTMLContentSecurityPolicy
+	if csp == "" {
+		csp = DefaultHTMLContentSecurityPolicy
+	}
+	return securityPolicy{csp: csp, referrer: "strict-origin-when-cross-origin"}
+}
+
+// withSecurityHeaders sets the headers of policy on every response.
+// Strict-Transport-Security is only sent over HTTPS, as browsers ignore it
+// otherwise: when the connection is TLS or, with opts.TrustProxyHTTPS, a
+// proxy in front says it terminated HTTPS. A group nested under another
+// overrides the outer group's headers.
+func withSecurityHeaders(policy securityPolicy, opts Options) gin.HandlerFunc {
+	var hsts string
+	if opts.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int64(opts.HSTSMaxAge.Seconds()))
+	}
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", policy.referrer)
+		h.Set("Content-Security-Policy", policy.csp)
+		if hsts != "" && isHTTPS(c.Request, opts.TrustProxyHTTPS) {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		c.Next()
+	}
+}
+
+// isHTTPS reports whether r reached the client over HTTPS. X-Forwarded-Proto
+// is only believed from a trusted proxy, since clients can set it; its
+// first value is the one the client-facing proxy added.
+func isHTTPS(r *http.Request, trustProxy bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !trustProxy {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
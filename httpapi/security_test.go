@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersPerGroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		method   string
+		path     string
+		csp      string
+		referrer string
+	}{
+		{"JSON route", Options{}, http.MethodPost, "/api/v1/orders", DefaultAPIContentSecurityPolicy, "no-referrer"},
+		{"JSON error", Options{}, http.MethodGet, "/api/v1/orders/order_missing", DefaultAPIContentSecurityPolicy, "no-referrer"},
+		{"v2 route", Options{}, http.MethodPost, "/api/v2/orders", DefaultAPIContentSecurityPolicy, "no-referrer"},
+		{"HTML route", Options{}, http.MethodGet, "/api/v1/orders/order_missing/receipt", DefaultHTMLContentSecurityPolicy, "strict-origin-when-cross-origin"},
+		{"JSON policy configured", Options{APIContentSecurityPolicy: "default-src 'none'"}, http.MethodPost, "/api/v1/orders", "default-src 'none'", "no-referrer"},
+		{"HTML policy configured", Options{HTMLContentSecurityPolicy: "default-src 'self'"}, http.MethodGet, "/api/v1/orders/order_missing/receipt", "default-src 'self'", "strict-origin-when-cross-origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.AdminToken = testAdminToken
+			r := NewRouter(newTestService(t, &fakeGateway{}), tt.opts)
+			w := serve(r, tt.method, tt.path, testAdminToken, `{"amount":100,"currency":"INR"}`)
+
+			want := map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "DENY",
+				"Referrer-Policy":         tt.referrer,
+				"Content-Security-Policy": tt.csp,
+			}
+			for header, value := range want {
+				if got := w.Header().Get(header); got != value {
+					t.Fatalf("%s = %q, want %q (status %d)", header, got, value, w.Code)
+				}
+			}
+		})
+	}
+
+	// Razorpay Checkout may run on the HTML pages
+	if !strings.Contains(DefaultHTMLContentSecurityPolicy, "script-src 'self' https://checkout.razorpay.com") {
+		t.Fatalf("HTML policy %q does not permit the checkout script", DefaultHTMLContentSecurityPolicy)
+	}
+}
+
+func TestHSTSOnlyOverHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		tls        bool
+		forwarded  string
+		trustProxy bool
+		maxAge     time.Duration
+		want       string
+	}{
+		{name: "plain", maxAge: time.Hour},
+		{name: "TLS", tls: true, maxAge: time.Hour, want: "max-age=3600"},
+		{name: "forwarded untrusted", forwarded: "https", maxAge: time.Hour},
+		{name: "forwarded trusted", forwarded: "https", trustProxy: true, maxAge: time.Hour, want: "max-age=3600"},
+		{name: "client-facing proxy first", forwarded: "HTTPS, http", trustProxy: true, maxAge: time.Hour, want: "max-age=3600"},
+		{name: "forwarded http", forwarded: "http", trustProxy: true, maxAge: time.Hour},
+		{name: "disabled", tls: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(newTestService(t, &fakeGateway{}), Options{HSTSMaxAge: tt.maxAge, TrustProxyHTTPS: tt.trustProxy})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(`{"amount":100}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwarded)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got := w.Header().Get("Strict-Transport-Security"); got != tt.want {
+				t.Fatalf("Strict-Transport-Security = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
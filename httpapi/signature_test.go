@@ -0,0 +1,53 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMalformedSignatures(t *testing.T) {
+	t.Setenv("RAZORPAY_WEBHOOK_SECRET", "whsec_test")
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	orderID, token := createOrder(t, r, 100)
+	signed := verifyBody(orderID, "pay_1", token)
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(signed), &fields); err != nil {
+		t.Fatal(err)
+	}
+	signature := fields["razorpay_signature"]
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		header http.Header
+		want   int
+		code   string
+	}{
+		{"payment truncated", "/api/v1/verify", strings.Replace(signed, signature, signature[:63], 1), nil, http.StatusBadRequest, "signature_malformed"},
+		{"payment padded", "/api/v1/verify", strings.Replace(signed, signature, " "+signature, 1), nil, http.StatusBadRequest, "signature_malformed"},
+		{"payment mismatched", "/api/v1/verify", strings.Replace(signed, signature, strings.Repeat("0", 64), 1), nil, http.StatusUnauthorized, "signature_mismatch"},
+		{"webhook not hex", "/api/v1/webhooks/razorpay", `{"event":"payment.authorized"}`, http.Header{"X-Razorpay-Signature": {strings.Repeat("z", 64)}}, http.StatusBadRequest, "webhook_signature_malformed"},
+		{"webhook mismatched", "/api/v1/webhooks/razorpay", `{"event":"payment.authorized"}`, http.Header{"X-Razorpay-Signature": {strings.Repeat("0", 64)}}, http.StatusUnauthorized, "webhook_signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWith(r, http.MethodPost, tt.path, "", tt.body, tt.header)
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.want || body["code"] != tt.code {
+				t.Fatalf("%d %v, want %d %s", w.Code, body["code"], tt.want, tt.code)
+			}
+		})
+	}
+
+	// A well-formed signature in upper case still verifies
+	upper := strings.Replace(signed, signature, strings.ToUpper(signature), 1)
+	if w := serve(r, http.MethodPost, "/api/v1/verify", "", upper); w.Code != http.StatusOK {
+		t.Fatalf("upper case: status = %d, want 200: %s", w.Code, w.Body)
+	}
+}
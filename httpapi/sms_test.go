@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/service"
+)
+
+func TestSMSEndpoints(t *testing.T) {
+	sms, err := notify.NewSMS(&notify.MSG91{StatusToken: "dlr_token"}, notify.SMSOptions{CountryCode: "91"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRouter(newTestService(t, &fakeGateway{}, service.WithSMS(sms)), Options{AdminToken: testAdminToken})
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		bearer string
+		body   string
+		want   int
+		code   string
+	}{
+		{"status unsigned", http.MethodPost, "/api/v1/webhooks/sms-status?token=forged", "", `[]`, http.StatusUnauthorized, "webhook_signature"},
+		{"status malformed", http.MethodPost, "/api/v1/webhooks/sms-status?token=dlr_token", "", `{"requestId":1}`, http.StatusBadRequest, "invalid_request"},
+		{"status of unknown messages", http.MethodPost, "/api/v1/webhooks/sms-status?token=dlr_token", "", `[{"requestId":"r1","numbers":[{"status":"1"}]}]`, http.StatusOK, ""},
+		{"suppress unauthenticated", http.MethodPut, "/api/v1/admin/sms/suppressions/9876543210", "", "", http.StatusUnauthorized, ""},
+		{"suppress", http.MethodPut, "/api/v1/admin/sms/suppressions/9876543210", testAdminToken, "", http.StatusNoContent, ""},
+		{"suppress invalid", http.MethodPut, "/api/v1/admin/sms/suppressions/nobody", testAdminToken, "", http.StatusBadRequest, "invalid_request"},
+		{"messages", http.MethodGet, "/api/v1/admin/sms/messages", testAdminToken, "", http.StatusOK, ""},
+	}
+	for _, st := range steps {
+		w := serve(r, st.method, st.path, st.bearer, st.body)
+		if w.Code != st.want {
+			t.Fatalf("%s: status = %d, want %d: %s", st.name, w.Code, st.want, w.Body)
+		}
+		if st.code != "" {
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["code"] != st.code {
+				t.Fatalf("%s: body = %s, want code %s", st.name, w.Body, st.code)
+			}
+		}
+	}
+
+	w := serve(r, http.MethodGet, "/api/v1/admin/sms/suppressions", testAdminToken, "")
+	var list struct {
+		Items []string `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Items) != 1 || list.Items[0] != "+919876543210" {
+		t.Fatalf("suppressions = %s, want the normalized number", w.Body)
+	}
+	if w := serve(r, http.MethodDelete, "/api/v1/admin/sms/suppressions/+919876543210", testAdminToken, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("unsuppress: status = %d, want 204", w.Code)
+	}
+	if got := sms.Suppressed(); len(got) != 0 {
+		t.Fatalf("suppressed = %v after opting back in, want none", got)
+	}
+}
+
+func TestSMSDisabled(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	for _, path := range []string{"/api/v1/webhooks/sms-status", "/api/v1/admin/sms/messages"} {
+		method := http.MethodGet
+		if path == "/api/v1/webhooks/sms-status" {
+			method = http.MethodPost
+		}
+		w := serve(r, method, path, testAdminToken, `[]`)
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusNotFound || body["code"] != "sms_disabled" {
+			t.Fatalf("%s: %d %s, want 404 sms_disabled", path, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/service"
+)
+
+// streamHeartbeat keeps idle SSE connections open through proxies
+const streamHeartbeat = 15 * time.Second
+
+// StreamEvents serves the admin event feed as server-sent events. Clients
+// filter with ?types=a,b and resume with Last-Event-ID. A client too slow
+// to keep up gets a final "close" event and should reconnect.
+func (h *handlers) StreamEvents(c *gin.Context) {
+	if _, ok := principal(c); !ok {
+		return
+	}
+
+	var lastID uint64
+	if v := c.GetHeader("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			respond(c, kindInvalidRequest, gin.H{
+				"error":   "Invalid request format",
+				"details": "Last-Event-ID must be an event ID",
+			})
+			return
+		}
+		lastID = id
+	}
+	var types []string
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	sub, backlog := h.svc.SubscribeEvents(lastID, types)
+	defer h.svc.UnsubscribeEvents(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, ev := range backlog {
+		if writeEvent(c, ev) != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					fmt.Fprint(c.Writer, "event: close\ndata: {\"reason\":\"slow_consumer\"}\n\n")
+					c.Writer.Flush()
+				}
+				return
+			}
+			if writeEvent(c, ev) != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes ev as one SSE message
+func writeEvent(c *gin.Context, ev service.StreamEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
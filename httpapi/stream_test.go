@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseMessage is one server-sent event
+type sseMessage struct {
+	id, event, data string
+}
+
+// sseClient reads messages from an open event stream
+type sseClient struct {
+	resp     *http.Response
+	messages chan sseMessage
+}
+
+// openStream connects to the admin event stream at url, resuming after
+// lastID when it is set
+func openStream(t *testing.T, url, lastID string) *sseClient {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	c := &sseClient{resp: resp, messages: make(chan sseMessage, 16)}
+	go func() {
+		defer close(c.messages)
+		var msg sseMessage
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if msg.event != "" {
+					c.messages <- msg
+				}
+				msg = sseMessage{}
+			case strings.HasPrefix(line, "id: "):
+				msg.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return c
+}
+
+// next returns the next message, failing the test after a second
+func (c *sseClient) next(t *testing.T) sseMessage {
+	t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return sseMessage{}
+}
+
+func (c *sseClient) close() {
+	c.resp.Body.Close()
+}
+
+func TestEventStreamResumes(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	server := httptest.NewServer(r)
+	defer server.Close()
+	stream := server.URL + "/api/v1/admin/events/stream?types=order.status_changed"
+
+	override := func(orderID, status string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"status":%q,"reason":"test","force":true}`, status)
+		if w := serve(r, http.MethodPost, "/api/v1/admin/orders/"+orderID+"/override-status", testAdminToken, body); w.Code != http.StatusOK {
+			t.Fatalf("override to %s: status %d: %s", status, w.Code, w.Body)
+		}
+	}
+	orderID, _ := createOrder(t, r, 100)
+
+	client := openStream(t, stream, "")
+	// The subscription is registered once the headers are sent
+	override(orderID, "failed")
+	first := client.next(t)
+	if first.event != "order.status_changed" || !strings.Contains(first.data, `"to":"failed"`) {
+		t.Fatalf("event = %+v, want the change to failed", first)
+	}
+	client.close()
+
+	// Missed while disconnected
+	override(orderID, "expired")
+	override(orderID, "paid")
+
+	client = openStream(t, stream, first.id)
+	defer client.close()
+	for _, want := range []string{"expired", "paid"} {
+		msg := client.next(t)
+		if !strings.Contains(msg.data, `"to":"`+want+`"`) {
+			t.Fatalf("replayed %+v, want the change to %s", msg, want)
+		}
+	}
+	override(orderID, "refunded")
+	if msg := client.next(t); !strings.Contains(msg.data, `"to":"refunded"`) {
+		t.Fatalf("live event = %+v, want the change to refunded", msg)
+	}
+}
+
+func TestEventStreamRequiresAdmin(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/events/stream", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if w := serveWith(r, http.MethodGet, "/api/v1/admin/events/stream", testAdminToken, "", http.Header{"Last-Event-ID": {"latest"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad Last-Event-ID: status = %d, want 400", w.Code)
+	}
+}
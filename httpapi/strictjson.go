@@ -0,0 +1,53 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// unknownFieldError is a request body naming a field the endpoint does not
+// take, reported in strict JSON mode
+type unknownFieldError struct {
+	Field string
+}
+
+func (e *unknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// strictJSON binds like binding.JSON but refuses fields the target struct
+// does not declare
+type strictJSON struct{}
+
+func (strictJSON) Name() string { return "json" }
+
+func (strictJSON) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("invalid request")
+	}
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		// encoding/json reports unknown fields only by message
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return &unknownFieldError{Field: strings.Trim(field, `"`)}
+		}
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// bindPaymentJSON binds the body of a payment endpoint, refusing unknown
+// fields when StrictJSON is set
+func (h *handlers) bindPaymentJSON(c *gin.Context, obj any) error {
+	if h.opts.StrictJSON {
+		return c.ShouldBindWith(obj, strictJSON{})
+	}
+	return c.ShouldBindJSON(obj)
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestStrictJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		path   string
+		body   string
+		want   int
+		field  string
+	}{
+		{"strict valid", true, "/api/v1/orders", `{"amount":100,"notes":{"anything":"goes"}}`, http.StatusOK, ""},
+		{"strict misspelled", true, "/api/v1/orders", `{"amout":100}`, http.StatusBadRequest, "amout"},
+		{"strict extra", true, "/api/v1/orders", `{"amount":100,"colour":"red"}`, http.StatusBadRequest, "colour"},
+		{"strict v2", true, "/api/v2/orders", `{"amount":100,"colour":"red"}`, http.StatusBadRequest, "colour"},
+		{"strict verify", true, "/api/v1/verify", `{"order_id":"order_1","razorpay_payment_id":"pay_1","razorpay_signature":"x","order_token":"t","sig":"x"}`, http.StatusBadRequest, "sig"},
+		{"lenient extra", false, "/api/v1/orders", `{"amount":100,"colour":"red"}`, http.StatusOK, ""},
+		{"lenient v2", false, "/api/v2/orders", `{"amount":100,"currency":"INR","colour":"red"}`, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(newTestService(t, &fakeGateway{}), Options{StrictJSON: tt.strict})
+			w := serve(r, http.MethodPost, tt.path, "", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.field == "" {
+				return
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["code"] != "unknown_field" || body["field"] != tt.field {
+				t.Fatalf("body = %v, want unknown_field naming %s", body, tt.field)
+			}
+		})
+	}
+}
+
+func TestStrictJSONStillValidates(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{StrictJSON: true})
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", `{"amount":`},
+		{"wrong type", `{"amount":"100"}`},
+		{"empty", ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/v1/orders", "", tt.body)
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusBadRequest || body["code"] == "unknown_field" {
+				t.Fatalf("status = %d %v, want 400 other than unknown_field", w.Code, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withTimeout bounds the rest of the handler chain to d. The handler runs
+// with a deadline on its request context and writes into a buffer; if the
+// deadline passes first, the client gets a 504 APIError immediately and
+// anything the handler writes afterwards is discarded. The middleware
+// still waits for the handler to return so the Gin context is never
+// recycled underneath it.
+func withTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		id := requestID(c)
+		w := c.Writer
+		tw := &timeoutWriter{ResponseWriter: w, header: make(http.Header)}
+		c.Writer = tw
+		defer func() { c.Writer = w }()
+
+		done := make(chan struct{})
+		var panicked interface{}
+		go func() {
+			defer close(done)
+			defer func() { panicked = recover() }()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+			if panicked != nil {
+				// Re-raise on the request goroutine so Recovery sees it
+				panic(panicked)
+			}
+			tw.flush()
+
+		case <-ctx.Done():
+			tw.expire()
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_ = json.NewEncoder(w).Encode(timeoutError(id))
+			w.Flush()
+
+			<-done
+			if panicked != nil {
+				log.Printf("handler panicked after timeout request_id=%s: %v", id, panicked)
+			}
+		}
+	}
+}
+
+// timeoutWriter buffers a handler's response until withTimeout decides
+// whether it is sent or discarded
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu      sync.Mutex
+	header  http.Header
+	buf     bytes.Buffer
+	code    int
+	wrote   bool
+	expired bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote && !w.expired {
+		w.code = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wrote = true
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wrote = true
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wrote
+}
+
+// Flush is a no-op; the response is only sent once the handler returns
+func (w *timeoutWriter) Flush() {}
+
+// expire discards the buffered response and refuses further writes
+func (w *timeoutWriter) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expired = true
+	w.buf.Reset()
+}
+
+// flush copies the buffered response to the underlying writer
+func (w *timeoutWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.wrote && w.code == 0 {
+		return
+	}
+
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+}
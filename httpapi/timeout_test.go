@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// slowRouter serves GET /slow through withTimeout(d), running handler
+func slowRouter(d time.Duration, handler gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(withRequestID(""), withTimeout(d))
+	r.GET("/slow", handler)
+	return r
+}
+
+// decodeTimeout checks w is a single 504 APIError and returns it
+func decodeTimeout(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	var body APIError
+	if err := dec.Decode(&body); err != nil {
+		t.Fatalf("decode %q: %v", w.Body, err)
+	}
+	if dec.More() {
+		t.Fatalf("body = %q, want one response", w.Body)
+	}
+	if body.Code != "timeout" || !body.Retryable || body.Error == "" {
+		t.Fatalf("body = %+v, want the timeout envelope", body)
+	}
+	if body.RequestID == "" || body.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Fatalf("request_id = %q, want the %s header %q", body.RequestID, RequestIDHeader, w.Header().Get(RequestIDHeader))
+	}
+	return body
+}
+
+func TestTimeoutLateResponseDiscarded(t *testing.T) {
+	finished := make(chan struct{})
+	r := slowRouter(20*time.Millisecond, func(c *gin.Context) {
+		defer close(finished)
+		<-c.Request.Context().Done()
+		// The handler answers after the deadline, as a slow one would
+		time.Sleep(10 * time.Millisecond)
+		c.Header("X-Late", "1")
+		c.JSON(http.StatusOK, gin.H{"late": true})
+	})
+
+	w := serve(r, http.MethodGet, "/slow", "", "")
+	<-finished
+	decodeTimeout(t, w)
+	if w.Header().Get("X-Late") != "" {
+		t.Fatalf("late handler header leaked into the response")
+	}
+}
+
+func TestTimeoutRaceWithHandler(t *testing.T) {
+	// Handlers answering right around the deadline get exactly one response,
+	// theirs or the 504
+	for i := 0; i < 50; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			r := slowRouter(5*time.Millisecond, func(c *gin.Context) {
+				time.Sleep(time.Duration(i%10) * time.Millisecond)
+				c.JSON(http.StatusOK, gin.H{"ok": true})
+			})
+			w := serve(r, http.MethodGet, "/slow", "", "")
+			if w.Code == http.StatusOK {
+				if w.Body.String() != `{"ok":true}` {
+					t.Fatalf("body = %q, want the handler's alone", w.Body)
+				}
+				return
+			}
+			decodeTimeout(t, w)
+		})
+	}
+}
+
+func TestTimeoutFastHandlerAnswers(t *testing.T) {
+	r := slowRouter(time.Second, func(c *gin.Context) {
+		c.Header("X-Handler", "1")
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+	w := serve(r, http.MethodGet, "/slow", "", "")
+	if w.Code != http.StatusCreated || w.Header().Get("X-Handler") != "1" || w.Body.String() != `{"ok":true}` {
+		t.Fatalf("response = %d %q, want the handler's", w.Code, w.Body)
+	}
+}
+
+func TestRazorpayTimeoutUsesEnvelope(t *testing.T) {
+	r := slowRouter(time.Second, func(c *gin.Context) {
+		writeError(c, fmt.Errorf("fetch order: %w", gateway.ErrTimeout), "Failed to fetch order")
+	})
+	decodeTimeout(t, serve(r, http.MethodGet, "/slow", "", ""))
+}
@@ -0,0 +1,138 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/canonicaljson"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// orderRequestV2 is the v2 order creation body. Unlike v1 the currency is
+// required, and the amount may be left for the items to add up to.
+type orderRequestV2 struct {
+	Amount         int                `json:"amount"`
+	Currency       string             `json:"currency" binding:"required"`
+	Items          []service.LineItem `json:"items"`
+	Notes          map[string]string  `json:"notes"`
+	FulfillmentURL string             `json:"fulfillment_url"`
+	DryRun         bool               `json:"dry_run"`
+}
+
+func (r orderRequestV2) paymentRequest() service.PaymentRequest {
+	amount := r.Amount
+	if amount == 0 {
+		for _, item := range r.Items {
+			amount += item.Quantity * item.UnitAmount
+		}
+	}
+	return service.PaymentRequest{
+		Amount:         amount,
+		Currency:       r.Currency,
+		Notes:          r.Notes,
+		LineItems:      r.Items,
+		FulfillmentURL: r.FulfillmentURL,
+		DryRun:         r.DryRun,
+	}
+}
+
+// orderResponseV2 is a created order in the v2 API: the typed order with
+// the tokens needed to verify its payment
+type orderResponseV2 struct {
+	service.OrderView
+	Items       []service.LineItem `json:"items,omitempty"`
+	OrderToken  string             `json:"order_token"`
+	ClientToken string             `json:"client_token,omitempty"`
+	DryRun      bool               `json:"dry_run,omitempty"`
+}
+
+func newOrderResponseV2(order map[string]interface{}) orderResponseV2 {
+	resp := orderResponseV2{OrderView: service.OrderViewOf(order)}
+	resp.Items, _ = order["line_items"].([]service.LineItem)
+	resp.OrderToken, _ = order["order_token"].(string)
+	resp.ClientToken, _ = order["client_token"].(string)
+	resp.DryRun, _ = order["dry_run"].(bool)
+	return resp
+}
+
+// CreateOrderV2 creates an order from the v2 body. With an Idempotency-Key
+// header a retry returns the order the first call created, with 200 and
+// Idempotent-Replayed instead of 201. The key is the order's receipt, so
+// only authenticated callers may send one: anyone else could name an
+// existing receipt and be handed its order.
+func (h *handlers) CreateOrderV2(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	if _, ok := authctx.Principal(c.Request.Context()); key != "" && !ok {
+		respond(c, kindUnauthorized, gin.H{
+			"error": "Idempotency-Key requires an API key",
+		})
+		return
+	}
+	var req orderRequestV2
+	if err := h.bindPaymentJSON(c, &req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	var order map[string]interface{}
+	var err error
+	created := true
+	if key != "" {
+		order, created, err = h.svc.CreateOrderOnce(c.Request.Context(), key, req.paymentRequest())
+	} else {
+		order, err = h.svc.CreateOrder(c.Request.Context(), req.paymentRequest())
+	}
+	if err != nil {
+		writeError(c, err, "Failed to create order")
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+		c.Header("Idempotent-Replayed", "true")
+	}
+	renderV2(c, status, newOrderResponseV2(order))
+}
+
+// renderV2 writes a v2 success response as canonical JSON, so an unchanged
+// resource is byte-for-byte the same on every request. The ETag is the
+// hash of the body; a GET whose If-None-Match carries it is answered with
+// 304 and no body.
+func renderV2(c *gin.Context, status int, v interface{}) {
+	body, err := canonicaljson.Marshal(v)
+	var hash string
+	if err == nil {
+		hash, err = canonicaljson.Hash(v)
+	}
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		respond(c, kindInternal, gin.H{
+			"error": "Failed to encode response",
+		})
+		return
+	}
+	etag := `"` + hash + `"`
+	c.Header("ETag", etag)
+	if c.Request.Method == http.MethodGet && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "application/json; charset=utf-8", body)
+}
+
+// etagMatches reports whether an If-None-Match header names etag. The
+// comparison is weak, as RFC 9110 asks for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/canonicaljson"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/service"
+)
+
+// fields returns the sorted top-level fields of a JSON object
+func fields(t *testing.T, body []byte) []string {
+	t.Helper()
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOrderContracts(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	v1 := []string{"amount", "currency", "id", "order_token", "receipt", "status"}
+	v2 := []string{"amount", "amount_due", "amount_paid", "attempts", "created_at", "currency", "id", "notes", "order_token", "receipt", "status"}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+		fields []string
+	}{
+		{"v1 create", http.MethodPost, "/api/v1/orders", `{"amount":100}`, http.StatusOK, v1},
+		{"v1 get", http.MethodGet, "/api/v1/orders/order_1", "", http.StatusOK, []string{"amount", "currency", "id", "receipt", "status"}},
+		{"v2 create", http.MethodPost, "/api/v2/orders", `{"amount":100,"currency":"INR"}`, http.StatusCreated, v2},
+		{"v2 get", http.MethodGet, "/api/v2/orders/order_2", "", http.StatusOK, []string{"amount", "amount_due", "amount_paid", "attempts", "created_at", "currency", "id", "notes", "receipt", "status"}},
+		{"v2 requires the currency", http.MethodPost, "/api/v2/orders", `{"amount":100}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, tt.method, tt.path, "", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.fields == nil {
+				return
+			}
+			if got := fields(t, w.Body.Bytes()); !reflect.DeepEqual(got, tt.fields) {
+				t.Fatalf("fields = %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCreateOrderV2Idempotent(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{"shop-key": {ScopeOrdersCreate}})
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{APIKeys: keys})
+	key := http.Header{"Idempotency-Key": {"checkout-42"}}
+	tests := []struct {
+		want     int
+		replayed string
+	}{
+		{http.StatusCreated, ""},
+		{http.StatusOK, "true"},
+		{http.StatusOK, "true"},
+	}
+	var first string
+	for i, tt := range tests {
+		w := serveWith(r, http.MethodPost, "/api/v2/orders", "shop-key", `{"amount":100,"currency":"INR"}`, key)
+		if w.Code != tt.want || w.Header().Get("Idempotent-Replayed") != tt.replayed {
+			t.Fatalf("call %d: status = %d, replayed %q, want %d %q", i+1, w.Code, w.Header().Get("Idempotent-Replayed"), tt.want, tt.replayed)
+		}
+		var order struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &order)
+		if first == "" {
+			first = order.ID
+		}
+		if order.ID != first {
+			t.Fatalf("call %d created %s, want %s again", i+1, order.ID, first)
+		}
+	}
+}
+
+func TestCreateOrderV2IdempotencyKeyNeedsAPIKey(t *testing.T) {
+	keys := testAPIKeys(t, map[string][]string{"shop-key": {ScopeOrdersCreate}})
+	gw := &fakeGateway{}
+	r := NewRouter(newTestService(t, gw), Options{APIKeys: keys})
+	key := http.Header{"Idempotency-Key": {"erp-1001"}}
+
+	// The ERP created erp-1001 for 500
+	if w := serveWith(r, http.MethodPost, "/api/v2/orders", "shop-key", `{"amount":500,"currency":"INR"}`, key); w.Code != http.StatusCreated {
+		t.Fatalf("keyed create: status = %d: %s", w.Code, w.Body)
+	}
+
+	for _, body := range []string{`{"amount":500,"currency":"INR"}`, `{"amount":100,"currency":"INR"}`} {
+		w := serveWith(r, http.MethodPost, "/api/v2/orders", "", body, key)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("anonymous %s: status = %d, want 401: %s", body, w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "order_1") || strings.Contains(w.Body.String(), "500") {
+			t.Fatalf("anonymous %s: body = %s, leaks the existing order", body, w.Body)
+		}
+	}
+	if gw.created != 1 {
+		t.Fatalf("%d orders created, want only the keyed one", gw.created)
+	}
+
+	// Without the header anonymous checkout is unchanged
+	if w := serve(r, http.MethodPost, "/api/v2/orders", "", `{"amount":100,"currency":"INR"}`); w.Code != http.StatusCreated {
+		t.Fatalf("anonymous create: status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestGetOrderV2ETag(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	if w := serve(r, http.MethodPost, "/api/v2/orders", "", `{"amount":100,"currency":"INR","notes":{"z":"1","a":"2"}}`); w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d: %s", w.Code, w.Body)
+	}
+
+	w := serve(r, http.MethodGet, "/api/v2/orders/order_1", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := canonicaljson.Hash(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := w.Header().Get("ETag")
+	if etag != `"`+hash+`"` {
+		t.Fatalf("ETag = %s, want the canonical hash %q of the body", etag, hash)
+	}
+	if again := serve(r, http.MethodGet, "/api/v2/orders/order_1", "", ""); again.Header().Get("ETag") != etag || again.Body.String() != w.Body.String() {
+		t.Fatalf("second GET: ETag %s, body %s, want the same response", again.Header().Get("ETag"), again.Body)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := serveWith(r, http.MethodGet, "/api/v2/orders/order_1", "", "", http.Header{"If-None-Match": {tt.ifNoneMatch}})
+		if w.Code != tt.want {
+			t.Fatalf("If-None-Match %s: status = %d, want %d", tt.ifNoneMatch, w.Code, tt.want)
+		}
+		if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Fatalf("304 with a body: %s", w.Body)
+		}
+	}
+}
+
+func TestV1DeprecationHeaders(t *testing.T) {
+	deprecated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		opts        Options
+		path        string
+		body        string
+		deprecation string
+		sunset      string
+	}{
+		{"v1 undated", Options{}, "/api/v1/orders", `{"amount":100}`, "", ""},
+		{"v1 deprecated", Options{V1Deprecation: deprecated}, "/api/v1/orders", `{"amount":100}`, "@1767225600", ""},
+		{"v1 with sunset", Options{V1Deprecation: deprecated, V1Sunset: sunset}, "/api/v1/orders", `{"amount":100}`, "@1767225600", "Thu, 31 Dec 2026 00:00:00 GMT"},
+		{"v2", Options{V1Deprecation: deprecated, V1Sunset: sunset}, "/api/v2/orders", `{"amount":100,"currency":"INR"}`, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(newTestService(t, &fakeGateway{}), tt.opts)
+			w := serve(r, http.MethodPost, tt.path, "", tt.body)
+			if got := w.Header().Get("Deprecation"); got != tt.deprecation {
+				t.Fatalf("Deprecation = %q, want %q", got, tt.deprecation)
+			}
+			if got := w.Header().Get("Sunset"); got != tt.sunset {
+				t.Fatalf("Sunset = %q, want %q", got, tt.sunset)
+			}
+		})
+	}
+}
+
+func TestRequestMetricsSplitByVersion(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	tests := []struct {
+		version string
+		path    string
+		body    string
+		status  int
+	}{
+		{"v1", "/api/v1/orders", `{"amount":100}`, http.StatusOK},
+		{"v2", "/api/v2/orders", `{"amount":100,"currency":"INR"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			requests := metrics.Requests.WithLabelValues(tt.version, http.MethodPost, tt.path, strconv.Itoa(tt.status), "")
+			before := testutil.ToFloat64(requests)
+			if w := serve(r, http.MethodPost, tt.path, "", tt.body); w.Code != tt.status {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := testutil.ToFloat64(requests) - before; got != 1 {
+				t.Fatalf("%s requests rose by %v, want 1", tt.version, got)
+			}
+		})
+	}
+}
+
+func TestCreateOrderV2LineItems(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	items := `[{"name":"Mug","quantity":2,"unit_amount":500},{"name":"Card","quantity":1,"unit_amount":500}]`
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"amount matches", `{"amount":1500,"currency":"INR","items":` + items + `}`, http.StatusCreated},
+		{"amount left to the items", `{"currency":"INR","items":` + items + `}`, http.StatusCreated},
+		{"sum mismatch", `{"amount":2000,"currency":"INR","items":` + items + `}`, http.StatusUnprocessableEntity},
+		{"item in another currency", `{"amount":500,"currency":"INR","items":[{"name":"Mug","quantity":1,"unit_amount":500,"currency":"USD"}]}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/v2/orders", "", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusCreated {
+				var body APIError
+				json.Unmarshal(w.Body.Bytes(), &body)
+				if body.Code != "invalid_amount" {
+					t.Fatalf("code = %q, want invalid_amount", body.Code)
+				}
+				return
+			}
+			var order struct {
+				Amount int                `json:"amount"`
+				Items  []service.LineItem `json:"items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+				t.Fatal(err)
+			}
+			if order.Amount != 1500 || len(order.Items) != 2 || order.Items[0].Name != "Mug" {
+				t.Fatalf("order = %+v, want 1500 with both items", order)
+			}
+		})
+	}
+}
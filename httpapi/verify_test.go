@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// createOrder creates an order of amount through r, returning its ID and
+// order token
+func createOrder(t *testing.T, r http.Handler, amount int) (string, string) {
+	t.Helper()
+	w := serve(r, http.MethodPost, "/api/v1/orders", "", fmt.Sprintf(`{"amount":%d}`, amount))
+	if w.Code != http.StatusOK {
+		t.Fatalf("create order: status %d: %s", w.Code, w.Body)
+	}
+	var order struct {
+		ID         string `json:"id"`
+		OrderToken string `json:"order_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Fatal(err)
+	}
+	return order.ID, order.OrderToken
+}
+
+// verifyBody is a verify request for paymentID paying orderID, signed with
+// the test secret
+func verifyBody(orderID, paymentID, orderToken string) string {
+	mac := hmac.New(sha256.New, []byte("test_secret"))
+	mac.Write([]byte(orderID + "|" + paymentID))
+	return fmt.Sprintf(`{"order_id":%q,"razorpay_payment_id":%q,"razorpay_signature":%q,"order_token":%q}`,
+		orderID, paymentID, hex.EncodeToString(mac.Sum(nil)), orderToken)
+}
+
+func TestVerifyReplayAnswered409(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	orderID, token := createOrder(t, r, 100)
+
+	for i, want := range []int{http.StatusOK, http.StatusConflict} {
+		w := serve(r, http.MethodPost, "/api/v1/verify", "", verifyBody(orderID, "pay_1", token))
+		if w.Code != want {
+			t.Fatalf("verification %d: status = %d, want %d: %s", i+1, w.Code, want, w.Body)
+		}
+	}
+}
+
+func TestVerifySignatureMismatch(t *testing.T) {
+	r := NewRouter(newTestService(t, &fakeGateway{}), Options{})
+	orderID, token := createOrder(t, r, 100)
+	forged := strings.Repeat("ab", 32)
+	body := fmt.Sprintf(`{"order_id":%q,"razorpay_payment_id":"pay_1","razorpay_signature":%q,"order_token":%q}`, orderID, forged, token)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	w := serve(r, http.MethodPost, "/api/v1/verify", "", body)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401: %s", w.Code, w.Body)
+	}
+	var got APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	id := w.Header().Get(RequestIDHeader)
+	if got.Code != "signature_mismatch" || got.Error == "" || got.RequestID != id {
+		t.Fatalf("body = %+v, want the signature_mismatch envelope for request %s", got, id)
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, "Payment signature mismatch for payment pay_1 order "+orderID) || !strings.Contains(logged, id) {
+		t.Fatalf("log = %q, want the mismatch logged with request ID %s", logged, id)
+	}
+	if strings.Contains(logged, forged) {
+		t.Fatalf("log = %q, the signature must never be logged", logged)
+	}
+}
@@ -0,0 +1,31 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSimulateWebhookEndpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		bearer string
+		body   string
+		want   int
+	}{
+		{"simulated", "debug", testAdminToken, `{"event":"payment.captured","order_id":"order_1","amount":100}`, http.StatusAccepted},
+		{"not an admin", "debug", "", `{"event":"payment.captured"}`, http.StatusUnauthorized},
+		{"no event", "debug", testAdminToken, `{"order_id":"order_1"}`, http.StatusBadRequest},
+		{"release mode", "release", testAdminToken, `{"event":"payment.captured"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GIN_MODE", tt.mode)
+			t.Setenv("RAZORPAY_WEBHOOK_SECRET", "whsec_test")
+			r := NewRouter(newTestService(t, &fakeGateway{}), Options{AdminToken: testAdminToken})
+			if w := serve(r, http.MethodPost, "/api/v1/admin/simulate-webhook", tt.bearer, tt.body); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
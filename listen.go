@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes, after stdin,
+// stdout and stderr
+const sdListenFDsStart = 3
+
+// listen returns the socket to serve on: the one systemd passed under socket
+// activation, otherwise a new one bound to port. Port "0" binds an
+// ephemeral port.
+func listen(port string) (net.Listener, error) {
+	ln, err := inheritedListener()
+	if err != nil || ln != nil {
+		return ln, err
+	}
+
+	ln, err = net.Listen("tcp", ":"+port)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return nil, fmt.Errorf("port %s is already in use. Another process (or another instance of this service) is listening on it; stop it or set PORT to a free port. (%w)", port, err)
+	}
+	return ln, err
+}
+
+// inheritedListener implements sd_listen_fds: when LISTEN_PID names this
+// process, the LISTEN_FDS sockets starting at fd 3 are ours. The variables
+// are cleared so child processes do not claim them. It returns nil when
+// the process was not socket activated.
+func inheritedListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	if n > 1 {
+		log.Printf("Socket activation passed %d sockets; serving on the first only", n)
+	}
+
+	syscall.CloseOnExec(sdListenFDsStart)
+	f := os.NewFile(sdListenFDsStart, "systemd-socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("use socket from systemd: %w", err)
+	}
+	log.Printf("Using socket passed by systemd")
+	return ln, nil
+}
+
+// writePortFile records the bound port in path for tests and supervisors
+// that started the service on port 0. The file is replaced atomically so
+// readers never see a partial write.
+func writePortFile(path string, addr net.Addr) error {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("listener address %s is not TCP", addr)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".port-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintf(tmp, "%d\n", tcp.Port); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
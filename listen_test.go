@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestListenEphemeralWritesPortFile(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	ln, err := listen("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	if port == 0 {
+		t.Fatal("bound port 0, want an ephemeral port")
+	}
+
+	path := filepath.Join(t.TempDir(), "port")
+	if err := writePortFile(path, ln.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(raw)); got != strconv.Itoa(port) {
+		t.Fatalf("port file = %q, want %d", got, port)
+	}
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatalf("dial the bound port: %v", err)
+	}
+	conn.Close()
+}
+
+func TestInheritedListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		pid     string
+		fds     string
+		wantErr bool
+	}{
+		{"not activated", "", "", false},
+		{"activated for another process", "1", "1", false},
+		{"no sockets", strconv.Itoa(os.Getpid()), "0", true},
+		{"garbled count", strconv.Itoa(os.Getpid()), "many", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+			ln, err := inheritedListener()
+			if ln != nil {
+				ln.Close()
+				t.Fatalf("listener %s, want none", ln.Addr())
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			// The variables are not passed on once read
+			if tt.pid != "" && (os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDS") != "") {
+				t.Fatal("LISTEN_PID and LISTEN_FDS left set")
+			}
+		})
+	}
+}
+
+func TestListenPortInUse(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	first, err := listen("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	port := strconv.Itoa(first.Addr().(*net.TCPAddr).Port)
+
+	second, err := listen(port)
+	if err == nil {
+		second.Close()
+		t.Fatalf("second listener on port %s started, want it refused", port)
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("err = %v, want EADDRINUSE", err)
+	}
+	if !strings.Contains(err.Error(), "port "+port+" is already in use") || !strings.Contains(err.Error(), "set PORT") {
+		t.Fatalf("err = %q, want it to name port %s and how to free it", err, port)
+	}
+}
@@ -1,63 +1,37 @@
 package main
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"strings"
-
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"github.com/razorpay/razorpay-go"
-)
-
-// Config holds all configuration values
-type Config struct {
-	APIKey         string
-	SecretKey      string
-	Port           string
-	AllowedOrigins []string
-}
-
-// PaymentService handles all payment related operations
-type PaymentService struct {
-	client *razorpay.Client
-	config Config
-}
-
-// PaymentRequest represents the incoming payment creation request
-type PaymentRequest struct {
-	Amount int `json:"amount" binding:"required,min=1"`
-}
-
-// PaymentVerificationRequest represents the payment verification payload
-type PaymentVerificationRequest struct {
-	ServerOrderID     string `json:"order_id" binding:"required"`
-	RazorpayPaymentID string `json:"razorpay_payment_id" binding:"required"`
-	RazorpaySignature string `json:"razorpay_signature" binding:"required"`
-}
 
-// NewPaymentService creates a new instance of PaymentService
-func NewPaymentService(config Config) (*PaymentService, error) {
-	if config.APIKey == "" || config.SecretKey == "" {
-		return nil, fmt.Errorf("missing required configuration")
-	}
-
-	client := razorpay.NewClient(config.APIKey, config.SecretKey)
-	return &PaymentService{
-		client: client,
-		config: config,
-	}, nil
-}
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/egress"
+	"github.com/yash170603/golang_payment/flags"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/httpapi"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/objstore"
+	"github.com/yash170603/golang_payment/service"
+)
 
 func main() {
+	portFile := flag.String("port-file", "", "write the bound port to this file, e.g. when PORT=0")
+	check := flag.Bool("check", false, "validate configuration and connectivity, then exit without serving")
+	flag.Parse()
 
 	err := godotenv.Load()
 	if err != nil {
@@ -65,113 +39,402 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 	fmt.Printf("API Key: %s\n", os.Getenv("RAZORPAY_API_KEY"))
-	fmt.Printf("Secret Key: %s\n", os.Getenv("RAZORPAY_SECRET_KEY"))
 	fmt.Printf("Port: %s\n", os.Getenv("PORT"))
 	fmt.Printf("Allowed Origins: %s\n", os.Getenv("ALLOWED_ORIGINS"))
-	// Set Gin to release mode in production
-	gin.SetMode(gin.TestMode)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Set GIN_MODE=release in production
+	gin.SetMode(cfg.Mode)
 
-	config := Config{
-		APIKey:         os.Getenv("RAZORPAY_API_KEY"),
-		SecretKey:      os.Getenv("RAZORPAY_SECRET_KEY"),
-		Port:           os.Getenv("PORT"),
-		AllowedOrigins: strings.Split(os.Getenv("ALLOWED_ORIGINS"), ","),
+	if cfg.MetricsMerchantLabels {
+		metrics.EnableMerchantLabels(cfg.MetricsMerchantLabelLimit)
 	}
 
-	if config.Port == "" {
-		config.Port = "8080"
+	outbound := service.EgressPolicy(cfg)
+	if err := checkOutboundURLs(outbound, cfg); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	service, err := NewPaymentService(config)
+	gw, err := gateway.NewRazorpay(gateway.RazorpayOptions{
+		KeyID:     cfg.APIKey,
+		KeySecret: cfg.SecretKey,
+		Timeout:   cfg.RazorpayTimeout,
+		BaseURL:   cfg.RazorpayBaseURL,
+	})
 	if err != nil {
-		log.Fatalf("Failed to initialize payment service: %v", err)
+		log.Fatalf("Failed to initialize payment gateway: %v", err)
+	}
+	if cfg.ProviderFailover {
+		secondary, err := gateway.NewRazorpay(gateway.RazorpayOptions{
+			KeyID:     cfg.FailoverAPIKey,
+			KeySecret: cfg.FailoverSecretKey,
+			Timeout:   cfg.RazorpayTimeout,
+			BaseURL:   cfg.RazorpayBaseURL,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize failover gateway: %v", err)
+		}
+		gw = gateway.NewFailover(gw, secondary)
 	}
 
-	r := gin.Default()
-
-	// Middleware setup
-	r.Use(gin.Recovery())
-	r.Use(gin.Logger())
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     config.AllowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	var opts []service.Option
+	if cfg.AccountsFile != "" {
+		accounts, err := service.LoadAccounts(cfg.AccountsFile)
+		if err != nil {
+			log.Fatalf("Failed to load Razorpay accounts: %v", err)
+		}
+		gateways := make(map[string]gateway.Gateway)
+		for _, acct := range accounts.List() {
+			gateways[acct.Name], err = gateway.NewRazorpay(gateway.RazorpayOptions{
+				KeyID:     acct.KeyID,
+				KeySecret: acct.KeySecret,
+				Timeout:   cfg.RazorpayTimeout,
+				BaseURL:   cfg.RazorpayBaseURL,
+			})
+			if err != nil {
+				log.Fatalf("Failed to initialize gateway for account %s: %v", acct.Name, err)
+			}
+		}
+		gw = gateway.NewAccounts(gw, gateways)
+		opts = append(opts, service.WithAccounts(accounts))
+	}
+	var clk clock.Clock = clock.Real{}
+	if !cfg.FreezeTime.IsZero() {
+		log.Printf("WARNING: service clock frozen at %s", cfg.FreezeTime.Format(time.RFC3339))
+		clk = clock.NewFake(cfg.FreezeTime)
+		opts = append(opts, service.WithClock(clk))
+	}
+	if cfg.TenantsFile != "" {
+		tenants, err := service.LoadTenants(cfg.TenantsFile)
+		if err != nil {
+			log.Fatalf("Failed to load tenants: %v", err)
+		}
+		opts = append(opts, service.WithTenants(tenants, func(t service.Tenant) (gateway.Gateway, error) {
+			return gateway.NewRazorpay(gateway.RazorpayOptions{
+				KeyID:     t.KeyID,
+				KeySecret: t.KeySecret,
+				Timeout:   cfg.RazorpayTimeout,
+				BaseURL:   cfg.RazorpayBaseURL,
+			})
+		}))
+	}
 
-	// Routes
-	r.POST("/api/v1/orders", service.CreateOrder)
-	r.POST("/api/v1/verify", service.VerifyOrder)
+	var brands *service.Brands
+	if cfg.BrandsFile != "" {
+		brands, err = service.LoadBrands(cfg.BrandsFile, cfg.DefaultBrand)
+		if err != nil {
+			log.Fatalf("Failed to load brands: %v", err)
+		}
+		opts = append(opts, service.WithBrands(brands))
+	}
 
-	// Start server
-	if err := r.Run(":" + config.Port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	var featureFlags *flags.Store
+	if cfg.FeatureFlagsFile != "" {
+		featureFlags, err = flags.Load(cfg.FeatureFlagsFile)
+		if err != nil {
+			log.Fatalf("Failed to load feature flags: %v", err)
+		}
+		opts = append(opts, service.WithFlags(featureFlags))
 	}
-}
 
-func (s *PaymentService) CreateOrder(c *gin.Context) {
-	var req PaymentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
+	if cfg.ArchiveS3Bucket != "" {
+		// Archive objects are read back whole, and are only as large as
+		// ARCHIVE_BATCH_SIZE lets them be
+		archivePolicy := outbound
+		archivePolicy.MaxResponseBytes = 0
+		archive, err := objstore.NewS3(objstore.S3Options{
+			Endpoint:        cfg.ArchiveS3Endpoint,
+			Region:          cfg.ArchiveS3Region,
+			Bucket:          cfg.ArchiveS3Bucket,
+			AccessKeyID:     cfg.ArchiveS3AccessKey,
+			SecretAccessKey: cfg.ArchiveS3SecretKey,
+			Client:          archivePolicy.Client(time.Minute),
 		})
-		return
+		if err != nil {
+			log.Fatalf("Failed to initialize archive storage: %v", err)
+		}
+		opts = append(opts, service.WithArchive(archive))
 	}
 
-	data := map[string]interface{}{
-		"amount":   req.Amount,
-		"currency": "INR",
-		"receipt":  fmt.Sprintf("rcpt_%d", time.Now().Unix()),
-		"notes": map[string]interface{}{
-			"created_at": time.Now().Format(time.RFC3339),
-		},
+	if cfg.IdempotencyBackend == config.IdempotencyRedis {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		replays, err := service.NewRedisReplayStore(ctx, cfg.RedisURL)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to initialize idempotency backend: %v", err)
+		}
+		defer replays.Close()
+		opts = append(opts, service.WithReplayStore(replays))
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		receipts, err := service.NewRedisReceiptStore(ctx, cfg.RedisURL, cfg.ReceiptLockTTL, cfg.ReceiptRecordTTL)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to initialize idempotency backend: %v", err)
+		}
+		defer receipts.Close()
+		opts = append(opts, service.WithReceiptStore(receipts))
 	}
 
-	order, err := s.client.Order.Create(data, nil)
+	channels := notificationChannels(cfg, brands, outbound)
+	sms, err := smsChannel(cfg, outbound)
 	if err != nil {
-		log.Printf("Error creating order: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create order",
-		})
-		return
+		log.Fatalf("Failed to initialize SMS: %v", err)
+	}
+	if sms != nil {
+		channels = append(channels, sms)
+		opts = append(opts, service.WithSMS(sms))
+	}
+	notifier := notify.New(notify.Options{
+		QueueSize:   cfg.NotifyQueueSize,
+		MaxAttempts: cfg.NotifyMaxAttempts,
+		Backoff:     cfg.NotifyRetryBackoff,
+	}, channels...)
+	opts = append(opts, service.WithNotifier(notifier))
+
+	svc, err := service.New(gw, service.NewMemoryStore(), cfg, opts...)
+	if err != nil {
+		log.Fatalf("Failed to initialize payment service: %v", err)
+	}
+
+	// Check mode exits before the port is bound, 1 when a check failed
+	if *check || cfg.CheckOnly {
+		if !runCheck(context.Background(), svc, notifier, cfg.HealthCheckTimeout, os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// The backfill command exits once Razorpay history is imported; after
+	// an interrupt it resumes from the last window checkpointed
+	if flag.Arg(0) == "backfill" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := runBackfill(ctx, svc, flag.Args()[1:], os.Stdout)
+		stop()
+		os.Exit(code)
+	}
+
+	// Reload the notes schema, capture policy, tag rules, account routing
+	// and feature flags on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := svc.ReloadNotesSchema(); err != nil {
+				log.Printf("Keeping previous notes schema, reload failed: %v", err)
+			} else {
+				log.Printf("Reloaded notes schema")
+			}
+			if err := svc.ReloadCapturePolicy(); err != nil {
+				log.Printf("Keeping previous capture policy, reload failed: %v", err)
+			} else {
+				log.Printf("Reloaded capture policy")
+			}
+			if err := svc.ReloadTagRules(); err != nil {
+				log.Printf("Keeping previous tag rules, reload failed: %v", err)
+			} else {
+				log.Printf("Reloaded tag rules")
+			}
+			if cfg.AccountsFile != "" {
+				if err := svc.ReloadAccounts(); err != nil {
+					log.Printf("Keeping previous account routing, reload failed: %v", err)
+				} else {
+					log.Printf("Reloaded account routing")
+				}
+			}
+			if featureFlags != nil {
+				if err := featureFlags.Reload(); err != nil {
+					log.Printf("Keeping previous feature flags, reload failed: %v", err)
+				} else {
+					log.Printf("Reloaded feature flags")
+				}
+			}
+		}
+	}()
+
+	var apiKeys *httpapi.APIKeys
+	if cfg.APIKeysFile != "" {
+		apiKeys, err = httpapi.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+	}
+
+	r := httpapi.NewRouter(svc, httpapi.Options{
+		AllowedOrigins:            cfg.AllowedOrigins,
+		AdminAllowedOrigins:       cfg.AdminAllowedOrigins,
+		CORSMaxAge:                cfg.CORSMaxAge,
+		AdminToken:                cfg.AdminToken,
+		APIKeys:                   apiKeys,
+		ForwardHeaders:            cfg.NotifyForwardHeaders,
+		RequestTimeout:            cfg.RequestTimeout,
+		PublicStatusRateLimit:     cfg.PublicStatusRateLimit,
+		FunnelBeaconRateLimit:     cfg.FunnelBeaconRateLimit,
+		VerifyBatchRateLimit:      cfg.VerifyBatchRateLimit,
+		MerchantRateLimit:         cfg.MerchantRateLimit,
+		StrictJSON:                cfg.StrictJSONFields,
+		RequestIDHeader:           cfg.RequestIDHeader,
+		APIContentSecurityPolicy:  cfg.APIContentSecurityPolicy,
+		HTMLContentSecurityPolicy: cfg.HTMLContentSecurityPolicy,
+		HSTSMaxAge:                cfg.HSTSMaxAge,
+		TrustProxyHTTPS:           cfg.TrustProxyHTTPS,
+		HealthCheckTimeout:        cfg.HealthCheckTimeout,
+		CompressionLevel:          cfg.CompressionLevel,
+		CompressionMinSize:        cfg.CompressionMinSize,
+		V1Deprecation:             cfg.V1Deprecation,
+		V1Sunset:                  cfg.V1Sunset,
+		Clock:                     clk,
+	})
+
+	srv := &http.Server{
+		Handler: r,
 	}
 
-	c.JSON(http.StatusOK, order)
+	ln, err := listen(cfg.Port)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	log.Printf("Listening on %s", ln.Addr())
+	if *portFile != "" {
+		if err := writePortFile(*portFile, ln.Addr()); err != nil {
+			log.Fatalf("Failed to write port file: %v", err)
+		}
+		defer os.Remove(*portFile)
+	}
+
+	// Start server. Shutdown closes the listener whether it was inherited
+	// or opened here.
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Printf("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Drain requests first so no new webhooks are queued, then the queue
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error draining requests: %v", err)
+	}
+	if err := svc.Shutdown(ctx); err != nil {
+		log.Printf("Error stopping background workers: %v", err)
+	}
+	if err := notifier.Shutdown(ctx); err != nil {
+		log.Printf("Error draining notifications: %v", err)
+	}
+	flushMetrics(cfg, outbound)
 }
 
-func (s *PaymentService) VerifyOrder(c *gin.Context) {
-	var req PaymentVerificationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+// flushMetrics pushes the final metrics to the Pushgateway, if configured,
+// once everything that records them has drained
+func flushMetrics(cfg config.Config, outbound egress.Policy) {
+	if cfg.MetricsPushgatewayURL == "" {
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.MetricsFlushTimeout)
+	defer cancel()
 
-	// Generate verification data
-	data := fmt.Sprintf("%s|%s", req.ServerOrderID, req.RazorpayPaymentID)
-
-	// Verify signature
-	if !s.verifySignature(data, req.RazorpaySignature) {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid payment signature",
-		})
+	instance, _ := os.Hostname()
+	if err := metrics.Push(ctx, outbound.Client(cfg.MetricsFlushTimeout), cfg.MetricsPushgatewayURL, "golang_payment", instance); err != nil {
+		log.Printf("Error flushing metrics to %s: %v", cfg.MetricsPushgatewayURL, err)
 		return
 	}
+	log.Printf("Flushed metrics to %s", cfg.MetricsPushgatewayURL)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Payment verified successfully",
-	})
+// checkOutboundURLs refuses configured URLs the egress policy would never
+// let a request reach, rather than failing every delivery to them later
+func checkOutboundURLs(outbound egress.Policy, cfg config.Config) error {
+	urls := map[string]string{
+		"NOTIFY_SLACK_WEBHOOK_URL": cfg.NotifySlackWebhookURL,
+		"NOTIFY_CALLBACK_URL":      cfg.NotifyCallbackURL,
+		"ARCHIVE_S3_ENDPOINT":      cfg.ArchiveS3Endpoint,
+		"METRICS_PUSHGATEWAY_URL":  cfg.MetricsPushgatewayURL,
+	}
+	for env, raw := range urls {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", env, err)
+		}
+		if err := outbound.Check(u); err != nil {
+			return fmt.Errorf("%s: %w; allow its host with EGRESS_ALLOWED_HOSTS if it is trusted", env, err)
+		}
+	}
+	return nil
 }
 
-func (s *PaymentService) verifySignature(data, signature string) bool {
-	h := hmac.New(sha256.New, []byte(s.config.SecretKey))
-	h.Write([]byte(data))
-	generated := hex.EncodeToString(h.Sum(nil))
-	return hmac.Equal([]byte(generated), []byte(signature))
+// notificationChannels returns the channels whose destination is configured.
+// Emails about a brand's orders are sent from the brand's sender.
+func notificationChannels(cfg config.Config, brands *service.Brands, outbound egress.Policy) []notify.Channel {
+	var channels []notify.Channel
+	if cfg.NotifySlackWebhookURL != "" {
+		channels = append(channels, &notify.Slack{WebhookURL: cfg.NotifySlackWebhookURL, Client: outbound.Client(time.Minute)})
+	}
+	if cfg.NotifyCallbackURL != "" {
+		channels = append(channels, &notify.Callback{URL: cfg.NotifyCallbackURL, Secret: cfg.NotifyCallbackSecret, Client: outbound.Client(time.Minute)})
+	}
+	if cfg.NotifySMTPAddr != "" {
+		email := &notify.Email{
+			Addr:     cfg.NotifySMTPAddr,
+			Username: cfg.NotifySMTPUsername,
+			Password: cfg.NotifySMTPPassword,
+			From:     cfg.NotifyEmailFrom,
+			To:       cfg.NotifyEmailTo,
+		}
+		if brands != nil {
+			email.Senders = brands.Senders()
+		}
+		channels = append(channels, email)
+	}
+	return channels
+}
+
+// smsChannel returns the SMS channel of SMS_PROVIDER, or nil when SMS is off
+func smsChannel(cfg config.Config, outbound egress.Policy) (*notify.SMS, error) {
+	var provider notify.SMSProvider
+	switch cfg.SMSProvider {
+	case config.SMSProviderMSG91:
+		provider = &notify.MSG91{
+			AuthKey:     cfg.MSG91AuthKey,
+			SenderID:    cfg.MSG91SenderID,
+			Route:       cfg.MSG91Route,
+			StatusToken: cfg.SMSStatusToken,
+			Client:      outbound.Client(time.Minute),
+		}
+	case config.SMSProviderTwilio:
+		provider = &notify.Twilio{
+			AccountSID:          cfg.TwilioAccountSID,
+			AuthToken:           cfg.TwilioAuthToken,
+			From:                cfg.TwilioFrom,
+			MessagingServiceSID: cfg.TwilioMessagingServiceSID,
+			StatusCallbackURL:   cfg.SMSStatusCallbackURL,
+			Client:              outbound.Client(time.Minute),
+		}
+	default:
+		return nil, nil
+	}
+
+	templates, err := notify.LoadSMSTemplates(cfg.SMSTemplatesFile)
+	if err != nil {
+		return nil, err
+	}
+	return notify.NewSMS(provider, notify.SMSOptions{
+		Templates:   templates,
+		MaxSegments: cfg.SMSMaxSegments,
+		RateLimit:   cfg.SMSRateLimit,
+		CountryCode: cfg.SMSCountryCode,
+		Suppressed:  cfg.SMSSuppressed,
+	})
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/egress"
+)
+
+func TestFlushMetricsLogsResult(t *testing.T) {
+	status := http.StatusOK
+	pushes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+	outbound := egress.Policy{AllowedHosts: []string{host.Hostname()}}
+
+	tests := []struct {
+		name       string
+		url        string
+		status     int
+		wantPushes int
+		wantLog    string
+	}{
+		{"not configured", "", http.StatusOK, 0, ""},
+		{"flushed", server.URL, http.StatusOK, 1, "Flushed metrics to " + server.URL},
+		{"refused", server.URL, http.StatusBadGateway, 1, "Error flushing metrics to " + server.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, pushes = tt.status, 0
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			flushMetrics(config.Config{MetricsPushgatewayURL: tt.url, MetricsFlushTimeout: time.Second}, outbound)
+			if pushes != tt.wantPushes {
+				t.Fatalf("%d pushes, want %d", pushes, tt.wantPushes)
+			}
+			if tt.wantLog == "" && buf.Len() > 0 || !strings.Contains(buf.String(), tt.wantLog) {
+				t.Fatalf("log = %q, want %q", buf.String(), tt.wantLog)
+			}
+		})
+	}
+}
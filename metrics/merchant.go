@@ -0,0 +1,48 @@
+package metrics
+
+import "sync"
+
+// OtherMerchant is the label value shared by merchants beyond the cap
+const OtherMerchant = "other"
+
+// merchants decides the merchant label value. It is off by default: every
+// distinct value multiplies the series of each labelled collector, so with
+// many merchants the label can swamp Prometheus. When enabled, only the
+// first limit merchants seen get their own value and the rest are bucketed
+// into OtherMerchant.
+var merchants struct {
+	mu      sync.Mutex
+	enabled bool
+	limit   int
+	seen    map[string]struct{}
+}
+
+// EnableMerchantLabels turns on the merchant label, keeping at most limit
+// distinct merchant values
+func EnableMerchantLabels(limit int) {
+	merchants.mu.Lock()
+	defer merchants.mu.Unlock()
+	merchants.enabled = true
+	merchants.limit = limit
+	merchants.seen = make(map[string]struct{})
+}
+
+// Merchant returns the merchant label value for tenant. It is empty, which
+// Prometheus treats as no label, when merchant labels are disabled or the
+// call has no tenant.
+func Merchant(tenant string) string {
+	merchants.mu.Lock()
+	defer merchants.mu.Unlock()
+
+	if !merchants.enabled || tenant == "" {
+		return ""
+	}
+	if _, ok := merchants.seen[tenant]; ok {
+		return tenant
+	}
+	if len(merchants.seen) >= merchants.limit {
+		return OtherMerchant
+	}
+	merchants.seen[tenant] = struct{}{}
+	return tenant
+}
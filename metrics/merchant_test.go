@@ -0,0 +1,32 @@
+package metrics
+
+import "testing"
+
+func TestMerchant(t *testing.T) {
+	t.Cleanup(func() { merchants.enabled = false })
+
+	if got := Merchant("acme"); got != "" {
+		t.Fatalf("disabled: Merchant(acme) = %q, want no label", got)
+	}
+	EnableMerchantLabels(2)
+	tests := []struct {
+		tenant string
+		want   string
+	}{
+		{"", ""},
+		{"acme", "acme"},
+		{"globex", "globex"},
+		// The cap is reached, so new merchants share a value
+		{"initech", OtherMerchant},
+		{"umbrella", OtherMerchant},
+		// Merchants seen before the cap keep theirs
+		{"acme", "acme"},
+		{"globex", "globex"},
+		{"initech", OtherMerchant},
+	}
+	for _, tt := range tests {
+		if got := Merchant(tt.tenant); got != tt.want {
+			t.Errorf("Merchant(%q) = %q, want %q", tt.tenant, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package metrics defines the Prometheus collectors exported by the service.
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Registry holds every collector below plus the Go and process collectors
+var Registry = prometheus.NewRegistry()
+
+// SignatureVerifications counts payment signature checks by result: valid,
+// invalid for a well-formed signature that does not match, or malformed
+// for one that is not 64 hex digits. Either failure rising is worth an
+// alert, e.g. on
+//
+//	sum(rate(signature_verifications_total{result!="valid"}[5m]))
+//	  / sum(rate(signature_verifications_total[5m])) > 0.05
+//
+// Malformed signatures point at a broken or probing client rather than
+// a replayed payment.
+var SignatureVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "signature_verifications_total",
+	Help: "Payment signature checks by result (valid, invalid, malformed).",
+}, []string{"result"})
+
+// OrderFetches counts order reads by how they were served: fresh from
+// Razorpay, stale from the warm cache, or failed
+var OrderFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "order_fetch_total",
+	Help: "Order reads by result (fresh, stale, failed).",
+}, []string{"result"})
+
+// NotifyDeliveries counts notification outcomes per channel: delivered,
+// failed after all retries, or dropped because the queue was full
+var NotifyDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "notify_deliveries_total",
+	Help: "Notification outcomes by channel and result (delivered, failed, dropped).",
+}, []string{"channel", "result"})
+
+// SMSMessages counts texts per provider by state: sent, delivered,
+// failed, or suppressed and rejected without being sent
+var SMSMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "sms_messages_total",
+	Help: "SMS messages by provider and status (sent, delivered, failed, suppressed, rejected).",
+}, []string{"provider", "status"})
+
+// AccountOrders counts the orders created on each Razorpay account when
+// orders are routed between several
+var AccountOrders = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "account_orders_total",
+	Help: "Orders created per Razorpay account.",
+}, []string{"account"})
+
+// AccountWeight is the routing weight currently set for each account
+var AccountWeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "account_routing_weight",
+	Help: "Order routing weight per Razorpay account.",
+}, []string{"account"})
+
+// ArchivedRecords counts the records moved to the archive by kind, orders
+// or webhook events
+var ArchivedRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "archived_records_total",
+	Help: "Records moved to the archive by kind (order, webhook_event).",
+}, []string{"kind"})
+
+// WebhookReordering counts webhook events that arrived out of order:
+// reordered ones came after a successor, parked ones were held back for a
+// predecessor and force_resolved ones gave up waiting and were settled
+// from the Razorpay API
+var WebhookReordering = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "webhook_reordering_total",
+	Help: "Out-of-order webhook events by outcome (reordered, parked, force_resolved).",
+}, []string{"outcome"})
+
+// RazorpayRateLimits counts Razorpay calls refused for rate limiting by
+// source: upstream for a 429 from Razorpay, short_circuited for a call the
+// open circuit breaker refused without sending
+var RazorpayRateLimits = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "razorpay_rate_limits_total",
+	Help: "Rate-limited Razorpay calls by source (upstream, short_circuited).",
+}, []string{"source"})
+
+// RazorpayRetries counts Razorpay calls retried after a rate limit
+var RazorpayRetries = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "razorpay_retries_total",
+	Help: "Razorpay calls retried after a rate limit.",
+})
+
+// NotifyQueueDepth is the number of events waiting on each channel
+var NotifyQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "notify_queue_depth",
+	Help: "Events queued per notification channel.",
+}, []string{"channel"})
+
+// NotifyConsecutiveFailures is each channel's current run of failed events
+var NotifyConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "notify_consecutive_failures",
+	Help: "Events in a row a notification channel failed to deliver.",
+}, []string{"channel"})
+
+// Requests counts API requests by API version, method, route pattern,
+// status code and merchant
+var Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_total",
+	Help: "API requests by version, method, route, status and merchant.",
+}, []string{"version", "method", "route", "status", "merchant"})
+
+// RequestDuration observes API request latency by API version, method,
+// route pattern and merchant
+var RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "API request latency by version, method, route and merchant.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"version", "method", "route", "merchant"})
+
+// Verifications counts payment verifications by result and merchant
+var Verifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "payment_verifications_total",
+	Help: "Payment verifications by result and merchant.",
+}, []string{"result", "merchant"})
+
+// Refunds counts refunds made through the API, including scheduled and
+// approved ones, by the status Razorpay gave them (processed, pending) or
+// failed when Razorpay refused or could not be reached
+var Refunds = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "refunds_total",
+	Help: "Refunds made by status (processed, pending, failed).",
+}, []string{"status"})
+
+// RefundAmount sums the amounts of the refunds Razorpay accepted, in minor
+// units of each currency like every amount in the API
+var RefundAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "refund_amount",
+	Help: "Amount refunded in minor units (e.g. paise) by currency.",
+}, []string{"currency"})
+
+// Disputes counts dispute webhooks by the state the dispute is in: open,
+// under_review, won, lost or closed
+var Disputes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "disputes_total",
+	Help: "Dispute events by dispute state (open, under_review, won, lost, closed).",
+}, []string{"state"})
+
+// ScheduledExecutions counts attempts at scheduled refunds and captures by
+// kind and result: done, retried or failed
+var ScheduledExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "scheduled_executions_total",
+	Help: "Scheduled action executions by kind (refund, capture) and result (done, retried, failed).",
+}, []string{"kind", "result"})
+
+// ScheduledPending is the number of scheduled actions not yet executed
+var ScheduledPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "scheduled_actions_pending",
+	Help: "Scheduled actions waiting to execute, by kind.",
+}, []string{"kind"})
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests,
+		RequestDuration,
+		Verifications,
+		SignatureVerifications,
+		OrderFetches,
+		NotifyDeliveries,
+		NotifyQueueDepth,
+		NotifyConsecutiveFailures,
+		SMSMessages,
+		AccountOrders,
+		AccountWeight,
+		ArchivedRecords,
+		WebhookReordering,
+		RazorpayRateLimits,
+		RazorpayRetries,
+		ScheduledExecutions,
+		ScheduledPending,
+		Refunds,
+		RefundAmount,
+		Disputes,
+	)
+}
+
+// Push sends the registry to a Prometheus Pushgateway under job, grouped
+// by instance, over client. It runs on shutdown so the last observations
+// outlive the process instead of waiting for a scrape that never comes.
+func Push(ctx context.Context, client push.HTTPDoer, url, job, instance string) error {
+	return push.New(url, job).
+		Client(client).
+		Gatherer(Registry).
+		Grouping("instance", instance).
+		PushContext(ctx)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
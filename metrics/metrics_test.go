@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	NotifyDeliveries.WithLabelValues("push-test", "delivered").Inc()
+	if err := Push(context.Background(), server.Client(), server.URL, "golang_payment", "host-1"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/golang_payment/instance/host-1" {
+		t.Fatalf("pushed %s %s, want PUT under the job and instance", method, path)
+	}
+	if !strings.Contains(body, "notify_deliveries_total") {
+		t.Fatalf("push did not carry the registry")
+	}
+}
+
+func TestPushBoundedByContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := Push(ctx, server.Client(), server.URL, "golang_payment", "host-1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the flush timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("push took %s past its timeout", elapsed)
+	}
+}
+
+func TestPushRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	if err := Push(context.Background(), server.Client(), server.URL, "golang_payment", "host-1"); err == nil {
+		t.Fatal("err = nil, want the Pushgateway's refusal")
+	}
+}
@@ -0,0 +1,138 @@
+package money
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// amountName matches identifiers that hold an amount of money
+var amountName = regexp.MustCompile(`(?i)amount|fee|tax|paise|price|balance`)
+
+// mentionsAmount reports whether expr reads an amount-named identifier
+func mentionsAmount(expr ast.Node) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			found = found || amountName.MatchString(n.Name)
+		case *ast.BasicLit:
+			found = found || (n.Kind == token.STRING && amountName.MatchString(n.Value))
+		}
+		return !found
+	})
+	return found
+}
+
+// floatOfAmount reports whether expr converts an amount to floating point
+func floatOfAmount(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return !found
+		}
+		if fn, ok := call.Fun.(*ast.Ident); ok && (fn.Name == "float64" || fn.Name == "float32") {
+			found = found || mentionsAmount(call.Args[0])
+		}
+		return !found
+	})
+	return found
+}
+
+// floatRounding is the math functions that round or cut floats
+var floatRounding = map[string]bool{"Round": true, "RoundToEven": true, "Floor": true, "Ceil": true, "Trunc": true, "Mod": true}
+
+// TestNoFloatArithmeticOnAmounts keeps amounts out of floating point
+// outside this package: converting one to a float for a metric is fine,
+// but adding, scaling or rounding it there is not.
+func TestNoFloatArithmeticOnAmounts(t *testing.T) {
+	fset := token.NewFileSet()
+	err := filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != ".." && (strings.HasPrefix(d.Name(), ".") || d.Name() == "money") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BinaryExpr:
+				switch n.Op {
+				case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+					if floatOfAmount(n.X) || floatOfAmount(n.Y) {
+						t.Errorf("%s: float arithmetic on an amount; use money", fset.Position(n.Pos()))
+					}
+				}
+			case *ast.AssignStmt:
+				switch n.Tok {
+				case token.ADD_ASSIGN, token.SUB_ASSIGN, token.MUL_ASSIGN, token.QUO_ASSIGN:
+					for _, rhs := range n.Rhs {
+						if floatOfAmount(rhs) {
+							t.Errorf("%s: float arithmetic on an amount; use money", fset.Position(n.Pos()))
+						}
+					}
+				}
+			case *ast.CallExpr:
+				sel, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok || !floatRounding[sel.Sel.Name] {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "math" {
+					for _, arg := range n.Args {
+						if mentionsAmount(arg) {
+							t.Errorf("%s: math.%s on an amount; use money.Round", fset.Position(n.Pos()), sel.Sel.Name)
+						}
+					}
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFloatArithmeticCaught(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"float64(amount) * 1.02", true},
+		{"rate * float64(p.Fee)", true},
+		{"float64(total.Amount) / 100", true},
+		{"float64(len(parked))", false},
+		{"float64(n) * 1000 / float64(total)", false},
+		{"float64(time.Second) * math.Pow(2, float64(n))", false},
+	}
+	for _, tt := range tests {
+		expr, err := parser.ParseExpr(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := false
+		if bin, ok := expr.(*ast.BinaryExpr); ok {
+			got = floatOfAmount(bin.X) || floatOfAmount(bin.Y)
+		}
+		if got != tt.want {
+			t.Errorf("%s: caught = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
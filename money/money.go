@@ -0,0 +1,184 @@
+// Package money holds amounts as whole minor units of a currency, such as
+// paise, and is the one place they are split, scaled and rounded. Nothing
+// here goes through floating point, so no paisa is created or lost.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrCurrencyMismatch is arithmetic on amounts of different currencies
+var ErrCurrencyMismatch = errors.New("currencies differ")
+
+// ErrOutOfRange is a result that does not fit in an int64 of minor units
+var ErrOutOfRange = errors.New("amount out of range")
+
+// Money is an amount in minor units of Currency, an ISO 4217 code
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New returns amount minor units of currency, its code upper-cased
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// IsZero reports whether m is no money at all
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+}
+
+// Add returns m+o
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrOutOfRange, m, o)
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m-o
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrOutOfRange, m, o)
+	}
+	return m.Add(o.Neg())
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Sum adds up amounts, all of currency
+func Sum(currency string, amounts ...Money) (Money, error) {
+	total := New(0, currency)
+	for _, m := range amounts {
+		var err error
+		if total, err = total.Add(m); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Allocate splits m in proportion to weights. The parts add up to m
+// exactly: each gets the floor of its exact share, and the minor units
+// left over go one each to the largest remainders, earlier weights first
+// on ties.
+func (m Money) Allocate(weights ...int64) ([]Money, error) {
+	var whole int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("allocate %s: negative weight %d", m, w)
+		}
+		whole += w
+	}
+	return m.Shares(whole, weights...)
+}
+
+// Split divides m into n parts differing by at most one minor unit
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("split %s into %d parts", m, n)
+	}
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return m.Allocate(weights...)
+}
+
+// Shares gives each of parts its part/whole share of m, in whole minor
+// units by largest remainder, so the shares total the floor of the exact
+// total and no share exceeds its exact value by a whole unit. With parts
+// adding up to whole, that is Allocate. A negative m is shared as its
+// absolute value and the shares negated.
+func (m Money) Shares(whole int64, parts ...int64) ([]Money, error) {
+	if whole <= 0 {
+		return nil, fmt.Errorf("share %s: whole must be positive, is %d", m, whole)
+	}
+	amount := new(big.Int).Abs(big.NewInt(m.Amount))
+	w := big.NewInt(whole)
+
+	shares := make([]*big.Int, len(parts))
+	remainders := make([]*big.Int, len(parts))
+	exact, floored := new(big.Int), new(big.Int)
+	for i, part := range parts {
+		if part < 0 {
+			return nil, fmt.Errorf("share %s: negative part %d", m, part)
+		}
+		product := new(big.Int).Mul(amount, big.NewInt(part))
+		shares[i], remainders[i] = new(big.Int).QuoRem(product, w, new(big.Int))
+		exact.Add(exact, product)
+		floored.Add(floored, shares[i])
+	}
+	order := make([]int, len(parts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]].Cmp(remainders[order[b]]) > 0 })
+	extra := new(big.Int).Sub(exact.Quo(exact, w), floored).Int64()
+	for _, i := range order[:extra] {
+		shares[i].Add(shares[i], big.NewInt(1))
+	}
+
+	result := make([]Money, len(parts))
+	for i, share := range shares {
+		if m.Amount < 0 {
+			share.Neg(share)
+		}
+		if !share.IsInt64() {
+			return nil, fmt.Errorf("%w: share of %s", ErrOutOfRange, m)
+		}
+		result[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+	}
+	return result, nil
+}
+
+// Mul returns m times rate, rounded to whole minor units by mode
+func (m Money) Mul(rate *big.Rat, mode Rounding) (Money, error) {
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate)
+	amount, err := Round(v, mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Percent returns basisPoints hundredths of a percent of m, as a
+// percentage fee is charged, rounded by mode
+func (m Money) Percent(basisPoints int64, mode Rounding) (Money, error) {
+	return m.Mul(big.NewRat(basisPoints, 10000), mode)
+}
+
+// Format renders m in major units with exponent decimal digits, e.g.
+// "1234.50" for 123450 paise, leaving the currency code to the caller
+func (m Money) Format(exponent int) string {
+	sign := ""
+	digits := strconv.FormatInt(m.Amount, 10)
+	if m.Amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if exponent <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
@@ -0,0 +1,247 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"testing/quick"
+)
+
+// quickConfig runs each property on enough inputs to reach the edges
+var quickConfig = &quick.Config{MaxCount: 2000}
+
+// smallWeights turns arbitrary bytes into 1 to 16 weights, some zero
+func smallWeights(raw []uint16) []int64 {
+	if len(raw) == 0 {
+		raw = []uint16{1}
+	}
+	if len(raw) > 16 {
+		raw = raw[:16]
+	}
+	weights := make([]int64, len(raw))
+	for i, w := range raw {
+		weights[i] = int64(w % 1000)
+	}
+	return weights
+}
+
+func TestAllocateKeepsEveryMinorUnit(t *testing.T) {
+	property := func(amount int64, raw []uint16) bool {
+		amount %= 1 << 50
+		weights := smallWeights(raw)
+		m := New(amount, "INR")
+		parts, err := m.Allocate(weights...)
+		var whole int64
+		for _, w := range weights {
+			whole += w
+		}
+		if whole == 0 {
+			return err != nil
+		}
+		if err != nil || len(parts) != len(weights) {
+			return false
+		}
+		sum, err := Sum("INR", parts...)
+		if err != nil || sum != m {
+			return false
+		}
+		// Each part is within one minor unit of its exact share
+		for i, part := range parts {
+			exact := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(amount), big.NewInt(weights[i])), big.NewInt(whole))
+			diff := new(big.Rat).Sub(new(big.Rat).SetInt64(part.Amount), exact)
+			if diff.Abs(diff).Cmp(big.NewRat(1, 1)) >= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitDiffersByAtMostOne(t *testing.T) {
+	property := func(amount int64, n uint8) bool {
+		parts, err := New(amount, "INR").Split(int(n%50) + 1)
+		if err != nil {
+			return false
+		}
+		sum, err := Sum("INR", parts...)
+		if err != nil || sum.Amount != amount {
+			return false
+		}
+		lo, hi := parts[0].Amount, parts[0].Amount
+		for _, p := range parts {
+			lo, hi = min(lo, p.Amount), max(hi, p.Amount)
+		}
+		return hi-lo <= 1
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharesNeverExceedExactTotal(t *testing.T) {
+	property := func(amount uint32, raw []uint16, slack uint16) bool {
+		parts := smallWeights(raw)
+		var sum int64
+		for _, p := range parts {
+			sum += p
+		}
+		// The parts cover some of the whole, as transfers do a payment
+		whole := sum + int64(slack%1000) + 1
+		m := New(int64(amount), "INR")
+		shares, err := m.Shares(whole, parts...)
+		if err != nil {
+			return false
+		}
+		total, _ := Sum("INR", shares...)
+		floor := new(big.Int).Quo(new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(sum)), big.NewInt(whole))
+		if total.Amount != floor.Int64() {
+			return false
+		}
+		for i, share := range shares {
+			// No share is above the ceiling of its exact value
+			ceil := (int64(amount)*parts[i] + whole - 1) / whole
+			if share.Amount < 0 || share.Amount > ceil {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharesOfNegativeAmountMirror(t *testing.T) {
+	pos, err := New(1001, "INR").Allocate(1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	neg, err := New(-1001, "INR").Allocate(1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range pos {
+		if neg[i].Amount != -pos[i].Amount {
+			t.Fatalf("shares of -1001 = %v, want the negation of %v", neg, pos)
+		}
+	}
+}
+
+func TestAddRefusesMixedCurrencies(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want error
+	}{
+		{"same currency", New(100, "INR"), New(50, "inr"), nil},
+		{"mixed", New(100, "INR"), New(50, "USD"), ErrCurrencyMismatch},
+		{"overflow", New(math.MaxInt64, "INR"), New(1, "INR"), ErrOutOfRange},
+		{"underflow", New(math.MinInt64, "INR"), New(-1, "INR"), ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.a.Add(tt.b); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := New(0, "INR").Sub(New(math.MinInt64, "INR")); !errors.Is(err, ErrOutOfRange) {
+		t.Fatalf("0 - MinInt64: err = %v, want ErrOutOfRange", err)
+	}
+}
+
+func TestAddSubRoundTrip(t *testing.T) {
+	property := func(a, b int32) bool {
+		x, y := New(int64(a), "INR"), New(int64(b), "INR")
+		sum, err := x.Add(y)
+		if err != nil {
+			return false
+		}
+		back, err := sum.Sub(y)
+		return err == nil && back == x
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		mode     Rounding
+		want     int64
+	}{
+		{5, 2, RoundHalfUp, 3},
+		{-5, 2, RoundHalfUp, -3},
+		{5, 2, RoundBankers, 2},
+		{7, 2, RoundBankers, 4},
+		{-5, 2, RoundBankers, -2},
+		{7, 3, RoundHalfUp, 2},
+		{8, 3, RoundHalfUp, 3},
+		{7, 3, RoundFloor, 2},
+		{-7, 3, RoundFloor, -3},
+		{7, 3, RoundCeil, 3},
+		{-7, 3, RoundCeil, -2},
+		{6, 3, RoundCeil, 2},
+		{5, 2, "", 3},
+	}
+	for _, tt := range tests {
+		got, err := Round(big.NewRat(tt.num, tt.den), tt.mode)
+		if err != nil || got != tt.want {
+			t.Errorf("Round(%d/%d, %q) = %d, %v, want %d", tt.num, tt.den, tt.mode, got, err, tt.want)
+		}
+	}
+	huge := new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 70))
+	if _, err := Round(huge, RoundHalfUp); !errors.Is(err, ErrOutOfRange) {
+		t.Fatalf("err = %v, want ErrOutOfRange", err)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount, bps int64
+		mode        Rounding
+		want        int64
+	}{
+		// 2% of 1234.56
+		{123456, 200, RoundHalfUp, 2469},
+		// 2.36% of 10.05 is 23.718 paise
+		{1005, 236, RoundHalfUp, 24},
+		{1005, 236, RoundFloor, 23},
+		// 18% of 12.50 is exactly 225 paise
+		{1250, 1800, RoundCeil, 225},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.amount, "INR").Percent(tt.bps, tt.mode)
+		if err != nil || got != New(tt.want, "INR") {
+			t.Errorf("%d bps of %d by %s = %v, %v, want %d", tt.bps, tt.amount, tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		exponent int
+		want     string
+	}{
+		{123450, 2, "1234.50"},
+		{5, 2, "0.05"},
+		{0, 2, "0.00"},
+		{-5, 2, "-0.05"},
+		{-123450, 2, "-1234.50"},
+		{1234, 0, "1234"},
+		{-1234, 0, "-1234"},
+		{1234, 3, "1.234"},
+		{math.MinInt64, 2, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		if got := New(tt.amount, "INR").Format(tt.exponent); got != tt.want {
+			t.Errorf("Format(%d, %d) = %q, want %q", tt.amount, tt.exponent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Rounding is how a fractional amount is brought to whole minor units
+type Rounding string
+
+// Rounding modes. Half-up rounds ties away from zero, so refunds of a
+// negative amount mirror their charges; bankers rounds ties to the even
+// neighbour; floor and ceil round toward negative and positive infinity.
+const (
+	RoundHalfUp  Rounding = "half-up"
+	RoundBankers Rounding = "bankers"
+	RoundFloor   Rounding = "floor"
+	RoundCeil    Rounding = "ceil"
+)
+
+// Round rounds v, in minor units, to a whole number of them by mode;
+// unknown modes round half-up. Every fractional amount is rounded here.
+func Round(v *big.Rat, mode Rounding) (int64, error) {
+	// Euclidean division by the positive denominator floors the quotient
+	// and leaves a remainder in [0, denom)
+	q, r := new(big.Int).DivMod(v.Num(), v.Denom(), new(big.Int))
+	if r.Sign() != 0 {
+		half := new(big.Int).Lsh(r, 1).Cmp(v.Denom())
+		up := false
+		switch mode {
+		case RoundCeil:
+			up = true
+		case RoundFloor:
+		case RoundBankers:
+			up = half > 0 || (half == 0 && q.Bit(0) == 1)
+		default:
+			up = half > 0 || (half == 0 && v.Sign() > 0)
+		}
+		if up {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("%w: %s minor units", ErrOutOfRange, q)
+	}
+	return q.Int64(), nil
+}
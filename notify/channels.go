@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yash170603/golang_payment/canonicaljson"
+)
+
+// Slack posts a one-line summary of each event to an incoming webhook
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *Slack) Name() string { return "slack" }
+
+func (s *Slack) Deliver(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(map[string]string{"text": summary(ev)})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.WebhookURL, body, nil)
+}
+
+// Callback POSTs the event as canonical JSON to a merchant URL. When Secret
+// is set the body is signed in X-Signature as hex HMAC-SHA256.
+type Callback struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (c *Callback) Name() string { return "callback" }
+
+func (c *Callback) Deliver(ctx context.Context, ev Event) error {
+	body, err := canonicaljson.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if c.Secret != "" {
+		h := hmac.New(sha256.New, []byte(c.Secret))
+		h.Write(body)
+		headers["X-Signature"] = hex.EncodeToString(h.Sum(nil))
+	}
+	return post(ctx, c.Client, c.URL, body, headers)
+}
+
+// Email sends a plain-text message per event over SMTP, upgrading to TLS
+// when the server offers STARTTLS
+type Email struct {
+	// Addr is the SMTP server as host:port
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// Senders overrides From for events of the brands it names
+	Senders map[string]string
+	To      []string
+}
+
+func (e *Email) Name() string { return "email" }
+
+func (e *Email) Deliver(ctx context.Context, ev Event) error {
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(nil); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, host)); err != nil {
+			return err
+		}
+	}
+	from := e.sender(ev)
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		from, strings.Join(e.To, ", "), summary(ev), ev.OccurredAt.Format(time.RFC1123Z), summary(ev))
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// sender is the From address for ev, its brand's when it has one
+func (e *Email) sender(ev Event) string {
+	if brand, _ := ev.Data["brand"].(string); brand != "" {
+		if from, ok := e.Senders[brand]; ok {
+			return from
+		}
+	}
+	return e.From
+}
+
+// summary renders ev as one human-readable line
+func summary(ev Event) string {
+	return fmt.Sprintf("[%s] %s at %s", ev.Type, ev.Subject, ev.OccurredAt.Format(time.RFC3339))
+}
+
+// post sends body as JSON and treats any non-2xx status as a failure
+func post(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Probe connects to the webhook host without posting anything
+func (s *Slack) Probe(ctx context.Context) error { return dialURL(ctx, s.WebhookURL) }
+
+// Probe connects to the callback host without posting anything
+func (c *Callback) Probe(ctx context.Context) error { return dialURL(ctx, c.URL) }
+
+// Probe opens an SMTP session and quits without sending mail
+func (e *Email) Probe(ctx context.Context) error {
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
+
+// dialURL opens and closes a TCP connection to the host of rawURL
+func dialURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
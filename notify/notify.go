@@ -0,0 +1,384 @@
+// Package notify fans business events out to notification channels. Each
+// channel consumes from its own bounded queue and retries independently, so
+// one failing destination never delays the others.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// Event types published by the service
+const (
+	EventPaymentVerified = "payment.verified"
+	EventRefundProcessed = "refund.processed"
+	EventDisputeCreated  = "dispute.created"
+	// EventExpiryReversed is an expired order paid by a late payment
+	EventExpiryReversed = "order.expiry_reversed"
+	// EventOrderPaid is sent to an order's fulfillment URL
+	EventOrderPaid = "order.paid"
+	// EventWebhookDrift is the Razorpay webhook no longer matching the
+	// configuration this service expects
+	EventWebhookDrift = "webhook.drift"
+	// EventOrderCreated is every order created, whether or not it is paid
+	EventOrderCreated = "order.created"
+	// Refunds above the approval threshold wait for a second admin
+	EventRefundApprovalRequested = "refund.approval_requested"
+	EventRefundApproved          = "refund.approved"
+	EventRefundRejected          = "refund.rejected"
+	// EventPaymentRecovery carries a fresh checkout link for the customer
+	// of an order whose payment failed recoverably
+	EventPaymentRecovery = "payment.recovery"
+)
+
+const (
+	maxBackoff            = time.Minute
+	defaultQueueSize      = 100
+	defaultMaxAttempts    = 5
+	defaultBackoff        = time.Second
+	defaultDeliverTimeout = 10 * time.Second
+)
+
+// Event is something that happened, published once to every channel
+type Event struct {
+	Type string `json:"type"`
+	// Subject is the ID of the entity the event is about, e.g. a payment ID
+	Subject    string                 `json:"subject"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	// Headers are the allow-listed headers of the request that caused the
+	// event, keyed by canonical name
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type headersKey struct{}
+
+// WithHeaders returns a copy of ctx carrying the request headers to attach
+// to events published while handling it
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// Headers returns the headers recorded by WithHeaders, if any
+func Headers(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
+
+// Channel delivers events to one destination
+type Channel interface {
+	// Name labels the channel in health reports and metrics
+	Name() string
+	Deliver(ctx context.Context, ev Event) error
+}
+
+// Prober is implemented by channels that can check their destination is
+// reachable without delivering anything
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Options tunes every channel's queue and retry policy; zero values take
+// the defaults
+type Options struct {
+	QueueSize   int
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling up to a minute
+	Backoff time.Duration
+	// DeliverTimeout bounds a single delivery attempt
+	DeliverTimeout time.Duration
+}
+
+// ChannelHealth reports how a channel is keeping up
+type ChannelHealth struct {
+	Name                string     `json:"name"`
+	QueueDepth          int        `json:"queue_depth"`
+	QueueSize           int        `json:"queue_size"`
+	Delivered           int        `json:"delivered"`
+	Failed              int        `json:"failed"`
+	Dropped             int        `json:"dropped"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// Notifier publishes events to its channels. A nil Notifier discards them.
+type Notifier struct {
+	opts   Options
+	queues []*queue
+	// runners deliver each channel's queue
+	runners *runner.Manager
+	// stop aborts retries and in-flight deliveries once shutdown times out
+	stop   context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// queue is one channel's backlog and delivery record
+type queue struct {
+	channel Channel
+	events  chan Event
+
+	mu     sync.Mutex
+	health ChannelHealth
+}
+
+// New starts a worker per channel. Workers drain their queue rather than
+// stopping when cancelled; Shutdown closes the queues.
+func New(opts Options, channels ...Channel) *Notifier {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	if opts.DeliverTimeout <= 0 {
+		opts.DeliverTimeout = defaultDeliverTimeout
+	}
+
+	n := &Notifier{opts: opts, runners: runner.New()}
+	n.stop, n.cancel = context.WithCancel(context.Background())
+	for _, ch := range channels {
+		q := &queue{
+			channel: ch,
+			events:  make(chan Event, opts.QueueSize),
+			health:  ChannelHealth{Name: ch.Name(), QueueSize: opts.QueueSize},
+		}
+		n.queues = append(n.queues, q)
+		n.runners.Add("notify-"+ch.Name(), runner.Func(func(context.Context) error {
+			n.run(q)
+			return nil
+		}))
+	}
+	n.runners.Start(context.Background())
+	return n
+}
+
+// Outcomes of queueing an event on a channel
+const (
+	Queued  = "queued"
+	Dropped = "dropped"
+)
+
+// Publish queues ev on every channel without blocking. A channel whose queue
+// is full drops the event and counts it.
+func (n *Notifier) Publish(ev Event) {
+	n.Enqueue(ev)
+}
+
+// OrderCreatedEvent describes a newly created order
+type OrderCreatedEvent struct {
+	OrderID  string
+	Amount   int
+	Currency string
+	Notes    map[string]string
+	// Brand is the brand the order is sold under, empty for none
+	Brand string
+}
+
+// OrderCreated publishes ev like Publish, without blocking the order it
+// describes
+func (n *Notifier) OrderCreated(ctx context.Context, ev OrderCreatedEvent) {
+	n.Publish(Event{
+		Type:    EventOrderCreated,
+		Subject: ev.OrderID,
+		Data: map[string]interface{}{
+			"order_id": ev.OrderID,
+			"amount":   ev.Amount,
+			"currency": ev.Currency,
+			"notes":    ev.Notes,
+			"brand":    ev.Brand,
+		},
+		Headers: Headers(ctx),
+	})
+}
+
+// Enqueue is Publish returning each channel's outcome, Queued or Dropped.
+// Delivery itself happens later and shows in Health.
+func (n *Notifier) Enqueue(ev Event) map[string]string {
+	outcomes := map[string]string{}
+	if n == nil {
+		return outcomes
+	}
+	if ev.OccurredAt.IsZero() {
+		ev.OccurredAt = time.Now()
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		log.Printf("Dropping %s event for %s: notifier is shut down", ev.Type, ev.Subject)
+		for _, q := range n.queues {
+			outcomes[q.channel.Name()] = Dropped
+		}
+		return outcomes
+	}
+	for _, q := range n.queues {
+		select {
+		case q.events <- ev:
+			outcomes[q.channel.Name()] = Queued
+		default:
+			log.Printf("Notification channel %s is full, dropping %s event for %s", q.channel.Name(), ev.Type, ev.Subject)
+			q.record(func(h *ChannelHealth) { h.Dropped++ })
+			metrics.NotifyDeliveries.WithLabelValues(q.channel.Name(), "dropped").Inc()
+			outcomes[q.channel.Name()] = Dropped
+		}
+		metrics.NotifyQueueDepth.WithLabelValues(q.channel.Name()).Set(float64(len(q.events)))
+	}
+	return outcomes
+}
+
+// run delivers one channel's events in order
+func (n *Notifier) run(q *queue) {
+	name := q.channel.Name()
+	for ev := range q.events {
+		metrics.NotifyQueueDepth.WithLabelValues(name).Set(float64(len(q.events)))
+
+		err := n.deliver(q.channel, ev)
+		now := time.Now()
+		if err != nil {
+			log.Printf("Notification channel %s gave up on %s event for %s: %v", name, ev.Type, ev.Subject, err)
+			metrics.NotifyDeliveries.WithLabelValues(name, "failed").Inc()
+			q.record(func(h *ChannelHealth) {
+				h.Failed++
+				h.ConsecutiveFailures++
+				h.LastFailure = &now
+				h.LastError = err.Error()
+			})
+		} else {
+			metrics.NotifyDeliveries.WithLabelValues(name, "delivered").Inc()
+			q.record(func(h *ChannelHealth) {
+				h.Delivered++
+				h.ConsecutiveFailures = 0
+				h.LastSuccess = &now
+			})
+		}
+		metrics.NotifyConsecutiveFailures.WithLabelValues(name).Set(float64(q.snapshot().ConsecutiveFailures))
+	}
+}
+
+// permanentError is a delivery failure retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure retrying cannot fix, so the event is
+// given up on after the first attempt
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// deliver attempts ev up to MaxAttempts times with exponential backoff
+func (n *Notifier) deliver(ch Channel, ev Event) error {
+	backoff := n.opts.Backoff
+	var err error
+	for attempt := 1; attempt <= n.opts.MaxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(n.stop, n.opts.DeliverTimeout)
+		err = ch.Deliver(ctx, ev)
+		cancel()
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return fmt.Errorf("not retried: %w", err)
+		}
+		if err == nil || attempt == n.opts.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-n.stop.Done():
+			return fmt.Errorf("shutting down after %d attempts: %w", attempt, err)
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+	if err != nil {
+		return fmt.Errorf("after %d attempts: %w", n.opts.MaxAttempts, err)
+	}
+	return nil
+}
+
+func (q *queue) record(fn func(*ChannelHealth)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fn(&q.health)
+}
+
+func (q *queue) snapshot() ChannelHealth {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	h := q.health
+	h.QueueDepth = len(q.events)
+	return h
+}
+
+// Health reports every channel's state
+func (n *Notifier) Health() []ChannelHealth {
+	if n == nil {
+		return []ChannelHealth{}
+	}
+	health := make([]ChannelHealth, 0, len(n.queues))
+	for _, q := range n.queues {
+		health = append(health, q.snapshot())
+	}
+	return health
+}
+
+// Probe checks every channel implementing Prober, returning each one's
+// error by name; nil for those that are reachable
+func (n *Notifier) Probe(ctx context.Context) map[string]error {
+	results := map[string]error{}
+	if n == nil {
+		return results
+	}
+	for _, q := range n.queues {
+		if p, ok := q.channel.(Prober); ok {
+			results[q.channel.Name()] = p.Probe(ctx)
+		}
+	}
+	return results
+}
+
+// Shutdown stops accepting events and waits for queued ones to be
+// delivered. When ctx is done first, pending retries are abandoned.
+func (n *Notifier) Shutdown(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, q := range n.queues {
+			close(q.events)
+		}
+	}
+	n.mu.Unlock()
+
+	if err := n.runners.Stop(ctx); err != nil {
+		n.cancel()
+		n.runners.Wait()
+		return fmt.Errorf("notification queues not drained: %w", err)
+	}
+	return nil
+}
+
+// Runners reports the state of each channel's worker
+func (n *Notifier) Runners() []runner.Status {
+	if n == nil {
+		return nil
+	}
+	return n.runners.Status()
+}
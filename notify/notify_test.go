@@ -0,0 +1,227 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// fakeChannel records the events it delivers. fail, when set, decides
+// each attempt's error; hang makes Deliver wait for its context instead.
+type fakeChannel struct {
+	name string
+	hang bool
+
+	mu        sync.Mutex
+	fail      func(attempt int) error
+	attempts  int
+	delivered []Event
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Deliver(ctx context.Context, ev Event) error {
+	if c.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.fail != nil {
+		if err := c.fail(c.attempts); err != nil {
+			return err
+		}
+	}
+	c.delivered = append(c.delivered, ev)
+	return nil
+}
+
+func (c *fakeChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.delivered)
+}
+
+// newTestNotifier starts a notifier over channels, shut down with the test
+func newTestNotifier(t *testing.T, opts Options, channels ...Channel) *Notifier {
+	t.Helper()
+	n := New(opts, channels...)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = n.Shutdown(ctx)
+	})
+	return n
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// health returns the health of the channel called name
+func health(n *Notifier, name string) ChannelHealth {
+	for _, h := range n.Health() {
+		if h.Name == name {
+			return h
+		}
+	}
+	return ChannelHealth{}
+}
+
+func TestDeadChannelDoesNotBlockOthers(t *testing.T) {
+	tests := []struct {
+		name string
+		dead *fakeChannel
+	}{
+		{"hanging", &fakeChannel{name: "email-hang", hang: true}},
+		{"failing", &fakeChannel{name: "email-fail", fail: func(int) error { return errors.New("connection refused") }}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slack := &fakeChannel{name: "slack-" + tt.name}
+			callback := &fakeChannel{name: "callback-" + tt.name}
+			delivered := metrics.NotifyDeliveries.WithLabelValues(callback.name, "delivered")
+			before := testutil.ToFloat64(delivered)
+			n := newTestNotifier(t, Options{QueueSize: 5, MaxAttempts: 3, Backoff: time.Millisecond, DeliverTimeout: time.Hour}, tt.dead, slack, callback)
+
+			const events = 20
+			for i := 0; i < events; i++ {
+				n.Publish(Event{Type: EventPaymentVerified, Subject: "pay_1"})
+				// Give the healthy channels the chance to keep up, as real
+				// traffic would; the dead one's queue fills regardless
+				waitFor(t, "healthy delivery", func() bool { return slack.count() == i+1 && callback.count() == i+1 })
+			}
+
+			if h := health(n, slack.name); h.Delivered != events || h.ConsecutiveFailures != 0 || h.LastSuccess == nil {
+				t.Fatalf("slack health = %+v, want %d delivered", h, events)
+			}
+			if got := testutil.ToFloat64(delivered) - before; got != events {
+				t.Fatalf("callback delivered metric = %v, want %d", got, events)
+			}
+			if h := health(n, tt.dead.name); h.Delivered != 0 {
+				t.Fatalf("dead channel health = %+v, want nothing delivered", h)
+			}
+		})
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         func(attempt int) error
+		wantAttempts int
+		wantFailed   int
+	}{
+		{"first attempt", nil, 1, 0},
+		{"recovers", func(attempt int) error {
+			if attempt < 3 {
+				return errors.New("503")
+			}
+			return nil
+		}, 3, 0},
+		{"gives up", func(int) error { return errors.New("503") }, 4, 1},
+		{"permanent", func(int) error { return Permanent(errors.New("400")) }, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &fakeChannel{name: "retry-" + tt.name, fail: tt.fail}
+			n := newTestNotifier(t, Options{MaxAttempts: 4, Backoff: time.Millisecond}, ch)
+			n.Publish(Event{Type: EventRefundProcessed, Subject: "rfnd_1"})
+
+			waitFor(t, "the event to settle", func() bool {
+				h := health(n, ch.name)
+				return h.Delivered+h.Failed == 1
+			})
+			h := health(n, ch.name)
+			if ch.attempts != tt.wantAttempts || h.Failed != tt.wantFailed || h.ConsecutiveFailures != tt.wantFailed {
+				t.Fatalf("attempts = %d, health = %+v, want %d attempts and %d failed", ch.attempts, h, tt.wantAttempts, tt.wantFailed)
+			}
+			if tt.wantFailed > 0 && (h.LastError == "" || h.LastFailure == nil) {
+				t.Fatalf("health = %+v, want the last failure recorded", h)
+			}
+		})
+	}
+}
+
+func TestFullQueueDrops(t *testing.T) {
+	ch := &fakeChannel{name: "full", hang: true}
+	n := newTestNotifier(t, Options{QueueSize: 2, DeliverTimeout: time.Hour}, ch)
+
+	// One event is held by the hanging delivery, two fill the queue
+	n.Publish(Event{Type: EventDisputeCreated, Subject: "disp_0"})
+	waitFor(t, "the worker to take the first event", func() bool { return health(n, ch.name).QueueDepth == 0 })
+	for i := 0; i < 2; i++ {
+		if got := n.Enqueue(Event{Type: EventDisputeCreated})[ch.name]; got != Queued {
+			t.Fatalf("event %d: outcome = %s, want %s", i, got, Queued)
+		}
+	}
+	if got := n.Enqueue(Event{Type: EventDisputeCreated})[ch.name]; got != Dropped {
+		t.Fatalf("outcome = %s, want %s", got, Dropped)
+	}
+	if h := health(n, ch.name); h.Dropped != 1 || h.QueueDepth != 2 {
+		t.Fatalf("health = %+v, want 1 dropped and 2 queued", h)
+	}
+}
+
+func TestShutdownDrainsQueues(t *testing.T) {
+	ch := &fakeChannel{name: "drain"}
+	n := New(Options{}, ch)
+	for i := 0; i < 10; i++ {
+		n.Publish(Event{Type: EventPaymentVerified})
+	}
+	if err := n.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ch.count() != 10 {
+		t.Fatalf("delivered %d before shutdown returned, want 10", ch.count())
+	}
+	if got := n.Enqueue(Event{Type: EventPaymentVerified})[ch.name]; got != Dropped {
+		t.Fatalf("after shutdown: outcome = %s, want %s", got, Dropped)
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	n.Publish(Event{Type: EventPaymentVerified})
+	n.OrderCreated(context.Background(), OrderCreatedEvent{OrderID: "order_1"})
+	if h := n.Health(); len(h) != 0 {
+		t.Fatalf("health = %v, want none", h)
+	}
+	if err := n.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailSender(t *testing.T) {
+	e := &Email{From: "payments@example.com", Senders: map[string]string{"acme": "orders@acme.example.com"}}
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"brand with a sender", map[string]interface{}{"brand": "acme"}, "orders@acme.example.com"},
+		{"brand without a sender", map[string]interface{}{"brand": "zed"}, "payments@example.com"},
+		{"no brand", map[string]interface{}{"brand": ""}, "payments@example.com"},
+		{"no data", nil, "payments@example.com"},
+	}
+	for _, tt := range tests {
+		if got := e.sender(Event{Type: EventPaymentVerified, Data: tt.data}); got != tt.want {
+			t.Errorf("%s: sender = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
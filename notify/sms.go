@@ -0,0 +1,480 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/money"
+)
+
+// SMS errors
+var (
+	ErrSMSContact    = errors.New("invalid SMS contact")
+	ErrSMSTooLong    = errors.New("SMS exceeds the segment limit")
+	ErrSMSTemplate   = errors.New("SMS template failed to render")
+	ErrSMSStatusAuth = errors.New("SMS status callback is not authenticated")
+	// ErrSMSStatusMalformed is a status callback the provider could not
+	// have sent
+	ErrSMSStatusMalformed = errors.New("malformed SMS status callback")
+)
+
+// SMS message states. Delivered and failed are final; suppressed and
+// rejected messages were never handed to the provider.
+const (
+	SMSSent       = "sent"
+	SMSDelivered  = "delivered"
+	SMSFailed     = "failed"
+	SMSSuppressed = "suppressed"
+	SMSRejected   = "rejected"
+)
+
+const (
+	defaultSMSMaxSegments = 3
+	defaultSMSRateLimit   = 10
+	// smsRecordLimit is how many messages are kept for status callbacks
+	// and operators; older ones are forgotten
+	smsRecordLimit = 1000
+)
+
+// SMSMessage is one text to send
+type SMSMessage struct {
+	// To is the E.164 number, e.g. +919876543210
+	To   string
+	Body string
+	// TemplateID is the DLT template the body was registered as, required
+	// by Indian operators on some routes; empty when there is none
+	TemplateID string
+}
+
+// SMSStatus is a delivery report for a sent message
+type SMSStatus struct {
+	MessageID string
+	// Status is SMSSent, SMSDelivered or SMSFailed
+	Status string
+	Error  string
+}
+
+// SMSProvider sends texts through an SMS gateway
+type SMSProvider interface {
+	// Name labels the provider in records and metrics
+	Name() string
+	// Send hands msg to the gateway and returns the gateway's message ID
+	Send(ctx context.Context, msg SMSMessage) (string, error)
+	// ParseStatus authenticates and decodes a delivery report posted by
+	// the gateway
+	ParseStatus(r *http.Request) ([]SMSStatus, error)
+}
+
+// SMSTemplate is the text sent for one event type. Body is a text/template
+// over the event's data, plus .subject and .type; {{major .amount}} writes
+// a minor-unit amount in major units.
+type SMSTemplate struct {
+	Body          string `json:"body"`
+	DLTTemplateID string `json:"dlt_template_id,omitempty"`
+}
+
+// LoadSMSTemplates reads a JSON object of templates keyed by event type
+// from path
+func LoadSMSTemplates(path string) (map[string]SMSTemplate, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var templates map[string]SMSTemplate
+	if err := json.Unmarshal(raw, &templates); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return templates, nil
+}
+
+// SMSOptions configures an SMS channel; zero values take the defaults
+type SMSOptions struct {
+	Templates map[string]SMSTemplate
+	// MaxSegments is the most segments a message may take; longer ones
+	// are not sent
+	MaxSegments int
+	// RateLimit is the most messages handed to the provider per second
+	RateLimit int
+	// CountryCode is prefixed to contacts given without one, e.g. "91"
+	CountryCode string
+	// Suppressed are the contacts that opted out of texts
+	Suppressed []string
+}
+
+// SMSRecord is a text the channel sent or chose not to send. The number
+// is masked, as records are shown to operators.
+type SMSRecord struct {
+	MessageID string    `json:"message_id,omitempty"`
+	Provider  string    `json:"provider"`
+	To        string    `json:"to"`
+	Event     string    `json:"event"`
+	Subject   string    `json:"subject"`
+	Segments  int       `json:"segments,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SMS texts the customer of an event through provider, for the event
+// types that have a template. The customer is the event's contact; events
+// without one, and contacts on the suppression list, are skipped.
+type SMS struct {
+	provider    SMSProvider
+	templates   map[string]smsTemplate
+	maxSegments int
+	countryCode string
+	pace        pacer
+
+	mu         sync.Mutex
+	suppressed map[string]bool
+	records    []*SMSRecord
+	byID       map[string]*SMSRecord
+}
+
+type smsTemplate struct {
+	body       *template.Template
+	templateID string
+}
+
+// NewSMS returns an SMS channel sending through provider
+func NewSMS(provider SMSProvider, opts SMSOptions) (*SMS, error) {
+	if opts.MaxSegments <= 0 {
+		opts.MaxSegments = defaultSMSMaxSegments
+	}
+	if opts.RateLimit <= 0 {
+		opts.RateLimit = defaultSMSRateLimit
+	}
+
+	s := &SMS{
+		provider:    provider,
+		templates:   make(map[string]smsTemplate, len(opts.Templates)),
+		maxSegments: opts.MaxSegments,
+		countryCode: opts.CountryCode,
+		pace:        pacer{interval: time.Second / time.Duration(opts.RateLimit)},
+		suppressed:  make(map[string]bool),
+		byID:        make(map[string]*SMSRecord),
+	}
+	for event, t := range opts.Templates {
+		body, err := template.New(event).Funcs(smsFuncs).Option("missingkey=error").Parse(t.Body)
+		if err != nil {
+			return nil, fmt.Errorf("SMS template %s: %w", event, err)
+		}
+		s.templates[event] = smsTemplate{body: body, templateID: t.DLTTemplateID}
+	}
+	for _, contact := range opts.Suppressed {
+		if err := s.Suppress(contact); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+var smsFuncs = template.FuncMap{
+	// major writes minor units as major units of a two-decimal currency
+	"major": func(amount interface{}) (string, error) {
+		switch v := amount.(type) {
+		case int:
+			return majorUnits(int64(v)), nil
+		case int64:
+			return majorUnits(v), nil
+		case float64:
+			// Amounts decoded from JSON; minor units are always whole
+			if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+				return "", fmt.Errorf("amount %v is not a whole number of minor units", v)
+			}
+			return majorUnits(int64(v)), nil
+		}
+		return "", fmt.Errorf("amount %v is not a number", amount)
+	},
+}
+
+// majorUnits formats minor units with two decimals, in integer arithmetic
+// so no amount is rounded on the way
+func majorUnits(amount int64) string {
+	return money.New(amount, "").Format(2)
+}
+
+func (s *SMS) Name() string { return "sms" }
+
+func (s *SMS) Deliver(ctx context.Context, ev Event) error {
+	tmpl, ok := s.templates[ev.Type]
+	if !ok {
+		return nil
+	}
+	contact, _ := ev.Data["contact"].(string)
+	if contact == "" {
+		return nil
+	}
+	to, err := s.phone(contact)
+	if err != nil {
+		return Permanent(err)
+	}
+	rec := &SMSRecord{Provider: s.provider.Name(), To: maskPhone(to), Event: ev.Type, Subject: ev.Subject}
+
+	s.mu.Lock()
+	suppressed := s.suppressed[to]
+	s.mu.Unlock()
+	if suppressed {
+		s.record(rec, SMSSuppressed, "")
+		return nil
+	}
+
+	body, err := s.render(tmpl, ev)
+	if err != nil {
+		s.record(rec, SMSRejected, err.Error())
+		return Permanent(err)
+	}
+	rec.Segments = smsSegments(body)
+	if rec.Segments > s.maxSegments {
+		err := fmt.Errorf("%w: %s takes %d segments, at most %d allowed", ErrSMSTooLong, ev.Type, rec.Segments, s.maxSegments)
+		s.record(rec, SMSRejected, err.Error())
+		return Permanent(err)
+	}
+
+	if err := s.pace.wait(ctx); err != nil {
+		return err
+	}
+	id, err := s.provider.Send(ctx, SMSMessage{To: to, Body: body, TemplateID: tmpl.templateID})
+	if err != nil {
+		return err
+	}
+	rec.MessageID = id
+	s.record(rec, SMSSent, "")
+	return nil
+}
+
+// render fills the template with the event's data
+func (s *SMS) render(tmpl smsTemplate, ev Event) (string, error) {
+	data := make(map[string]interface{}, len(ev.Data)+2)
+	for k, v := range ev.Data {
+		data[k] = v
+	}
+	data["subject"] = ev.Subject
+	data["type"] = ev.Type
+
+	var b strings.Builder
+	if err := tmpl.body.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSMSTemplate, err)
+	}
+	body := strings.TrimSpace(b.String())
+	if body == "" {
+		return "", fmt.Errorf("%w: %s rendered an empty message", ErrSMSTemplate, ev.Type)
+	}
+	return body, nil
+}
+
+// record adds rec to the log in state
+func (s *SMS) record(rec *SMSRecord, state, reason string) {
+	now := time.Now()
+	rec.Status, rec.Error = state, reason
+	rec.CreatedAt, rec.UpdatedAt = now, now
+	metrics.SMSMessages.WithLabelValues(rec.Provider, state).Inc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) == smsRecordLimit {
+		delete(s.byID, s.records[0].MessageID)
+		s.records = s.records[1:]
+	}
+	s.records = append(s.records, rec)
+	if rec.MessageID != "" {
+		s.byID[rec.MessageID] = rec
+	}
+}
+
+// HandleStatus applies a delivery report posted by the provider and
+// returns how many of the messages it reports were known. A message's
+// final state is not changed by later, out-of-order reports.
+func (s *SMS) HandleStatus(r *http.Request) (int, error) {
+	statuses, err := s.provider.ParseStatus(r)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	matched := 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range statuses {
+		rec, ok := s.byID[st.MessageID]
+		if !ok {
+			continue
+		}
+		matched++
+		if rec.Status == SMSDelivered || rec.Status == SMSFailed || rec.Status == st.Status {
+			continue
+		}
+		rec.Status, rec.Error, rec.UpdatedAt = st.Status, st.Error, now
+		metrics.SMSMessages.WithLabelValues(rec.Provider, st.Status).Inc()
+	}
+	return matched, nil
+}
+
+// Messages returns the recorded messages, newest first
+func (s *SMS) Messages() []SMSRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]SMSRecord, len(s.records))
+	for i, rec := range s.records {
+		messages[len(s.records)-1-i] = *rec
+	}
+	return messages
+}
+
+// Suppress adds contact to the suppression list, so it is never texted
+func (s *SMS) Suppress(contact string) error {
+	to, err := s.phone(contact)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suppressed[to] = true
+	return nil
+}
+
+// Unsuppress removes contact from the suppression list
+func (s *SMS) Unsuppress(contact string) error {
+	to, err := s.phone(contact)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.suppressed, to)
+	return nil
+}
+
+// Suppressed lists the suppressed numbers, sorted
+func (s *SMS) Suppressed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	numbers := make([]string, 0, len(s.suppressed))
+	for n := range s.suppressed {
+		numbers = append(numbers, n)
+	}
+	sort.Strings(numbers)
+	return numbers
+}
+
+// phone normalizes contact to E.164. Separators are dropped, and numbers
+// without a leading + or international prefix that are short enough to be
+// national get the channel's country code.
+func (s *SMS) phone(contact string) (string, error) {
+	var digits strings.Builder
+	international := false
+	for i, r := range strings.TrimSpace(contact) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case strings.ContainsRune(" -().", r):
+		default:
+			return "", fmt.Errorf("%w: %q", ErrSMSContact, contact)
+		}
+	}
+	number := digits.String()
+	if !international {
+		number = strings.TrimLeft(number, "0")
+		if len(number) <= 10 {
+			number = s.countryCode + number
+		}
+	}
+	if len(number) < 8 || len(number) > 15 {
+		return "", fmt.Errorf("%w: %q", ErrSMSContact, contact)
+	}
+	return "+" + number, nil
+}
+
+// maskPhone keeps the country code and last four digits of an E.164 number
+func maskPhone(number string) string {
+	if len(number) <= 7 {
+		return number
+	}
+	return number[:3] + strings.Repeat("*", len(number)-7) + number[len(number)-4:]
+}
+
+// gsm7 is the GSM 03.38 basic character set, one septet each, and
+// gsm7Extended the characters taking an escape septet too
+const (
+	gsm7 = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "^{}\\[~]|€"
+)
+
+// smsSegments returns how many segments body is sent as: 160 septets fit
+// one GSM-7 message and 153 each part of a longer one; with any character
+// outside GSM-7 the body goes as UCS-2, 70 code units, or 67 per part.
+func smsSegments(body string) int {
+	septets, units := 0, 0
+	gsm := true
+	for _, r := range body {
+		// Runes outside the Basic Multilingual Plane take a surrogate pair
+		units++
+		if r > 0xFFFF {
+			units++
+		}
+		switch {
+		case strings.ContainsRune(gsm7, r):
+			septets++
+		case strings.ContainsRune(gsm7Extended, r):
+			septets += 2
+		default:
+			gsm = false
+		}
+	}
+	single, part, n := 160, 153, septets
+	if !gsm {
+		single, part, n = 70, 67, units
+	}
+	if n <= single {
+		return 1
+	}
+	return (n + part - 1) / part
+}
+
+// pacer spaces calls at least interval apart
+type pacer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the caller's turn, or ctx is done
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,257 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Twilio sends texts through the Twilio Messages API. Indian DLT templates
+// are matched by Twilio from the registered body, so TemplateID is unused.
+type Twilio struct {
+	AccountSID string
+	AuthToken  string
+	// From is the sending number; MessagingServiceSID may be set instead
+	From                string
+	MessagingServiceSID string
+	// StatusCallbackURL is the public URL of the status callback endpoint.
+	// It is passed with every message, and Twilio's signature over status
+	// reports covers it, so reports are refused while it is unset.
+	StatusCallbackURL string
+	// BaseURL overrides https://api.twilio.com, for tests
+	BaseURL string
+	Client  *http.Client
+}
+
+func (t *Twilio) Name() string { return "twilio" }
+
+func (t *Twilio) Send(ctx context.Context, msg SMSMessage) (string, error) {
+	form := url.Values{"To": {msg.To}, "Body": {msg.Body}}
+	if t.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", t.MessagingServiceSID)
+	} else {
+		form.Set("From", t.From)
+	}
+	if t.StatusCallbackURL != "" {
+		form.Set("StatusCallback", t.StatusCallbackURL)
+	}
+
+	base := t.BaseURL
+	if base == "" {
+		base = "https://api.twilio.com"
+	}
+	endpoint := base + "/2010-04-01/Accounts/" + url.PathEscape(t.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+
+	var reply struct {
+		SID string `json:"sid"`
+	}
+	if err := sendSMSRequest(t.Client, req, &reply); err != nil {
+		return "", err
+	}
+	if reply.SID == "" {
+		return "", fmt.Errorf("twilio returned no message SID")
+	}
+	return reply.SID, nil
+}
+
+// ParseStatus checks X-Twilio-Signature, the base64 HMAC-SHA1 of the
+// callback URL followed by each form field and value in key order
+func (t *Twilio) ParseStatus(r *http.Request) ([]SMSStatus, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSMSStatusMalformed, err)
+	}
+	if t.StatusCallbackURL == "" {
+		return nil, ErrSMSStatusAuth
+	}
+	signed := t.StatusCallbackURL
+	keys := make([]string, 0, len(r.PostForm))
+	for k := range r.PostForm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range r.PostForm[k] {
+			signed += k + v
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(t.AuthToken))
+	mac.Write([]byte(signed))
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get("X-Twilio-Signature"))) {
+		return nil, ErrSMSStatusAuth
+	}
+
+	id := r.PostForm.Get("MessageSid")
+	if id == "" {
+		return nil, fmt.Errorf("%w: no MessageSid", ErrSMSStatusMalformed)
+	}
+	st := SMSStatus{MessageID: id, Status: SMSSent}
+	switch r.PostForm.Get("MessageStatus") {
+	case "delivered":
+		st.Status = SMSDelivered
+	case "failed", "undelivered":
+		st.Status = SMSFailed
+		st.Error = "twilio error " + r.PostForm.Get("ErrorCode")
+	}
+	return []SMSStatus{st}, nil
+}
+
+// MSG91 sends texts through the MSG91 SendSMS API
+type MSG91 struct {
+	AuthKey  string
+	SenderID string
+	// Route is the MSG91 route, "4" for transactional
+	Route string
+	// StatusToken must be the token query parameter of the delivery report
+	// URL set up in MSG91, which does not sign its reports. Reports are
+	// refused while it is unset.
+	StatusToken string
+	// BaseURL overrides https://api.msg91.com, for tests
+	BaseURL string
+	Client  *http.Client
+}
+
+func (m *MSG91) Name() string { return "msg91" }
+
+func (m *MSG91) Send(ctx context.Context, msg SMSMessage) (string, error) {
+	payload := map[string]interface{}{
+		"sender":  m.SenderID,
+		"route":   m.Route,
+		"country": "0",
+		"sms": []map[string]interface{}{{
+			"message": msg.Body,
+			"to":      []string{strings.TrimPrefix(msg.To, "+")},
+		}},
+	}
+	if msg.TemplateID != "" {
+		payload["DLT_TE_ID"] = msg.TemplateID
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	base := m.BaseURL
+	if base == "" {
+		base = "https://api.msg91.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/v2/sendsms", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("authkey", m.AuthKey)
+
+	// The request ID is also what delivery reports are keyed by
+	var reply struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if err := sendSMSRequest(m.Client, req, &reply); err != nil {
+		return "", err
+	}
+	if reply.Type != "success" {
+		return "", Permanent(fmt.Errorf("msg91 refused the message: %s", reply.Message))
+	}
+	return reply.Message, nil
+}
+
+// msg91Failed are the MSG91 report codes of messages that will not be
+// delivered: failed, DND, rejected, blocked and the like
+var msg91Failed = map[string]bool{"2": true, "9": true, "16": true, "17": true, "25": true, "26": true}
+
+// ParseStatus decodes an MSG91 delivery report, a JSON array posted as the
+// data form field or as the body
+func (m *MSG91) ParseStatus(r *http.Request) ([]SMSStatus, error) {
+	if m.StatusToken == "" || !hmac.Equal([]byte(r.URL.Query().Get("token")), []byte(m.StatusToken)) {
+		return nil, ErrSMSStatusAuth
+	}
+
+	var raw []byte
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/json" {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSMSStatusMalformed, err)
+		}
+		raw = body
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSMSStatusMalformed, err)
+		}
+		raw = []byte(r.PostForm.Get("data"))
+	}
+
+	var reports []struct {
+		RequestID string `json:"requestId"`
+		Numbers   []struct {
+			Status string `json:"status"`
+			Desc   string `json:"desc"`
+		} `json:"numbers"`
+	}
+	if err := json.Unmarshal(raw, &reports); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSMSStatusMalformed, err)
+	}
+	var statuses []SMSStatus
+	for _, report := range reports {
+		// Messages are sent to one number each
+		if report.RequestID == "" || len(report.Numbers) == 0 {
+			continue
+		}
+		n := report.Numbers[0]
+		st := SMSStatus{MessageID: report.RequestID, Status: SMSSent}
+		switch {
+		case n.Status == "1":
+			st.Status = SMSDelivered
+		case msg91Failed[n.Status]:
+			st.Status, st.Error = SMSFailed, n.Desc
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// sendSMSRequest sends req and decodes the JSON reply into v. Client
+// errors other than 429 are permanent, as resending the same message
+// would be refused again.
+func sendSMSRequest(client *http.Client, req *http.Request, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		err := fmt.Errorf("%s answered %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(body))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decode %s reply: %w", req.URL.Host, err)
+	}
+	return nil
+}
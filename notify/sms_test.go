@@ -0,0 +1,370 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMSProvider records the messages it sends, numbering their IDs, and
+// reports the statuses it is given
+type fakeSMSProvider struct {
+	mu       sync.Mutex
+	sent     []SMSMessage
+	statuses []SMSStatus
+}
+
+func (p *fakeSMSProvider) Name() string { return "fake" }
+
+func (p *fakeSMSProvider) Send(ctx context.Context, msg SMSMessage) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, msg)
+	return "msg_" + string(rune('0'+len(p.sent))), nil
+}
+
+func (p *fakeSMSProvider) ParseStatus(r *http.Request) ([]SMSStatus, error) {
+	return p.statuses, nil
+}
+
+var testSMSTemplates = map[string]SMSTemplate{
+	EventPaymentVerified: {Body: "Paid Rs {{major .amount}} for {{.subject}}.", DLTTemplateID: "1107160000000000001"},
+	EventRefundProcessed: {Body: "Refund {{.refund_ref}} processed."},
+}
+
+func newTestSMS(t *testing.T, opts SMSOptions) (*SMS, *fakeSMSProvider) {
+	t.Helper()
+	p := &fakeSMSProvider{}
+	if opts.Templates == nil {
+		opts.Templates = testSMSTemplates
+	}
+	if opts.CountryCode == "" {
+		opts.CountryCode = "91"
+	}
+	opts.RateLimit = 1000
+	s, err := NewSMS(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, p
+}
+
+func TestSMSDeliver(t *testing.T) {
+	paid := func(contact string) Event {
+		return Event{Type: EventPaymentVerified, Subject: "order_1", Data: map[string]interface{}{"amount": float64(123450), "contact": contact}}
+	}
+	tests := []struct {
+		name      string
+		opts      SMSOptions
+		ev        Event
+		wantTo    string
+		wantBody  string
+		wantState string
+		wantErr   error
+	}{
+		{name: "sent", ev: paid("+91 98765-43210"), wantTo: "+919876543210", wantBody: "Paid Rs 1234.50 for order_1.", wantState: SMSSent},
+		{name: "national number", ev: paid("09876543210"), wantTo: "+919876543210", wantBody: "Paid Rs 1234.50 for order_1.", wantState: SMSSent},
+		{name: "opted out", opts: SMSOptions{Suppressed: []string{"9876543210"}}, ev: paid("+919876543210"), wantState: SMSSuppressed},
+		{name: "no template", ev: Event{Type: EventDisputeCreated, Data: map[string]interface{}{"contact": "+919876543210"}}},
+		{name: "no contact", ev: paid("")},
+		{name: "invalid contact", ev: paid("call me"), wantErr: ErrSMSContact},
+		{name: "missing variable", ev: Event{Type: EventRefundProcessed, Data: map[string]interface{}{"contact": "+919876543210"}}, wantState: SMSRejected, wantErr: ErrSMSTemplate},
+		{
+			name:      "over the segment limit",
+			opts:      SMSOptions{MaxSegments: 1, Templates: map[string]SMSTemplate{EventRefundProcessed: {Body: "{{.refund_ref}}"}}},
+			ev:        Event{Type: EventRefundProcessed, Data: map[string]interface{}{"contact": "+919876543210", "refund_ref": strings.Repeat("x", 161)}},
+			wantState: SMSRejected,
+			wantErr:   ErrSMSTooLong,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, p := newTestSMS(t, tt.opts)
+			err := s.Deliver(context.Background(), tt.ev)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			var permanent *permanentError
+			if tt.wantErr != nil && !errors.As(err, &permanent) {
+				t.Fatalf("err = %v, want it permanent", err)
+			}
+
+			if tt.wantBody == "" && len(p.sent) != 0 {
+				t.Fatalf("sent %+v, want nothing", p.sent)
+			}
+			if tt.wantBody != "" {
+				if len(p.sent) != 1 || p.sent[0].To != tt.wantTo || p.sent[0].Body != tt.wantBody || p.sent[0].TemplateID != "1107160000000000001" {
+					t.Fatalf("sent %+v, want %q to %s with its DLT template", p.sent, tt.wantBody, tt.wantTo)
+				}
+			}
+			messages := s.Messages()
+			if tt.wantState == "" {
+				if len(messages) != 0 {
+					t.Fatalf("recorded %+v, want nothing", messages)
+				}
+				return
+			}
+			if len(messages) != 1 || messages[0].Status != tt.wantState || messages[0].To != "+91******3210" {
+				t.Fatalf("recorded %+v, want one %s to a masked number", messages, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestSMSSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"single GSM-7", strings.Repeat("a", 160), 1},
+		{"two GSM-7", strings.Repeat("a", 161), 2},
+		{"extended characters count twice", strings.Repeat("€", 80), 1},
+		{"extended over a segment", strings.Repeat("€", 81), 2},
+		{"single UCS-2", strings.Repeat("₹", 70), 1},
+		{"two UCS-2", strings.Repeat("₹", 71), 2},
+		{"three UCS-2", strings.Repeat("₹", 135), 3},
+		{"surrogate pairs", strings.Repeat("😀", 36), 2},
+	}
+	for _, tt := range tests {
+		if got := smsSegments(tt.body); got != tt.want {
+			t.Errorf("%s: %d segments, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSMSSuppression(t *testing.T) {
+	s, p := newTestSMS(t, SMSOptions{})
+	ev := Event{Type: EventPaymentVerified, Subject: "order_1", Data: map[string]interface{}{"amount": float64(100), "contact": "+919876543210"}}
+
+	if err := s.Suppress("98765 43210"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Suppressed(); len(got) != 1 || got[0] != "+919876543210" {
+		t.Fatalf("suppressed = %v, want the normalized number", got)
+	}
+	if err := s.Deliver(context.Background(), ev); err != nil || len(p.sent) != 0 {
+		t.Fatalf("deliver to an opted-out number: %v, sent %d", err, len(p.sent))
+	}
+	if err := s.Unsuppress("+919876543210"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deliver(context.Background(), ev); err != nil || len(p.sent) != 1 {
+		t.Fatalf("deliver after opting back in: %v, sent %d", err, len(p.sent))
+	}
+	if err := s.Suppress("not a number"); !errors.Is(err, ErrSMSContact) {
+		t.Fatalf("suppress: err = %v, want ErrSMSContact", err)
+	}
+}
+
+func TestSMSStatusReconciled(t *testing.T) {
+	s, p := newTestSMS(t, SMSOptions{})
+	ev := Event{Type: EventPaymentVerified, Subject: "order_1", Data: map[string]interface{}{"amount": float64(100), "contact": "+919876543210"}}
+	for i := 0; i < 2; i++ {
+		if err := s.Deliver(context.Background(), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports := []struct {
+		name     string
+		statuses []SMSStatus
+		matched  int
+		want     map[string]string
+	}{
+		{"delivered and failed", []SMSStatus{{MessageID: "msg_1", Status: SMSDelivered}, {MessageID: "msg_2", Status: SMSFailed, Error: "DND"}}, 2,
+			map[string]string{"msg_1": SMSDelivered, "msg_2": SMSFailed}},
+		{"late report ignored", []SMSStatus{{MessageID: "msg_1", Status: SMSSent}}, 1,
+			map[string]string{"msg_1": SMSDelivered, "msg_2": SMSFailed}},
+		{"unknown message", []SMSStatus{{MessageID: "msg_9", Status: SMSDelivered}}, 0,
+			map[string]string{"msg_1": SMSDelivered, "msg_2": SMSFailed}},
+	}
+	for _, r := range reports {
+		p.statuses = r.statuses
+		matched, err := s.HandleStatus(httptest.NewRequest(http.MethodPost, "/", nil))
+		if err != nil || matched != r.matched {
+			t.Fatalf("%s: matched %d, %v, want %d", r.name, matched, err, r.matched)
+		}
+		for _, m := range s.Messages() {
+			if m.Status != r.want[m.MessageID] {
+				t.Fatalf("%s: %s is %s, want %s", r.name, m.MessageID, m.Status, r.want[m.MessageID])
+			}
+		}
+	}
+	if m := s.Messages(); m[0].MessageID != "msg_2" || m[0].Error != "DND" {
+		t.Fatalf("messages = %+v, want the newest first with its failure", m)
+	}
+}
+
+// twilioStatus is a Twilio status callback for form, signed with token
+// over callbackURL
+func twilioStatus(form url.Values, token, callbackURL string) *http.Request {
+	signed := callbackURL
+	for _, k := range []string{"ErrorCode", "MessageSid", "MessageStatus"} {
+		if v := form.Get(k); v != "" {
+			signed += k + v
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(signed))
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/sms-status", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestTwilioParseStatus(t *testing.T) {
+	const callback = "https://pay.example.com/api/v1/webhooks/sms-status"
+	tw := &Twilio{AuthToken: "tw_token", StatusCallbackURL: callback}
+	tests := []struct {
+		name    string
+		req     *http.Request
+		twilio  *Twilio
+		want    SMSStatus
+		wantErr error
+	}{
+		{"delivered", twilioStatus(url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}}, "tw_token", callback), tw, SMSStatus{MessageID: "SM1", Status: SMSDelivered}, nil},
+		{"undelivered", twilioStatus(url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30007"}}, "tw_token", callback), tw, SMSStatus{MessageID: "SM1", Status: SMSFailed, Error: "twilio error 30007"}, nil},
+		{"queued", twilioStatus(url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"queued"}}, "tw_token", callback), tw, SMSStatus{MessageID: "SM1", Status: SMSSent}, nil},
+		{"other token", twilioStatus(url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}}, "forged", callback), tw, SMSStatus{}, ErrSMSStatusAuth},
+		{"other URL", twilioStatus(url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}}, "tw_token", "https://evil.example"), tw, SMSStatus{}, ErrSMSStatusAuth},
+		{"no callback URL", twilioStatus(url.Values{"MessageSid": {"SM1"}}, "tw_token", ""), &Twilio{AuthToken: "tw_token"}, SMSStatus{}, ErrSMSStatusAuth},
+		{"no message", twilioStatus(url.Values{"MessageStatus": {"delivered"}}, "tw_token", callback), tw, SMSStatus{}, ErrSMSStatusMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.twilio.ParseStatus(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (len(got) != 1 || got[0] != tt.want) {
+				t.Fatalf("statuses = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMSG91ParseStatus(t *testing.T) {
+	m := &MSG91{StatusToken: "dlr_token"}
+	report := `[{"requestId":"r1","numbers":[{"status":"1"}]},{"requestId":"r2","numbers":[{"status":"16","desc":"Rejected"}]},{"requestId":"r3","numbers":[{"status":"8"}]}]`
+	tests := []struct {
+		name    string
+		query   string
+		json    bool
+		body    string
+		wantErr error
+	}{
+		{"JSON body", "?token=dlr_token", true, report, nil},
+		{"form field", "?token=dlr_token", false, url.Values{"data": {report}}.Encode(), nil},
+		{"wrong token", "?token=forged", true, report, ErrSMSStatusAuth},
+		{"no token", "", true, report, ErrSMSStatusAuth},
+		{"not a report", "?token=dlr_token", true, `{"requestId":"r1"}`, ErrSMSStatusMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/sms-status"+tt.query, strings.NewReader(tt.body))
+			if tt.json {
+				r.Header.Set("Content-Type", "application/json")
+			} else {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			got, err := m.ParseStatus(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			want := []SMSStatus{{MessageID: "r1", Status: SMSDelivered}, {MessageID: "r2", Status: SMSFailed, Error: "Rejected"}, {MessageID: "r3", Status: SMSSent}}
+			if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+				t.Fatalf("statuses = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSMSProvidersSend(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	status, reply := http.StatusOK, ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	defer server.Close()
+	msg := SMSMessage{To: "+919876543210", Body: "Paid", TemplateID: "1107160000000000001"}
+
+	t.Run("twilio", func(t *testing.T) {
+		reply = `{"sid":"SM1"}`
+		tw := &Twilio{AccountSID: "AC1", AuthToken: "tw_token", From: "+15550000000", StatusCallbackURL: "https://pay.example.com/cb", BaseURL: server.URL}
+		id, err := tw.Send(context.Background(), msg)
+		if err != nil || id != "SM1" {
+			t.Fatalf("send = %q, %v, want SM1", id, err)
+		}
+		form, _ := url.ParseQuery(string(body))
+		user, pass, _ := got.BasicAuth()
+		if got.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" || user != "AC1" || pass != "tw_token" ||
+			form.Get("To") != msg.To || form.Get("From") != "+15550000000" || form.Get("StatusCallback") != "https://pay.example.com/cb" {
+			t.Fatalf("sent %s %s, want the message to the account's endpoint", got.URL.Path, body)
+		}
+	})
+
+	t.Run("msg91", func(t *testing.T) {
+		reply = `{"type":"success","message":"req_1"}`
+		m := &MSG91{AuthKey: "key", SenderID: "SHOPIN", Route: "4", BaseURL: server.URL}
+		id, err := m.Send(context.Background(), msg)
+		if err != nil || id != "req_1" {
+			t.Fatalf("send = %q, %v, want req_1", id, err)
+		}
+		var payload struct {
+			DLT string `json:"DLT_TE_ID"`
+			SMS []struct {
+				To []string `json:"to"`
+			} `json:"sms"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if got.Header.Get("authkey") != "key" || payload.DLT != msg.TemplateID || len(payload.SMS) != 1 || payload.SMS[0].To[0] != "919876543210" {
+			t.Fatalf("sent %s, want the number without + and the DLT template", body)
+		}
+
+		reply = `{"type":"error","message":"invalid sender"}`
+		var permanent *permanentError
+		if _, err := m.Send(context.Background(), msg); !errors.As(err, &permanent) {
+			t.Fatalf("refused: err = %v, want permanent", err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tw := &Twilio{AccountSID: "AC1", BaseURL: server.URL}
+		tests := []struct {
+			status    int
+			permanent bool
+		}{
+			{http.StatusBadRequest, true},
+			{http.StatusTooManyRequests, false},
+			{http.StatusBadGateway, false},
+		}
+		for _, tt := range tests {
+			status, reply = tt.status, `{}`
+			_, err := tw.Send(context.Background(), msg)
+			var permanent *permanentError
+			if err == nil || errors.As(err, &permanent) != tt.permanent {
+				t.Fatalf("%d: err = %v, want permanent %v", tt.status, err, tt.permanent)
+			}
+		}
+	})
+}
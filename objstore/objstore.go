@@ -0,0 +1,48 @@
+// Package objstore stores whole objects by key in S3-compatible storage,
+// or in memory for development.
+package objstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned for keys holding no object
+var ErrNotFound = errors.New("object not found")
+
+// Store puts and gets whole objects by key
+type Store interface {
+	// Put stores body under key, replacing any object there
+	Put(ctx context.Context, key string, body []byte) error
+	// Get returns the object under key or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Memory is a Store kept in process memory
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemory returns an empty in-memory Store
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string][]byte)}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = append([]byte(nil), body...)
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	body, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), body...), nil
+}
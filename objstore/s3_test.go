@@ -0,0 +1,151 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 keeps objects by escaped request path, refusing requests whose
+// payload hash or credential do not hold
+type fakeS3 struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+	f := &fakeS3{objects: make(map[string][]byte)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		auth := r.Header.Get("Authorization")
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) ||
+			!strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") || !strings.Contains(auth, "/ap-south-1/s3/aws4_request") {
+			http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			f.objects[r.URL.EscapedPath()] = body
+		case http.MethodGet:
+			object, ok := f.objects[r.URL.EscapedPath()]
+			if !ok {
+				http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+				return
+			}
+			w.Write(object)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newTestS3(t *testing.T, endpoint, secret string) *S3 {
+	t.Helper()
+	s, err := NewS3(S3Options{Endpoint: endpoint, Region: "ap-south-1", Bucket: "archive", AccessKeyID: "AKIDTEST", SecretAccessKey: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestS3PutGet(t *testing.T) {
+	server := newFakeS3(t)
+	ctx := context.Background()
+	tests := []struct {
+		endpoint string
+		key      string
+		wantPath string
+	}{
+		{server.URL, "orders/2026/03/02/order_1.ndjson.gz", "/archive/orders/2026/03/02/order_1.ndjson.gz"},
+		{server.URL + "/minio/", "a b+c.gz", "/minio/archive/a%20b%2Bc.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			s := newTestS3(t, tt.endpoint, "secret")
+			body := []byte("{\"id\":\"order_1\"}\n")
+			if err := s.Put(ctx, tt.key, body); err != nil {
+				t.Fatal(err)
+			}
+			server.mu.Lock()
+			_, stored := server.objects[tt.wantPath]
+			server.mu.Unlock()
+			if !stored {
+				t.Fatalf("objects = %v, want one at %s", server.objects, tt.wantPath)
+			}
+			got, err := s.Get(ctx, tt.key)
+			if err != nil || !bytes.Equal(got, body) {
+				t.Fatalf("get = %q, %v, want %q", got, err, body)
+			}
+		})
+	}
+}
+
+func TestS3Errors(t *testing.T) {
+	server := newFakeS3(t)
+	ctx := context.Background()
+
+	if _, err := newTestS3(t, server.URL, "secret").Get(ctx, "missing.gz"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get missing: err = %v, want ErrNotFound", err)
+	}
+	// Signed for another region
+	wrong, err := NewS3(S3Options{Endpoint: server.URL, Region: "us-east-1", Bucket: "archive", AccessKeyID: "AKIDTEST", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wrong.Put(ctx, "key.gz", []byte("x")); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("put refused: err = %v, want the service's error surfaced", err)
+	}
+
+	for _, opts := range []S3Options{{Endpoint: "minio:9000", Bucket: "archive"}, {Endpoint: "http://minio:9000"}} {
+		if _, err := NewS3(opts); err == nil {
+			t.Fatalf("NewS3(%+v) succeeded, want an error", opts)
+		}
+	}
+}
+
+// signature is the request signature s makes for a PUT of body to path
+func signature(s *S3, path string, body []byte) string {
+	req := httptest.NewRequest(http.MethodPut, "http://minio:9000"+path, nil)
+	s.sign(req, path, body, time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	auth := req.Header.Get("Authorization")
+	return auth[strings.LastIndex(auth, "=")+1:]
+}
+
+func TestS3SignatureCoversKeyAndBody(t *testing.T) {
+	s := newTestS3(t, "http://minio:9000", "secret")
+	base := signature(s, "/archive/a.gz", []byte("x"))
+	if base != signature(s, "/archive/a.gz", []byte("x")) {
+		t.Fatal("signature not deterministic")
+	}
+	tests := []struct {
+		name string
+		s    *S3
+		path string
+		body string
+	}{
+		{"other key", s, "/archive/b.gz", "x"},
+		{"other body", s, "/archive/a.gz", "y"},
+		{"other secret", newTestS3(t, "http://minio:9000", "other"), "/archive/a.gz", "x"},
+	}
+	for _, tt := range tests {
+		if signature(tt.s, tt.path, []byte(tt.body)) == base {
+			t.Errorf("%s: same signature, want it to differ", tt.name)
+		}
+	}
+}
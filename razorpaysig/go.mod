@@ -0,0 +1,3 @@
+module github.com/yash170603/golang_payment/razorpaysig
+
+go 1.22.1
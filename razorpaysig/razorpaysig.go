@@ -0,0 +1,127 @@
+// Package razorpaysig verifies and produces Razorpay signatures.
+//
+// It is its own module, importing only the standard library, so other
+// services can depend on it without pulling in this repository's HTTP
+// stack. Release it by tagging razorpaysig/vX.Y.Z.
+//
+// Every signature is the lowercase hex HMAC-SHA256 of a message under a
+// secret: "order_id|payment_id" under the key secret for checkout payments,
+// "payment_id|subscription_id" under the key secret for subscriptions, and
+// the raw request body under the webhook secret for webhooks.
+//
+// A supplied signature must be exactly 64 hex digits. Both cases are
+// accepted, since hex is case-insensitive, but nothing else is: padding,
+// whitespace or a prefix make it ErrMalformed before any MAC is computed.
+// Well-formed signatures are decoded and compared as bytes in constant
+// time, so a near miss takes as long to reject as a far one.
+package razorpaysig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Errors of the Check functions
+var (
+	// ErrMalformed is a signature that is not 64 hex digits
+	ErrMalformed = errors.New("razorpaysig: malformed signature")
+	// ErrMismatch is a well-formed signature of another message or secret
+	ErrMismatch = errors.New("razorpaysig: signature mismatch")
+)
+
+// VerifyPaymentSignature reports whether signature is the checkout
+// signature of orderID and paymentID under the key secret
+func VerifyPaymentSignature(orderID, paymentID, signature, secret string) bool {
+	return CheckPaymentSignature(orderID, paymentID, signature, secret) == nil
+}
+
+// CheckPaymentSignature is VerifyPaymentSignature telling a malformed
+// signature, ErrMalformed, from a wrong one, ErrMismatch
+func CheckPaymentSignature(orderID, paymentID, signature, secret string) error {
+	return check(secret, signature, []byte(orderID), []byte("|"), []byte(paymentID))
+}
+
+// VerifySubscriptionSignature reports whether signature is the checkout
+// signature of a subscription payment under the key secret
+func VerifySubscriptionSignature(paymentID, subscriptionID, signature, secret string) bool {
+	return CheckSubscriptionSignature(paymentID, subscriptionID, signature, secret) == nil
+}
+
+// CheckSubscriptionSignature is VerifySubscriptionSignature telling a
+// malformed signature, ErrMalformed, from a wrong one, ErrMismatch
+func CheckSubscriptionSignature(paymentID, subscriptionID, signature, secret string) error {
+	return check(secret, signature, []byte(paymentID), []byte("|"), []byte(subscriptionID))
+}
+
+// VerifyWebhookSignature reports whether header, the X-Razorpay-Signature
+// of a delivery, signs body under the webhook secret
+func VerifyWebhookSignature(body []byte, header, secret string) bool {
+	return CheckWebhookSignature(body, header, secret) == nil
+}
+
+// CheckWebhookSignature is VerifyWebhookSignature telling a malformed
+// header, ErrMalformed, from a wrong one, ErrMismatch
+func CheckWebhookSignature(body []byte, header, secret string) error {
+	return check(secret, header, body)
+}
+
+// SignPayment returns the checkout signature of orderID and paymentID
+func SignPayment(orderID, paymentID, secret string) string {
+	return sign(secret, orderID, "|", paymentID)
+}
+
+// SignSubscription returns the checkout signature of a subscription payment
+func SignSubscription(paymentID, subscriptionID, secret string) string {
+	return sign(secret, paymentID, "|", subscriptionID)
+}
+
+// SignWebhook returns the X-Razorpay-Signature of body
+func SignWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// check compares signature with the MAC of the concatenated parts
+func check(secret, signature string, parts ...[]byte) error {
+	var want [sha256.Size]byte
+	if !decode(&want, signature) {
+		return ErrMalformed
+	}
+	var got [sha256.Size]byte
+	if !hmac.Equal(mac(got[:0], secret, parts), want[:]) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func sign(secret string, parts ...string) string {
+	var sum [sha256.Size]byte
+	b := make([][]byte, len(parts))
+	for i, p := range parts {
+		b[i] = []byte(p)
+	}
+	return hex.EncodeToString(mac(sum[:0], secret, b))
+}
+
+// mac appends the HMAC-SHA256 of the concatenated parts to b
+func mac(b []byte, secret string, parts [][]byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(b)
+}
+
+// decode hex-decodes a signature into dst, in either case. The length and
+// the digits checked before the constant-time compare belong to the
+// caller's own input, so rejecting them early leaks nothing of the MAC.
+func decode(dst *[sha256.Size]byte, signature string) bool {
+	if len(signature) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.Decode(dst[:], []byte(signature))
+	return err == nil
+}
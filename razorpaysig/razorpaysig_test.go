@@ -0,0 +1,203 @@
+package razorpaysig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Vectors computed independently, with openssl dgst -sha256 -hmac
+const (
+	testKeySecret     = "EnLs21M47BllR3X8PSFtjtbd"
+	testWebhookSecret = "whsec_test"
+	testOrderID       = "order_IEIaMR65cu6nz3"
+	testPaymentID     = "pay_IH4NVgf4Dreq1l"
+	testSubscription  = "sub_00000000000001"
+	testWebhookBody   = `{"entity":"event","event":"payment.captured"}`
+
+	paymentVector      = "0d4e745a1838664ad6c9c9902212a32d627d68e917290b0ad5f08ff4561bc50f"
+	subscriptionVector = "5326e75ddda78863b7e1bb5dc3b7a13adf7f363e644fa1b28ecccd7272e74aa4"
+	webhookVector      = "14026b4f55f7195cf5fabf2ce57f1344fa969faf1d2cb4352740beb936dd5c18"
+)
+
+func TestSignMatchesVectors(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"payment", SignPayment(testOrderID, testPaymentID, testKeySecret), paymentVector},
+		{"subscription", SignSubscription(testPaymentID, testSubscription, testKeySecret), subscriptionVector},
+		{"webhook", SignWebhook([]byte(testWebhookBody), testWebhookSecret), webhookVector},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s signature = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestCheckPaymentSignature(t *testing.T) {
+	flipped := []byte(paymentVector)
+	flipped[len(flipped)-1] = 'e'
+	tests := []struct {
+		name      string
+		orderID   string
+		paymentID string
+		signature string
+		secret    string
+		want      error
+	}{
+		{name: "valid", signature: paymentVector},
+		{name: "upper case", signature: strings.ToUpper(paymentVector)},
+		{name: "last digit off", signature: string(flipped), want: ErrMismatch},
+		{name: "other secret", signature: paymentVector, secret: "other", want: ErrMismatch},
+		{name: "IDs swapped", orderID: testPaymentID, paymentID: testOrderID, signature: paymentVector, want: ErrMismatch},
+		{name: "subscription signature", signature: subscriptionVector, want: ErrMismatch},
+		{name: "empty", signature: "", want: ErrMalformed},
+		{name: "short", signature: paymentVector[:63], want: ErrMalformed},
+		{name: "long", signature: paymentVector + "0", want: ErrMalformed},
+		{name: "not hex", signature: "z" + paymentVector[1:], want: ErrMalformed},
+		{name: "trailing newline", signature: paymentVector[:63] + "\n", want: ErrMalformed},
+		{name: "padded", signature: " " + paymentVector, want: ErrMalformed},
+		{name: "prefixed", signature: "sha256=" + paymentVector, want: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderID, paymentID, secret := testOrderID, testPaymentID, testKeySecret
+			if tt.orderID != "" {
+				orderID, paymentID = tt.orderID, tt.paymentID
+			}
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+			err := CheckPaymentSignature(orderID, paymentID, tt.signature, secret)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if got := VerifyPaymentSignature(orderID, paymentID, tt.signature, secret); got != (tt.want == nil) {
+				t.Fatalf("VerifyPaymentSignature = %v, want %v", got, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestCheckSubscriptionSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string
+		want      error
+	}{
+		{"valid", subscriptionVector, nil},
+		{"payment signature", paymentVector, ErrMismatch},
+		{"malformed", subscriptionVector[:10], ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckSubscriptionSignature(testPaymentID, testSubscription, tt.signature, testKeySecret); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		header string
+		secret string
+		want   error
+	}{
+		{name: "valid", body: testWebhookBody, header: webhookVector, secret: testWebhookSecret},
+		{name: "body changed", body: testWebhookBody + " ", header: webhookVector, secret: testWebhookSecret, want: ErrMismatch},
+		{name: "key secret", body: testWebhookBody, header: webhookVector, secret: testKeySecret, want: ErrMismatch},
+		{name: "empty body", body: "", header: webhookVector, secret: testWebhookSecret, want: ErrMismatch},
+		{name: "missing header", body: testWebhookBody, header: "", secret: testWebhookSecret, want: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckWebhookSignature([]byte(tt.body), tt.header, tt.secret); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if got := VerifyWebhookSignature([]byte(tt.body), tt.header, tt.secret); got != (tt.want == nil) {
+				t.Fatalf("VerifyWebhookSignature = %v, want %v", got, tt.want == nil)
+			}
+		})
+	}
+}
+
+// wellFormed reports whether signature is 64 hex digits of either case
+func wellFormed(signature string) bool {
+	if len(signature) != 64 {
+		return false
+	}
+	return strings.Trim(strings.ToLower(signature), "0123456789abcdef") == ""
+}
+
+func FuzzCheckPaymentSignature(f *testing.F) {
+	for _, seed := range []string{paymentVector, strings.ToUpper(paymentVector), "", paymentVector[:63], " " + paymentVector, "sha256=" + paymentVector, "\x00\xff"} {
+		f.Add(testOrderID, testPaymentID, seed)
+	}
+	f.Fuzz(func(t *testing.T, orderID, paymentID, signature string) {
+		err := CheckPaymentSignature(orderID, paymentID, signature, testKeySecret)
+		switch {
+		case !wellFormed(signature):
+			if !errors.Is(err, ErrMalformed) {
+				t.Fatalf("signature %q: err = %v, want ErrMalformed", signature, err)
+			}
+		case err != nil && !errors.Is(err, ErrMismatch):
+			t.Fatalf("signature %q: err = %v, want nil or ErrMismatch", signature, err)
+		case (err == nil) != strings.EqualFold(signature, SignPayment(orderID, paymentID, testKeySecret)):
+			t.Fatalf("signature %q of %s|%s: err = %v", signature, orderID, paymentID, err)
+		}
+	})
+}
+
+func FuzzCheckWebhookSignature(f *testing.F) {
+	for _, seed := range []string{webhookVector, strings.ToUpper(webhookVector), "", webhookVector + "\n", "zz"} {
+		f.Add([]byte(testWebhookBody), seed)
+	}
+	f.Fuzz(func(t *testing.T, body []byte, header string) {
+		err := CheckWebhookSignature(body, header, testWebhookSecret)
+		switch {
+		case !wellFormed(header):
+			if !errors.Is(err, ErrMalformed) {
+				t.Fatalf("header %q: err = %v, want ErrMalformed", header, err)
+			}
+		case (err == nil) != strings.EqualFold(header, SignWebhook(body, testWebhookSecret)):
+			t.Fatalf("header %q: err = %v", header, err)
+		case err != nil && !errors.Is(err, ErrMismatch):
+			t.Fatalf("header %q: err = %v, want ErrMismatch", header, err)
+		}
+	})
+}
+
+// BenchmarkCheckPaymentSignature compares rejecting a signature off in its
+// last digit with one off in every digit; both take the same time
+func BenchmarkCheckPaymentSignature(b *testing.B) {
+	near := []byte(paymentVector)
+	near[len(near)-1] = 'e'
+	far := strings.Map(func(r rune) rune {
+		if r == '0' {
+			return '1'
+		}
+		return '0'
+	}, paymentVector)
+	benchmarks := []struct {
+		name      string
+		signature string
+	}{
+		{"valid", paymentVector},
+		{"near miss", string(near)},
+		{"far miss", far},
+		{"malformed", paymentVector[:63]},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				CheckPaymentSignature(testOrderID, testPaymentID, bm.signature, testKeySecret)
+			}
+		})
+	}
+}
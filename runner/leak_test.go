@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// waitForGoroutines waits until no more than baseline goroutines are left,
+// e.g. the count taken before a manager was started and stopped. When
+// that does not happen before ctx is done, the error lists the stacks of
+// the goroutines still running, for tests to report the leak.
+func waitForGoroutines(ctx context.Context, baseline int) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := runtime.NumGoroutine()
+		if n <= baseline {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			return fmt.Errorf("%d goroutines leaked (%d running, %d expected):\n%s", n-baseline, n, baseline, buf)
+		}
+	}
+}
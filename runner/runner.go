@@ -0,0 +1,285 @@
+// Package runner starts and stops the long-lived background workers of the
+// service, so none is left running after shutdown.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runnable is a background worker. Start runs it until ctx is cancelled.
+// Returning nil means the worker is done, e.g. its queue was closed and
+// drained; returning an error or panicking means it crashed.
+type Runnable interface {
+	Start(ctx context.Context) error
+}
+
+// Func adapts a function to a Runnable
+type Func func(ctx context.Context) error
+
+func (f Func) Start(ctx context.Context) error { return f(ctx) }
+
+// Every returns a Runnable calling fn every interval until stopped
+func Every(interval time.Duration, fn func()) Runnable {
+	return Func(func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
+
+// Runnable states
+const (
+	StatePending    = "pending"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateStopped    = "stopped"
+	StateFailed     = "failed"
+)
+
+// Status describes a runnable for operators
+type Status struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Restarts  int        `json:"restarts"`
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+}
+
+// Option configures a runnable when it is added
+type Option func(*entry)
+
+// Restart starts the runnable again when it crashes, after backoff at
+// first and doubling up to max. The backoff resets once a run lasts
+// longer than max.
+func Restart(backoff, max time.Duration) Option {
+	return func(e *entry) {
+		e.backoff, e.maxBackoff = backoff, max
+	}
+}
+
+// entry is an added runnable and what it has done so far
+type entry struct {
+	name       string
+	runnable   Runnable
+	backoff    time.Duration
+	maxBackoff time.Duration
+	done       chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Manager starts the runnables added to it together and stops them
+// together. The zero value is not usable; use New.
+type Manager struct {
+	mu      sync.Mutex
+	entries []*entry
+	names   map[string]bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	stopped bool
+}
+
+// New returns a Manager with no runnables
+func New() *Manager {
+	return &Manager{names: make(map[string]bool)}
+}
+
+// Add registers r under name, which must be unique. Runnables added after
+// Start are started right away; those added after Stop never are.
+func (m *Manager) Add(name string, r Runnable, opts ...Option) {
+	e := &entry{name: name, runnable: r, done: make(chan struct{})}
+	e.status = Status{Name: name, State: StatePending}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.names[name] {
+		panic(fmt.Sprintf("runner: %s added twice", name))
+	}
+	m.names[name] = true
+	m.entries = append(m.entries, e)
+	switch {
+	case m.stopped:
+		e.set(StateStopped, nil)
+		close(e.done)
+	case m.started:
+		e.set(StateRunning, nil)
+		go m.run(m.ctx, e)
+	}
+}
+
+// Start starts every runnable added so far. The runnables are stopped when
+// ctx is cancelled or Stop is called.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started || m.stopped {
+		return
+	}
+	m.started = true
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	for _, e := range m.entries {
+		e.set(StateRunning, nil)
+		go m.run(m.ctx, e)
+	}
+}
+
+// Stop cancels the runnables and waits for them to return, giving up when
+// ctx is done. It then returns a *StopError naming those still running.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.stopped {
+		m.stopped = true
+		if m.cancel != nil {
+			m.cancel()
+		}
+		if !m.started {
+			for _, e := range m.entries {
+				e.set(StateStopped, nil)
+				close(e.done)
+			}
+		}
+	}
+	entries := append([]*entry(nil), m.entries...)
+	m.mu.Unlock()
+
+	for _, e := range entries {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return &StopError{Names: running(entries), Err: ctx.Err()}
+		}
+	}
+	return nil
+}
+
+// Wait blocks until every started runnable has returned
+func (m *Manager) Wait() {
+	m.mu.Lock()
+	if !m.started && !m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	entries := append([]*entry(nil), m.entries...)
+	m.mu.Unlock()
+	for _, e := range entries {
+		<-e.done
+	}
+}
+
+// Status reports every runnable in the order they were added
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]Status, len(m.entries))
+	for i, e := range m.entries {
+		e.mu.Lock()
+		statuses[i] = e.status
+		e.mu.Unlock()
+	}
+	return statuses
+}
+
+// run runs e until ctx is cancelled or it returns for good
+func (m *Manager) run(ctx context.Context, e *entry) {
+	defer close(e.done)
+	backoff := e.backoff
+	for {
+		began := time.Now()
+		err := e.start(ctx)
+		if ctx.Err() != nil || err == nil {
+			e.set(StateStopped, nil)
+			return
+		}
+		if e.backoff <= 0 {
+			log.Printf("Background worker %s failed: %v", e.name, err)
+			e.set(StateFailed, err)
+			return
+		}
+
+		if time.Since(began) > e.maxBackoff {
+			backoff = e.backoff
+		}
+		log.Printf("Background worker %s failed, restarting in %s: %v", e.name, backoff, err)
+		e.set(StateRestarting, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			e.set(StateStopped, nil)
+			return
+		}
+		backoff = min(backoff*2, e.maxBackoff)
+		e.mu.Lock()
+		e.status.State = StateRunning
+		e.status.Restarts++
+		e.mu.Unlock()
+	}
+}
+
+// start runs the runnable once, turning a panic into an error
+func (e *entry) start(ctx context.Context) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Background worker %s panicked: %v\n%s", e.name, p, debug.Stack())
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return e.runnable.Start(ctx)
+}
+
+// set records the state and, when err is not nil, the failure
+func (e *entry) set(state string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.State = state
+	if err != nil {
+		now := time.Now()
+		e.status.LastError, e.status.FailedAt = err.Error(), &now
+	}
+}
+
+// running returns the sorted names of the entries not yet returned
+func running(entries []*entry) []string {
+	var names []string
+	for _, e := range entries {
+		select {
+		case <-e.done:
+		default:
+			names = append(names, e.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StopError is returned by Stop when some runnables did not stop in time
+type StopError struct {
+	Names []string
+	Err   error
+}
+
+func (e *StopError) Error() string {
+	return fmt.Sprintf("background workers did not stop in time: %s: %v", strings.Join(e.Names, ", "), e.Err)
+}
+
+func (e *StopError) Unwrap() error {
+	return e.Err
+}
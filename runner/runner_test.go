@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManagerRestartsCrashedRunnables(t *testing.T) {
+	tests := []struct {
+		name  string
+		crash func()
+	}{
+		{"error", func() {}},
+		{"panic", func() { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs atomic.Int32
+			m := New()
+			m.Add("worker", Func(func(ctx context.Context) error {
+				if runs.Add(1) < 3 {
+					tt.crash()
+					return errors.New("crashed")
+				}
+				<-ctx.Done()
+				return nil
+			}), Restart(time.Millisecond, 4*time.Millisecond))
+			m.Start(context.Background())
+
+			deadline := time.Now().Add(time.Second)
+			for runs.Load() < 3 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			status := m.Status()[0]
+			if status.State != StateRunning || status.Restarts != 2 || status.LastError == "" {
+				t.Fatalf("status = %+v, want running after 2 restarts", status)
+			}
+			if err := m.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if state := m.Status()[0].State; state != StateStopped {
+				t.Fatalf("state after Stop = %s", state)
+			}
+		})
+	}
+}
+
+func TestManagerWithoutRestartMarksCrashFailed(t *testing.T) {
+	m := New()
+	m.Add("worker", Func(func(ctx context.Context) error { return errors.New("crashed") }))
+	m.Start(context.Background())
+	m.Wait()
+	if status := m.Status()[0]; status.State != StateFailed || status.LastError != "crashed" {
+		t.Fatalf("status = %+v, want failed", status)
+	}
+}
+
+func TestManagerStopNamesStuckRunnables(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	m := New()
+	m.Add("ticker", Every(time.Hour, func() {}))
+	m.Add("stuck", Func(func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+	m.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var stopErr *StopError
+	if err := m.Stop(ctx); !errors.As(err, &stopErr) || len(stopErr.Names) != 1 || stopErr.Names[0] != "stuck" {
+		t.Fatalf("Stop = %v, want stuck named", err)
+	}
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	m := New()
+	var started atomic.Int32
+	worker := Func(func(ctx context.Context) error {
+		started.Add(1)
+		<-ctx.Done()
+		return nil
+	})
+	m.Add("before-start", worker)
+	m.Start(context.Background())
+	m.Add("after-start", worker)
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m.Add("after-stop", worker)
+	m.Wait()
+
+	if n := started.Load(); n != 2 {
+		t.Fatalf("%d runnables started, want the 2 added before Stop", n)
+	}
+	for _, s := range m.Status() {
+		if s.State != StateStopped {
+			t.Fatalf("%s is %s after Stop", s.Name, s.State)
+		}
+	}
+}
+
+func TestManagerLeavesNoGoroutines(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	m := New()
+	for _, name := range []string{"a", "b", "c"} {
+		m.Add(name, Every(time.Millisecond, func() {}), Restart(time.Millisecond, time.Millisecond))
+	}
+	m.Start(context.Background())
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := waitForGoroutines(ctx, baseline); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+)
+
+// Why a customer left the checkout without paying
+const (
+	AbandonDismissed         = "dismissed"
+	AbandonTimeout           = "timeout"
+	AbandonMethodUnavailable = "method_unavailable"
+)
+
+var abandonReasons = []string{AbandonDismissed, AbandonTimeout, AbandonMethodUnavailable}
+
+// errAbandonIgnored leaves an order abandoning would not change
+var errAbandonIgnored = errors.New("abandon ignored")
+
+// AbandonRequest is the beacon the checkout page sends when the Razorpay
+// modal is closed without paying
+type AbandonRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	// ClientToken is the client_token the order was created with, required
+	// while VERIFY_CLIENT_BINDING is on
+	ClientToken string `json:"client_token"`
+	// OrderToken is the order_token the order was created with, required
+	// while VERIFY_CLIENT_BINDING is off
+	OrderToken string `json:"order_token"`
+}
+
+// AbandonResult is the state of the order after the beacon. Abandoned is
+// false when this beacon did not change it: the order was paid, already
+// abandoned, or otherwise past being abandoned.
+type AbandonResult struct {
+	OrderID   string `json:"order_id"`
+	Status    string `json:"status"`
+	Abandoned bool   `json:"abandoned"`
+}
+
+// AbandonOrder marks a created or failed order abandoned for the holder of
+// its client token, so the beacon cannot be sent for someone else's order.
+// While VERIFY_CLIENT_BINDING is off orders carry no client token, and the
+// holder of the order token may abandon the order instead; while it is on,
+// orders created without a binding cannot be abandoned. Repeats are no-ops,
+// as is abandoning an order that is paid, refunded, expired or overridden
+// by an operator; its real status is returned. An order abandoned and then
+// paid ends up paid, as a payment can still complete after the modal
+// closes.
+//
+// When ABANDON_RECOVERY_DELAY is set, a payment recovery is scheduled that
+// long after, and published unless the order was paid meanwhile.
+func (s *Service) AbandonOrder(ctx context.Context, orderID string, req AbandonRequest) (AbandonResult, error) {
+	if !slices.Contains(abandonReasons, req.Reason) {
+		return AbandonResult{}, invalidRequest("reason must be %s, %s or %s", AbandonDismissed, AbandonTimeout, AbandonMethodUnavailable)
+	}
+	bound := s.cfg.VerifyClientBinding
+	if !bound {
+		if _, err := s.verifyOrderToken(req.OrderToken, orderID); err != nil {
+			return AbandonResult{}, err
+		}
+	}
+
+	var from string
+	order, err := s.store.Update(ctx, orderID, func(order *Order) error {
+		if bound {
+			if err := s.matchClientToken(*order, req.ClientToken); err != nil {
+				return err
+			}
+		}
+		if order.Override != nil || !canTransition(order.Status, OrderAbandoned) {
+			return errAbandonIgnored
+		}
+		from = order.Status
+		now := s.clock.Now()
+		if err := order.transition(OrderAbandoned, now); err != nil {
+			return err
+		}
+		order.Timeline[len(order.Timeline)-1].Message = "Checkout abandoned: " + req.Reason
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrNotFound) && bound:
+		return AbandonResult{}, ErrClientUnbound
+	case errors.Is(err, errAbandonIgnored):
+		current, err := s.store.Get(ctx, orderID)
+		if err != nil {
+			return AbandonResult{}, err
+		}
+		return AbandonResult{OrderID: orderID, Status: current.Status}, nil
+	case err != nil:
+		return AbandonResult{}, err
+	}
+
+	s.trackFunnel(func(f *funnelTracker, _ time.Time) {
+		f.abandoned(orderID, req.Reason)
+	})
+	s.publishEvent(EventOrderStatusChanged, map[string]string{
+		"order_id": orderID,
+		"from":     from,
+		"to":       OrderAbandoned,
+		"reason":   req.Reason,
+	})
+	s.recoverAbandoned(orderID, req.Reason)
+	log.Printf("Order %s abandoned at checkout: %s", orderID, req.Reason)
+	return AbandonResult{OrderID: orderID, Status: order.Status, Abandoned: true}, nil
+}
+
+// recoverAbandoned schedules the recovery of an abandoned checkout, unless
+// the order was followed up before
+func (s *Service) recoverAbandoned(orderID, reason string) {
+	if !s.cfg.PaymentRecoveryEnabled || s.cfg.AbandonRecoveryDelay <= 0 {
+		return
+	}
+	now := s.clock.Now()
+	r := &PaymentRecovery{
+		OrderID:       orderID,
+		AbandonReason: reason,
+		Status:        RecoveryPending,
+		FailedAt:      now,
+		SendAt:        s.afterQuietHours(now.Add(s.cfg.AbandonRecoveryDelay)),
+	}
+	s.recoveries.mu.Lock()
+	defer s.recoveries.mu.Unlock()
+	if _, seen := s.recoveries.byOrder[orderID]; !seen {
+		s.recoveries.byOrder[orderID] = r
+	}
+}
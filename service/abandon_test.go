@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// abandonService binds orders to their client for ten minutes and follows
+// up abandoned checkouts half an hour on
+func abandonService(t *testing.T, bound bool) *Service {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.VerifyClientBinding = bound
+	cfg.ClientTokenTTL = 10 * time.Minute
+	cfg.PaymentRecoveryEnabled = true
+	cfg.AbandonRecoveryDelay = 30 * time.Minute
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	return s
+}
+
+func TestAbandonOrder(t *testing.T) {
+	setStatus := func(status string) func(*Order) {
+		return func(o *Order) { o.Status = status }
+	}
+	tests := []struct {
+		name       string
+		unbound    bool
+		setup      func(*Order)
+		reason     string
+		token      func(issued string) string
+		orderToken func(issued string) string
+		// otherOrder sends the order token of another order
+		otherOrder    bool
+		orderID       string
+		want          error
+		wantInvalid   bool
+		wantStatus    string
+		wantAbandoned bool
+	}{
+		{name: "dismissed", reason: AbandonDismissed, wantStatus: OrderAbandoned, wantAbandoned: true},
+		{name: "timeout", reason: AbandonTimeout, wantStatus: OrderAbandoned, wantAbandoned: true},
+		{name: "method unavailable", reason: AbandonMethodUnavailable, wantStatus: OrderAbandoned, wantAbandoned: true},
+		{name: "after a failure", setup: setStatus(OrderFailed), reason: AbandonDismissed, wantStatus: OrderAbandoned, wantAbandoned: true},
+		{name: "unknown reason", reason: "bored", wantInvalid: true},
+		{name: "missing token", reason: AbandonDismissed, token: func(string) string { return "" }, want: ErrClientTokenMissing},
+		{name: "someone else's token", reason: AbandonDismissed, token: func(issued string) string { return issued + "x" }, want: ErrClientTokenMismatch},
+		{name: "order without a binding", setup: func(o *Order) { o.ClientBinding = nil }, reason: AbandonDismissed, want: ErrClientUnbound},
+		{name: "binding off", unbound: true, reason: AbandonDismissed, wantStatus: OrderAbandoned, wantAbandoned: true},
+		{name: "binding off without an order token", unbound: true, reason: AbandonDismissed, orderToken: func(string) string { return "" }, want: ErrInvalidOrderToken},
+		{name: "binding off with a forged order token", unbound: true, reason: AbandonDismissed, orderToken: func(issued string) string { return issued + "x" }, want: ErrInvalidOrderToken},
+		{name: "binding off with another order's token", unbound: true, reason: AbandonDismissed, otherOrder: true, want: ErrTokenOrder},
+		{name: "binding off, already paid", unbound: true, setup: setStatus(OrderPaid), reason: AbandonDismissed, wantStatus: OrderPaid},
+		{name: "unknown order", reason: AbandonDismissed, orderID: "order_missing", want: ErrClientUnbound},
+		{name: "paid", setup: setStatus(OrderPaid), reason: AbandonDismissed, wantStatus: OrderPaid},
+		{name: "refunded", setup: setStatus(OrderRefunded), reason: AbandonDismissed, wantStatus: OrderRefunded},
+		{name: "already abandoned", setup: setStatus(OrderAbandoned), reason: AbandonTimeout, wantStatus: OrderAbandoned},
+		{name: "overridden", setup: func(o *Order) { o.Override = &StatusOverride{} }, reason: AbandonDismissed, wantStatus: OrderCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := abandonService(t, !tt.unbound)
+			ctx := context.Background()
+			order := createTestOrder(t, s, 500)
+			id := order["id"].(string)
+			issued, _ := order["client_token"].(string)
+			if tt.setup != nil {
+				if _, err := s.store.Update(ctx, id, func(o *Order) error { tt.setup(o); return nil }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			token := issued
+			if tt.token != nil {
+				token = tt.token(issued)
+			}
+			orderToken := order["order_token"].(string)
+			if tt.orderToken != nil {
+				orderToken = tt.orderToken(orderToken)
+			}
+			if tt.otherOrder {
+				orderToken = createTestOrder(t, s, 500)["order_token"].(string)
+			}
+			if tt.orderID != "" {
+				id = tt.orderID
+			}
+
+			res, err := s.AbandonOrder(ctx, id, AbandonRequest{Reason: tt.reason, ClientToken: token, OrderToken: orderToken})
+			if tt.wantInvalid {
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != tt.wantStatus || res.Abandoned != tt.wantAbandoned {
+				t.Fatalf("result = %+v, want %s, abandoned %v", res, tt.wantStatus, tt.wantAbandoned)
+			}
+			stored, _ := s.store.Get(ctx, id)
+			if stored.Status != tt.wantStatus {
+				t.Fatalf("stored status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+			s.recoveries.mu.Lock()
+			_, scheduled := s.recoveries.byOrder[id]
+			s.recoveries.mu.Unlock()
+			if scheduled != tt.wantAbandoned {
+				t.Fatalf("recovery scheduled %v, want %v", scheduled, tt.wantAbandoned)
+			}
+		})
+	}
+}
+
+func TestAbandonedOrderPaid(t *testing.T) {
+	s := abandonService(t, true)
+	ctx := context.Background()
+	order := createTestOrder(t, s, 500)
+	id := order["id"].(string)
+	from := s.clock.Now()
+
+	for _, reason := range []string{AbandonTimeout, AbandonDismissed} {
+		if _, err := s.AbandonOrder(ctx, id, AbandonRequest{Reason: reason, ClientToken: order["client_token"].(string)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.recoveries.mu.Lock()
+	r := s.recoveries.byOrder[id]
+	s.recoveries.mu.Unlock()
+	if r == nil || r.AbandonReason != AbandonTimeout || !r.SendAt.Equal(s.afterQuietHours(from.Add(30*time.Minute))) {
+		t.Fatalf("recovery = %+v, want one for the first beacon 30 minutes on", r)
+	}
+
+	s.markOrderPaid(ctx, id, "pay_1")
+	if stored, _ := s.store.Get(ctx, id); stored.Status != OrderPaid || stored.PaymentID != "pay_1" {
+		t.Fatalf("order = %s %s, want paid after the modal closed", stored.Status, stored.PaymentID)
+	}
+	report, err := s.Funnel(from, from.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Abandoned) != 1 || report.Abandoned[AbandonTimeout] != 1 {
+		t.Fatalf("abandoned = %v, want the first reason counted once", report.Abandoned)
+	}
+}
+
+func TestAbandonRacesPayment(t *testing.T) {
+	s := abandonService(t, true)
+	ctx := context.Background()
+	for i := 0; i < 50; i++ {
+		order := createTestOrder(t, s, 500)
+		id := order["id"].(string)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.markOrderPaid(ctx, id, "pay_1")
+		}()
+		go func() {
+			defer wg.Done()
+			s.AbandonOrder(ctx, id, AbandonRequest{Reason: AbandonDismissed, ClientToken: order["client_token"].(string)})
+		}()
+		wg.Wait()
+		if stored, _ := s.store.Get(ctx, id); stored.Status != OrderPaid {
+			t.Fatalf("order %s = %s, want paid whichever came first", id, stored.Status)
+		}
+	}
+}
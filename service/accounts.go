@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// RazorpayAccount is a further Razorpay account orders can be routed to,
+// alongside the primary account of RAZORPAY_API_KEY
+type RazorpayAccount struct {
+	Name      string `json:"name"`
+	KeyID     string `json:"key_id"`
+	KeySecret string `json:"key_secret"`
+	// WebhookSecret verifies the account's webhooks, which are refused
+	// while it is empty
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// AccountRule sends the orders it matches to Account, before weights are
+// considered. Every condition set must hold; the first rule matching wins.
+type AccountRule struct {
+	Account string `json:"account"`
+	// MinAmount and MaxAmount bound the amount in minor units; zero is open
+	MinAmount int      `json:"min_amount,omitempty"`
+	MaxAmount int      `json:"max_amount,omitempty"`
+	Brands    []string `json:"brands,omitempty"`
+}
+
+func (r AccountRule) matches(amount int, brand string) bool {
+	if r.MinAmount > 0 && amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount > 0 && amount > r.MaxAmount {
+		return false
+	}
+	return len(r.Brands) == 0 || slices.Contains(r.Brands, brand)
+}
+
+// accountsFile is the format of RAZORPAY_ACCOUNTS_FILE
+type accountsFile struct {
+	Accounts []RazorpayAccount `json:"accounts"`
+	// Weights split the orders no rule matches between the accounts by
+	// name, "primary" included. Accounts without a weight get none; with
+	// no weights at all every such order goes to the primary.
+	Weights map[string]int `json:"weights"`
+	Rules   []AccountRule  `json:"rules"`
+}
+
+// accountRouting is the part of the file a reload may change. Weighted
+// picks use smooth weighted round robin, so a 3:1 split is exact over
+// every four orders rather than only on average.
+type accountRouting struct {
+	weights map[string]int
+	rules   []AccountRule
+	// weighted are the accounts with a weight, sorted
+	weighted []string
+
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (r *accountRouting) pick(amount int, brand string) string {
+	for _, rule := range r.rules {
+		if rule.matches(amount, brand) {
+			return rule.Account
+		}
+	}
+	if len(r.weighted) == 0 {
+		return gateway.ProviderPrimary
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	best, total := "", 0
+	for _, name := range r.weighted {
+		r.current[name] += r.weights[name]
+		total += r.weights[name]
+		if best == "" || r.current[name] > r.current[best] {
+			best = name
+		}
+	}
+	r.current[best] -= total
+	return best
+}
+
+// Accounts are the Razorpay accounts of RAZORPAY_ACCOUNTS_FILE and how new
+// orders are routed between them
+type Accounts struct {
+	path     string
+	accounts map[string]RazorpayAccount
+	routing  atomic.Pointer[accountRouting]
+}
+
+// LoadAccounts reads the accounts, weights and rules at path
+func LoadAccounts(path string) (*Accounts, error) {
+	file, err := readAccountsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &Accounts{path: path, accounts: make(map[string]RazorpayAccount, len(file.Accounts))}
+	keyIDs := make(map[string]bool, len(file.Accounts))
+	for _, acct := range file.Accounts {
+		if acct.Name == "" || acct.KeyID == "" || acct.KeySecret == "" {
+			return nil, fmt.Errorf("account %q: name, key_id and key_secret are required", acct.Name)
+		}
+		if acct.Name == gateway.ProviderPrimary || acct.Name == gateway.ProviderSecondary {
+			return nil, fmt.Errorf("account name %q is reserved", acct.Name)
+		}
+		if _, dup := a.accounts[acct.Name]; dup {
+			return nil, fmt.Errorf("duplicate account %q", acct.Name)
+		}
+		if keyIDs[acct.KeyID] {
+			return nil, fmt.Errorf("account %q: key_id is used by another account", acct.Name)
+		}
+		keyIDs[acct.KeyID] = true
+		a.accounts[acct.Name] = acct
+	}
+	routing, err := a.routingOf(file)
+	if err != nil {
+		return nil, err
+	}
+	a.store(routing)
+	return a, nil
+}
+
+func readAccountsFile(path string) (accountsFile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return accountsFile{}, err
+	}
+	var file accountsFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return accountsFile{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// routingOf checks the weights and rules of file against the accounts
+func (a *Accounts) routingOf(file accountsFile) (*accountRouting, error) {
+	known := func(name string) bool {
+		_, ok := a.accounts[name]
+		return ok || name == gateway.ProviderPrimary
+	}
+	r := &accountRouting{weights: make(map[string]int), rules: file.Rules, current: make(map[string]int)}
+	for name, weight := range file.Weights {
+		if !known(name) {
+			return nil, fmt.Errorf("weight for unknown account %q", name)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("weight for account %q must not be negative", name)
+		}
+		if weight > 0 {
+			r.weights[name] = weight
+			r.weighted = append(r.weighted, name)
+		}
+	}
+	sort.Strings(r.weighted)
+	for i, rule := range file.Rules {
+		if !known(rule.Account) {
+			return nil, fmt.Errorf("rule %d: unknown account %q", i, rule.Account)
+		}
+		if rule.MaxAmount > 0 && rule.MaxAmount < rule.MinAmount {
+			return nil, fmt.Errorf("rule %d: max_amount is below min_amount", i)
+		}
+	}
+	return r, nil
+}
+
+func (a *Accounts) store(r *accountRouting) {
+	metrics.AccountWeight.WithLabelValues(gateway.ProviderPrimary).Set(float64(r.weights[gateway.ProviderPrimary]))
+	for name := range a.accounts {
+		metrics.AccountWeight.WithLabelValues(name).Set(float64(r.weights[name]))
+	}
+	a.routing.Store(r)
+}
+
+// Reload re-reads the weights and rules, keeping the previous ones when
+// the file fails to load. The accounts themselves are only read at start,
+// as their gateways are built then, so a file changing them is refused.
+func (a *Accounts) Reload() error {
+	file, err := readAccountsFile(a.path)
+	if err != nil {
+		return err
+	}
+	changed := len(file.Accounts) != len(a.accounts)
+	for _, acct := range file.Accounts {
+		if !reflect.DeepEqual(a.accounts[acct.Name], acct) {
+			changed = true
+		}
+	}
+	if changed {
+		return fmt.Errorf("%s: accounts changed, restart to apply", a.path)
+	}
+	routing, err := a.routingOf(file)
+	if err != nil {
+		return err
+	}
+	a.store(routing)
+	return nil
+}
+
+// List returns the accounts by name, for building their gateways
+func (a *Accounts) List() []RazorpayAccount {
+	list := make([]RazorpayAccount, 0, len(a.accounts))
+	for _, acct := range a.accounts {
+		list = append(list, acct)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// WithAccounts routes new orders between the primary account and the
+// accounts, whose gateways gw must hold; see gateway.NewAccounts
+func WithAccounts(a *Accounts) Option {
+	return func(s *Service) {
+		s.accounts = a
+	}
+}
+
+// ReloadAccounts re-reads the account weights and rules. The previous ones
+// stay in effect when the file fails to load.
+func (s *Service) ReloadAccounts() error {
+	if s.accounts == nil {
+		return nil
+	}
+	return s.accounts.Reload()
+}
+
+// routeOrder picks the account a new order is created on
+func (s *Service) routeOrder(ctx context.Context, p orderParams) context.Context {
+	if s.accounts == nil {
+		return ctx
+	}
+	return gateway.WithAccount(ctx, s.accounts.routing.Load().pick(p.Amount, p.Brand))
+}
+
+// account returns the routed account named name, other than the primary
+func (s *Service) account(name string) (RazorpayAccount, bool) {
+	if s.accounts == nil {
+		return RazorpayAccount{}, false
+	}
+	acct, ok := s.accounts.accounts[name]
+	return acct, ok
+}
+
+// accountKeyIDs maps each routed account to its key ID
+func (s *Service) accountKeyIDs() map[string]string {
+	if s.accounts == nil {
+		return nil
+	}
+	ids := make(map[string]string, len(s.accounts.accounts))
+	for name, acct := range s.accounts.accounts {
+		ids[name] = acct.KeyID
+	}
+	return ids
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+const (
+	brandSecret        = "brand_secret"
+	brandWebhookSecret = "brand_webhook_secret"
+)
+
+// writeAccounts writes file as RAZORPAY_ACCOUNTS_FILE would hold it,
+// returning its path
+func writeAccounts(t *testing.T, path string, file accountsFile) string {
+	t.Helper()
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "accounts.json")
+	}
+	raw, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// brandAccount is the one account test services route to besides the
+// primary
+func brandAccount() RazorpayAccount {
+	return RazorpayAccount{Name: "brand", KeyID: "rzp_test_brand", KeySecret: brandSecret, WebhookSecret: brandWebhookSecret}
+}
+
+// accountsService routes orders by weights and rules between the primary
+// and brand, each a fake gateway. Brand's order IDs start at order_101 so
+// the two never collide.
+func accountsService(t *testing.T, weights map[string]int, rules ...AccountRule) (*Service, *fakeGateway, *fakeGateway, string) {
+	t.Helper()
+	path := writeAccounts(t, "", accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Weights: weights, Rules: rules})
+	accounts, err := LoadAccounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary, brand := newFakeGateway(), newFakeGateway()
+	brand.created = 100
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookReorderDelay = 0
+	s, _ := newTestService(t, gateway.NewAccounts(primary, map[string]gateway.Gateway{"brand": brand}), cfg, WithAccounts(accounts))
+	return s, primary, brand, path
+}
+
+func TestLoadAccountsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    accountsFile
+		wantErr string
+	}{
+		{"no key secret", accountsFile{Accounts: []RazorpayAccount{{Name: "brand", KeyID: "rzp_test_brand"}}}, "required"},
+		{"reserved name", accountsFile{Accounts: []RazorpayAccount{{Name: "primary", KeyID: "k", KeySecret: "s"}}}, "reserved"},
+		{"duplicate name", accountsFile{Accounts: []RazorpayAccount{brandAccount(), {Name: "brand", KeyID: "k", KeySecret: "s"}}}, "duplicate"},
+		{"shared key ID", accountsFile{Accounts: []RazorpayAccount{brandAccount(), {Name: "other", KeyID: "rzp_test_brand", KeySecret: "s"}}}, "key_id"},
+		{"unknown weight", accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Weights: map[string]int{"other": 1}}, "unknown account"},
+		{"negative weight", accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Weights: map[string]int{"brand": -1}}, "negative"},
+		{"unknown rule", accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Rules: []AccountRule{{Account: "other"}}}, "unknown account"},
+		{"inverted rule", accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Rules: []AccountRule{{Account: "brand", MinAmount: 500, MaxAmount: 100}}}, "max_amount"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadAccounts(writeAccounts(t, "", tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccountKeyIDMustDifferFromPrimary(t *testing.T) {
+	acct := brandAccount()
+	acct.KeyID = "rzp_test_key"
+	accounts, err := LoadAccounts(writeAccounts(t, "", accountsFile{Accounts: []RazorpayAccount{acct}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(newFakeGateway(), NewMemoryStore(), testConfig(t), WithAccounts(accounts)); err == nil {
+		t.Fatal("account sharing RAZORPAY_API_KEY accepted")
+	}
+}
+
+func TestAccountRoutingPick(t *testing.T) {
+	rules := []AccountRule{
+		{Account: "large", MinAmount: 100000},
+		{Account: "brand", Brands: []string{"acme"}, MaxAmount: 50000},
+	}
+	tests := []struct {
+		name    string
+		weights map[string]int
+		amount  int
+		brand   string
+		want    []string
+	}{
+		{"no weights", nil, 500, "", []string{"primary", "primary"}},
+		{"amount rule", map[string]int{"primary": 1}, 200000, "acme", []string{"large", "large"}},
+		{"brand rule", map[string]int{"primary": 1}, 500, "acme", []string{"brand", "brand"}},
+		{"brand rule over its amount", map[string]int{"primary": 1}, 60000, "acme", []string{"primary"}},
+		{"even split", map[string]int{"primary": 1, "brand": 1}, 500, "", []string{"brand", "primary", "brand", "primary"}},
+		{"3:1 split", map[string]int{"primary": 3, "brand": 1}, 500, "", []string{"primary", "brand", "primary", "primary", "primary", "brand", "primary", "primary"}},
+		{"zero weight", map[string]int{"primary": 0, "brand": 2}, 500, "", []string{"brand", "brand"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Accounts{accounts: map[string]RazorpayAccount{"brand": brandAccount(), "large": {Name: "large"}}}
+			r, err := a.routingOf(accountsFile{Weights: tt.weights, Rules: rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for range tt.want {
+				got = append(got, r.pick(tt.amount, tt.brand))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrdersRoutedBetweenAccounts(t *testing.T) {
+	s, primary, brand, _ := accountsService(t, map[string]int{"primary": 1, "brand": 1}, AccountRule{Account: "brand", MinAmount: 100000})
+	beforePrimary := testutil.ToFloat64(metrics.AccountOrders.WithLabelValues("primary"))
+	beforeBrand := testutil.ToFloat64(metrics.AccountOrders.WithLabelValues("brand"))
+
+	for _, amount := range []int{500, 500, 500, 500, 200000} {
+		createTestOrder(t, s, amount)
+	}
+	if primary.created != 2 || brand.created != 103 {
+		t.Fatalf("%d orders on the primary and %d on brand, want 2 and 3", primary.created, brand.created-100)
+	}
+	if n := testutil.ToFloat64(metrics.AccountOrders.WithLabelValues("primary")) - beforePrimary; n != 2 {
+		t.Fatalf("account_orders_total{primary} rose by %v, want 2", n)
+	}
+	if n := testutil.ToFloat64(metrics.AccountOrders.WithLabelValues("brand")) - beforeBrand; n != 3 {
+		t.Fatalf("account_orders_total{brand} rose by %v, want 3", n)
+	}
+
+	order, err := s.store.Get(context.Background(), "order_101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Provider != "brand" {
+		t.Fatalf("provider = %q, want the order recorded on brand", order.Provider)
+	}
+	if keys := s.PublicConfig(context.Background()).AccountKeyIDs; keys["brand"] != "rzp_test_brand" {
+		t.Fatalf("account key IDs = %v, want brand's checkout key", keys)
+	}
+}
+
+func TestCrossAccountVerificationRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		secret  string
+		wantErr error
+	}{
+		{"primary order, primary secret", "primary", testSecret, nil},
+		{"primary order, brand secret", "primary", brandSecret, ErrSignatureMismatch},
+		{"brand order, brand secret", "brand", brandSecret, nil},
+		{"brand order, primary secret", "brand", testSecret, ErrSignatureMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, primary, brand, _ := accountsService(t, map[string]int{tt.account: 1})
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			gw := primary
+			if tt.account == "brand" {
+				gw = brand
+			}
+			gw.pay("pay_1", orderID, 500, "INR")
+
+			_, err := s.VerifyPayment(context.Background(), PaymentVerificationRequest{
+				ServerOrderID:     orderID,
+				RazorpayPaymentID: "pay_1",
+				RazorpaySignature: paymentSignature(orderID, "pay_1", tt.secret),
+				OrderToken:        order["order_token"].(string),
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify: err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccountWebhooks(t *testing.T) {
+	s, _, _, _ := accountsService(t, map[string]int{"brand": 1})
+	orderID := createTestOrder(t, s, 500)["id"].(string)
+	body := fmt.Sprintf(`{"event":"order.paid","payload":{"order":{"entity":{"id":%q,"amount":500,"status":"paid"}}}}`, orderID)
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name    string
+		account string
+		secret  string
+		wantErr error
+	}{
+		{"brand order, brand secret", "", brandWebhookSecret, nil},
+		{"brand order, primary secret", "", testWebhookSecret, ErrWebhookSignature},
+		{"brand URL, brand secret", "brand", brandWebhookSecret, nil},
+		{"brand URL, primary secret", "brand", testWebhookSecret, ErrWebhookSignature},
+		{"primary URL, brand secret", "primary", brandWebhookSecret, ErrWebhookSignature},
+		{"unknown URL", "other", brandWebhookSecret, ErrNotFound},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventID := fmt.Sprintf("evt_%d", i)
+			var err error
+			if tt.account == "" {
+				err = s.HandleWebhook([]byte(body), sign(tt.secret), eventID)
+			} else {
+				err = s.HandleAccountWebhook(tt.account, []byte(body), sign(tt.secret), eventID)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReloadAccounts(t *testing.T) {
+	s, _, _, path := accountsService(t, map[string]int{"primary": 1})
+	weight := func(name string) float64 { return testutil.ToFloat64(metrics.AccountWeight.WithLabelValues(name)) }
+	if weight("primary") != 1 || weight("brand") != 0 {
+		t.Fatalf("weights = %v/%v, want 1/0", weight("primary"), weight("brand"))
+	}
+
+	writeAccounts(t, path, accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Weights: map[string]int{"brand": 4}})
+	if err := s.ReloadAccounts(); err != nil {
+		t.Fatal(err)
+	}
+	if weight("primary") != 0 || weight("brand") != 4 {
+		t.Fatalf("weights = %v/%v after reload, want 0/4", weight("primary"), weight("brand"))
+	}
+	if order := createTestOrder(t, s, 500); order["id"] != "order_101" {
+		t.Fatalf("order %v after reload, want it on brand", order["id"])
+	}
+
+	changed := brandAccount()
+	changed.KeySecret = "rotated"
+	tests := []struct {
+		name string
+		file accountsFile
+	}{
+		{"account changed", accountsFile{Accounts: []RazorpayAccount{changed}, Weights: map[string]int{"primary": 1}}},
+		{"account removed", accountsFile{Weights: map[string]int{"primary": 1}}},
+		{"unknown weight", accountsFile{Accounts: []RazorpayAccount{brandAccount()}, Weights: map[string]int{"other": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeAccounts(t, path, tt.file)
+			if err := s.ReloadAccounts(); err == nil {
+				t.Fatal("reload succeeded, want it refused")
+			}
+			if weight("brand") != 4 {
+				t.Fatalf("brand weight = %v, want the previous routing kept", weight("brand"))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/yash170603/golang_payment/money"
+)
+
+// ErrInvalidAmount is returned for amounts that are not positive or fall
+// outside the currency's limits
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Currency describes how amounts in a currency are expressed and bounded
+type Currency struct {
+	Code string `json:"code"`
+	// Exponent is the number of minor-unit digits (2 for paise)
+	Exponent int `json:"exponent"`
+	// MinAmount is the smallest accepted amount in minor units
+	MinAmount int `json:"min_amount"`
+	// MaxAmount is the largest accepted amount in minor units; zero is open
+	MaxAmount int `json:"max_amount,omitempty"`
+}
+
+// currencies lists the currencies amounts are validated against
+var currencies = map[string]Currency{
+	"INR": {Code: "INR", Exponent: 2, MinAmount: 100},
+	"USD": {Code: "USD", Exponent: 2, MinAmount: 100},
+	"EUR": {Code: "EUR", Exponent: 2, MinAmount: 100},
+	"GBP": {Code: "GBP", Exponent: 2, MinAmount: 100},
+	"SGD": {Code: "SGD", Exponent: 2, MinAmount: 100},
+	"AED": {Code: "AED", Exponent: 2, MinAmount: 100},
+}
+
+// validateAmount checks that amount, in minor units, is positive and within
+// the limits of currency. Every endpoint taking an amount uses it.
+func validateAmount(currency string, amount int) error {
+	cur, ok := currencies[currency]
+	if !ok {
+		return fmt.Errorf("%w: unsupported currency %q", ErrInvalidAmount, currency)
+	}
+	if amount <= 0 {
+		return fmt.Errorf("%w: amount must be a positive number of minor units", ErrInvalidAmount)
+	}
+	if amount < cur.MinAmount {
+		return fmt.Errorf("%w: amount must be at least %d for %s", ErrInvalidAmount, cur.MinAmount, currency)
+	}
+	if cur.MaxAmount > 0 && amount > cur.MaxAmount {
+		return fmt.Errorf("%w: amount must be at most %d for %s", ErrInvalidAmount, cur.MaxAmount, currency)
+	}
+	return nil
+}
+
+// SupportedCurrencies are the currencies a merchant may create orders in
+type SupportedCurrencies struct {
+	Default    string     `json:"default"`
+	Currencies []Currency `json:"currencies"`
+}
+
+// SupportedCurrencies returns the currencies the calling merchant, or the
+// configuration, allows, in the order they are configured. They come from
+// the table amounts are validated against.
+func (s *Service) SupportedCurrencies(ctx context.Context) (SupportedCurrencies, error) {
+	def, allowed, err := s.merchantCurrencies(ctx)
+	if err != nil {
+		return SupportedCurrencies{}, err
+	}
+	list := SupportedCurrencies{Default: def, Currencies: make([]Currency, 0, len(allowed))}
+	for _, code := range allowed {
+		list.Currencies = append(list.Currencies, currencies[code])
+	}
+	return list, nil
+}
+
+// ConvertAmount converts amount, in minor units of from, to minor units of
+// to at rate, the major units of to one major unit of from buys. The
+// result is rounded by ROUNDING_MODE. This is the one place amounts
+// become fractional: orders are created and receipts formatted in whole
+// minor units, so a converted amount is rounded once, here, and charged,
+// shown and reconciled as rounded.
+func (s *Service) ConvertAmount(amount int, from, to string, rate *big.Rat) (int, error) {
+	fromCur, ok := currencies[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: unsupported currency %q", ErrInvalidAmount, from)
+	}
+	toCur, ok := currencies[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: unsupported currency %q", ErrInvalidAmount, to)
+	}
+	if rate == nil || rate.Sign() <= 0 {
+		return 0, fmt.Errorf("conversion rate from %s to %s must be positive", from, to)
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toCur.Exponent-fromCur.Exponent))), nil))
+	if toCur.Exponent < fromCur.Exponent {
+		scale.Inv(scale)
+	}
+	converted, err := money.New(int64(amount), to).Mul(new(big.Rat).Mul(rate, scale), money.Rounding(s.cfg.RoundingMode))
+	if err != nil || converted.Amount > math.MaxInt || converted.Amount < math.MinInt {
+		return 0, fmt.Errorf("%w: converted amount is out of range", ErrInvalidAmount)
+	}
+	return int(converted.Amount), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// LineItem is one invoice line of an order
+type LineItem struct {
+	Name       string `json:"name"`
+	Quantity   int    `json:"quantity"`
+	UnitAmount int    `json:"unit_amount"`
+	// Currency defaults to the order currency and must match it
+	Currency string `json:"currency,omitempty"`
+}
+
+// validateLineItems checks each line and that the lines add up to amount.
+// Amounts are integer minor units, so the sum is exact and needs no
+// rounding in any currency.
+func validateLineItems(currency string, amount int, items []LineItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	sum := 0
+	for i, item := range items {
+		if item.Name == "" {
+			return invalidRequest("line_items[%d]: name is required", i)
+		}
+		if item.Quantity < 1 {
+			return invalidRequest("line_items[%d]: quantity must be at least 1", i)
+		}
+		if item.Currency != "" && strings.ToUpper(item.Currency) != currency {
+			return fmt.Errorf("%w: line_items[%d] is in %s, the order is in %s", ErrInvalidAmount, i, item.Currency, currency)
+		}
+		if err := validateItemAmount(item.UnitAmount); err != nil {
+			return fmt.Errorf("line_items[%d]: %w", i, err)
+		}
+		sum += item.Quantity * item.UnitAmount
+	}
+	if sum != amount {
+		return fmt.Errorf("%w: line items total %d, order amount is %d", ErrInvalidAmount, sum, amount)
+	}
+	return nil
+}
+
+// validateItemAmount checks a line item's unit amount, which may be below
+// the order minimum but must still be positive
+func validateItemAmount(amount int) error {
+	if amount <= 0 {
+		return fmt.Errorf("%w: item amount must be a positive number of minor units", ErrInvalidAmount)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/config"
+)
+
+func TestConvertAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int
+		rate     *big.Rat
+		rounding string
+		want     int
+	}{
+		{"exact", 10000, big.NewRat(12, 1000), config.RoundHalfUp, 120},
+		// 1005 paise at 0.012 is 12.06 cents
+		{"fraction down", 1005, big.NewRat(12, 1000), config.RoundHalfUp, 12},
+		// 125 paise at 0.02 is 2.5 cents
+		{"tie half-up", 125, big.NewRat(2, 100), config.RoundHalfUp, 3},
+		{"tie bankers", 125, big.NewRat(2, 100), config.RoundBankers, 2},
+		// 175 paise at 0.02 is 3.5 cents
+		{"tie bankers to the even above", 175, big.NewRat(2, 100), config.RoundBankers, 4},
+		{"below a tie bankers", 124, big.NewRat(2, 100), config.RoundBankers, 2},
+		{"floor", 199, big.NewRat(1, 2), config.RoundFloor, 99},
+		{"floor negative", -199, big.NewRat(1, 2), config.RoundFloor, -100},
+		{"ceil", 199, big.NewRat(1, 2), config.RoundCeil, 100},
+		{"ceil negative", -199, big.NewRat(1, 2), config.RoundCeil, -99},
+		{"exact with ceil", 200, big.NewRat(1, 2), config.RoundCeil, 100},
+		{"negative mirrors", -125, big.NewRat(2, 100), config.RoundHalfUp, -3},
+		{"negative tie bankers", -125, big.NewRat(2, 100), config.RoundBankers, -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.RoundingMode = tt.rounding
+			s, _ := newTestService(t, newFakeGateway(), cfg)
+			got, err := s.ConvertAmount(tt.amount, "INR", "USD", tt.rate)
+			if err != nil || got != tt.want {
+				t.Fatalf("ConvertAmount(%d) = %d, %v, want %d", tt.amount, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertAmountRefused(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	tests := []struct {
+		name     string
+		from, to string
+		rate     *big.Rat
+		want     error
+	}{
+		{"unknown currency", "INR", "XYZ", big.NewRat(1, 1), ErrInvalidAmount},
+		{"out of range", "INR", "USD", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 70)), ErrInvalidAmount},
+		{"zero rate", "INR", "USD", new(big.Rat), nil},
+		{"no rate", "INR", "USD", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ConvertAmount(100, tt.from, tt.to, tt.rate)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		amount   int
+		ok       bool
+	}{
+		{"minimum", "INR", 100, true},
+		{"above minimum", "USD", 123456, true},
+		{"zero", "INR", 0, false},
+		{"negative", "INR", -500, false},
+		{"below minimum", "INR", 99, false},
+		{"unsupported currency", "XYZ", 10000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAmount(tt.currency, tt.amount)
+			if tt.ok != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidAmount)) {
+				t.Fatalf("validateAmount(%s, %d) = %v, want ok %v", tt.currency, tt.amount, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSupportedCurrencies(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.AllowedCurrencies = []string{"USD", "INR"}
+	cfg.DefaultCurrency = "INR"
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+
+	list, err := s.SupportedCurrencies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Default != "INR" || len(list.Currencies) != 2 || list.Currencies[0].Code != "USD" || list.Currencies[1].Code != "INR" {
+		t.Fatalf("currencies = %+v, want USD then INR as configured, INR by default", list)
+	}
+	// Each listed minimum is the one amounts are validated against
+	for _, cur := range list.Currencies {
+		if cur != currencies[cur.Code] || cur.Exponent != 2 {
+			t.Fatalf("%s = %+v, want the validation table's %+v", cur.Code, cur, currencies[cur.Code])
+		}
+		if err := validateAmount(cur.Code, cur.MinAmount); err != nil {
+			t.Fatalf("%s minimum %d refused: %v", cur.Code, cur.MinAmount, err)
+		}
+		if err := validateAmount(cur.Code, cur.MinAmount-1); err == nil {
+			t.Fatalf("%s below the listed minimum accepted", cur.Code)
+		}
+	}
+}
+
+func TestCaptureAndRefundValidateAmount(t *testing.T) {
+	ctx := context.Background()
+	calls := map[string]func(s *Service, amount int) error{
+		"capture": func(s *Service, amount int) error {
+			_, err := s.CapturePayment(ctx, "pay_1", CaptureRequest{Amount: amount})
+			return err
+		},
+		"refund": func(s *Service, amount int) error {
+			_, _, err := s.RequestRefund(ctx, RefundRequest{PaymentID: "pay_1", Amount: amount})
+			return err
+		},
+		"scheduled capture": func(s *Service, amount int) error {
+			at := time.Now().Add(time.Hour)
+			_, err := s.ScheduleCapture(ctx, "pay_1", CaptureRequest{Amount: amount, CaptureAt: &at})
+			return err
+		},
+		"scheduled refund": func(s *Service, amount int) error {
+			at := time.Now().Add(time.Hour)
+			_, err := s.ScheduleRefund(ctx, RefundRequest{PaymentID: "pay_1", Amount: amount, ExecuteAt: &at})
+			return err
+		},
+	}
+	amounts := map[string]int{"zero": 0, "negative": -100, "below minimum": 50}
+	for call, do := range calls {
+		for name, amount := range amounts {
+			t.Run(call+"/"+name, func(t *testing.T) {
+				gw := newFakeGateway()
+				s, _ := newTestService(t, gw, testConfig(t))
+				if err := do(s, amount); !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want ErrInvalidAmount", err)
+				}
+				if gw.fetches != 0 || len(gw.captured) != 0 {
+					t.Fatalf("invalid amount reached Razorpay: %d fetches, captured %v", gw.fetches, gw.captured)
+				}
+			})
+		}
+	}
+}
+
+func TestValidateLineItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		amount   int
+		items    []LineItem
+		// want is nil for valid items, ErrInvalidAmount, or errInvalid for a
+		// ValidationError
+		want error
+	}{
+		{"no items", "INR", 50000, nil, nil},
+		{"one line", "INR", 50000, []LineItem{{Name: "Plan", Quantity: 1, UnitAmount: 50000}}, nil},
+		{"several lines", "INR", 1500, []LineItem{{Name: "Mug", Quantity: 2, UnitAmount: 500}, {Name: "Card", Quantity: 1, UnitAmount: 500, Currency: "inr"}}, nil},
+		// Thirds of a rupee add up exactly in paise, with nothing to round
+		{"exact in minor units", "INR", 999, []LineItem{{Name: "Third", Quantity: 3, UnitAmount: 333}}, nil},
+		{"one paisa short", "INR", 1000, []LineItem{{Name: "Third", Quantity: 3, UnitAmount: 333}}, ErrInvalidAmount},
+		{"cents", "USD", 1001, []LineItem{{Name: "Sticker", Quantity: 7, UnitAmount: 143}}, nil},
+		{"item below the order minimum", "INR", 150, []LineItem{{Name: "Fee", Quantity: 1, UnitAmount: 50}, {Name: "Item", Quantity: 1, UnitAmount: 100}}, nil},
+		{"sum over", "INR", 1000, []LineItem{{Name: "Mug", Quantity: 3, UnitAmount: 500}}, ErrInvalidAmount},
+		{"other currency", "INR", 500, []LineItem{{Name: "Mug", Quantity: 1, UnitAmount: 500, Currency: "USD"}}, ErrInvalidAmount},
+		{"zero unit amount", "INR", 500, []LineItem{{Name: "Free", Quantity: 1, UnitAmount: 0}, {Name: "Mug", Quantity: 1, UnitAmount: 500}}, ErrInvalidAmount},
+		{"negative unit amount", "INR", 500, []LineItem{{Name: "Discount", Quantity: 1, UnitAmount: -100}, {Name: "Mug", Quantity: 1, UnitAmount: 600}}, ErrInvalidAmount},
+		{"no name", "INR", 500, []LineItem{{Quantity: 1, UnitAmount: 500}}, errInvalid},
+		{"no quantity", "INR", 500, []LineItem{{Name: "Mug", UnitAmount: 500}}, errInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLineItems(tt.currency, tt.amount, tt.items)
+			var invalid *ValidationError
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatalf("err = %v, want none", err)
+			case tt.want == errInvalid && !errors.As(err, &invalid):
+				t.Fatalf("err = %v, want a validation error", err)
+			case tt.want == ErrInvalidAmount && !errors.Is(err, ErrInvalidAmount):
+				t.Fatalf("err = %v, want ErrInvalidAmount", err)
+			}
+		})
+	}
+}
+
+// errInvalid stands for a ValidationError in test tables
+var errInvalid = errors.New("validation error")
+
+func TestLineItemsStoredWithOrder(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	items := []LineItem{{Name: "Mug", Quantity: 2, UnitAmount: 500}, {Name: "Card", Quantity: 1, UnitAmount: 500}}
+	order, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 1500, LineItems: items})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := s.store.Get(context.Background(), order["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local.LineItems) != 2 || local.LineItems[0] != items[0] || local.LineItems[1] != items[1] {
+		t.Fatalf("stored line items = %+v, want %+v", local.LineItems, items)
+	}
+
+	if _, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 2000, LineItems: items}); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("mismatched sum: err = %v, want ErrInvalidAmount", err)
+	}
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/objstore"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// ErrArchiveChecksum is an archive object that did not read back as it
+// was written
+var ErrArchiveChecksum = errors.New("archive checksum mismatch")
+
+// errArchiveChanged leaves an order that changed after it was exported
+var errArchiveChanged = errors.New("changed since export")
+
+// Metric kinds of archived records
+const (
+	archiveKindOrder        = "order"
+	archiveKindWebhookEvent = "webhook_event"
+)
+
+// OrderArchive locates the archived copy of an order
+type OrderArchive struct {
+	Location string `json:"location"`
+	// Checksum is the hex SHA-256 of the object
+	Checksum   string    `json:"checksum"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// ArchiveRun reports one run of the archiver
+type ArchiveRun struct {
+	Orders        int      `json:"orders"`
+	WebhookEvents int      `json:"webhook_events"`
+	Objects       []string `json:"objects,omitempty"`
+	// More is set when a batch was full, so older records may remain for
+	// the next run
+	More bool `json:"more"`
+}
+
+// WithArchive archives orders and dead-lettered webhook events not
+// updated for ARCHIVE_AFTER to objects, each a gzipped NDJSON file
+func WithArchive(objects objstore.Store) Option {
+	return func(s *Service) {
+		s.archive = objects
+	}
+}
+
+// startArchiver archives a batch every ArchiveInterval
+func (s *Service) startArchiver() {
+	if s.archive == nil {
+		return
+	}
+	s.runners.Add("archiver", runner.Every(s.cfg.ArchiveInterval, func() {
+		run, err := s.ArchiveOnce(context.Background())
+		if err != nil {
+			log.Printf("Archiving failed after %d orders and %d webhook events: %v", run.Orders, run.WebhookEvents, err)
+			return
+		}
+		if run.Orders > 0 || run.WebhookEvents > 0 {
+			log.Printf("Archived %d orders and %d webhook events to %v", run.Orders, run.WebhookEvents, run.Objects)
+		}
+	}))
+}
+
+// ArchiveOnce moves at most ArchiveBatchSize orders and as many dead
+// letters to one object each. Records are only pruned once their object
+// reads back with the checksum it was written with, so a run that fails
+// part way is picked up by the next: the records still in the store are
+// exported again, to the same key when nothing else changed.
+//
+// Archived orders leave a stub behind holding their ID, receipt, status
+// and amount, and where the rest is.
+func (s *Service) ArchiveOnce(ctx context.Context) (ArchiveRun, error) {
+	var run ArchiveRun
+	cutoff := s.clock.Now().Add(-s.cfg.ArchiveAfter)
+
+	orders, err := s.store.Archivable(ctx, cutoff, s.cfg.ArchiveBatchSize)
+	if err != nil {
+		return run, fmt.Errorf("list archivable orders: %w", err)
+	}
+	if len(orders) > 0 {
+		run.More = len(orders) == s.cfg.ArchiveBatchSize
+		records := make([]interface{}, len(orders))
+		for i, order := range orders {
+			records[i] = order
+		}
+		key := fmt.Sprintf("orders/%s/%s.ndjson.gz", orders[0].UpdatedAt.UTC().Format("2006/01/02"), orders[0].ID)
+		checksum, err := s.putArchive(ctx, key, records)
+		if err != nil {
+			return run, err
+		}
+		run.Objects = append(run.Objects, key)
+
+		ref := OrderArchive{Location: key, Checksum: checksum, ArchivedAt: s.clock.Now()}
+		for _, exported := range orders {
+			_, err := s.store.Update(ctx, exported.ID, func(order *Order) error {
+				if order.Archive != nil || !order.UpdatedAt.Equal(exported.UpdatedAt) {
+					return errArchiveChanged
+				}
+				*order = order.archiveStub(ref)
+				return nil
+			})
+			switch {
+			case errors.Is(err, errArchiveChanged), errors.Is(err, ErrNotFound):
+				continue
+			case err != nil:
+				return run, fmt.Errorf("prune order %s: %w", exported.ID, err)
+			}
+			run.Orders++
+			metrics.ArchivedRecords.WithLabelValues(archiveKindOrder).Inc()
+		}
+	}
+
+	letters, indexes := s.webhooks.lettersBefore(cutoff, s.cfg.ArchiveBatchSize)
+	if len(letters) > 0 {
+		run.More = run.More || len(letters) == s.cfg.ArchiveBatchSize
+		records := make([]interface{}, len(letters))
+		for i, letter := range letters {
+			records[i] = letter
+		}
+		key := fmt.Sprintf("webhooks/%s/%d.ndjson.gz", letters[0].FailedAt.UTC().Format("2006/01/02"), letters[0].FailedAt.UnixNano())
+		if _, err := s.putArchive(ctx, key, records); err != nil {
+			return run, err
+		}
+		run.Objects = append(run.Objects, key)
+		s.webhooks.pruneLetters(indexes)
+		run.WebhookEvents = len(letters)
+		metrics.ArchivedRecords.WithLabelValues(archiveKindWebhookEvent).Add(float64(len(letters)))
+	}
+	return run, nil
+}
+
+// archiveStub is what remains of an archived order in the store
+func (o Order) archiveStub(ref OrderArchive) Order {
+	return Order{
+		ID:        o.ID,
+		Amount:    o.Amount,
+		Currency:  o.Currency,
+		Receipt:   o.Receipt,
+		Status:    o.Status,
+		PaymentID: o.PaymentID,
+		Brand:     o.Brand,
+		Provider:  o.Provider,
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+		Archive:   &ref,
+	}
+}
+
+// putArchive writes records as gzipped NDJSON under key and reads the
+// object back, returning its checksum once it matches
+func (s *Service) putArchive(ctx context.Context, key string, records []interface{}) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return "", fmt.Errorf("encode archive %s: %w", key, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("compress archive %s: %w", key, err)
+	}
+	checksum := archiveChecksum(buf.Bytes())
+
+	if err := s.archive.Put(ctx, key, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("upload archive %s: %w", key, err)
+	}
+	stored, err := s.archive.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("read back archive %s: %w", key, err)
+	}
+	if archiveChecksum(stored) != checksum {
+		return "", fmt.Errorf("%w: %s", ErrArchiveChecksum, key)
+	}
+	return checksum, nil
+}
+
+func archiveChecksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// rehydrateOrder reads the archived copy of the order stub stands for.
+// Changes made to the stub since, such as a late refund, are carried
+// over. Without an archive store the stub itself is returned.
+func (s *Service) rehydrateOrder(ctx context.Context, stub Order) (Order, error) {
+	stub.Archived = true
+	if s.archive == nil {
+		return stub, nil
+	}
+	object, err := s.archive.Get(ctx, stub.Archive.Location)
+	if err != nil {
+		return Order{}, fmt.Errorf("fetch archive %s: %w", stub.Archive.Location, err)
+	}
+	if archiveChecksum(object) != stub.Archive.Checksum {
+		return Order{}, fmt.Errorf("%w: %s", ErrArchiveChecksum, stub.Archive.Location)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(object))
+	if err != nil {
+		return Order{}, fmt.Errorf("decompress archive %s: %w", stub.Archive.Location, err)
+	}
+	dec := json.NewDecoder(zr)
+	for {
+		var order Order
+		switch err := dec.Decode(&order); {
+		case errors.Is(err, io.EOF):
+			return Order{}, fmt.Errorf("order %s missing from archive %s", stub.ID, stub.Archive.Location)
+		case err != nil:
+			return Order{}, fmt.Errorf("decode archive %s: %w", stub.Archive.Location, err)
+		}
+		if order.ID != stub.ID {
+			continue
+		}
+		if stub.UpdatedAt.After(order.UpdatedAt) {
+			order.Status, order.PaymentID, order.UpdatedAt = stub.Status, stub.PaymentID, stub.UpdatedAt
+			order.Timeline = append(order.Timeline, stub.Timeline...)
+		}
+		order.Archive, order.Archived = stub.Archive, true
+		return order, nil
+	}
+}
+
+// lettersBefore returns up to limit dead letters that failed before
+// cutoff, oldest first, and their indexes
+func (p *webhookPool) lettersBefore(cutoff time.Time, limit int) ([]DeadLetter, []int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var letters []DeadLetter
+	var indexes []int
+	for i, letter := range p.letters {
+		if len(letters) == limit {
+			break
+		}
+		if letter.FailedAt.Before(cutoff) {
+			letters = append(letters, letter)
+			indexes = append(indexes, i)
+		}
+	}
+	return letters, indexes
+}
+
+// pruneLetters drops the dead letters at indexes, as returned by
+// lettersBefore. Letters are only ever appended meanwhile, so the indexes
+// still hold.
+func (p *webhookPool) pruneLetters(indexes []int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	drop := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		drop[i] = true
+	}
+	kept := p.letters[:0]
+	for i, letter := range p.letters {
+		if !drop[i] {
+			kept = append(kept, letter)
+		}
+	}
+	p.letters = kept
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/objstore"
+)
+
+// flakyObjects is an in-memory object store failing the next failPuts
+// uploads, and reading back corrupted objects while corrupt is set
+type flakyObjects struct {
+	*objstore.Memory
+
+	mu       sync.Mutex
+	failPuts int
+	corrupt  bool
+}
+
+func (o *flakyObjects) Put(ctx context.Context, key string, body []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.failPuts > 0 {
+		o.failPuts--
+		return errors.New("connection reset")
+	}
+	return o.Memory.Put(ctx, key, body)
+}
+
+func (o *flakyObjects) Get(ctx context.Context, key string) ([]byte, error) {
+	body, err := o.Memory.Get(ctx, key)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err == nil && o.corrupt {
+		body[len(body)-1] ^= 0xff
+	}
+	return body, err
+}
+
+// archiveService archives orders not updated for a day, two at a time
+func archiveService(t *testing.T, objects objstore.Store) (*Service, *clock.Fake) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.ArchiveAfter = 24 * time.Hour
+	cfg.ArchiveBatchSize = 2
+	return newTestService(t, newFakeGateway(), cfg, WithArchive(objects))
+}
+
+func TestArchiveOnce(t *testing.T) {
+	objects := &flakyObjects{Memory: objstore.NewMemory()}
+	s, clk := archiveService(t, objects)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := s.CreateOrder(ctx, PaymentRequest{Amount: 500, Notes: map[string]string{"sku": "A-1"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := testutil.ToFloat64(metrics.ArchivedRecords.WithLabelValues(archiveKindOrder))
+
+	if run, err := s.ArchiveOnce(ctx); err != nil || run.Orders != 0 {
+		t.Fatalf("run = %+v, %v, want nothing archived before ARCHIVE_AFTER", run, err)
+	}
+	clk.Advance(25 * time.Hour)
+	runs := []struct {
+		orders int
+		object string
+		more   bool
+	}{
+		{2, "orders/2026/03/02/order_1.ndjson.gz", true},
+		{1, "orders/2026/03/02/order_3.ndjson.gz", false},
+		{0, "", false},
+	}
+	for i, want := range runs {
+		run, err := s.ArchiveOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Orders != want.orders || run.More != want.more || (want.object != "" && (len(run.Objects) != 1 || run.Objects[0] != want.object)) {
+			t.Fatalf("run %d = %+v, want %d orders in %q, more %v", i+1, run, want.orders, want.object, want.more)
+		}
+	}
+	if n := testutil.ToFloat64(metrics.ArchivedRecords.WithLabelValues(archiveKindOrder)) - before; n != 3 {
+		t.Fatalf("archived_records_total{order} rose by %v, want 3", n)
+	}
+
+	stub, err := s.store.Get(ctx, "order_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.Archive == nil || stub.Archive.Location != "orders/2026/03/02/order_1.ndjson.gz" || stub.Notes != nil || stub.Amount != 500 {
+		t.Fatalf("stub = %+v, want the amount and the archive location only", stub)
+	}
+	order, err := s.LocalOrder(ctx, "order_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !order.Archived || order.Notes["sku"] != "A-1" || len(order.Timeline) == 0 {
+		t.Fatalf("order = %+v, want it rehydrated with its notes and timeline", order)
+	}
+}
+
+func TestArchiveRehydrateCarriesLaterChanges(t *testing.T) {
+	s, clk := archiveService(t, objstore.NewMemory())
+	ctx := context.Background()
+	id := createTestOrder(t, s, 500)["id"].(string)
+	clk.Advance(25 * time.Hour)
+	if _, err := s.ArchiveOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paid late, on the stub
+	s.markOrderPaid(ctx, id, "pay_1")
+	order, err := s.LocalOrder(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !order.Archived || order.Status != OrderPaid || order.PaymentID != "pay_1" {
+		t.Fatalf("order = %+v, want the late payment carried over", order)
+	}
+	if run, err := s.ArchiveOnce(ctx); err != nil || run.Orders != 0 {
+		t.Fatalf("run = %+v, %v, want a stub never archived again", run, err)
+	}
+}
+
+func TestArchiveResumable(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   func(*flakyObjects)
+		wantErr error
+	}{
+		{"upload failed", func(o *flakyObjects) { o.failPuts = 1 }, nil},
+		{"read back corrupted", func(o *flakyObjects) { o.corrupt = true }, ErrArchiveChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := &flakyObjects{Memory: objstore.NewMemory()}
+			s, clk := archiveService(t, objects)
+			ctx := context.Background()
+			createTestOrder(t, s, 500)
+			clk.Advance(25 * time.Hour)
+
+			tt.fault(objects)
+			_, err := s.ArchiveOnce(ctx)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("err = %v, want the run failed with %v", err, tt.wantErr)
+			}
+			if order, _ := s.store.Get(ctx, "order_1"); order.Archive != nil {
+				t.Fatal("order pruned by a failed run")
+			}
+
+			objects.mu.Lock()
+			objects.corrupt = false
+			objects.mu.Unlock()
+			run, err := s.ArchiveOnce(ctx)
+			if err != nil || run.Orders != 1 {
+				t.Fatalf("next run = %+v, %v, want the order archived", run, err)
+			}
+			if order, _ := s.LocalOrder(ctx, "order_1"); !order.Archived || order.Amount != 500 {
+				t.Fatalf("order = %+v, want it read back", order)
+			}
+		})
+	}
+}
+
+func TestArchiveRehydrateChecksum(t *testing.T) {
+	objects := &flakyObjects{Memory: objstore.NewMemory()}
+	s, clk := archiveService(t, objects)
+	ctx := context.Background()
+	createTestOrder(t, s, 500)
+	clk.Advance(25 * time.Hour)
+	if _, err := s.ArchiveOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	objects.corrupt = true
+	if _, err := s.LocalOrder(ctx, "order_1"); !errors.Is(err, ErrArchiveChecksum) {
+		t.Fatalf("err = %v, want ErrArchiveChecksum", err)
+	}
+	objects.Memory = objstore.NewMemory()
+	if _, err := s.LocalOrder(ctx, "order_1"); !errors.Is(err, objstore.ErrNotFound) {
+		t.Fatalf("err = %v, want the missing object reported", err)
+	}
+}
+
+func TestArchiveDeadLetters(t *testing.T) {
+	s, clk := archiveService(t, objstore.NewMemory())
+	ctx := context.Background()
+	now := clk.Now()
+	s.webhooks.mu.Lock()
+	for _, failed := range []time.Time{now.Add(-72 * time.Hour), now.Add(-48 * time.Hour), now.Add(-30 * time.Hour), now.Add(-time.Hour)} {
+		s.webhooks.letters = append(s.webhooks.letters, DeadLetter{Event: WebhookEvent{ID: failed.Format(time.RFC3339)}, FailedAt: failed})
+	}
+	s.webhooks.mu.Unlock()
+
+	for i, want := range []int{2, 1, 0} {
+		run, err := s.ArchiveOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.WebhookEvents != want {
+			t.Fatalf("run %d archived %d dead letters, want %d", i+1, run.WebhookEvents, want)
+		}
+	}
+	s.webhooks.mu.RLock()
+	defer s.webhooks.mu.RUnlock()
+	if len(s.webhooks.letters) != 1 || !s.webhooks.letters[0].FailedAt.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("letters = %+v, want only the recent one kept", s.webhooks.letters)
+	}
+}
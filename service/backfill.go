@@ -0,0 +1,680 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// backfillEntities are the collections a backfill imports, in the order they
+// are walked: orders first, so payments find the orders they belong to
+var backfillEntities = []string{gateway.EntityOrders, gateway.EntityPayments, gateway.EntityRefunds}
+
+const (
+	// backfillAuthor is the timeline author of changes a backfill makes
+	backfillAuthor = "backfill"
+	// backfillMinWindow is the shortest window a backfill lists at once
+	backfillMinWindow = time.Minute
+	// backfillMaxRateLimits is how many rate limits in a row one window may
+	// hit before the backfill gives up
+	backfillMaxRateLimits = 5
+	// backfillMaxPageDelay caps the page delay rate limits slow down to
+	backfillMaxPageDelay = 30 * time.Second
+	// backfillSpotCheckEvery is how often a verified record is compared by
+	// hash, one in so many starting with the first
+	backfillSpotCheckEvery = 10
+	// backfillMaxMismatches caps the mismatches a report lists
+	backfillMaxMismatches = 50
+)
+
+// errBackfillUnchanged leaves a stored order as it is
+var errBackfillUnchanged = errors.New("unchanged")
+
+// BackfillRequest imports Razorpay records created in [From, To) into the
+// local store, window by window
+type BackfillRequest struct {
+	From time.Time
+	// To defaults to now, or to where the resumed backfill was going
+	To time.Time
+	// Entities are among orders, payments and refunds; empty means all
+	Entities []string
+	// Window is the span of created_at listed at once and checkpointed
+	// after; it defaults to a day
+	Window time.Duration
+	// VerifyOnly compares counts and spot-check hashes without writing
+	VerifyOnly bool
+	// Checkpoint is the file progress is saved to after every window and
+	// resumed from; empty runs without one
+	Checkpoint string
+	// Progress, when set, is called after every window
+	Progress func(BackfillProgress)
+}
+
+// BackfillCounts is what a backfill did with one entity's records
+type BackfillCounts struct {
+	Seen int `json:"seen"`
+	// Written records were inserted or updated. Payments and refunds are
+	// also posted to the ledger, which records each once however often
+	// the backfill runs.
+	Written   int `json:"written"`
+	Unchanged int `json:"unchanged"`
+	// KeptLocal records were left alone: live traffic updated them after
+	// the page was fetched, or an operator overrode their status
+	KeptLocal int `json:"kept_local"`
+	// Skipped records have nothing to import, like payments never
+	// captured or of orders not stored locally
+	Skipped int `json:"skipped"`
+	// Missing, Checked and Mismatched are set when verifying: records not
+	// found locally, and spot-checked records whose hashes differ
+	Missing    int `json:"missing,omitempty"`
+	Checked    int `json:"checked,omitempty"`
+	Mismatched int `json:"mismatched,omitempty"`
+}
+
+func (c *BackfillCounts) add(o BackfillCounts) {
+	c.Seen += o.Seen
+	c.Written += o.Written
+	c.Unchanged += o.Unchanged
+	c.KeptLocal += o.KeptLocal
+	c.Skipped += o.Skipped
+	c.Missing += o.Missing
+	c.Checked += o.Checked
+	c.Mismatched += o.Mismatched
+}
+
+// BackfillProgress reports a backfill after one of its windows
+type BackfillProgress struct {
+	Entity      string
+	WindowStart time.Time
+	WindowEnd   time.Time
+	// Counts are the entity's so far, including earlier runs resumed from
+	Counts BackfillCounts
+	// Done of Windows are imported, across all entities
+	Done    int
+	Windows int
+	Elapsed time.Duration
+	// ETA extrapolates this run's pace over the windows left
+	ETA time.Duration
+}
+
+// BackfillReport is the outcome of a backfill
+type BackfillReport struct {
+	From       time.Time                 `json:"from"`
+	To         time.Time                 `json:"to"`
+	VerifyOnly bool                      `json:"verify_only"`
+	Resumed    bool                      `json:"resumed"`
+	Entities   map[string]BackfillCounts `json:"entities"`
+	// Mismatches names the first records missing or differing locally
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// backfillCheckpoint is the progress of a backfill saved between windows
+type backfillCheckpoint struct {
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Window     time.Duration `json:"window"`
+	VerifyOnly bool          `json:"verify_only"`
+	Entities   []string      `json:"entities"`
+	// Done is, per entity, the end of the last window imported
+	Done       map[string]time.Time      `json:"done"`
+	Counts     map[string]BackfillCounts `json:"counts"`
+	Mismatches []string                  `json:"mismatches,omitempty"`
+}
+
+// backfillRun is the state of a backfill in progress
+type backfillRun struct {
+	req   BackfillRequest
+	cp    backfillCheckpoint
+	delay time.Duration
+	// refunds are the ledger's refund postings by refund ID, read once
+	// when refunds are verified
+	refunds map[string]LedgerTransaction
+	// verified counts the records verified, to spot-check one in so many
+	verified int
+	resumed  bool
+}
+
+// Backfill imports the Razorpay history of req.Entities into the local
+// store. Orders are upserted; captured payments mark their orders paid and
+// post to the ledger, as do processed refunds. Re-running it is safe: what
+// is stored already is left unchanged. A record live traffic updated after
+// its page was fetched keeps the local copy, otherwise the upstream one,
+// just fetched, wins.
+//
+// With a checkpoint, an interrupted backfill resumes after its last
+// imported window; the checkpoint is removed once the backfill completes.
+// Backfill returns the report so far along with any error.
+func (s *Service) Backfill(ctx context.Context, req BackfillRequest) (BackfillReport, error) {
+	run, err := s.startBackfill(req)
+	if err != nil {
+		return BackfillReport{}, err
+	}
+
+	req = run.req
+	windows, done := 0, 0
+	for _, entity := range run.cp.Entities {
+		windows += countWindows(run.cp.From, run.cp.To, req.Window)
+		done += countWindows(run.cp.From, run.cp.Done[entity], req.Window)
+	}
+	started, doneAtStart := s.clock.Now(), done
+
+	for _, entity := range run.cp.Entities {
+		for start := run.cp.Done[entity]; start.Before(run.cp.To); {
+			end := start.Add(req.Window)
+			if end.After(run.cp.To) {
+				end = run.cp.To
+			}
+			counts, mismatches, err := s.backfillWindow(ctx, run, entity, start, end)
+			if err != nil {
+				return run.report(), fmt.Errorf("backfill %s from %s: %w", entity, start.Format(time.RFC3339), err)
+			}
+
+			total := run.cp.Counts[entity]
+			total.add(counts)
+			run.cp.Counts[entity] = total
+			run.cp.Done[entity] = end
+			for _, m := range mismatches {
+				if len(run.cp.Mismatches) < backfillMaxMismatches {
+					run.cp.Mismatches = append(run.cp.Mismatches, m)
+				}
+			}
+			if err := run.save(); err != nil {
+				return run.report(), err
+			}
+
+			done++
+			if req.Progress != nil {
+				elapsed := s.clock.Now().Sub(started)
+				p := BackfillProgress{
+					Entity:      entity,
+					WindowStart: start,
+					WindowEnd:   end,
+					Counts:      total,
+					Done:        done,
+					Windows:     windows,
+					Elapsed:     elapsed,
+				}
+				if ran := done - doneAtStart; ran > 0 {
+					p.ETA = elapsed / time.Duration(ran) * time.Duration(windows-done)
+				}
+				req.Progress(p)
+			}
+			start = end
+		}
+	}
+	if err := run.finish(); err != nil {
+		return run.report(), err
+	}
+	return run.report(), nil
+}
+
+// startBackfill checks req and resumes its checkpoint, if one was saved
+func (s *Service) startBackfill(req BackfillRequest) (*backfillRun, error) {
+	if req.Window == 0 {
+		req.Window = 24 * time.Hour
+	}
+	if len(req.Entities) == 0 {
+		req.Entities = backfillEntities
+	}
+	switch {
+	case req.From.IsZero():
+		return nil, invalidRequest("from is required")
+	case req.Window < backfillMinWindow:
+		return nil, invalidRequest("window must be at least %s", backfillMinWindow)
+	}
+	var entities []string
+	for _, entity := range backfillEntities {
+		if slices.Contains(req.Entities, entity) {
+			entities = append(entities, entity)
+		}
+	}
+	for _, entity := range req.Entities {
+		if !slices.Contains(backfillEntities, entity) {
+			return nil, invalidRequest("cannot backfill %q, use %s", entity, strings.Join(backfillEntities, ", "))
+		}
+	}
+
+	run := &backfillRun{req: req, delay: s.cfg.ListPageDelay}
+	resumed, err := loadBackfillCheckpoint(req.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if resumed != nil {
+		if !resumed.From.Equal(req.From) || resumed.Window != req.Window || resumed.VerifyOnly != req.VerifyOnly ||
+			!slices.Equal(resumed.Entities, entities) || (!req.To.IsZero() && !resumed.To.Equal(req.To)) {
+			return nil, fmt.Errorf("checkpoint %s is of another backfill; remove it to start over", req.Checkpoint)
+		}
+		run.cp = *resumed
+		for _, entity := range entities {
+			if run.cp.Done[entity].IsZero() {
+				run.cp.Done[entity] = req.From
+			}
+		}
+		run.resumed = true
+		log.Printf("Resuming backfill from checkpoint %s", req.Checkpoint)
+		return run, nil
+	}
+
+	to := req.To
+	if to.IsZero() {
+		to = s.clock.Now().Truncate(time.Second)
+	}
+	if !req.From.Before(to) {
+		return nil, invalidRequest("from must be before to")
+	}
+	run.cp = backfillCheckpoint{
+		From:       req.From,
+		To:         to,
+		Window:     req.Window,
+		VerifyOnly: req.VerifyOnly,
+		Entities:   entities,
+		Done:       map[string]time.Time{},
+		Counts:     map[string]BackfillCounts{},
+	}
+	for _, entity := range entities {
+		run.cp.Done[entity] = req.From
+	}
+	return run, nil
+}
+
+// countWindows is how many windows of length window fit in [from, to),
+// counting a partial last one
+func countWindows(from, to time.Time, window time.Duration) int {
+	if !from.Before(to) {
+		return 0
+	}
+	span := to.Sub(from)
+	return int((span + window - 1) / window)
+}
+
+// backfillWindow imports the records of entity created in [start, end). A
+// rate limit slows the page delay and lists the window again from the
+// start, which re-imports nothing already stored; the counts are those of
+// the last, complete listing.
+func (s *Service) backfillWindow(ctx context.Context, run *backfillRun, entity string, start, end time.Time) (BackfillCounts, []string, error) {
+	params := map[string]interface{}{"from": start.Unix(), "to": end.Unix() - 1}
+	for attempt := 1; ; attempt++ {
+		var counts BackfillCounts
+		var mismatches []string
+		err := s.gateway.ListAll(ctx, entity, params, gateway.ListOptions{PageDelay: run.delay}, func(item map[string]interface{}) error {
+			counts.Seen++
+			if run.cp.VerifyOnly {
+				run.verified++
+				spotCheck := run.verified%backfillSpotCheckEvery == 1
+				mismatch, err := s.verifyRecord(ctx, run, entity, item, spotCheck, &counts)
+				if mismatch != "" {
+					mismatches = append(mismatches, mismatch)
+				}
+				return err
+			}
+			return s.importRecord(ctx, entity, item, s.clock.Now(), &counts)
+		})
+
+		var rl *gateway.RateLimitError
+		if err == nil {
+			// Ease back toward the configured pace after a clean window
+			run.delay = max(s.cfg.ListPageDelay, run.delay/2)
+			return counts, mismatches, nil
+		}
+		if !errors.As(err, &rl) || attempt == backfillMaxRateLimits {
+			return BackfillCounts{}, nil, err
+		}
+		run.delay = min(backfillMaxPageDelay, max(2*run.delay, time.Second))
+		log.Printf("Backfill of %s rate limited, retrying window in %s with %s between pages", entity, rl.RetryAfter, run.delay)
+		select {
+		case <-time.After(rl.RetryAfter):
+		case <-ctx.Done():
+			return BackfillCounts{}, nil, ctx.Err()
+		}
+	}
+}
+
+// importRecord upserts a record of entity fetched at fetchedAt
+func (s *Service) importRecord(ctx context.Context, entity string, item map[string]interface{}, fetchedAt time.Time, counts *BackfillCounts) error {
+	switch entity {
+	case gateway.EntityOrders:
+		return s.importOrder(ctx, OrderViewOf(item), fetchedAt, counts)
+	case gateway.EntityPayments:
+		payment := PaymentViewOf(item)
+		status := paymentOrderStatus(payment.Status)
+		if status == "" {
+			counts.Skipped++
+			return nil
+		}
+		if err := s.postCapture(ctx, item); err != nil {
+			return fmt.Errorf("post payment %s: %w", payment.ID, err)
+		}
+		if payment.OrderID == "" {
+			counts.Written++
+			return nil
+		}
+		return s.importPayment(ctx, payment, status, fetchedAt, counts)
+	default:
+		if status, _ := item["status"].(string); status != "processed" {
+			counts.Skipped++
+			return nil
+		}
+		if err := s.postRefund(ctx, item); err != nil {
+			return fmt.Errorf("post refund: %w", err)
+		}
+		counts.Written++
+		return nil
+	}
+}
+
+// importOrder inserts an upstream order, or brings the stored one up to
+// date. Razorpay orders stay paid once refunded and know nothing of local
+// failures or expiry, so only paid moves a stored status.
+func (s *Service) importOrder(ctx context.Context, v OrderView, fetchedAt time.Time, counts *BackfillCounts) error {
+	if v.ID == "" {
+		counts.Skipped++
+		return nil
+	}
+	status := OrderCreated
+	if v.Status == RazorpayOrderPaid {
+		status = OrderPaid
+	}
+	currency := s.defaultCurrency(v.Currency)
+
+	outcome := &counts.Written
+	_, err := s.store.Update(ctx, v.ID, func(order *Order) error {
+		if s.keepLocal(order, fetchedAt) {
+			outcome = &counts.KeptLocal
+			return errBackfillUnchanged
+		}
+		changed := false
+		if order.Amount != v.Amount || order.Currency != currency || order.Receipt != v.Receipt || !maps.Equal(order.Notes, v.Notes) {
+			order.Amount, order.Currency, order.Receipt, order.Notes = v.Amount, currency, v.Receipt, v.Notes
+			changed = true
+		}
+		if status == OrderPaid && order.Status != OrderPaid && order.Status != OrderRefunded {
+			s.backfillStatus(order, OrderPaid)
+			changed = true
+		}
+		if !changed {
+			outcome = &counts.Unchanged
+			return errBackfillUnchanged
+		}
+		order.UpdatedAt = s.clock.Now()
+		return nil
+	})
+	switch {
+	case errors.Is(err, errBackfillUnchanged):
+	case errors.Is(err, ErrNotFound):
+		err = s.store.Save(ctx, Order{
+			ID:        v.ID,
+			Amount:    v.Amount,
+			Currency:  currency,
+			Receipt:   v.Receipt,
+			Status:    status,
+			Notes:     v.Notes,
+			CreatedAt: v.CreatedAt,
+			UpdatedAt: s.clock.Now(),
+			Timeline:  []TimelineEntry{{At: v.CreatedAt, Type: TimelineStatus, Author: backfillAuthor, To: status}},
+		})
+		if err != nil {
+			return fmt.Errorf("save order %s: %w", v.ID, err)
+		}
+	case err != nil:
+		return fmt.Errorf("update order %s: %w", v.ID, err)
+	}
+	*outcome++
+	return nil
+}
+
+// importPayment records a captured or refunded payment on its order
+func (s *Service) importPayment(ctx context.Context, payment PaymentView, status string, fetchedAt time.Time, counts *BackfillCounts) error {
+	outcome := &counts.Written
+	_, err := s.store.Update(ctx, payment.OrderID, func(order *Order) error {
+		if s.keepLocal(order, fetchedAt) {
+			outcome = &counts.KeptLocal
+			return errBackfillUnchanged
+		}
+		changed := false
+		if order.PaymentID != payment.ID {
+			order.PaymentID = payment.ID
+			changed = true
+		}
+		if order.Status != status && order.Status != OrderRefunded {
+			s.backfillStatus(order, status)
+			changed = true
+		}
+		if !changed {
+			outcome = &counts.Unchanged
+			return errBackfillUnchanged
+		}
+		order.UpdatedAt = s.clock.Now()
+		return nil
+	})
+	switch {
+	case errors.Is(err, errBackfillUnchanged):
+	case errors.Is(err, ErrNotFound):
+		// The ledger has the capture; the order was not backfilled
+		outcome = &counts.Skipped
+	case err != nil:
+		return fmt.Errorf("update order %s: %w", payment.OrderID, err)
+	}
+	*outcome++
+	return nil
+}
+
+// keepLocal reports whether a stored order wins over upstream: an operator
+// overrode its status, or live traffic updated it after the upstream copy
+// was fetched
+func (s *Service) keepLocal(order *Order, fetchedAt time.Time) bool {
+	return order.Override != nil || order.UpdatedAt.After(fetchedAt)
+}
+
+func (s *Service) backfillStatus(order *Order, status string) {
+	order.Timeline = append(order.Timeline, TimelineEntry{
+		At:     s.clock.Now(),
+		Type:   TimelineStatus,
+		Author: backfillAuthor,
+		From:   order.Status,
+		To:     status,
+	})
+	order.Status = status
+}
+
+// paymentOrderStatus is the order status a payment's status implies, empty
+// for payments that never took money
+func paymentOrderStatus(status string) string {
+	switch status {
+	case "captured":
+		return OrderPaid
+	case "refunded":
+		return OrderRefunded
+	}
+	return ""
+}
+
+// verifyRecord looks a record of entity up locally without writing,
+// comparing hashes of both copies when spotCheck is set. It returns a
+// description of the record when it is missing or differs.
+func (s *Service) verifyRecord(ctx context.Context, run *backfillRun, entity string, item map[string]interface{}, spotCheck bool, counts *BackfillCounts) (string, error) {
+	var id, upstream, local string
+	switch entity {
+	case gateway.EntityOrders:
+		v := OrderViewOf(item)
+		id = v.ID
+		order, err := s.store.Get(ctx, v.ID)
+		if errors.Is(err, ErrNotFound) {
+			counts.Missing++
+			return id + " missing", nil
+		} else if err != nil {
+			return "", fmt.Errorf("get order %s: %w", v.ID, err)
+		}
+		upstream = recordHash(v.ID, strconv.Itoa(v.Amount), s.defaultCurrency(v.Currency), v.Receipt, notesHash(v.Notes), strconv.FormatBool(v.Status == RazorpayOrderPaid))
+		local = recordHash(order.ID, strconv.Itoa(order.Amount), order.Currency, order.Receipt, notesHash(order.Notes), strconv.FormatBool(order.Status == OrderPaid || order.Status == OrderRefunded))
+
+	case gateway.EntityPayments:
+		payment := PaymentViewOf(item)
+		id = payment.ID
+		status := paymentOrderStatus(payment.Status)
+		if status == "" || payment.OrderID == "" {
+			counts.Skipped++
+			return "", nil
+		}
+		order, err := s.store.Get(ctx, payment.OrderID)
+		if errors.Is(err, ErrNotFound) {
+			counts.Missing++
+			return id + " of missing order " + payment.OrderID, nil
+		} else if err != nil {
+			return "", fmt.Errorf("get order %s: %w", payment.OrderID, err)
+		}
+		upstream = recordHash(payment.OrderID, payment.ID, status)
+		local = recordHash(order.ID, order.PaymentID, order.Status)
+
+	default:
+		id, _ = item["id"].(string)
+		if status, _ := item["status"].(string); status != "processed" {
+			counts.Skipped++
+			return "", nil
+		}
+		if run.refunds == nil {
+			if err := run.loadRefunds(ctx, s.ledger); err != nil {
+				return "", err
+			}
+		}
+		tx, ok := run.refunds[id]
+		if !ok {
+			counts.Missing++
+			return id + " missing from the ledger", nil
+		}
+		e := ledgerEntityOf(item)
+		upstream = recordHash(e.ID, e.Amount.String())
+		local = recordHash(tx.Reference, tx.Postings[0].String())
+	}
+
+	if !spotCheck {
+		return "", nil
+	}
+	counts.Checked++
+	if upstream != local {
+		counts.Mismatched++
+		return id + " differs (upstream " + upstream + ", local " + local + ")", nil
+	}
+	return "", nil
+}
+
+// loadRefunds indexes the ledger's refund postings by refund ID
+func (run *backfillRun) loadRefunds(ctx context.Context, ledger LedgerStore) error {
+	txs, err := ledger.Transactions(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		return fmt.Errorf("read ledger: %w", err)
+	}
+	run.refunds = make(map[string]LedgerTransaction)
+	for _, tx := range txs {
+		if tx.Kind == LedgerRefund && len(tx.Postings) > 0 {
+			run.refunds[tx.Reference] = tx
+		}
+	}
+	return nil
+}
+
+// recordHash is a short hash of the fields of a record compared when
+// verifying
+func recordHash(fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// notesHash is a hash of notes independent of their order
+func notesHash(notes map[string]string) string {
+	keys := make([]string, 0, len(notes))
+	for k := range notes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		fields = append(fields, k, notes[k])
+	}
+	return recordHash(fields...)
+}
+
+func (run *backfillRun) report() BackfillReport {
+	r := BackfillReport{
+		From:       run.cp.From,
+		To:         run.cp.To,
+		VerifyOnly: run.cp.VerifyOnly,
+		Resumed:    run.resumed,
+		Entities:   make(map[string]BackfillCounts, len(run.cp.Counts)),
+		Mismatches: run.cp.Mismatches,
+	}
+	for entity, counts := range run.cp.Counts {
+		r.Entities[entity] = counts
+	}
+	return r
+}
+
+// save writes the checkpoint, replacing the previous one whole so an
+// interruption never leaves half a file
+func (run *backfillRun) save() error {
+	path := run.req.Checkpoint
+	if path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(run.cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// finish removes the checkpoint of a completed backfill, so running it
+// again starts over
+func (run *backfillRun) finish() error {
+	if run.req.Checkpoint == "" {
+		return nil
+	}
+	if err := os.Remove(run.req.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// loadBackfillCheckpoint reads the checkpoint at path, nil when there is
+// none to resume from
+func loadBackfillCheckpoint(path string) (*backfillCheckpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	var cp backfillCheckpoint
+	if err := json.Unmarshal(raw, &cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint %s: %w", path, err)
+	}
+	if cp.Done == nil {
+		cp.Done = map[string]time.Time{}
+	}
+	if cp.Counts == nil {
+		cp.Counts = map[string]BackfillCounts{}
+	}
+	return &cp, nil
+}
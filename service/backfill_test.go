@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// backfillFrom is the first day of the history backfill tests import
+var backfillFrom = time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+// historyGateway lists the records it holds created within the from and to
+// of each listing, as Razorpay's list filters do, recording the windows
+// listed. The first rateLimits listings are rate limited.
+type historyGateway struct {
+	*fakeGateway
+
+	mu         sync.Mutex
+	records    map[string][]map[string]interface{}
+	rateLimits int
+	listed     []string
+}
+
+func (g *historyGateway) ListAll(ctx context.Context, entity string, params map[string]interface{}, opts gateway.ListOptions, fn func(item map[string]interface{}) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	if g.rateLimits > 0 {
+		g.rateLimits--
+		g.mu.Unlock()
+		return &gateway.RateLimitError{RetryAfter: time.Millisecond}
+	}
+	from, to := params["from"].(int64), params["to"].(int64)
+	g.listed = append(g.listed, entity+" "+time.Unix(from, 0).UTC().Format("01-02"))
+	var found []map[string]interface{}
+	for _, item := range g.records[entity] {
+		if created := int64(item["created_at"].(float64)); created >= from && created <= to {
+			found = append(found, copyMap(item))
+		}
+	}
+	g.mu.Unlock()
+	for _, item := range found {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *historyGateway) add(entity string, item map[string]interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.records[entity] = append(g.records[entity], item)
+}
+
+func (g *historyGateway) listings() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.listed...)
+}
+
+// day is the created_at of a record made d days into the backfill tests'
+// history
+func day(d int) float64 {
+	return float64(backfillFrom.Add(time.Duration(d)*24*time.Hour + time.Hour).Unix())
+}
+
+// newHistoryGateway holds three days of history: an order a day, the
+// second paid, a captured and a failed payment, and a processed refund
+func newHistoryGateway() *historyGateway {
+	return &historyGateway{fakeGateway: newFakeGateway(), records: map[string][]map[string]interface{}{
+		gateway.EntityOrders: {
+			{"id": "order_1", "amount": float64(50000), "currency": "INR", "receipt": "r1", "status": "created", "notes": map[string]interface{}{"sku": "A-1"}, "created_at": day(0)},
+			{"id": "order_2", "amount": float64(20000), "currency": "INR", "status": "paid", "created_at": day(1)},
+			{"id": "order_3", "amount": float64(10000), "currency": "INR", "status": "created", "created_at": day(2)},
+		},
+		gateway.EntityPayments: {
+			{"id": "pay_1", "order_id": "order_2", "amount": float64(20000), "currency": "INR", "status": "captured", "created_at": day(1)},
+			{"id": "pay_2", "order_id": "order_3", "amount": float64(10000), "currency": "INR", "status": "failed", "created_at": day(2)},
+		},
+		gateway.EntityRefunds: {
+			{"id": "rfnd_1", "payment_id": "pay_1", "amount": float64(5000), "currency": "INR", "status": "processed", "created_at": day(2)},
+		},
+	}}
+}
+
+func backfillRequest() BackfillRequest {
+	return BackfillRequest{From: backfillFrom, To: backfillFrom.Add(72 * time.Hour)}
+}
+
+func ledgerCount(t *testing.T, s *Service) int {
+	t.Helper()
+	txs, err := s.ledger.Transactions(context.Background(), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(txs)
+}
+
+func TestBackfillImportsHistory(t *testing.T) {
+	gw := newHistoryGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	ctx := context.Background()
+
+	runs := []struct {
+		name string
+		want map[string]BackfillCounts
+	}{
+		{"first", map[string]BackfillCounts{
+			gateway.EntityOrders:   {Seen: 3, Written: 3},
+			gateway.EntityPayments: {Seen: 2, Written: 1, Skipped: 1},
+			gateway.EntityRefunds:  {Seen: 1, Written: 1},
+		}},
+		{"again", map[string]BackfillCounts{
+			gateway.EntityOrders:   {Seen: 3, Unchanged: 3},
+			gateway.EntityPayments: {Seen: 2, Unchanged: 1, Skipped: 1},
+			gateway.EntityRefunds:  {Seen: 1, Written: 1},
+		}},
+	}
+	for _, run := range runs {
+		report, err := s.Backfill(ctx, backfillRequest())
+		if err != nil {
+			t.Fatalf("%s run: %v", run.name, err)
+		}
+		for entity, want := range run.want {
+			if got := report.Entities[entity]; got != want {
+				t.Fatalf("%s run: %s = %+v, want %+v", run.name, entity, got, want)
+			}
+		}
+		// The ledger records the capture and the refund once however often
+		// the backfill runs
+		if n := ledgerCount(t, s); n != 2 {
+			t.Fatalf("%s run: %d ledger transactions, want 2", run.name, n)
+		}
+	}
+
+	// A window a day for each entity, orders first
+	listed := gw.listings()
+	if len(listed) != 18 || listed[0] != "orders 02-01" || listed[2] != "orders 02-03" || listed[3] != "payments 02-01" {
+		t.Fatalf("listed %v, want three daily windows of each entity per run", listed)
+	}
+
+	tests := []struct {
+		id        string
+		status    string
+		paymentID string
+	}{
+		{"order_1", OrderCreated, ""},
+		{"order_2", OrderPaid, "pay_1"},
+		{"order_3", OrderCreated, ""},
+	}
+	for _, tt := range tests {
+		order, err := s.store.Get(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.id, err)
+		}
+		if order.Status != tt.status || order.PaymentID != tt.paymentID || order.CreatedAt.IsZero() {
+			t.Fatalf("%s = %s with payment %q, want %s with %q", tt.id, order.Status, order.PaymentID, tt.status, tt.paymentID)
+		}
+	}
+	order, _ := s.store.Get(ctx, "order_1")
+	if order.Amount != 50000 || order.Receipt != "r1" || order.Notes["sku"] != "A-1" || order.Timeline[0].Author != backfillAuthor {
+		t.Fatalf("order_1 = %+v, want the upstream fields and a backfill timeline", order)
+	}
+}
+
+func TestBackfillResumesFromCheckpoint(t *testing.T) {
+	gw := newHistoryGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// Interrupted after the first window
+	ctx, cancel := context.WithCancel(context.Background())
+	req := backfillRequest()
+	req.Checkpoint = path
+	req.Progress = func(BackfillProgress) { cancel() }
+	if _, err := s.Backfill(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted: err = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("checkpoint not saved: %v", err)
+	}
+
+	other := req
+	other.Window = 12 * time.Hour
+	if _, err := s.Backfill(context.Background(), other); err == nil || !strings.Contains(err.Error(), "another backfill") {
+		t.Fatalf("other backfill: err = %v, want the checkpoint refused", err)
+	}
+
+	var progress []BackfillProgress
+	req.Progress = func(p BackfillProgress) { progress = append(progress, p) }
+	req.To = time.Time{}
+	report, err := s.Backfill(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Resumed || !report.To.Equal(backfillFrom.Add(72*time.Hour)) {
+		t.Fatalf("report = %+v, want resumed up to the checkpoint's end", report)
+	}
+	if got := report.Entities[gateway.EntityOrders]; got.Seen != 3 || got.Written != 3 {
+		t.Fatalf("orders = %+v, want the first window's counted too", got)
+	}
+	if listed := gw.listings(); len(listed) != 9 || listed[1] != "orders 02-02" {
+		t.Fatalf("listed %v, want the first window once and the rest after it", listed)
+	}
+	if len(progress) != 8 || progress[0].Done != 2 || progress[7].Done != 9 || progress[7].Windows != 9 {
+		t.Fatalf("progress = %+v, want windows 2 to 9 of 9", progress)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("checkpoint kept after completing: %v", err)
+	}
+}
+
+func TestBackfillConflicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		updatedAgo time.Duration
+		override   bool
+		want       BackfillCounts
+		wantAmount int
+	}{
+		{"upstream fresher", time.Hour, false, BackfillCounts{Seen: 1, Written: 1}, 50000},
+		{"updated after the fetch", -time.Minute, false, BackfillCounts{Seen: 1, KeptLocal: 1}, 999},
+		{"overridden", time.Hour, true, BackfillCounts{Seen: 1, KeptLocal: 1}, 999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newHistoryGateway()
+			s, clk := newTestService(t, gw, testConfig(t))
+			ctx := context.Background()
+			local := Order{ID: "order_1", Amount: 999, Currency: "INR", Status: OrderCreated, UpdatedAt: clk.Now().Add(-tt.updatedAgo)}
+			if tt.override {
+				local.Override = &StatusOverride{Status: OrderCreated, Reason: "held", Author: "ops"}
+			}
+			if err := s.store.Save(ctx, local); err != nil {
+				t.Fatal(err)
+			}
+
+			req := backfillRequest()
+			req.Entities = []string{gateway.EntityOrders}
+			req.To = backfillFrom.Add(24 * time.Hour)
+			report, err := s.Backfill(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := report.Entities[gateway.EntityOrders]; got != tt.want {
+				t.Fatalf("orders = %+v, want %+v", got, tt.want)
+			}
+			order, _ := s.store.Get(ctx, "order_1")
+			if order.Amount != tt.wantAmount {
+				t.Fatalf("amount = %d, want %d", order.Amount, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestBackfillVerify(t *testing.T) {
+	gw := newHistoryGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	ctx := context.Background()
+	if _, err := s.Backfill(ctx, backfillRequest()); err != nil {
+		t.Fatal(err)
+	}
+	verify := backfillRequest()
+	verify.VerifyOnly = true
+
+	report, err := s.Backfill(ctx, verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for entity, counts := range report.Entities {
+		if counts.Missing != 0 || counts.Mismatched != 0 || counts.Written != 0 {
+			t.Fatalf("%s = %+v after importing, want nothing missing, differing or written", entity, counts)
+		}
+	}
+
+	// order_1 is the first record verified, so it is spot-checked
+	if _, err := s.store.Update(ctx, "order_1", func(o *Order) error {
+		o.Amount = 999
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	gw.add(gateway.EntityOrders, map[string]interface{}{"id": "order_4", "amount": float64(100), "currency": "INR", "status": "created", "created_at": day(2)})
+
+	report, err = s.Backfill(ctx, verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := report.Entities[gateway.EntityOrders], (BackfillCounts{Seen: 4, Missing: 1, Checked: 1, Mismatched: 1}); got != want {
+		t.Fatalf("orders = %+v, want %+v", got, want)
+	}
+	if len(report.Mismatches) != 2 || !strings.HasPrefix(report.Mismatches[0], "order_1 differs") || report.Mismatches[1] != "order_4 missing" {
+		t.Fatalf("mismatches = %q, want order_1 differing and order_4 missing", report.Mismatches)
+	}
+	if _, err := s.store.Get(ctx, "order_4"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("order_4: err = %v, verifying wrote it", err)
+	}
+	if order, _ := s.store.Get(ctx, "order_1"); order.Amount != 999 {
+		t.Fatalf("order_1 amount = %d, verifying overwrote it", order.Amount)
+	}
+	if n := ledgerCount(t, s); n != 2 {
+		t.Fatalf("%d ledger transactions, verifying posted", n)
+	}
+}
+
+func TestBackfillRateLimited(t *testing.T) {
+	tests := []struct {
+		name       string
+		rateLimits int
+		wantErr    bool
+	}{
+		{"retried", 2, false},
+		{"gives up", backfillMaxRateLimits, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newHistoryGateway()
+			gw.rateLimits = tt.rateLimits
+			s, _ := newTestService(t, gw, testConfig(t))
+			req := backfillRequest()
+			req.Entities = []string{gateway.EntityOrders}
+
+			report, err := s.Backfill(context.Background(), req)
+			var rl *gateway.RateLimitError
+			if tt.wantErr {
+				if !errors.As(err, &rl) {
+					t.Fatalf("err = %v, want the rate limit", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The retried window counts its last listing only
+			if got := report.Entities[gateway.EntityOrders]; got.Seen != 3 || got.Written != 3 {
+				t.Fatalf("orders = %+v, want each order counted once", got)
+			}
+		})
+	}
+}
+
+func TestBackfillInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  BackfillRequest
+		want string
+	}{
+		{"no from", BackfillRequest{To: backfillFrom}, "from is required"},
+		{"short window", BackfillRequest{From: backfillFrom, Window: time.Second}, "window must be"},
+		{"unknown entity", BackfillRequest{From: backfillFrom, Entities: []string{"invoices"}}, `cannot backfill "invoices"`},
+		{"from after to", BackfillRequest{From: backfillFrom, To: backfillFrom.Add(-time.Hour)}, "from must be before to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t, newHistoryGateway(), testConfig(t))
+			_, err := s.Backfill(context.Background(), tt.req)
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want a validation error about %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yash170603/golang_payment/authctx"
+)
+
+// Brand is a consumer brand sold through the shared Razorpay account. Its
+// name, logo and color dress checkout; its sender signs its emails.
+type Brand struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LogoURL     string `json:"logo_url,omitempty"`
+	// Color is the checkout theme color as #RGB or #RRGGBB
+	Color        string `json:"color,omitempty"`
+	SupportEmail string `json:"support_email,omitempty"`
+	// ReceiptTemplateDir may hold a receipt.html template replacing the
+	// built-in receipt
+	ReceiptTemplateDir string `json:"receipt_template_dir,omitempty"`
+	// EmailFrom overrides NOTIFY_EMAIL_FROM for the brand's emails
+	EmailFrom string `json:"email_from,omitempty"`
+}
+
+// UnknownBrandError is a brand that is not configured
+type UnknownBrandError struct {
+	Brand string
+	Valid []string
+}
+
+func (e *UnknownBrandError) Error() string {
+	return fmt.Sprintf("unknown brand %q, use one of %s", e.Brand, strings.Join(e.Valid, ", "))
+}
+
+// Brands are the configured branding profiles and the one applied when a
+// request names none
+type Brands struct {
+	brands map[string]Brand
+	def    string
+}
+
+// WithBrands enables per-brand checkout and notifications
+func WithBrands(b *Brands) Option {
+	return func(s *Service) {
+		s.brands = b
+	}
+}
+
+// LoadBrands reads a JSON array of brands from path. def names the default
+// brand and must be one of them; it may be empty to require a brand on
+// every order.
+func LoadBrands(path, def string) (*Brands, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Brand
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	b := &Brands{brands: make(map[string]Brand, len(list)), def: def}
+	for _, brand := range list {
+		if err := checkBrand(brand); err != nil {
+			return nil, fmt.Errorf("brand %q: %w", brand.Name, err)
+		}
+		if _, dup := b.brands[brand.Name]; dup {
+			return nil, fmt.Errorf("duplicate brand %q", brand.Name)
+		}
+		b.brands[brand.Name] = brand
+	}
+	if _, ok := b.brands[def]; def != "" && !ok {
+		return nil, fmt.Errorf("default brand %q is not in %s", def, path)
+	}
+	return b, nil
+}
+
+// checkBrand rejects a brand checkout or email could not use
+func checkBrand(b Brand) error {
+	if b.Name == "" || b.DisplayName == "" {
+		return fmt.Errorf("name and display_name are required")
+	}
+	if b.Color != "" && !hexColor.MatchString(b.Color) {
+		return fmt.Errorf("color must be #RGB or #RRGGBB")
+	}
+	if b.LogoURL != "" {
+		if u, err := url.Parse(b.LogoURL); err != nil || !u.IsAbs() || u.Host == "" {
+			return fmt.Errorf("logo_url must be an absolute URL")
+		}
+	}
+	if b.ReceiptTemplateDir != "" {
+		if info, err := os.Stat(b.ReceiptTemplateDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("receipt_template_dir %s is not a directory", b.ReceiptTemplateDir)
+		}
+		if _, err := loadReceiptTemplate(b.ReceiptTemplateDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names lists the configured brands in order
+func (b *Brands) Names() []string {
+	names := make([]string, 0, len(b.brands))
+	for name := range b.brands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Senders maps each brand with its own sender to that address
+func (b *Brands) Senders() map[string]string {
+	senders := map[string]string{}
+	for name, brand := range b.brands {
+		if brand.EmailFrom != "" {
+			senders[name] = brand.EmailFrom
+		}
+	}
+	return senders
+}
+
+// resolveBrand picks the brand of a new order: requested, else the one the
+// calling API key belongs to, else the default. It is nil when no brands
+// are configured, or none applies.
+func (s *Service) resolveBrand(ctx context.Context, requested string) (*Brand, error) {
+	if s.brands == nil {
+		if requested != "" {
+			return nil, invalidRequest("brands are not configured")
+		}
+		return nil, nil
+	}
+	name := requested
+	if name == "" {
+		if caller, ok := authctx.Principal(ctx); ok {
+			name = caller.Brand
+		}
+	}
+	if name == "" {
+		name = s.brands.def
+	}
+	if name == "" {
+		return nil, nil
+	}
+	brand, ok := s.brands.brands[name]
+	if !ok {
+		return nil, &UnknownBrandError{Brand: name, Valid: s.brands.Names()}
+	}
+	return &brand, nil
+}
+
+// brandName is the name of b, empty for no brand
+func brandName(b *Brand) string {
+	if b == nil {
+		return ""
+	}
+	return b.Name
+}
+
+// brandCheckout dresses the checkout options in the brand's name, logo and
+// color
+func brandCheckout(checkout map[string]interface{}, b *Brand) {
+	if b == nil {
+		return
+	}
+	checkout["name"] = b.DisplayName
+	if b.LogoURL != "" {
+		checkout["image"] = b.LogoURL
+	}
+	if b.Color != "" {
+		checkout["theme"] = map[string]string{"color": b.Color}
+	}
+}
+
+// orderBrand is the brand recorded on the order, empty when it has none or
+// the order is unknown
+func (s *Service) orderBrand(ctx context.Context, orderID string) string {
+	order, err := s.store.Get(ctx, orderID)
+	if err != nil {
+		return ""
+	}
+	return order.Brand
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/notify"
+)
+
+const testBrands = `[
+	{"name": "acme", "display_name": "Acme", "logo_url": "https://cdn.example.com/acme.png", "color": "#ff6600", "email_from": "orders@acme.example.com"},
+	{"name": "zed", "display_name": "Zed Store"}
+]`
+
+// writeBrands writes brands to a file in a temporary directory
+func writeBrands(t *testing.T, brands string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "brands.json")
+	if err := os.WriteFile(path, []byte(brands), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBrands(t *testing.T) {
+	tests := []struct {
+		name    string
+		brands  string
+		def     string
+		wantErr string
+	}{
+		{"valid", testBrands, "acme", ""},
+		{"no default", testBrands, "", ""},
+		{"unknown default", testBrands, "other", "default brand"},
+		{"duplicate", `[{"name": "a", "display_name": "A"}, {"name": "a", "display_name": "A again"}]`, "", "duplicate"},
+		{"no display name", `[{"name": "a"}]`, "", "display_name"},
+		{"bad color", `[{"name": "a", "display_name": "A", "color": "orange"}]`, "", "color"},
+		{"relative logo", `[{"name": "a", "display_name": "A", "logo_url": "/acme.png"}]`, "", "logo_url"},
+		{"missing template dir", `[{"name": "a", "display_name": "A", "receipt_template_dir": "/nonexistent"}]`, "", "receipt_template_dir"},
+		{"not JSON", `{`, "", "parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := LoadBrands(writeBrands(t, tt.brands), tt.def)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := b.Names(); !reflect.DeepEqual(names, []string{"acme", "zed"}) {
+				t.Fatalf("names = %v, want acme and zed", names)
+			}
+			if senders := b.Senders(); !reflect.DeepEqual(senders, map[string]string{"acme": "orders@acme.example.com"}) {
+				t.Fatalf("senders = %v, want acme's only", senders)
+			}
+		})
+	}
+}
+
+func brandService(t *testing.T, gw *fakeGateway, def string, opts ...Option) *Service {
+	t.Helper()
+	brands, err := LoadBrands(writeBrands(t, testBrands), def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestService(t, gw, testConfig(t), append(opts, WithBrands(brands))...)
+	return s
+}
+
+// asKey is a context authenticated as an API key selling under brand
+func asKey(brand string) context.Context {
+	return authctx.WithPrincipal(context.Background(), authctx.Identity{Kind: authctx.KindAPIKey, ID: "shop", Brand: brand})
+}
+
+func TestOrderBrand(t *testing.T) {
+	tests := []struct {
+		name      string
+		def       string
+		ctx       context.Context
+		requested string
+		want      string
+		unknown   bool
+	}{
+		{"requested", "acme", context.Background(), "zed", "zed", false},
+		{"from the API key", "acme", asKey("zed"), "", "zed", false},
+		{"requested over the API key", "", asKey("zed"), "acme", "acme", false},
+		{"default", "acme", context.Background(), "", "acme", false},
+		{"none", "", context.Background(), "", "", false},
+		{"unknown", "acme", context.Background(), "other", "", true},
+		{"unknown on the API key", "", asKey("other"), "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s := brandService(t, gw, tt.def)
+			order, err := s.CreateOrder(tt.ctx, PaymentRequest{Amount: 50000, Brand: tt.requested})
+			if tt.unknown {
+				var unknown *UnknownBrandError
+				if !errors.As(err, &unknown) || !reflect.DeepEqual(unknown.Valid, []string{"acme", "zed"}) {
+					t.Fatalf("err = %v, want an unknown brand listing the valid ones", err)
+				}
+				if gw.created != 0 {
+					t.Fatal("order created for an unknown brand")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := order["id"].(string)
+			if got, _ := order["brand"].(string); got != tt.want {
+				t.Fatalf("order brand = %q, want %q", got, tt.want)
+			}
+			if stored, _ := s.store.Get(context.Background(), id); stored.Brand != tt.want {
+				t.Fatalf("stored brand = %q, want %q", stored.Brand, tt.want)
+			}
+		})
+	}
+
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	var invalid *ValidationError
+	if _, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 50000, Brand: "acme"}); !errors.As(err, &invalid) {
+		t.Fatalf("brand without brands configured: err = %v, want a validation error", err)
+	}
+}
+
+func TestCheckoutBranded(t *testing.T) {
+	tests := []struct {
+		brand string
+		want  map[string]interface{}
+	}{
+		{"acme", map[string]interface{}{"name": "Acme", "image": "https://cdn.example.com/acme.png", "theme": map[string]string{"color": "#ff6600"}}},
+		{"zed", map[string]interface{}{"name": "Zed Store", "image": nil, "theme": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.brand, func(t *testing.T) {
+			s := brandService(t, newFakeGateway(), "")
+			session, err := s.CreateCheckoutSession(context.Background(), CheckoutSessionRequest{Amount: 500, Brand: tt.brand})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.want {
+				if got := session.Checkout[k]; !reflect.DeepEqual(got, v) {
+					t.Fatalf("checkout %s = %v, want %v", k, got, v)
+				}
+			}
+			if stored, _ := s.store.Get(context.Background(), session.OrderID); stored.Brand != tt.brand {
+				t.Fatalf("stored brand = %q, want %q", stored.Brand, tt.brand)
+			}
+		})
+	}
+}
+
+func TestVerifiedEventCarriesBrand(t *testing.T) {
+	gw := newFakeGateway()
+	ch := &recordingChannel{events: make(chan notify.Event, 10)}
+	n := notify.New(notify.Options{}, ch)
+	defer n.Shutdown(context.Background())
+	s := brandService(t, gw, "", WithNotifier(n))
+	order, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 500, Brand: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderID := order["id"].(string)
+	gw.pay("pay_1", orderID, 500, "INR")
+	if _, err := s.VerifyPayment(context.Background(), PaymentVerificationRequest{
+		ServerOrderID:     orderID,
+		RazorpayPaymentID: "pay_1",
+		RazorpaySignature: paymentSignature(orderID, "pay_1", testSecret),
+		OrderToken:        order["order_token"].(string),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ev, ok := verifiedEvent(ch, time.Second)
+	if !ok {
+		t.Fatal("no payment.verified event")
+	}
+	if ev.Data["brand"] != "acme" {
+		t.Fatalf("event data = %v, want the order's brand", ev.Data)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Capture policy actions
+const (
+	CaptureNow  = "capture"
+	CaptureHold = "hold"
+	CaptureVoid = "void"
+)
+
+// CaptureRule matches authorized payments; every condition set must hold
+type CaptureRule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// MinAmount and MaxAmount bound the amount in minor units; zero is open
+	MinAmount int      `json:"min_amount,omitempty"`
+	MaxAmount int      `json:"max_amount,omitempty"`
+	Methods   []string `json:"methods,omitempty"`
+	// Notes must all be present on the payment with these values
+	Notes map[string]string `json:"notes,omitempty"`
+	// Blocked matches on whether the customer is on the policy blocklist
+	Blocked *bool `json:"blocked,omitempty"`
+}
+
+// CapturePolicy decides what happens to each authorized payment. Rules are
+// tried in order and the first match wins; Default applies otherwise.
+type CapturePolicy struct {
+	Default string        `json:"default"`
+	Rules   []CaptureRule `json:"rules"`
+	// Blocklist holds customer emails and contacts that are never trusted
+	Blocklist []string `json:"blocklist,omitempty"`
+
+	blocked map[string]bool
+}
+
+// authorizedPayment is the part of a payment entity the policy reads
+type authorizedPayment struct {
+	ID        string            `json:"id"`
+	OrderID   string            `json:"order_id"`
+	Amount    int               `json:"amount"`
+	Currency  string            `json:"currency"`
+	Method    string            `json:"method"`
+	Email     string            `json:"email"`
+	Contact   string            `json:"contact"`
+	Notes     map[string]string `json:"notes"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+// UnmarshalJSON accepts Razorpay's empty-array notes
+func (p *authorizedPayment) UnmarshalJSON(b []byte) error {
+	type plain authorizedPayment
+	var raw struct {
+		plain
+		Notes json.RawMessage `json:"notes"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*p = authorizedPayment(raw.plain)
+	if len(raw.Notes) > 0 && raw.Notes[0] == '{' {
+		return json.Unmarshal(raw.Notes, &p.Notes)
+	}
+	return nil
+}
+
+// loadCapturePolicy reads and checks the policy at path. An empty path
+// yields nil, leaving authorized payments to operations as before.
+func loadCapturePolicy(path string) (*CapturePolicy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &CapturePolicy{}
+	if err := json.Unmarshal(raw, policy); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if policy.Default == "" {
+		policy.Default = CaptureHold
+	}
+	if !validCaptureAction(policy.Default) {
+		return nil, fmt.Errorf("capture policy default: unknown action %q", policy.Default)
+	}
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("capture rule %d: name is required", i)
+		}
+		if !validCaptureAction(rule.Action) {
+			return nil, fmt.Errorf("capture rule %q: unknown action %q", rule.Name, rule.Action)
+		}
+	}
+	policy.blocked = make(map[string]bool, len(policy.Blocklist))
+	for _, v := range policy.Blocklist {
+		policy.blocked[strings.ToLower(v)] = true
+	}
+	return policy, nil
+}
+
+func validCaptureAction(action string) bool {
+	return action == CaptureNow || action == CaptureHold || action == CaptureVoid
+}
+
+// evaluate returns the action for payment and the name of the rule that
+// chose it, "default" when none matched
+func (policy *CapturePolicy) evaluate(payment authorizedPayment) (action, rule string) {
+	blocked := policy.blocked[strings.ToLower(payment.Email)] || policy.blocked[strings.ToLower(payment.Contact)]
+	for _, r := range policy.Rules {
+		if r.matches(payment, blocked) {
+			return r.Action, r.Name
+		}
+	}
+	return policy.Default, "default"
+}
+
+func (r CaptureRule) matches(payment authorizedPayment, blocked bool) bool {
+	if r.MinAmount > 0 && payment.Amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount > 0 && payment.Amount > r.MaxAmount {
+		return false
+	}
+	if len(r.Methods) > 0 && !contains(r.Methods, payment.Method) {
+		return false
+	}
+	for k, v := range r.Notes {
+		if payment.Notes[k] != v {
+			return false
+		}
+	}
+	if r.Blocked != nil && *r.Blocked != blocked {
+		return false
+	}
+	return true
+}
+
+// capturePolicyHolder serves the current policy and swaps it on reload
+type capturePolicyHolder struct {
+	path    string
+	current atomic.Pointer[CapturePolicy]
+}
+
+func newCapturePolicyHolder(path string) (*capturePolicyHolder, error) {
+	policy, err := loadCapturePolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	h := &capturePolicyHolder{path: path}
+	h.current.Store(policy)
+	return h, nil
+}
+
+// reload swaps in a freshly loaded policy, keeping the previous one when
+// the file fails to load
+func (h *capturePolicyHolder) reload() error {
+	if h.path == "" {
+		return nil
+	}
+	policy, err := loadCapturePolicy(h.path)
+	if err != nil {
+		return err
+	}
+	h.current.Store(policy)
+	return nil
+}
+
+func (h *capturePolicyHolder) policy() *CapturePolicy {
+	return h.current.Load()
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+const testCapturePolicy = `{
+  "default": "hold",
+  "blocklist": ["Fraud@Example.com", "+919999999999"],
+  "rules": [
+    {"name": "blocked", "action": "void", "blocked": true},
+    {"name": "large", "action": "hold", "min_amount": 1000000},
+    {"name": "ready", "action": "capture", "notes": {"fulfillment_ready": "true"}},
+    {"name": "small-upi", "action": "capture", "max_amount": 50000, "methods": ["upi"]}
+  ]
+}`
+
+// writeCapturePolicy writes policy to a temporary file and returns its path
+func writeCapturePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture.json")
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCapturePolicyEvaluate(t *testing.T) {
+	policy, err := loadCapturePolicy(writeCapturePolicy(t, testCapturePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		payment    authorizedPayment
+		wantAction string
+		wantRule   string
+	}{
+		{"small upi", authorizedPayment{Amount: 50000, Method: "upi"}, CaptureNow, "small-upi"},
+		{"small card", authorizedPayment{Amount: 50000, Method: "card"}, CaptureHold, "default"},
+		{"upi over the limit", authorizedPayment{Amount: 50001, Method: "upi"}, CaptureHold, "default"},
+		{"fulfillment ready", authorizedPayment{Amount: 200000, Method: "card", Notes: map[string]string{"fulfillment_ready": "true"}}, CaptureNow, "ready"},
+		{"not ready", authorizedPayment{Amount: 200000, Method: "card", Notes: map[string]string{"fulfillment_ready": "false"}}, CaptureHold, "default"},
+		// The first matching rule wins
+		{"large and ready", authorizedPayment{Amount: 1000000, Notes: map[string]string{"fulfillment_ready": "true"}}, CaptureHold, "large"},
+		{"blocked email", authorizedPayment{Amount: 100, Method: "upi", Email: "fraud@example.com"}, CaptureVoid, "blocked"},
+		{"blocked contact", authorizedPayment{Amount: 100, Method: "upi", Contact: "+919999999999"}, CaptureVoid, "blocked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, rule := policy.evaluate(tt.payment)
+			if action != tt.wantAction || rule != tt.wantRule {
+				t.Fatalf("evaluate = %s by %q, want %s by %q", action, rule, tt.wantAction, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoadCapturePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{"default defaults to hold", `{"rules": []}`, ""},
+		{"unknown default", `{"default": "refund"}`, "unknown action"},
+		{"unknown rule action", `{"rules": [{"name": "r", "action": "maybe"}]}`, "unknown action"},
+		{"unnamed rule", `{"rules": [{"action": "capture"}]}`, "name is required"},
+		{"not JSON", `rules:`, "parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := loadCapturePolicy(writeCapturePolicy(t, tt.policy))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || policy.Default != CaptureHold {
+				t.Fatalf("policy = %+v, %v, want the hold default", policy, err)
+			}
+		})
+	}
+	if policy, err := loadCapturePolicy(""); policy != nil || err != nil {
+		t.Fatalf("no file: %v, %v, want no policy", policy, err)
+	}
+}
+
+// capturePolicyService returns a service applying the policy at path,
+// with payment pay_1 of amount authorized
+func capturePolicyService(t *testing.T, path string, amount int) (*Service, *fakeGateway, *clock.Fake) {
+	t.Helper()
+	gw := newFakeGateway()
+	cfg := testConfig(t)
+	cfg.CapturePolicyFile = path
+	s, clk := newTestService(t, gw, cfg)
+	gw.pay("pay_1", "order_1", amount, "INR")
+	return s, gw, clk
+}
+
+func TestApplyCapturePolicy(t *testing.T) {
+	path := writeCapturePolicy(t, testCapturePolicy)
+	tests := []struct {
+		name         string
+		payment      authorizedPayment
+		wantCaptured bool
+		wantStatus   string
+	}{
+		{"captured", authorizedPayment{ID: "pay_1", Amount: 500, Currency: "INR", Method: "upi"}, true, ""},
+		{"held", authorizedPayment{ID: "pay_1", Amount: 500, Currency: "INR", Method: "card"}, false, ReviewPending},
+		{"voided", authorizedPayment{ID: "pay_1", Amount: 500, Currency: "INR", Method: "upi", Email: "fraud@example.com"}, false, ReviewRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, gw, _ := capturePolicyService(t, path, tt.payment.Amount)
+			if err := s.applyCapturePolicy(context.Background(), tt.payment); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(gw.captured) == 1; got != tt.wantCaptured {
+				t.Fatalf("captured %v, want captured %v", gw.captured, tt.wantCaptured)
+			}
+			reviews := s.CaptureReviews()
+			if tt.wantStatus == "" {
+				if len(reviews) != 0 {
+					t.Fatalf("reviews = %+v, want none", reviews)
+				}
+				return
+			}
+			if len(reviews) != 1 || reviews[0].Status != tt.wantStatus || reviews[0].PaymentID != "pay_1" {
+				t.Fatalf("reviews = %+v, want pay_1 %s", reviews, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCaptureReviewDecisions(t *testing.T) {
+	path := writeCapturePolicy(t, testCapturePolicy)
+	held := authorizedPayment{ID: "pay_1", Amount: 500, Currency: "INR", Method: "card"}
+	ctx := context.Background()
+
+	t.Run("approve", func(t *testing.T) {
+		s, gw, _ := capturePolicyService(t, path, 500)
+		s.applyCapturePolicy(ctx, held)
+		hold, err := s.ApproveCapture(ctx, "pay_1", ReviewDecision{Author: "ops", Reason: "verified by phone"})
+		if err != nil || hold.Status != ReviewApproved || hold.DecidedBy != "ops" {
+			t.Fatalf("approve = %+v, %v", hold, err)
+		}
+		if len(gw.captured) != 1 {
+			t.Fatalf("captured %v, want pay_1", gw.captured)
+		}
+		if _, err := s.RejectCapture(ctx, "pay_1", ReviewDecision{Author: "ops"}); !errors.Is(err, ErrReviewClosed) {
+			t.Fatalf("second decision: err = %v, want ErrReviewClosed", err)
+		}
+	})
+	t.Run("reject", func(t *testing.T) {
+		s, gw, _ := capturePolicyService(t, path, 500)
+		s.applyCapturePolicy(ctx, held)
+		if hold, err := s.RejectCapture(ctx, "pay_1", ReviewDecision{Author: "ops"}); err != nil || hold.Status != ReviewRejected {
+			t.Fatalf("reject = %+v, %v", hold, err)
+		}
+		if len(gw.captured) != 0 {
+			t.Fatalf("captured %v after rejection", gw.captured)
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		s, _, _ := capturePolicyService(t, path, 500)
+		if _, err := s.ApproveCapture(ctx, "pay_missing", ReviewDecision{}); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCaptureHoldDeadline(t *testing.T) {
+	s, _, clk := capturePolicyService(t, writeCapturePolicy(t, testCapturePolicy), 500)
+	s.applyCapturePolicy(context.Background(), authorizedPayment{ID: "pay_1", Amount: 500, Currency: "INR", Method: "card"})
+	hold := s.CaptureReviews()[0]
+	// The default five-day window less the default hour of margin
+	if want := hold.HeldAt.Add(5*24*time.Hour - time.Hour); !hold.VoidBy.Equal(want) {
+		t.Fatalf("VoidBy = %s, want %s", hold.VoidBy, want)
+	}
+
+	clk.Advance(5*24*time.Hour - time.Hour - time.Second)
+	s.sweepCaptureHolds()
+	if got := s.CaptureReviews()[0].Status; got != ReviewPending {
+		t.Fatalf("before the deadline: status = %s, want pending", got)
+	}
+	clk.Advance(time.Second)
+	s.sweepCaptureHolds()
+	if got := s.CaptureReviews()[0].Status; got != ReviewExpired {
+		t.Fatalf("at the deadline: status = %s, want expired", got)
+	}
+}
+
+func TestReloadCapturePolicy(t *testing.T) {
+	path := writeCapturePolicy(t, `{"default": "hold"}`)
+	s, gw, _ := capturePolicyService(t, path, 500)
+	payment := authorizedPayment{ID: "pay_1", Amount: 500, Currency: "INR", Method: "upi"}
+
+	if err := os.WriteFile(path, []byte(`{"default": "capture"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadCapturePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	// A broken file leaves the reloaded policy in place
+	if err := os.WriteFile(path, []byte(`{"default": "maybe"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadCapturePolicy(); err == nil {
+		t.Fatal("reloading a broken policy succeeded")
+	}
+
+	if err := s.applyCapturePolicy(context.Background(), payment); err != nil {
+		t.Fatal(err)
+	}
+	if len(gw.captured) != 1 {
+		t.Fatalf("captured %v, want the reloaded policy to capture", gw.captured)
+	}
+}
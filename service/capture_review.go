@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// Review states of a held payment
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+	// ReviewExpired holds were released by the deadline job before anyone
+	// decided
+	ReviewExpired = "expired"
+)
+
+// captureSweepInterval is how often holds are checked against their deadline
+const captureSweepInterval = time.Minute
+
+// ErrReviewClosed is a decision on a hold that was already decided
+var ErrReviewClosed = errors.New("payment review already closed")
+
+// HeldPayment is an authorized payment waiting for an operator decision
+type HeldPayment struct {
+	PaymentID string `json:"payment_id"`
+	OrderID   string `json:"order_id,omitempty"`
+	Amount    int    `json:"amount"`
+	Currency  string `json:"currency"`
+	Method    string `json:"method,omitempty"`
+	// Rule is the policy rule that held the payment
+	Rule   string    `json:"rule"`
+	Status string    `json:"status"`
+	HeldAt time.Time `json:"held_at"`
+	// VoidBy is when the deadline job releases the hold, ahead of Razorpay's
+	// authorization expiry
+	VoidBy    time.Time  `json:"void_by"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// ReviewDecision is an operator approving or rejecting a hold
+type ReviewDecision struct {
+	Reason string `json:"reason"`
+	Author string `json:"-"`
+}
+
+// captureReviews is the queue of held payments
+type captureReviews struct {
+	mu    sync.Mutex
+	holds map[string]*HeldPayment
+}
+
+// applyCapturePolicy evaluates the policy for a payment.authorized event
+// and captures, holds or releases the payment accordingly
+func (s *Service) applyCapturePolicy(ctx context.Context, payment authorizedPayment) error {
+	policy := s.capturePolicy.policy()
+	if policy == nil {
+		return nil
+	}
+
+	action, rule := policy.evaluate(payment)
+	log.Printf("Capture policy for payment %s (order %s, %d %s, %s): rule %q -> %s",
+		payment.ID, payment.OrderID, payment.Amount, payment.Currency, payment.Method, rule, action)
+
+	if action == CaptureNow {
+		_, err := s.CapturePayment(ctx, payment.ID, CaptureRequest{Amount: payment.Amount, Currency: payment.Currency})
+		return err
+
+	}
+
+	now := s.clock.Now()
+	authorizedAt := time.Unix(payment.CreatedAt, 0)
+	if payment.CreatedAt == 0 {
+		authorizedAt = now
+	}
+	hold := &HeldPayment{
+		PaymentID: payment.ID,
+		OrderID:   payment.OrderID,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		Method:    payment.Method,
+		Rule:      rule,
+		Status:    ReviewPending,
+		HeldAt:    now,
+		VoidBy:    authorizedAt.Add(s.cfg.CaptureAuthWindow - s.cfg.CaptureVoidMargin),
+	}
+	if action == CaptureVoid {
+		// Razorpay has no void call; an uncaptured authorization is
+		// released back to the customer when it expires. The entry keeps
+		// the decision visible in the review queue.
+		hold.Status = ReviewRejected
+		hold.DecidedBy = "policy"
+		hold.DecidedAt = &now
+		hold.Reason = "voided by rule " + rule
+	}
+
+	s.reviews.mu.Lock()
+	defer s.reviews.mu.Unlock()
+	if _, ok := s.reviews.holds[payment.ID]; !ok {
+		s.reviews.holds[payment.ID] = hold
+	}
+	return nil
+}
+
+// CaptureReviews lists held payments, oldest first
+func (s *Service) CaptureReviews() []HeldPayment {
+	s.reviews.mu.Lock()
+	defer s.reviews.mu.Unlock()
+
+	holds := make([]HeldPayment, 0, len(s.reviews.holds))
+	for _, h := range s.reviews.holds {
+		holds = append(holds, *h)
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].HeldAt.Before(holds[j].HeldAt) })
+	return holds
+}
+
+// ApproveCapture captures a held payment
+func (s *Service) ApproveCapture(ctx context.Context, paymentID string, d ReviewDecision) (HeldPayment, error) {
+	hold, err := s.decide(paymentID, ReviewApproved, d)
+	if err != nil {
+		return HeldPayment{}, err
+	}
+	if _, err := s.CapturePayment(ctx, paymentID, CaptureRequest{Amount: hold.Amount, Currency: hold.Currency}); err != nil {
+		// Reopen the hold so the approval can be retried
+		s.reviews.mu.Lock()
+		if h, ok := s.reviews.holds[paymentID]; ok {
+			h.Status, h.DecidedBy, h.DecidedAt, h.Reason = ReviewPending, "", nil, ""
+		}
+		s.reviews.mu.Unlock()
+		return HeldPayment{}, err
+	}
+	return hold, nil
+}
+
+// RejectCapture leaves a held payment uncaptured so Razorpay releases it
+func (s *Service) RejectCapture(ctx context.Context, paymentID string, d ReviewDecision) (HeldPayment, error) {
+	return s.decide(paymentID, ReviewRejected, d)
+}
+
+// decide closes a pending hold with status
+func (s *Service) decide(paymentID, status string, d ReviewDecision) (HeldPayment, error) {
+	s.reviews.mu.Lock()
+	defer s.reviews.mu.Unlock()
+
+	h, ok := s.reviews.holds[paymentID]
+	if !ok {
+		return HeldPayment{}, ErrNotFound
+	}
+	if h.Status != ReviewPending {
+		return HeldPayment{}, fmt.Errorf("%w: payment %s is %s", ErrReviewClosed, paymentID, h.Status)
+	}
+
+	now := s.clock.Now()
+	h.Status = status
+	h.DecidedBy = d.Author
+	h.DecidedAt = &now
+	h.Reason = d.Reason
+	log.Printf("Capture review of payment %s: %s by %s (reason: %q)", paymentID, status, d.Author, d.Reason)
+	return *h, nil
+}
+
+// startCaptureSweeper releases holds that reach their deadline undecided
+func (s *Service) startCaptureSweeper() {
+	s.reviews = &captureReviews{holds: make(map[string]*HeldPayment)}
+	s.runners.Add("capture-sweeper", runner.Every(captureSweepInterval, s.sweepCaptureHolds))
+}
+
+// sweepCaptureHolds expires pending holds past their void deadline
+func (s *Service) sweepCaptureHolds() {
+	now := s.clock.Now()
+	s.reviews.mu.Lock()
+	defer s.reviews.mu.Unlock()
+	for _, h := range s.reviews.holds {
+		if h.Status == ReviewPending && !now.Before(h.VoidBy) {
+			h.Status = ReviewExpired
+			h.DecidedAt = &now
+			h.Reason = "authorization deadline reached"
+			log.Printf("Capture review of payment %s expired undecided; leaving it uncaptured", h.PaymentID)
+		}
+	}
+}
+
+// ReloadCapturePolicy re-reads the capture policy file. The previous
+// policy stays in effect when the file fails to load.
+func (s *Service) ReloadCapturePolicy() error {
+	return s.capturePolicy.reload()
+}
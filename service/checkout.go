@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// Checkout session states returned to clients
+const (
+	SessionPending = "pending"
+	SessionPaid    = "paid"
+	SessionExpired = "expired"
+)
+
+// checkoutMethods lists the Razorpay checkout methods a session may toggle
+var checkoutMethods = map[string]bool{
+	"card":       true,
+	"netbanking": true,
+	"wallet":     true,
+	"upi":        true,
+	"emi":        true,
+	"paylater":   true,
+}
+
+// CheckoutItem is a single line of a checkout session
+type CheckoutItem struct {
+	Name     string `json:"name" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+	Amount   int    `json:"amount"`
+}
+
+// CheckoutCustomer holds the customer details used for upsert and prefill
+type CheckoutCustomer struct {
+	Name    string `json:"name"`
+	Email   string `json:"email" binding:"omitempty,email"`
+	Contact string `json:"contact"`
+}
+
+// CheckoutSessionRequest represents the incoming checkout session creation request
+type CheckoutSessionRequest struct {
+	Amount int `json:"amount"`
+	// Currency defaults to the merchant's, or the configured default
+	Currency string            `json:"currency"`
+	Items    []CheckoutItem    `json:"items" binding:"omitempty,dive"`
+	Customer CheckoutCustomer  `json:"customer"`
+	Notes    map[string]string `json:"notes"`
+	Methods  map[string]bool   `json:"methods"`
+	// Brand defaults to the API key's brand, then DEFAULT_BRAND
+	Brand string `json:"brand"`
+}
+
+// CheckoutSession ties a Razorpay order and customer to everything the
+// frontend needs to open checkout
+type CheckoutSession struct {
+	ID         string                 `json:"id"`
+	Status     string                 `json:"status"`
+	OrderID    string                 `json:"order_id"`
+	CustomerID string                 `json:"customer_id,omitempty"`
+	PaymentID  string                 `json:"payment_id,omitempty"`
+	Amount     int                    `json:"amount"`
+	Currency   string                 `json:"currency"`
+	Checkout   map[string]interface{} `json:"checkout"`
+	OrderToken string                 `json:"order_token"`
+	// ClientToken is set when VERIFY_CLIENT_BINDING is on, to be sent
+	// along with the payment's verification
+	ClientToken string    `json:"client_token,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// sessionStore keeps checkout sessions in memory, indexed by ID and order ID
+type sessionStore struct {
+	mu      sync.RWMutex
+	clock   clock.Clock
+	skew    time.Duration
+	byID    map[string]*CheckoutSession
+	byOrder map[string]string
+}
+
+func newSessionStore(clk clock.Clock, skew time.Duration) *sessionStore {
+	return &sessionStore{
+		clock:   clk,
+		skew:    skew,
+		byID:    make(map[string]*CheckoutSession),
+		byOrder: make(map[string]string),
+	}
+}
+
+func (st *sessionStore) save(session *CheckoutSession) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// Drop sessions that expired more than a day ago so the store stays bounded
+	cutoff := st.clock.Now().Add(-24 * time.Hour)
+	for id, s := range st.byID {
+		if s.Status != SessionPaid && s.ExpiresAt.Before(cutoff) {
+			delete(st.byOrder, s.OrderID)
+			delete(st.byID, id)
+		}
+	}
+
+	st.byID[session.ID] = session
+	st.byOrder[session.OrderID] = session.ID
+}
+
+// get returns a copy of the session with its status resolved against now
+func (st *sessionStore) get(id string) (CheckoutSession, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	s, ok := st.byID[id]
+	if !ok {
+		return CheckoutSession{}, false
+	}
+	return s.resolved(st.clock.Now(), st.skew), true
+}
+
+func (st *sessionStore) getByOrder(orderID string) (CheckoutSession, bool) {
+	st.mu.RLock()
+	id, ok := st.byOrder[orderID]
+	st.mu.RUnlock()
+	if !ok {
+		return CheckoutSession{}, false
+	}
+	return st.get(id)
+}
+
+// contact is the customer contact prefilled by the session owning orderID,
+// if any
+func (st *sessionStore) contact(orderID string) string {
+	session, ok := st.getByOrder(orderID)
+	if !ok {
+		return ""
+	}
+	prefill, _ := session.Checkout["prefill"].(map[string]string)
+	return prefill["contact"]
+}
+
+// markPaid records a successful payment against the session owning orderID
+func (st *sessionStore) markPaid(orderID, paymentID string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	id, ok := st.byOrder[orderID]
+	if !ok {
+		return false
+	}
+	s := st.byID[id]
+	s.Status = SessionPaid
+	s.PaymentID = paymentID
+	return true
+}
+
+func (s CheckoutSession) resolved(now time.Time, skew time.Duration) CheckoutSession {
+	if s.Status == SessionPending && (clock.Window{NotAfter: s.ExpiresAt}).Check(now, skew) != nil {
+		s.Status = SessionExpired
+	}
+	return s
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "cs_" + hex.EncodeToString(b), nil
+}
+
+// CreateCheckoutSession upserts the customer, creates the order and returns
+// a session holding everything the frontend needs to open checkout
+func (s *Service) CreateCheckoutSession(ctx context.Context, req CheckoutSessionRequest) (CheckoutSession, error) {
+	for _, item := range req.Items {
+		if err := validateItemAmount(item.Amount); err != nil {
+			return CheckoutSession{}, err
+		}
+	}
+	amount, err := req.total()
+	if err != nil {
+		return CheckoutSession{}, invalidRequest("%v", err)
+	}
+	currency, err := s.orderCurrency(ctx, req.Currency)
+	if err != nil {
+		return CheckoutSession{}, err
+	}
+	if err := validateAmount(currency, amount); err != nil {
+		return CheckoutSession{}, err
+	}
+	for method := range req.Methods {
+		if !checkoutMethods[method] {
+			return CheckoutSession{}, invalidRequest("unsupported checkout method %q", method)
+		}
+	}
+	// Razorpay accepts at most 15 notes per order; one slot is ours
+	if len(req.Notes) > 14 {
+		return CheckoutSession{}, invalidRequest("at most 14 notes are allowed")
+	}
+	if err := s.checkNotes(req.Notes); err != nil {
+		return CheckoutSession{}, err
+	}
+	brand, err := s.resolveBrand(ctx, req.Brand)
+	if err != nil {
+		return CheckoutSession{}, err
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return CheckoutSession{}, fmt.Errorf("generate session ID: %w", err)
+	}
+
+	var customerID string
+	if req.Customer.Email != "" || req.Customer.Contact != "" {
+		customer, err := s.gateway.UpsertCustomer(ctx, map[string]interface{}{
+			"name":    req.Customer.Name,
+			"email":   req.Customer.Email,
+			"contact": req.Customer.Contact,
+		})
+		if err != nil {
+			return CheckoutSession{}, fmt.Errorf("upsert customer: %w", err)
+		}
+		customerID, _ = customer["id"].(string)
+	}
+
+	notes := map[string]string{
+		"checkout_session": sessionID,
+	}
+	for k, v := range req.Notes {
+		notes[k] = v
+	}
+
+	order, err := s.createOrder(ctx, orderParams{Amount: amount, Currency: currency, Notes: notes, CustomerID: customerID, Brand: brandName(brand)})
+	if err != nil {
+		return CheckoutSession{}, err
+	}
+	orderID, _ := order["id"].(string)
+	provider, _ := order[gateway.ProviderField].(string)
+	clientToken, _ := order["client_token"].(string)
+
+	token, err := s.issueOrderToken(order)
+	if err != nil {
+		return CheckoutSession{}, fmt.Errorf("issue order token: %w", err)
+	}
+
+	checkout := map[string]interface{}{
+		"key":      s.checkoutKey(provider),
+		"amount":   amount,
+		"currency": currency,
+		"order_id": orderID,
+		"notes":    notes,
+		"prefill": map[string]string{
+			"name":    req.Customer.Name,
+			"email":   req.Customer.Email,
+			"contact": req.Customer.Contact,
+		},
+	}
+	if customerID != "" {
+		checkout["customer_id"] = customerID
+	}
+	if methods := sessionMethods(req.Methods, s.accountMethods(ctx)); len(methods) > 0 {
+		checkout["method"] = methods
+	}
+	brandCheckout(checkout, brand)
+
+	now := s.clock.Now()
+	session := &CheckoutSession{
+		ID:          sessionID,
+		Status:      SessionPending,
+		OrderID:     orderID,
+		CustomerID:  customerID,
+		Amount:      amount,
+		Currency:    currency,
+		Checkout:    checkout,
+		OrderToken:  token,
+		ClientToken: clientToken,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.cfg.SessionTTL),
+	}
+	s.sessions.save(session)
+
+	return *session, nil
+}
+
+// CheckoutSession returns the session with its current state
+func (s *Service) CheckoutSession(id string) (CheckoutSession, error) {
+	session, ok := s.sessions.get(id)
+	if !ok {
+		return CheckoutSession{}, ErrNotFound
+	}
+	return session, nil
+}
+
+// total returns the session amount, deriving it from the items when only
+// items are given and rejecting a mismatch when both are
+func (req CheckoutSessionRequest) total() (int, error) {
+	sum := 0
+	for _, item := range req.Items {
+		sum += item.Quantity * item.Amount
+	}
+
+	switch {
+	case len(req.Items) == 0:
+		return req.Amount, nil
+	case req.Amount != 0 && req.Amount != sum:
+		return 0, fmt.Errorf("amount %d does not match items total %d", req.Amount, sum)
+	default:
+		return sum, nil
+	}
+}
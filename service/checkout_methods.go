@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// methodsCache holds the payment methods enabled on the Razorpay account.
+// They rarely change, so a copy older than CheckoutMethodsTTL is still
+// served while one caller revalidates it in the background.
+type methodsCache struct {
+	mu         sync.Mutex
+	methods    map[string]bool
+	fetchedAt  time.Time
+	refreshing bool
+
+	// fetch admits one Razorpay call at a time, so a cold cache is filled
+	// once and a revalidation never overwrites a newer forced refresh.
+	// fetches counts the calls and lastErr is the outcome of the latest.
+	fetch   sync.Mutex
+	fetches uint64
+	lastErr error
+}
+
+// checkDefaultMethods rejects configured fallback methods checkout does
+// not know
+func checkDefaultMethods(methods []string) error {
+	for _, m := range methods {
+		if !checkoutMethods[m] {
+			return fmt.Errorf("unknown checkout method %q", m)
+		}
+	}
+	return nil
+}
+
+// accountMethods returns every checkout method with whether the account
+// supports it. A stale copy triggers a background revalidation; with no
+// copy at all Razorpay is asked, falling back to CheckoutMethodsDefault.
+// It returns nil when nothing is known.
+func (s *Service) accountMethods(ctx context.Context) map[string]bool {
+	c := &s.methods
+	c.mu.Lock()
+	if c.methods != nil {
+		methods := c.methods
+		if s.clock.Now().Sub(c.fetchedAt) >= s.cfg.CheckoutMethodsTTL && !c.refreshing {
+			c.refreshing = true
+			go s.revalidateMethods()
+		}
+		c.mu.Unlock()
+		return methods
+	}
+	c.mu.Unlock()
+
+	methods, err := s.fetchMethods(ctx, false)
+	if err != nil {
+		log.Printf("Falling back to default checkout methods: %v", err)
+		return s.defaultMethods()
+	}
+	return methods
+}
+
+func (s *Service) revalidateMethods() {
+	defer func() {
+		s.methods.mu.Lock()
+		s.methods.refreshing = false
+		s.methods.mu.Unlock()
+	}()
+	if _, err := s.fetchMethods(context.Background(), false); err != nil {
+		log.Printf("Serving stale checkout methods, revalidation failed: %v", err)
+	}
+}
+
+// RefreshCheckoutMethods fetches the account's payment methods from
+// Razorpay now, replacing the cached copy
+func (s *Service) RefreshCheckoutMethods(ctx context.Context) (map[string]bool, error) {
+	methods, err := s.fetchMethods(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("fetch checkout methods: %w", err)
+	}
+	return methods, nil
+}
+
+// fetchMethods asks Razorpay for the account's methods and caches them.
+// Unless forced, the outcome of a call made while waiting for the fetch
+// lock is shared instead, so callers queued behind a failing call do not
+// each wait out the gateway timeout.
+func (s *Service) fetchMethods(ctx context.Context, force bool) (map[string]bool, error) {
+	c := &s.methods
+	c.mu.Lock()
+	seen := c.fetches
+	c.mu.Unlock()
+
+	c.fetch.Lock()
+	defer c.fetch.Unlock()
+
+	if !force {
+		c.mu.Lock()
+		methods, fresh := c.methods, s.clock.Now().Sub(c.fetchedAt) < s.cfg.CheckoutMethodsTTL
+		fetched := c.fetches != seen
+		c.mu.Unlock()
+		if methods != nil && fresh {
+			return methods, nil
+		}
+		if fetched && c.lastErr != nil {
+			return nil, c.lastErr
+		}
+	}
+
+	started := s.clock.Now()
+	raw, err := s.gateway.FetchMethods(ctx)
+	c.mu.Lock()
+	c.fetches++
+	c.mu.Unlock()
+	c.lastErr = err
+	if err != nil {
+		return nil, err
+	}
+	methods := make(map[string]bool, len(checkoutMethods))
+	for m := range checkoutMethods {
+		methods[m] = enabledMethod(raw[m])
+	}
+
+	c.mu.Lock()
+	c.methods, c.fetchedAt = methods, started
+	c.mu.Unlock()
+	return methods, nil
+}
+
+// enabledMethod reads one method from Razorpay's /methods response, which
+// is a boolean for some methods and a map of providers for others
+func enabledMethod(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// defaultMethods returns CheckoutMethodsDefault in accountMethods' form
+func (s *Service) defaultMethods() map[string]bool {
+	if len(s.cfg.CheckoutMethodsDefault) == 0 {
+		return nil
+	}
+	methods := make(map[string]bool, len(checkoutMethods))
+	for m := range checkoutMethods {
+		methods[m] = false
+	}
+	for _, m := range s.cfg.CheckoutMethodsDefault {
+		methods[m] = true
+	}
+	return methods
+}
+
+// sessionMethods narrows the methods a session asked for to those the
+// account supports; with none asked for, the account's methods apply
+func sessionMethods(requested, supported map[string]bool) map[string]bool {
+	if supported == nil {
+		return requested
+	}
+	methods := make(map[string]bool, len(supported))
+	for m, ok := range supported {
+		methods[m] = ok
+	}
+	for m, ok := range requested {
+		methods[m] = ok && supported[m]
+	}
+	return methods
+}
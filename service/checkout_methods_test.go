@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// methodsGateway answers FetchMethods with methods or err, counting the
+// calls. While hold is open each call waits for it to close.
+type methodsGateway struct {
+	*fakeGateway
+
+	mu      sync.Mutex
+	methods map[string]interface{}
+	err     error
+	hold    chan struct{}
+	calls   int
+}
+
+func (g *methodsGateway) FetchMethods(ctx context.Context) (map[string]interface{}, error) {
+	g.mu.Lock()
+	g.calls++
+	hold := g.hold
+	g.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.methods, g.err
+}
+
+func (g *methodsGateway) set(methods map[string]interface{}, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.methods, g.err = methods, err
+}
+
+func (g *methodsGateway) fetches() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+func methodsService(t *testing.T, gw *methodsGateway, defaults ...string) (*Service, func(time.Duration)) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.CheckoutMethodsTTL = 10 * time.Minute
+	cfg.CheckoutMethodsDefault = defaults
+	s, clk := newTestService(t, gw, cfg)
+	return s, clk.Advance
+}
+
+// waitForRevalidation waits until no background revalidation is running
+func waitForRevalidation(t *testing.T, s *Service) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.methods.mu.Lock()
+		refreshing := s.methods.refreshing
+		s.methods.mu.Unlock()
+		if !refreshing {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("revalidation never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEnabledMethod(t *testing.T) {
+	tests := []struct {
+		raw  interface{}
+		want bool
+	}{
+		{true, true},
+		{false, false},
+		{map[string]interface{}{"HDFC": "HDFC Bank"}, true},
+		{map[string]interface{}{}, false},
+		{nil, false},
+		{"yes", false},
+	}
+	for _, tt := range tests {
+		if got := enabledMethod(tt.raw); got != tt.want {
+			t.Errorf("enabledMethod(%v) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestAccountMethodsStaleWhileRevalidate(t *testing.T) {
+	gw := &methodsGateway{fakeGateway: newFakeGateway(), methods: map[string]interface{}{"card": true}}
+	s, advance := methodsService(t, gw)
+	ctx := context.Background()
+
+	if m := s.accountMethods(ctx); !m["card"] || m["upi"] {
+		t.Fatalf("methods = %v, want card only", m)
+	}
+	s.accountMethods(ctx)
+	if n := gw.fetches(); n != 1 {
+		t.Fatalf("%d fetches within the TTL, want 1", n)
+	}
+
+	// Past the TTL every caller gets the stale copy at once while a single
+	// revalidation runs
+	gw.set(map[string]interface{}{"card": true, "upi": true}, nil)
+	gw.hold = make(chan struct{})
+	advance(11 * time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m := s.accountMethods(ctx); m["upi"] {
+				t.Errorf("methods = %v during revalidation, want the stale copy", m)
+			}
+		}()
+	}
+	wg.Wait()
+	close(gw.hold)
+	waitForRevalidation(t, s)
+	if n := gw.fetches(); n != 2 {
+		t.Fatalf("%d fetches, want one revalidation", n)
+	}
+	if m := s.accountMethods(ctx); !m["upi"] {
+		t.Fatalf("methods = %v after revalidation, want upi", m)
+	}
+}
+
+func TestAccountMethodsFallBack(t *testing.T) {
+	gw := &methodsGateway{fakeGateway: newFakeGateway(), err: errors.New("razorpay down")}
+	s, advance := methodsService(t, gw, "card", "upi")
+	ctx := context.Background()
+
+	if m := s.accountMethods(ctx); !m["card"] || !m["upi"] || m["wallet"] {
+		t.Fatalf("methods = %v, want the configured defaults", m)
+	}
+
+	gw.set(map[string]interface{}{"wallet": true}, nil)
+	if _, err := s.RefreshCheckoutMethods(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// A failed revalidation keeps the last copy
+	gw.set(nil, errors.New("razorpay down"))
+	advance(11 * time.Minute)
+	s.accountMethods(ctx)
+	waitForRevalidation(t, s)
+	if m := s.accountMethods(ctx); !m["wallet"] || m["card"] {
+		t.Fatalf("methods = %v, want the last fetched copy", m)
+	}
+
+	none, _ := methodsService(t, &methodsGateway{fakeGateway: newFakeGateway(), err: errors.New("razorpay down")})
+	if m := none.accountMethods(ctx); m != nil {
+		t.Fatalf("methods = %v with no copy and no defaults, want nothing known", m)
+	}
+}
+
+func TestColdMethodsCacheFilledOnce(t *testing.T) {
+	gw := &methodsGateway{fakeGateway: newFakeGateway(), methods: map[string]interface{}{"card": true}, hold: make(chan struct{})}
+	s, _ := methodsService(t, gw)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m := s.accountMethods(context.Background()); !m["card"] {
+				t.Errorf("methods = %v, want card", m)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(gw.hold)
+	wg.Wait()
+	if n := gw.fetches(); n != 1 {
+		t.Fatalf("%d fetches filling a cold cache, want 1", n)
+	}
+}
+
+func TestRefreshCheckoutMethodsForced(t *testing.T) {
+	gw := &methodsGateway{fakeGateway: newFakeGateway(), methods: map[string]interface{}{"card": true}}
+	s, _ := methodsService(t, gw)
+	ctx := context.Background()
+	s.accountMethods(ctx)
+
+	gw.set(map[string]interface{}{"emi": true}, nil)
+	m, err := s.RefreshCheckoutMethods(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m["emi"] || m["card"] || gw.fetches() != 2 {
+		t.Fatalf("refreshed %v in %d fetches, want emi fetched again", m, gw.fetches())
+	}
+	if m := s.accountMethods(ctx); !m["emi"] {
+		t.Fatalf("methods = %v after the refresh, want emi", m)
+	}
+
+	gw.set(nil, errors.New("razorpay down"))
+	if _, err := s.RefreshCheckoutMethods(ctx); err == nil {
+		t.Fatal("forced refresh against a failing gateway succeeded")
+	}
+}
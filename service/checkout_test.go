@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+func TestCheckoutSessionTotal(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     CheckoutSessionRequest
+		want    int
+		wantErr bool
+	}{
+		{name: "amount only", req: CheckoutSessionRequest{Amount: 500}, want: 500},
+		{name: "items only", req: CheckoutSessionRequest{Items: []CheckoutItem{{Name: "a", Quantity: 2, Amount: 150}, {Name: "b", Quantity: 1, Amount: 200}}}, want: 500},
+		{name: "amount matching items", req: CheckoutSessionRequest{Amount: 300, Items: []CheckoutItem{{Name: "a", Quantity: 3, Amount: 100}}}, want: 300},
+		{name: "amount against items", req: CheckoutSessionRequest{Amount: 400, Items: []CheckoutItem{{Name: "a", Quantity: 3, Amount: 100}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.total()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("total = %d, %v, want %d (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateCheckoutSession(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          CheckoutSessionRequest
+		wantCustomer bool
+		// invalid is whether the request is refused as invalid
+		invalid bool
+		want    error
+	}{
+		{name: "anonymous", req: CheckoutSessionRequest{Amount: 500}},
+		{
+			name:         "with customer",
+			req:          CheckoutSessionRequest{Amount: 500, Customer: CheckoutCustomer{Name: "Asha", Email: "asha@example.com"}},
+			wantCustomer: true,
+		},
+		{name: "unknown method", req: CheckoutSessionRequest{Amount: 500, Methods: map[string]bool{"cash": true}}, invalid: true},
+		{name: "below minimum", req: CheckoutSessionRequest{Amount: 50}, want: ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, clk := newTestService(t, gw, testConfig(t))
+			session, err := s.CreateCheckoutSession(context.Background(), tt.req)
+			var invalid *ValidationError
+			if tt.invalid && !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want an invalid request", err)
+			}
+			if !tt.invalid && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if gw.created != 0 {
+					t.Fatal("order created for a refused session")
+				}
+				return
+			}
+			if session.Status != SessionPending || session.OrderID == "" || session.OrderToken == "" {
+				t.Fatalf("session = %+v", session)
+			}
+			if !session.ExpiresAt.Equal(clk.Now().Add(s.cfg.SessionTTL)) {
+				t.Fatalf("expires at %s, want %s after %s", session.ExpiresAt, s.cfg.SessionTTL, clk.Now())
+			}
+			if session.Checkout["order_id"] != session.OrderID || session.Checkout["amount"] != 500 {
+				t.Fatalf("checkout payload = %v", session.Checkout)
+			}
+			if got := gw.orders[session.OrderID]["notes"].(map[string]string)["checkout_session"]; got != session.ID {
+				t.Fatalf("order notes name session %q, want %q", got, session.ID)
+			}
+			if (session.CustomerID != "") != tt.wantCustomer || (len(gw.customers) == 1) != tt.wantCustomer {
+				t.Fatalf("customer %q after %d upserts, want one: %v", session.CustomerID, len(gw.customers), tt.wantCustomer)
+			}
+		})
+	}
+}
+
+func TestCheckoutSessionResolvesPayments(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		// webhook pays through a captured payment event instead of verify
+		webhook    bool
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "verified", wantStatus: SessionPaid},
+		{name: "captured by webhook", webhook: true, wantStatus: SessionPaid},
+		{name: "verified late", advance: 15 * time.Minute, wantErr: ErrSessionExpired, wantStatus: SessionExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.SessionTTL = 10 * time.Minute
+			cfg.WebhookSecret = testWebhookSecret
+			cfg.WebhookReorderDelay = 0
+			gw := newFakeGateway()
+			s, clk := newTestService(t, gw, cfg)
+			session, err := s.CreateCheckoutSession(context.Background(), CheckoutSessionRequest{Amount: 500})
+			if err != nil {
+				t.Fatal(err)
+			}
+			gw.pay("pay_1", session.OrderID, 500, "INR")
+			clk.Advance(tt.advance)
+
+			if tt.webhook {
+				body := fmt.Sprintf(`{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","order_id":%q,"amount":500,"currency":"INR","status":"captured"}}}}`, session.OrderID)
+				if err := deliver(t, s, body, "evt_1"); err != nil {
+					t.Fatal(err)
+				}
+				drainWebhooks(t, s)
+			} else {
+				_, err = s.VerifyPayment(context.Background(), PaymentVerificationRequest{
+					ServerOrderID:     session.OrderID,
+					RazorpayPaymentID: "pay_1",
+					RazorpaySignature: paymentSignature(session.OrderID, "pay_1", testSecret),
+					OrderToken:        session.OrderToken,
+				})
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("verify: err = %v, want %v", err, tt.wantErr)
+				}
+			}
+
+			got, err := s.CheckoutSession(session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == SessionPaid && got.PaymentID != "pay_1" {
+				t.Fatalf("payment ID = %q, want pay_1", got.PaymentID)
+			}
+		})
+	}
+}
+
+func TestCheckoutSessionNotFound(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	if _, err := s.CheckoutSession("cs_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCheckoutSessionCurrency(t *testing.T) {
+	tenants := testTenants(t,
+		Tenant{ID: "acme", KeyID: "rzp_test_acme", KeySecret: "acme_secret", DefaultCurrency: "USD", AllowedCurrencies: []string{"USD", "EUR"}},
+	)
+	gw := newFakeGateway()
+	cfg := testConfig(t)
+	cfg.DefaultCurrency, cfg.AllowedCurrencies = "INR", []string{"INR", "GBP"}
+	s, _ := newTestService(t, gw, cfg, WithTenants(tenants, func(Tenant) (gateway.Gateway, error) { return gw, nil }))
+
+	tests := []struct {
+		name      string
+		tenant    string
+		requested string
+		// want is the session currency, empty when the request is refused
+		want string
+	}{
+		{"configured default", "", "", "INR"},
+		{"requested", "", "gbp", "GBP"},
+		{"not allowed", "", "USD", ""},
+		{"merchant default", "acme", "", "USD"},
+		{"merchant allows", "acme", "EUR", "EUR"},
+		{"merchant refuses", "acme", "INR", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.tenant != "" {
+				ctx = authctx.WithTenant(ctx, tt.tenant)
+			}
+			session, err := s.CreateCheckoutSession(ctx, CheckoutSessionRequest{Amount: 50000, Currency: tt.requested})
+			if tt.want == "" {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Currency != tt.want || session.Checkout["currency"] != tt.want || gw.orders[session.OrderID]["currency"] != tt.want {
+				t.Fatalf("session %s, checkout %v, order %v, want %s", session.Currency, session.Checkout["currency"], gw.orders[session.OrderID]["currency"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+// clientTokenBytes is the entropy of a client token
+const clientTokenBytes = 32
+
+// newClientBinding returns a fresh client token and the binding stored on
+// the order, or nothing when VERIFY_CLIENT_BINDING is off. The token is
+// random, so nothing public about the order gives it away, and only its
+// hash is kept.
+func (s *Service) newClientBinding() (string, *ClientBinding, error) {
+	if !s.cfg.VerifyClientBinding {
+		return "", nil, nil
+	}
+	b := make([]byte, clientTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("generate client token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, &ClientBinding{
+		TokenHash: clientTokenHash(token),
+		ExpiresAt: s.clock.Now().Add(s.cfg.ClientTokenTTL),
+	}, nil
+}
+
+// checkClientBinding checks that token is the client token handed out when
+// orderID was created. Orders the store does not know, or created without
+// a binding, cannot be verified while binding is on.
+func (s *Service) checkClientBinding(ctx context.Context, orderID, token string) error {
+	if !s.cfg.VerifyClientBinding {
+		return nil
+	}
+	if token == "" {
+		return ErrClientTokenMissing
+	}
+	order, err := s.store.Get(ctx, orderID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return ErrClientUnbound
+	case err != nil:
+		return fmt.Errorf("load order %s: %w", orderID, err)
+	}
+	return s.matchClientToken(order, token)
+}
+
+// matchClientToken checks token against the client binding of order,
+// which must have one
+func (s *Service) matchClientToken(order Order, token string) error {
+	if order.ClientBinding == nil {
+		return ErrClientUnbound
+	}
+	if token == "" {
+		return ErrClientTokenMissing
+	}
+	if !hmac.Equal([]byte(clientTokenHash(token)), []byte(order.ClientBinding.TokenHash)) {
+		return ErrClientTokenMismatch
+	}
+	if err := s.checkWindow(clock.Window{NotAfter: order.ClientBinding.ExpiresAt}); err != nil {
+		return ErrClientTokenExpired
+	}
+	return nil
+}
+
+func clientTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
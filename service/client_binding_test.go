@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientBinding(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+		token    func(issued string) string
+		wait     time.Duration
+		unstored bool
+		badSig   bool
+		want     error
+		wantLog  string
+	}{
+		{name: "disabled", disabled: true, token: func(string) string { return "" }},
+		{name: "match", token: func(issued string) string { return issued }},
+		{name: "missing", token: func(string) string { return "" }, want: ErrClientTokenMissing, wantLog: "signature valid: true"},
+		{name: "mismatch", token: func(issued string) string { return issued + "x" }, want: ErrClientTokenMismatch, wantLog: "signature valid: true"},
+		{name: "mismatch and bad signature", token: func(issued string) string { return "forged" }, badSig: true, want: ErrClientTokenMismatch, wantLog: "signature valid: false"},
+		{name: "expired", token: func(issued string) string { return issued }, wait: 15 * time.Minute, want: ErrClientTokenExpired},
+		{name: "order not stored", token: func(issued string) string { return issued }, unstored: true, want: ErrClientUnbound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.VerifyClientBinding = !tt.disabled
+			cfg.ClientTokenTTL = 10 * time.Minute
+			gw := newFakeGateway()
+			s, clk := newTestService(t, gw, cfg)
+			ctx := context.Background()
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			issued, _ := order["client_token"].(string)
+			if tt.disabled != (issued == "") {
+				t.Fatalf("client_token = %q with binding disabled %v", issued, tt.disabled)
+			}
+			if tt.unstored {
+				store := s.store.(*MemoryStore)
+				store.mu.Lock()
+				delete(store.orders, orderID)
+				store.mu.Unlock()
+			}
+			clk.Advance(tt.wait)
+			gw.pay("pay_1", orderID, 500, "INR")
+			signature := paymentSignature(orderID, "pay_1", testSecret)
+			if tt.badSig {
+				signature = paymentSignature(orderID, "pay_1", "other")
+			}
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			_, err := s.VerifyPayment(ctx, PaymentVerificationRequest{
+				ServerOrderID:     orderID,
+				RazorpayPaymentID: "pay_1",
+				RazorpaySignature: signature,
+				OrderToken:        order["order_token"].(string),
+				ClientToken:       tt.token(issued),
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil && !errors.Is(err, ErrClientBinding) {
+				t.Fatalf("err = %v, want it to wrap ErrClientBinding", err)
+			}
+			if !strings.Contains(buf.String(), tt.wantLog) {
+				t.Fatalf("log = %q, want %q", buf.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestClientTokenNotStored(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.VerifyClientBinding = true
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	ctx := context.Background()
+
+	first, second := createTestOrder(t, s, 500), createTestOrder(t, s, 500)
+	token := first["client_token"].(string)
+	if token == second["client_token"] || len(token) < 43 {
+		t.Fatalf("client tokens %q and %q, want distinct random tokens", token, second["client_token"])
+	}
+	order, err := s.store.Get(ctx, first["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.ClientBinding == nil || order.ClientBinding.TokenHash == token || order.ClientBinding.TokenHash != clientTokenHash(token) {
+		t.Fatalf("binding = %+v, want only the token's hash kept", order.ClientBinding)
+	}
+	// The order's public fields, cached for lookups, never carry the token
+	fetched, err := s.GetOrder(ctx, first["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fetched["client_token"]; ok {
+		t.Fatalf("fetched order %v carries the client token", fetched)
+	}
+}
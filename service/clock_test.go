@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefundApprovalSweepFollowsClock(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.RefundApprovalThreshold = 10000
+	cfg.RefundApprovalTTL = time.Hour
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+
+	_, approval, err := s.RequestRefund(context.Background(), RefundRequest{PaymentID: "pay_1", Amount: 50000})
+	if err != nil || approval == nil {
+		t.Fatalf("RequestRefund = %v, %v, want an approval", approval, err)
+	}
+	if want := clk.Now().Add(time.Hour); !approval.ExpiresAt.Equal(want) {
+		t.Fatalf("ExpiresAt = %s, want %s", approval.ExpiresAt, want)
+	}
+
+	tests := []struct {
+		advance time.Duration
+		want    string
+	}{
+		{59 * time.Minute, RefundPendingApproval},
+		{time.Minute, RefundRejected},
+	}
+	for _, tt := range tests {
+		clk.Advance(tt.advance)
+		s.sweepRefundApprovals()
+		s.refundApprovals.mu.Lock()
+		a := *s.refundApprovals.approvals[approval.ID]
+		s.refundApprovals.mu.Unlock()
+		if a.Status != tt.want {
+			t.Fatalf("at %s: status = %s, want %s", clk.Now(), a.Status, tt.want)
+		}
+		if a.Status == RefundRejected && (a.DecidedAt == nil || !a.DecidedAt.Equal(clk.Now())) {
+			t.Fatalf("DecidedAt = %v, want %s", a.DecidedAt, clk.Now())
+		}
+	}
+}
+
+func TestOrderTimestampsFollowClock(t *testing.T) {
+	s, clk := newTestService(t, newFakeGateway(), testConfig(t))
+	// The last minute of the financial year, in IST
+	clk.Set(time.Date(2026, 3, 31, 23, 59, 0, 0, time.FixedZone("IST", 5*3600+1800)))
+
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	order, err := s.store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("rcpt_%d_", clk.Now().Unix()); !strings.HasPrefix(order.Receipt, want) {
+		t.Fatalf("receipt = %q, want prefix %q", order.Receipt, want)
+	}
+	if want := clk.Now().Format(time.RFC3339); order.Notes["created_at"] != want {
+		t.Fatalf("created_at note = %q, want %q", order.Notes["created_at"], want)
+	}
+	if !order.CreatedAt.Equal(clk.Now()) {
+		t.Fatalf("CreatedAt = %s, want %s", order.CreatedAt, clk.Now())
+	}
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// creditCurrency is the currency store credit is held in
+const creditCurrency = "INR"
+
+// creditSweepInterval is how often credit holds are checked for expiry
+const creditSweepInterval = time.Minute
+
+// creditSwapAttempts bounds the retries of a credit update losing races
+const creditSwapAttempts = 10
+
+// Statuses of the credit applied to an order
+const (
+	CreditHeld     = "held"
+	CreditCaptured = "captured"
+	CreditReleased = "released"
+)
+
+// TimelineCredit is the timeline entry type of credit holds, captures and
+// releases
+const TimelineCredit = "credit"
+
+// Credit errors
+var (
+	ErrInsufficientCredit = errors.New("insufficient store credit")
+	ErrCreditConflict     = errors.New("store credit kept changing during the update")
+)
+
+// CreditAccount is a customer's store credit in paise. Holds reserve part
+// of Balance for unpaid orders; Version changes on every save.
+type CreditAccount struct {
+	CustomerID string                `json:"customer_id"`
+	Balance    int                   `json:"balance"`
+	Holds      map[string]CreditHold `json:"holds,omitempty"`
+	Version    int64                 `json:"version"`
+}
+
+// CreditHold is credit reserved for an order until it is paid or the
+// reservation is released
+type CreditHold struct {
+	OrderID string    `json:"order_id"`
+	Amount  int       `json:"amount"`
+	At      time.Time `json:"at"`
+}
+
+// Available is the balance not held for orders
+func (a CreditAccount) Available() int {
+	available := a.Balance
+	for _, h := range a.Holds {
+		available -= h.Amount
+	}
+	return available
+}
+
+func (a CreditAccount) clone() CreditAccount {
+	holds := make(map[string]CreditHold, len(a.Holds))
+	for id, h := range a.Holds {
+		holds[id] = h
+	}
+	a.Holds = holds
+	return a
+}
+
+// CreditStore persists store credit. Updates are check-and-set, so two
+// orders drawing on one balance at once cannot both spend it.
+type CreditStore interface {
+	// Account returns the customer's account, an empty one at version zero
+	// for customers without credit
+	Account(ctx context.Context, customerID string) (CreditAccount, error)
+	// Swap saves next unless the account changed since prev was read, that
+	// is unless it is still at prev.Version. It reports whether it saved.
+	Swap(ctx context.Context, prev, next CreditAccount) (bool, error)
+}
+
+// WithCreditStore keeps store credit in store instead of in memory
+func WithCreditStore(store CreditStore) Option {
+	return func(s *Service) {
+		s.credits = store
+	}
+}
+
+// MemoryCreditStore is a CreditStore kept in process memory
+type MemoryCreditStore struct {
+	mu       sync.Mutex
+	accounts map[string]CreditAccount
+}
+
+// NewMemoryCreditStore returns an empty in-memory CreditStore
+func NewMemoryCreditStore() *MemoryCreditStore {
+	return &MemoryCreditStore{accounts: make(map[string]CreditAccount)}
+}
+
+func (m *MemoryCreditStore) Account(ctx context.Context, customerID string) (CreditAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[customerID]
+	if !ok {
+		return CreditAccount{CustomerID: customerID}, nil
+	}
+	return a.clone(), nil
+}
+
+func (m *MemoryCreditStore) Swap(ctx context.Context, prev, next CreditAccount) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts[prev.CustomerID].Version != prev.Version {
+		return false, nil
+	}
+	next = next.clone()
+	next.CustomerID = prev.CustomerID
+	next.Version = prev.Version + 1
+	m.accounts[prev.CustomerID] = next
+	return true, nil
+}
+
+// updateCredit applies fn to the customer's account and saves it, reading
+// the account again and retrying when another update got in first. The
+// account is not saved when fn fails.
+func (s *Service) updateCredit(ctx context.Context, customerID string, fn func(*CreditAccount) error) (CreditAccount, error) {
+	for attempt := 0; attempt < creditSwapAttempts; attempt++ {
+		prev, err := s.credits.Account(ctx, customerID)
+		if err != nil {
+			return CreditAccount{}, fmt.Errorf("read credit of %s: %w", customerID, err)
+		}
+		next := prev.clone()
+		if err := fn(&next); err != nil {
+			return CreditAccount{}, err
+		}
+		saved, err := s.credits.Swap(ctx, prev, next)
+		if err != nil {
+			return CreditAccount{}, fmt.Errorf("save credit of %s: %w", customerID, err)
+		}
+		if saved {
+			next.Version = prev.Version + 1
+			return next, nil
+		}
+	}
+	return CreditAccount{}, fmt.Errorf("%w: customer %s", ErrCreditConflict, customerID)
+}
+
+// CreditAdjustment grants or deducts store credit by hand
+type CreditAdjustment struct {
+	Amount int    `json:"amount" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+	// Author is filled in from the authenticated principal
+	Author string `json:"-"`
+}
+
+// CreditBalance is a customer's credit as reported to operators
+type CreditBalance struct {
+	CreditAccount
+	Available int `json:"available"`
+}
+
+func balanceOf(a CreditAccount) CreditBalance {
+	return CreditBalance{CreditAccount: a, Available: a.Available()}
+}
+
+// CreditBalance returns the customer's store credit
+func (s *Service) CreditBalance(ctx context.Context, customerID string) (CreditBalance, error) {
+	a, err := s.credits.Account(ctx, customerID)
+	if err != nil {
+		return CreditBalance{}, fmt.Errorf("read credit of %s: %w", customerID, err)
+	}
+	return balanceOf(a), nil
+}
+
+// GrantCredit adds req.Amount to the customer's balance
+func (s *Service) GrantCredit(ctx context.Context, customerID string, req CreditAdjustment) (CreditBalance, error) {
+	if req.Amount <= 0 {
+		return CreditBalance{}, invalidRequest("amount must be a positive number of paise")
+	}
+	a, err := s.updateCredit(ctx, customerID, func(a *CreditAccount) error {
+		a.Balance += req.Amount
+		return nil
+	})
+	if err != nil {
+		return CreditBalance{}, err
+	}
+	log.Printf("Granted %d paise of credit to %s by %s: %s", req.Amount, customerID, req.Author, req.Reason)
+	return balanceOf(a), nil
+}
+
+// DeductCredit takes req.Amount from the customer's available balance;
+// credit held for orders cannot be deducted
+func (s *Service) DeductCredit(ctx context.Context, customerID string, req CreditAdjustment) (CreditBalance, error) {
+	if req.Amount <= 0 {
+		return CreditBalance{}, invalidRequest("amount must be a positive number of paise")
+	}
+	a, err := s.updateCredit(ctx, customerID, func(a *CreditAccount) error {
+		if a.Available() < req.Amount {
+			return fmt.Errorf("%w: %d available, %d requested", ErrInsufficientCredit, a.Available(), req.Amount)
+		}
+		a.Balance -= req.Amount
+		return nil
+	})
+	if err != nil {
+		return CreditBalance{}, err
+	}
+	log.Printf("Deducted %d paise of credit from %s by %s: %s", req.Amount, customerID, req.Author, req.Reason)
+	return balanceOf(a), nil
+}
+
+// OrderCredit is the store credit applied to an order
+type OrderCredit struct {
+	CustomerID string `json:"customer_id"`
+	HoldID     string `json:"hold_id"`
+	Amount     int    `json:"amount"`
+	Status     string `json:"status"`
+	// Shortfall is credit that could not be deducted on payment because
+	// the hold had been released and the balance spent meanwhile
+	Shortfall int `json:"shortfall,omitempty"`
+}
+
+// holdCredit reserves up to amount of the customer's available credit for
+// an order, leaving a remainder Razorpay accepts: none, or at least the
+// currency minimum. It returns nil when no credit applies.
+func (s *Service) holdCredit(ctx context.Context, customerID string, amount int) (*OrderCredit, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	credit := &OrderCredit{CustomerID: customerID, HoldID: "crh_" + hex.EncodeToString(b), Status: CreditHeld}
+	minimum := currencies[creditCurrency].MinAmount
+	_, err := s.updateCredit(ctx, customerID, func(a *CreditAccount) error {
+		credit.Amount = min(a.Available(), amount)
+		if rest := amount - credit.Amount; rest > 0 && rest < minimum {
+			credit.Amount -= minimum - rest
+		}
+		if credit.Amount <= 0 {
+			return nil
+		}
+		if a.Holds == nil {
+			a.Holds = map[string]CreditHold{}
+		}
+		a.Holds[credit.HoldID] = CreditHold{Amount: credit.Amount, At: s.clock.Now()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credit.Amount <= 0 {
+		return nil, nil
+	}
+	return credit, nil
+}
+
+// requestedCredit holds credit for an order asking for apply_credit
+func (s *Service) requestedCredit(ctx context.Context, req PaymentRequest, currency string) (*OrderCredit, error) {
+	if req.CustomerID == "" {
+		return nil, invalidRequest("apply_credit requires customer_id")
+	}
+	if currency != creditCurrency {
+		return nil, invalidRequest("store credit can only be applied to %s orders", creditCurrency)
+	}
+	if req.DryRun {
+		return nil, invalidRequest("store credit cannot be applied to dry runs")
+	}
+	return s.holdCredit(ctx, req.CustomerID, req.Amount)
+}
+
+// creditOrder is the order object of an order paid in full with credit,
+// which never reaches Razorpay
+func (s *Service) creditOrder(data map[string]interface{}, credit *OrderCredit) map[string]interface{} {
+	order := map[string]interface{}{
+		"id":          "order_credit" + strings.TrimPrefix(credit.HoldID, "crh_"),
+		"entity":      "order",
+		"amount_paid": 0,
+		"amount_due":  0,
+		"status":      "paid",
+		"attempts":    0,
+		"created_at":  s.clock.Now().Unix(),
+	}
+	for k, v := range data {
+		order[k] = v
+	}
+	return order
+}
+
+// attachCredit records the order a hold is for, once the order exists,
+// and schedules its release
+func (s *Service) attachCredit(ctx context.Context, credit *OrderCredit, orderID string) {
+	_, err := s.updateCredit(ctx, credit.CustomerID, func(a *CreditAccount) error {
+		if h, ok := a.Holds[credit.HoldID]; ok {
+			h.OrderID = orderID
+			a.Holds[credit.HoldID] = h
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error attaching credit hold %s to order %s: %v", credit.HoldID, orderID, err)
+	}
+	s.creditHolds.add(orderID, *credit, s.clock.Now().Add(s.cfg.CreditHoldTTL))
+}
+
+// captureCredit deducts the order's credit as it is paid. A hold released
+// in the meantime is deducted from what is available, and any shortfall
+// recorded for review rather than failing the payment.
+func (s *Service) captureCredit(ctx context.Context, order *Order) error {
+	credit := order.Credit
+	if credit == nil || credit.Status == CreditCaptured {
+		return nil
+	}
+	shortfall := 0
+	_, err := s.updateCredit(ctx, credit.CustomerID, func(a *CreditAccount) error {
+		shortfall = 0
+		if _, held := a.Holds[credit.HoldID]; held {
+			delete(a.Holds, credit.HoldID)
+			a.Balance -= credit.Amount
+			return nil
+		}
+		deducted := min(max(a.Available(), 0), credit.Amount)
+		a.Balance -= deducted
+		shortfall = credit.Amount - deducted
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("capture credit of order %s: %w", order.ID, err)
+	}
+
+	now := s.clock.Now()
+	credit.Status = CreditCaptured
+	credit.Shortfall = shortfall
+	message := fmt.Sprintf("Captured %d paise of store credit", credit.Amount)
+	if shortfall > 0 {
+		log.Printf("ANOMALY: order %s was paid after its credit hold was released; %d paise of credit could not be deducted from %s",
+			order.ID, shortfall, credit.CustomerID)
+		message = fmt.Sprintf("Captured %d of %d paise of store credit; the rest was spent after the hold was released, review manually",
+			credit.Amount-shortfall, credit.Amount)
+	}
+	order.Timeline = append(order.Timeline, TimelineEntry{At: now, Type: TimelineCredit, Author: "system", Message: message})
+	s.creditHolds.remove(order.ID)
+	return nil
+}
+
+// releaseCredit returns the order's held credit to the customer
+func (s *Service) releaseCredit(ctx context.Context, order *Order, reason string) error {
+	credit := order.Credit
+	if credit == nil || credit.Status != CreditHeld {
+		return nil
+	}
+	_, err := s.updateCredit(ctx, credit.CustomerID, func(a *CreditAccount) error {
+		delete(a.Holds, credit.HoldID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("release credit of order %s: %w", order.ID, err)
+	}
+	credit.Status = CreditReleased
+	order.Timeline = append(order.Timeline, TimelineEntry{
+		At:      s.clock.Now(),
+		Type:    TimelineCredit,
+		Author:  "system",
+		Message: fmt.Sprintf("Released %d paise of store credit: %s", credit.Amount, reason),
+	})
+	s.creditHolds.remove(order.ID)
+	return nil
+}
+
+// releaseOrderCredit releases the credit held for an unpaid order
+func (s *Service) releaseOrderCredit(ctx context.Context, orderID, reason string) {
+	_, err := s.store.Update(ctx, orderID, func(order *Order) error {
+		if order.Status == OrderPaid {
+			return nil
+		}
+		return s.releaseCredit(ctx, order, reason)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Error releasing credit of order %s: %v", orderID, err)
+		}
+		return
+	}
+	s.creditHolds.remove(orderID)
+}
+
+// expireCredit releases a hold past CreditHoldTTL. A hold whose order was
+// never stored locally is released from the account directly.
+func (s *Service) expireCredit(ctx context.Context, orderID string, credit OrderCredit) {
+	if _, err := s.store.Get(ctx, orderID); !errors.Is(err, ErrNotFound) {
+		s.releaseOrderCredit(ctx, orderID, "order unpaid after the hold expired")
+		return
+	}
+	if err := s.dropHold(ctx, credit); err != nil {
+		log.Printf("Error releasing credit hold %s: %v", credit.HoldID, err)
+		return
+	}
+	s.creditHolds.remove(orderID)
+}
+
+// dropHold deletes a hold from the customer's account
+func (s *Service) dropHold(ctx context.Context, credit OrderCredit) error {
+	_, err := s.updateCredit(ctx, credit.CustomerID, func(a *CreditAccount) error {
+		delete(a.Holds, credit.HoldID)
+		return nil
+	})
+	return err
+}
+
+// creditHolds tracks when the credit held for each unpaid order expires
+type creditHolds struct {
+	mu    sync.Mutex
+	holds map[string]expiringHold
+}
+
+type expiringHold struct {
+	credit  OrderCredit
+	expires time.Time
+}
+
+func (h *creditHolds) add(orderID string, credit OrderCredit, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.holds[orderID] = expiringHold{credit: credit, expires: at}
+}
+
+func (h *creditHolds) remove(orderID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.holds, orderID)
+}
+
+// due returns the holds that have expired by now, by order ID
+func (h *creditHolds) due(now time.Time) map[string]OrderCredit {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	due := map[string]OrderCredit{}
+	for id, hold := range h.holds {
+		if !now.Before(hold.expires) {
+			due[id] = hold.credit
+		}
+	}
+	return due
+}
+
+// startCreditSweeper releases credit held for orders still unpaid after
+// CreditHoldTTL
+func (s *Service) startCreditSweeper() {
+	s.creditHolds = &creditHolds{holds: make(map[string]expiringHold)}
+	s.runners.Add("credit-sweeper", runner.Every(creditSweepInterval, func() {
+		for id, credit := range s.creditHolds.due(s.clock.Now()) {
+			s.expireCredit(context.Background(), id, credit)
+		}
+	}))
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+// grant gives the customer amount paise of credit
+func grant(t *testing.T, s *Service, customerID string, amount int) {
+	t.Helper()
+	if _, err := s.GrantCredit(context.Background(), customerID, CreditAdjustment{Amount: amount, Reason: "goodwill", Author: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrantAndDeductCredit(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	steps := []struct {
+		name    string
+		deduct  bool
+		amount  int
+		balance int
+		wantErr error
+	}{
+		{"grant", false, 50000, 50000, nil},
+		{"grant more", false, 10000, 60000, nil},
+		{"deduct", true, 20000, 40000, nil},
+		{"deduct too much", true, 40001, 40000, ErrInsufficientCredit},
+		{"deduct all", true, 40000, 0, nil},
+	}
+	for _, st := range steps {
+		req := CreditAdjustment{Amount: st.amount, Reason: st.name, Author: "ops"}
+		var err error
+		if st.deduct {
+			_, err = s.DeductCredit(ctx, "cust_1", req)
+		} else {
+			_, err = s.GrantCredit(ctx, "cust_1", req)
+		}
+		if !errors.Is(err, st.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", st.name, err, st.wantErr)
+		}
+		if b, _ := s.CreditBalance(ctx, "cust_1"); b.Balance != st.balance {
+			t.Fatalf("%s: balance = %d, want %d", st.name, b.Balance, st.balance)
+		}
+	}
+
+	var invalid *ValidationError
+	for _, amount := range []int{0, -100} {
+		if _, err := s.GrantCredit(ctx, "cust_1", CreditAdjustment{Amount: amount}); !errors.As(err, &invalid) {
+			t.Fatalf("grant of %d: err = %v, want a validation error", amount, err)
+		}
+		if _, err := s.DeductCredit(ctx, "cust_1", CreditAdjustment{Amount: amount}); !errors.As(err, &invalid) {
+			t.Fatalf("deduct of %d: err = %v, want a validation error", amount, err)
+		}
+	}
+}
+
+func TestCreateOrderWithCredit(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int
+		applied int
+		// charged is what reaches Razorpay; zero when the credit covers
+		// the order, which is paid at once
+		charged int
+	}{
+		{"part", 30000, 30000, 20000},
+		{"all", 60000, 50000, 0},
+		{"remainder below the minimum", 49950, 49900, 100},
+		{"no credit", 0, 0, 50000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			ctx := context.Background()
+			if tt.balance > 0 {
+				grant(t, s, "cust_1", tt.balance)
+			}
+
+			order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 50000, CustomerID: "cust_1", ApplyCredit: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if order["credit_applied"] != tt.applied || order["amount_total"] != 50000 {
+				t.Fatalf("order = %v, want %d of credit applied to 50000", order, tt.applied)
+			}
+			if tt.charged == 0 {
+				if gw.created != 0 {
+					t.Fatalf("%d Razorpay orders, want none for an order paid with credit", gw.created)
+				}
+			} else if gw.orders["order_1"]["amount"] != tt.charged {
+				t.Fatalf("Razorpay order = %v, want %d charged", gw.orders["order_1"], tt.charged)
+			}
+
+			stored, err := s.store.Get(ctx, order["id"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := s.CreditBalance(ctx, "cust_1")
+			switch {
+			case tt.applied == 0:
+				if stored.Credit != nil {
+					t.Fatalf("credit = %+v, want none", stored.Credit)
+				}
+			case tt.charged == 0:
+				if stored.Status != OrderPaid || stored.Credit.Status != CreditCaptured || b.Balance != tt.balance-tt.applied || len(b.Holds) != 0 {
+					t.Fatalf("order %s with credit %+v, balance %+v, want paid and the credit deducted", stored.Status, stored.Credit, b)
+				}
+			default:
+				if stored.Status != OrderCreated || stored.Credit.Status != CreditHeld || b.Balance != tt.balance || b.Available != tt.balance-tt.applied {
+					t.Fatalf("order %s with credit %+v, balance %+v, want the credit held", stored.Status, stored.Credit, b)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOrderWithCreditRefused(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.OrderDryRunEnabled = true
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	grant(t, s, "cust_1", 50000)
+	tests := []struct {
+		name string
+		req  PaymentRequest
+	}{
+		{"no customer", PaymentRequest{Amount: 50000, ApplyCredit: true}},
+		{"other currency", PaymentRequest{Amount: 50000, Currency: "USD", CustomerID: "cust_1", ApplyCredit: true}},
+		{"dry run", PaymentRequest{Amount: 50000, CustomerID: "cust_1", ApplyCredit: true, DryRun: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var invalid *ValidationError
+			if _, err := s.CreateOrder(context.Background(), tt.req); !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+		})
+	}
+	if b, _ := s.CreditBalance(context.Background(), "cust_1"); b.Available != 50000 {
+		t.Fatalf("available = %d after refused orders, want nothing held", b.Available)
+	}
+}
+
+func TestOrderCreditSettled(t *testing.T) {
+	tests := []struct {
+		name    string
+		settle  func(t *testing.T, s *Service, clk *clock.Fake, orderID string)
+		balance int
+		status  string
+	}{
+		{"paid", func(t *testing.T, s *Service, _ *clock.Fake, id string) {
+			s.markOrderPaid(context.Background(), id, "pay_1")
+		}, 0, CreditCaptured},
+		{"payment failed", func(t *testing.T, s *Service, _ *clock.Fake, id string) {
+			if err := deliver(t, s, failedPaymentBody(id, "pay_1", "BAD_REQUEST_ERROR"), "evt_1"); err != nil {
+				t.Fatal(err)
+			}
+			drainWebhooks(t, s)
+		}, 50000, CreditReleased},
+		{"hold expired", func(t *testing.T, s *Service, clk *clock.Fake, id string) {
+			clk.Advance(s.cfg.CreditHoldTTL)
+			for id, credit := range s.creditHolds.due(s.clock.Now()) {
+				s.expireCredit(context.Background(), id, credit)
+			}
+		}, 50000, CreditReleased},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.WebhookSecret = testWebhookSecret
+			cfg.WebhookReorderDelay = 0
+			s, clk := newTestService(t, newFakeGateway(), cfg)
+			ctx := context.Background()
+			grant(t, s, "cust_1", 50000)
+			order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 80000, CustomerID: "cust_1", ApplyCredit: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := order["id"].(string)
+
+			tt.settle(t, s, clk, id)
+			stored, _ := s.store.Get(ctx, id)
+			b, _ := s.CreditBalance(ctx, "cust_1")
+			if stored.Credit.Status != tt.status || b.Balance != tt.balance || len(b.Holds) != 0 {
+				t.Fatalf("credit %+v, balance %+v, want %s leaving %d", stored.Credit, b, tt.status, tt.balance)
+			}
+			recorded := false
+			for _, e := range stored.Timeline {
+				recorded = recorded || e.Type == TimelineCredit
+			}
+			if !recorded {
+				t.Fatalf("timeline = %+v, want the credit %s recorded", stored.Timeline, tt.status)
+			}
+		})
+	}
+}
+
+func TestConcurrentOrdersShareCredit(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	grant(t, s, "cust_1", 50000)
+
+	var wg sync.WaitGroup
+	applied := make([]int, 10)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 20000, CustomerID: "cust_1", ApplyCredit: true})
+			if err != nil {
+				t.Errorf("order %d: %v", i, err)
+				return
+			}
+			applied[i] = order["credit_applied"].(int)
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range applied {
+		total += n
+	}
+	// Orders the credit covered are paid, and their credit deducted
+	b, _ := s.CreditBalance(ctx, "cust_1")
+	held := 0
+	for _, h := range b.Holds {
+		held += h.Amount
+	}
+	if total != 50000 || b.Available != 0 || b.Balance != held {
+		t.Fatalf("%d paise applied across the orders, balance %+v, want exactly the 50000 spent or held", total, b)
+	}
+}
+
+func TestMemoryCreditStoreSwap(t *testing.T) {
+	m := NewMemoryCreditStore()
+	ctx := context.Background()
+	prev, _ := m.Account(ctx, "cust_1")
+	next := prev
+	next.Balance = 100
+	if ok, err := m.Swap(ctx, prev, next); !ok || err != nil {
+		t.Fatalf("first swap = %v, %v, want saved", ok, err)
+	}
+	// prev is stale now
+	next.Balance = 200
+	if ok, _ := m.Swap(ctx, prev, next); ok {
+		t.Fatal("swap from a stale version saved")
+	}
+	if a, _ := m.Account(ctx, "cust_1"); a.Balance != 100 || a.Version != 1 {
+		t.Fatalf("account = %+v, want the first swap kept at version 1", a)
+	}
+}
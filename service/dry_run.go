@@ -0,0 +1,27 @@
+package service
+
+import "errors"
+
+// ErrDryRunDisabled is returned for dry-run orders when the configuration
+// does not allow them
+var ErrDryRunDisabled = errors.New("dry-run orders are disabled")
+
+// dryRunOrder returns what Razorpay would answer for data, flagged
+// dry_run so it cannot be mistaken for a real order
+func (s *Service) dryRunOrder(data map[string]interface{}) map[string]interface{} {
+	amount, _ := data["amount"].(int)
+	order := map[string]interface{}{
+		"id":          simulatedID("order"),
+		"entity":      "order",
+		"amount_paid": 0,
+		"amount_due":  amount,
+		"status":      "created",
+		"attempts":    0,
+		"created_at":  s.clock.Now().Unix(),
+		"dry_run":     true,
+	}
+	for k, v := range data {
+		order[k] = v
+	}
+	return order
+}
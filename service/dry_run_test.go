@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDryRunOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		req     PaymentRequest
+		wantErr error
+	}{
+		{"dry run", true, PaymentRequest{Amount: 50000, Notes: map[string]string{"sku": "A-1"}, DryRun: true}, nil},
+		{"still validated", true, PaymentRequest{Amount: 50, DryRun: true}, ErrInvalidAmount},
+		{"disabled", false, PaymentRequest{Amount: 50000, DryRun: true}, ErrDryRunDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			cfg := testConfig(t)
+			cfg.OrderDryRunEnabled = tt.enabled
+			s, clk := newTestService(t, gw, cfg)
+			ctx := context.Background()
+
+			order, err := s.CreateOrder(ctx, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if gw.created != 0 {
+				t.Fatalf("%d orders created at Razorpay, want none", gw.created)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if order["dry_run"] != true || order["amount"] != tt.req.Amount || order["currency"] != "INR" || order["created_at"] != clk.Now().Unix() {
+				t.Fatalf("order = %v, want a synthetic order flagged dry_run", order)
+			}
+			if id, _ := order["id"].(string); id == "" {
+				t.Fatalf("order = %v, want an ID", order)
+			}
+			if _, err := s.store.Get(ctx, order["id"].(string)); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("dry-run order stored: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/egress"
+)
+
+// EgressPolicy is the policy of cfg that every request to a URL taken
+// from config or from a request is made under
+func EgressPolicy(cfg config.Config) egress.Policy {
+	return egress.Policy{
+		Schemes:          cfg.EgressAllowedSchemes,
+		AllowedHosts:     cfg.EgressAllowedHosts,
+		DeniedHosts:      cfg.EgressDeniedHosts,
+		MaxResponseBytes: int64(cfg.EgressMaxResponseBytes),
+		MaxRedirects:     cfg.EgressMaxRedirects,
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the service; the transport maps them onto responses
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrSessionExpired    = errors.New("checkout session expired")
+	ErrSignatureMismatch = errors.New("invalid payment signature")
+	ErrAlreadyVerified   = errors.New("payment already verified")
+	// ErrPaymentMismatch is a payment Razorpay reports against another
+	// order, or for another amount than the order was created for
+	ErrPaymentMismatch = errors.New("payment does not match order")
+	// ErrSignatureMalformed is a payment signature that is not 64 hex
+	// digits, so it could not have come from Razorpay
+	ErrSignatureMalformed = fmt.Errorf("%w: malformed", ErrSignatureMismatch)
+)
+
+// Order token verification failures, all wrapping ErrInvalidOrderToken
+var (
+	ErrInvalidOrderToken = errors.New("invalid order token")
+	ErrTokenMalformed    = fmt.Errorf("%w: malformed", ErrInvalidOrderToken)
+	ErrTokenSignature    = fmt.Errorf("%w: signature mismatch", ErrInvalidOrderToken)
+	ErrTokenExpired      = fmt.Errorf("%w: expired", ErrInvalidOrderToken)
+	ErrTokenOrder        = fmt.Errorf("%w: issued for another order", ErrInvalidOrderToken)
+	ErrTokenAmount       = fmt.Errorf("%w: issued for another amount", ErrInvalidOrderToken)
+)
+
+// Client binding failures, all wrapping ErrClientBinding
+var (
+	ErrClientBinding       = errors.New("verification not from the order's client")
+	ErrClientTokenMissing  = fmt.Errorf("%w: client token missing", ErrClientBinding)
+	ErrClientTokenMismatch = fmt.Errorf("%w: client token mismatch", ErrClientBinding)
+	ErrClientTokenExpired  = fmt.Errorf("%w: client token expired", ErrClientBinding)
+	ErrClientUnbound       = fmt.Errorf("%w: order has no client binding", ErrClientBinding)
+)
+
+// ValidationError reports a request the service refused before calling the
+// gateway, either with a single detail or with per-field messages
+type ValidationError struct {
+	Message string
+	Details string
+	Fields  map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Details != "" {
+		return e.Message + ": " + e.Details
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Fields)
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return &ValidationError{
+		Message: "Invalid request format",
+		Details: fmt.Sprintf(format, args...),
+	}
+}
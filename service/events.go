@@ -0,0 +1,147 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Internal event types published alongside processed webhook events
+const (
+	EventOrderStatusChanged = "order.status_changed"
+)
+
+// subscriberBuffer is how many events a stream subscriber may fall behind
+// before it is dropped
+const subscriberBuffer = 64
+
+// StreamEvent is one entry of the live admin event feed
+type StreamEvent struct {
+	// ID increases by one per event and is the SSE resume cursor
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	At   time.Time   `json:"at"`
+}
+
+// Subscription receives live events. C is closed when the subscription
+// ends; Dropped then reports whether it fell too far behind.
+type Subscription struct {
+	C <-chan StreamEvent
+
+	c       chan StreamEvent
+	types   map[string]bool
+	dropped bool
+}
+
+// Dropped reports whether the subscription was closed for being too slow.
+// It is only meaningful once C is closed.
+func (sub *Subscription) Dropped() bool {
+	return sub.dropped
+}
+
+func (sub *Subscription) wants(eventType string) bool {
+	return len(sub.types) == 0 || sub.types[eventType]
+}
+
+// eventBus fans events out to stream subscribers and keeps the most recent
+// ones in a ring so reconnecting clients can resume
+type eventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	ring   []StreamEvent
+	start  int
+	subs   map[*Subscription]struct{}
+}
+
+func newEventBus(size int) *eventBus {
+	return &eventBus{
+		nextID: 1,
+		ring:   make([]StreamEvent, 0, size),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// publish records the event and hands it to every interested subscriber
+// without blocking; a subscriber whose buffer is full is dropped
+func (b *eventBus) publish(eventType string, data interface{}, at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ev := StreamEvent{ID: b.nextID, Type: eventType, Data: data, At: at}
+	b.nextID++
+	if len(b.ring) < cap(b.ring) {
+		b.ring = append(b.ring, ev)
+	} else if cap(b.ring) > 0 {
+		b.ring[b.start] = ev
+		b.start = (b.start + 1) % cap(b.ring)
+	}
+
+	for sub := range b.subs {
+		if !sub.wants(eventType) {
+			continue
+		}
+		select {
+		case sub.c <- ev:
+		default:
+			sub.dropped = true
+			b.remove(sub)
+		}
+	}
+}
+
+// subscribe registers a subscriber for types (all when empty) and returns
+// the buffered events after lastID it missed
+func (b *eventBus) subscribe(lastID uint64, types []string) (*Subscription, []StreamEvent) {
+	c := make(chan StreamEvent, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, types: make(map[string]bool, len(types))}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []StreamEvent
+	if lastID > 0 {
+		for i := range b.ring {
+			ev := b.ring[(b.start+i)%len(b.ring)]
+			if ev.ID > lastID && sub.wants(ev.Type) {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	return sub, backlog
+}
+
+// unsubscribe ends sub; it is safe to call after sub was dropped
+func (b *eventBus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+func (b *eventBus) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// SubscribeEvents streams processed webhook events and order status
+// changes of the given types, all of them when types is empty. Events
+// after lastID still in the ring buffer are returned for replay first.
+// Callers must Unsubscribe when done.
+func (s *Service) SubscribeEvents(lastID uint64, types []string) (*Subscription, []StreamEvent) {
+	return s.events.subscribe(lastID, types)
+}
+
+// UnsubscribeEvents ends a subscription from SubscribeEvents
+func (s *Service) UnsubscribeEvents(sub *Subscription) {
+	s.events.unsubscribe(sub)
+}
+
+// publishEvent adds an event to the admin feed
+func (s *Service) publishEvent(eventType string, data interface{}) {
+	s.events.publish(eventType, data, s.clock.Now())
+}
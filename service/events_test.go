@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// ids returns the IDs of events
+func ids(events []StreamEvent) string {
+	var out []uint64
+	for _, ev := range events {
+		out = append(out, ev.ID)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestEventBusReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		published int
+		lastID    uint64
+		types     []string
+		want      string
+	}{
+		{"fresh subscriber", 3, 0, nil, "[]"},
+		{"missed some", 3, 1, nil, "[2 3]"},
+		{"missed none", 3, 3, nil, "[]"},
+		// The ring holds four, so events 1 and 2 are gone
+		{"ring wrapped", 6, 1, nil, "[3 4 5 6]"},
+		{"filtered", 6, 2, []string{"payment.captured"}, "[4 6]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newEventBus(4)
+			for i := 1; i <= tt.published; i++ {
+				eventType := "refund.processed"
+				if i%2 == 0 {
+					eventType = "payment.captured"
+				}
+				b.publish(eventType, nil, time.Now())
+			}
+			sub, backlog := b.subscribe(tt.lastID, tt.types)
+			defer b.unsubscribe(sub)
+			if got := ids(backlog); got != tt.want {
+				t.Fatalf("backlog = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventBusFiltersLiveEvents(t *testing.T) {
+	b := newEventBus(8)
+	sub, _ := b.subscribe(0, []string{"payment.captured"})
+	defer b.unsubscribe(sub)
+	b.publish("refund.processed", nil, time.Now())
+	b.publish("payment.captured", nil, time.Now())
+
+	if ev := <-sub.C; ev.ID != 2 || ev.Type != "payment.captured" {
+		t.Fatalf("event = %+v, want 2 payment.captured", ev)
+	}
+	select {
+	case ev := <-sub.C:
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	b := newEventBus(8)
+	slow, _ := b.subscribe(0, nil)
+	fast, _ := b.subscribe(0, nil)
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < subscriberBuffer+10; i++ {
+			b.publish("payment.captured", nil, time.Now())
+			// fast keeps up; slow never reads
+			<-fast.C
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing blocked on a slow subscriber")
+	}
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if !slow.Dropped() || n != subscriberBuffer {
+		t.Fatalf("slow subscriber got %d events, dropped %v, want %d then dropped", n, slow.Dropped(), subscriberBuffer)
+	}
+	if fast.Dropped() {
+		t.Fatal("a subscriber keeping up was dropped")
+	}
+	// Unsubscribing after the drop is safe
+	b.unsubscribe(slow)
+	b.unsubscribe(fast)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// paymentAccount routes ctx to the account that created the order paid by
+// paymentID, so a capture or refund goes to that account alone. Payments
+// on orders the store does not know go to the primary.
+func (s *Service) paymentAccount(ctx context.Context, paymentID string) (context.Context, error) {
+	if !s.cfg.ProviderFailover && s.accounts == nil {
+		return ctx, nil
+	}
+	if _, ok := gateway.AccountFrom(ctx); ok {
+		return ctx, nil
+	}
+	payment, err := s.gateway.FetchPayment(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch payment %s: %w", paymentID, err)
+	}
+	orderID, _ := payment["order_id"].(string)
+	order, err := s.store.Get(ctx, orderID)
+	switch {
+	case errors.Is(err, ErrNotFound) || orderID == "":
+		return ctx, nil
+	case err != nil:
+		return nil, fmt.Errorf("load order %s: %w", orderID, err)
+	}
+	if order.Provider == "" {
+		return ctx, nil
+	}
+	return gateway.WithAccount(ctx, order.Provider), nil
+}
+
+// paymentSecret is the key secret payments on orderID are signed with:
+// that of the account which created the order, when it is not the primary
+func (s *Service) paymentSecret(ctx context.Context, orderID string) string {
+	if !s.cfg.ProviderFailover && s.accounts == nil {
+		return s.cfg.SecretKey
+	}
+	if order, err := s.store.Get(ctx, orderID); err == nil {
+		_, secret := s.providerKeys(order.Provider)
+		return secret
+	}
+	return s.cfg.SecretKey
+}
+
+// checkoutKey is the key ID Razorpay Checkout opens an order created by
+// provider with
+func (s *Service) checkoutKey(provider string) string {
+	keyID, _ := s.providerKeys(provider)
+	return keyID
+}
+
+// providerKeys is the key pair of the account provider names: the failover
+// account, a routed account or, for anything else, the primary
+func (s *Service) providerKeys(provider string) (keyID, secret string) {
+	if provider == gateway.ProviderSecondary && s.cfg.ProviderFailover {
+		return s.cfg.FailoverAPIKey, s.cfg.FailoverSecretKey
+	}
+	if acct, ok := s.account(provider); ok {
+		return acct.KeyID, acct.KeySecret
+	}
+	return s.cfg.APIKey, s.cfg.SecretKey
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+func TestCaptureGoesToTheOrdersAccount(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ProviderFailover = true
+	cfg.FailoverAPIKey, cfg.FailoverSecretKey = "rzp_test_failover", "failover_secret"
+
+	tests := []struct {
+		name string
+		// unreachable fails creating the order on the primary
+		unreachable bool
+	}{
+		{name: "order on the primary"},
+		{name: "order on the secondary", unreachable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, secondary := newFakeGateway(), newFakeGateway()
+			if tt.unreachable {
+				primary.createErr = &net.OpError{Op: "dial", Net: "tcp"}
+			}
+			s, _ := newTestService(t, gateway.NewFailover(primary, secondary), cfg)
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			if tt.unreachable {
+				primary.createErr = nil
+			}
+			// Both accounts know a payment of that ID, so a capture tried in
+			// turn would land on the primary
+			primary.pay("pay_1", orderID, 500, "INR")
+			secondary.pay("pay_1", orderID, 500, "INR")
+			want, other := primary, secondary
+			if tt.unreachable {
+				want, other = secondary, primary
+			}
+
+			if _, err := s.CapturePayment(context.Background(), "pay_1", CaptureRequest{Amount: 500}); err != nil {
+				t.Fatalf("capture: %v", err)
+			}
+			if len(want.captured) != 1 || len(other.captured) != 0 {
+				t.Fatalf("captured %v on the order's account and %v on the other", want.captured, other.captured)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/flags"
+)
+
+// flagsNote is the order note recording the branch of every flag
+const flagsNote = "flags"
+
+// WithFlags makes the service consult e for soft-launched changes. Without
+// it every flag is off.
+func WithFlags(e flags.Evaluator) Option {
+	return func(s *Service) {
+		s.flags = e
+	}
+}
+
+// FeatureFlags returns the configured flags
+func (s *Service) FeatureFlags() []flags.Flag {
+	return s.flags.Flags()
+}
+
+// decideFlag returns the branch the caller gets for the named flag and
+// logs it. customer, when known, keeps the branch stable per customer.
+func (s *Service) decideFlag(ctx context.Context, name, customer string) flags.Decision {
+	subject := flags.Subject{Customer: customer}
+	if id, ok := authctx.Principal(ctx); ok && id.Kind == authctx.KindAPIKey {
+		subject.APIKey = id.ID
+	}
+	subject.Tenant, _ = authctx.Tenant(ctx)
+
+	d := s.flags.Decide(name, subject)
+	log.Printf("Flag %s is %s (%s)%s", name, d.Branch(), d.Reason, authctx.LogFields(ctx))
+	return d
+}
+
+// withFlagNotes returns notes with the caller's branch of every configured
+// flag added as one note, e.g. "async_create=on,stripe=off", so orders can
+// be attributed to a branch afterwards
+func (s *Service) withFlagNotes(ctx context.Context, notes map[string]string, customer string) map[string]string {
+	configured := s.flags.Flags()
+	if len(configured) == 0 {
+		return notes
+	}
+	if _, set := notes[flagsNote]; !set && len(notes) >= maxNotes {
+		log.Printf("Leaving %q note off order: notes limit reached", flagsNote)
+		return notes
+	}
+
+	branches := make([]string, 0, len(configured))
+	for _, f := range configured {
+		branches = append(branches, f.Name+"="+s.decideFlag(ctx, f.Name, customer).Branch())
+	}
+	tagged := make(map[string]string, len(notes)+1)
+	for k, v := range notes {
+		tagged[k] = v
+	}
+	tagged[flagsNote] = strings.Join(branches, ",")
+	return tagged
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/flags"
+)
+
+func TestOrderRecordsFlagBranches(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags flags.Evaluator
+		notes map[string]string
+		// want is the flags note, empty when it is left off
+		want string
+	}{
+		{"no flags", nil, nil, ""},
+		{"forced branches", flags.Static{"stripe": false, "async_create": true}, nil, "async_create=on,stripe=off"},
+		{"caller notes kept", flags.Static{"stripe": true}, map[string]string{"sku": "tee"}, "stripe=on"},
+		// with created_at the order already has every note it can take
+		{"no room", flags.Static{"stripe": true}, manyNotes("n", maxNotes-1), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			var opts []Option
+			if tt.flags != nil {
+				opts = append(opts, WithFlags(tt.flags))
+			}
+			s, _ := newTestService(t, gw, testConfig(t), opts...)
+			if _, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 50000, Notes: tt.notes}); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := gw.orders["order_1"]["notes"].(map[string]string)
+			if got, ok := sent[flagsNote]; got != tt.want || ok != (tt.want != "") {
+				t.Fatalf("flags note = %q, want %q", got, tt.want)
+			}
+			if len(sent) > maxNotes {
+				t.Fatalf("%d notes sent, want at most %d", len(sent), maxNotes)
+			}
+			for k, v := range tt.notes {
+				if sent[k] != v {
+					t.Fatalf("caller note %s = %q, want %q", k, sent[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestFlagRolloutKeyedByCaller(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	if err := os.WriteFile(path, []byte(`{"flags":[{"name":"stripe","rollout":0,"allow":["pos","cust_vip"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := flags.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, testConfig(t), WithFlags(store))
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		customer string
+		want     string
+	}{
+		{"anonymous", "", "", "stripe=off"},
+		{"allowed API key", "pos", "", "stripe=on"},
+		{"other API key", "web", "", "stripe=off"},
+		{"allowed customer", "web", "cust_vip", "stripe=on"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.apiKey != "" {
+				ctx = authctx.WithPrincipal(ctx, authctx.Identity{Kind: authctx.KindAPIKey, ID: tt.apiKey})
+			}
+			order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 50000, CustomerID: tt.customer})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gw.orders[order["id"].(string)]["notes"].(map[string]string)[flagsNote]; got != tt.want {
+				t.Fatalf("flags note = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := s.FeatureFlags(); len(got) != 1 || got[0].Name != "stripe" {
+		t.Fatalf("feature flags = %+v, want stripe", got)
+	}
+}
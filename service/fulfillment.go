@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/egress"
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// Fulfillment delivery states
+const (
+	FulfillmentPending   = "pending"
+	FulfillmentDelivered = "delivered"
+	// FulfillmentFailed deliveries exhausted their retries and wait for an
+	// operator to replay them
+	FulfillmentFailed = "failed"
+)
+
+const (
+	fulfillmentMaxBackoff     = 5 * time.Minute
+	fulfillmentDeliverTimeout = 10 * time.Second
+)
+
+// ErrFulfillmentNotFailed is a replay of a delivery that has not failed
+var ErrFulfillmentNotFailed = errors.New("fulfillment delivery has not failed")
+
+// FulfillmentDelivery tracks the paid notification for one order
+type FulfillmentDelivery struct {
+	OrderID     string     `json:"order_id"`
+	URL         string     `json:"url"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	FailedAt    *time.Time `json:"failed_at,omitempty"`
+
+	event notify.Event
+}
+
+// fulfillments holds one delivery per order, so each order is announced
+// once however often it is marked paid
+type fulfillments struct {
+	mu         sync.Mutex
+	deliveries map[string]*FulfillmentDelivery
+	channel    *notify.Callback
+	stop       chan struct{}
+}
+
+func (s *Service) startFulfillments() {
+	s.fulfillments = &fulfillments{
+		deliveries: make(map[string]*FulfillmentDelivery),
+		channel: &notify.Callback{
+			Secret: s.cfg.FulfillmentSecret,
+			Client: s.egress.Client(fulfillmentDeliverTimeout),
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+// checkFulfillmentURL accepts only http(s) URLs on an allow-listed host
+// that the egress policy allows; https is required in release mode. A
+// "*.example.com" entry allows every subdomain of example.com.
+func (s *Service) checkFulfillmentURL(raw string) error {
+	if len(s.cfg.FulfillmentAllowedHosts) == 0 {
+		return invalidRequest("fulfillment_url is not enabled")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return invalidRequest("fulfillment_url must be an absolute http or https URL")
+	}
+	if u.Scheme != "https" && s.cfg.Mode == config.ModeRelease {
+		return invalidRequest("fulfillment_url must use https")
+	}
+	if u.User != nil {
+		return invalidRequest("fulfillment_url must not carry credentials")
+	}
+	host := strings.ToLower(u.Hostname())
+	if !egress.MatchHost(s.cfg.FulfillmentAllowedHosts, host) {
+		return invalidRequest("fulfillment_url host %q is not allowed", host)
+	}
+	if err := s.egress.Check(u); err != nil {
+		return invalidRequest("fulfillment_url is refused by the egress policy: %v", err)
+	}
+	return nil
+}
+
+// queueFulfillment announces a newly paid order to its fulfillment URL, if
+// it has one and was not announced before
+func (s *Service) queueFulfillment(order Order) {
+	if order.FulfillmentURL == "" {
+		return
+	}
+	f := s.fulfillments
+	f.mu.Lock()
+	if _, seen := f.deliveries[order.ID]; seen {
+		f.mu.Unlock()
+		return
+	}
+	now := s.clock.Now()
+	d := &FulfillmentDelivery{
+		OrderID:   order.ID,
+		URL:       order.FulfillmentURL,
+		Status:    FulfillmentPending,
+		CreatedAt: now,
+		event: notify.Event{
+			Type:       notify.EventOrderPaid,
+			Subject:    order.ID,
+			OccurredAt: now,
+			Data: map[string]interface{}{
+				"order_id":   order.ID,
+				"amount":     order.Amount,
+				"currency":   order.Currency,
+				"receipt":    order.Receipt,
+				"payment_id": order.PaymentID,
+				"notes":      order.Notes,
+				"line_items": order.LineItems,
+				"brand":      order.Brand,
+			},
+		},
+	}
+	f.deliveries[order.ID] = d
+	f.mu.Unlock()
+
+	go s.deliverFulfillment(d)
+}
+
+// deliverFulfillment POSTs the signed event with exponential backoff,
+// marking the delivery failed once FulfillmentMaxAttempts are used up
+func (s *Service) deliverFulfillment(d *FulfillmentDelivery) {
+	f := s.fulfillments
+	backoff := s.cfg.FulfillmentRetryBackoff
+	for {
+		f.mu.Lock()
+		d.Attempts++
+		attempt := d.Attempts
+		f.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), fulfillmentDeliverTimeout)
+		channel := *f.channel
+		channel.URL = d.URL
+		err := channel.Deliver(ctx, d.event)
+		cancel()
+
+		f.mu.Lock()
+		now := s.clock.Now()
+		if err == nil {
+			d.Status, d.LastError, d.DeliveredAt = FulfillmentDelivered, "", &now
+			f.mu.Unlock()
+			log.Printf("Delivered fulfillment for order %s after %d attempts", d.OrderID, attempt)
+			return
+		}
+		d.LastError = err.Error()
+		if attempt >= s.cfg.FulfillmentMaxAttempts {
+			d.Status, d.FailedAt = FulfillmentFailed, &now
+			f.mu.Unlock()
+			log.Printf("Fulfillment for order %s failed after %d attempts, dead-lettered: %v", d.OrderID, attempt, err)
+			return
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-time.After(backoff):
+		case <-f.stop:
+			return
+		}
+		backoff = min(backoff*2, fulfillmentMaxBackoff)
+	}
+}
+
+// Fulfillments lists deliveries in the given states, all of them when none
+// are given, oldest first
+func (s *Service) Fulfillments(states ...string) []FulfillmentDelivery {
+	f := s.fulfillments
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := make([]FulfillmentDelivery, 0, len(f.deliveries))
+	for _, d := range f.deliveries {
+		if len(states) == 0 || slices.Contains(states, d.Status) {
+			list = append(list, *d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// ReplayFulfillment retries a failed delivery from scratch
+func (s *Service) ReplayFulfillment(ctx context.Context, orderID string) (FulfillmentDelivery, error) {
+	f := s.fulfillments
+	f.mu.Lock()
+	d, ok := f.deliveries[orderID]
+	if !ok {
+		f.mu.Unlock()
+		return FulfillmentDelivery{}, ErrNotFound
+	}
+	if d.Status != FulfillmentFailed {
+		f.mu.Unlock()
+		return FulfillmentDelivery{}, fmt.Errorf("%w: order %s is %s", ErrFulfillmentNotFailed, orderID, d.Status)
+	}
+	d.Status, d.Attempts, d.FailedAt = FulfillmentPending, 0, nil
+	replayed := *d
+	f.mu.Unlock()
+
+	log.Printf("Replaying fulfillment for order %s", orderID)
+	go s.deliverFulfillment(d)
+	return replayed, nil
+}
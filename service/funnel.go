@@ -0,0 +1,285 @@
+package service
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Funnel stages, in the order customers go through them
+const (
+	FunnelOrderCreated     = "order_created"
+	FunnelCheckoutOpened   = "checkout_opened"
+	FunnelPaymentAttempted = "payment_attempted"
+	FunnelPaymentCaptured  = "payment_captured"
+)
+
+// funnelStages orders the stages of FunnelReport
+var funnelStages = []string{FunnelOrderCreated, FunnelCheckoutOpened, FunnelPaymentAttempted, FunnelPaymentCaptured}
+
+// CheckoutEvent is a beacon the checkout page sends about an order
+type CheckoutEvent struct {
+	Event string `json:"event" binding:"required"`
+}
+
+// topFailuresLimit is how many failure reasons FunnelReport lists
+const topFailuresLimit = 10
+
+// FunnelReport aggregates the funnel of the orders created in [From, To)
+type FunnelReport struct {
+	From   time.Time     `json:"from"`
+	To     time.Time     `json:"to"`
+	Stages []FunnelStage `json:"stages"`
+	// FailedOrders had at least one failed payment; RetriedOrders more than
+	// one payment attempt; RecoveredOrders were captured after a failure
+	FailedOrders    int            `json:"failed_orders"`
+	RetriedOrders   int            `json:"retried_orders"`
+	RecoveredOrders int            `json:"recovered_orders"`
+	TopFailures     []FailureCount `json:"top_failures"`
+	// Abandoned counts the orders whose checkout was abandoned, by reason
+	Abandoned map[string]int `json:"abandoned"`
+}
+
+// FunnelStage is how many orders reached a stage. Percent is relative to
+// the orders created and DropOff to the previous stage, both out of 100.
+type FunnelStage struct {
+	Stage   string  `json:"stage"`
+	Orders  int     `json:"orders"`
+	Percent float64 `json:"percent"`
+	DropOff float64 `json:"drop_off"`
+}
+
+// FailureCount is how many failed payments Razorpay gave a reason
+type FailureCount struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// failedPayment is the part of a payment.failed entity the funnel and
+// payment recovery read
+type failedPayment struct {
+	ID          string `json:"id"`
+	OrderID     string `json:"order_id"`
+	ErrorCode   string `json:"error_code"`
+	ErrorReason string `json:"error_reason"`
+	Email       string `json:"email"`
+	Contact     string `json:"contact"`
+}
+
+// funnelOrder is what the funnel knows of one order. A stage is recorded
+// once, so duplicate beacons and redelivered webhooks count once.
+type funnelOrder struct {
+	created  time.Time
+	opened   bool
+	captured bool
+	// payments holds the failure of each attempted payment, nil for those
+	// that did not fail
+	payments map[string]*FailureCount
+	// failedBeforeCapture is set when a failure preceded the capture
+	failedBeforeCapture bool
+	// abandoned is the reason the checkout was first abandoned for
+	abandoned string
+}
+
+// funnelTracker keeps the funnel of recent orders in memory. Orders are
+// dropped oldest first once past the retention or the size cap.
+type funnelTracker struct {
+	mu        sync.Mutex
+	retention time.Duration
+	maxOrders int
+	orders    map[string]*funnelOrder
+	// queue lists order IDs in creation order, for eviction
+	queue []string
+}
+
+func newFunnelTracker(retention time.Duration, maxOrders int) *funnelTracker {
+	return &funnelTracker{
+		retention: retention,
+		maxOrders: maxOrders,
+		orders:    make(map[string]*funnelOrder),
+	}
+}
+
+// trackFunnel applies fn to the tracker. Analytics are best-effort: a
+// failure is logged and never reaches the payment path.
+func (s *Service) trackFunnel(fn func(f *funnelTracker, now time.Time)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Funnel tracking failed: %v", r)
+		}
+	}()
+	f := s.funnel
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f, s.clock.Now())
+}
+
+// created starts tracking a new order, making room for it first
+func (f *funnelTracker) created(orderID string, now time.Time) {
+	if _, ok := f.orders[orderID]; ok {
+		return
+	}
+	for len(f.queue) > 0 {
+		oldest, ok := f.orders[f.queue[0]]
+		expired := !ok || (f.retention > 0 && now.Sub(oldest.created) > f.retention)
+		if !expired && (f.maxOrders <= 0 || len(f.orders) < f.maxOrders) {
+			break
+		}
+		delete(f.orders, f.queue[0])
+		f.queue = f.queue[1:]
+	}
+	f.orders[orderID] = &funnelOrder{created: now, payments: make(map[string]*FailureCount)}
+	f.queue = append(f.queue, orderID)
+}
+
+// opened records the checkout being opened; orders the tracker did not see
+// created are ignored
+func (f *funnelTracker) opened(orderID string) {
+	if o, ok := f.orders[orderID]; ok {
+		o.opened = true
+	}
+}
+
+// attempted records a payment against the order
+func (f *funnelTracker) attempted(orderID, paymentID string) {
+	o, ok := f.orders[orderID]
+	if !ok || paymentID == "" {
+		return
+	}
+	if _, seen := o.payments[paymentID]; !seen {
+		o.payments[paymentID] = nil
+	}
+}
+
+// failed records a payment failing with code and reason
+func (f *funnelTracker) failed(orderID, paymentID, code, reason string) {
+	o, ok := f.orders[orderID]
+	if !ok || paymentID == "" || o.payments[paymentID] != nil {
+		return
+	}
+	if code == "" {
+		code = "unknown"
+	}
+	o.payments[paymentID] = &FailureCount{Code: code, Reason: reason, Count: 1}
+}
+
+// captured records the order being paid by paymentID
+func (f *funnelTracker) captured(orderID, paymentID string) {
+	o, ok := f.orders[orderID]
+	if !ok || o.captured {
+		return
+	}
+	f.attempted(orderID, paymentID)
+	o.captured = true
+	for _, failure := range o.payments {
+		if failure != nil {
+			o.failedBeforeCapture = true
+		}
+	}
+}
+
+// abandoned records the checkout being abandoned for reason; only the
+// first reason counts
+func (f *funnelTracker) abandoned(orderID, reason string) {
+	if o, ok := f.orders[orderID]; ok && o.abandoned == "" {
+		o.abandoned = reason
+	}
+}
+
+// RecordCheckoutEvent records a beacon from the checkout page. Only
+// checkout_opened is accepted; repeats of it are harmless.
+func (s *Service) RecordCheckoutEvent(orderID string, ev CheckoutEvent) error {
+	if ev.Event != FunnelCheckoutOpened {
+		return invalidRequest("event must be %s", FunnelCheckoutOpened)
+	}
+	s.trackFunnel(func(f *funnelTracker, _ time.Time) {
+		f.opened(orderID)
+	})
+	return nil
+}
+
+// Funnel reports the funnel of the orders created in [from, to)
+func (s *Service) Funnel(from, to time.Time) (FunnelReport, error) {
+	if !from.Before(to) {
+		return FunnelReport{}, invalidRequest("from must be before to")
+	}
+	report := FunnelReport{From: from.UTC(), To: to.UTC(), TopFailures: []FailureCount{}, Abandoned: map[string]int{}}
+	reached := make([]int, len(funnelStages))
+	failures := map[FailureCount]int{}
+
+	s.funnel.mu.Lock()
+	for _, o := range s.funnel.orders {
+		if o.created.Before(from) || !o.created.Before(to) {
+			continue
+		}
+		reached[0]++
+		if o.opened {
+			reached[1]++
+		}
+		if len(o.payments) > 0 {
+			reached[2]++
+		}
+		if o.captured {
+			reached[3]++
+		}
+		if len(o.payments) > 1 {
+			report.RetriedOrders++
+		}
+		if o.failedBeforeCapture {
+			report.RecoveredOrders++
+		}
+		if o.abandoned != "" {
+			report.Abandoned[o.abandoned]++
+		}
+		failedOrder := false
+		for _, failure := range o.payments {
+			if failure != nil {
+				failures[FailureCount{Code: failure.Code, Reason: failure.Reason}]++
+				failedOrder = true
+			}
+		}
+		if failedOrder {
+			report.FailedOrders++
+		}
+	}
+	s.funnel.mu.Unlock()
+
+	for i, stage := range funnelStages {
+		st := FunnelStage{Stage: stage, Orders: reached[i], Percent: percent(reached[i], reached[0])}
+		if i > 0 {
+			st.DropOff = percent(reached[i-1]-reached[i], reached[i-1])
+		}
+		report.Stages = append(report.Stages, st)
+	}
+
+	for failure, n := range failures {
+		failure.Count = n
+		report.TopFailures = append(report.TopFailures, failure)
+	}
+	sort.Slice(report.TopFailures, func(i, j int) bool {
+		a, b := report.TopFailures[i], report.TopFailures[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		return a.Reason < b.Reason
+	})
+	if len(report.TopFailures) > topFailuresLimit {
+		report.TopFailures = report.TopFailures[:topFailuresLimit]
+	}
+	return report, nil
+}
+
+// percent is n out of total as a percentage to one decimal, zero when
+// total is
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
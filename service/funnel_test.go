@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failedPaymentBody is a payment.failed webhook for paymentID of orderID
+func failedPaymentBody(orderID, paymentID, code string) string {
+	return `{"event":"payment.failed","payload":{"payment":{"entity":{"id":"` + paymentID + `","order_id":"` + orderID +
+		`","error_code":"` + code + `","error_reason":"payment_failed"}}}}`
+}
+
+func TestFunnel(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookReorderDelay = 0
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	ctx := context.Background()
+	from := clk.Now()
+
+	var orders []string
+	for i := 0; i < 4; i++ {
+		orders = append(orders, createTestOrder(t, s, 50000)["id"].(string))
+	}
+	for _, id := range []string{orders[0], orders[0], orders[1], orders[2]} {
+		if err := s.RecordCheckoutEvent(id, CheckoutEvent{Event: FunnelCheckoutOpened}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first order fails, is retried and paid; the second only fails,
+	// twice over as Razorpay redelivers; the third is paid at once
+	for i, body := range []string{
+		failedPaymentBody(orders[0], "pay_a", "BAD_REQUEST_ERROR"),
+		failedPaymentBody(orders[1], "pay_c", "BAD_REQUEST_ERROR"),
+		failedPaymentBody(orders[1], "pay_c", "BAD_REQUEST_ERROR"),
+	} {
+		if err := deliver(t, s, body, ""); err != nil {
+			t.Fatalf("webhook %d: %v", i+1, err)
+		}
+	}
+	drainWebhooks(t, s)
+	s.markOrderPaid(ctx, orders[0], "pay_b")
+	s.markOrderPaid(ctx, orders[2], "pay_d")
+	// Created after the window
+	clk.Advance(time.Hour)
+	createTestOrder(t, s, 50000)
+
+	report, err := s.Funnel(from, from.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStages := []FunnelStage{
+		{Stage: FunnelOrderCreated, Orders: 4, Percent: 100},
+		{Stage: FunnelCheckoutOpened, Orders: 3, Percent: 75, DropOff: 25},
+		{Stage: FunnelPaymentAttempted, Orders: 3, Percent: 75},
+		{Stage: FunnelPaymentCaptured, Orders: 2, Percent: 50, DropOff: 33.3},
+	}
+	if !reflect.DeepEqual(report.Stages, wantStages) {
+		t.Fatalf("stages = %+v, want %+v", report.Stages, wantStages)
+	}
+	if report.FailedOrders != 2 || report.RetriedOrders != 1 || report.RecoveredOrders != 1 {
+		t.Fatalf("failed %d, retried %d, recovered %d, want 2, 1, 1", report.FailedOrders, report.RetriedOrders, report.RecoveredOrders)
+	}
+	wantFailures := []FailureCount{{Code: "BAD_REQUEST_ERROR", Reason: "payment_failed", Count: 2}}
+	if !reflect.DeepEqual(report.TopFailures, wantFailures) {
+		t.Fatalf("top failures = %+v, want %+v", report.TopFailures, wantFailures)
+	}
+}
+
+func TestFunnelRefusesBadInput(t *testing.T) {
+	s, clk := newTestService(t, newFakeGateway(), testConfig(t))
+	var invalid *ValidationError
+	if err := s.RecordCheckoutEvent("order_1", CheckoutEvent{Event: "payment_captured"}); !errors.As(err, &invalid) {
+		t.Fatalf("beacon for another stage: err = %v, want a validation error", err)
+	}
+	if err := s.RecordCheckoutEvent("order_unknown", CheckoutEvent{Event: FunnelCheckoutOpened}); err != nil {
+		t.Fatalf("beacon for an unknown order: %v, want it ignored", err)
+	}
+	if _, err := s.Funnel(clk.Now(), clk.Now()); !errors.As(err, &invalid) {
+		t.Fatalf("empty range: err = %v, want a validation error", err)
+	}
+}
+
+func TestFunnelTrackerEvicts(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		retention time.Duration
+		maxOrders int
+		want      []string
+	}{
+		{"size cap", 0, 2, []string{"order_2", "order_3"}},
+		{"retention", 90 * time.Minute, 0, []string{"order_2", "order_3"}},
+		{"neither", 0, 0, []string{"order_1", "order_2", "order_3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFunnelTracker(tt.retention, tt.maxOrders)
+			for i, id := range []string{"order_1", "order_2", "order_3"} {
+				f.created(id, start.Add(time.Duration(i)*time.Hour))
+			}
+			if !reflect.DeepEqual(f.queue, tt.want) || len(f.orders) != len(tt.want) {
+				t.Fatalf("tracking %v, want %v", f.queue, tt.want)
+			}
+		})
+	}
+}
+
+func TestFunnelTrackingNeverFailsThePaymentPath(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	s.trackFunnel(func(*funnelTracker, time.Time) { panic("boom") })
+	if !strings.Contains(buf.String(), "Funnel tracking failed: boom") {
+		t.Fatalf("log = %q, want the failure logged", buf.String())
+	}
+	// The tracker is left unlocked
+	createTestOrder(t, s, 50000)
+}
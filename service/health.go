@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Dependency and overall health states
+const (
+	HealthUp       = "up"
+	HealthDown     = "down"
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthFailing  = "unhealthy"
+)
+
+// Pinger is implemented by stores that can report their own reachability
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DependencyHealth is the outcome of checking one dependency
+type DependencyHealth struct {
+	Status    string `json:"status"`
+	Required  bool   `json:"required"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthReport aggregates every dependency check
+type HealthReport struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+}
+
+// Healthy reports whether every required dependency is up
+func (r HealthReport) Healthy() bool {
+	return r.Status != HealthFailing
+}
+
+type healthCheck struct {
+	name     string
+	required bool
+	check    func(ctx context.Context) error
+}
+
+// Health checks every dependency concurrently, each under its own timeout
+func (s *Service) Health(ctx context.Context, timeout time.Duration) HealthReport {
+	checks := []healthCheck{
+		{name: "razorpay", required: true, check: s.gateway.Ping},
+	}
+	if p, ok := s.store.(Pinger); ok {
+		checks = append(checks, healthCheck{name: "database", required: true, check: p.Ping})
+	}
+	if p, ok := s.replays.(Pinger); ok {
+		checks = append(checks, healthCheck{name: "replay_store", required: true, check: p.Ping})
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	report := HealthReport{
+		Status:       HealthHealthy,
+		Dependencies: make(map[string]DependencyHealth, len(checks)),
+	}
+
+	for _, hc := range checks {
+		wg.Add(1)
+		go func(hc healthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			errc := make(chan error, 1)
+			go func() { errc <- hc.check(checkCtx) }()
+
+			var err error
+			select {
+			case err = <-errc:
+			case <-checkCtx.Done():
+				err = checkCtx.Err()
+			}
+
+			result := DependencyHealth{
+				Status:    HealthUp,
+				Required:  hc.required,
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = HealthDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[hc.name] = result
+			switch {
+			case err == nil:
+			case hc.required:
+				report.Status = HealthFailing
+			case report.Status == HealthHealthy:
+				report.Status = HealthDegraded
+			}
+		}(hc)
+	}
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pingStore is a memory store reporting err, after delay, when pinged
+type pingStore struct {
+	*MemoryStore
+	delay time.Duration
+	err   error
+}
+
+func (p pingStore) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(p.delay):
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestHealth(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	down := errors.New("connection refused")
+	tests := []struct {
+		name string
+		// gateway and store configure the razorpay and database checks
+		gateway *fakeGateway
+		store   pingStore
+		status  string
+		// downs are the dependencies reported down
+		downs []string
+	}{
+		{name: "all up", gateway: &fakeGateway{}, status: HealthHealthy},
+		{name: "razorpay down", gateway: &fakeGateway{pingErr: down}, status: HealthFailing, downs: []string{"razorpay"}},
+		{name: "database down", gateway: &fakeGateway{}, store: pingStore{err: down}, status: HealthFailing, downs: []string{"database"}},
+		{name: "razorpay hanging", gateway: &fakeGateway{pingDelay: time.Minute}, status: HealthFailing, downs: []string{"razorpay"}},
+		{name: "both down", gateway: &fakeGateway{pingErr: down}, store: pingStore{delay: time.Minute}, status: HealthFailing, downs: []string{"razorpay", "database"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.MemoryStore = NewMemoryStore()
+			s, err := New(tt.gateway, tt.store, testConfig(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+
+			began := time.Now()
+			report := s.Health(context.Background(), timeout)
+			// Checks run concurrently, so hanging ones time out together
+			if took := time.Since(began); took > timeout+timeout/2 {
+				t.Fatalf("health took %s, want about the %s timeout", took, timeout)
+			}
+			if report.Status != tt.status || report.Healthy() != (tt.status != HealthFailing) {
+				t.Fatalf("status = %s, want %s", report.Status, tt.status)
+			}
+			for _, name := range []string{"razorpay", "database"} {
+				dep, ok := report.Dependencies[name]
+				if !ok || !dep.Required {
+					t.Fatalf("%s missing or not required: %+v", name, report.Dependencies)
+				}
+				wantDown := contains(tt.downs, name)
+				if (dep.Status == HealthDown) != wantDown || (dep.Error != "") != wantDown {
+					t.Fatalf("%s = %+v, want down %v", name, dep, wantDown)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// recordingChannel passes every delivered notification to events
+type recordingChannel struct {
+	events chan notify.Event
+}
+
+func (c *recordingChannel) Name() string { return "recording" }
+
+func (c *recordingChannel) Deliver(ctx context.Context, ev notify.Event) error {
+	c.events <- ev
+	return nil
+}
+
+func TestLateCaptureOfExpiredOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		late     time.Duration
+		reversed bool
+	}{
+		{"just expired", time.Second, true},
+		{"within grace", 5 * time.Minute, true},
+		{"at the edge", 10 * time.Minute, true},
+		{"beyond grace", 10*time.Minute + time.Second, false},
+		{"long after", 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.WebhookSecret = testWebhookSecret
+			cfg.WebhookReorderDelay = 0
+			cfg.OrderExpiry = 30 * time.Minute
+			cfg.LateCaptureGrace = 10 * time.Minute
+			ch := &recordingChannel{events: make(chan notify.Event, 10)}
+			n := notify.New(notify.Options{}, ch)
+			defer n.Shutdown(context.Background())
+			gw := newFakeGateway()
+			s, clk := newTestService(t, gw, cfg, WithNotifier(n))
+			ctx := context.Background()
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			clk.Advance(31 * time.Minute)
+			if n, err := s.expireOrders(ctx); err != nil || n != 1 {
+				t.Fatalf("expired %d orders, err %v, want the one", n, err)
+			}
+			gw.pay("pay_1", id, 50000, "INR")
+			sub, _ := s.SubscribeEvents(0, []string{EventOrderStatusChanged})
+			defer s.UnsubscribeEvents(sub)
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			clk.Advance(tt.late)
+			body := fmt.Sprintf(`{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","order_id":%q,"amount":50000,"currency":"INR","status":"captured"}}}}`, id)
+			if err := deliver(t, s, body, "evt_1"); err != nil {
+				t.Fatal(err)
+			}
+			drainWebhooks(t, s)
+
+			order, _ := s.store.Get(ctx, id)
+			last := order.Timeline[len(order.Timeline)-1]
+			if !tt.reversed {
+				if order.Status != OrderExpired || order.PaymentID != "" {
+					t.Fatalf("order = %s paid by %q, want it left expired", order.Status, order.PaymentID)
+				}
+				if last.Type != TimelineNote || last.Author != "system" || !strings.Contains(last.Message, "review manually") {
+					t.Fatalf("timeline entry = %+v, want a note for manual review", last)
+				}
+				if !strings.Contains(buf.String(), "ANOMALY: payment pay_1 for order "+id) {
+					t.Fatalf("log = %q, want an anomaly", buf.String())
+				}
+				if len(sub.C) != 0 {
+					t.Fatalf("status change published for an order left expired: %+v", <-sub.C)
+				}
+				return
+			}
+
+			if order.Status != OrderPaid || order.PaymentID != "pay_1" {
+				t.Fatalf("order = %s paid by %q, want paid by pay_1", order.Status, order.PaymentID)
+			}
+			if last.Type != TimelineStatus || last.From != OrderExpired || last.To != OrderPaid || !last.At.Equal(clk.Now()) {
+				t.Fatalf("timeline entry = %+v, want expired -> paid", last)
+			}
+			ev := <-sub.C
+			if data := ev.Data.(map[string]string); data["from"] != OrderExpired || data["to"] != OrderPaid {
+				t.Fatalf("event = %+v, want expired -> paid", ev.Data)
+			}
+			timeout := time.After(time.Second)
+			for {
+				select {
+				case got := <-ch.events:
+					if got.Type != notify.EventExpiryReversed {
+						continue
+					}
+					if got.Subject != id || got.Data["payment_id"] != "pay_1" {
+						t.Fatalf("notification = %+v, want the reversal of %s", got, id)
+					}
+					return
+				case <-timeout:
+					t.Fatal("no expiry-reversed notification")
+				}
+			}
+		})
+	}
+}
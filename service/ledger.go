@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/money"
+)
+
+// Ledger accounts. razorpay_receivable is the balance Razorpay holds for
+// the merchant until it settles to the bank.
+const (
+	AccountRazorpayReceivable = "razorpay_receivable"
+	AccountSales              = "sales"
+	AccountRazorpayFees       = "razorpay_fees"
+	AccountFeeTax             = "fee_tax"
+	AccountRefunds            = "refunds"
+	AccountLinkedAccounts     = "linked_accounts"
+	AccountBank               = "bank"
+)
+
+// ledgerAccounts lists the accounts, in trial balance order
+var ledgerAccounts = []string{
+	AccountRazorpayReceivable,
+	AccountSales,
+	AccountRazorpayFees,
+	AccountFeeTax,
+	AccountRefunds,
+	AccountLinkedAccounts,
+	AccountBank,
+}
+
+// Ledger transaction kinds
+const (
+	LedgerCapture    = "payment_captured"
+	LedgerFee        = "fee"
+	LedgerRefund     = "refund"
+	LedgerTransfer   = "transfer"
+	LedgerReversal   = "transfer_reversal"
+	LedgerSettlement = "settlement"
+	LedgerCorrection = "correction"
+)
+
+// Posting directions
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+// ErrLedgerUnbalanced is returned for a transaction whose postings do not
+// balance or are malformed
+var ErrLedgerUnbalanced = errors.New("ledger transaction does not balance")
+
+// Posting is one side of a money movement on an account
+type Posting struct {
+	Account   string `json:"account"`
+	Direction string `json:"direction"`
+	money.Money
+}
+
+// LedgerTransaction is a set of postings recording one money movement.
+// Posted transactions are never changed: a correction is a new transaction
+// reversing the postings of the one it Corrects.
+type LedgerTransaction struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Reference is the ID of the Razorpay entity the movement comes from,
+	// or of the corrected transaction
+	Reference string    `json:"reference"`
+	PostedAt  time.Time `json:"posted_at"`
+	Postings  []Posting `json:"postings"`
+	Corrects  string    `json:"corrects,omitempty"`
+	Memo      string    `json:"memo,omitempty"`
+	Author    string    `json:"author,omitempty"`
+}
+
+// check enforces the ledger invariants: two postings or more on known
+// accounts, positive amounts, and debits equal to credits in each currency
+func (tx LedgerTransaction) check() error {
+	if len(tx.Postings) < 2 {
+		return fmt.Errorf("%w: %s %s has fewer than two postings", ErrLedgerUnbalanced, tx.Kind, tx.Reference)
+	}
+	sums := map[string]money.Money{}
+	for _, p := range tx.Postings {
+		if !knownAccount(p.Account) || p.Amount <= 0 || p.Currency == "" {
+			return fmt.Errorf("%w: %s %s has a malformed posting: %s of %s to %q", ErrLedgerUnbalanced, tx.Kind, tx.Reference, p.Direction, p.Money, p.Account)
+		}
+		amount := p.Money
+		switch p.Direction {
+		case Debit:
+		case Credit:
+			amount = amount.Neg()
+		default:
+			return fmt.Errorf("%w: %s %s has a posting of direction %q", ErrLedgerUnbalanced, tx.Kind, tx.Reference, p.Direction)
+		}
+		sum, ok := sums[p.Currency]
+		if !ok {
+			sum = money.Money{Currency: p.Currency}
+		}
+		var err error
+		if sums[p.Currency], err = sum.Add(amount); err != nil {
+			return fmt.Errorf("%w: %s %s: %v", ErrLedgerUnbalanced, tx.Kind, tx.Reference, err)
+		}
+	}
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s %s is off by %s", ErrLedgerUnbalanced, tx.Kind, tx.Reference, sum)
+		}
+	}
+	return nil
+}
+
+func knownAccount(account string) bool {
+	for _, a := range ledgerAccounts {
+		if a == account {
+			return true
+		}
+	}
+	return false
+}
+
+// LedgerStore persists ledger transactions. It has no way to change or
+// delete one.
+type LedgerStore interface {
+	// Post records tx under a new ID unless a transaction of the same kind
+	// and reference is posted already, so redelivered events post once. It
+	// returns the transaction held and whether tx was recorded.
+	Post(ctx context.Context, tx LedgerTransaction) (LedgerTransaction, bool, error)
+	// Get returns the transaction or ErrNotFound
+	Get(ctx context.Context, id string) (LedgerTransaction, error)
+	// Transactions returns the transactions posted in [from, to), in
+	// posting order; a zero bound leaves that side open
+	Transactions(ctx context.Context, from, to time.Time) ([]LedgerTransaction, error)
+}
+
+// WithLedgerStore keeps the ledger in store instead of in memory
+func WithLedgerStore(store LedgerStore) Option {
+	return func(s *Service) {
+		s.ledger = store
+	}
+}
+
+// MemoryLedger is a LedgerStore kept in process memory
+type MemoryLedger struct {
+	mu    sync.RWMutex
+	txs   []LedgerTransaction
+	byID  map[string]int
+	byRef map[string]int
+}
+
+// NewMemoryLedger returns an empty in-memory LedgerStore
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{
+		byID:  make(map[string]int),
+		byRef: make(map[string]int),
+	}
+}
+
+func (m *MemoryLedger) Post(ctx context.Context, tx LedgerTransaction) (LedgerTransaction, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := tx.Kind + "\x00" + tx.Reference
+	if i, ok := m.byRef[key]; ok {
+		return m.txs[i].copy(), false, nil
+	}
+	tx = tx.copy()
+	tx.ID = fmt.Sprintf("ltx_%06d", len(m.txs)+1)
+	m.byID[tx.ID] = len(m.txs)
+	m.byRef[key] = len(m.txs)
+	m.txs = append(m.txs, tx)
+	return tx.copy(), true, nil
+}
+
+func (m *MemoryLedger) Get(ctx context.Context, id string) (LedgerTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i, ok := m.byID[id]
+	if !ok {
+		return LedgerTransaction{}, ErrNotFound
+	}
+	return m.txs[i].copy(), nil
+}
+
+func (m *MemoryLedger) Transactions(ctx context.Context, from, to time.Time) ([]LedgerTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var txs []LedgerTransaction
+	for _, tx := range m.txs {
+		if (!from.IsZero() && tx.PostedAt.Before(from)) || (!to.IsZero() && !tx.PostedAt.Before(to)) {
+			continue
+		}
+		txs = append(txs, tx.copy())
+	}
+	return txs, nil
+}
+
+// copy returns tx with postings of its own, so callers cannot alter a
+// posted transaction
+func (tx LedgerTransaction) copy() LedgerTransaction {
+	tx.Postings = append([]Posting(nil), tx.Postings...)
+	return tx
+}
+
+// postLedger checks and records a money movement of kind from the entity
+// reference. Postings of zero, like an untaxed fee's tax, are left out.
+func (s *Service) postLedger(ctx context.Context, kind, reference string, postings ...Posting) error {
+	tx := LedgerTransaction{Kind: kind, Reference: reference, PostedAt: s.clock.Now().UTC()}
+	for _, p := range postings {
+		if !p.IsZero() {
+			tx.Postings = append(tx.Postings, p)
+		}
+	}
+	if err := tx.check(); err != nil {
+		return err
+	}
+	if _, _, err := s.ledger.Post(ctx, tx); err != nil {
+		return fmt.Errorf("post %s %s: %w", kind, reference, err)
+	}
+	return nil
+}
+
+// logLedgerError logs a failed posting of a flow whose money has already
+// moved, where it must not fail the request
+func (s *Service) logLedgerError(err error) {
+	if err != nil {
+		log.Printf("ERROR: ledger posting failed: %v", err)
+	}
+}
+
+// movement returns the postings moving amount from the credited account to
+// the debited one
+func movement(debit, credit string, amount money.Money) []Posting {
+	return []Posting{
+		{Account: debit, Direction: Debit, Money: amount},
+		{Account: credit, Direction: Credit, Money: amount},
+	}
+}
+
+// LedgerCorrectionRequest reverses a posted transaction
+type LedgerCorrectionRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	// Author is filled in from the authenticated principal
+	Author string `json:"-"`
+}
+
+// CorrectLedgerTransaction posts a transaction reversing every posting of
+// the one with id. A transaction is corrected once; a second request
+// returns the first correction.
+func (s *Service) CorrectLedgerTransaction(ctx context.Context, id string, req LedgerCorrectionRequest) (LedgerTransaction, error) {
+	original, err := s.ledger.Get(ctx, id)
+	if err != nil {
+		return LedgerTransaction{}, err
+	}
+	if original.Kind == LedgerCorrection {
+		return LedgerTransaction{}, invalidRequest("%s is a correction; post the movement again instead", id)
+	}
+
+	correction := LedgerTransaction{
+		Kind:      LedgerCorrection,
+		Reference: original.ID,
+		PostedAt:  s.clock.Now().UTC(),
+		Corrects:  original.ID,
+		Memo:      req.Reason,
+		Author:    req.Author,
+	}
+	for _, p := range original.Postings {
+		if p.Direction == Debit {
+			p.Direction = Credit
+		} else {
+			p.Direction = Debit
+		}
+		correction.Postings = append(correction.Postings, p)
+	}
+	if err := correction.check(); err != nil {
+		return LedgerTransaction{}, err
+	}
+	posted, recorded, err := s.ledger.Post(ctx, correction)
+	if err != nil {
+		return LedgerTransaction{}, fmt.Errorf("post correction of %s: %w", id, err)
+	}
+	if !recorded {
+		return posted, nil
+	}
+	log.Printf("Ledger transaction %s corrected by %s as %s: %s", id, req.Author, posted.ID, req.Reason)
+	return posted, nil
+}
+
+// AccountBalance totals an account's postings in one currency. Balance is
+// debits less credits.
+type AccountBalance struct {
+	Account  string `json:"account"`
+	Currency string `json:"currency"`
+	Debits   int64  `json:"debits"`
+	Credits  int64  `json:"credits"`
+	Balance  int64  `json:"balance"`
+}
+
+// LedgerReport lists the transactions of a period touching Account, all of
+// them when it is empty, and the totals of each account they post to
+type LedgerReport struct {
+	Account      string              `json:"account,omitempty"`
+	From         *time.Time          `json:"from,omitempty"`
+	To           *time.Time          `json:"to,omitempty"`
+	Transactions []LedgerTransaction `json:"transactions"`
+	Totals       []AccountBalance    `json:"totals"`
+}
+
+// Ledger reports the transactions posted in [from, to) touching account
+func (s *Service) Ledger(ctx context.Context, account string, from, to time.Time) (LedgerReport, error) {
+	if account != "" && !knownAccount(account) {
+		return LedgerReport{}, invalidRequest("unknown account %q", account)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return LedgerReport{}, invalidRequest("from must be before to")
+	}
+	txs, err := s.ledger.Transactions(ctx, from, to)
+	if err != nil {
+		return LedgerReport{}, fmt.Errorf("read ledger: %w", err)
+	}
+
+	report := LedgerReport{Account: account, Transactions: []LedgerTransaction{}}
+	if !from.IsZero() {
+		from = from.UTC()
+		report.From = &from
+	}
+	if !to.IsZero() {
+		to = to.UTC()
+		report.To = &to
+	}
+	for _, tx := range txs {
+		if account == "" || touches(tx, account) {
+			report.Transactions = append(report.Transactions, tx)
+		}
+	}
+	report.Totals = balances(report.Transactions, account)
+	return report, nil
+}
+
+func touches(tx LedgerTransaction, account string) bool {
+	for _, p := range tx.Postings {
+		if p.Account == account {
+			return true
+		}
+	}
+	return false
+}
+
+// TrialBalance is every account's balance at a point in time. Balanced
+// holds when debits equal credits in every currency, which the ledger
+// invariants guarantee.
+type TrialBalance struct {
+	At       time.Time        `json:"at"`
+	Accounts []AccountBalance `json:"accounts"`
+	// Totals has one entry per currency, under the account "total"
+	Totals   []AccountBalance `json:"totals"`
+	Balanced bool             `json:"balanced"`
+}
+
+// TrialBalance totals the transactions posted before at
+func (s *Service) TrialBalance(ctx context.Context, at time.Time) (TrialBalance, error) {
+	txs, err := s.ledger.Transactions(ctx, time.Time{}, at)
+	if err != nil {
+		return TrialBalance{}, fmt.Errorf("read ledger: %w", err)
+	}
+
+	tb := TrialBalance{At: at.UTC(), Accounts: balances(txs, ""), Totals: []AccountBalance{}, Balanced: true}
+	totals := map[string]*AccountBalance{}
+	for _, b := range tb.Accounts {
+		t, ok := totals[b.Currency]
+		if !ok {
+			t = &AccountBalance{Account: "total", Currency: b.Currency}
+			totals[b.Currency] = t
+		}
+		t.Debits += b.Debits
+		t.Credits += b.Credits
+		t.Balance += b.Balance
+	}
+	for _, t := range totals {
+		if t.Balance != 0 {
+			tb.Balanced = false
+		}
+		tb.Totals = append(tb.Totals, *t)
+	}
+	sort.Slice(tb.Totals, func(i, j int) bool { return tb.Totals[i].Currency < tb.Totals[j].Currency })
+	return tb, nil
+}
+
+// balances totals the postings of txs per account and currency, of only
+// account when it is set, in ledgerAccounts order
+func balances(txs []LedgerTransaction, account string) []AccountBalance {
+	sums := map[[2]string]*AccountBalance{}
+	for _, tx := range txs {
+		for _, p := range tx.Postings {
+			if account != "" && p.Account != account {
+				continue
+			}
+			key := [2]string{p.Account, p.Currency}
+			b, ok := sums[key]
+			if !ok {
+				b = &AccountBalance{Account: p.Account, Currency: p.Currency}
+				sums[key] = b
+			}
+			if p.Direction == Debit {
+				b.Debits += p.Amount
+			} else {
+				b.Credits += p.Amount
+			}
+			b.Balance = b.Debits - b.Credits
+		}
+	}
+
+	result := []AccountBalance{}
+	for _, b := range sums {
+		result = append(result, *b)
+	}
+	rank := map[string]int{}
+	for i, a := range ledgerAccounts {
+		rank[a] = i
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Account != result[j].Account {
+			return rank[result[i].Account] < rank[result[j].Account]
+		}
+		return result[i].Currency < result[j].Currency
+	})
+	return result
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yash170603/golang_payment/money"
+)
+
+// settlementCurrency is the currency Razorpay settles to the bank in when
+// the settlement does not say
+const settlementCurrency = "INR"
+
+// ledgerEntity is the part of a payment, refund, transfer, reversal or
+// settlement the ledger reads. Amounts are Razorpay's own minor units, so
+// postings reconcile with its reports without rounding.
+type ledgerEntity struct {
+	ID     string
+	Amount money.Money
+	// Fee, which includes Tax, is nil on payments Razorpay has not yet
+	// charged a fee for
+	Fee *int
+	Tax *int
+}
+
+// ledgerEntityOf reads a raw Razorpay entity. International payments are
+// taken in the currency Razorpay credits them in, base_currency, along
+// with their fees.
+func ledgerEntityOf(m map[string]interface{}) ledgerEntity {
+	e := ledgerEntity{Fee: optionalInt(m, "fee"), Tax: optionalInt(m, "tax")}
+	e.ID, _ = m["id"].(string)
+	amount, _ := intField(m, "amount")
+	currency, _ := m["currency"].(string)
+	if base, _ := m["base_currency"].(string); base != "" {
+		if baseAmount, ok := intField(m, "base_amount"); ok {
+			amount, currency = baseAmount, base
+		}
+	}
+	e.Amount = money.New(int64(amount), currency)
+	// Settlements name their fee "fees"
+	if e.Fee == nil {
+		e.Fee = optionalInt(m, "fees")
+	}
+	return e
+}
+
+// feePostings returns the postings charging the entity's fee against the
+// receivable, none when there is no fee
+func (e ledgerEntity) feePostings() ([]Posting, error) {
+	if e.Fee == nil || *e.Fee == 0 {
+		return nil, nil
+	}
+	fee, tax := money.New(int64(*e.Fee), e.Amount.Currency), money.New(0, e.Amount.Currency)
+	if e.Tax != nil {
+		tax.Amount = int64(*e.Tax)
+	}
+	if fee.Amount < 0 || tax.Amount < 0 || tax.Amount > fee.Amount {
+		return nil, fmt.Errorf("%w: %s has fee %d with tax %d", ErrLedgerUnbalanced, e.ID, fee.Amount, tax.Amount)
+	}
+	net, err := fee.Sub(tax)
+	if err != nil {
+		return nil, err
+	}
+	return []Posting{
+		{Account: AccountRazorpayFees, Direction: Debit, Money: net},
+		{Account: AccountFeeTax, Direction: Debit, Money: tax},
+		{Account: AccountRazorpayReceivable, Direction: Credit, Money: fee},
+	}, nil
+}
+
+// postCapture records a captured payment as a sale owed by Razorpay, and
+// the fee Razorpay keeps of it once known
+func (s *Service) postCapture(ctx context.Context, payment map[string]interface{}) error {
+	e := ledgerEntityOf(payment)
+	if err := s.postLedger(ctx, LedgerCapture, e.ID, movement(AccountRazorpayReceivable, AccountSales, e.Amount)...); err != nil {
+		return err
+	}
+	fee, err := e.feePostings()
+	if err != nil || fee == nil {
+		return err
+	}
+	return s.postLedger(ctx, LedgerFee, e.ID, fee...)
+}
+
+// postRefund records a processed refund paid out of the receivable
+func (s *Service) postRefund(ctx context.Context, refund map[string]interface{}) error {
+	e := ledgerEntityOf(refund)
+	return s.postLedger(ctx, LedgerRefund, e.ID, movement(AccountRefunds, AccountRazorpayReceivable, e.Amount)...)
+}
+
+// postTransfer records a Route transfer to a linked account
+func (s *Service) postTransfer(ctx context.Context, transfer map[string]interface{}) error {
+	e := ledgerEntityOf(transfer)
+	return s.postLedger(ctx, LedgerTransfer, e.ID, movement(AccountLinkedAccounts, AccountRazorpayReceivable, e.Amount)...)
+}
+
+// postReversal records a transfer reversal, which brings the money back
+// from the linked account
+func (s *Service) postReversal(ctx context.Context, reversal map[string]interface{}) error {
+	e := ledgerEntityOf(reversal)
+	return s.postLedger(ctx, LedgerReversal, e.ID, movement(AccountRazorpayReceivable, AccountLinkedAccounts, e.Amount)...)
+}
+
+// postSettlement records a settlement to the bank. Its amount is what
+// reached the bank; fees and tax of the settlement itself, charged for
+// instant settlements, come out of the receivable on top.
+func (s *Service) postSettlement(ctx context.Context, settlement map[string]interface{}) error {
+	e := ledgerEntityOf(settlement)
+	if e.Amount.Currency == "" {
+		e.Amount.Currency = settlementCurrency
+	}
+	postings := []Posting{{Account: AccountBank, Direction: Debit, Money: e.Amount}}
+	fee, err := e.feePostings()
+	if err != nil {
+		return err
+	}
+	owed := e.Amount
+	for _, p := range fee {
+		if p.Account == AccountRazorpayReceivable {
+			if owed, err = owed.Add(p.Money); err != nil {
+				return err
+			}
+			continue
+		}
+		postings = append(postings, p)
+	}
+	postings = append(postings, Posting{Account: AccountRazorpayReceivable, Direction: Credit, Money: owed})
+	return s.postLedger(ctx, LedgerSettlement, e.ID, postings...)
+}
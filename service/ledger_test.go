@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/money"
+)
+
+func TestLedgerTransactionCheck(t *testing.T) {
+	inr := func(amount int64) money.Money { return money.New(amount, "INR") }
+	tests := []struct {
+		name     string
+		postings []Posting
+		ok       bool
+	}{
+		{"balanced", movement(AccountRazorpayReceivable, AccountSales, inr(50000)), true},
+		{"fee split", []Posting{
+			{Account: AccountRazorpayReceivable, Direction: Debit, Money: inr(48820)},
+			{Account: AccountRazorpayFees, Direction: Debit, Money: inr(1000)},
+			{Account: AccountFeeTax, Direction: Debit, Money: inr(180)},
+			{Account: AccountSales, Direction: Credit, Money: inr(50000)},
+		}, true},
+		{"off by a paisa", []Posting{
+			{Account: AccountRazorpayReceivable, Direction: Debit, Money: inr(49999)},
+			{Account: AccountSales, Direction: Credit, Money: inr(50000)},
+		}, false},
+		{"balanced across currencies only", []Posting{
+			{Account: AccountRazorpayReceivable, Direction: Debit, Money: money.New(100, "USD")},
+			{Account: AccountSales, Direction: Credit, Money: inr(100)},
+		}, false},
+		{"overflowing", []Posting{
+			{Account: AccountRazorpayReceivable, Direction: Debit, Money: inr(math.MaxInt64)},
+			{Account: AccountRazorpayReceivable, Direction: Debit, Money: inr(1)},
+			{Account: AccountSales, Direction: Credit, Money: inr(1)},
+		}, false},
+		{"zero amount", movement(AccountRazorpayReceivable, AccountSales, inr(0)), false},
+		{"no currency", movement(AccountRazorpayReceivable, AccountSales, money.Money{Amount: 100}), false},
+		{"unknown account", movement("suspense", AccountSales, inr(100)), false},
+		{"one posting", movement(AccountRazorpayReceivable, AccountSales, inr(100))[:1], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := LedgerTransaction{Kind: "payment", Reference: "pay_1", Postings: tt.postings}.check()
+			if tt.ok && err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrLedgerUnbalanced) {
+				t.Fatalf("err = %v, want ErrLedgerUnbalanced", err)
+			}
+		})
+	}
+}
+
+func TestPostingJSON(t *testing.T) {
+	// Money is embedded so a posting reads as it did with plain fields
+	p := Posting{Account: AccountSales, Direction: Credit, Money: money.New(1250, "inr")}
+	body, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"account":"sales","direction":"credit","amount":1250,"currency":"INR"}`; string(body) != want {
+		t.Fatalf("posting = %s, want %s", body, want)
+	}
+}
+
+// ledgerService is a service accepting webhooks straight away, so their
+// postings are made by the time drainWebhooks returns
+func ledgerService(t *testing.T) *Service {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookReorderDelay = 0
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	return s
+}
+
+func TestLedgerPostedFromWebhooks(t *testing.T) {
+	s := ledgerService(t)
+	ctx := context.Background()
+	deliveries := []struct {
+		id   string
+		body string
+	}{
+		{"evt_1", `{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","amount":50000,"currency":"INR","fee":1180,"tax":180}}}}`},
+		// Redelivered under another event ID, posted once all the same
+		{"evt_2", `{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","amount":50000,"currency":"INR","fee":1180,"tax":180}}}}`},
+		{"evt_3", `{"event":"refund.processed","payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","amount":10000,"currency":"INR"}}}}`},
+		{"evt_4", `{"event":"transfer.processed","payload":{"transfer":{"entity":{"id":"trf_1","amount":5000,"currency":"INR"}}}}`},
+		{"evt_5", `{"event":"settlement.processed","payload":{"settlement":{"entity":{"id":"setl_1","amount":30000,"fees":236,"tax":36}}}}`},
+	}
+	for _, d := range deliveries {
+		if err := deliver(t, s, d.body, d.id); err != nil {
+			t.Fatalf("%s: %v", d.id, err)
+		}
+	}
+	drainWebhooks(t, s)
+
+	txs, err := s.ledger.Transactions(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, tx := range txs {
+		kinds = append(kinds, tx.Kind+" "+tx.Reference)
+	}
+	want := []string{"payment_captured pay_1", "fee pay_1", "refund rfnd_1", "transfer trf_1", "settlement setl_1"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("transactions = %v, want %v", kinds, want)
+	}
+
+	tb, err := s.TrialBalance(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, b := range tb.Accounts {
+		got[b.Account] = b.Balance
+	}
+	wantBalances := map[string]int64{
+		AccountRazorpayReceivable: 50000 - 1180 - 10000 - 5000 - 30000 - 236,
+		AccountSales:              -50000,
+		AccountRazorpayFees:       1000 + 200,
+		AccountFeeTax:             180 + 36,
+		AccountRefunds:            10000,
+		AccountLinkedAccounts:     5000,
+		AccountBank:               30000,
+	}
+	if !tb.Balanced || !reflect.DeepEqual(got, wantBalances) {
+		t.Fatalf("trial balance = %v balanced %v, want %v balanced", got, tb.Balanced, wantBalances)
+	}
+}
+
+func TestLedgerFeeRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		fee  map[string]interface{}
+	}{
+		{"tax above the fee", map[string]interface{}{"fee": float64(100), "tax": float64(180)}},
+		{"negative fee", map[string]interface{}{"fee": float64(-100)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ledgerEntityOf(map[string]interface{}{"id": "pay_1", "amount": float64(50000), "currency": "INR", "fee": tt.fee["fee"], "tax": tt.fee["tax"]})
+			if _, err := e.feePostings(); !errors.Is(err, ErrLedgerUnbalanced) {
+				t.Fatalf("err = %v, want ErrLedgerUnbalanced", err)
+			}
+		})
+	}
+	if fee, err := ledgerEntityOf(map[string]interface{}{"id": "pay_1", "amount": float64(50000), "currency": "INR", "fee": nil}).feePostings(); err != nil || fee != nil {
+		t.Fatalf("unsettled fee = %v, %v, want no postings", fee, err)
+	}
+}
+
+func TestLedgerTransactionsImmutable(t *testing.T) {
+	s := ledgerService(t)
+	ctx := context.Background()
+	if err := s.postLedger(ctx, LedgerTransfer, "trf_1", movement(AccountLinkedAccounts, AccountRazorpayReceivable, money.New(5000, "INR"))...); err != nil {
+		t.Fatal(err)
+	}
+	txs, _ := s.ledger.Transactions(ctx, time.Time{}, time.Time{})
+	txs[0].Postings[0].Amount = 1
+
+	tx, err := s.ledger.Get(ctx, txs[0].ID)
+	if err != nil || tx.Postings[0].Amount != 5000 {
+		t.Fatalf("posted transaction = %+v, %v, want it unchanged", tx, err)
+	}
+	if _, recorded, err := s.ledger.Post(ctx, LedgerTransaction{Kind: LedgerTransfer, Reference: "trf_1", Postings: movement(AccountLinkedAccounts, AccountRazorpayReceivable, money.New(1, "INR"))}); err != nil || recorded {
+		t.Fatalf("reposting: recorded %v, %v, want the first posting kept", recorded, err)
+	}
+}
+
+func TestCorrectLedgerTransaction(t *testing.T) {
+	s := ledgerService(t)
+	ctx := context.Background()
+	if err := s.postLedger(ctx, LedgerTransfer, "trf_1", movement(AccountLinkedAccounts, AccountRazorpayReceivable, money.New(5000, "INR"))...); err != nil {
+		t.Fatal(err)
+	}
+	txs, _ := s.ledger.Transactions(ctx, time.Time{}, time.Time{})
+	id := txs[0].ID
+
+	req := LedgerCorrectionRequest{Reason: "transfer sent twice", Author: "finance"}
+	correction, err := s.CorrectLedgerTransaction(ctx, id, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correction.Kind != LedgerCorrection || correction.Corrects != id || correction.Postings[0].Direction != Credit || correction.Postings[1].Direction != Debit {
+		t.Fatalf("correction = %+v, want %s reversed", correction, id)
+	}
+	again, err := s.CorrectLedgerTransaction(ctx, id, req)
+	if err != nil || again.ID != correction.ID {
+		t.Fatalf("second correction = %+v, %v, want the first returned", again, err)
+	}
+	var invalid *ValidationError
+	if _, err := s.CorrectLedgerTransaction(ctx, correction.ID, req); !errors.As(err, &invalid) {
+		t.Fatalf("correcting a correction: err = %v, want a validation error", err)
+	}
+	if _, err := s.CorrectLedgerTransaction(ctx, "ltx_missing", req); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown transaction: err = %v, want ErrNotFound", err)
+	}
+
+	tb, _ := s.TrialBalance(ctx, time.Now())
+	for _, b := range tb.Accounts {
+		if b.Balance != 0 {
+			t.Fatalf("%s balance = %d after the correction, want 0", b.Account, b.Balance)
+		}
+	}
+}
+
+func TestLedgerReport(t *testing.T) {
+	s := ledgerService(t)
+	ctx := context.Background()
+	s.postLedger(ctx, LedgerCapture, "pay_1", movement(AccountRazorpayReceivable, AccountSales, money.New(50000, "INR"))...)
+	s.postLedger(ctx, LedgerTransfer, "trf_1", movement(AccountLinkedAccounts, AccountRazorpayReceivable, money.New(5000, "INR"))...)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		account  string
+		from, to time.Time
+		txs      int
+		totals   []AccountBalance
+		invalid  bool
+	}{
+		{name: "all", txs: 2},
+		{name: "receivable", account: AccountRazorpayReceivable, txs: 2, totals: []AccountBalance{
+			{Account: AccountRazorpayReceivable, Currency: "INR", Debits: 50000, Credits: 5000, Balance: 45000},
+		}},
+		{name: "linked accounts", account: AccountLinkedAccounts, txs: 1, totals: []AccountBalance{
+			{Account: AccountLinkedAccounts, Currency: "INR", Debits: 5000, Balance: 5000},
+		}},
+		{name: "before the postings", to: s.clock.Now().Add(-time.Hour), txs: 0, totals: []AccountBalance{}},
+		{name: "unknown account", account: "suspense", invalid: true},
+		{name: "empty range", from: now, to: now, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := s.Ledger(ctx, tt.account, tt.from, tt.to)
+			if tt.invalid {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Transactions) != tt.txs {
+				t.Fatalf("%d transactions, want %d", len(report.Transactions), tt.txs)
+			}
+			if tt.totals != nil && !reflect.DeepEqual(report.Totals, tt.totals) {
+				t.Fatalf("totals = %+v, want %+v", report.Totals, tt.totals)
+			}
+		})
+	}
+}
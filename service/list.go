@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// ListRequest selects the Razorpay records a list walk returns
+type ListRequest struct {
+	// Entity is one of the gateway.Entity* collections
+	Entity string
+	// From and To bound created_at in Unix seconds; zero leaves them open
+	From int64
+	To   int64
+	// Limit caps the walk below ListMaxItems; zero means ListMaxItems
+	Limit int
+}
+
+// ListUpstream walks a Razorpay collection, newest first, calling fn for
+// each record as its page arrives. gateway.ErrListTruncated reports that
+// the item cap was hit before the collection ended.
+func (s *Service) ListUpstream(ctx context.Context, req ListRequest, fn func(item map[string]interface{}) error) error {
+	if req.Limit < 0 || (req.From != 0 && req.To != 0 && req.From > req.To) {
+		return invalidRequest("limit must be positive and from must not be after to")
+	}
+
+	params := map[string]interface{}{}
+	if req.From != 0 {
+		params["from"] = req.From
+	}
+	if req.To != 0 {
+		params["to"] = req.To
+	}
+
+	limit := s.cfg.ListMaxItems
+	if req.Limit > 0 && req.Limit < limit {
+		limit = req.Limit
+	}
+
+	err := s.gateway.ListAll(ctx, req.Entity, params, gateway.ListOptions{
+		PageDelay: s.cfg.ListPageDelay,
+		MaxItems:  limit,
+	}, fn)
+	if errors.Is(err, gateway.ErrUnknownEntity) {
+		return invalidRequest("%v", err)
+	}
+	return err
+}
+
+// Paging bounds of ListRazorpayOrders, Razorpay's own
+const (
+	defaultOrderPageSize = 10
+	maxOrderPageSize     = 100
+)
+
+// OrderPageRequest selects one page of Razorpay orders
+type OrderPageRequest struct {
+	// From and To bound created_at in Unix seconds; zero leaves them open
+	From int64
+	To   int64
+	// Count is capped at 100 and defaults to 10
+	Count int
+	Skip  int
+}
+
+// OrderPage is a page of raw Razorpay orders with what is needed to ask
+// for the next
+type OrderPage struct {
+	Items      []interface{}   `json:"items"`
+	Pagination OrderPagination `json:"pagination"`
+}
+
+// OrderPagination describes an OrderPage. HasMore is set when the page
+// came back full, so NextSkip may return more orders.
+type OrderPagination struct {
+	From     int64 `json:"from,omitempty"`
+	To       int64 `json:"to,omitempty"`
+	Count    int   `json:"count"`
+	Skip     int   `json:"skip"`
+	Returned int   `json:"returned"`
+	HasMore  bool  `json:"has_more"`
+	NextSkip int   `json:"next_skip,omitempty"`
+}
+
+// ListRazorpayOrders fetches one page of orders straight from Razorpay,
+// bypassing the local store
+func (s *Service) ListRazorpayOrders(ctx context.Context, req OrderPageRequest) (OrderPage, error) {
+	switch {
+	case req.From < 0 || req.To < 0:
+		return OrderPage{}, invalidRequest("from and to must not be negative")
+	case req.From != 0 && req.To != 0 && req.From > req.To:
+		return OrderPage{}, invalidRequest("from must not be after to")
+	case req.Count < 0:
+		return OrderPage{}, invalidRequest("count must be positive")
+	case req.Skip < 0:
+		return OrderPage{}, invalidRequest("skip must not be negative")
+	}
+	if req.Count == 0 {
+		req.Count = defaultOrderPageSize
+	}
+	if req.Count > maxOrderPageSize {
+		req.Count = maxOrderPageSize
+	}
+
+	params := map[string]interface{}{"count": req.Count, "skip": req.Skip}
+	if req.From != 0 {
+		params["from"] = req.From
+	}
+	if req.To != 0 {
+		params["to"] = req.To
+	}
+	collection, err := s.gateway.ListOrders(ctx, params)
+	if err != nil {
+		return OrderPage{}, fmt.Errorf("list orders: %w", err)
+	}
+
+	items, _ := collection["items"].([]interface{})
+	if items == nil {
+		items = []interface{}{}
+	}
+	page := OrderPage{
+		Items: items,
+		Pagination: OrderPagination{
+			From:     req.From,
+			To:       req.To,
+			Count:    req.Count,
+			Skip:     req.Skip,
+			Returned: len(items),
+			HasMore:  len(items) == req.Count,
+		},
+	}
+	if page.Pagination.HasMore {
+		page.Pagination.NextSkip = req.Skip + len(items)
+	}
+	return page, nil
+}
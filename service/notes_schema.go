@@ -0,0 +1,141 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/yash170603/golang_payment/config"
+)
+
+// NoteField constrains the value of a single notes key
+type NoteField struct {
+	Pattern string   `json:"pattern,omitempty"`
+	Enum    []string `json:"enum,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// NotesSchema describes the notes every order must carry
+type NotesSchema struct {
+	Required []string             `json:"required"`
+	Fields   map[string]NoteField `json:"fields"`
+}
+
+// notesSchemaHolder serves the current schema and swaps it on reload
+type notesSchemaHolder struct {
+	path    string
+	mode    string
+	current atomic.Pointer[NotesSchema]
+}
+
+// loadNotesSchema reads and compiles the schema at path. An empty path
+// yields an empty schema that accepts any notes.
+func loadNotesSchema(path string) (*NotesSchema, error) {
+	schema := &NotesSchema{Fields: map[string]NoteField{}}
+	if path == "" {
+		return schema, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if schema.Fields == nil {
+		schema.Fields = map[string]NoteField{}
+	}
+	for key, field := range schema.Fields {
+		if field.Pattern != "" {
+			re, err := regexp.Compile(field.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("notes field %q: %w", key, err)
+			}
+			field.re = re
+			schema.Fields[key] = field
+		}
+	}
+	return schema, nil
+}
+
+func newNotesSchemaHolder(path, mode string) (*notesSchemaHolder, error) {
+	schema, err := loadNotesSchema(path)
+	if err != nil {
+		return nil, err
+	}
+	h := &notesSchemaHolder{path: path, mode: mode}
+	h.current.Store(schema)
+	return h, nil
+}
+
+// reload swaps in a freshly loaded schema, keeping the previous one when
+// the file fails to load
+func (h *notesSchemaHolder) reload() error {
+	if h.path == "" {
+		return nil
+	}
+	schema, err := loadNotesSchema(h.path)
+	if err != nil {
+		return err
+	}
+	h.current.Store(schema)
+	return nil
+}
+
+func (h *notesSchemaHolder) schema() *NotesSchema {
+	return h.current.Load()
+}
+
+// validate returns the field-level violations of notes against the schema
+func (schema *NotesSchema) validate(notes map[string]string) map[string]string {
+	violations := map[string]string{}
+
+	for _, key := range schema.Required {
+		if notes[key] == "" {
+			violations[key] = "is required"
+		}
+	}
+	for key, field := range schema.Fields {
+		value, ok := notes[key]
+		if !ok || value == "" {
+			continue
+		}
+		if field.re != nil && !field.re.MatchString(value) {
+			violations[key] = fmt.Sprintf("must match %s", field.Pattern)
+			continue
+		}
+		if len(field.Enum) > 0 && !contains(field.Enum, value) {
+			violations[key] = fmt.Sprintf("must be one of %v", field.Enum)
+		}
+	}
+
+	return violations
+}
+
+// checkNotes applies the schema in the configured mode, returning the
+// violations only when they should reject the request
+func (h *notesSchemaHolder) checkNotes(notes map[string]string) map[string]string {
+	violations := h.schema().validate(notes)
+	if len(violations) == 0 {
+		return nil
+	}
+	if h.mode == config.NotesModePermissive {
+		log.Printf("Order notes violate schema (permissive mode): %v", violations)
+		return nil
+	}
+	return violations
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yash170603/golang_payment/config"
+)
+
+const testNotesSchema = `{
+	"required": ["cost_center", "store_id"],
+	"fields": {
+		"store_id": {"pattern": "^ST[0-9]{3}$"},
+		"channel": {"enum": ["web", "pos"]}
+	}
+}`
+
+// writeNotesSchema writes schema to a temporary file, returning its path
+func writeNotesSchema(t *testing.T, schema string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notes.json")
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNotesSchemaValidate(t *testing.T) {
+	schema, err := loadNotesSchema(writeNotesSchema(t, testNotesSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		notes map[string]string
+		// want are the keys in violation
+		want []string
+	}{
+		{name: "complete", notes: map[string]string{"cost_center": "cc1", "store_id": "ST001", "channel": "pos"}},
+		{name: "optional key absent", notes: map[string]string{"cost_center": "cc1", "store_id": "ST001"}},
+		{name: "required missing", notes: map[string]string{"store_id": "ST001"}, want: []string{"cost_center"}},
+		{name: "required empty", notes: map[string]string{"cost_center": "", "store_id": "ST001"}, want: []string{"cost_center"}},
+		{name: "pattern", notes: map[string]string{"cost_center": "cc1", "store_id": "store-1"}, want: []string{"store_id"}},
+		{name: "enum", notes: map[string]string{"cost_center": "cc1", "store_id": "ST001", "channel": "phone"}, want: []string{"channel"}},
+		{name: "nothing", notes: nil, want: []string{"cost_center", "store_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schema.validate(tt.notes)
+			if len(got) != len(tt.want) {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+			for _, key := range tt.want {
+				if got[key] == "" {
+					t.Fatalf("violations = %v, want one for %s", got, key)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadNotesSchemaRefusesBadSchema(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":    `{"required":`,
+		"bad pattern": `{"fields": {"store_id": {"pattern": "("}}}`,
+	}
+	for name, schema := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadNotesSchema(writeNotesSchema(t, schema)); err == nil {
+				t.Fatal("schema loaded")
+			}
+		})
+	}
+}
+
+func TestCreateOrderEnforcesNotesSchema(t *testing.T) {
+	tests := []struct {
+		mode  string
+		notes map[string]string
+		// rejected is whether the order is refused before Razorpay
+		rejected bool
+	}{
+		{config.NotesModeEnforce, map[string]string{"cost_center": "cc1", "store_id": "ST001"}, false},
+		{config.NotesModeEnforce, map[string]string{"store_id": "nope"}, true},
+		{config.NotesModePermissive, map[string]string{"store_id": "nope"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.NotesSchemaFile = writeNotesSchema(t, testNotesSchema)
+			cfg.NotesSchemaMode = tt.mode
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, cfg)
+
+			_, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 500, Notes: tt.notes})
+			var invalid *ValidationError
+			if rejected := errors.As(err, &invalid); rejected != tt.rejected {
+				t.Fatalf("err = %v, want rejected %v", err, tt.rejected)
+			}
+			if tt.rejected && (invalid.Fields["cost_center"] == "" || invalid.Fields["store_id"] == "") {
+				t.Fatalf("fields = %v, want cost_center and store_id", invalid.Fields)
+			}
+			if (gw.created == 0) != tt.rejected {
+				t.Fatalf("%d orders created upstream", gw.created)
+			}
+		})
+	}
+}
+
+func TestReloadNotesSchema(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.NotesSchemaFile = writeNotesSchema(t, `{"required": ["cost_center"]}`)
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	notes := map[string]string{"store_id": "ST001"}
+	if err := s.checkNotes(notes); err == nil {
+		t.Fatal("notes missing cost_center accepted")
+	}
+
+	// A broken file keeps the schema loaded before it
+	os.WriteFile(cfg.NotesSchemaFile, []byte(`{`), 0o600)
+	if err := s.ReloadNotesSchema(); err == nil {
+		t.Fatal("broken schema reloaded")
+	}
+	if err := s.checkNotes(notes); err == nil {
+		t.Fatal("schema dropped by a failed reload")
+	}
+
+	os.WriteFile(cfg.NotesSchemaFile, []byte(`{"required": ["store_id"]}`), 0o600)
+	if err := s.ReloadNotesSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkNotes(notes); err != nil {
+		t.Fatalf("notes refused by the reloaded schema: %v", err)
+	}
+	if got := s.PublicConfig(context.Background()).NotesSchema.Required; len(got) != 1 || got[0] != "store_id" {
+		t.Fatalf("exported schema requires %v, want store_id", got)
+	}
+}
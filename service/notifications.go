@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// ErrSMSDisabled is returned when no SMS provider is configured
+var ErrSMSDisabled = errors.New("SMS is not configured")
+
+// WithNotifier publishes payment, refund and dispute events to n
+func WithNotifier(n *notify.Notifier) Option {
+	return func(s *Service) {
+		s.notifier = n
+	}
+}
+
+// WithSMS reconciles delivery reports and manages opt-outs for sms, which
+// must also be one of the notifier's channels
+func WithSMS(sms *notify.SMS) Option {
+	return func(s *Service) {
+		s.sms = sms
+	}
+}
+
+// NotificationChannels reports the health of each notification channel
+func (s *Service) NotificationChannels() []notify.ChannelHealth {
+	return s.notifier.Health()
+}
+
+// HandleSMSStatus applies a delivery report posted by the SMS provider and
+// returns how many of its messages were known
+func (s *Service) HandleSMSStatus(r *http.Request) (int, error) {
+	if s.sms == nil {
+		return 0, ErrSMSDisabled
+	}
+	n, err := s.sms.HandleStatus(r)
+	switch {
+	case errors.Is(err, notify.ErrSMSStatusAuth):
+		return 0, ErrWebhookSignature
+	case err != nil:
+		return 0, invalidRequest("%v", err)
+	}
+	return n, nil
+}
+
+// SMSMessages returns the recent texts, newest first
+func (s *Service) SMSMessages() ([]notify.SMSRecord, error) {
+	if s.sms == nil {
+		return nil, ErrSMSDisabled
+	}
+	return s.sms.Messages(), nil
+}
+
+// SMSSuppressions lists the numbers that opted out of texts
+func (s *Service) SMSSuppressions() ([]string, error) {
+	if s.sms == nil {
+		return nil, ErrSMSDisabled
+	}
+	return s.sms.Suppressed(), nil
+}
+
+// SuppressSMS opts contact out of texts, or back in when suppress is false
+func (s *Service) SuppressSMS(contact string, suppress bool) error {
+	if s.sms == nil {
+		return ErrSMSDisabled
+	}
+	var err error
+	if suppress {
+		err = s.sms.Suppress(contact)
+	} else {
+		err = s.sms.Unsuppress(contact)
+	}
+	if errors.Is(err, notify.ErrSMSContact) {
+		return invalidRequest("%v", err)
+	}
+	return err
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrTransitionForbidden is returned for status changes the order state
+// machine does not allow
+var ErrTransitionForbidden = errors.New("status transition not allowed")
+
+// ErrOrderNotPaid is returned when renotifying an order that is not paid
+var ErrOrderNotPaid = errors.New("order is not paid")
+
+// orderTransitions is the order state machine: status -> allowed next statuses
+var orderTransitions = map[string][]string{
+	OrderCreated:   {OrderPaid, OrderFailed, OrderExpired, OrderAbandoned},
+	OrderFailed:    {OrderPaid, OrderExpired, OrderAbandoned},
+	OrderAbandoned: {OrderPaid, OrderExpired},
+	OrderExpired:   {OrderPaid},
+	OrderPaid:      {OrderRefunded},
+	OrderRefunded:  {},
+}
+
+// canTransition reports whether the state machine allows from -> to
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition moves the order to status, recording it on the timeline
+func (o *Order) transition(status string, at time.Time) error {
+	if !canTransition(o.Status, status) {
+		return fmt.Errorf("%w: %s -> %s", ErrTransitionForbidden, o.Status, status)
+	}
+	o.Timeline = append(o.Timeline, TimelineEntry{At: at, Type: TimelineStatus, From: o.Status, To: status})
+	o.Status = status
+	o.UpdatedAt = at
+	return nil
+}
+
+// enteredAt returns when the order last moved to its current status
+func (o *Order) enteredAt() time.Time {
+	for i := len(o.Timeline) - 1; i >= 0; i-- {
+		if e := o.Timeline[i]; e.To == o.Status {
+			return e.At
+		}
+	}
+	return o.UpdatedAt
+}
+
+// OperatorNoteRequest is a free-text note support attaches to an order
+type OperatorNoteRequest struct {
+	Note   string `json:"note" binding:"required,max=2000"`
+	Author string `json:"author" binding:"required"`
+}
+
+// StatusOverrideRequest asks to set an order's status by hand
+type StatusOverrideRequest struct {
+	Status    string `json:"status" binding:"required"`
+	Reason    string `json:"reason" binding:"required"`
+	Reference string `json:"reference"`
+	// Force allows transitions the state machine forbids
+	Force bool `json:"force"`
+	// Author is filled in from the authenticated principal
+	Author string `json:"-"`
+}
+
+// LocalOrder returns the local record of an order, including its timeline.
+// Archived orders are read back from the archive, which is slower, and
+// flagged Archived.
+func (s *Service) LocalOrder(ctx context.Context, id string) (Order, error) {
+	order, err := s.store.Get(ctx, id)
+	if err != nil || order.Archive == nil {
+		return order, err
+	}
+	return s.rehydrateOrder(ctx, order)
+}
+
+// AddOperatorNote appends a note to the order timeline
+func (s *Service) AddOperatorNote(ctx context.Context, orderID string, req OperatorNoteRequest) (Order, error) {
+	return s.store.Update(ctx, orderID, func(order *Order) error {
+		now := s.clock.Now()
+		order.Timeline = append(order.Timeline, TimelineEntry{
+			At:      now,
+			Type:    TimelineNote,
+			Author:  req.Author,
+			Message: req.Note,
+		})
+		order.UpdatedAt = now
+		return nil
+	})
+}
+
+// OverrideStatus sets the order status by hand. Transitions the state
+// machine forbids are refused unless req.Force is set.
+func (s *Service) OverrideStatus(ctx context.Context, orderID string, req StatusOverrideRequest) (Order, error) {
+	if _, known := orderTransitions[req.Status]; !known {
+		return Order{}, invalidRequest("unknown status %q", req.Status)
+	}
+
+	var from string
+	order, err := s.store.Update(ctx, orderID, func(order *Order) error {
+		from = order.Status
+		allowed := canTransition(order.Status, req.Status)
+		if !allowed && !req.Force {
+			return fmt.Errorf("%w: %s -> %s, set force to override", ErrTransitionForbidden, order.Status, req.Status)
+		}
+
+		switch req.Status {
+		case OrderPaid:
+			if err := s.captureCredit(ctx, order); err != nil {
+				return err
+			}
+		case OrderFailed, OrderExpired:
+			if err := s.releaseCredit(ctx, order, "status overridden to "+req.Status); err != nil {
+				return err
+			}
+		}
+
+		now := s.clock.Now()
+		order.Timeline = append(order.Timeline, TimelineEntry{
+			At:        now,
+			Type:      TimelineOverride,
+			Author:    req.Author,
+			Message:   req.Reason,
+			From:      order.Status,
+			To:        req.Status,
+			Reference: req.Reference,
+		})
+		order.Override = &StatusOverride{
+			Status:    req.Status,
+			Reason:    req.Reason,
+			Reference: req.Reference,
+			Author:    req.Author,
+			Forced:    !allowed,
+			At:        now,
+		}
+		order.Status = req.Status
+		order.UpdatedAt = now
+		s.applyTagRules(order, tagFacts{On: req.Status, Amount: order.Amount, Notes: order.Notes})
+		return nil
+	})
+	if err != nil {
+		return Order{}, err
+	}
+
+	if order.Override.Forced {
+		log.Printf("WARNING: FORCED status override of order %s from %s to %s by %s (reason: %q, reference: %q)",
+			orderID, from, req.Status, req.Author, req.Reason, req.Reference)
+	} else {
+		log.Printf("Status override of order %s from %s to %s by %s", orderID, from, req.Status, req.Author)
+	}
+	s.publishEvent(EventOrderStatusChanged, map[string]string{
+		"order_id": orderID,
+		"from":     from,
+		"to":       req.Status,
+		"override": req.Author,
+	})
+	if req.Status == OrderPaid {
+		s.queueFulfillment(order)
+	}
+	return order, nil
+}
+
+// Renotification is the outcome of re-sending a paid order's verification
+// notification: Channels maps each channel to notify.Queued or
+// notify.Dropped
+type Renotification struct {
+	OrderID   string            `json:"order_id"`
+	PaymentID string            `json:"payment_id"`
+	Channels  map[string]string `json:"channels"`
+}
+
+// Renotify publishes the payment.verified event of a paid order again,
+// without verifying anything, for when a downstream system missed it. The
+// re-send is recorded on the order timeline under author.
+func (s *Service) Renotify(ctx context.Context, orderID, author string) (Renotification, error) {
+	order, err := s.store.Get(ctx, orderID)
+	if err != nil {
+		return Renotification{}, err
+	}
+	if order.Status != OrderPaid {
+		return Renotification{}, fmt.Errorf("%w: order %s is %s", ErrOrderNotPaid, orderID, order.Status)
+	}
+	if order.PaymentID == "" {
+		return Renotification{}, fmt.Errorf("%w: order %s has no payment recorded", ErrOrderNotPaid, orderID)
+	}
+
+	ev := s.paymentVerifiedEvent(ctx, orderID, order.PaymentID, order.Brand)
+	ev.Data["renotified_by"] = author
+	result := Renotification{
+		OrderID:   orderID,
+		PaymentID: order.PaymentID,
+		Channels:  s.notifier.Enqueue(ev),
+	}
+
+	channels := make([]string, 0, len(result.Channels))
+	for name, outcome := range result.Channels {
+		channels = append(channels, name+": "+outcome)
+	}
+	sort.Strings(channels)
+	_, err = s.store.Update(ctx, orderID, func(order *Order) error {
+		now := s.clock.Now()
+		order.Timeline = append(order.Timeline, TimelineEntry{
+			At:        now,
+			Type:      TimelineRenotify,
+			Author:    author,
+			Message:   "Re-sent payment.verified (" + strings.Join(channels, ", ") + ")",
+			Reference: order.PaymentID,
+		})
+		order.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		log.Printf("Renotified order %s but failed to record it on the timeline: %v", orderID, err)
+	}
+	log.Printf("Renotified payment %s of order %s by %s", order.PaymentID, orderID, author)
+	return result, nil
+}
+
+// withOverride returns a copy of a provider order flagged with the manual
+// override, if any, so every order-detail view shows it
+func (s *Service) withOverride(ctx context.Context, order map[string]interface{}) map[string]interface{} {
+	id, _ := order["id"].(string)
+	local, err := s.store.Get(ctx, id)
+	if err != nil || local.Override == nil {
+		return order
+	}
+	flagged := make(map[string]interface{}, len(order)+1)
+	for k, v := range order {
+		flagged[k] = v
+	}
+	flagged["manual_override"] = local.Override
+	return flagged
+}
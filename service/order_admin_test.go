@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+)
+
+func TestOverrideStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       string
+		req        StatusOverrideRequest
+		wantErr    error
+		wantForced bool
+	}{
+		{"allowed", OrderCreated, StatusOverrideRequest{Status: OrderFailed}, nil, false},
+		{"another allowed", OrderCreated, StatusOverrideRequest{Status: OrderPaid}, nil, false},
+		{"forbidden", OrderPaid, StatusOverrideRequest{Status: OrderCreated}, ErrTransitionForbidden, false},
+		{"forbidden but forced", OrderPaid, StatusOverrideRequest{Status: OrderCreated, Force: true}, nil, true},
+		{"refunded is final", OrderRefunded, StatusOverrideRequest{Status: OrderPaid}, ErrTransitionForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+			ctx := context.Background()
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			if _, err := s.store.Update(ctx, id, func(o *Order) error {
+				o.Status = tt.from
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.req.Reason, tt.req.Reference, tt.req.Author = "bank confirmed", "TICKET-7", "ops@example.com"
+			order, err := s.OverrideStatus(ctx, id, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if local, _ := s.store.Get(ctx, id); local.Status != tt.from || local.Override != nil {
+					t.Fatalf("refused override changed the order: status %s, override %+v", local.Status, local.Override)
+				}
+				return
+			}
+			if order.Status != tt.req.Status {
+				t.Fatalf("status = %s, want %s", order.Status, tt.req.Status)
+			}
+			o := order.Override
+			if o == nil || o.Forced != tt.wantForced || o.Author != tt.req.Author || o.Reason != tt.req.Reason || o.Reference != tt.req.Reference {
+				t.Fatalf("override = %+v, want forced %v by %s", o, tt.wantForced, tt.req.Author)
+			}
+			last := order.Timeline[len(order.Timeline)-1]
+			if last.Type != TimelineOverride || last.From != tt.from || last.To != tt.req.Status || last.Author != tt.req.Author || last.Reference != tt.req.Reference {
+				t.Fatalf("timeline entry = %+v, want an override %s -> %s", last, tt.from, tt.req.Status)
+			}
+		})
+	}
+}
+
+func TestOverrideStatusRefusesUnknownStatus(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	_, err := s.OverrideStatus(context.Background(), id, StatusOverrideRequest{Status: "settled", Reason: "x", Force: true})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+}
+
+func TestForcedOverrideWarnsAndPublishes(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	if _, err := s.OverrideStatus(ctx, id, StatusOverrideRequest{Status: OrderPaid, Reason: "paid offline", Author: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := s.SubscribeEvents(0, []string{EventOrderStatusChanged})
+	defer s.UnsubscribeEvents(sub)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	if _, err := s.OverrideStatus(ctx, id, StatusOverrideRequest{Status: OrderFailed, Reason: "chargeback", Author: "ops", Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "WARNING: FORCED status override of order "+id) {
+		t.Fatalf("log = %q, want a forced-override warning", buf.String())
+	}
+
+	ev := <-sub.C
+	data := ev.Data.(map[string]string)
+	if data["order_id"] != id || data["from"] != OrderPaid || data["to"] != OrderFailed || data["override"] != "ops" {
+		t.Fatalf("event = %+v, want %s paid -> failed by ops", ev.Data, id)
+	}
+}
+
+func TestAddOperatorNote(t *testing.T) {
+	s, clk := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	before, _ := s.store.Get(ctx, id)
+
+	order, err := s.AddOperatorNote(ctx, id, OperatorNoteRequest{Note: "customer called", Author: "ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != before.Status {
+		t.Fatalf("status = %s, a note must not change it from %s", order.Status, before.Status)
+	}
+	if len(order.Timeline) != len(before.Timeline)+1 {
+		t.Fatalf("timeline has %d entries, want %d", len(order.Timeline), len(before.Timeline)+1)
+	}
+	last := order.Timeline[len(order.Timeline)-1]
+	if last.Type != TimelineNote || last.Message != "customer called" || last.Author != "ops@example.com" || !last.At.Equal(clk.Now()) {
+		t.Fatalf("timeline entry = %+v, want the note", last)
+	}
+
+	if _, err := s.AddOperatorNote(ctx, "order_missing", OperatorNoteRequest{Note: "x", Author: "ops"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("note on a missing order: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOverriddenOrderShownAndLeftAlone(t *testing.T) {
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	ctx := context.Background()
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	if _, err := s.OverrideStatus(ctx, id, StatusOverrideRequest{Status: OrderFailed, Reason: "fraud hold", Author: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+
+	shown, err := s.GetOrder(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := shown["manual_override"].(*StatusOverride); !ok || o.Status != OrderFailed {
+		t.Fatalf("manual_override = %v, want the override", shown["manual_override"])
+	}
+
+	// A payment arriving later does not undo the override
+	s.markOrderPaid(ctx, id, "pay_late")
+	local, _ := s.store.Get(ctx, id)
+	if local.Status != OrderFailed || local.PaymentID != "" {
+		t.Fatalf("order = %s paid by %q, want it left failed", local.Status, local.PaymentID)
+	}
+}
+
+// verifiedEvent waits up to d for a payment.verified notification on ch,
+// passing over the others
+func verifiedEvent(ch *recordingChannel, d time.Duration) (notify.Event, bool) {
+	timeout := time.After(d)
+	for {
+		select {
+		case ev := <-ch.events:
+			if ev.Type == notify.EventPaymentVerified {
+				return ev, true
+			}
+		case <-timeout:
+			return notify.Event{}, false
+		}
+	}
+}
+
+func TestRenotify(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		payment string
+		wantErr error
+	}{
+		{"paid", OrderPaid, "pay_1", nil},
+		{"created", OrderCreated, "", ErrOrderNotPaid},
+		{"refunded", OrderRefunded, "pay_1", ErrOrderNotPaid},
+		{"paid without a payment", OrderPaid, "", ErrOrderNotPaid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &recordingChannel{events: make(chan notify.Event, 10)}
+			n := notify.New(notify.Options{}, ch)
+			defer n.Shutdown(context.Background())
+			s, _ := newTestService(t, newFakeGateway(), testConfig(t), WithNotifier(n))
+			ctx := context.Background()
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			if _, err := s.store.Update(ctx, id, func(o *Order) error {
+				o.Status, o.PaymentID = tt.status, tt.payment
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := s.Renotify(ctx, id, "ops@example.com")
+			order, _ := s.store.Get(ctx, id)
+			last := order.Timeline[len(order.Timeline)-1]
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if last.Type == TimelineRenotify {
+					t.Fatal("refused renotification recorded on the timeline")
+				}
+				if ev, ok := verifiedEvent(ch, 50*time.Millisecond); ok {
+					t.Fatalf("notified %+v, want nothing", ev)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.PaymentID != tt.payment || result.Channels["recording"] != notify.Queued {
+				t.Fatalf("result = %+v, want %s queued on the recording channel", result, tt.payment)
+			}
+			if last.Type != TimelineRenotify || last.Author != "ops@example.com" || last.Reference != tt.payment {
+				t.Fatalf("timeline entry = %+v, want the renotification by ops", last)
+			}
+			ev, ok := verifiedEvent(ch, time.Second)
+			if !ok || ev.Subject != tt.payment || ev.Data["renotified_by"] != "ops@example.com" {
+				t.Fatalf("notified %+v, want payment.verified renotified by ops", ev)
+			}
+		})
+	}
+
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	if _, err := s.Renotify(context.Background(), "order_missing", "ops"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown order: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MaxOrderFetchBatch is the most orders one batch fetch may ask for
+const MaxOrderFetchBatch = 100
+
+// Where a batch-fetched order came from
+const (
+	OrderSourceStore    = "store"
+	OrderSourceRazorpay = "razorpay"
+)
+
+// Why a batch-fetched order is missing
+const (
+	OrderFetchNotFound      = "not_found"
+	OrderFetchStoreError    = "store_error"
+	OrderFetchUpstreamError = "upstream_error"
+)
+
+// OrderBatchRequest lists the orders to fetch
+type OrderBatchRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100,dive,required"`
+}
+
+// OrderFetchResult is one order of a batch fetch: the local record when
+// there is one, otherwise Razorpay's order, or why neither was found
+type OrderFetchResult struct {
+	Source        string                 `json:"source,omitempty"`
+	Status        string                 `json:"status,omitempty"`
+	Order         *Order                 `json:"order,omitempty"`
+	RazorpayOrder map[string]interface{} `json:"razorpay_order,omitempty"`
+	Code          string                 `json:"code,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// FetchOrderBatch fetches the orders by ID, a few at a time. Each order is
+// looked up in the store and, when it is not there, fetched from Razorpay
+// like GetOrder. An order that cannot be fetched fails alone; the batch
+// only fails when it is malformed.
+func (s *Service) FetchOrderBatch(ctx context.Context, req OrderBatchRequest) (map[string]OrderFetchResult, error) {
+	if len(req.IDs) > MaxOrderFetchBatch {
+		return nil, invalidRequest("at most %d orders per batch", MaxOrderFetchBatch)
+	}
+
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	results := make([]OrderFetchResult, len(ids))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.cfg.OrderFetchConcurrency && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = s.fetchBatchOrder(ctx, ids[i])
+			}
+		}()
+	}
+	for i := range ids {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	byID := make(map[string]OrderFetchResult, len(ids))
+	for i, id := range ids {
+		byID[id] = results[i]
+	}
+	return byID, nil
+}
+
+// fetchBatchOrder fetches one order of a batch
+func (s *Service) fetchBatchOrder(ctx context.Context, id string) OrderFetchResult {
+	order, err := s.store.Get(ctx, id)
+	if err == nil {
+		return OrderFetchResult{Source: OrderSourceStore, Status: order.Status, Order: &order}
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return OrderFetchResult{Code: OrderFetchStoreError, Error: err.Error()}
+	}
+
+	remote, err := s.GetOrder(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return OrderFetchResult{Code: OrderFetchNotFound, Error: "order not found"}
+	case err != nil:
+		return OrderFetchResult{Code: OrderFetchUpstreamError, Error: err.Error()}
+	}
+	status, _ := remote["status"].(string)
+	return OrderFetchResult{Source: OrderSourceRazorpay, Status: status, RazorpayOrder: remote}
+}
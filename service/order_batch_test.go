@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchGateway is fakeGateway failing FetchOrder for down and recording
+// how many fetches ran at once
+type batchGateway struct {
+	*fakeGateway
+
+	down     string
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (g *batchGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	g.inFlight++
+	g.peak = max(g.peak, g.inFlight)
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.inFlight--
+		g.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if id == g.down {
+		return nil, errors.New("connection refused")
+	}
+	return g.fakeGateway.FetchOrder(ctx, id)
+}
+
+// brokenStore fails reads of one order
+type brokenStore struct {
+	OrderStore
+	broken string
+}
+
+func (s brokenStore) Get(ctx context.Context, id string) (Order, error) {
+	if id == s.broken {
+		return Order{}, errors.New("store unavailable")
+	}
+	return s.OrderStore.Get(ctx, id)
+}
+
+func TestFetchOrderBatch(t *testing.T) {
+	gw := &batchGateway{fakeGateway: newFakeGateway(), down: "order_down"}
+	s, _ := newTestService(t, gw, testConfig(t))
+	s.store = brokenStore{OrderStore: s.store, broken: "order_broken"}
+	stored := createTestOrder(t, s, 500)["id"].(string)
+	gw.mu.Lock()
+	gw.orders["order_remote"] = map[string]interface{}{"id": "order_remote", "amount": float64(700), "status": "attempted"}
+	gw.mu.Unlock()
+
+	results, err := s.FetchOrderBatch(context.Background(), OrderBatchRequest{
+		IDs: []string{stored, "order_remote", "order_missing", "order_down", "order_broken", stored},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("%d results, want one per distinct ID: %+v", len(results), results)
+	}
+
+	tests := []struct {
+		id     string
+		source string
+		status string
+		code   string
+	}{
+		{stored, OrderSourceStore, OrderCreated, ""},
+		{"order_remote", OrderSourceRazorpay, "attempted", ""},
+		{"order_missing", "", "", OrderFetchNotFound},
+		{"order_down", "", "", OrderFetchUpstreamError},
+		{"order_broken", "", "", OrderFetchStoreError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			r := results[tt.id]
+			if r.Source != tt.source || r.Status != tt.status || r.Code != tt.code || (tt.code != "") != (r.Error != "") {
+				t.Fatalf("result = %+v, want source %q status %q code %q", r, tt.source, tt.status, tt.code)
+			}
+			if tt.source == OrderSourceStore && (r.Order == nil || r.Order.ID != tt.id) {
+				t.Fatalf("order = %+v, want the stored record", r.Order)
+			}
+			if tt.source == OrderSourceRazorpay && r.RazorpayOrder["id"] != tt.id {
+				t.Fatalf("razorpay order = %v, want Razorpay's", r.RazorpayOrder)
+			}
+		})
+	}
+}
+
+func TestFetchOrderBatchBounded(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.OrderFetchConcurrency = 3
+	gw := &batchGateway{fakeGateway: newFakeGateway()}
+	s, _ := newTestService(t, gw, cfg)
+
+	ids := make([]string, 20)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("order_%d", i)
+	}
+	results, err := s.FetchOrderBatch(context.Background(), OrderBatchRequest{IDs: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 20 || gw.peak > 3 {
+		t.Fatalf("%d results with %d fetches at once, want 20 with at most 3", len(results), gw.peak)
+	}
+
+	tooMany := make([]string, MaxOrderFetchBatch+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("order_%d", i)
+	}
+	var invalid *ValidationError
+	if _, err := s.FetchOrderBatch(context.Background(), OrderBatchRequest{IDs: tooMany}); !errors.As(err, &invalid) {
+		t.Fatalf("err = %v, want a validation error over the cap", err)
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// cachedOrder is a provider order as last seen by this instance
+type cachedOrder struct {
+	id       string
+	order    map[string]interface{}
+	cachedAt time.Time
+}
+
+// orderCache is a bounded LRU of provider orders this instance created or
+// fetched, used to keep serving reads through upstream outages
+type orderCache struct {
+	mu       sync.Mutex
+	clock    clock.Clock
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+func newOrderCache(capacity int, clk clock.Clock) *orderCache {
+	return &orderCache{
+		clock:    clk,
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (oc *orderCache) put(order map[string]interface{}) {
+	id, _ := order["id"].(string)
+	if id == "" || oc.capacity <= 0 {
+		return
+	}
+
+	// Callers go on to decorate their map, e.g. with order_token
+	snapshot := make(map[string]interface{}, len(order))
+	for k, v := range order {
+		snapshot[k] = v
+	}
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	entry := &cachedOrder{id: id, order: snapshot, cachedAt: oc.clock.Now()}
+	if el, ok := oc.entries[id]; ok {
+		el.Value = entry
+		oc.lru.MoveToFront(el)
+		return
+	}
+	oc.entries[id] = oc.lru.PushFront(entry)
+	if oc.lru.Len() > oc.capacity {
+		oldest := oc.lru.Back()
+		oc.lru.Remove(oldest)
+		delete(oc.entries, oldest.Value.(*cachedOrder).id)
+	}
+}
+
+func (oc *orderCache) get(id string) (cachedOrder, bool) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	el, ok := oc.entries[id]
+	if !ok {
+		return cachedOrder{}, false
+	}
+	oc.lru.MoveToFront(el)
+	return *el.Value.(*cachedOrder), true
+}
+
+// terminalOrder reports whether a provider order can no longer change
+func terminalOrder(order map[string]interface{}) bool {
+	status, _ := order["status"].(string)
+	return status == "paid"
+}
+
+// orderFetches coalesces concurrent fetches of the same order into one
+// provider call. A call is forgotten once it returns, so its result, error
+// or not, is only shared with the callers that were already waiting.
+type orderFetches struct {
+	mu    sync.Mutex
+	calls map[string]*orderFetch
+}
+
+type orderFetch struct {
+	done  chan struct{}
+	order map[string]interface{}
+	err   error
+}
+
+// do returns the result of fetch for key, calling it unless a call for key
+// is in flight. fetch runs without the caller's cancellation, so a caller
+// giving up does not fail the others; each caller stops waiting when its
+// own ctx is done.
+func (g *orderFetches) do(ctx context.Context, key string, fetch func(context.Context) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		if g.calls == nil {
+			g.calls = make(map[string]*orderFetch)
+		}
+		call = &orderFetch{done: make(chan struct{})}
+		g.calls[key] = call
+		go func(ctx context.Context) {
+			call.order, call.err = fetch(ctx)
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+		}(context.WithoutCancel(ctx))
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	// Callers decorate the map they get back
+	order := make(map[string]interface{}, len(call.order))
+	for k, v := range call.order {
+		order[k] = v
+	}
+	return order, nil
+}
+
+// GetOrder fetches the order from the provider. When the provider is
+// unreachable, the last cached copy is served with stale=true and its
+// cached_at time: indefinitely for terminal orders and up to the configured
+// staleness limit for the rest.
+//
+// Concurrent fetches of the same order, e.g. clients polling a new order,
+// share one provider call.
+func (s *Service) GetOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	tenant, _ := authctx.Tenant(ctx)
+	order, err := s.fetches.do(ctx, tenant+"/"+id, func(ctx context.Context) (map[string]interface{}, error) {
+		order, err := s.gateway.FetchOrder(ctx, id)
+		if err == nil {
+			s.orders.put(order)
+		}
+		return order, err
+	})
+	if err == nil {
+		metrics.OrderFetches.WithLabelValues("fresh").Inc()
+		return s.withOverride(ctx, order), nil
+	}
+
+	var rejected *gateway.RequestError
+	if errors.As(err, &rejected) {
+		// Razorpay answered; the order does not exist or the ID is invalid
+		metrics.OrderFetches.WithLabelValues("failed").Inc()
+		return nil, ErrNotFound
+	}
+
+	cached, ok := s.orders.get(id)
+	if ok && (terminalOrder(cached.order) || s.clock.Now().Sub(cached.cachedAt) <= s.cfg.OrderCacheMaxStaleness) {
+		metrics.OrderFetches.WithLabelValues("stale").Inc()
+		stale := make(map[string]interface{}, len(cached.order)+2)
+		for k, v := range cached.order {
+			stale[k] = v
+		}
+		stale["stale"] = true
+		stale["cached_at"] = cached.cachedAt.Format(time.RFC3339)
+		return s.withOverride(ctx, stale), nil
+	}
+
+	metrics.OrderFetches.WithLabelValues("failed").Inc()
+	return nil, fmt.Errorf("fetch order %s: %w", id, err)
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// mockRazorpay serves orders until it is taken down, then answers 503
+type mockRazorpay struct {
+	mu     sync.Mutex
+	down   bool
+	status string
+}
+
+func (m *mockRazorpay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	down, status := m.down, m.status
+	m.mu.Unlock()
+	if down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id":"order_1","entity":"order","amount":500,"currency":"INR","status":%q}`, status)
+}
+
+func (m *mockRazorpay) set(down bool, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down, m.status = down, status
+}
+
+func TestGetOrderServedStaleThroughOutage(t *testing.T) {
+	const maxStaleness = 5 * time.Minute
+	tests := []struct {
+		name string
+		// status is the order's status when last seen
+		status string
+		// age is how long before the outage the order was fetched
+		age       time.Duration
+		wantStale bool
+	}{
+		{name: "recent", status: "created", age: time.Minute, wantStale: true},
+		{name: "at the limit", status: "attempted", age: maxStaleness, wantStale: true},
+		{name: "too old", status: "created", age: maxStaleness + time.Second},
+		{name: "terminal", status: "paid", age: 30 * 24 * time.Hour, wantStale: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockRazorpay{status: tt.status}
+			server := httptest.NewServer(mock)
+			defer server.Close()
+			gw, err := gateway.NewRazorpay(gateway.RazorpayOptions{KeyID: "rzp_test_key", KeySecret: testSecret, BaseURL: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := testConfig(t)
+			cfg.OrderCacheMaxStaleness = maxStaleness
+			s, clk := newTestService(t, gw, cfg)
+			fetches := func(result string) float64 {
+				return testutil.ToFloat64(metrics.OrderFetches.WithLabelValues(result))
+			}
+			fresh, stale, failed := fetches("fresh"), fetches("stale"), fetches("failed")
+
+			if order, err := s.GetOrder(context.Background(), "order_1"); err != nil || order["stale"] != nil {
+				t.Fatalf("fetch while up = %v, %v", order, err)
+			}
+			cachedAt := clk.Now()
+			mock.set(true, tt.status)
+			clk.Advance(tt.age)
+
+			order, err := s.GetOrder(context.Background(), "order_1")
+			if !tt.wantStale {
+				if err == nil || !gateway.IsOutage(err) {
+					t.Fatalf("err = %v, want the outage", err)
+				}
+				if fetches("failed")-failed != 1 {
+					t.Fatal("failed fetch not counted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetch during the outage: %v", err)
+			}
+			if order["stale"] != true || order["cached_at"] != cachedAt.Format(time.RFC3339) || order["status"] != tt.status {
+				t.Fatalf("order = %v, want the cached copy marked stale", order)
+			}
+			if fetches("fresh")-fresh != 1 || fetches("stale")-stale != 1 {
+				t.Fatal("fresh and stale fetches not counted apart")
+			}
+
+			// Once Razorpay is back the order is fresh again
+			mock.set(false, tt.status)
+			if order, err := s.GetOrder(context.Background(), "order_1"); err != nil || order["stale"] != nil {
+				t.Fatalf("fetch after recovery = %v, %v", order, err)
+			}
+		})
+	}
+}
+
+func TestGetOrderNeverCachedFails(t *testing.T) {
+	server := httptest.NewServer(&mockRazorpay{down: true})
+	defer server.Close()
+	gw, err := gateway.NewRazorpay(gateway.RazorpayOptions{KeyID: "rzp_test_key", KeySecret: testSecret, BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestService(t, gw, testConfig(t))
+	if _, err := s.GetOrder(context.Background(), "order_1"); !errors.Is(err, gateway.ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestOrderCacheEvictsLeastRecent(t *testing.T) {
+	_, clk := newTestService(t, newFakeGateway(), testConfig(t))
+	oc := newOrderCache(2, clk)
+	for _, id := range []string{"order_1", "order_2"} {
+		oc.put(map[string]interface{}{"id": id})
+	}
+	oc.get("order_1")
+	oc.put(map[string]interface{}{"id": "order_3"})
+
+	for id, want := range map[string]bool{"order_1": true, "order_2": false, "order_3": true} {
+		if _, ok := oc.get(id); ok != want {
+			t.Fatalf("%s cached: %v, want %v", id, ok, want)
+		}
+	}
+
+	order := map[string]interface{}{"id": "order_4"}
+	oc.put(order)
+	order["order_token"] = "decorated"
+	if got, _ := oc.get("order_4"); got.order["order_token"] != nil {
+		t.Fatal("cached order changed by its caller")
+	}
+}
+
+// heldFetch is an order fetch counting its calls that waits for release,
+// then answers with err or an order
+type heldFetch struct {
+	release chan struct{}
+	mu      sync.Mutex
+	calls   int
+	err     error
+}
+
+func (f *heldFetch) fetch(ctx context.Context) (map[string]interface{}, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	<-f.release
+	if f.err != nil {
+		return nil, f.err
+	}
+	return map[string]interface{}{"id": "order_1", "status": "created"}, nil
+}
+
+func (f *heldFetch) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestOrderFetchesCoalesced(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"order shared", nil, false},
+		{"error shared", errors.New("razorpay down"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g orderFetches
+			f := &heldFetch{release: make(chan struct{}), err: tt.err}
+			results := make([]map[string]interface{}, 10)
+			errs := make([]error, 10)
+			var wg sync.WaitGroup
+			for i := range results {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i], errs[i] = g.do(context.Background(), "order_1", f.fetch)
+				}()
+			}
+			time.Sleep(10 * time.Millisecond)
+			close(f.release)
+			wg.Wait()
+
+			if n := f.count(); n != 1 {
+				t.Fatalf("%d upstream calls for 10 concurrent fetches, want 1", n)
+			}
+			for i := range results {
+				if (errs[i] != nil) != tt.wantErr {
+					t.Fatalf("caller %d: err = %v, want error %v", i, errs[i], tt.wantErr)
+				}
+			}
+			if !tt.wantErr {
+				// Each caller gets its own copy to decorate
+				results[0]["stale"] = true
+				if _, ok := results[1]["stale"]; ok {
+					t.Fatal("callers share one map")
+				}
+			}
+
+			// The call is forgotten once it returns, error or not
+			f.release = make(chan struct{})
+			close(f.release)
+			g.do(context.Background(), "order_1", f.fetch)
+			if n := f.count(); n != 2 {
+				t.Fatalf("%d upstream calls after the first returned, want a new one", n)
+			}
+		})
+	}
+}
+
+func TestOrderFetchesCallerGivesUp(t *testing.T) {
+	var g orderFetches
+	f := &heldFetch{release: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := g.do(ctx, "order_1", f.fetch)
+		done <- err
+	}()
+	other := make(chan error)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		_, err := g.do(context.Background(), "order_1", f.fetch)
+		other <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller: err = %v, want context.Canceled", err)
+	}
+	close(f.release)
+	if err := <-other; err != nil {
+		t.Fatalf("waiting caller: %v, want the shared fetch unaffected", err)
+	}
+	if n := f.count(); n != 1 {
+		t.Fatalf("%d upstream calls, want 1", n)
+	}
+}
+
+// slowOrderGateway is fakeGateway holding FetchOrder until release closes
+type slowOrderGateway struct {
+	*fakeGateway
+	fetch *heldFetch
+}
+
+func (g *slowOrderGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	return g.fetch.fetch(ctx)
+}
+
+func TestGetOrderPollingStorm(t *testing.T) {
+	gw := &slowOrderGateway{fakeGateway: newFakeGateway(), fetch: &heldFetch{release: make(chan struct{})}}
+	s, _ := newTestService(t, gw, testConfig(t))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetOrder(context.Background(), "order_1"); err != nil {
+				t.Errorf("get order: %v", err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(gw.fetch.release)
+	wg.Wait()
+	if n := gw.fetch.count(); n != 1 {
+		t.Fatalf("%d Razorpay calls for 20 concurrent polls, want 1", n)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MaxOrderCreateBatch is the most orders one batch may create
+const MaxOrderCreateBatch = 100
+
+// Outcomes of a batch-created order
+const (
+	BatchOrderCreated = "created"
+	// BatchOrderInvalid is an item refused by validation, which would fail
+	// the same way on POST /orders
+	BatchOrderInvalid = "invalid"
+	BatchOrderFailed  = "failed"
+	// BatchOrderNotProcessed is an item not yet started when the request
+	// was cancelled
+	BatchOrderNotProcessed = "not_processed"
+)
+
+// OrderCreateBatchItem is one order of a batch: a PaymentRequest with the
+// receipt to create it under, generated when empty
+type OrderCreateBatchItem struct {
+	PaymentRequest
+	Receipt string `json:"receipt"`
+}
+
+// OrderCreateBatchRequest lists the orders to create
+type OrderCreateBatchRequest struct {
+	Items []OrderCreateBatchItem `json:"items" binding:"required,min=1,max=100"`
+}
+
+// OrderCreateResult is the outcome of one item, in request order. Receipt
+// is the one the order was created under, generated or not.
+type OrderCreateResult struct {
+	Index   int                    `json:"index"`
+	Receipt string                 `json:"receipt,omitempty"`
+	Status  string                 `json:"status"`
+	Order   map[string]interface{} `json:"order,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// CreateOrderBatch creates each item like CreateOrder, under its own
+// receipt, notes and currency, BatchConcurrency at a time. An item that
+// fails validation or creation fails alone; the batch only fails when it
+// is malformed. Items not started once ctx is done are not_processed.
+// Receipts are not checked against existing orders; PUT /orders/by-receipt
+// is the path that is safe to repeat.
+func (s *Service) CreateOrderBatch(ctx context.Context, req OrderCreateBatchRequest) ([]OrderCreateResult, error) {
+	if len(req.Items) > MaxOrderCreateBatch {
+		return nil, invalidRequest("at most %d orders per batch", MaxOrderCreateBatch)
+	}
+
+	results := make([]OrderCreateResult, len(req.Items))
+	receipts := make(map[string]int, len(req.Items))
+	var pending []int
+	for i, item := range req.Items {
+		results[i] = OrderCreateResult{Index: i, Receipt: item.Receipt, Status: BatchOrderNotProcessed}
+		if item.Receipt != "" {
+			if !receiptPattern.MatchString(item.Receipt) {
+				results[i].Status, results[i].Error = BatchOrderInvalid, invalidRequest("receipt must be 1-40 letters, digits, dots, dashes or underscores").Error()
+				continue
+			}
+			if first, dup := receipts[item.Receipt]; dup {
+				results[i].Status, results[i].Error = BatchOrderInvalid, invalidRequest("receipt repeats item %d", first).Error()
+				continue
+			}
+			receipts[item.Receipt] = i
+		}
+		pending = append(pending, i)
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.cfg.BatchConcurrency && w < len(pending); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if ctx.Err() != nil {
+					continue
+				}
+				s.createBatchOrder(ctx, req.Items[i], &results[i])
+			}
+		}()
+	}
+feed:
+	for _, i := range pending {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return results, nil
+}
+
+// createBatchOrder fills in the outcome of one item
+func (s *Service) createBatchOrder(ctx context.Context, item OrderCreateBatchItem, result *OrderCreateResult) {
+	order, err := s.createRequestedOrder(ctx, item.PaymentRequest, item.Receipt)
+	switch {
+	case err == nil:
+		result.Status, result.Order = BatchOrderCreated, order
+		result.Receipt, _ = order["receipt"].(string)
+	case invalidOrder(err):
+		result.Status, result.Error = BatchOrderInvalid, err.Error()
+	default:
+		result.Status, result.Error = BatchOrderFailed, err.Error()
+	}
+}
+
+// invalidOrder reports whether createRequestedOrder refused the request
+// itself, rather than failing to create it
+func invalidOrder(err error) bool {
+	var validation *ValidationError
+	var brand *UnknownBrandError
+	return errors.As(err, &validation) || errors.As(err, &brand) ||
+		errors.Is(err, ErrInvalidAmount) || errors.Is(err, ErrNoteTooLong) ||
+		errors.Is(err, ErrUnknownTag) || errors.Is(err, ErrDryRunDisabled) ||
+		errors.Is(err, ErrInsufficientCredit)
+}
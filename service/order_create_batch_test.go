@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowGateway holds each CreateOrder for a moment, recording how many were
+// in flight at once
+type slowGateway struct {
+	*fakeGateway
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (g *slowGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	g.inFlight++
+	if g.inFlight > g.maxInFlight {
+		g.maxInFlight = g.inFlight
+	}
+	g.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	g.mu.Lock()
+	g.inFlight--
+	g.mu.Unlock()
+	return g.fakeGateway.CreateOrder(ctx, data)
+}
+
+func TestCreateOrderBatchBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{"serial", 1},
+		{"bounded", 3},
+		{"more workers than items", 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.BatchConcurrency = tt.concurrency
+			gw := &slowGateway{fakeGateway: newFakeGateway()}
+			s, _ := newTestService(t, gw, cfg)
+			items := make([]OrderCreateBatchItem, 12)
+			for i := range items {
+				items[i].Amount = 100 * (i + 1)
+			}
+
+			results, err := s.CreateOrderBatch(context.Background(), OrderCreateBatchRequest{Items: items})
+			if err != nil {
+				t.Fatalf("CreateOrderBatch: %v", err)
+			}
+			for i, r := range results {
+				if r.Index != i || r.Status != BatchOrderCreated {
+					t.Fatalf("result %d = %+v, want item %d created", i, r, i)
+				}
+				// Results are in request order, whichever finished first
+				if amount, _ := intField(r.Order, "amount"); amount != items[i].Amount {
+					t.Fatalf("result %d is the order for %d, want %d", i, amount, items[i].Amount)
+				}
+			}
+			limit := min(tt.concurrency, len(items))
+			if gw.maxInFlight > limit {
+				t.Fatalf("%d creates in flight at once, limit %d", gw.maxInFlight, limit)
+			}
+		})
+	}
+}
+
+func TestCreateOrderBatchStopsWhenCancelled(t *testing.T) {
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := s.CreateOrderBatch(ctx, OrderCreateBatchRequest{Items: make([]OrderCreateBatchItem, 5)})
+	if err != nil {
+		t.Fatalf("CreateOrderBatch: %v", err)
+	}
+	for i, r := range results {
+		if r.Status != BatchOrderNotProcessed {
+			t.Fatalf("result %d = %s after cancelling, want not_processed", i, r.Status)
+		}
+	}
+	if gw.created != 0 {
+		t.Fatalf("%d orders created after cancelling", gw.created)
+	}
+}
+
+func TestCreateOrderBatchItemsKeepTheirOwnFields(t *testing.T) {
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	items := []OrderCreateBatchItem{
+		{PaymentRequest: PaymentRequest{Amount: 500, Notes: map[string]string{"sku": "a"}}, Receipt: "imp-1"},
+		{PaymentRequest: PaymentRequest{Amount: 700, Currency: "inr", Notes: map[string]string{"sku": "b"}}, Receipt: "imp-2"},
+		{PaymentRequest: PaymentRequest{Amount: 0}, Receipt: "imp-3"},
+		{PaymentRequest: PaymentRequest{Amount: 900}, Receipt: "imp-1"},
+		{PaymentRequest: PaymentRequest{Amount: 900}, Receipt: "not a receipt"},
+		{PaymentRequest: PaymentRequest{Amount: 300}},
+		{PaymentRequest: PaymentRequest{Amount: 300}},
+	}
+
+	results, err := s.CreateOrderBatch(context.Background(), OrderCreateBatchRequest{Items: items})
+	if err != nil {
+		t.Fatalf("CreateOrderBatch: %v", err)
+	}
+	want := []string{BatchOrderCreated, BatchOrderCreated, BatchOrderInvalid, BatchOrderInvalid, BatchOrderInvalid, BatchOrderCreated, BatchOrderCreated}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Fatalf("item %d = %s %q, want %s", i, r.Status, r.Error, want[i])
+		}
+	}
+	for i, sku := range []string{"a", "b"} {
+		stored, err := s.store.GetByReceipt(context.Background(), items[i].Receipt)
+		if err != nil {
+			t.Fatalf("item %d: %v", i, err)
+		}
+		if stored.Notes["sku"] != sku || stored.Amount != items[i].Amount || stored.Currency != "INR" {
+			t.Fatalf("item %d stored as %+v", i, stored)
+		}
+	}
+	// Orders created in the same second without a receipt still get
+	// distinct ones
+	if results[5].Receipt == "" || results[5].Receipt == results[6].Receipt {
+		t.Fatalf("generated receipts %q and %q", results[5].Receipt, results[6].Receipt)
+	}
+	if gw.created != 4 {
+		t.Fatalf("%d orders created, want 4", gw.created)
+	}
+}
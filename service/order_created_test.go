@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// createdEvent waits up to d for ch's next order.created event
+func createdEvent(ch *recordingChannel, d time.Duration) (notify.Event, bool) {
+	timeout := time.After(d)
+	for {
+		select {
+		case ev := <-ch.events:
+			if ev.Type == notify.EventOrderCreated {
+				return ev, true
+			}
+		case <-timeout:
+			return notify.Event{}, false
+		}
+	}
+}
+
+func TestOrderCreatedEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       PaymentRequest
+		createErr error
+		want      map[string]interface{}
+	}{
+		{
+			"with notes",
+			PaymentRequest{Amount: 50000, Currency: "INR", Notes: map[string]string{"sku": "A-1"}},
+			nil,
+			map[string]interface{}{"amount": 50000, "currency": "INR", "notes": map[string]string{"sku": "A-1", "created_at": "2026-03-02T10:00:00Z"}, "brand": ""},
+		},
+		{
+			"default currency",
+			PaymentRequest{Amount: 100},
+			nil,
+			map[string]interface{}{"amount": 100, "currency": "INR", "notes": map[string]string{"created_at": "2026-03-02T10:00:00Z"}, "brand": ""},
+		},
+		{"refused by Razorpay", PaymentRequest{Amount: 100}, errors.New("razorpay down"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			gw.createErr = tt.createErr
+			ch := &recordingChannel{events: make(chan notify.Event, 10)}
+			n := notify.New(notify.Options{}, ch)
+			defer n.Shutdown(context.Background())
+			s, _ := newTestService(t, gw, testConfig(t), WithNotifier(n))
+
+			ctx := notify.WithHeaders(context.Background(), map[string]string{"X-Tenant": "acme"})
+			order, err := s.CreateOrder(ctx, tt.req)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("create against a failing gateway succeeded")
+				}
+				if ev, ok := createdEvent(ch, 50*time.Millisecond); ok {
+					t.Fatalf("published %+v for an order never created", ev)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, ok := createdEvent(ch, time.Second)
+			if !ok {
+				t.Fatal("no order.created event")
+			}
+			id := order["id"].(string)
+			tt.want["order_id"] = id
+			if ev.Subject != id || !reflect.DeepEqual(ev.Data, tt.want) {
+				t.Fatalf("event = %s %v, want %s %v", ev.Subject, ev.Data, id, tt.want)
+			}
+			if ev.Headers["X-Tenant"] != "acme" {
+				t.Fatalf("headers = %v, want the forwarded headers", ev.Headers)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// orderExpirySweepInterval is how often unpaid orders are checked against
+// ORDER_EXPIRY
+const orderExpirySweepInterval = time.Minute
+
+// orderExpiryBatch is the most orders one sweep expires; the rest wait for
+// the next
+const orderExpiryBatch = 100
+
+// startOrderExpirySweeper expires orders left unpaid for OrderExpiry
+func (s *Service) startOrderExpirySweeper() {
+	if s.cfg.OrderExpiry <= 0 {
+		return
+	}
+	s.runners.Add("order-expiry-sweeper", runner.Every(orderExpirySweepInterval, func() {
+		if _, err := s.expireOrders(context.Background()); err != nil {
+			log.Printf("Error expiring unpaid orders: %v", err)
+		}
+	}))
+}
+
+// expireOrders moves orders created more than OrderExpiry ago and still
+// awaiting payment to expired, returning how many it expired. A payment
+// arriving later is subject to LATE_CAPTURE_GRACE.
+func (s *Service) expireOrders(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	due, err := s.store.Expirable(ctx, now.Add(-s.cfg.OrderExpiry), orderExpiryBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, candidate := range due {
+		var from string
+		_, err := s.store.Update(ctx, candidate.ID, func(order *Order) error {
+			// Paid, overridden or archived since it was listed
+			if order.Override != nil || order.Archive != nil || !canTransition(order.Status, OrderExpired) {
+				return nil
+			}
+			from = order.Status
+			return order.transition(OrderExpired, now)
+		})
+		if err != nil {
+			log.Printf("Error expiring order %s: %v", candidate.ID, err)
+			continue
+		}
+		if from == "" {
+			continue
+		}
+		expired++
+		s.publishEvent(EventOrderStatusChanged, map[string]string{
+			"order_id": candidate.ID,
+			"from":     from,
+			"to":       OrderExpired,
+		})
+	}
+	if expired > 0 {
+		log.Printf("Expired %d orders unpaid for %s", expired, s.cfg.OrderExpiry)
+	}
+	return expired, nil
+}
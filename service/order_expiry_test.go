@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExpireOrders(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.OrderExpiry = 30 * time.Minute
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	ctx := context.Background()
+
+	set := func(id string, fn func(*Order)) {
+		t.Helper()
+		if _, err := s.store.Update(ctx, id, func(o *Order) error { fn(o); return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := createTestOrder(t, s, 500)["id"].(string)
+	failed := createTestOrder(t, s, 500)["id"].(string)
+	set(failed, func(o *Order) { o.Status = OrderFailed })
+	abandoned := createTestOrder(t, s, 500)["id"].(string)
+	set(abandoned, func(o *Order) { o.Status = OrderAbandoned })
+	paid := createTestOrder(t, s, 500)["id"].(string)
+	s.markOrderPaid(ctx, paid, "pay_1")
+	overridden := createTestOrder(t, s, 500)["id"].(string)
+	set(overridden, func(o *Order) { o.Override = &StatusOverride{Status: OrderCreated} })
+	clk.Advance(20 * time.Minute)
+	recent := createTestOrder(t, s, 500)["id"].(string)
+
+	sub, _ := s.SubscribeEvents(0, []string{EventOrderStatusChanged})
+	defer s.UnsubscribeEvents(sub)
+	clk.Advance(10*time.Minute + time.Second)
+	n, err := s.expireOrders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expired %d orders, want 3", n)
+	}
+
+	want := map[string]string{
+		open:       OrderExpired,
+		failed:     OrderExpired,
+		abandoned:  OrderExpired,
+		paid:       OrderPaid,
+		overridden: OrderCreated,
+		recent:     OrderCreated,
+	}
+	for id, status := range want {
+		order, _ := s.store.Get(ctx, id)
+		if order.Status != status {
+			t.Fatalf("order %s = %s, want %s", id, order.Status, status)
+		}
+		if status == OrderExpired {
+			if last := order.Timeline[len(order.Timeline)-1]; last.To != OrderExpired || !last.At.Equal(clk.Now()) {
+				t.Fatalf("timeline entry = %+v, want the expiry now", last)
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		ev := <-sub.C
+		data := ev.Data.(map[string]string)
+		if data["to"] != OrderExpired || want[data["order_id"]] != OrderExpired {
+			t.Fatalf("event = %+v, want an expiry", data)
+		}
+	}
+	if len(sub.C) != 0 {
+		t.Fatalf("unexpected event: %+v", <-sub.C)
+	}
+
+	// The next sweep has nothing left to do
+	if n, err := s.expireOrders(ctx); err != nil || n != 0 {
+		t.Fatalf("second sweep expired %d orders, err %v, want none", n, err)
+	}
+}
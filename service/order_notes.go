@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// maxNotes is Razorpay's limit on the number of notes per entity
+const maxNotes = 15
+
+// ErrNoteTooLong is a caller's note value over NoteValueMaxLength
+var ErrNoteTooLong = errors.New("note value too long")
+
+// OrderNotesRequest adds or overwrites notes on an existing order
+type OrderNotesRequest struct {
+	Notes map[string]string `json:"notes" binding:"required"`
+}
+
+// UpdateOrderNotes merges req.Notes into the order's notes and returns the
+// result. Razorpay replaces notes wholesale on update, so the current notes
+// are fetched from Razorpay, merged, and written back in full. The change is
+// reflected on Razorpay and in the local store.
+func (s *Service) UpdateOrderNotes(ctx context.Context, id string, req OrderNotesRequest) (map[string]string, error) {
+	if len(req.Notes) == 0 {
+		return nil, invalidRequest("notes must not be empty")
+	}
+
+	current, err := s.gateway.FetchOrder(ctx, id)
+	if err != nil {
+		var reqErr *gateway.RequestError
+		if errors.As(err, &reqErr) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("fetch order %s: %w", id, err)
+	}
+
+	merged := stringNotes(current["notes"])
+	for k, v := range req.Notes {
+		merged[k] = v
+	}
+	if len(merged) > maxNotes {
+		return nil, invalidRequest("an order takes at most %d notes, merging would leave %d", maxNotes, len(merged))
+	}
+	if err := s.checkNotes(merged); err != nil {
+		return nil, err
+	}
+
+	merged = s.limitNotes(merged)
+	order, err := s.gateway.UpdateOrder(ctx, id, map[string]interface{}{"notes": merged})
+	if err != nil {
+		return nil, fmt.Errorf("update order %s notes: %w", id, err)
+	}
+	s.orders.put(order)
+
+	_, err = s.store.Update(ctx, id, func(order *Order) error {
+		order.Notes = merged
+		order.UpdatedAt = s.clock.Now()
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error saving notes of order %s: %v", id, err)
+	}
+
+	return merged, nil
+}
+
+// stringNotes converts Razorpay's notes value into a map. Razorpay returns
+// an empty JSON array rather than an object when there are no notes.
+func stringNotes(v interface{}) map[string]string {
+	notes := map[string]string{}
+	m, _ := v.(map[string]interface{})
+	for k, val := range m {
+		notes[k] = fmt.Sprint(val)
+	}
+	return notes
+}
+
+// checkNoteLengths refuses note values over the limit in reject mode. In
+// truncate mode they pass, to be cut by limitNotes.
+func (s *Service) checkNoteLengths(notes map[string]string) error {
+	if s.cfg.NoteValueOverflow == config.NoteOverflowTruncate || s.cfg.NoteValueMaxLength <= 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(notes))
+	for k := range notes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if n := utf8.RuneCountInString(notes[k]); n > s.cfg.NoteValueMaxLength {
+			return fmt.Errorf("%w: note %q is %d characters, at most %d are allowed", ErrNoteTooLong, k, n, s.cfg.NoteValueMaxLength)
+		}
+	}
+	return nil
+}
+
+// limitNotes returns notes with every value cut to NoteValueMaxLength,
+// logging each one cut. It covers what is sent to Razorpay, including the
+// notes the service adds to the caller's.
+func (s *Service) limitNotes(notes map[string]string) map[string]string {
+	limit := s.cfg.NoteValueMaxLength
+	var limited map[string]string
+	for k, v := range notes {
+		if limit <= 0 || utf8.RuneCountInString(v) <= limit {
+			continue
+		}
+		if limited == nil {
+			limited = make(map[string]string, len(notes))
+			for k, v := range notes {
+				limited[k] = v
+			}
+		}
+		limited[k] = string([]rune(v)[:limit])
+		log.Printf("WARNING: truncated note %q from %d to %d characters", k, utf8.RuneCountInString(v), limit)
+	}
+	if limited == nil {
+		return notes
+	}
+	return limited
+}
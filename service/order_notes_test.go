@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/yash170603/golang_payment/config"
+)
+
+// manyNotes returns n notes named prefix0 onwards
+func manyNotes(prefix string, n int) map[string]string {
+	notes := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		notes[fmt.Sprintf("%s%d", prefix, i)] = "v"
+	}
+	return notes
+}
+
+func TestUpdateOrderNotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]string
+		update  map[string]string
+		want    map[string]string
+		invalid bool
+	}{
+		{"adds", map[string]string{"customer": "c1"}, map[string]string{"ticket": "SUP-1"},
+			map[string]string{"customer": "c1", "ticket": "SUP-1"}, false},
+		{"overwrites", map[string]string{"customer": "c1", "ticket": "SUP-1"}, map[string]string{"ticket": "SUP-2"},
+			map[string]string{"customer": "c1", "ticket": "SUP-2"}, false},
+		{"no current notes", nil, map[string]string{"ticket": "SUP-1"}, map[string]string{"ticket": "SUP-1"}, false},
+		{"reaches the limit", manyNotes("k", 14), map[string]string{"ticket": "SUP-1"}, nil, false},
+		// Overwriting keys does not count against the limit
+		{"full but overwriting", manyNotes("k", 15), map[string]string{"k0": "new"}, nil, false},
+		{"merged over the limit", manyNotes("k", 14), manyNotes("x", 2), nil, true},
+		{"update alone over the limit", nil, manyNotes("x", 16), nil, true},
+		{"empty", map[string]string{"customer": "c1"}, map[string]string{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			ctx := context.Background()
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			current := map[string]interface{}{}
+			for k, v := range tt.current {
+				current[k] = v
+			}
+			gw.orders[id]["notes"] = current
+
+			got, err := s.UpdateOrderNotes(ctx, id, OrderNotesRequest{Notes: tt.update})
+			var invalid *ValidationError
+			if tt.invalid {
+				if !errors.As(err, &invalid) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				if gw.updates != 0 {
+					t.Fatalf("refused notes were sent to Razorpay")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want
+			if want == nil {
+				want = copyNotes(tt.current)
+				for k, v := range tt.update {
+					want[k] = v
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("notes = %v, want %v", got, want)
+			}
+			if remote := stringNotes(gw.orders[id]["notes"]); !reflect.DeepEqual(remote, want) {
+				t.Fatalf("Razorpay notes = %v, want %v", remote, want)
+			}
+			if local, _ := s.store.Get(ctx, id); !reflect.DeepEqual(local.Notes, want) {
+				t.Fatalf("local notes = %v, want %v", local.Notes, want)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderNotesUnknownOrder(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	_, err := s.UpdateOrderNotes(context.Background(), "order_missing", OrderNotesRequest{Notes: map[string]string{"a": "b"}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func copyNotes(notes map[string]string) map[string]string {
+	c := make(map[string]string, len(notes))
+	for k, v := range notes {
+		c[k] = v
+	}
+	return c
+}
+
+func TestDefaultNotesMergedUnderCallerNotes(t *testing.T) {
+	defaults := map[string]string{"env": "staging", "service_version": "1.4.0"}
+	tests := []struct {
+		name  string
+		notes map[string]string
+		want  map[string]string
+		// left are default notes left off the order
+		left []string
+	}{
+		{"no caller notes", nil, map[string]string{"env": "staging", "service_version": "1.4.0"}, nil},
+		{"caller notes kept", map[string]string{"customer": "c_1"}, map[string]string{"customer": "c_1", "env": "staging", "service_version": "1.4.0"}, nil},
+		{"caller wins", map[string]string{"env": "prod-canary"}, map[string]string{"env": "prod-canary", "service_version": "1.4.0"}, nil},
+		// Orders are created with a created_at note as well
+		{"room for one", manyNotes("n", maxNotes-2), map[string]string{"env": "staging"}, []string{"service_version"}},
+		{"no room", manyNotes("n", maxNotes-1), nil, []string{"env", "service_version"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			cfg := testConfig(t)
+			cfg.OrderDefaultNotes = defaults
+			s, _ := newTestService(t, gw, cfg)
+			if _, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 50000, Notes: tt.notes}); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := gw.orders["order_1"]["notes"].(map[string]string)
+			if len(sent) > maxNotes {
+				t.Fatalf("%d notes sent, want at most %d", len(sent), maxNotes)
+			}
+			for k, v := range tt.want {
+				if sent[k] != v {
+					t.Fatalf("note %s = %q, want %q", k, sent[k], v)
+				}
+			}
+			for _, k := range tt.left {
+				if _, ok := sent[k]; ok {
+					t.Fatalf("default note %s sent past the notes limit", k)
+				}
+			}
+			for k, v := range tt.notes {
+				if sent[k] != v {
+					t.Fatalf("caller note %s = %q, want %q", k, sent[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestNoteValueLength(t *testing.T) {
+	long := strings.Repeat("a", 9)
+	tests := []struct {
+		name     string
+		overflow string
+		notes    map[string]string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{"within the limit", config.NoteOverflowReject, map[string]string{"k": "12345678"}, map[string]string{"k": "12345678"}, false},
+		{"rejected", config.NoteOverflowReject, map[string]string{"k": long}, nil, true},
+		{"truncated", config.NoteOverflowTruncate, map[string]string{"k": long}, map[string]string{"k": "aaaaaaaa"}, false},
+		// The limit counts characters, not bytes
+		{"multibyte within", config.NoteOverflowReject, map[string]string{"k": "₹₹₹₹₹₹₹₹"}, map[string]string{"k": "₹₹₹₹₹₹₹₹"}, false},
+		{"multibyte truncated", config.NoteOverflowTruncate, map[string]string{"k": "₹₹₹₹₹₹₹₹₹₹"}, map[string]string{"k": "₹₹₹₹₹₹₹₹"}, false},
+	}
+	for _, tt := range tests {
+		for _, op := range []string{"create", "update"} {
+			t.Run(tt.name+" on "+op, func(t *testing.T) {
+				gw := newFakeGateway()
+				cfg := testConfig(t)
+				cfg.NoteValueMaxLength = 8
+				cfg.NoteValueOverflow = tt.overflow
+				// Cut whatever the mode, as the caller did not send it
+				cfg.OrderDefaultNotes = map[string]string{"service_version": "1.4.0-rc.1+build"}
+				s, _ := newTestService(t, gw, cfg)
+				ctx := context.Background()
+				var buf bytes.Buffer
+				log.SetOutput(&buf)
+				defer log.SetOutput(os.Stderr)
+
+				var err error
+				id := "order_1"
+				if op == "create" {
+					_, err = s.CreateOrder(ctx, PaymentRequest{Amount: 50000, Notes: tt.notes})
+				} else {
+					id = createTestOrder(t, s, 50000)["id"].(string)
+					_, err = s.UpdateOrderNotes(ctx, id, OrderNotesRequest{Notes: tt.notes})
+				}
+				if tt.wantErr {
+					if !errors.Is(err, ErrNoteTooLong) || !strings.Contains(err.Error(), `"k"`) {
+						t.Fatalf("err = %v, want ErrNoteTooLong naming the note", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				sent, ok := gw.orders[id]["notes"].(map[string]string)
+				if !ok {
+					sent = stringNotes(gw.orders[id]["notes"])
+				}
+				for k, v := range tt.want {
+					if sent[k] != v {
+						t.Fatalf("note %s = %q, want %q", k, sent[k], v)
+					}
+				}
+				if v := sent["service_version"]; op == "create" && v != "1.4.0-rc" {
+					t.Fatalf("default note = %q, want it cut to the limit", v)
+				}
+				if cut := strings.Contains(buf.String(), `truncated note "k"`); cut != (tt.overflow == config.NoteOverflowTruncate) {
+					t.Fatalf("log = %q, want a warning only for a cut caller note", buf.String())
+				}
+				for k, v := range sent {
+					if utf8.RuneCountInString(v) > 8 {
+						t.Fatalf("note %s = %q sent over the limit", k, v)
+					}
+				}
+			})
+		}
+	}
+}
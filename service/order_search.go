@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Bounds of an order search
+const (
+	// noteSearchMaxLength is the longest note key or value searched for
+	noteSearchMaxLength = 256
+	// noteSearchMaxSkip bounds how deep a search may page
+	noteSearchMaxSkip = 10000
+)
+
+// OrderSearchRequest looks up local orders by a note, tags or both
+type OrderSearchRequest struct {
+	NoteKey   string
+	NoteValue string
+	Tags      []string
+	// Count is capped at 100 and defaults to 10
+	Count int
+	Skip  int
+}
+
+// OrderSearchPage is a page of local orders matching a search
+type OrderSearchPage struct {
+	Items      []Order         `json:"items"`
+	Pagination OrderPagination `json:"pagination"`
+}
+
+// SearchOrders returns the local orders whose note NoteKey is exactly
+// NoteValue and that carry every one of Tags, newest first
+func (s *Service) SearchOrders(ctx context.Context, req OrderSearchRequest) (OrderSearchPage, error) {
+	switch {
+	case (req.NoteKey == "") != (req.NoteValue == ""):
+		return OrderSearchPage{}, invalidRequest("note_key and note_value go together")
+	case req.NoteKey == "" && len(req.Tags) == 0:
+		return OrderSearchPage{}, invalidRequest("note_key and note_value, or tag, are required")
+	case utf8.RuneCountInString(req.NoteKey) > noteSearchMaxLength || utf8.RuneCountInString(req.NoteValue) > noteSearchMaxLength:
+		return OrderSearchPage{}, invalidRequest("note_key and note_value take at most %d characters", noteSearchMaxLength)
+	case req.Count < 0:
+		return OrderSearchPage{}, invalidRequest("count must be positive")
+	case req.Skip < 0 || req.Skip > noteSearchMaxSkip:
+		return OrderSearchPage{}, invalidRequest("skip must be between 0 and %d", noteSearchMaxSkip)
+	}
+	tags, err := s.vocabularyTags(req.Tags)
+	if err != nil {
+		return OrderSearchPage{}, err
+	}
+	if req.Count == 0 {
+		req.Count = defaultOrderPageSize
+	}
+	if req.Count > maxOrderPageSize {
+		req.Count = maxOrderPageSize
+	}
+
+	// One more than asked for tells whether another page follows
+	q := OrderQuery{NoteKey: req.NoteKey, NoteValue: req.NoteValue, Tags: tags}
+	orders, err := s.store.Search(ctx, q, req.Skip, req.Count+1)
+	if err != nil {
+		return OrderSearchPage{}, fmt.Errorf("search orders: %w", err)
+	}
+	page := OrderSearchPage{
+		Items:      orders,
+		Pagination: OrderPagination{Count: req.Count, Skip: req.Skip},
+	}
+	if len(orders) > req.Count {
+		page.Items = orders[:req.Count]
+		page.Pagination.HasMore = true
+		page.Pagination.NextSkip = req.Skip + req.Count
+	}
+	page.Pagination.Returned = len(page.Items)
+	return page, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchOrdersInvalid(t *testing.T) {
+	long := strings.Repeat("k", noteSearchMaxLength+1)
+	tests := []struct {
+		name string
+		req  OrderSearchRequest
+	}{
+		{"nothing to search for", OrderSearchRequest{}},
+		{"key without value", OrderSearchRequest{NoteKey: "user_id"}},
+		{"value without key", OrderSearchRequest{NoteValue: "u_1"}},
+		{"key too long", OrderSearchRequest{NoteKey: long, NoteValue: "u_1"}},
+		{"value too long", OrderSearchRequest{NoteKey: "user_id", NoteValue: long}},
+		{"negative count", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Count: -1}},
+		{"negative skip", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Skip: -1}},
+		{"skip too deep", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Skip: noteSearchMaxSkip + 1}},
+	}
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var invalid *ValidationError
+			if _, err := s.SearchOrders(context.Background(), tt.req); !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestSearchOrdersByNote(t *testing.T) {
+	s, clk := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	var ids []string
+	for i := 0; i < 5; i++ {
+		user := "u_1"
+		if i%2 == 1 {
+			user = "u_2"
+		}
+		order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 500, Notes: map[string]string{"user_id": user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, order["id"].(string))
+		clk.Advance(time.Minute)
+	}
+	// u_1 placed orders 0, 2 and 4, listed newest first
+	tests := []struct {
+		name     string
+		req      OrderSearchRequest
+		want     []string
+		hasMore  bool
+		nextSkip int
+	}{
+		{"all", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1"}, []string{ids[4], ids[2], ids[0]}, false, 0},
+		{"first page", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Count: 2}, []string{ids[4], ids[2]}, true, 2},
+		{"last page", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Count: 2, Skip: 2}, []string{ids[0]}, false, 0},
+		{"past the end", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Skip: 10}, nil, false, 0},
+		{"other value", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_2"}, []string{ids[3], ids[1]}, false, 0},
+		{"value prefix", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_"}, nil, false, 0},
+		{"absent key", OrderSearchRequest{NoteKey: "customer", NoteValue: "u_1"}, nil, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.SearchOrders(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range page.Items {
+				got = append(got, o.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("orders = %v, want %v", got, tt.want)
+			}
+			p := page.Pagination
+			if p.Returned != len(tt.want) || p.HasMore != tt.hasMore || p.NextSkip != tt.nextSkip || p.Skip != tt.req.Skip {
+				t.Fatalf("pagination = %+v, want %d returned, more %v, next %d", p, len(tt.want), tt.hasMore, tt.nextSkip)
+			}
+		})
+	}
+}
+
+func TestSearchOrdersCountCapped(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	for i := 0; i < maxOrderPageSize+1; i++ {
+		if err := s.store.Save(ctx, Order{ID: fmt.Sprintf("order_%d", i), Notes: map[string]string{"user_id": "u_1"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, err := s.SearchOrders(ctx, OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Count: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := page.Pagination; len(page.Items) != maxOrderPageSize || p.Count != maxOrderPageSize || !p.HasMore {
+		t.Fatalf("%d orders, pagination %+v, want a page of %d", len(page.Items), p, maxOrderPageSize)
+	}
+	page, _ = s.SearchOrders(ctx, OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1"})
+	if len(page.Items) != defaultOrderPageSize {
+		t.Fatalf("%d orders, want the default %d", len(page.Items), defaultOrderPageSize)
+	}
+}
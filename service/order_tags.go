@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Points in an order's life tag rules run at
+const (
+	TagOnCreated    = "created"
+	TagOnAuthorized = "authorized"
+)
+
+// tagPattern is what a tag in the vocabulary looks like, e.g. "vip" or
+// "chargeback-risk"
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// ErrUnknownTag is a tag outside TAG_VOCABULARY
+var ErrUnknownTag = errors.New("tag is not in the vocabulary")
+
+// TagRule tags orders automatically. Every condition set must hold.
+type TagRule struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	// On lists when the rule runs: TagOnCreated, TagOnAuthorized or an
+	// order status the order moves to
+	On []string `json:"on"`
+	// MinAmount and MaxAmount bound the amount in minor units; zero is open
+	MinAmount int `json:"min_amount,omitempty"`
+	MaxAmount int `json:"max_amount,omitempty"`
+	// Methods match the payment method, known once a payment is authorized
+	Methods []string `json:"methods,omitempty"`
+	// Notes must all be present on the order with these values; "*"
+	// matches any value. An absent note never matches.
+	Notes map[string]string `json:"notes,omitempty"`
+}
+
+// tagFacts is what tag rules are evaluated against
+type tagFacts struct {
+	On     string
+	Amount int
+	Method string
+	Notes  map[string]string
+}
+
+// OrderTagsRequest adds or removes tags on an order
+type OrderTagsRequest struct {
+	Tags []string `json:"tags" binding:"required,min=1"`
+}
+
+// loadTagRules reads and checks the rules at path against vocabulary. An
+// empty path yields no rules.
+func loadTagRules(path string, vocabulary []string) ([]TagRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []TagRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("tag rule %d: name is required", i)
+		}
+		if !slices.Contains(vocabulary, rule.Tag) {
+			return nil, fmt.Errorf("tag rule %q: %w: %q", rule.Name, ErrUnknownTag, rule.Tag)
+		}
+		if len(rule.On) == 0 {
+			return nil, fmt.Errorf("tag rule %q: on is required", rule.Name)
+		}
+		for _, on := range rule.On {
+			if _, status := orderTransitions[on]; !status && on != TagOnCreated && on != TagOnAuthorized {
+				return nil, fmt.Errorf("tag rule %q: cannot run on %q", rule.Name, on)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// checkVocabulary rejects tags that would not survive a URL query or CSV
+// column unescaped
+func checkVocabulary(vocabulary []string) error {
+	for _, tag := range vocabulary {
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: use lowercase letters, digits and dashes, at most 40", tag)
+		}
+	}
+	return nil
+}
+
+func (r TagRule) matches(f tagFacts) bool {
+	if !slices.Contains(r.On, f.On) {
+		return false
+	}
+	if r.MinAmount > 0 && f.Amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount > 0 && f.Amount > r.MaxAmount {
+		return false
+	}
+	if len(r.Methods) > 0 && !slices.Contains(r.Methods, f.Method) {
+		return false
+	}
+	for k, want := range r.Notes {
+		v, ok := f.Notes[k]
+		if !ok || (want != "*" && v != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagRulesHolder serves the current rules and swaps them on reload
+type tagRulesHolder struct {
+	path       string
+	vocabulary []string
+	current    atomic.Pointer[[]TagRule]
+}
+
+func newTagRulesHolder(path string, vocabulary []string) (*tagRulesHolder, error) {
+	if err := checkVocabulary(vocabulary); err != nil {
+		return nil, err
+	}
+	rules, err := loadTagRules(path, vocabulary)
+	if err != nil {
+		return nil, err
+	}
+	h := &tagRulesHolder{path: path, vocabulary: vocabulary}
+	h.current.Store(&rules)
+	return h, nil
+}
+
+// reload swaps in freshly loaded rules, keeping the previous ones when the
+// file fails to load
+func (h *tagRulesHolder) reload() error {
+	if h.path == "" {
+		return nil
+	}
+	rules, err := loadTagRules(h.path, h.vocabulary)
+	if err != nil {
+		return err
+	}
+	h.current.Store(&rules)
+	return nil
+}
+
+func (h *tagRulesHolder) rules() []TagRule {
+	return *h.current.Load()
+}
+
+// ReloadTagRules re-reads the tag rules file. The previous rules stay in
+// effect when the file fails to load.
+func (s *Service) ReloadTagRules() error {
+	return s.tagRules.reload()
+}
+
+// applyTagRules adds the tags of the rules matching f to order, recording
+// each on the timeline
+func (s *Service) applyTagRules(order *Order, f tagFacts) {
+	for _, rule := range s.tagRules.rules() {
+		if !rule.matches(f) {
+			continue
+		}
+		if order.addTags(rule.Tag) {
+			order.Timeline = append(order.Timeline, TimelineEntry{
+				At:      s.clock.Now(),
+				Type:    TimelineTag,
+				Author:  "rule:" + rule.Name,
+				Message: "tagged " + rule.Tag,
+			})
+			log.Printf("Tag rule %q tagged order %s %s on %s", rule.Name, order.ID, rule.Tag, f.On)
+		}
+	}
+}
+
+// tagAuthorized runs the authorized rules against an order once its payment
+// method is known
+func (s *Service) tagAuthorized(ctx context.Context, payment authorizedPayment) {
+	if payment.OrderID == "" || len(s.tagRules.rules()) == 0 {
+		return
+	}
+	_, err := s.store.Update(ctx, payment.OrderID, func(order *Order) error {
+		s.applyTagRules(order, tagFacts{On: TagOnAuthorized, Amount: order.Amount, Method: payment.Method, Notes: order.Notes})
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error tagging order %s: %v", payment.OrderID, err)
+	}
+}
+
+// TagOrder adds tags from the vocabulary to an order
+func (s *Service) TagOrder(ctx context.Context, orderID, author string, req OrderTagsRequest) (Order, error) {
+	tags, err := s.vocabularyTags(req.Tags)
+	if err != nil {
+		return Order{}, err
+	}
+	return s.store.Update(ctx, orderID, func(order *Order) error {
+		if order.addTags(tags...) {
+			s.timelineTags(order, author, "tagged", tags)
+		}
+		return nil
+	})
+}
+
+// UntagOrder removes tags from an order. Tags it does not carry are
+// ignored.
+func (s *Service) UntagOrder(ctx context.Context, orderID, author string, req OrderTagsRequest) (Order, error) {
+	tags, err := s.vocabularyTags(req.Tags)
+	if err != nil {
+		return Order{}, err
+	}
+	return s.store.Update(ctx, orderID, func(order *Order) error {
+		kept := order.Tags[:0:0]
+		for _, tag := range order.Tags {
+			if !slices.Contains(tags, tag) {
+				kept = append(kept, tag)
+			}
+		}
+		if len(kept) != len(order.Tags) {
+			order.Tags = kept
+			s.timelineTags(order, author, "untagged", tags)
+		}
+		return nil
+	})
+}
+
+// vocabularyTags lowercases tags and refuses any outside the vocabulary
+func (s *Service) vocabularyTags(requested []string) ([]string, error) {
+	tags := make([]string, 0, len(requested))
+	for _, tag := range requested {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !slices.Contains(s.cfg.TagVocabulary, tag) {
+			return nil, fmt.Errorf("%w: %q, use one of %s", ErrUnknownTag, tag, strings.Join(s.cfg.TagVocabulary, ", "))
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (s *Service) timelineTags(order *Order, author, verb string, tags []string) {
+	now := s.clock.Now()
+	order.Timeline = append(order.Timeline, TimelineEntry{
+		At:      now,
+		Type:    TimelineTag,
+		Author:  author,
+		Message: verb + " " + strings.Join(tags, ", "),
+	})
+	order.UpdatedAt = now
+}
+
+// addTags adds the tags the order does not carry yet, keeping Tags sorted,
+// and reports whether any was added
+func (o *Order) addTags(tags ...string) bool {
+	added := false
+	for _, tag := range tags {
+		if !slices.Contains(o.Tags, tag) {
+			o.Tags = append(o.Tags, tag)
+			added = true
+		}
+	}
+	sort.Strings(o.Tags)
+	return added
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testVocabulary = []string{"vip", "cod-conversion", "chargeback-risk", "big-card"}
+
+// tagService runs with testVocabulary and the tag rules in rules, if any
+func tagService(t *testing.T, rules string) *Service {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.TagVocabulary = testVocabulary
+	if rules != "" {
+		cfg.TagRulesFile = filepath.Join(t.TempDir(), "tag_rules.json")
+		if err := os.WriteFile(cfg.TagRulesFile, []byte(rules), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	return s
+}
+
+func TestTagRuleMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  TagRule
+		facts tagFacts
+		want  bool
+	}{
+		{"on matches", TagRule{On: []string{TagOnCreated}}, tagFacts{On: TagOnCreated}, true},
+		{"other point", TagRule{On: []string{TagOnCreated}}, tagFacts{On: TagOnAuthorized}, false},
+		{"above the minimum", TagRule{On: []string{TagOnCreated}, MinAmount: 1000}, tagFacts{On: TagOnCreated, Amount: 1000}, true},
+		{"below the minimum", TagRule{On: []string{TagOnCreated}, MinAmount: 1000}, tagFacts{On: TagOnCreated, Amount: 999}, false},
+		{"above the maximum", TagRule{On: []string{TagOnCreated}, MaxAmount: 1000}, tagFacts{On: TagOnCreated, Amount: 1001}, false},
+		{"method listed", TagRule{On: []string{TagOnAuthorized}, Methods: []string{"card"}}, tagFacts{On: TagOnAuthorized, Method: "card"}, true},
+		{"method not listed", TagRule{On: []string{TagOnAuthorized}, Methods: []string{"card"}}, tagFacts{On: TagOnAuthorized, Method: "upi"}, false},
+		{"method unknown yet", TagRule{On: []string{TagOnCreated}, Methods: []string{"card"}}, tagFacts{On: TagOnCreated}, false},
+		{"note value", TagRule{On: []string{TagOnCreated}, Notes: map[string]string{"segment": "vip"}}, tagFacts{On: TagOnCreated, Notes: map[string]string{"segment": "vip"}}, true},
+		{"other note value", TagRule{On: []string{TagOnCreated}, Notes: map[string]string{"segment": "vip"}}, tagFacts{On: TagOnCreated, Notes: map[string]string{"segment": "new"}}, false},
+		{"any note value", TagRule{On: []string{TagOnCreated}, Notes: map[string]string{"cod_order": "*"}}, tagFacts{On: TagOnCreated, Notes: map[string]string{"cod_order": ""}}, true},
+		{"absent note", TagRule{On: []string{TagOnCreated}, Notes: map[string]string{"segment": "vip"}}, tagFacts{On: TagOnCreated, Notes: map[string]string{"other": "vip"}}, false},
+		{"absent note with any value", TagRule{On: []string{TagOnCreated}, Notes: map[string]string{"cod_order": "*"}}, tagFacts{On: TagOnCreated}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.facts); got != tt.want {
+				t.Fatalf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTagRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{"valid", `[{"name": "vip", "tag": "vip", "on": ["created", "paid"], "min_amount": 100000}]`, ""},
+		{"tag outside the vocabulary", `[{"name": "typo", "tag": "vipp", "on": ["created"]}]`, "not in the vocabulary"},
+		{"no name", `[{"tag": "vip", "on": ["created"]}]`, "name is required"},
+		{"no on", `[{"name": "vip", "tag": "vip"}]`, "on is required"},
+		{"unknown point", `[{"name": "vip", "tag": "vip", "on": ["shipped"]}]`, "cannot run on"},
+		{"not JSON", `[`, "parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tag_rules.json")
+			if err := os.WriteFile(path, []byte(tt.rules), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadTagRules(path, testVocabulary)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one about %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := newTagRulesHolder("", []string{"VIP tier"}); err == nil {
+		t.Fatal("vocabulary with spaces and capitals loaded")
+	}
+}
+
+func TestTagRulesApplied(t *testing.T) {
+	s := tagService(t, `[
+		{"name": "big", "tag": "vip", "on": ["created"], "min_amount": 100000},
+		{"name": "cod", "tag": "cod-conversion", "on": ["created"], "notes": {"cod_order": "*"}},
+		{"name": "card", "tag": "big-card", "on": ["authorized"], "methods": ["card"], "min_amount": 100000},
+		{"name": "paid-risky", "tag": "chargeback-risk", "on": ["paid"], "notes": {"risk": "high"}}
+	]`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		amount  int
+		notes   map[string]string
+		method  string
+		created []string
+		paid    []string
+	}{
+		{"untagged", 500, nil, "upi", nil, nil},
+		{"big", 150000, nil, "upi", []string{"vip"}, []string{"vip"}},
+		{"cod", 500, map[string]string{"cod_order": "ORD-1"}, "upi", []string{"cod-conversion"}, []string{"cod-conversion"}},
+		{"big card", 150000, nil, "card", []string{"vip"}, []string{"big-card", "vip"}},
+		{"risky once paid", 500, map[string]string{"risk": "high"}, "upi", nil, []string{"chargeback-risk"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := s.CreateOrder(ctx, PaymentRequest{Amount: tt.amount, Notes: tt.notes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := order["id"].(string)
+			stored, _ := s.store.Get(ctx, id)
+			if !reflect.DeepEqual(stored.Tags, tt.created) {
+				t.Fatalf("tags on creation = %v, want %v", stored.Tags, tt.created)
+			}
+
+			s.tagAuthorized(ctx, authorizedPayment{ID: "pay_1", OrderID: id, Method: tt.method})
+			s.markOrderPaid(ctx, id, "pay_1")
+			stored, _ = s.store.Get(ctx, id)
+			if !reflect.DeepEqual(stored.Tags, tt.paid) {
+				t.Fatalf("tags once paid = %v, want %v", stored.Tags, tt.paid)
+			}
+			for _, e := range stored.Timeline {
+				if e.Type == TimelineTag && !strings.HasPrefix(e.Author, "rule:") {
+					t.Fatalf("timeline entry %+v, want rule tags authored by their rule", e)
+				}
+			}
+		})
+	}
+}
+
+func TestTagOrder(t *testing.T) {
+	s := tagService(t, "")
+	ctx := context.Background()
+	id := createTestOrder(t, s, 500)["id"].(string)
+
+	steps := []struct {
+		name    string
+		untag   bool
+		tags    []string
+		want    []string
+		wantErr error
+	}{
+		{"tagged", false, []string{"vip", "Chargeback-Risk "}, []string{"chargeback-risk", "vip"}, nil},
+		{"tagged again", false, []string{"vip"}, []string{"chargeback-risk", "vip"}, nil},
+		{"typo", false, []string{"vipp"}, []string{"chargeback-risk", "vip"}, ErrUnknownTag},
+		{"untagged", true, []string{"vip", "cod-conversion"}, []string{"chargeback-risk"}, nil},
+		{"untag typo", true, []string{"chargeback"}, []string{"chargeback-risk"}, ErrUnknownTag},
+	}
+	for _, st := range steps {
+		change := s.TagOrder
+		if st.untag {
+			change = s.UntagOrder
+		}
+		_, err := change(ctx, id, "admin:alice", OrderTagsRequest{Tags: st.tags})
+		if !errors.Is(err, st.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", st.name, err, st.wantErr)
+		}
+		stored, _ := s.store.Get(ctx, id)
+		if !reflect.DeepEqual(stored.Tags, st.want) {
+			t.Fatalf("%s: tags = %v, want %v", st.name, stored.Tags, st.want)
+		}
+	}
+
+	stored, _ := s.store.Get(ctx, id)
+	var entries []string
+	for _, e := range stored.Timeline {
+		if e.Type == TimelineTag {
+			entries = append(entries, e.Author+" "+e.Message)
+		}
+	}
+	if want := []string{"admin:alice tagged vip, chargeback-risk", "admin:alice untagged vip, cod-conversion"}; !reflect.DeepEqual(entries, want) {
+		t.Fatalf("timeline = %v, want only the changes %v", entries, want)
+	}
+	if _, err := s.TagOrder(ctx, "order_missing", "admin:alice", OrderTagsRequest{Tags: []string{"vip"}}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown order: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSearchOrdersByTag(t *testing.T) {
+	s := tagService(t, "")
+	ctx := context.Background()
+	var ids []string
+	for _, user := range []string{"u_1", "u_1", "u_2"} {
+		order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 500, Notes: map[string]string{"user_id": user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, order["id"].(string))
+	}
+	for i, tags := range [][]string{{"vip"}, {"vip", "chargeback-risk"}, {"vip"}} {
+		if _, err := s.TagOrder(ctx, ids[i], "admin:alice", OrderTagsRequest{Tags: tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		req     OrderSearchRequest
+		want    int
+		wantErr error
+	}{
+		{"one tag", OrderSearchRequest{Tags: []string{"vip"}}, 3, nil},
+		{"every tag", OrderSearchRequest{Tags: []string{"vip", "chargeback-risk"}}, 1, nil},
+		{"tag and note", OrderSearchRequest{NoteKey: "user_id", NoteValue: "u_1", Tags: []string{"vip"}}, 2, nil},
+		{"tag nobody carries", OrderSearchRequest{Tags: []string{"cod-conversion"}}, 0, nil},
+		{"unknown tag", OrderSearchRequest{Tags: []string{"vipp"}}, 0, ErrUnknownTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.SearchOrders(ctx, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(page.Items) != tt.want {
+				t.Fatalf("found %d orders, want %d", len(page.Items), tt.want)
+			}
+		})
+	}
+}
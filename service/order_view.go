@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Razorpay order statuses
+const (
+	RazorpayOrderCreated   = "created"
+	RazorpayOrderAttempted = "attempted"
+	RazorpayOrderPaid      = "paid"
+)
+
+// OrderView is the typed order of the v2 API. Unlike the raw passthrough,
+// created_at is an RFC3339 time and status one of the Razorpay order
+// statuses.
+type OrderView struct {
+	ID         string            `json:"id"`
+	Amount     int               `json:"amount"`
+	AmountPaid int               `json:"amount_paid"`
+	AmountDue  int               `json:"amount_due"`
+	Currency   string            `json:"currency"`
+	Receipt    string            `json:"receipt"`
+	Status     string            `json:"status"`
+	Attempts   int               `json:"attempts"`
+	Notes      map[string]string `json:"notes"`
+	CreatedAt  time.Time         `json:"created_at"`
+	// Stale and CachedAt are set when Razorpay was unreachable and the
+	// cached copy was served
+	Stale          bool            `json:"stale,omitempty"`
+	CachedAt       string          `json:"cached_at,omitempty"`
+	ManualOverride *StatusOverride `json:"manual_override,omitempty"`
+}
+
+// OrderView fetches the order like GetOrder and returns it typed
+func (s *Service) OrderView(ctx context.Context, id string) (OrderView, error) {
+	order, err := s.GetOrder(ctx, id)
+	if err != nil {
+		return OrderView{}, err
+	}
+	return OrderViewOf(order), nil
+}
+
+// OrderViewOf converts a raw Razorpay order. Unknown statuses are passed
+// through, with a warning so a new Razorpay status gets noticed.
+func OrderViewOf(order map[string]interface{}) OrderView {
+	v := OrderView{Notes: stringNotes(order["notes"])}
+	v.ID, _ = order["id"].(string)
+	v.Amount, _ = intField(order, "amount")
+	v.AmountPaid, _ = intField(order, "amount_paid")
+	v.AmountDue, _ = intField(order, "amount_due")
+	v.Currency, _ = order["currency"].(string)
+	v.Receipt, _ = order["receipt"].(string)
+	v.Attempts, _ = intField(order, "attempts")
+	if created, ok := intField(order, "created_at"); ok {
+		v.CreatedAt = time.Unix(int64(created), 0).UTC()
+	}
+
+	v.Status, _ = order["status"].(string)
+	switch v.Status {
+	case RazorpayOrderCreated, RazorpayOrderAttempted, RazorpayOrderPaid:
+	default:
+		log.Printf("WARNING: order %s has unknown Razorpay status %q", v.ID, v.Status)
+	}
+
+	v.Stale, _ = order["stale"].(bool)
+	v.CachedAt, _ = order["cached_at"].(string)
+	v.ManualOverride, _ = order["manual_override"].(*StatusOverride)
+	return v
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOrderViewOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		warned bool
+	}{
+		{"created", "created", false},
+		{"attempted", "attempted", false},
+		{"paid", "paid", false},
+		{"unknown passed through", "partially_refunded", true},
+		{"missing", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			// Decoded from Razorpay's JSON, so every number is a float64
+			v := OrderViewOf(map[string]interface{}{
+				"id":          "order_1",
+				"amount":      float64(50000),
+				"amount_paid": float64(0),
+				"amount_due":  float64(50000),
+				"currency":    "INR",
+				"receipt":     "rcpt_1",
+				"status":      tt.status,
+				"attempts":    float64(1),
+				"notes":       map[string]interface{}{"sku": "A-1"},
+				"created_at":  float64(1772445600),
+			})
+			if v.Status != tt.status {
+				t.Fatalf("status = %q, want %q passed through", v.Status, tt.status)
+			}
+			if warned := strings.Contains(buf.String(), "unknown Razorpay status"); warned != tt.warned {
+				t.Fatalf("log = %q, want a warning %v", buf.String(), tt.warned)
+			}
+			if v.Amount != 50000 || v.AmountDue != 50000 || v.Attempts != 1 || v.Notes["sku"] != "A-1" {
+				t.Fatalf("view = %+v, want the order's fields", v)
+			}
+
+			raw, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out map[string]interface{}
+			if err := json.Unmarshal(raw, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out["created_at"] != "2026-03-02T10:00:00Z" {
+				t.Fatalf("created_at = %v, want RFC 3339", out["created_at"])
+			}
+		})
+	}
+}
+
+func TestOrderViewOfWithoutCreatedAt(t *testing.T) {
+	v := OrderViewOf(map[string]interface{}{"id": "order_1", "status": "created"})
+	if !v.CreatedAt.IsZero() {
+		t.Fatalf("created_at = %s, want zero", v.CreatedAt)
+	}
+}
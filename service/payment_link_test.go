@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCreatePaymentLinkTheme(t *testing.T) {
+	tests := []struct {
+		name  string
+		theme *PaymentLinkTheme
+		// want is the options.checkout forwarded, nil for no options
+		want    map[string]interface{}
+		invalid bool
+	}{
+		{name: "no theme"},
+		{name: "empty theme", theme: &PaymentLinkTheme{}},
+		{name: "six digit color", theme: &PaymentLinkTheme{Color: "#3399cc"}, want: map[string]interface{}{"theme": map[string]string{"color": "#3399cc"}}},
+		{name: "three digit color", theme: &PaymentLinkTheme{Color: "#FC0"}, want: map[string]interface{}{"theme": map[string]string{"color": "#FC0"}}},
+		{name: "logo", theme: &PaymentLinkTheme{LogoURL: "https://cdn.example/logo.png"}, want: map[string]interface{}{"image": "https://cdn.example/logo.png"}},
+		{
+			name:  "both",
+			theme: &PaymentLinkTheme{Color: "#000000", LogoURL: "https://cdn.example/logo.png"},
+			want:  map[string]interface{}{"theme": map[string]string{"color": "#000000"}, "image": "https://cdn.example/logo.png"},
+		},
+		{name: "color name", theme: &PaymentLinkTheme{Color: "blue"}, invalid: true},
+		{name: "color without hash", theme: &PaymentLinkTheme{Color: "3399cc"}, invalid: true},
+		{name: "color of four digits", theme: &PaymentLinkTheme{Color: "#3399"}, invalid: true},
+		{name: "color not hex", theme: &PaymentLinkTheme{Color: "#33gg00"}, invalid: true},
+		{name: "logo over http", theme: &PaymentLinkTheme{LogoURL: "http://cdn.example/logo.png"}, invalid: true},
+		{name: "relative logo", theme: &PaymentLinkTheme{LogoURL: "/logo.png"}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			_, err := s.CreatePaymentLink(context.Background(), PaymentLinkRequest{Amount: 500, Description: "Spring sale", Theme: tt.theme})
+			var invalid *ValidationError
+			if tt.invalid {
+				if !errors.As(err, &invalid) || len(gw.links) != 0 {
+					t.Fatalf("err = %v with %d links created, want an invalid request", err, len(gw.links))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			options, ok := gw.links[0]["options"].(map[string]interface{})
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("options = %v, want none so the account defaults apply", options)
+				}
+				return
+			}
+			if !reflect.DeepEqual(options["checkout"], tt.want) {
+				t.Fatalf("options.checkout = %v, want %v", options["checkout"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// checkPaymentMatch asks Razorpay for paymentID and checks it was made
+// against orderID for the amount and currency the order was stored with,
+// so a genuine payment cannot be verified against another order. Orders
+// the store does not know are checked against tokenAmount, the amount
+// their order token was issued for.
+func (s *Service) checkPaymentMatch(ctx context.Context, orderID, paymentID string, tokenAmount int) error {
+	order, err := s.store.Get(ctx, orderID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		order = Order{ID: orderID, Amount: tokenAmount}
+	case err != nil:
+		return fmt.Errorf("load order %s: %w", orderID, err)
+	}
+
+	fetchCtx := ctx
+	if order.Provider != "" {
+		fetchCtx = gateway.WithAccount(ctx, order.Provider)
+	}
+	payment, err := s.gateway.FetchPayment(fetchCtx, paymentID)
+	var rejected *gateway.RequestError
+	switch {
+	case errors.As(err, &rejected):
+		return fmt.Errorf("%w: Razorpay does not know payment %s", ErrPaymentMismatch, paymentID)
+	case err != nil:
+		return fmt.Errorf("fetch payment %s: %w", paymentID, err)
+	}
+	if err := matchPayment(order, payment); err != nil {
+		log.Printf("Payment %s does not match order %s: %v%s", paymentID, orderID, err, authctx.LogFields(ctx))
+		return err
+	}
+	return nil
+}
+
+// matchPayment checks a payment fetched from Razorpay against the stored
+// order. An order with no currency, as for one known only by its token, is
+// not checked for it.
+func matchPayment(order Order, payment map[string]interface{}) error {
+	if paid, _ := payment["order_id"].(string); paid != order.ID {
+		return fmt.Errorf("%w: payment belongs to a different order", ErrPaymentMismatch)
+	}
+	amount, _ := intField(payment, "amount")
+	currency, _ := payment["currency"].(string)
+	if amount != order.Amount || (order.Currency != "" && !strings.EqualFold(currency, order.Currency)) {
+		return fmt.Errorf("%w: payment is %d %s, order is %d %s", ErrPaymentMismatch, amount, currency, order.Amount, order.Currency)
+	}
+	return nil
+}
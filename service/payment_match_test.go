@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+func TestVerifyPaymentMatchesStoredOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// pay records pay_1 on the fake gateway; nil leaves it unknown
+		pay      func(gw *fakeGateway, orderID string)
+		noFetch  bool
+		want     error
+		wantPaid bool
+	}{
+		{name: "matching", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", id, 500, "INR") }, wantPaid: true},
+		{name: "matching in another case", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", id, 500, "inr") }, wantPaid: true},
+		{name: "smaller amount", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", id, 100, "INR") }, want: ErrPaymentMismatch},
+		{name: "larger amount", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", id, 900, "INR") }, want: ErrPaymentMismatch},
+		{name: "other currency", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", id, 500, "USD") }, want: ErrPaymentMismatch},
+		{name: "paid against another order", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", "order_other", 500, "INR") }, want: ErrPaymentMismatch},
+		{name: "unknown to Razorpay", want: ErrPaymentMismatch},
+		{name: "fetch turned off", pay: func(gw *fakeGateway, id string) { gw.pay("pay_1", id, 100, "INR") }, noFetch: true, wantPaid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.VerifyPaymentFetch = !tt.noFetch
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, cfg)
+			ctx := context.Background()
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			if tt.pay != nil {
+				tt.pay(gw, orderID)
+			}
+			mismatches := testutil.ToFloat64(metrics.Verifications.WithLabelValues("payment_mismatch", metrics.Merchant("")))
+
+			_, err := s.VerifyPayment(ctx, PaymentVerificationRequest{
+				ServerOrderID:     orderID,
+				RazorpayPaymentID: "pay_1",
+				RazorpaySignature: paymentSignature(orderID, "pay_1", testSecret),
+				OrderToken:        order["order_token"].(string),
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if stored, _ := s.store.Get(ctx, orderID); (stored.Status == OrderPaid) != tt.wantPaid {
+				t.Fatalf("order %s, want paid %v", stored.Status, tt.wantPaid)
+			}
+			if tt.noFetch && gw.fetches != 0 {
+				t.Fatalf("%d payment fetches with VERIFY_PAYMENT_FETCH off", gw.fetches)
+			}
+			wantCounted := 0.0
+			if tt.want != nil {
+				wantCounted = 1
+			}
+			if n := testutil.ToFloat64(metrics.Verifications.WithLabelValues("payment_mismatch", metrics.Merchant(""))) - mismatches; n != wantCounted {
+				t.Fatalf("payment_verifications{payment_mismatch} rose by %v, want %v", n, wantCounted)
+			}
+		})
+	}
+}
+
+func TestRefusedPaymentNotRemembered(t *testing.T) {
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	ctx := context.Background()
+	order := createTestOrder(t, s, 500)
+	orderID := order["id"].(string)
+	req := PaymentVerificationRequest{
+		ServerOrderID:     orderID,
+		RazorpayPaymentID: "pay_1",
+		RazorpaySignature: paymentSignature(orderID, "pay_1", testSecret),
+		OrderToken:        order["order_token"].(string),
+	}
+
+	// Razorpay has not recorded the payment yet
+	if _, err := s.VerifyPayment(ctx, req); !errors.Is(err, ErrPaymentMismatch) {
+		t.Fatalf("err = %v, want ErrPaymentMismatch", err)
+	}
+	gw.pay("pay_1", orderID, 500, "INR")
+	if _, err := s.VerifyPayment(ctx, req); err != nil {
+		t.Fatalf("genuine retry: %v, want it verified", err)
+	}
+	if stored, _ := s.store.Get(ctx, orderID); stored.Status != OrderPaid || stored.PaymentID != "pay_1" {
+		t.Fatalf("order = %s %s, want paid by pay_1", stored.Status, stored.PaymentID)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// PaymentMethod is how a customer paid, or last tried to pay, for an order
+type PaymentMethod struct {
+	OrderID   string `json:"order_id"`
+	PaymentID string `json:"payment_id,omitempty"`
+	// Method is Razorpay's payment method, e.g. upi, card or netbanking.
+	// It is empty when no payment was attempted.
+	Method string `json:"method"`
+	// Status is the status of that payment
+	Status string `json:"status,omitempty"`
+	// Successful is set when the payment was authorized or captured, even
+	// if later refunded; otherwise the latest attempt is reported
+	Successful bool `json:"successful"`
+	// Attempts is the number of payments made against the order
+	Attempts int `json:"attempts"`
+}
+
+// OrderPaymentMethod reports the method of the order's successful payment,
+// or of its latest attempt when none succeeded
+func (s *Service) OrderPaymentMethod(ctx context.Context, orderID string) (PaymentMethod, error) {
+	collection, err := s.gateway.FetchOrderPayments(ctx, orderID)
+	if err != nil {
+		var rejected *gateway.RequestError
+		if errors.As(err, &rejected) {
+			return PaymentMethod{}, ErrNotFound
+		}
+		return PaymentMethod{}, fmt.Errorf("fetch payments of order %s: %w", orderID, err)
+	}
+
+	items, _ := collection["items"].([]interface{})
+	result := PaymentMethod{OrderID: orderID}
+	var chosen map[string]interface{}
+	for _, raw := range items {
+		payment, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		result.Attempts++
+		if chosen == nil || preferPayment(payment, chosen) {
+			chosen = payment
+		}
+	}
+	if chosen == nil {
+		return result, nil
+	}
+
+	result.PaymentID, _ = chosen["id"].(string)
+	result.Method, _ = chosen["method"].(string)
+	result.Status, _ = chosen["status"].(string)
+	result.Successful = successfulPayment(chosen)
+	return result, nil
+}
+
+// preferPayment reports whether a says more about the order than b: a
+// successful payment beats a failed one, then the later attempt wins
+func preferPayment(a, b map[string]interface{}) bool {
+	if sa, sb := successfulPayment(a), successfulPayment(b); sa != sb {
+		return sa
+	}
+	ca, _ := a["created_at"].(float64)
+	cb, _ := b["created_at"].(float64)
+	return ca > cb
+}
+
+// successfulPayment reports whether the customer's money was taken
+func successfulPayment(payment map[string]interface{}) bool {
+	status, _ := payment["status"].(string)
+	return status == "captured" || status == "authorized" || status == "refunded"
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOrderPaymentMethod(t *testing.T) {
+	// attempt is a payment made at created_at seconds
+	type attempt struct {
+		id, method, status string
+		createdAt          float64
+	}
+	tests := []struct {
+		name     string
+		attempts []attempt
+		want     PaymentMethod
+	}{
+		{"no attempts", nil, PaymentMethod{}},
+		{"captured", []attempt{{"pay_1", "upi", "captured", 1}}, PaymentMethod{PaymentID: "pay_1", Method: "upi", Status: "captured", Successful: true, Attempts: 1}},
+		{
+			"success beats a later failure",
+			[]attempt{{"pay_1", "card", "failed", 1}, {"pay_2", "upi", "captured", 2}, {"pay_3", "netbanking", "failed", 3}},
+			PaymentMethod{PaymentID: "pay_2", Method: "upi", Status: "captured", Successful: true, Attempts: 3},
+		},
+		{
+			"refunded still paid",
+			[]attempt{{"pay_1", "card", "refunded", 1}, {"pay_2", "upi", "failed", 2}},
+			PaymentMethod{PaymentID: "pay_1", Method: "card", Status: "refunded", Successful: true, Attempts: 2},
+		},
+		{
+			"latest failure",
+			[]attempt{{"pay_1", "card", "failed", 1}, {"pay_2", "netbanking", "failed", 3}, {"pay_3", "upi", "created", 2}},
+			PaymentMethod{PaymentID: "pay_2", Method: "netbanking", Status: "failed", Attempts: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			for _, a := range tt.attempts {
+				gw.payments[a.id] = map[string]interface{}{"id": a.id, "order_id": id, "method": a.method, "status": a.status, "created_at": a.createdAt}
+			}
+
+			got, err := s.OrderPaymentMethod(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.OrderID = id
+			if got != tt.want {
+				t.Fatalf("method = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderPaymentMethodUnknownOrder(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	if _, err := s.OrderPaymentMethod(context.Background(), "order_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+// Coarse payment states shown to token holders
+const (
+	PublicStatusPending  = "pending"
+	PublicStatusPaid     = "paid"
+	PublicStatusFailed   = "failed"
+	PublicStatusRefunded = "refunded"
+)
+
+// PaymentStatus is the little a status-token holder may learn about an order
+type PaymentStatus struct {
+	OrderID  string `json:"order_id"`
+	Status   string `json:"status"`
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Verification is the outcome of a successful payment verification
+type Verification struct {
+	// StatusToken lets the customer check the order's status later, e.g.
+	// from the post-checkout redirect
+	StatusToken string `json:"status_token"`
+}
+
+// issueStatusToken returns base64url("order_id|expiry").base64url(hmac),
+// an order-scoped credential for the public status endpoint
+func (s *Service) issueStatusToken(orderID string) string {
+	expiry := s.clock.Now().Add(s.cfg.StatusTokenTTL).Unix()
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", orderID, expiry)))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.signToken(purposeStatusToken, encoded))
+}
+
+// validStatusToken reports whether token is an unexpired status token for
+// orderID
+func (s *Service) validStatusToken(token, orderID string) bool {
+	encoded, sig, _ := strings.Cut(token, ".")
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	signed := err == nil && hmac.Equal(rawSig, s.signToken(purposeStatusToken, encoded))
+
+	payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+	id, exp, _ := strings.Cut(string(payload), "|")
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	return signed && err == nil &&
+		hmac.Equal([]byte(id), []byte(orderID)) &&
+		s.checkWindow(clock.Window{NotAfter: time.Unix(expiry, 0)}) == nil
+}
+
+// ValidStatusToken reports whether token is an unexpired status token for
+// orderID, for transports admitting the customer who paid the order
+func (s *Service) ValidStatusToken(token, orderID string) bool {
+	return s.validStatusToken(token, orderID)
+}
+
+// PaymentStatus returns the coarse status of an order to the holder of its
+// status token. A bad token and an unknown order both yield ErrNotFound,
+// and both do the same work, so neither can be told apart from outside.
+func (s *Service) PaymentStatus(ctx context.Context, orderID, token string) (PaymentStatus, error) {
+	valid := s.validStatusToken(token, orderID)
+	order, err := s.store.Get(ctx, orderID)
+	if !valid || err != nil {
+		return PaymentStatus{}, ErrNotFound
+	}
+
+	status := PublicStatusPending
+	switch order.Status {
+	case OrderPaid:
+		status = PublicStatusPaid
+	case OrderRefunded:
+		status = PublicStatusRefunded
+	case OrderFailed, OrderExpired:
+		status = PublicStatusFailed
+	}
+	return PaymentStatus{OrderID: order.ID, Status: status, Amount: order.Amount, Currency: order.Currency}, nil
+}
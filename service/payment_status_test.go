@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPaymentStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{OrderCreated, PublicStatusPending},
+		{OrderAbandoned, PublicStatusPending},
+		{OrderPaid, PublicStatusPaid},
+		{OrderRefunded, PublicStatusRefunded},
+		{OrderFailed, PublicStatusFailed},
+		{OrderExpired, PublicStatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+			ctx := context.Background()
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			if _, err := s.store.Update(ctx, id, func(o *Order) error {
+				o.Status = tt.status
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.PaymentStatus(ctx, id, s.issueStatusToken(id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := PaymentStatus{OrderID: id, Status: tt.want, Amount: 50000, Currency: "INR"}
+			if got != want {
+				t.Fatalf("status = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestPaymentStatusRefusesWithoutValidToken(t *testing.T) {
+	cfg := testConfig(t)
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	ctx := context.Background()
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	other := createTestOrder(t, s, 50000)["id"].(string)
+	orderToken, err := s.issueOrderToken(map[string]interface{}{"id": id, "amount": 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := s.issueStatusToken(id)
+	clk.Advance(cfg.StatusTokenTTL + 2*cfg.ClockSkewTolerance)
+	valid := s.issueStatusToken(id)
+
+	tests := []struct {
+		name    string
+		orderID string
+		token   string
+	}{
+		{"no token", id, ""},
+		{"garbage", id, "not-a-token"},
+		{"order token", id, orderToken},
+		{"token of another order", other, valid},
+		{"expired", id, expired},
+		{"unknown order", "order_missing", s.issueStatusToken("order_missing")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.PaymentStatus(ctx, tt.orderID, tt.token); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+	if _, err := s.PaymentStatus(ctx, id, valid); err != nil {
+		t.Fatalf("fresh token: %v", err)
+	}
+}
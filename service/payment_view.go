@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// PaymentView is a Razorpay payment normalized for reconciliation. Amounts
+// are integer minor units like everywhere else in the API.
+type PaymentView struct {
+	ID       string `json:"id"`
+	OrderID  string `json:"order_id"`
+	Status   string `json:"status"`
+	Method   string `json:"method"`
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	// Fee is Razorpay's fee including Tax, the tax charged on it. Both are
+	// null until Razorpay has computed the fee, typically on capture.
+	Fee *int `json:"fee"`
+	Tax *int `json:"tax"`
+	// FeeCurrency is the currency of Fee and Tax: the settlement currency,
+	// which differs from Currency for international payments
+	FeeCurrency string `json:"fee_currency,omitempty"`
+	// Net is Amount less Fee when both are in the same currency
+	Net       *int      `json:"net"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrderPayments is every payment attempted against an order
+type OrderPayments struct {
+	OrderID  string        `json:"order_id"`
+	Payments []PaymentView `json:"payments"`
+}
+
+// GetPayment fetches a payment from Razorpay and returns it normalized
+func (s *Service) GetPayment(ctx context.Context, paymentID string) (PaymentView, error) {
+	payment, err := s.gateway.FetchPayment(ctx, paymentID)
+	if err != nil {
+		var rejected *gateway.RequestError
+		if errors.As(err, &rejected) {
+			return PaymentView{}, ErrNotFound
+		}
+		return PaymentView{}, fmt.Errorf("fetch payment %s: %w", paymentID, err)
+	}
+	return PaymentViewOf(payment), nil
+}
+
+// OrderPayments lists the payments of an order, normalized
+func (s *Service) OrderPayments(ctx context.Context, orderID string) (OrderPayments, error) {
+	collection, err := s.gateway.FetchOrderPayments(ctx, orderID)
+	if err != nil {
+		var rejected *gateway.RequestError
+		if errors.As(err, &rejected) {
+			return OrderPayments{}, ErrNotFound
+		}
+		return OrderPayments{}, fmt.Errorf("fetch payments of order %s: %w", orderID, err)
+	}
+
+	result := OrderPayments{OrderID: orderID, Payments: []PaymentView{}}
+	items, _ := collection["items"].([]interface{})
+	for _, raw := range items {
+		if payment, ok := raw.(map[string]interface{}); ok {
+			result.Payments = append(result.Payments, PaymentViewOf(payment))
+		}
+	}
+	return result, nil
+}
+
+// PaymentViewOf converts a raw Razorpay payment. A null or missing fee or
+// tax stays nil rather than reading as zero.
+func PaymentViewOf(payment map[string]interface{}) PaymentView {
+	v := PaymentView{}
+	v.ID, _ = payment["id"].(string)
+	v.OrderID, _ = payment["order_id"].(string)
+	v.Status, _ = payment["status"].(string)
+	v.Method, _ = payment["method"].(string)
+	v.Amount, _ = intField(payment, "amount")
+	v.Currency, _ = payment["currency"].(string)
+	if created, ok := intField(payment, "created_at"); ok {
+		v.CreatedAt = time.Unix(int64(created), 0).UTC()
+	}
+
+	v.Fee = optionalInt(payment, "fee")
+	v.Tax = optionalInt(payment, "tax")
+	if v.Fee == nil && v.Tax == nil {
+		return v
+	}
+	v.FeeCurrency = v.Currency
+	if base, _ := payment["base_currency"].(string); base != "" {
+		v.FeeCurrency = base
+	}
+	if v.Fee != nil && v.FeeCurrency == v.Currency {
+		net := v.Amount - *v.Fee
+		v.Net = &net
+	}
+	return v
+}
+
+// optionalInt reads a numeric field that Razorpay may send as null
+func optionalInt(m map[string]interface{}, key string) *int {
+	n, ok := intField(m, key)
+	if !ok {
+		return nil
+	}
+	return &n
+}
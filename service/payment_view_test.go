@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intp(n int) *int { return &n }
+
+func TestPaymentViewOf(t *testing.T) {
+	base := func(extra map[string]interface{}) map[string]interface{} {
+		p := map[string]interface{}{
+			"id": "pay_1", "order_id": "order_1", "status": "captured", "method": "upi",
+			"amount": float64(50000), "currency": "INR", "created_at": float64(1772445600),
+		}
+		for k, v := range extra {
+			p[k] = v
+		}
+		return p
+	}
+	created := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payment map[string]interface{}
+		want    PaymentView
+	}{
+		{
+			"settled",
+			base(map[string]interface{}{"fee": float64(1180), "tax": float64(180)}),
+			PaymentView{ID: "pay_1", OrderID: "order_1", Status: "captured", Method: "upi", Amount: 50000, Currency: "INR",
+				Fee: intp(1180), Tax: intp(180), FeeCurrency: "INR", Net: intp(48820), CreatedAt: created},
+		},
+		{
+			"not yet settled",
+			base(map[string]interface{}{"fee": nil, "tax": nil}),
+			PaymentView{ID: "pay_1", OrderID: "order_1", Status: "captured", Method: "upi", Amount: 50000, Currency: "INR", CreatedAt: created},
+		},
+		{
+			"fee fields missing",
+			base(nil),
+			PaymentView{ID: "pay_1", OrderID: "order_1", Status: "captured", Method: "upi", Amount: 50000, Currency: "INR", CreatedAt: created},
+		},
+		{
+			"zero fee",
+			base(map[string]interface{}{"fee": float64(0), "tax": float64(0)}),
+			PaymentView{ID: "pay_1", OrderID: "order_1", Status: "captured", Method: "upi", Amount: 50000, Currency: "INR",
+				Fee: intp(0), Tax: intp(0), FeeCurrency: "INR", Net: intp(50000), CreatedAt: created},
+		},
+		{
+			"international",
+			base(map[string]interface{}{"currency": "USD", "amount": float64(1000), "base_currency": "INR", "fee": float64(2360), "tax": float64(360)}),
+			PaymentView{ID: "pay_1", OrderID: "order_1", Status: "captured", Method: "upi", Amount: 1000, Currency: "USD",
+				Fee: intp(2360), Tax: intp(360), FeeCurrency: "INR", CreatedAt: created},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PaymentViewOf(tt.payment); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("view = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Unsettled fees reach clients as null, not zero
+	raw, _ := json.Marshal(PaymentViewOf(map[string]interface{}{"id": "pay_1", "fee": nil}))
+	if !strings.Contains(string(raw), `"fee":null`) || !strings.Contains(string(raw), `"tax":null`) || !strings.Contains(string(raw), `"net":null`) {
+		t.Fatalf("encoded %s, want null fee, tax and net", raw)
+	}
+}
+
+func TestOrderPaymentsNormalized(t *testing.T) {
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, testConfig(t))
+	ctx := context.Background()
+	id := createTestOrder(t, s, 50000)["id"].(string)
+	gw.pay("pay_1", id, 50000, "INR")
+	gw.payments["pay_1"]["fee"], gw.payments["pay_1"]["tax"] = float64(1180), float64(180)
+
+	payments, err := s.OrderPayments(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments.Payments) != 1 || *payments.Payments[0].Fee != 1180 || *payments.Payments[0].Tax != 180 || *payments.Payments[0].Net != 48820 {
+		t.Fatalf("payments = %+v, want pay_1 with its fee and tax", payments)
+	}
+	empty := createTestOrder(t, s, 50000)["id"].(string)
+	if payments, err := s.OrderPayments(ctx, empty); err != nil || payments.Payments == nil || len(payments.Payments) != 0 {
+		t.Fatalf("unpaid order: %+v, %v, want an empty list", payments, err)
+	}
+	if _, err := s.OrderPayments(ctx, "order_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown order: err = %v, want ErrNotFound", err)
+	}
+
+	view, err := s.GetPayment(ctx, "pay_1")
+	if err != nil || view.Fee == nil || *view.Fee != 1180 {
+		t.Fatalf("payment = %+v, %v, want the fee", view, err)
+	}
+	if _, err := s.GetPayment(ctx, "pay_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown payment: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yash170603/golang_payment/money"
+)
+
+// receiptTemplateFile is the file a brand's ReceiptTemplateDir may hold to
+// replace the built-in receipt
+const receiptTemplateFile = "receipt.html"
+
+// defaultReceiptTemplate renders a ReceiptData when the order's brand has
+// no receipt template of its own
+var defaultReceiptTemplate = template.Must(template.New(receiptTemplateFile).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.OrderID}}</title>
+</head>
+<body>
+<h1>{{with .MerchantName}}{{.}} {{end}}Receipt</h1>
+<table>
+{{range .Lines}}<tr><th>{{.Label}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{with .SupportEmail}}<p>Questions? Contact <a href="mailto:{{.}}">{{.}}</a></p>{{end}}
+</body>
+</html>
+`))
+
+// ReceiptData is what a receipt shows of a paid order. Templates may use
+// the fields or range over Lines.
+type ReceiptData struct {
+	MerchantName string
+	SupportEmail string
+	OrderID      string
+	Receipt      string
+	PaymentID    string
+	// Amount is in minor units; FormattedAmount is in major units with the
+	// currency code, e.g. "INR 499.00"
+	Amount          int
+	Currency        string
+	FormattedAmount string
+	PaidAt          time.Time
+	// Lines are the labelled values in display order
+	Lines []ReceiptLine
+	// template is the brand's receipt template, nil for the built-in one
+	template *template.Template
+}
+
+// ReceiptLine is one labelled value of a receipt
+type ReceiptLine struct {
+	Label string
+	Value string
+}
+
+// Receipt returns the receipt of a paid order. The merchant is the order's
+// brand when it has one, else RECEIPT_MERCHANT_NAME.
+func (s *Service) Receipt(ctx context.Context, orderID string) (ReceiptData, error) {
+	order, err := s.store.Get(ctx, orderID)
+	if err != nil {
+		return ReceiptData{}, err
+	}
+	if order.Status != OrderPaid {
+		return ReceiptData{}, fmt.Errorf("%w: order %s is %s", ErrOrderNotPaid, orderID, order.Status)
+	}
+
+	r := ReceiptData{
+		MerchantName:    s.cfg.ReceiptMerchantName,
+		OrderID:         order.ID,
+		Receipt:         order.Receipt,
+		PaymentID:       order.PaymentID,
+		Amount:          order.Amount,
+		Currency:        order.Currency,
+		FormattedAmount: formatAmount(order.Currency, order.Amount),
+		PaidAt:          paidAt(order),
+	}
+	if s.brands != nil {
+		if brand, ok := s.brands.brands[order.Brand]; ok {
+			r.MerchantName = brand.DisplayName
+			r.SupportEmail = brand.SupportEmail
+			if r.template, err = loadReceiptTemplate(brand.ReceiptTemplateDir); err != nil {
+				return ReceiptData{}, fmt.Errorf("receipt template of brand %s: %w", brand.Name, err)
+			}
+		}
+	}
+
+	r.Lines = []ReceiptLine{
+		{Label: "Order", Value: r.OrderID},
+		{Label: "Receipt", Value: r.Receipt},
+		{Label: "Payment", Value: r.PaymentID},
+		{Label: "Amount", Value: r.FormattedAmount},
+		{Label: "Paid", Value: r.PaidAt.Format("2 Jan 2006 15:04 MST")},
+	}
+	if r.MerchantName != "" {
+		r.Lines = append([]ReceiptLine{{Label: "Merchant", Value: r.MerchantName}}, r.Lines...)
+	}
+	return r, nil
+}
+
+// loadReceiptTemplate parses the receipt template in dir. It is nil when
+// dir is empty or holds none.
+func loadReceiptTemplate(dir string) (*template.Template, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	path := filepath.Join(dir, receiptTemplateFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return template.ParseFiles(path)
+}
+
+// paidAt is when the order last became paid, its last update when the
+// timeline does not say
+func paidAt(order Order) time.Time {
+	for i := len(order.Timeline) - 1; i >= 0; i-- {
+		if e := order.Timeline[i]; e.Type == TimelineStatus && e.To == OrderPaid {
+			return e.At
+		}
+	}
+	return order.UpdatedAt
+}
+
+// formatAmount renders minor units in major units with the currency code
+func formatAmount(currency string, amount int) string {
+	exp := 2
+	if cur, ok := currencies[currency]; ok {
+		exp = cur.Exponent
+	}
+	return currency + " " + money.New(int64(amount), currency).Format(exp)
+}
+
+// RenderHTML writes the receipt as an HTML page
+func (r ReceiptData) RenderHTML(w io.Writer) error {
+	t := r.template
+	if t == nil {
+		t = defaultReceiptTemplate
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, r); err != nil {
+		return fmt.Errorf("render receipt: %w", err)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// RenderPDF writes the receipt as a one-page PDF of its lines
+func (r ReceiptData) RenderPDF(w io.Writer) error {
+	title := "Receipt"
+	if r.MerchantName != "" {
+		title = r.MerchantName + " Receipt"
+	}
+	lines := make([]string, 0, len(r.Lines)+1)
+	for _, l := range r.Lines {
+		lines = append(lines, l.Label+": "+l.Value)
+	}
+	if r.SupportEmail != "" {
+		lines = append(lines, "", "Questions? Contact "+r.SupportEmail)
+	}
+	return writeTextPDF(w, title, lines)
+}
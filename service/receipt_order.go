@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// receiptPattern is what Razorpay accepts as a receipt, at most 40
+// characters, narrowed to ones that survive a URL path segment unescaped
+var receiptPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,40}$`)
+
+// errStopList ends a ListAll walk once the wanted item is found
+var errStopList = errors.New("stop listing")
+
+// ReceiptConflictError is a receipt already used for a different amount
+type ReceiptConflictError struct {
+	Receipt         string
+	OrderID         string
+	ExistingAmount  int
+	RequestedAmount int
+}
+
+func (e *ReceiptConflictError) Error() string {
+	return fmt.Sprintf("receipt %s belongs to order %s for %d, not %d", e.Receipt, e.OrderID, e.ExistingAmount, e.RequestedAmount)
+}
+
+// ReceiptOrderRequest creates the order for a receipt unless it exists
+type ReceiptOrderRequest struct {
+	Amount int               `json:"amount"`
+	Notes  map[string]string `json:"notes"`
+}
+
+// ReceiptStore serialises work on a receipt and remembers the order it
+// created. A store shared between instances keeps two of them from each
+// creating an order for the same receipt, which Razorpay's receipt filter
+// may not list straight away.
+type ReceiptStore interface {
+	// Lock holds receipt until unlock is called, waiting for another
+	// holder to let go until ctx is done
+	Lock(ctx context.Context, receipt string) (unlock func(), err error)
+	// Order returns the ID of the order recorded for receipt, or
+	// ErrNotFound
+	Order(ctx context.Context, receipt string) (string, error)
+	// Record records orderID as the order of receipt
+	Record(ctx context.Context, receipt, orderID string) error
+}
+
+// WithReceiptStore makes the service lock and record receipts in store
+// instead of in memory
+func WithReceiptStore(store ReceiptStore) Option {
+	return func(s *Service) {
+		s.receipts = store
+	}
+}
+
+// MemoryReceiptStore is a ReceiptStore private to one process. It keeps no
+// records of its own: the process' order store already has them.
+type MemoryReceiptStore struct {
+	mu    sync.Mutex
+	locks map[string]*receiptLock
+}
+
+type receiptLock struct {
+	sync.Mutex
+	waiters int
+}
+
+func (l *MemoryReceiptStore) Lock(ctx context.Context, receipt string) (func(), error) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*receiptLock)
+	}
+	rl, ok := l.locks[receipt]
+	if !ok {
+		rl = &receiptLock{}
+		l.locks[receipt] = rl
+	}
+	rl.waiters++
+	l.mu.Unlock()
+
+	rl.Lock()
+	return func() {
+		rl.Unlock()
+		l.mu.Lock()
+		if rl.waiters--; rl.waiters == 0 {
+			delete(l.locks, receipt)
+		}
+		l.mu.Unlock()
+	}, nil
+}
+
+func (l *MemoryReceiptStore) Order(ctx context.Context, receipt string) (string, error) {
+	return "", ErrNotFound
+}
+
+func (l *MemoryReceiptStore) Record(ctx context.Context, receipt, orderID string) error {
+	return nil
+}
+
+// recordReceipt records the order created for receipt. A failure is only
+// logged: the order exists, and Razorpay's receipt filter finds it once it
+// is listed.
+func (s *Service) recordReceipt(ctx context.Context, receipt string, order map[string]interface{}) {
+	id, _ := order["id"].(string)
+	if err := s.receipts.Record(ctx, receipt, id); err != nil {
+		log.Printf("Error recording order %s for receipt %s: %v", id, receipt, err)
+	}
+}
+
+// OrderByReceipt returns the order for receipt, creating it when neither
+// the local store nor Razorpay's receipt filter knows it. created reports
+// which happened. An existing order for another amount is a
+// ReceiptConflictError. Concurrent calls for one receipt are serialised
+// through the ReceiptStore, so only one of them creates the order.
+func (s *Service) OrderByReceipt(ctx context.Context, receipt string, req ReceiptOrderRequest) (order map[string]interface{}, created bool, err error) {
+	if !receiptPattern.MatchString(receipt) {
+		return nil, false, invalidRequest("receipt must be 1-40 letters, digits, dots, dashes or underscores")
+	}
+	if err := validateAmount(s.cfg.DefaultCurrency, req.Amount); err != nil {
+		return nil, false, err
+	}
+
+	unlock, err := s.receipts.Lock(ctx, receipt)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock receipt %s: %w", receipt, err)
+	}
+	defer unlock()
+
+	order, err = s.findByReceipt(ctx, receipt)
+	switch {
+	case err == nil:
+		amount, _ := intField(order, "amount")
+		if amount != req.Amount {
+			id, _ := order["id"].(string)
+			return nil, false, &ReceiptConflictError{Receipt: receipt, OrderID: id, ExistingAmount: amount, RequestedAmount: req.Amount}
+		}
+	case errors.Is(err, ErrNotFound):
+		notes, err := s.orderNotes(req.Notes)
+		if err != nil {
+			return nil, false, err
+		}
+		if order, err = s.createOrder(ctx, orderParams{Amount: req.Amount, Receipt: receipt, Notes: notes}); err != nil {
+			return nil, false, err
+		}
+		s.recordReceipt(ctx, receipt, order)
+		created = true
+	default:
+		return nil, false, err
+	}
+
+	token, err := s.issueOrderToken(order)
+	if err != nil {
+		return nil, false, fmt.Errorf("issue order token: %w", err)
+	}
+	order["order_token"] = token
+	return order, created, nil
+}
+
+// CreateOrderOnce is CreateOrder made idempotent by receipt: when an order
+// already exists for receipt it is returned instead, with created false. An
+// existing order for another amount or currency is a ReceiptConflictError.
+func (s *Service) CreateOrderOnce(ctx context.Context, receipt string, req PaymentRequest) (order map[string]interface{}, created bool, err error) {
+	if !receiptPattern.MatchString(receipt) {
+		return nil, false, invalidRequest("idempotency key must be 1-40 letters, digits, dots, dashes or underscores")
+	}
+
+	unlock, err := s.receipts.Lock(ctx, receipt)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock receipt %s: %w", receipt, err)
+	}
+	defer unlock()
+
+	order, err = s.findByReceipt(ctx, receipt)
+	switch {
+	case err == nil:
+		amount, _ := intField(order, "amount")
+		currency, _ := order["currency"].(string)
+		if amount != req.Amount || (req.Currency != "" && strings.ToUpper(currency) != strings.ToUpper(req.Currency)) {
+			id, _ := order["id"].(string)
+			return nil, false, &ReceiptConflictError{Receipt: receipt, OrderID: id, ExistingAmount: amount, RequestedAmount: req.Amount}
+		}
+		token, err := s.issueOrderToken(order)
+		if err != nil {
+			return nil, false, fmt.Errorf("issue order token: %w", err)
+		}
+		order["order_token"] = token
+		return order, false, nil
+	case errors.Is(err, ErrNotFound):
+		if order, err = s.createRequestedOrder(ctx, req, receipt); err != nil {
+			return nil, false, err
+		}
+		s.recordReceipt(ctx, receipt, order)
+		return order, true, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// findByReceipt looks the receipt up locally first, then in the
+// ReceiptStore, then on Razorpay. An order found only upstream is recorded
+// locally for next time.
+func (s *Service) findByReceipt(ctx context.Context, receipt string) (map[string]interface{}, error) {
+	if local, err := s.store.GetByReceipt(ctx, receipt); err == nil {
+		return s.GetOrder(ctx, local.ID)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("look up receipt %s: %w", receipt, err)
+	}
+	if id, err := s.receipts.Order(ctx, receipt); err == nil {
+		return s.GetOrder(ctx, id)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("look up receipt %s: %w", receipt, err)
+	}
+
+	var found map[string]interface{}
+	err := s.gateway.ListAll(ctx, gateway.EntityOrders, map[string]interface{}{"receipt": receipt}, gateway.ListOptions{PageSize: 1}, func(item map[string]interface{}) error {
+		found = item
+		return errStopList
+	})
+	if err != nil && !errors.Is(err, errStopList) {
+		return nil, fmt.Errorf("look up receipt %s on Razorpay: %w", receipt, err)
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	s.orders.put(found)
+
+	id, _ := found["id"].(string)
+	amount, _ := intField(found, "amount")
+	currency, _ := found["currency"].(string)
+	now := s.clock.Now()
+	record := Order{
+		ID:        id,
+		Amount:    amount,
+		Currency:  s.defaultCurrency(currency),
+		Receipt:   receipt,
+		Status:    OrderCreated,
+		Notes:     stringNotes(found["notes"]),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Timeline:  []TimelineEntry{{At: now, Type: TimelineStatus, To: OrderCreated}},
+	}
+	if err := s.store.Save(ctx, record); err != nil {
+		log.Printf("Error saving order %s found by receipt: %v", id, err)
+	}
+	return found, nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// sharedReceipts is a ReceiptStore shared by several services, as a Redis
+// one is by several instances
+type sharedReceipts struct {
+	MemoryReceiptStore
+
+	mu      sync.Mutex
+	records map[string]string
+}
+
+func (r *sharedReceipts) Order(ctx context.Context, receipt string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.records[receipt]; ok {
+		return id, nil
+	}
+	return "", ErrNotFound
+}
+
+func (r *sharedReceipts) Record(ctx context.Context, receipt, orderID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[receipt] = orderID
+	return nil
+}
+
+func TestReceiptOrderCreatedOnceAcrossInstances(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(s *Service) (map[string]interface{}, bool, error)
+	}{
+		{"idempotency key", func(s *Service) (map[string]interface{}, bool, error) {
+			return s.CreateOrderOnce(context.Background(), "imp-42", PaymentRequest{Amount: 500, Currency: "INR"})
+		}},
+		{"by receipt", func(s *Service) (map[string]interface{}, bool, error) {
+			return s.OrderByReceipt(context.Background(), "imp-42", ReceiptOrderRequest{Amount: 500})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			receipts := &sharedReceipts{records: make(map[string]string)}
+			// Each instance has its own order store; only the receipts
+			// are shared
+			instances := make([]*Service, 4)
+			for i := range instances {
+				instances[i], _ = newTestService(t, gw, testConfig(t), WithReceiptStore(receipts))
+			}
+
+			var wg sync.WaitGroup
+			ids := make([]string, 2*len(instances))
+			created := make([]bool, len(ids))
+			for i := range ids {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					order, c, err := tt.create(instances[i%len(instances)])
+					if err != nil {
+						t.Errorf("call %d: %v", i, err)
+						return
+					}
+					ids[i], created[i] = order["id"].(string), c
+				}(i)
+			}
+			wg.Wait()
+
+			if gw.created != 1 {
+				t.Fatalf("%d orders created for one receipt", gw.created)
+			}
+			var creators int
+			for i, id := range ids {
+				if id != ids[0] {
+					t.Fatalf("call %d got order %s, call 0 got %s", i, id, ids[0])
+				}
+				if created[i] {
+					creators++
+				}
+			}
+			if creators != 1 {
+				t.Fatalf("%d calls report creating the order", creators)
+			}
+		})
+	}
+}
+
+func TestCreateOrderOnceConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		req  PaymentRequest
+		want bool
+	}{
+		{name: "same request", req: PaymentRequest{Amount: 500, Currency: "INR"}},
+		{name: "currency in lower case", req: PaymentRequest{Amount: 500, Currency: "inr"}},
+		{name: "currency left to the default", req: PaymentRequest{Amount: 500}},
+		{name: "other amount", req: PaymentRequest{Amount: 700, Currency: "INR"}, want: true},
+		{name: "other currency", req: PaymentRequest{Amount: 500, Currency: "USD"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+			if _, _, err := s.CreateOrderOnce(context.Background(), "imp-1", PaymentRequest{Amount: 500, Currency: "INR"}); err != nil {
+				t.Fatal(err)
+			}
+			_, created, err := s.CreateOrderOnce(context.Background(), "imp-1", tt.req)
+			var conflict *ReceiptConflictError
+			if got := errors.As(err, &conflict); got != tt.want {
+				t.Fatalf("err = %v, want conflict %v", err, tt.want)
+			}
+			if created {
+				t.Fatal("second call created an order")
+			}
+		})
+	}
+}
+
+func TestOrderByReceiptFormat(t *testing.T) {
+	tests := []struct {
+		receipt string
+		valid   bool
+	}{
+		{"INV-2026-001", true},
+		{"erp.doc_42", true},
+		{strings.Repeat("a", 40), true},
+		{strings.Repeat("a", 41), false},
+		{"", false},
+		{"inv 001", false},
+		{"inv/001", false},
+		{"inv;001", false},
+		{"₹001", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.receipt, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			_, _, err := s.OrderByReceipt(context.Background(), tt.receipt, ReceiptOrderRequest{Amount: 500})
+			var invalid *ValidationError
+			if got := !errors.As(err, &invalid); got != tt.valid {
+				t.Fatalf("err = %v, want valid %v", err, tt.valid)
+			}
+			if !tt.valid && gw.created != 0 {
+				t.Fatal("an order was created for an invalid receipt")
+			}
+		})
+	}
+}
+
+func TestOrderByReceiptAmounts(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	ctx := context.Background()
+	first, created, err := s.OrderByReceipt(ctx, "INV-1", ReceiptOrderRequest{Amount: 500})
+	if err != nil || !created {
+		t.Fatalf("first call: created %v, %v, want created", created, err)
+	}
+
+	again, created, err := s.OrderByReceipt(ctx, "INV-1", ReceiptOrderRequest{Amount: 500})
+	if err != nil || created || again["id"] != first["id"] {
+		t.Fatalf("same amount: order %v, created %v, %v, want %v returned", again["id"], created, err, first["id"])
+	}
+
+	_, _, err = s.OrderByReceipt(ctx, "INV-1", ReceiptOrderRequest{Amount: 700})
+	var conflict *ReceiptConflictError
+	if !errors.As(err, &conflict) || conflict.OrderID != first["id"] || conflict.ExistingAmount != 500 || conflict.RequestedAmount != 700 {
+		t.Fatalf("other amount: err = %v, want a conflict of 500 and 700", err)
+	}
+}
+
+// receiptFilterGateway is fakeGateway with Razorpay's receipt filter
+// answering for the orders it holds
+type receiptFilterGateway struct {
+	*fakeGateway
+}
+
+func (g receiptFilterGateway) ListAll(ctx context.Context, entity string, params map[string]interface{}, opts gateway.ListOptions, fn func(item map[string]interface{}) error) error {
+	g.mu.Lock()
+	var found []map[string]interface{}
+	for _, order := range g.orders {
+		if order["receipt"] == params["receipt"] {
+			found = append(found, copyMap(order))
+		}
+	}
+	g.mu.Unlock()
+	for _, order := range found {
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestOrderByReceiptFoundOnRazorpay(t *testing.T) {
+	gw := receiptFilterGateway{newFakeGateway()}
+	ctx := context.Background()
+	// The order was created by an instance that shares nothing with this one
+	other, _ := newTestService(t, gw, testConfig(t))
+	first, _, err := other.OrderByReceipt(ctx, "INV-9", ReceiptOrderRequest{Amount: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := newTestService(t, gw, testConfig(t))
+	order, created, err := s.OrderByReceipt(ctx, "INV-9", ReceiptOrderRequest{Amount: 500})
+	if err != nil || created || order["id"] != first["id"] {
+		t.Fatalf("order %v, created %v, %v, want %v found on Razorpay", order["id"], created, err, first["id"])
+	}
+	if gw.created != 1 {
+		t.Fatalf("%d orders created for one receipt", gw.created)
+	}
+	if local, err := s.store.GetByReceipt(ctx, "INV-9"); err != nil || local.ID != first["id"] {
+		t.Fatalf("local record = %v, %v, want the Razorpay order recorded", local.ID, err)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Key prefixes of receipt locks and records among other keys
+const (
+	redisReceiptLockPrefix  = "payments:receipt-lock:"
+	redisReceiptOrderPrefix = "payments:receipt:"
+)
+
+// redisReceiptPoll is how often a waiting Lock tries again
+const redisReceiptPoll = 50 * time.Millisecond
+
+// redisUnlock deletes a lock only while it still holds the caller's token,
+// so a lock that expired and was taken by another instance is left alone
+var redisUnlock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisReceiptStore is a ReceiptStore shared by every instance using the
+// same Redis. A lock expires after lockTTL even if its holder never lets
+// go, so a crashed instance cannot hold a receipt forever; lockTTL must
+// outlast creating an order. Records expire after recordTTL, by when
+// Razorpay's receipt filter lists the order.
+type RedisReceiptStore struct {
+	client    *redis.Client
+	lockTTL   time.Duration
+	recordTTL time.Duration
+}
+
+// NewRedisReceiptStore connects to the Redis at url, a redis:// or
+// rediss:// URL, and checks it answers
+func NewRedisReceiptStore(ctx context.Context, url string, lockTTL, recordTTL time.Duration) (*RedisReceiptStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return &RedisReceiptStore{client: client, lockTTL: lockTTL, recordTTL: recordTTL}, nil
+}
+
+// Lock takes the lock with SET NX PX under a random token, trying again
+// every redisReceiptPoll while another instance holds it
+func (r *RedisReceiptStore) Lock(ctx context.Context, receipt string) (func(), error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	key := redisReceiptLockPrefix + receipt
+
+	ticker := time.NewTicker(redisReceiptPoll)
+	defer ticker.Stop()
+	for {
+		locked, err := r.client.SetNX(ctx, key, token, r.lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		// The caller's context may be done by now; the lock still goes
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		redisUnlock.Run(ctx, r.client, []string{key}, token)
+	}, nil
+}
+
+func (r *RedisReceiptStore) Order(ctx context.Context, receipt string) (string, error) {
+	id, err := r.client.Get(ctx, redisReceiptOrderPrefix+receipt).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return id, err
+}
+
+func (r *RedisReceiptStore) Record(ctx context.Context, receipt, orderID string) error {
+	return r.client.Set(ctx, redisReceiptOrderPrefix+receipt, orderID, r.recordTTL).Err()
+}
+
+// Close closes the connection pool
+func (r *RedisReceiptStore) Close() error {
+	return r.client.Close()
+}
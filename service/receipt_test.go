@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// paidOrder creates an order of amount and marks it paid by pay_1
+func paidOrder(t *testing.T, s *Service, req PaymentRequest) string {
+	t.Helper()
+	order, err := s.CreateOrder(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := order["id"].(string)
+	s.markOrderPaid(context.Background(), id, "pay_1")
+	return id
+}
+
+func TestReceipt(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ReceiptMerchantName = "Acme Payments"
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+	ctx := context.Background()
+	paid := paidOrder(t, s, PaymentRequest{Amount: 49900})
+	unpaid := createTestOrder(t, s, 50000)["id"].(string)
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{"paid", paid, nil},
+		{"not paid", unpaid, ErrOrderNotPaid},
+		{"unknown", "order_missing", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.Receipt(ctx, tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.MerchantName != "Acme Payments" || r.PaymentID != "pay_1" || r.Receipt == "" || r.FormattedAmount != "INR 499.00" {
+				t.Fatalf("receipt = %+v", r)
+			}
+			if r.PaidAt.IsZero() || r.Lines[0] != (ReceiptLine{Label: "Merchant", Value: "Acme Payments"}) {
+				t.Fatalf("receipt = %+v, want when it was paid, headed by the merchant", r)
+			}
+
+			var html bytes.Buffer
+			if err := r.RenderHTML(&html); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"Acme Payments Receipt", tt.id, "pay_1", r.Receipt, "INR 499.00", "2 Mar 2026 10:00 UTC"} {
+				if !strings.Contains(html.String(), want) {
+					t.Fatalf("HTML receipt lacks %q:\n%s", want, html.String())
+				}
+			}
+
+			var pdf bytes.Buffer
+			if err := r.RenderPDF(&pdf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf.Bytes(), []byte("%%EOF\n")) {
+				t.Fatal("PDF receipt is not a PDF document")
+			}
+			for _, want := range []string{"(Acme Payments Receipt)", "(Payment: pay_1)", "(Amount: INR 499.00)"} {
+				if !bytes.Contains(pdf.Bytes(), []byte(want)) {
+					t.Fatalf("PDF receipt lacks %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiptUnnamedMerchant(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	r, err := s.Receipt(context.Background(), paidOrder(t, s, PaymentRequest{Amount: 500}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Lines[0].Label != "Order" {
+		t.Fatalf("lines = %+v, want no merchant line", r.Lines)
+	}
+	var html bytes.Buffer
+	if err := r.RenderHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "<h1>Receipt</h1>") {
+		t.Fatalf("HTML receipt = %s, want an unnamed heading", html.String())
+	}
+}
+
+func TestReceiptBranded(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, receiptTemplateFile), []byte(`<p>{{.MerchantName}} thanks you for {{.FormattedAmount}}</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	brands := `[{"name": "acme", "display_name": "Acme", "support_email": "help@acme.example.com", "receipt_template_dir": "` + dir + `"},
+		{"name": "zed", "display_name": "Zed <Store>", "support_email": "help@zed.example.com"}]`
+	b, err := LoadBrands(writeBrands(t, brands), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t)
+	cfg.ReceiptMerchantName = "Shared Account"
+	s, _ := newTestService(t, newFakeGateway(), cfg, WithBrands(b))
+
+	tests := []struct {
+		brand string
+		want  string
+	}{
+		{"acme", "<p>Acme thanks you for INR 5.00</p>"},
+		// The built-in template escapes what it shows
+		{"zed", "<h1>Zed &lt;Store&gt; Receipt</h1>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.brand, func(t *testing.T) {
+			r, err := s.Receipt(context.Background(), paidOrder(t, s, PaymentRequest{Amount: 500, Brand: tt.brand}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var html bytes.Buffer
+			if err := r.RenderHTML(&html); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(html.String(), tt.want) {
+				t.Fatalf("HTML receipt = %s, want %s", html.String(), tt.want)
+			}
+			if r.SupportEmail == "" || strings.Contains(html.String(), "Shared Account") {
+				t.Fatalf("receipt = %+v, want the brand's merchant and support email", r)
+			}
+		})
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Receipt", "Receipt"},
+		{"Acme (India)", `Acme \(India\)`},
+		{`C:\path`, `C:\\path`},
+		{"₹ 499", "? 499"},
+		{"line\nbreak", "line?break"},
+	}
+	for _, tt := range tests {
+		if got := pdfText(tt.in); got != tt.want {
+			t.Errorf("pdfText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
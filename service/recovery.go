@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// States of a payment recovery
+const (
+	RecoveryPending   = "pending"
+	RecoverySent      = "sent"
+	RecoverySkipped   = "skipped"
+	RecoveryConverted = "converted"
+)
+
+// recoverySendInterval is how often recoveries held by quiet hours are
+// checked for being due
+const recoverySendInterval = time.Minute
+
+// ist is the zone quiet hours are read in
+var ist = time.FixedZone("IST", 5*60*60+30*60)
+
+// PaymentRecovery is the follow-up of an order's first recoverable payment
+// failure, or of its abandoned checkout. Each order is followed up at most
+// once.
+type PaymentRecovery struct {
+	OrderID     string `json:"order_id"`
+	PaymentID   string `json:"payment_id,omitempty"`
+	ErrorCode   string `json:"error_code,omitempty"`
+	ErrorReason string `json:"error_reason,omitempty"`
+	// AbandonReason is set when the checkout was abandoned rather than a
+	// payment failing
+	AbandonReason string    `json:"abandon_reason,omitempty"`
+	Status        string    `json:"status"`
+	FailedAt      time.Time `json:"failed_at"`
+	// SendAt is when the link goes out, after quiet hours
+	SendAt time.Time  `json:"send_at"`
+	SentAt *time.Time `json:"sent_at,omitempty"`
+	PaidAt *time.Time `json:"paid_at,omitempty"`
+	// SkipReason says why a pending recovery was not sent
+	SkipReason string `json:"skip_reason,omitempty"`
+
+	email   string
+	contact string
+}
+
+// RecoveryReport is how recovery links converted for orders that failed
+// within a period. ConversionRate is converted out of sent, out of 100.
+type RecoveryReport struct {
+	From           time.Time      `json:"from"`
+	To             time.Time      `json:"to"`
+	Sent           int            `json:"sent"`
+	Converted      int            `json:"converted"`
+	Pending        int            `json:"pending"`
+	ConversionRate float64        `json:"conversion_rate"`
+	Skipped        map[string]int `json:"skipped"`
+}
+
+// paymentRecoveries holds the recoveries of recent orders by order ID
+type paymentRecoveries struct {
+	mu      sync.Mutex
+	byOrder map[string]*PaymentRecovery
+}
+
+// recoverPayment follows up a failed payment when recovery is enabled, the
+// failure is one the customer can get past and the order has not been
+// followed up before. The link goes out now, or once quiet hours end.
+func (s *Service) recoverPayment(ctx context.Context, payment failedPayment) {
+	if !s.cfg.PaymentRecoveryEnabled || payment.OrderID == "" {
+		return
+	}
+	if !slices.Contains(s.cfg.PaymentRecoveryReasons, payment.ErrorReason) &&
+		!slices.Contains(s.cfg.PaymentRecoveryReasons, payment.ErrorCode) {
+		return
+	}
+
+	now := s.clock.Now()
+	r := &PaymentRecovery{
+		OrderID:     payment.OrderID,
+		PaymentID:   payment.ID,
+		ErrorCode:   payment.ErrorCode,
+		ErrorReason: payment.ErrorReason,
+		Status:      RecoveryPending,
+		FailedAt:    now,
+		SendAt:      s.afterQuietHours(now),
+		email:       payment.Email,
+		contact:     payment.Contact,
+	}
+	s.recoveries.mu.Lock()
+	if _, seen := s.recoveries.byOrder[r.OrderID]; seen {
+		s.recoveries.mu.Unlock()
+		return
+	}
+	s.recoveries.byOrder[r.OrderID] = r
+	s.recoveries.mu.Unlock()
+
+	if r.SendAt.After(now) {
+		log.Printf("Payment recovery of order %s held for quiet hours until %s", r.OrderID, r.SendAt.In(ist).Format(time.RFC3339))
+		return
+	}
+	s.sendRecovery(ctx, r.OrderID)
+}
+
+// afterQuietHours is t, or the end of the quiet hours t falls in
+func (s *Service) afterQuietHours(t time.Time) time.Time {
+	start, end := s.cfg.PaymentRecoveryQuietStart, s.cfg.PaymentRecoveryQuietEnd
+	if start == end {
+		return t
+	}
+	local := t.In(ist)
+	hour := local.Hour()
+	quiet := hour >= start || hour < end
+	if start < end {
+		quiet = hour >= start && hour < end
+	}
+	if !quiet {
+		return t
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), end, 0, 0, 0, ist)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
+
+// sendRecovery publishes the recovery link of a pending recovery, unless
+// the order was paid, left its validity window or can no longer be paid
+// through its checkout session
+func (s *Service) sendRecovery(ctx context.Context, orderID string) {
+	order, err := s.store.Get(ctx, orderID)
+	reason := ""
+	switch {
+	case err != nil:
+		reason = "order_unknown"
+	case order.Status != OrderCreated && order.Status != OrderFailed && order.Status != OrderAbandoned:
+		reason = "order_" + order.Status
+	case !s.clock.Now().Before(order.CreatedAt.Add(s.cfg.PaymentRecoveryWindow)):
+		reason = "window_passed"
+	}
+	if session, ok := s.sessions.getByOrder(orderID); reason == "" && ok && session.Status == SessionExpired {
+		reason = "session_expired"
+	}
+
+	var link string
+	if reason == "" {
+		if link, err = s.recoveryLink(order); err != nil {
+			log.Printf("Error building recovery link for order %s: %v", orderID, err)
+			reason = "link_failed"
+		}
+	}
+
+	now := s.clock.Now()
+	s.recoveries.mu.Lock()
+	r, ok := s.recoveries.byOrder[orderID]
+	if !ok || r.Status != RecoveryPending {
+		s.recoveries.mu.Unlock()
+		return
+	}
+	if reason != "" {
+		r.Status, r.SkipReason = RecoverySkipped, reason
+	} else {
+		r.Status, r.SentAt = RecoverySent, &now
+	}
+	sent := *r
+	s.recoveries.mu.Unlock()
+
+	if reason != "" {
+		log.Printf("Payment recovery of order %s skipped: %s", orderID, reason)
+		return
+	}
+	data := map[string]interface{}{
+		"order_id":     orderID,
+		"payment_id":   sent.PaymentID,
+		"error_code":   sent.ErrorCode,
+		"error_reason": sent.ErrorReason,
+		"amount":       order.Amount,
+		"currency":     order.Currency,
+		"link":         link,
+		"brand":        order.Brand,
+	}
+	if sent.email != "" {
+		data["email"] = sent.email
+	}
+	if sent.contact != "" {
+		data["contact"] = sent.contact
+	}
+	if sent.AbandonReason != "" {
+		data["abandon_reason"] = sent.AbandonReason
+	}
+	s.notifier.Publish(notify.Event{
+		Type:       notify.EventPaymentRecovery,
+		Subject:    orderID,
+		Data:       data,
+		OccurredAt: now,
+	})
+	if sent.AbandonReason != "" {
+		log.Printf("Payment recovery of order %s sent after its checkout was abandoned (%s)", orderID, sent.AbandonReason)
+		return
+	}
+	log.Printf("Payment recovery of order %s sent after payment %s failed (%s)", orderID, sent.PaymentID, sent.ErrorReason)
+}
+
+// recoveryLink is PAYMENT_RECOVERY_URL with the order and a fresh order
+// token, and the checkout session when the order has one
+func (s *Service) recoveryLink(order Order) (string, error) {
+	token, err := s.issueOrderToken(map[string]interface{}{"id": order.ID, "amount": order.Amount})
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(s.cfg.PaymentRecoveryURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("order_id", order.ID)
+	q.Set("order_token", token)
+	if session, ok := s.sessions.getByOrder(order.ID); ok {
+		q.Set("session_id", session.ID)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// recoveryPaid counts a sent recovery as converted once its order is paid
+func (s *Service) recoveryPaid(orderID string) {
+	s.recoveries.mu.Lock()
+	defer s.recoveries.mu.Unlock()
+	r, ok := s.recoveries.byOrder[orderID]
+	if !ok {
+		return
+	}
+	switch r.Status {
+	case RecoverySent:
+		now := s.clock.Now()
+		r.Status, r.PaidAt = RecoveryConverted, &now
+	case RecoveryPending:
+		// Paid before the link went out, which is no longer needed
+		r.Status, r.SkipReason = RecoverySkipped, "order_paid"
+	}
+}
+
+// RecoveryReport summarises the recoveries of payments failed in [from, to)
+func (s *Service) RecoveryReport(from, to time.Time) (RecoveryReport, error) {
+	if !from.Before(to) {
+		return RecoveryReport{}, invalidRequest("from must be before to")
+	}
+	report := RecoveryReport{From: from.UTC(), To: to.UTC(), Skipped: map[string]int{}}
+
+	s.recoveries.mu.Lock()
+	for _, r := range s.recoveries.byOrder {
+		if r.FailedAt.Before(from) || !r.FailedAt.Before(to) {
+			continue
+		}
+		switch r.Status {
+		case RecoveryPending:
+			report.Pending++
+		case RecoverySkipped:
+			report.Skipped[r.SkipReason]++
+		case RecoverySent:
+			report.Sent++
+		case RecoveryConverted:
+			report.Sent++
+			report.Converted++
+		}
+	}
+	s.recoveries.mu.Unlock()
+
+	if report.Sent > 0 {
+		report.ConversionRate = percent(report.Converted, report.Sent)
+	}
+	return report, nil
+}
+
+// startRecoverySender sends recoveries held by quiet hours once due, and
+// forgets recoveries older than the funnel retention
+func (s *Service) startRecoverySender() {
+	s.recoveries = &paymentRecoveries{byOrder: make(map[string]*PaymentRecovery)}
+	if !s.cfg.PaymentRecoveryEnabled {
+		return
+	}
+	s.runners.Add("recovery-sender", runner.Every(recoverySendInterval, func() {
+		for _, orderID := range s.dueRecoveries() {
+			s.sendRecovery(context.Background(), orderID)
+		}
+	}))
+}
+
+// dueRecoveries lists the orders whose pending recovery is due, dropping
+// recoveries past the retention
+func (s *Service) dueRecoveries() []string {
+	now := s.clock.Now()
+	cutoff := now.Add(-s.cfg.FunnelRetention)
+	var due []string
+	s.recoveries.mu.Lock()
+	defer s.recoveries.mu.Unlock()
+	for id, r := range s.recoveries.byOrder {
+		if s.cfg.FunnelRetention > 0 && r.FailedAt.Before(cutoff) {
+			delete(s.recoveries.byOrder, id)
+			continue
+		}
+		if r.Status == RecoveryPending && !now.Before(r.SendAt) {
+			due = append(due, id)
+		}
+	}
+	return due
+}
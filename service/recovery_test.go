@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// recoveryEvent waits up to d for ch's next payment.recovery event
+func recoveryEvent(ch *recordingChannel, d time.Duration) (notify.Event, bool) {
+	timeout := time.After(d)
+	for {
+		select {
+		case ev := <-ch.events:
+			if ev.Type == notify.EventPaymentRecovery {
+				return ev, true
+			}
+		case <-timeout:
+			return notify.Event{}, false
+		}
+	}
+}
+
+func recoveryService(t *testing.T, enabled bool) (*Service, *recordingChannel, *fakeGateway, func(time.Time)) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookReorderDelay = 0
+	cfg.PaymentRecoveryEnabled = enabled
+	cfg.PaymentRecoveryURL = "https://shop.example.com/pay?ref=email"
+	ch := &recordingChannel{events: make(chan notify.Event, 20)}
+	n := notify.New(notify.Options{}, ch)
+	t.Cleanup(func() { n.Shutdown(context.Background()) })
+	gw := newFakeGateway()
+	s, clk := newTestService(t, gw, cfg, WithNotifier(n))
+	return s, ch, gw, clk.Set
+}
+
+func TestAfterQuietHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		at         string
+		want       string
+	}{
+		{"before wrapping quiet hours", 21, 9, "2026-03-02T20:59:00+05:30", "2026-03-02T20:59:00+05:30"},
+		{"evening", 21, 9, "2026-03-02T22:30:00+05:30", "2026-03-03T09:00:00+05:30"},
+		{"small hours", 21, 9, "2026-03-03T03:00:00+05:30", "2026-03-03T09:00:00+05:30"},
+		{"quiet hours over", 21, 9, "2026-03-03T09:00:00+05:30", "2026-03-03T09:00:00+05:30"},
+		// Read in IST whatever the zone of the failure
+		{"UTC evening", 21, 9, "2026-03-02T16:00:00Z", "2026-03-03T09:00:00+05:30"},
+		{"within the same day", 13, 14, "2026-03-02T13:15:00+05:30", "2026-03-02T14:00:00+05:30"},
+		{"outside the same day", 13, 14, "2026-03-02T12:15:00+05:30", "2026-03-02T12:15:00+05:30"},
+		{"no quiet hours", 0, 0, "2026-03-02T03:00:00+05:30", "2026-03-02T03:00:00+05:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.PaymentRecoveryQuietStart, cfg.PaymentRecoveryQuietEnd = tt.start, tt.end
+			s, _ := newTestService(t, newFakeGateway(), cfg)
+			at, _ := time.Parse(time.RFC3339, tt.at)
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if got := s.afterQuietHours(at); !got.Equal(want) {
+				t.Fatalf("afterQuietHours(%s) = %s, want %s", at, got, want)
+			}
+		})
+	}
+}
+
+func TestRecoverPayment(t *testing.T) {
+	// 10:00 UTC is 15:30 IST, outside the default quiet hours
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		enabled  bool
+		reason   string
+		paid     bool
+		after    time.Duration
+		sent     bool
+		skip     string
+		recorded bool
+	}{
+		{"recoverable", true, "insufficient_funds", false, 0, true, "", true},
+		{"fraud decline", true, "payment_risk_check_failed", false, 0, false, "", false},
+		{"disabled", false, "insufficient_funds", false, 0, false, "", false},
+		{"already paid", true, "payment_timed_out", true, 0, false, "order_paid", true},
+		{"window passed", true, "payment_timed_out", false, 48 * time.Hour, false, "window_passed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ch, _, set := recoveryService(t, tt.enabled)
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			if tt.paid {
+				s.markOrderPaid(context.Background(), id, "pay_0")
+			}
+			set(start.Add(tt.after))
+
+			// A second failure of the order is not followed up again
+			for i, paymentID := range []string{"pay_1", "pay_2"} {
+				body := `{"event":"payment.failed","payload":{"payment":{"entity":{"id":"` + paymentID + `","order_id":"` + id +
+					`","error_code":"BAD_REQUEST_ERROR","error_reason":"` + tt.reason + `","email":"asha@example.com","contact":"+919999999999"}}}}`
+				if err := deliver(t, s, body, fmt.Sprintf("evt_%d", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			drainWebhooks(t, s)
+
+			ev, sent := recoveryEvent(ch, 50*time.Millisecond)
+			if sent != tt.sent {
+				t.Fatalf("recovery sent = %v, want %v", sent, tt.sent)
+			}
+			s.recoveries.mu.Lock()
+			r, recorded := s.recoveries.byOrder[id]
+			s.recoveries.mu.Unlock()
+			if recorded != tt.recorded {
+				t.Fatalf("recovery recorded = %v, want %v", recorded, tt.recorded)
+			}
+			if tt.skip != "" && (r.Status != RecoverySkipped || r.SkipReason != tt.skip) {
+				t.Fatalf("recovery = %+v, want skipped for %s", r, tt.skip)
+			}
+			if !sent {
+				return
+			}
+
+			if r.Status != RecoverySent || r.PaymentID != "pay_1" || r.SentAt == nil {
+				t.Fatalf("recovery = %+v, want sent for the first failure", r)
+			}
+			if ev.Subject != id || ev.Data["email"] != "asha@example.com" || ev.Data["contact"] != "+919999999999" || ev.Data["amount"] != 50000 {
+				t.Fatalf("event = %+v, want the order and the customer's contact details", ev)
+			}
+			link, err := url.Parse(ev.Data["link"].(string))
+			if err != nil || link.Host != "shop.example.com" || link.Query().Get("ref") != "email" || link.Query().Get("order_id") != id {
+				t.Fatalf("link = %v, want the recovery URL for the order", ev.Data["link"])
+			}
+			if _, err := s.verifyOrderToken(link.Query().Get("order_token"), id); err != nil {
+				t.Fatalf("link token: %v, want a valid order token", err)
+			}
+
+			if ev, again := recoveryEvent(ch, 50*time.Millisecond); again {
+				t.Fatalf("sent %+v, want the order followed up once", ev)
+			}
+		})
+	}
+}
+
+func TestRecoveryHeldForQuietHours(t *testing.T) {
+	s, ch, _, set := recoveryService(t, true)
+	ctx := context.Background()
+	held := createTestOrder(t, s, 50000)["id"].(string)
+	paid := createTestOrder(t, s, 50000)["id"].(string)
+
+	// 17:00 UTC is 22:30 IST
+	set(time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC))
+	for _, id := range []string{held, paid} {
+		s.recoverPayment(ctx, failedPayment{ID: "pay_" + id, OrderID: id, ErrorReason: "insufficient_funds"})
+	}
+	if ev, ok := recoveryEvent(ch, 50*time.Millisecond); ok {
+		t.Fatalf("sent %+v during quiet hours", ev)
+	}
+	if due := s.dueRecoveries(); len(due) != 0 {
+		t.Fatalf("due = %v during quiet hours, want none", due)
+	}
+	s.markOrderPaid(ctx, paid, "pay_later")
+
+	// 03:30 UTC is 09:00 IST
+	set(time.Date(2026, 3, 3, 3, 30, 0, 0, time.UTC))
+	due := s.dueRecoveries()
+	if len(due) != 1 || due[0] != held {
+		t.Fatalf("due = %v, want only the unpaid %s", due, held)
+	}
+	for _, id := range due {
+		s.sendRecovery(ctx, id)
+	}
+	ev, ok := recoveryEvent(ch, time.Second)
+	if !ok || ev.Subject != held {
+		t.Fatalf("sent %+v, want the held recovery of %s", ev, held)
+	}
+}
+
+func TestRecoveryReport(t *testing.T) {
+	s, _, _, set := recoveryService(t, true)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	var orders []string
+	for i := 0; i < 5; i++ {
+		orders = append(orders, createTestOrder(t, s, 50000)["id"].(string))
+	}
+	fail := func(id string) {
+		s.recoverPayment(ctx, failedPayment{ID: "pay_" + id, OrderID: id, ErrorReason: "payment_timed_out"})
+	}
+
+	// Two sent, one of them then paid
+	fail(orders[0])
+	fail(orders[1])
+	s.markOrderPaid(ctx, orders[0], "pay_retry")
+	// One skipped, paid before its link went out
+	s.markOrderPaid(ctx, orders[2], "pay_other")
+	fail(orders[2])
+	// One held by quiet hours
+	set(start.Add(7 * time.Hour))
+	fail(orders[3])
+	// One failed outside the period
+	set(start.Add(72 * time.Hour))
+	fail(orders[4])
+
+	report, err := s.RecoveryReport(start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RecoveryReport{From: start, To: start.Add(24 * time.Hour), Sent: 2, Converted: 1, Pending: 1, ConversionRate: 50, Skipped: map[string]int{"order_paid": 1}}
+	if report.Sent != want.Sent || report.Converted != want.Converted || report.Pending != want.Pending ||
+		report.ConversionRate != want.ConversionRate || len(report.Skipped) != 1 || report.Skipped["order_paid"] != 1 {
+		t.Fatalf("report = %+v, want %+v", report, want)
+	}
+
+	if _, err := s.RecoveryReport(start, start); err == nil {
+		t.Fatal("report of an empty period succeeded")
+	}
+}
@@ -0,0 +1,104 @@
+//go:build integration
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisURL is the Redis the integration tests run against, from
+// TEST_REDIS_URL; they are skipped without one
+func redisURL(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	return url
+}
+
+func TestRedisReplayStoreClaimsOnce(t *testing.T) {
+	store, err := NewRedisReplayStore(context.Background(), redisURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	paymentID := fmt.Sprintf("pay_it_%d", time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claims := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v := VerifiedPayment{OrderID: "order_1", IdempotencyKey: fmt.Sprint(i), VerifiedAt: time.Now()}
+			_, claimed, err := store.Claim(context.Background(), paymentID, v, time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if claimed {
+				mu.Lock()
+				claims++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if claims != 1 {
+		t.Fatalf("%d claims of one payment succeeded", claims)
+	}
+}
+
+func TestRedisReceiptStore(t *testing.T) {
+	store, err := NewRedisReceiptStore(context.Background(), redisURL(t), time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	receipt := fmt.Sprintf("it-%d", time.Now().UnixNano())
+	ctx := context.Background()
+
+	if _, err := store.Order(ctx, receipt); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Order of a new receipt: %v", err)
+	}
+	if err := store.Record(ctx, receipt, "order_1"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := store.Order(ctx, receipt); err != nil || id != "order_1" {
+		t.Fatalf("Order = %q, %v", id, err)
+	}
+
+	unlock, err := store.Lock(ctx, receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := store.Lock(waitCtx, receipt); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second Lock while held: %v", err)
+	}
+	unlock()
+	unlock2, err := store.Lock(ctx, receipt)
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlock2()
+
+	// A holder that never lets go loses the lock after lockTTL
+	if _, err := store.Lock(ctx, receipt); err != nil {
+		t.Fatal(err)
+	}
+	expiryCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if _, err := store.Lock(expiryCtx, receipt); err != nil {
+		t.Fatalf("Lock after the holder's lock expired: %v", err)
+	}
+}
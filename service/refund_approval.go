@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// States of a refund awaiting approval
+const (
+	RefundPendingApproval = "pending_approval"
+	RefundApproved        = "approved"
+	RefundRejected        = "rejected"
+)
+
+// refundApprovalSweepInterval is how often pending approvals are checked for
+// expiry
+const refundApprovalSweepInterval = time.Minute
+
+// Refund approval errors
+var (
+	ErrApprovalClosed = errors.New("refund approval already decided")
+	// ErrSelfApproval is the requester of a refund deciding on it
+	ErrSelfApproval = errors.New("a refund must be decided by someone other than its requester")
+)
+
+// RefundApproval is a refund over the approval threshold, held until a
+// second admin approves or rejects it. Razorpay is only called on approval.
+type RefundApproval struct {
+	ID          string        `json:"id"`
+	Request     RefundRequest `json:"request"`
+	Status      string        `json:"status"`
+	RequestedBy string        `json:"requested_by"`
+	RequestedAt time.Time     `json:"requested_at"`
+	// ExpiresAt is when the approval is rejected if still undecided
+	ExpiresAt time.Time  `json:"expires_at"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	// RefundID is the Razorpay refund created on approval
+	RefundID string `json:"refund_id,omitempty"`
+}
+
+// refundApprovals holds refunds awaiting approval
+type refundApprovals struct {
+	mu        sync.Mutex
+	approvals map[string]*RefundApproval
+}
+
+// RequestRefund refunds req, or holds it for approval when its amount is
+// over RefundApprovalThreshold. Exactly one of the refund and the approval
+// is returned on success.
+func (s *Service) RequestRefund(ctx context.Context, req RefundRequest) (map[string]interface{}, *RefundApproval, error) {
+	if s.cfg.RefundApprovalThreshold <= 0 || req.Amount <= s.cfg.RefundApprovalThreshold {
+		refund, err := s.RefundPayment(ctx, req)
+		return refund, nil, err
+	}
+	if err := validateAmount(s.defaultCurrency(req.Currency), req.Amount); err != nil {
+		return nil, nil, err
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, err
+	}
+	requester, _ := authctx.Principal(ctx)
+	now := s.clock.Now()
+	a := &RefundApproval{
+		ID:          "rfa_" + hex.EncodeToString(b),
+		Request:     req,
+		Status:      RefundPendingApproval,
+		RequestedBy: requester.String(),
+		RequestedAt: now,
+		ExpiresAt:   now.Add(s.cfg.RefundApprovalTTL),
+	}
+	s.refundApprovals.mu.Lock()
+	s.refundApprovals.approvals[a.ID] = a
+	s.refundApprovals.mu.Unlock()
+
+	log.Printf("Refund approval %s: %d %s of payment %s requested by %s, over the %d threshold",
+		a.ID, req.Amount, s.defaultCurrency(req.Currency), req.PaymentID, a.RequestedBy, s.cfg.RefundApprovalThreshold)
+	s.publishApproval(notify.EventRefundApprovalRequested, *a)
+	return nil, a, nil
+}
+
+// PendingRefunds lists the refunds awaiting approval, oldest first
+func (s *Service) PendingRefunds() []RefundApproval {
+	s.refundApprovals.mu.Lock()
+	defer s.refundApprovals.mu.Unlock()
+
+	pending := []RefundApproval{}
+	for _, a := range s.refundApprovals.approvals {
+		if a.Status == RefundPendingApproval {
+			pending = append(pending, *a)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].RequestedAt.Before(pending[j].RequestedAt) })
+	return pending
+}
+
+// ApproveRefund makes a held refund with Razorpay. The approver, taken from
+// ctx, must not be the requester.
+func (s *Service) ApproveRefund(ctx context.Context, id string, d ReviewDecision) (RefundApproval, map[string]interface{}, error) {
+	a, err := s.decideRefund(ctx, id, RefundApproved, d)
+	if err != nil {
+		return RefundApproval{}, nil, err
+	}
+	refund, err := s.RefundPayment(ctx, a.Request)
+	if err != nil {
+		// Reopen the approval so it can be retried
+		s.refundApprovals.mu.Lock()
+		if h, ok := s.refundApprovals.approvals[id]; ok {
+			h.Status, h.DecidedBy, h.DecidedAt, h.Reason = RefundPendingApproval, "", nil, ""
+		}
+		s.refundApprovals.mu.Unlock()
+		log.Printf("Refund approval %s: refund failed after approval by %s, reopened: %v", id, a.DecidedBy, err)
+		return RefundApproval{}, nil, err
+	}
+
+	refundID, _ := refund["id"].(string)
+	s.refundApprovals.mu.Lock()
+	if h, ok := s.refundApprovals.approvals[id]; ok {
+		h.RefundID = refundID
+		a = *h
+	}
+	s.refundApprovals.mu.Unlock()
+	log.Printf("Refund approval %s: refund %s created", id, refundID)
+	s.publishApproval(notify.EventRefundApproved, a)
+	return a, refund, nil
+}
+
+// RejectRefund drops a held refund without calling Razorpay. The rejecter,
+// taken from ctx, must not be the requester.
+func (s *Service) RejectRefund(ctx context.Context, id string, d ReviewDecision) (RefundApproval, error) {
+	a, err := s.decideRefund(ctx, id, RefundRejected, d)
+	if err != nil {
+		return RefundApproval{}, err
+	}
+	s.publishApproval(notify.EventRefundRejected, a)
+	return a, nil
+}
+
+// decideRefund closes a pending approval with status on behalf of the
+// principal in ctx
+func (s *Service) decideRefund(ctx context.Context, id, status string, d ReviewDecision) (RefundApproval, error) {
+	decider, ok := authctx.Principal(ctx)
+	if !ok {
+		return RefundApproval{}, fmt.Errorf("%w: no authenticated principal", ErrSelfApproval)
+	}
+
+	s.refundApprovals.mu.Lock()
+	defer s.refundApprovals.mu.Unlock()
+
+	a, ok := s.refundApprovals.approvals[id]
+	if !ok {
+		return RefundApproval{}, ErrNotFound
+	}
+	if a.Status != RefundPendingApproval {
+		return RefundApproval{}, fmt.Errorf("%w: %s is %s", ErrApprovalClosed, id, a.Status)
+	}
+	if decider.String() == a.RequestedBy {
+		log.Printf("Refund approval %s: refused %s by its requester %s", id, status, a.RequestedBy)
+		return RefundApproval{}, ErrSelfApproval
+	}
+
+	now := s.clock.Now()
+	a.Status = status
+	a.DecidedBy = decider.String()
+	a.DecidedAt = &now
+	a.Reason = d.Reason
+	log.Printf("Refund approval %s: %s by %s (reason: %q)", id, status, a.DecidedBy, d.Reason)
+	return *a, nil
+}
+
+// publishApproval notifies a step of the approval workflow
+func (s *Service) publishApproval(eventType string, a RefundApproval) {
+	data := map[string]interface{}{
+		"payment_id":   a.Request.PaymentID,
+		"amount":       a.Request.Amount,
+		"currency":     s.defaultCurrency(a.Request.Currency),
+		"requested_by": a.RequestedBy,
+	}
+	if a.DecidedBy != "" {
+		data["decided_by"] = a.DecidedBy
+		data["reason"] = a.Reason
+	}
+	if a.RefundID != "" {
+		data["refund_id"] = a.RefundID
+	}
+	s.notifier.Publish(notify.Event{
+		Type:       eventType,
+		Subject:    a.ID,
+		Data:       data,
+		OccurredAt: s.clock.Now(),
+	})
+}
+
+// startRefundApprovalSweeper rejects approvals left undecided past their
+// expiry
+func (s *Service) startRefundApprovalSweeper() {
+	s.refundApprovals = &refundApprovals{approvals: make(map[string]*RefundApproval)}
+	s.runners.Add("refund-approval-sweeper", runner.Every(refundApprovalSweepInterval, s.sweepRefundApprovals))
+}
+
+// sweepRefundApprovals rejects pending approvals past their expiry
+func (s *Service) sweepRefundApprovals() {
+	now := s.clock.Now()
+	var expired []RefundApproval
+	s.refundApprovals.mu.Lock()
+	for _, a := range s.refundApprovals.approvals {
+		if a.Status == RefundPendingApproval && !now.Before(a.ExpiresAt) {
+			a.Status = RefundRejected
+			a.DecidedBy = "system"
+			a.DecidedAt = &now
+			a.Reason = "approval expired"
+			expired = append(expired, *a)
+		}
+	}
+	s.refundApprovals.mu.Unlock()
+
+	for _, a := range expired {
+		log.Printf("Refund approval %s expired undecided; rejected", a.ID)
+		s.publishApproval(notify.EventRefundRejected, a)
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/notify"
+)
+
+// refundGateway refunds payments in memory, counting the refunds made
+type refundGateway struct {
+	*fakeGateway
+
+	mu      sync.Mutex
+	refunds int
+	err     error
+}
+
+func (g *refundGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	g.refunds++
+	return map[string]interface{}{"id": "rfnd_1", "payment_id": paymentID, "amount": float64(amount), "currency": "INR", "status": "pending"}, nil
+}
+
+func (g *refundGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"items": []interface{}{}}, nil
+}
+
+func (g *refundGateway) made() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.refunds
+}
+
+// asAdmin is a context authenticated as the admin id
+func asAdmin(id string) context.Context {
+	return authctx.WithPrincipal(context.Background(), authctx.Identity{Kind: authctx.KindAdmin, ID: id})
+}
+
+func approvalService(t *testing.T, gw *refundGateway) (*Service, *recordingChannel, func(time.Duration)) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.RefundApprovalThreshold = 500000
+	cfg.RefundApprovalTTL = 7 * 24 * time.Hour
+	ch := &recordingChannel{events: make(chan notify.Event, 10)}
+	n := notify.New(notify.Options{}, ch)
+	t.Cleanup(func() { n.Shutdown(context.Background()) })
+	s, clk := newTestService(t, gw, cfg, WithNotifier(n))
+	return s, ch, clk.Advance
+}
+
+// approvalEvent waits for the next refund approval notification on ch
+func approvalEvent(t *testing.T, ch *recordingChannel) notify.Event {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-ch.events:
+			switch ev.Type {
+			case notify.EventRefundApprovalRequested, notify.EventRefundApproved, notify.EventRefundRejected:
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("no refund approval notification")
+		}
+	}
+}
+
+func TestRequestRefundThreshold(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int
+		pending bool
+	}{
+		{"below", 100000, false},
+		{"at the threshold", 500000, false},
+		{"above", 500001, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &refundGateway{fakeGateway: newFakeGateway()}
+			s, ch, _ := approvalService(t, gw)
+
+			refund, approval, err := s.RequestRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: tt.amount})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.pending {
+				if approval != nil || refund == nil || gw.made() != 1 {
+					t.Fatalf("refund %v, approval %+v, %d refunds made, want refunded at once", refund, approval, gw.made())
+				}
+				return
+			}
+			if refund != nil || approval == nil || approval.Status != RefundPendingApproval || approval.RequestedBy != "admin:alice" || gw.made() != 0 {
+				t.Fatalf("refund %v, approval %+v, %d refunds made, want held for approval", refund, approval, gw.made())
+			}
+			if pending := s.PendingRefunds(); len(pending) != 1 || pending[0].ID != approval.ID {
+				t.Fatalf("pending = %+v, want %s", pending, approval.ID)
+			}
+			if ev := approvalEvent(t, ch); ev.Type != notify.EventRefundApprovalRequested || ev.Subject != approval.ID {
+				t.Fatalf("notified %+v, want the approval requested", ev)
+			}
+		})
+	}
+}
+
+func TestDecideRefund(t *testing.T) {
+	tests := []struct {
+		name    string
+		decider string
+		approve bool
+		wantErr error
+		status  string
+		refunds int
+	}{
+		{"approved", "bob", true, nil, RefundApproved, 1},
+		{"rejected", "bob", false, nil, RefundRejected, 0},
+		{"approved by the requester", "alice", true, ErrSelfApproval, RefundPendingApproval, 0},
+		{"rejected by the requester", "alice", false, ErrSelfApproval, RefundPendingApproval, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &refundGateway{fakeGateway: newFakeGateway()}
+			s, ch, _ := approvalService(t, gw)
+			_, approval, err := s.RequestRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 600000})
+			if err != nil {
+				t.Fatal(err)
+			}
+			approvalEvent(t, ch)
+
+			d := ReviewDecision{Reason: "checked with the customer"}
+			if tt.approve {
+				_, _, err = s.ApproveRefund(asAdmin(tt.decider), approval.ID, d)
+			} else {
+				_, err = s.RejectRefund(asAdmin(tt.decider), approval.ID, d)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if gw.made() != tt.refunds {
+				t.Fatalf("%d refunds made, want %d", gw.made(), tt.refunds)
+			}
+			pending := s.PendingRefunds()
+			if open := len(pending) == 1; open != (tt.status == RefundPendingApproval) {
+				t.Fatalf("pending = %+v, want the approval %s", pending, tt.status)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			ev := approvalEvent(t, ch)
+			want := notify.EventRefundRejected
+			if tt.approve {
+				want = notify.EventRefundApproved
+			}
+			if ev.Type != want || ev.Data["decided_by"] != "admin:bob" {
+				t.Fatalf("notified %+v, want %s by bob", ev, want)
+			}
+
+			// A decided approval stays decided
+			if _, err := s.RejectRefund(asAdmin("carol"), approval.ID, d); !errors.Is(err, ErrApprovalClosed) {
+				t.Fatalf("second decision: err = %v, want ErrApprovalClosed", err)
+			}
+		})
+	}
+}
+
+func TestDecideRefundRefused(t *testing.T) {
+	gw := &refundGateway{fakeGateway: newFakeGateway()}
+	s, _, _ := approvalService(t, gw)
+	_, approval, err := s.RequestRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 600000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RejectRefund(context.Background(), approval.ID, ReviewDecision{}); !errors.Is(err, ErrSelfApproval) {
+		t.Fatalf("unauthenticated: err = %v, want ErrSelfApproval", err)
+	}
+	if _, err := s.RejectRefund(asAdmin("bob"), "rfa_missing", ReviewDecision{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown approval: err = %v, want ErrNotFound", err)
+	}
+
+	// A refund Razorpay fails reopens the approval for another try
+	gw.err = errors.New("razorpay down")
+	if _, _, err := s.ApproveRefund(asAdmin("bob"), approval.ID, ReviewDecision{}); err == nil {
+		t.Fatal("approval of a failing refund succeeded")
+	}
+	if pending := s.PendingRefunds(); len(pending) != 1 || pending[0].DecidedBy != "" {
+		t.Fatalf("pending = %+v, want the approval reopened", pending)
+	}
+	gw.err = nil
+	if a, _, err := s.ApproveRefund(asAdmin("bob"), approval.ID, ReviewDecision{}); err != nil || a.RefundID != "rfnd_1" {
+		t.Fatalf("retried approval = %+v, %v, want refund rfnd_1", a, err)
+	}
+}
+
+func TestRefundApprovalsExpire(t *testing.T) {
+	gw := &refundGateway{fakeGateway: newFakeGateway()}
+	s, ch, advance := approvalService(t, gw)
+	_, approval, err := s.RequestRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 600000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvalEvent(t, ch)
+
+	advance(7*24*time.Hour - time.Second)
+	s.sweepRefundApprovals()
+	if len(s.PendingRefunds()) != 1 {
+		t.Fatal("approval expired early")
+	}
+	advance(time.Second)
+	s.sweepRefundApprovals()
+	if pending := s.PendingRefunds(); len(pending) != 0 {
+		t.Fatalf("pending = %+v after the TTL, want none", pending)
+	}
+	ev := approvalEvent(t, ch)
+	if ev.Type != notify.EventRefundRejected || ev.Subject != approval.ID || ev.Data["decided_by"] != "system" {
+		t.Fatalf("notified %+v, want the expiry rejection", ev)
+	}
+	if gw.made() != 0 {
+		t.Fatalf("%d refunds made, want none", gw.made())
+	}
+}
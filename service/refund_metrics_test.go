@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// refundStatusGateway answers refunds with status in currency, or fails
+// them with err
+type refundStatusGateway struct {
+	*fakeGateway
+
+	status   string
+	currency string
+	err      error
+}
+
+func (g *refundStatusGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	return map[string]interface{}{"id": "rfnd_1", "payment_id": paymentID, "amount": float64(amount), "currency": g.currency, "status": g.status}, nil
+}
+
+func (g *refundStatusGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"items": []interface{}{}}, nil
+}
+
+func TestRefundMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		gw         *refundStatusGateway
+		wantStatus string
+		wantAmount float64
+	}{
+		{"processed", &refundStatusGateway{status: "processed", currency: "INR"}, "processed", 2500},
+		{"pending", &refundStatusGateway{status: "pending", currency: "inr"}, "pending", 2500},
+		{"refused", &refundStatusGateway{err: errors.New("razorpay down")}, "failed", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.gw.fakeGateway = newFakeGateway()
+			s, _ := newTestService(t, tt.gw, testConfig(t))
+			refunds := testutil.ToFloat64(metrics.Refunds.WithLabelValues(tt.wantStatus))
+			amount := testutil.ToFloat64(metrics.RefundAmount.WithLabelValues("INR"))
+
+			_, err := s.RefundPayment(context.Background(), RefundRequest{PaymentID: "pay_1", Amount: 2500})
+			if (err != nil) != (tt.gw.err != nil) {
+				t.Fatalf("err = %v", err)
+			}
+			if got := testutil.ToFloat64(metrics.Refunds.WithLabelValues(tt.wantStatus)) - refunds; got != 1 {
+				t.Fatalf("refunds_total{status=%q} rose by %v, want 1", tt.wantStatus, got)
+			}
+			if got := testutil.ToFloat64(metrics.RefundAmount.WithLabelValues("INR")) - amount; got != tt.wantAmount {
+				t.Fatalf("refund_amount{currency=INR} rose by %v, want %v", got, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestDisputeMetrics(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookReorderDelay = 0
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+
+	events := []struct {
+		event string
+		state string
+	}{
+		{"payment.dispute.created", "open"},
+		{"payment.dispute.under_review", "under_review"},
+		{"payment.dispute.won", "won"},
+		{"payment.dispute.lost", "lost"},
+		{"payment.dispute.closed", ""},
+	}
+	// A dispute without a state counts as unknown
+	want := map[string]float64{"open": 1, "under_review": 1, "won": 1, "lost": 1, "unknown": 1}
+	before := map[string]float64{}
+	for state := range want {
+		before[state] = testutil.ToFloat64(metrics.Disputes.WithLabelValues(state))
+	}
+	for i, e := range events {
+		body := fmt.Sprintf(`{"event":%q,"created_at":%d,"payload":{"dispute":{"entity":{"id":"disp_1","status":%q}}}}`,
+			e.event, clk.Now().Unix(), e.state)
+		if err := deliver(t, s, body, fmt.Sprintf("evt_%d", i)); err != nil {
+			t.Fatalf("%s: %v", e.event, err)
+		}
+	}
+	drainWebhooks(t, s)
+
+	for state, n := range want {
+		if got := testutil.ToFloat64(metrics.Disputes.WithLabelValues(state)) - before[state]; got != n {
+			t.Errorf("disputes_total{state=%q} rose by %v, want %v", state, got, n)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+// Outcomes of claiming a payment ID for verification
+const (
+	claimNew = iota
+	claimRetry
+	claimReplay
+)
+
+// VerifiedPayment records a successful verification of a payment ID
+type VerifiedPayment struct {
+	OrderID        string    `json:"order_id"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	VerifiedAt     time.Time `json:"verified_at"`
+}
+
+// ReplayStore remembers recently verified payment IDs so a captured
+// (order_id, payment_id, signature) triple cannot be confirmed twice. A
+// store shared between instances keeps a replay from landing on one that
+// has not seen the first verification.
+type ReplayStore interface {
+	// Claim records v for paymentID for ttl unless a record is already
+	// held, atomically. It returns the record held and false when there is
+	// one, or v and true when v was recorded.
+	Claim(ctx context.Context, paymentID string, v VerifiedPayment, ttl time.Duration) (VerifiedPayment, bool, error)
+}
+
+// WithReplayStore makes the service remember verified payments in store
+// instead of in memory
+func WithReplayStore(store ReplayStore) Option {
+	return func(s *Service) {
+		s.replays = store
+	}
+}
+
+// MemoryReplayStore is a ReplayStore private to one process
+type MemoryReplayStore struct {
+	mu         sync.Mutex
+	clock      clock.Clock
+	seen       map[string]replayRecord
+	lastPruned time.Time
+}
+
+type replayRecord struct {
+	VerifiedPayment
+	expires time.Time
+}
+
+// NewMemoryReplayStore returns an empty in-memory ReplayStore
+func NewMemoryReplayStore(clk clock.Clock) *MemoryReplayStore {
+	return &MemoryReplayStore{
+		clock: clk,
+		seen:  make(map[string]replayRecord),
+	}
+}
+
+func (m *MemoryReplayStore) Claim(ctx context.Context, paymentID string, v VerifiedPayment, ttl time.Duration) (VerifiedPayment, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	if now.Sub(m.lastPruned) > time.Minute {
+		for id, r := range m.seen {
+			if now.After(r.expires) {
+				delete(m.seen, id)
+			}
+		}
+		m.lastPruned = now
+	}
+
+	if prev, ok := m.seen[paymentID]; ok && !now.After(prev.expires) {
+		return prev.VerifiedPayment, false, nil
+	}
+	m.seen[paymentID] = replayRecord{VerifiedPayment: v, expires: now.Add(ttl)}
+	return v, true, nil
+}
+
+// claimPayment marks paymentID as verified. A second claim is a legitimate
+// retry only when it repeats the original Idempotency-Key for the same
+// order; anything else is a replay.
+func (s *Service) claimPayment(ctx context.Context, paymentID, orderID, idempotencyKey string) (int, error) {
+	// Held the skew tolerance longer, as long as late tokens are accepted
+	prev, claimed, err := s.replays.Claim(ctx, paymentID, VerifiedPayment{
+		OrderID:        orderID,
+		IdempotencyKey: idempotencyKey,
+		VerifiedAt:     s.clock.Now(),
+	}, s.cfg.VerifyReplayTTL+s.cfg.ClockSkewTolerance)
+	if err != nil {
+		// Failing closed: verifying without the claim could confirm a replay
+		log.Printf("ERROR: claiming payment %s for order %s failed: %v", paymentID, orderID, err)
+		return 0, fmt.Errorf("claim payment %s: %w", paymentID, err)
+	}
+	if claimed {
+		return claimNew, nil
+	}
+	if idempotencyKey != "" && prev.IdempotencyKey == idempotencyKey && prev.OrderID == orderID {
+		return claimRetry, nil
+	}
+	return claimReplay, nil
+}
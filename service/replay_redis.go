@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisReplayPrefix namespaces replay records among other keys
+const redisReplayPrefix = "payments:verified:"
+
+// RedisReplayStore is a ReplayStore shared by every instance using the
+// same Redis. Records expire with Redis' own TTL.
+type RedisReplayStore struct {
+	client *redis.Client
+}
+
+// NewRedisReplayStore connects to the Redis at url, a redis:// or
+// rediss:// URL, and checks it answers
+func NewRedisReplayStore(ctx context.Context, url string) (*RedisReplayStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return &RedisReplayStore{client: client}, nil
+}
+
+// Claim sets the record with SET NX PX, so of two instances claiming the
+// same payment at once only one succeeds
+func (r *RedisReplayStore) Claim(ctx context.Context, paymentID string, v VerifiedPayment, ttl time.Duration) (VerifiedPayment, bool, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return VerifiedPayment{}, false, err
+	}
+	key := redisReplayPrefix + paymentID
+	// The held record can expire between the SET and the GET; the claim is
+	// then tried again
+	for attempt := 0; attempt < 3; attempt++ {
+		claimed, err := r.client.SetNX(ctx, key, value, ttl).Result()
+		if err != nil {
+			return VerifiedPayment{}, false, err
+		}
+		if claimed {
+			return v, true, nil
+		}
+
+		held, err := r.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return VerifiedPayment{}, false, err
+		}
+		var prev VerifiedPayment
+		if err := json.Unmarshal(held, &prev); err != nil {
+			return VerifiedPayment{}, false, fmt.Errorf("decode replay record of %s: %w", paymentID, err)
+		}
+		return prev, false, nil
+	}
+	return VerifiedPayment{}, false, fmt.Errorf("claim of %s kept racing its expiry", paymentID)
+}
+
+// Ping checks Redis answers, for health checks
+func (r *RedisReplayStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close closes the connection pool
+func (r *RedisReplayStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+func TestVerifyPaymentReplay(t *testing.T) {
+	cfg := testConfig(t)
+	tests := []struct {
+		name string
+		// first and second are the Idempotency-Keys of two verifications
+		// of the same payment
+		first, second string
+		// advance is the time between them
+		advance time.Duration
+		// otherPayment verifies a second payment of the order instead
+		otherPayment bool
+		want         error
+	}{
+		{name: "replayed", want: ErrAlreadyVerified},
+		{name: "retried with its key", first: "key-1", second: "key-1"},
+		{name: "replayed with another key", first: "key-1", second: "key-2", want: ErrAlreadyVerified},
+		{name: "replayed without the key", first: "key-1", want: ErrAlreadyVerified},
+		{name: "second payment of the order", otherPayment: true},
+		{name: "replayed later", advance: cfg.OrderTokenTTL / 2, want: ErrAlreadyVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, clk := newTestService(t, gw, cfg)
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			verify := func(paymentID, key string) error {
+				gw.pay(paymentID, orderID, 500, "INR")
+				_, err := s.VerifyPayment(context.Background(), PaymentVerificationRequest{
+					ServerOrderID:     orderID,
+					RazorpayPaymentID: paymentID,
+					RazorpaySignature: paymentSignature(orderID, paymentID, testSecret),
+					OrderToken:        order["order_token"].(string),
+					IdempotencyKey:    key,
+				})
+				return err
+			}
+			if err := verify("pay_1", tt.first); err != nil {
+				t.Fatalf("first verification: %v", err)
+			}
+			clk.Advance(tt.advance)
+			second := "pay_1"
+			if tt.otherPayment {
+				second = "pay_2"
+			}
+			if err := verify(second, tt.second); !errors.Is(err, tt.want) {
+				t.Fatalf("second verification: err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryReplayStoreClaim(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	store := NewMemoryReplayStore(clk)
+	ctx := context.Background()
+	first := VerifiedPayment{OrderID: "order_1", IdempotencyKey: "key-1"}
+
+	if _, claimed, err := store.Claim(ctx, "pay_1", first, time.Minute); err != nil || !claimed {
+		t.Fatalf("first claim: claimed %v, %v", claimed, err)
+	}
+	prev, claimed, err := store.Claim(ctx, "pay_1", VerifiedPayment{OrderID: "order_2"}, time.Minute)
+	if err != nil || claimed || prev.OrderID != "order_1" || prev.IdempotencyKey != "key-1" {
+		t.Fatalf("second claim: %+v claimed %v, %v; want the first held", prev, claimed, err)
+	}
+	clk.Advance(2 * time.Minute)
+	if _, claimed, err := store.Claim(ctx, "pay_1", first, time.Minute); err != nil || !claimed {
+		t.Fatalf("claim after expiry: claimed %v, %v", claimed, err)
+	}
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// Kinds of scheduled action
+const (
+	ScheduleRefund  = "refund"
+	ScheduleCapture = "capture"
+)
+
+// States of a scheduled action
+const (
+	ScheduleScheduled = "scheduled"
+	// ScheduleRunning actions are being executed by an instance holding
+	// the lease; an expired lease means that instance died mid-execution
+	ScheduleRunning  = "running"
+	ScheduleDone     = "done"
+	ScheduleFailed   = "failed"
+	ScheduleCanceled = "canceled"
+)
+
+const (
+	// scheduleSweepInterval is how often due actions are looked for
+	scheduleSweepInterval = 10 * time.Second
+	// scheduleLease is how long an execution may take before another
+	// sweep considers it abandoned and runs it again
+	scheduleLease = 5 * time.Minute
+	// scheduleMaxBackoff caps the wait between retries
+	scheduleMaxBackoff = time.Hour
+	// scheduleNote tags refunds with the schedule that made them, so a
+	// retry can find a refund an earlier attempt already created
+	scheduleNote = "schedule_id"
+)
+
+// ErrScheduleClosed is canceling an action that is running or finished
+var ErrScheduleClosed = errors.New("scheduled action can no longer be canceled")
+
+// ScheduledAction is a refund or capture to make at a later time
+type ScheduledAction struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	PaymentID string            `json:"payment_id"`
+	Amount    int               `json:"amount"`
+	Currency  string            `json:"currency"`
+	Notes     map[string]string `json:"notes,omitempty"`
+	ExecuteAt time.Time         `json:"execute_at"`
+	Status    string            `json:"status"`
+	Attempts  int               `json:"attempts"`
+	// NextAttemptAt is when a scheduled action is next due: ExecuteAt,
+	// later after a failed attempt
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	// LeaseUntil is when a running execution is considered abandoned
+	LeaseUntil *time.Time `json:"lease_until,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	// ResultID is the refund created, or the payment captured
+	ResultID  string    `json:"result_id,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ScheduleStore persists scheduled actions. A durable implementation keeps
+// schedules across restarts; the sweep resumes them, running abandoned ones
+// again, and executions are idempotent.
+type ScheduleStore interface {
+	// Save inserts or replaces the action
+	Save(ctx context.Context, a ScheduledAction) error
+	// Get returns the action or ErrNotFound
+	Get(ctx context.Context, id string) (ScheduledAction, error)
+	// List returns every action
+	List(ctx context.Context) ([]ScheduledAction, error)
+	// Update applies fn to the stored action atomically and saves it unless
+	// fn fails. It returns ErrNotFound for unknown actions.
+	Update(ctx context.Context, id string, fn func(*ScheduledAction) error) (ScheduledAction, error)
+}
+
+// WithScheduleStore keeps scheduled actions in store instead of in memory
+func WithScheduleStore(store ScheduleStore) Option {
+	return func(s *Service) {
+		s.schedules = store
+	}
+}
+
+// MemoryScheduleStore is a ScheduleStore kept in process memory; schedules
+// do not survive a restart
+type MemoryScheduleStore struct {
+	mu      sync.Mutex
+	actions map[string]ScheduledAction
+}
+
+// NewMemoryScheduleStore returns an empty in-memory ScheduleStore
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{actions: make(map[string]ScheduledAction)}
+}
+
+func (m *MemoryScheduleStore) Save(ctx context.Context, a ScheduledAction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions[a.ID] = a
+	return nil
+}
+
+func (m *MemoryScheduleStore) Get(ctx context.Context, id string) (ScheduledAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.actions[id]
+	if !ok {
+		return ScheduledAction{}, ErrNotFound
+	}
+	return a, nil
+}
+
+func (m *MemoryScheduleStore) List(ctx context.Context) ([]ScheduledAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	actions := make([]ScheduledAction, 0, len(m.actions))
+	for _, a := range m.actions {
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+func (m *MemoryScheduleStore) Update(ctx context.Context, id string, fn func(*ScheduledAction) error) (ScheduledAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.actions[id]
+	if !ok {
+		return ScheduledAction{}, ErrNotFound
+	}
+	if err := fn(&a); err != nil {
+		return ScheduledAction{}, err
+	}
+	m.actions[id] = a
+	return a, nil
+}
+
+// ScheduleRefund schedules req for req.ExecuteAt. Refunds that would need
+// approval cannot be scheduled.
+func (s *Service) ScheduleRefund(ctx context.Context, req RefundRequest) (ScheduledAction, error) {
+	currency := s.defaultCurrency(req.Currency)
+	if err := validateAmount(currency, req.Amount); err != nil {
+		return ScheduledAction{}, err
+	}
+	if s.cfg.RefundApprovalThreshold > 0 && req.Amount > s.cfg.RefundApprovalThreshold {
+		return ScheduledAction{}, invalidRequest("refunds over %d need approval and cannot be scheduled", s.cfg.RefundApprovalThreshold)
+	}
+	if err := s.checkExecuteAt(req.ExecuteAt, "execute_at"); err != nil {
+		return ScheduledAction{}, err
+	}
+	return s.schedule(ctx, ScheduledAction{
+		Kind:      ScheduleRefund,
+		PaymentID: req.PaymentID,
+		Amount:    req.Amount,
+		Currency:  currency,
+		Notes:     req.Notes,
+		ExecuteAt: *req.ExecuteAt,
+	})
+}
+
+// ScheduleCapture schedules capturing an authorized payment at
+// req.CaptureAt, which must fall inside the authorization's validity
+func (s *Service) ScheduleCapture(ctx context.Context, paymentID string, req CaptureRequest) (ScheduledAction, error) {
+	currency := s.defaultCurrency(req.Currency)
+	if err := validateAmount(currency, req.Amount); err != nil {
+		return ScheduledAction{}, err
+	}
+	if err := s.checkExecuteAt(req.CaptureAt, "capture_at"); err != nil {
+		return ScheduledAction{}, err
+	}
+
+	payment, err := s.gateway.FetchPayment(ctx, paymentID)
+	if err != nil {
+		return ScheduledAction{}, fmt.Errorf("fetch payment %s: %w", paymentID, err)
+	}
+	if status, _ := payment["status"].(string); status != "authorized" {
+		return ScheduledAction{}, invalidRequest("payment %s is %s, only authorized payments can be captured", paymentID, status)
+	}
+	authorizedAt := s.clock.Now()
+	if created, ok := intField(payment, "created_at"); ok {
+		authorizedAt = time.Unix(int64(created), 0)
+	}
+	deadline := authorizedAt.Add(s.cfg.CaptureAuthWindow - s.cfg.CaptureVoidMargin)
+	if !req.CaptureAt.Before(deadline) {
+		return ScheduledAction{}, invalidRequest("capture_at must be before %s, when the authorization of %s lapses",
+			deadline.UTC().Format(time.RFC3339), paymentID)
+	}
+
+	return s.schedule(ctx, ScheduledAction{
+		Kind:      ScheduleCapture,
+		PaymentID: paymentID,
+		Amount:    req.Amount,
+		Currency:  currency,
+		ExecuteAt: *req.CaptureAt,
+	})
+}
+
+// checkExecuteAt requires a schedule time in the future
+func (s *Service) checkExecuteAt(at *time.Time, field string) error {
+	if at == nil || at.IsZero() {
+		return invalidRequest("%s is required", field)
+	}
+	if !at.After(s.clock.Now()) {
+		return invalidRequest("%s must be in the future", field)
+	}
+	return nil
+}
+
+// schedule saves a new action
+func (s *Service) schedule(ctx context.Context, a ScheduledAction) (ScheduledAction, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ScheduledAction{}, err
+	}
+	caller, _ := authctx.Principal(ctx)
+	now := s.clock.Now()
+	a.ID = "sch_" + hex.EncodeToString(b)
+	a.Status = ScheduleScheduled
+	a.NextAttemptAt = a.ExecuteAt
+	a.CreatedBy = caller.String()
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	if err := s.schedules.Save(ctx, a); err != nil {
+		return ScheduledAction{}, fmt.Errorf("save scheduled %s: %w", a.Kind, err)
+	}
+	log.Printf("Scheduled %s %s of %d %s for payment %s at %s by %s",
+		a.Kind, a.ID, a.Amount, a.Currency, a.PaymentID, a.ExecuteAt.UTC().Format(time.RFC3339), a.CreatedBy)
+	metrics.ScheduledPending.WithLabelValues(a.Kind).Inc()
+	return a, nil
+}
+
+// ScheduledActions lists scheduled actions by due time, optionally only
+// those of the given kind and status
+func (s *Service) ScheduledActions(ctx context.Context, kind, status string) ([]ScheduledAction, error) {
+	all, err := s.schedules.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list scheduled actions: %w", err)
+	}
+	actions := []ScheduledAction{}
+	for _, a := range all {
+		if (kind == "" || a.Kind == kind) && (status == "" || a.Status == status) {
+			actions = append(actions, a)
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].ExecuteAt.Before(actions[j].ExecuteAt) })
+	return actions, nil
+}
+
+// ScheduledAction returns one scheduled action
+func (s *Service) ScheduledAction(ctx context.Context, id string) (ScheduledAction, error) {
+	return s.schedules.Get(ctx, id)
+}
+
+// CancelScheduledAction cancels an action that has not started executing
+func (s *Service) CancelScheduledAction(ctx context.Context, id string) (ScheduledAction, error) {
+	caller, _ := authctx.Principal(ctx)
+	a, err := s.schedules.Update(ctx, id, func(a *ScheduledAction) error {
+		if a.Status != ScheduleScheduled {
+			return fmt.Errorf("%w: %s is %s", ErrScheduleClosed, id, a.Status)
+		}
+		a.Status = ScheduleCanceled
+		a.UpdatedAt = s.clock.Now()
+		return nil
+	})
+	if err != nil {
+		return ScheduledAction{}, err
+	}
+	log.Printf("Canceled scheduled %s %s by %s", a.Kind, id, caller.String())
+	metrics.ScheduledPending.WithLabelValues(a.Kind).Dec()
+	return a, nil
+}
+
+// startScheduler runs due scheduled actions until stopped
+func (s *Service) startScheduler() {
+	s.runners.Add("scheduler", runner.Every(scheduleSweepInterval, func() {
+		s.runDueActions(context.Background())
+	}), runner.Restart(time.Second, time.Minute))
+}
+
+// runDueActions executes every action that is due, and every running one
+// whose lease has expired
+func (s *Service) runDueActions(ctx context.Context) {
+	actions, err := s.schedules.List(ctx)
+	if err != nil {
+		log.Printf("Error listing scheduled actions: %v", err)
+		return
+	}
+	now := s.clock.Now()
+	for _, a := range actions {
+		if isDue(a, now) {
+			s.runScheduled(ctx, a.ID)
+		}
+	}
+}
+
+// isDue reports whether a should be executed at now
+func isDue(a ScheduledAction, now time.Time) bool {
+	switch a.Status {
+	case ScheduleScheduled:
+		return !now.Before(a.NextAttemptAt)
+	case ScheduleRunning:
+		return a.LeaseUntil == nil || !now.Before(*a.LeaseUntil)
+	}
+	return false
+}
+
+// runScheduled claims the action with a lease, so no two sweeps run it at
+// once, executes it and records the outcome
+func (s *Service) runScheduled(ctx context.Context, id string) {
+	now := s.clock.Now()
+	a, err := s.schedules.Update(ctx, id, func(a *ScheduledAction) error {
+		if !isDue(*a, now) {
+			return ErrScheduleClosed
+		}
+		lease := now.Add(scheduleLease)
+		a.Status = ScheduleRunning
+		a.LeaseUntil = &lease
+		a.Attempts++
+		a.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrScheduleClosed) {
+			log.Printf("Error claiming scheduled action %s: %v", id, err)
+		}
+		return
+	}
+
+	resultID, err := s.executeScheduled(ctx, a)
+	result := "done"
+	_, saveErr := s.schedules.Update(ctx, id, func(a *ScheduledAction) error {
+		now := s.clock.Now()
+		a.LeaseUntil = nil
+		a.UpdatedAt = now
+		switch {
+		case err == nil:
+			a.Status = ScheduleDone
+			a.ResultID = resultID
+			a.LastError = ""
+		case permanent(err) || a.Attempts >= s.cfg.ScheduleMaxAttempts:
+			a.Status = ScheduleFailed
+			a.LastError = err.Error()
+			result = "failed"
+		default:
+			a.Status = ScheduleScheduled
+			a.LastError = err.Error()
+			a.NextAttemptAt = now.Add(scheduleBackoff(s.cfg.ScheduleRetryBackoff, a.Attempts))
+			result = "retried"
+		}
+		return nil
+	})
+	if saveErr != nil {
+		// The lease expires and a later sweep runs the action again, which
+		// finds the outcome of this attempt
+		log.Printf("Error saving outcome of scheduled action %s: %v", id, saveErr)
+		return
+	}
+
+	metrics.ScheduledExecutions.WithLabelValues(a.Kind, result).Inc()
+	switch result {
+	case "done":
+		metrics.ScheduledPending.WithLabelValues(a.Kind).Dec()
+		log.Printf("Executed scheduled %s %s for payment %s: %s", a.Kind, id, a.PaymentID, resultID)
+	case "failed":
+		metrics.ScheduledPending.WithLabelValues(a.Kind).Dec()
+		log.Printf("ANOMALY: scheduled %s %s for payment %s failed after %d attempts: %v", a.Kind, id, a.PaymentID, a.Attempts, err)
+	default:
+		log.Printf("Scheduled %s %s for payment %s failed attempt %d, retrying: %v", a.Kind, id, a.PaymentID, a.Attempts, err)
+	}
+}
+
+// permanent reports errors no retry can fix: Razorpay refusing the call,
+// or the action itself being invalid
+func permanent(err error) bool {
+	var rejected *gateway.RequestError
+	var invalid *ValidationError
+	return errors.As(err, &rejected) || errors.As(err, &invalid) || errors.Is(err, ErrInvalidAmount)
+}
+
+// scheduleBackoff is the wait after the attempt-th failure
+func scheduleBackoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < scheduleMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, scheduleMaxBackoff)
+}
+
+// executeScheduled makes the refund or capture. Both are safe to repeat: a
+// refund an earlier attempt created is found by its note, and a payment
+// already captured is not captured again.
+func (s *Service) executeScheduled(ctx context.Context, a ScheduledAction) (string, error) {
+	switch a.Kind {
+	case ScheduleRefund:
+		if id, err := s.scheduledRefund(ctx, a); err != nil || id != "" {
+			return id, err
+		}
+		notes := map[string]string{scheduleNote: a.ID}
+		for k, v := range a.Notes {
+			notes[k] = v
+		}
+		refund, err := s.RefundPayment(ctx, RefundRequest{PaymentID: a.PaymentID, Amount: a.Amount, Currency: a.Currency, Notes: notes})
+		if err != nil {
+			return "", err
+		}
+		id, _ := refund["id"].(string)
+		return id, nil
+
+	case ScheduleCapture:
+		payment, err := s.gateway.FetchPayment(ctx, a.PaymentID)
+		if err != nil {
+			return "", fmt.Errorf("fetch payment %s: %w", a.PaymentID, err)
+		}
+		switch status, _ := payment["status"].(string); status {
+		case "captured":
+			return a.PaymentID, nil
+		case "authorized":
+		default:
+			return "", invalidRequest("payment %s is %s and can no longer be captured", a.PaymentID, status)
+		}
+		if _, err := s.CapturePayment(ctx, a.PaymentID, CaptureRequest{Amount: a.Amount, Currency: a.Currency}); err != nil {
+			return "", err
+		}
+		return a.PaymentID, nil
+	}
+	return "", invalidRequest("unknown scheduled action kind %q", a.Kind)
+}
+
+// scheduledRefund returns the ID of a refund an earlier attempt of a made,
+// empty when there is none
+func (s *Service) scheduledRefund(ctx context.Context, a ScheduledAction) (string, error) {
+	if a.Attempts <= 1 {
+		return "", nil
+	}
+	collection, err := s.gateway.FetchPaymentRefunds(ctx, a.PaymentID)
+	if err != nil {
+		return "", fmt.Errorf("fetch refunds of payment %s: %w", a.PaymentID, err)
+	}
+	items, _ := collection["items"].([]interface{})
+	for _, raw := range items {
+		refund, _ := raw.(map[string]interface{})
+		notes, _ := refund["notes"].(map[string]interface{})
+		if id, _ := notes[scheduleNote].(string); id == a.ID {
+			refundID, _ := refund["id"].(string)
+			return refundID, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// scheduleGateway keeps refunds in memory with their notes. lose makes
+// that many refunds go through while their response is lost; err fails
+// every refund without making it.
+type scheduleGateway struct {
+	*fakeGateway
+
+	mu      sync.Mutex
+	refunds []map[string]interface{}
+	lose    int
+	err     error
+}
+
+func (g *scheduleGateway) RefundPayment(ctx context.Context, paymentID string, amount int, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	notes := map[string]interface{}{}
+	for k, v := range data["notes"].(map[string]string) {
+		notes[k] = v
+	}
+	refund := map[string]interface{}{"id": "rfnd_" + string(rune('a'+len(g.refunds))), "payment_id": paymentID, "amount": float64(amount), "status": "pending", "notes": notes}
+	g.refunds = append(g.refunds, refund)
+	if g.lose > 0 {
+		g.lose--
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+	}
+	return copyMap(refund), nil
+}
+
+func (g *scheduleGateway) FetchPaymentRefunds(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	items := []interface{}{}
+	for _, r := range g.refunds {
+		if r["payment_id"] == paymentID {
+			items = append(items, copyMap(r))
+		}
+	}
+	return map[string]interface{}{"items": items}, nil
+}
+
+func (g *scheduleGateway) FetchPaymentTransfers(ctx context.Context, paymentID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"items": []interface{}{}}, nil
+}
+
+func (g *scheduleGateway) made() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.refunds)
+}
+
+func scheduleService(t *testing.T, gw *scheduleGateway) (*Service, func(time.Duration)) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.RefundApprovalThreshold = 500000
+	cfg.ScheduleMaxAttempts = 3
+	cfg.ScheduleRetryBackoff = time.Minute
+	s, clk := newTestService(t, gw, cfg)
+	return s, clk.Advance
+}
+
+// at is a time the given duration after the fake clock's start
+func at(d time.Duration) *time.Time {
+	t := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC).Add(d)
+	return &t
+}
+
+func TestScheduleRefund(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       RefundRequest
+		wantError bool
+	}{
+		{"scheduled", RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(72 * time.Hour)}, false},
+		{"no execute_at", RefundRequest{PaymentID: "pay_1", Amount: 1000}, true},
+		{"in the past", RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(-time.Minute)}, true},
+		{"now", RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(0)}, true},
+		{"needs approval", RefundRequest{PaymentID: "pay_1", Amount: 600000, ExecuteAt: at(time.Hour)}, true},
+		{"no amount", RefundRequest{PaymentID: "pay_1", ExecuteAt: at(time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := scheduleService(t, &scheduleGateway{fakeGateway: newFakeGateway()})
+			a, err := s.ScheduleRefund(asAdmin("alice"), tt.req)
+			if tt.wantError {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) && !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want the schedule refused", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Kind != ScheduleRefund || a.Status != ScheduleScheduled || !a.NextAttemptAt.Equal(*tt.req.ExecuteAt) || a.Currency != "INR" || a.CreatedBy == "" {
+				t.Fatalf("scheduled %+v, want a refund due at %s", a, tt.req.ExecuteAt)
+			}
+			if got, err := s.ScheduledAction(context.Background(), a.ID); err != nil || got.ID != a.ID {
+				t.Fatalf("stored %+v, %v, want it saved", got, err)
+			}
+		})
+	}
+}
+
+func TestScheduleCapture(t *testing.T) {
+	authorized := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC).Unix()
+	tests := []struct {
+		name      string
+		status    string
+		captureAt *time.Time
+		wantError bool
+	}{
+		{"within the window", "authorized", at(24 * time.Hour), false},
+		{"just inside the margin", "authorized", at(5*24*time.Hour - time.Hour - time.Minute), false},
+		{"inside the void margin", "authorized", at(5*24*time.Hour - time.Hour), true},
+		{"after the authorization lapses", "authorized", at(6 * 24 * time.Hour), true},
+		{"already captured", "captured", at(time.Hour), true},
+		{"no capture_at", "authorized", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &scheduleGateway{fakeGateway: newFakeGateway()}
+			gw.pay("pay_1", "order_1", 1000, "INR")
+			gw.payments["pay_1"]["status"] = tt.status
+			gw.payments["pay_1"]["created_at"] = float64(authorized)
+			s, _ := scheduleService(t, gw)
+
+			a, err := s.ScheduleCapture(asAdmin("alice"), "pay_1", CaptureRequest{Amount: 1000, CaptureAt: tt.captureAt})
+			if tt.wantError {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("err = %v, want the schedule refused", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Kind != ScheduleCapture || a.Status != ScheduleScheduled || !a.ExecuteAt.Equal(*tt.captureAt) {
+				t.Fatalf("scheduled %+v, want a capture at %s", a, tt.captureAt)
+			}
+		})
+	}
+}
+
+func TestScheduledRefundRetriedOnce(t *testing.T) {
+	gw := &scheduleGateway{fakeGateway: newFakeGateway(), lose: 1}
+	s, advance := scheduleService(t, gw)
+	ctx := context.Background()
+	a, err := s.ScheduleRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried := testutil.ToFloat64(metrics.ScheduledExecutions.WithLabelValues(ScheduleRefund, "retried"))
+	done := testutil.ToFloat64(metrics.ScheduledExecutions.WithLabelValues(ScheduleRefund, "done"))
+
+	steps := []struct {
+		advance  time.Duration
+		status   string
+		attempts int
+	}{
+		{0, ScheduleScheduled, 0},
+		// The refund goes through but its response is lost
+		{time.Hour, ScheduleScheduled, 1},
+		{30 * time.Second, ScheduleScheduled, 1},
+		// The retry finds the refund rather than making another
+		{30 * time.Second, ScheduleDone, 2},
+		{time.Hour, ScheduleDone, 2},
+	}
+	for i, st := range steps {
+		advance(st.advance)
+		s.runDueActions(ctx)
+		got, _ := s.ScheduledAction(ctx, a.ID)
+		if got.Status != st.status || got.Attempts != st.attempts {
+			t.Fatalf("step %d: %s after %d attempts, want %s after %d", i, got.Status, got.Attempts, st.status, st.attempts)
+		}
+	}
+
+	got, _ := s.ScheduledAction(ctx, a.ID)
+	if got.ResultID != "rfnd_a" || got.LastError != "" || got.LeaseUntil != nil || gw.made() != 1 {
+		t.Fatalf("action %+v after %d refunds, want the one refund rfnd_a", got, gw.made())
+	}
+	if n := testutil.ToFloat64(metrics.ScheduledExecutions.WithLabelValues(ScheduleRefund, "retried")) - retried; n != 1 {
+		t.Fatalf("%v retried executions counted, want 1", n)
+	}
+	if n := testutil.ToFloat64(metrics.ScheduledExecutions.WithLabelValues(ScheduleRefund, "done")) - done; n != 1 {
+		t.Fatalf("%v done executions counted, want 1", n)
+	}
+}
+
+func TestScheduledRefundFails(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		runs     int
+		attempts int
+	}{
+		{"rejected by Razorpay", &gateway.RequestError{Message: "payment fully refunded"}, 1, 1},
+		{"unreachable", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("refused")}, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &scheduleGateway{fakeGateway: newFakeGateway(), err: tt.err}
+			s, advance := scheduleService(t, gw)
+			ctx := context.Background()
+			a, err := s.ScheduleRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(time.Minute)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.runs+2; i++ {
+				advance(time.Hour)
+				s.runDueActions(ctx)
+			}
+			got, _ := s.ScheduledAction(ctx, a.ID)
+			if got.Status != ScheduleFailed || got.Attempts != tt.attempts || got.LastError == "" {
+				t.Fatalf("action %+v, want failed after %d attempts", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{20, scheduleMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := scheduleBackoff(time.Minute, tt.attempt); got != tt.want {
+			t.Errorf("scheduleBackoff(1m, %d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestScheduledCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		captured int
+		want     string
+	}{
+		{"authorized", "authorized", 1, ScheduleDone},
+		{"captured meanwhile", "captured", 0, ScheduleDone},
+		{"failed meanwhile", "failed", 0, ScheduleFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &scheduleGateway{fakeGateway: newFakeGateway()}
+			gw.pay("pay_1", "order_1", 1000, "INR")
+			gw.payments["pay_1"]["status"] = "authorized"
+			s, advance := scheduleService(t, gw)
+			ctx := context.Background()
+			a, err := s.ScheduleCapture(asAdmin("alice"), "pay_1", CaptureRequest{Amount: 1000, CaptureAt: at(time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gw.payments["pay_1"]["status"] = tt.status
+			advance(time.Hour)
+			s.runDueActions(ctx)
+			got, _ := s.ScheduledAction(ctx, a.ID)
+			if got.Status != tt.want || len(gw.captured) != tt.captured {
+				t.Fatalf("action %s after %d captures, want %s after %d", got.Status, len(gw.captured), tt.want, tt.captured)
+			}
+		})
+	}
+}
+
+func TestCancelScheduledAction(t *testing.T) {
+	gw := &scheduleGateway{fakeGateway: newFakeGateway()}
+	s, advance := scheduleService(t, gw)
+	ctx := context.Background()
+	canceled, err := s.ScheduleRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executed, err := s.ScheduleRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_2", Amount: 1000, ExecuteAt: at(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.CancelScheduledAction(asAdmin("bob"), canceled.ID); err != nil || got.Status != ScheduleCanceled {
+		t.Fatalf("cancel = %+v, %v, want canceled", got, err)
+	}
+	advance(2 * time.Hour)
+	s.runDueActions(ctx)
+
+	tests := []struct {
+		name string
+		id   string
+		want error
+	}{
+		{"canceled already", canceled.ID, ErrScheduleClosed},
+		{"executed", executed.ID, ErrScheduleClosed},
+		{"unknown", "sch_missing", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.CancelScheduledAction(asAdmin("bob"), tt.id); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if gw.made() != 1 {
+		t.Fatalf("%d refunds made, want only the one not canceled", gw.made())
+	}
+	if done, _ := s.ScheduledActions(ctx, ScheduleRefund, ScheduleDone); len(done) != 1 || done[0].ID != executed.ID {
+		t.Fatalf("done = %+v, want %s", done, executed.ID)
+	}
+}
+
+func TestAbandonedExecutionResumed(t *testing.T) {
+	tests := []struct {
+		name  string
+		lease time.Duration
+		runs  bool
+	}{
+		{"lease lapsed", -time.Minute, true},
+		{"lease held", time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &scheduleGateway{fakeGateway: newFakeGateway()}
+			s, _ := scheduleService(t, gw)
+			ctx := context.Background()
+			// Left running by an instance that died mid-execution
+			a, err := s.ScheduleRefund(asAdmin("alice"), RefundRequest{PaymentID: "pay_1", Amount: 1000, ExecuteAt: at(time.Minute)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.schedules.Update(ctx, a.ID, func(a *ScheduledAction) error {
+				a.Status, a.Attempts, a.LeaseUntil = ScheduleRunning, 1, at(tt.lease)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			s.runDueActions(ctx)
+			got, _ := s.ScheduledAction(ctx, a.ID)
+			if ran := got.Status == ScheduleDone; ran != tt.runs || (ran && gw.made() != 1) {
+				t.Fatalf("action %s after %d refunds, want run %v", got.Status, gw.made(), tt.runs)
+			}
+		})
+	}
+}
@@ -0,0 +1,756 @@
+// Package service implements order creation, checkout sessions and payment
+// verification independently of any transport.
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/egress"
+	"github.com/yash170603/golang_payment/flags"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/objstore"
+	"github.com/yash170603/golang_payment/razorpaysig"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// Service handles all payment related operations
+type Service struct {
+	gateway  gateway.Gateway
+	store    OrderStore
+	cfg      config.Config
+	sessions *sessionStore
+	notes    *notesSchemaHolder
+	replays  ReplayStore
+	orders   *orderCache
+	fetches  orderFetches
+	webhooks *webhookPool
+	notifier *notify.Notifier
+	sms      *notify.SMS
+	clock    clock.Clock
+	receipts ReceiptStore
+	events   *eventBus
+	funnel   *funnelTracker
+	ledger   LedgerStore
+	credits  CreditStore
+	// schedules holds refunds and captures to make later
+	schedules ScheduleStore
+
+	capturePolicy   *capturePolicyHolder
+	tagRules        *tagRulesHolder
+	reviews         *captureReviews
+	creditHolds     *creditHolds
+	refundApprovals *refundApprovals
+	recoveries      *paymentRecoveries
+	fulfillments    *fulfillments
+
+	flags   flags.Evaluator
+	methods methodsCache
+
+	// runners are the background workers, stopped by Shutdown
+	runners      *runner.Manager
+	shutdownOnce sync.Once
+	started      time.Time
+
+	tenants    TenantStore
+	newGateway GatewayFactory
+	brands     *Brands
+	smokeTests *smokeTestStore
+	// accounts route new orders between Razorpay accounts, when set
+	accounts *Accounts
+	// archive receives old orders and webhook events, when set
+	archive objstore.Store
+	// egress is the policy of requests to fulfillment URLs
+	egress egress.Policy
+	// ordering holds back webhook events arriving before their predecessor
+	ordering *webhookOrdering
+}
+
+// Option configures optional Service dependencies
+type Option func(*Service)
+
+// PaymentRequest represents the incoming payment creation request
+type PaymentRequest struct {
+	Amount int `json:"amount"`
+	// Currency defaults to the merchant's, or the configured default
+	Currency string            `json:"currency"`
+	Notes    map[string]string `json:"notes"`
+	// LineItems optionally itemises Amount for invoices; they must sum to it
+	LineItems []LineItem `json:"line_items"`
+	// FulfillmentURL receives a signed POST once the order is paid; its
+	// host must be allow-listed
+	FulfillmentURL string `json:"fulfillment_url"`
+	// DryRun validates the order and returns a synthetic one without
+	// calling Razorpay; it is refused unless ORDER_DRY_RUN_ENABLED is set
+	DryRun bool `json:"dry_run"`
+	// ApplyCredit pays what it can of Amount from the store credit of
+	// CustomerID, leaving Razorpay the rest
+	ApplyCredit bool   `json:"apply_credit"`
+	CustomerID  string `json:"customer_id"`
+	// Brand defaults to the API key's brand, then DEFAULT_BRAND
+	Brand string `json:"brand"`
+}
+
+// PaymentVerificationRequest represents the payment verification payload
+type PaymentVerificationRequest struct {
+	ServerOrderID     string `json:"order_id" binding:"required"`
+	RazorpayPaymentID string `json:"razorpay_payment_id" binding:"required"`
+	RazorpaySignature string `json:"razorpay_signature" binding:"required"`
+	OrderToken        string `json:"order_token" binding:"required"`
+	// ClientToken is the client_token the order was created with, required
+	// when VERIFY_CLIENT_BINDING is on
+	ClientToken string `json:"client_token"`
+	// IdempotencyKey lets a client safely retry a successful verification
+	IdempotencyKey string `json:"-"`
+}
+
+// PublicConfig is the checkout configuration safe to hand to browsers
+type PublicConfig struct {
+	KeyID           string       `json:"key_id"`
+	Currency        string       `json:"currency"`
+	NotesSchema     *NotesSchema `json:"notes_schema"`
+	NotesSchemaMode string       `json:"notes_schema_mode"`
+	// Methods are the payment methods enabled on the account, omitted when
+	// Razorpay has not said and no default is configured
+	Methods map[string]bool `json:"methods,omitempty"`
+	// FailoverKeyID opens checkout for orders whose provider is
+	// "secondary", when provider failover is enabled
+	FailoverKeyID string `json:"failover_key_id,omitempty"`
+	// AccountKeyIDs open checkout for orders whose provider names one of
+	// the accounts orders are routed to
+	AccountKeyIDs map[string]string `json:"account_key_ids,omitempty"`
+}
+
+// New creates a Service on top of gw, recording orders in store
+func New(gw gateway.Gateway, store OrderStore, cfg config.Config, opts ...Option) (*Service, error) {
+	if cfg.APIKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("missing required configuration")
+	}
+
+	if err := checkCurrencies(cfg.DefaultCurrency, cfg.AllowedCurrencies); err != nil {
+		return nil, fmt.Errorf("currency configuration: %w", err)
+	}
+
+	if err := checkDefaultMethods(cfg.CheckoutMethodsDefault); err != nil {
+		return nil, fmt.Errorf("CHECKOUT_METHODS_DEFAULT: %w", err)
+	}
+
+	notes, err := newNotesSchemaHolder(cfg.NotesSchemaFile, cfg.NotesSchemaMode)
+	if err != nil {
+		return nil, fmt.Errorf("load notes schema: %w", err)
+	}
+
+	capturePolicy, err := newCapturePolicyHolder(cfg.CapturePolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load capture policy: %w", err)
+	}
+
+	tagRules, err := newTagRulesHolder(cfg.TagRulesFile, cfg.TagVocabulary)
+	if err != nil {
+		return nil, fmt.Errorf("load tag rules: %w", err)
+	}
+
+	s := &Service{
+		gateway:       gw,
+		store:         store,
+		cfg:           cfg,
+		notes:         notes,
+		capturePolicy: capturePolicy,
+		tagRules:      tagRules,
+		smokeTests:    newSmokeTestStore(),
+		clock:         clock.Real{},
+		flags:         flags.Static(nil),
+		egress:        EgressPolicy(cfg),
+		started:       time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.accounts != nil {
+		for _, acct := range s.accounts.List() {
+			if acct.KeyID == cfg.APIKey {
+				return nil, fmt.Errorf("account %q: key_id must name another account than RAZORPAY_API_KEY", acct.Name)
+			}
+		}
+	}
+	if s.replays == nil {
+		s.replays = NewMemoryReplayStore(s.clock)
+	}
+	if s.receipts == nil {
+		s.receipts = &MemoryReceiptStore{}
+	}
+	if s.ledger == nil {
+		s.ledger = NewMemoryLedger()
+	}
+	if s.credits == nil {
+		s.credits = NewMemoryCreditStore()
+	}
+	if s.schedules == nil {
+		s.schedules = NewMemoryScheduleStore()
+	}
+	s.sessions = newSessionStore(s.clock, cfg.ClockSkewTolerance)
+	s.orders = newOrderCache(cfg.OrderCacheSize, s.clock)
+	s.events = newEventBus(cfg.EventStreamBuffer)
+	s.funnel = newFunnelTracker(cfg.FunnelRetention, cfg.FunnelMaxOrders)
+	s.runners = runner.New()
+	s.startWebhookPool()
+	s.startCaptureSweeper()
+	s.startFulfillments()
+	s.startCreditSweeper()
+	s.startRefundApprovalSweeper()
+	s.startOrderExpirySweeper()
+	s.startScheduler()
+	s.startRecoverySender()
+	s.startWebhookDriftCheck()
+	s.startArchiver()
+	s.startWebhookOrdering()
+	s.runners.Start(context.Background())
+	return s, nil
+}
+
+// WithClock makes the service read the time from c instead of the system
+// clock
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// ReloadNotesSchema re-reads the notes schema file. The previous schema
+// stays in effect when the file fails to load.
+func (s *Service) ReloadNotesSchema() error {
+	return s.notes.reload()
+}
+
+// CreateOrder validates req, creates the order and returns the provider's
+// order object with an order_token added
+func (s *Service) CreateOrder(ctx context.Context, req PaymentRequest) (map[string]interface{}, error) {
+	return s.createRequestedOrder(ctx, req, "")
+}
+
+// createRequestedOrder is CreateOrder with the receipt to create the order
+// under, generated when empty
+func (s *Service) createRequestedOrder(ctx context.Context, req PaymentRequest, receipt string) (map[string]interface{}, error) {
+	if req.DryRun && !s.cfg.OrderDryRunEnabled {
+		return nil, ErrDryRunDisabled
+	}
+	currency, err := s.orderCurrency(ctx, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAmount(currency, req.Amount); err != nil {
+		return nil, err
+	}
+	if err := validateLineItems(currency, req.Amount, req.LineItems); err != nil {
+		return nil, err
+	}
+	if req.FulfillmentURL != "" {
+		if err := s.checkFulfillmentURL(req.FulfillmentURL); err != nil {
+			return nil, err
+		}
+	}
+	notes, err := s.orderNotes(req.Notes)
+	if err != nil {
+		return nil, err
+	}
+	brand, err := s.resolveBrand(ctx, req.Brand)
+	if err != nil {
+		return nil, err
+	}
+
+	var credit *OrderCredit
+	charged := req.Amount
+	if req.ApplyCredit {
+		if credit, err = s.requestedCredit(ctx, req, currency); err != nil {
+			return nil, err
+		}
+		if credit != nil {
+			charged -= credit.Amount
+		}
+	}
+
+	order, err := s.createOrder(ctx, orderParams{
+		Amount:         charged,
+		Receipt:        receipt,
+		Currency:       currency,
+		Notes:          notes,
+		LineItems:      req.LineItems,
+		FulfillmentURL: req.FulfillmentURL,
+		CustomerID:     req.CustomerID,
+		Credit:         credit,
+		Brand:          brandName(brand),
+		DryRun:         req.DryRun,
+	})
+	if err != nil {
+		if credit != nil {
+			if err := s.dropHold(ctx, *credit); err != nil {
+				log.Printf("Error releasing credit hold %s: %v", credit.HoldID, err)
+			}
+		}
+		return nil, err
+	}
+	if req.ApplyCredit {
+		order["amount_total"] = req.Amount
+		order["credit_applied"] = req.Amount - charged
+	}
+	if len(req.LineItems) > 0 {
+		order["line_items"] = req.LineItems
+	}
+	if brand != nil {
+		order["brand"] = brand.Name
+	}
+
+	token, err := s.issueOrderToken(order)
+	if err != nil {
+		return nil, fmt.Errorf("issue order token: %w", err)
+	}
+	order["order_token"] = token
+
+	return order, nil
+}
+
+// orderNotes validates the caller's notes and adds the created_at note
+func (s *Service) orderNotes(requested map[string]string) (map[string]string, error) {
+	if err := s.checkNotes(requested); err != nil {
+		return nil, err
+	}
+
+	notes := map[string]string{
+		"created_at": s.clock.Now().Format(time.RFC3339),
+	}
+	for k, v := range requested {
+		notes[k] = v
+	}
+	if len(notes) > maxNotes {
+		return nil, invalidRequest("an order takes at most %d notes including created_at, got %d", maxNotes, len(notes))
+	}
+	return notes, nil
+}
+
+// withDefaultNotes returns notes with the configured default notes added
+// under them: caller keys win, and defaults that would exceed Razorpay's
+// notes limit are left out, in key order
+func (s *Service) withDefaultNotes(notes map[string]string) map[string]string {
+	if len(s.cfg.OrderDefaultNotes) == 0 {
+		return notes
+	}
+	merged := make(map[string]string, len(notes)+len(s.cfg.OrderDefaultNotes))
+	for k, v := range notes {
+		merged[k] = v
+	}
+	keys := make([]string, 0, len(s.cfg.OrderDefaultNotes))
+	for k := range s.cfg.OrderDefaultNotes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, set := merged[k]; set {
+			continue
+		}
+		if len(merged) >= maxNotes {
+			log.Printf("Leaving default note %q off order: notes limit reached", k)
+			continue
+		}
+		merged[k] = s.cfg.OrderDefaultNotes[k]
+	}
+	return merged
+}
+
+// orderParams describes an order to create
+type orderParams struct {
+	Amount int
+	// Receipt is generated when empty
+	Receipt string
+	// Currency defaults to the configured default
+	Currency       string
+	Notes          map[string]string
+	LineItems      []LineItem
+	FulfillmentURL string
+	// CustomerID keys flag rollouts when the customer is known
+	CustomerID string
+	// Credit is store credit held towards the order, which Amount excludes.
+	// Orders it pays in full are not sent to Razorpay.
+	Credit *OrderCredit
+	// Brand is the brand the order is sold under, if any
+	Brand string
+	// DryRun skips Razorpay and the store, returning a synthetic order
+	DryRun bool
+}
+
+// newReceipt is the receipt of an order created without one. The random
+// part keeps orders created in the same second, as a batch's are, apart.
+func (s *Service) newReceipt() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rcpt_%d_%s", s.clock.Now().Unix(), hex.EncodeToString(b)), nil
+}
+
+// createOrder calls the gateway and records the order locally. Store
+// failures are logged rather than failing an order that already exists,
+// unless the store write policy is strict. Dry runs stop short of both.
+func (s *Service) createOrder(ctx context.Context, p orderParams) (map[string]interface{}, error) {
+	receipt := p.Receipt
+	if receipt == "" {
+		var err error
+		if receipt, err = s.newReceipt(); err != nil {
+			return nil, err
+		}
+	}
+	currency := s.defaultCurrency(p.Currency)
+	p.Notes = s.withDefaultNotes(p.Notes)
+	p.Notes = s.withFlagNotes(ctx, p.Notes, p.CustomerID)
+	p.Notes = s.limitNotes(p.Notes)
+	data := map[string]interface{}{
+		"amount":   p.Amount,
+		"currency": currency,
+		"receipt":  receipt,
+		"notes":    p.Notes,
+	}
+	if p.DryRun {
+		return s.dryRunOrder(data), nil
+	}
+	clientToken, binding, err := s.newClientBinding()
+	if err != nil {
+		return nil, err
+	}
+
+	var order map[string]interface{}
+	if p.Credit != nil && p.Amount == 0 {
+		order = s.creditOrder(data, p.Credit)
+	} else {
+		if order, err = s.gateway.CreateOrder(s.routeOrder(ctx, p), data); err != nil {
+			return nil, fmt.Errorf("create order: %w", err)
+		}
+		if s.accounts != nil {
+			account, _ := order[gateway.ProviderField].(string)
+			metrics.AccountOrders.WithLabelValues(account).Inc()
+		}
+	}
+	s.orders.put(order)
+
+	now := s.clock.Now()
+	orderID, _ := order["id"].(string)
+	provider, _ := order[gateway.ProviderField].(string)
+	record := Order{
+		ID:             orderID,
+		Amount:         p.Amount,
+		Currency:       currency,
+		Receipt:        receipt,
+		Status:         OrderCreated,
+		Notes:          p.Notes,
+		LineItems:      p.LineItems,
+		FulfillmentURL: p.FulfillmentURL,
+		Credit:         p.Credit,
+		Brand:          p.Brand,
+		Provider:       provider,
+		ClientBinding:  binding,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Timeline:       []TimelineEntry{{At: now, Type: TimelineStatus, To: OrderCreated}},
+	}
+	s.applyTagRules(&record, tagFacts{On: TagOnCreated, Amount: p.Amount, Notes: p.Notes})
+	if err := s.store.Save(ctx, record); err != nil {
+		if s.cfg.StoreWritePolicy == config.StoreWriteStrict {
+			log.Printf("ERROR: order %s exists on Razorpay but could not be saved, it is orphaned: %v", orderID, err)
+			return nil, fmt.Errorf("%w: %v", ErrOrderNotSaved, err)
+		}
+		log.Printf("Error saving order %s: %v", orderID, err)
+	}
+	// Added after caching, so the token is only ever handed to the creator
+	if clientToken != "" {
+		order["client_token"] = clientToken
+	}
+	s.trackFunnel(func(f *funnelTracker, now time.Time) {
+		f.created(orderID, now)
+	})
+	s.notifier.OrderCreated(ctx, notify.OrderCreatedEvent{
+		OrderID:  orderID,
+		Amount:   p.Amount,
+		Currency: currency,
+		Notes:    p.Notes,
+		Brand:    p.Brand,
+	})
+	if p.Credit != nil {
+		s.attachCredit(ctx, p.Credit, orderID)
+		if p.Amount == 0 {
+			s.markOrderPaid(ctx, orderID, "")
+		}
+	}
+
+	return order, nil
+}
+
+// VerifyPayment checks the order token and the Razorpay payment signature,
+// marks the order paid and mints a status token for the order
+func (s *Service) VerifyPayment(ctx context.Context, req PaymentVerificationRequest) (Verification, error) {
+	v, err := s.verifyPayment(ctx, req)
+	tenant, _ := authctx.Tenant(ctx)
+	metrics.Verifications.WithLabelValues(verificationResult(err), metrics.Merchant(tenant)).Inc()
+	return v, err
+}
+
+// verificationResult is the result label of a verification outcome
+func verificationResult(err error) string {
+	switch {
+	case err == nil:
+		return "verified"
+	case errors.Is(err, ErrInvalidOrderToken):
+		return "invalid_token"
+	case errors.Is(err, ErrSessionExpired):
+		return "session_expired"
+	case errors.Is(err, ErrClientBinding):
+		return "client_mismatch"
+	case errors.Is(err, ErrSignatureMalformed):
+		return "signature_malformed"
+	case errors.Is(err, ErrSignatureMismatch):
+		return "signature_mismatch"
+	case errors.Is(err, ErrAlreadyVerified):
+		return "replay"
+	case errors.Is(err, ErrPaymentMismatch):
+		return "payment_mismatch"
+	default:
+		return "error"
+	}
+}
+
+func (s *Service) verifyPayment(ctx context.Context, req PaymentVerificationRequest) (Verification, error) {
+	token, err := s.checkVerification(ctx, req)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	// The signature only proves Razorpay issued the pair; what was paid is
+	// checked against what the order was stored for
+	if s.cfg.VerifyPaymentFetch {
+		if err := s.checkPaymentMatch(ctx, req.ServerOrderID, req.RazorpayPaymentID, token.Amount); err != nil {
+			return Verification{}, err
+		}
+	}
+
+	return s.recordVerification(ctx, req.ServerOrderID, req.RazorpayPaymentID, req.IdempotencyKey)
+}
+
+// checkVerification runs the checks every verification passes before its
+// payment is looked at, single or batched: the order token, which must
+// carry the stored order's amount, the checkout session, the client
+// binding and the payment signature. It returns the decoded order token.
+func (s *Service) checkVerification(ctx context.Context, req PaymentVerificationRequest) (OrderToken, error) {
+	// The order token must be checked before trusting anything else in the request
+	token, err := s.verifyOrderToken(req.OrderToken, req.ServerOrderID)
+	if err != nil {
+		return OrderToken{}, err
+	}
+	if order, err := s.store.Get(ctx, req.ServerOrderID); err == nil && order.Amount != token.Amount {
+		log.Printf("Refused verification of payment %s order %s: order token is for %d, order for %d%s",
+			req.RazorpayPaymentID, req.ServerOrderID, token.Amount, order.Amount, authctx.LogFields(ctx))
+		return OrderToken{}, ErrTokenAmount
+	}
+
+	// Sessions past their expiry can no longer be paid against
+	if session, ok := s.sessions.getByOrder(req.ServerOrderID); ok && session.Status == SessionExpired {
+		return OrderToken{}, ErrSessionExpired
+	}
+
+	// Verify signature. A verification from another client is refused
+	// whatever the signature, but whether it held is logged: a valid one
+	// means a genuine payment triple was replayed from elsewhere.
+	sigErr := s.checkPaymentSignature(ctx, req.ServerOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
+	if err := s.checkClientBinding(ctx, req.ServerOrderID, req.ClientToken); err != nil {
+		log.Printf("Refused verification of payment %s order %s (%v), signature valid: %t%s",
+			req.RazorpayPaymentID, req.ServerOrderID, err, sigErr == nil, authctx.LogFields(ctx))
+		return OrderToken{}, err
+	}
+	switch err := sigErr; {
+	case errors.Is(err, razorpaysig.ErrMalformed):
+		return OrderToken{}, ErrSignatureMalformed
+	case err != nil:
+		// Logged for fraud monitoring; the signature itself never is
+		log.Printf("Payment signature mismatch for payment %s order %s%s",
+			req.RazorpayPaymentID, req.ServerOrderID, authctx.LogFields(ctx))
+		return OrderToken{}, ErrSignatureMismatch
+	}
+	return token, nil
+}
+
+// checkPaymentSignature checks a checkout signature against the key secret
+// of the order's account, counting the result
+func (s *Service) checkPaymentSignature(ctx context.Context, orderID, paymentID, signature string) error {
+	err := razorpaysig.CheckPaymentSignature(orderID, paymentID, signature, s.paymentSecret(ctx, orderID))
+	result := "valid"
+	switch {
+	case errors.Is(err, razorpaysig.ErrMalformed):
+		result = "malformed"
+	case err != nil:
+		result = "invalid"
+	}
+	metrics.SignatureVerifications.WithLabelValues(result).Inc()
+	return err
+}
+
+// recordVerification applies a payment whose signature checked out: it
+// claims the payment ID, marks the order paid and notifies
+func (s *Service) recordVerification(ctx context.Context, orderID, paymentID, idempotencyKey string) (Verification, error) {
+	// Payment IDs are unique per payment, so orders accepting several
+	// payments are unaffected; only a repeat of the same payment is refused
+	claim, err := s.claimPayment(ctx, paymentID, orderID, idempotencyKey)
+	if err != nil {
+		return Verification{}, err
+	}
+	switch claim {
+	case claimReplay:
+		log.Printf("Rejected replayed verification of payment %s for order %s", paymentID, orderID)
+		return Verification{}, ErrAlreadyVerified
+	case claimNew:
+		s.sessions.markPaid(orderID, paymentID)
+		s.markOrderPaid(ctx, orderID, paymentID)
+		s.notifier.Publish(s.paymentVerifiedEvent(ctx, orderID, paymentID, s.orderBrand(ctx, orderID)))
+	}
+
+	return Verification{StatusToken: s.issueStatusToken(orderID)}, nil
+}
+
+// paymentVerifiedEvent is the notification of paymentID paying orderID,
+// sold under brand when not empty. It carries the customer's contact when
+// the order was paid through a checkout session that prefilled one.
+func (s *Service) paymentVerifiedEvent(ctx context.Context, orderID, paymentID, brand string) notify.Event {
+	ev := notify.Event{
+		Type:    notify.EventPaymentVerified,
+		Subject: paymentID,
+		Data:    map[string]interface{}{"order_id": orderID},
+		Headers: notify.Headers(ctx),
+	}
+	if brand != "" {
+		ev.Data["brand"] = brand
+	}
+	if contact := s.sessions.contact(orderID); contact != "" {
+		ev.Data["contact"] = contact
+	}
+	return ev
+}
+
+// markOrderPaid records a successful payment against the local order. A
+// payment arriving after the order expired still pays it within the
+// LateCaptureGrace window; later ones are flagged on the timeline for
+// manual review instead.
+func (s *Service) markOrderPaid(ctx context.Context, orderID, paymentID string) {
+	s.trackFunnel(func(f *funnelTracker, _ time.Time) {
+		f.captured(orderID, paymentID)
+	})
+	var from string
+	paid, err := s.store.Update(ctx, orderID, func(order *Order) error {
+		if order.Override != nil {
+			log.Printf("Not marking order %s paid by payment %s: status was overridden manually", orderID, paymentID)
+			return nil
+		}
+		if order.Status == OrderPaid {
+			return nil
+		}
+
+		now := s.clock.Now()
+		if order.Status == OrderExpired {
+			if late := now.Sub(order.enteredAt()); late > s.cfg.LateCaptureGrace {
+				log.Printf("ANOMALY: payment %s for order %s arrived %s after expiry, beyond the %s grace window; left for manual review",
+					paymentID, orderID, late.Round(time.Second), s.cfg.LateCaptureGrace)
+				order.Timeline = append(order.Timeline, TimelineEntry{
+					At:      now,
+					Type:    TimelineNote,
+					Author:  "system",
+					Message: fmt.Sprintf("Payment %s arrived %s after expiry, beyond the grace window; review manually", paymentID, late.Round(time.Second)),
+				})
+				order.UpdatedAt = now
+				return nil
+			}
+			log.Printf("Reversing expiry of order %s: payment %s arrived within the grace window", orderID, paymentID)
+		}
+
+		// The credit is deducted in the same update, so an order is never
+		// paid without its credit or the reverse
+		if err := s.captureCredit(ctx, order); err != nil {
+			return err
+		}
+		from = order.Status
+		order.PaymentID = paymentID
+		if err := order.transition(OrderPaid, now); err != nil {
+			return err
+		}
+		s.applyTagRules(order, tagFacts{On: OrderPaid, Amount: order.Amount, Notes: order.Notes})
+		return nil
+	})
+	// Orders created before this instance recorded them are not tracked
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error saving order %s: %v", orderID, err)
+	}
+	if err == nil && from != "" {
+		s.publishEvent(EventOrderStatusChanged, map[string]string{
+			"order_id":   orderID,
+			"from":       from,
+			"to":         OrderPaid,
+			"payment_id": paymentID,
+		})
+		s.queueFulfillment(paid)
+		s.recoveryPaid(orderID)
+		if from == OrderExpired {
+			s.notifier.Publish(notify.Event{
+				Type:    notify.EventExpiryReversed,
+				Subject: orderID,
+				Data:    map[string]interface{}{"payment_id": paymentID, "brand": paid.Brand},
+			})
+		}
+	}
+}
+
+// PublicConfig returns the checkout configuration, including the notes
+// schema so frontends can render the fields each order needs and the
+// methods so they only offer what the account supports
+func (s *Service) PublicConfig(ctx context.Context) PublicConfig {
+	return PublicConfig{
+		KeyID:           s.cfg.APIKey,
+		Currency:        s.cfg.DefaultCurrency,
+		NotesSchema:     s.notes.schema(),
+		NotesSchemaMode: s.cfg.NotesSchemaMode,
+		Methods:         s.accountMethods(ctx),
+		FailoverKeyID:   s.cfg.FailoverAPIKey,
+		AccountKeyIDs:   s.accountKeyIDs(),
+	}
+}
+
+// checkNotes applies the notes schema, returning a ValidationError when
+// the notes should be rejected, and the note value length limit
+func (s *Service) checkNotes(notes map[string]string) error {
+	if violations := s.notes.checkNotes(notes); violations != nil {
+		return &ValidationError{
+			Message: "Invalid order notes",
+			Fields:  violations,
+		}
+	}
+	return s.checkNoteLengths(notes)
+}
+
+// intField reads a numeric field from a provider object. The SDK decodes
+// JSON numbers as float64, while fakes tend to use int.
+func intField(m map[string]interface{}, key string) (int, bool) {
+	switch v := m[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// testSecret is the Razorpay key secret of test services
+const testSecret = "test_secret"
+
+// fakeGateway answers the provider calls the tests make from memory.
+// Calls it does not implement panic through the nil embedded Gateway.
+type fakeGateway struct {
+	gateway.Gateway
+
+	mu       sync.Mutex
+	orders   map[string]map[string]interface{}
+	payments map[string]map[string]interface{}
+	// created counts CreateOrder calls
+	created int
+	// createErr fails every CreateOrder when set
+	createErr error
+	// fetches counts FetchPayment calls
+	fetches int
+	// captured are the payments CapturePayment captured
+	captured []string
+	// customers are the customers UpsertCustomer was given
+	customers []map[string]interface{}
+	// links are the payment links CreatePaymentLink was given
+	links []map[string]interface{}
+	// updates counts UpdateOrder calls
+	updates int
+	// pingErr fails Ping, and pingDelay holds it up
+	pingErr   error
+	pingDelay time.Duration
+}
+
+func newFakeGateway() *fakeGateway {
+	return &fakeGateway{
+		orders:   make(map[string]map[string]interface{}),
+		payments: make(map[string]map[string]interface{}),
+	}
+}
+
+func (g *fakeGateway) CreateOrder(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.createErr != nil {
+		return nil, g.createErr
+	}
+	g.created++
+	order := map[string]interface{}{
+		"id":          fmt.Sprintf("order_%d", g.created),
+		"entity":      "order",
+		"amount":      data["amount"],
+		"amount_paid": 0,
+		"amount_due":  data["amount"],
+		"currency":    data["currency"],
+		"receipt":     data["receipt"],
+		"notes":       data["notes"],
+		"status":      "created",
+	}
+	g.orders[order["id"].(string)] = order
+	return copyMap(order), nil
+}
+
+func (g *fakeGateway) FetchOrder(ctx context.Context, id string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	order, ok := g.orders[id]
+	if !ok {
+		return nil, &gateway.RequestError{Message: "order not found"}
+	}
+	return copyMap(order), nil
+}
+
+func (g *fakeGateway) FetchPayment(ctx context.Context, id string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fetches++
+	payment, ok := g.payments[id]
+	if !ok {
+		return nil, &gateway.RequestError{Message: "payment not found"}
+	}
+	return copyMap(payment), nil
+}
+
+// FetchOrderPayments lists the payments recorded against a known order
+func (g *fakeGateway) FetchOrderPayments(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.orders[orderID]; !ok {
+		return nil, &gateway.RequestError{Message: "order not found"}
+	}
+	items := []interface{}{}
+	for _, payment := range g.payments {
+		if payment["order_id"] == orderID {
+			items = append(items, copyMap(payment))
+		}
+	}
+	return map[string]interface{}{"entity": "collection", "count": len(items), "items": items}, nil
+}
+
+func (g *fakeGateway) CapturePayment(ctx context.Context, paymentID string, amount int, currency string) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		return nil, &gateway.RequestError{Message: "payment not found"}
+	}
+	g.captured = append(g.captured, paymentID)
+	return copyMap(payment), nil
+}
+
+// UpdateOrder replaces the order's notes, as Razorpay does
+func (g *fakeGateway) UpdateOrder(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	order, ok := g.orders[id]
+	if !ok {
+		return nil, &gateway.RequestError{Message: "order not found"}
+	}
+	g.updates++
+	notes := map[string]interface{}{}
+	for k, v := range data["notes"].(map[string]string) {
+		notes[k] = v
+	}
+	order["notes"] = notes
+	return copyMap(order), nil
+}
+
+func (g *fakeGateway) UpsertCustomer(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.customers = append(g.customers, copyMap(data))
+	return map[string]interface{}{"id": fmt.Sprintf("cust_%d", len(g.customers)), "entity": "customer"}, nil
+}
+
+func (g *fakeGateway) CreatePaymentLink(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.links = append(g.links, data)
+	return map[string]interface{}{"id": fmt.Sprintf("plink_%d", len(g.links)), "short_url": "https://rzp.io/i/test"}, nil
+}
+
+func (g *fakeGateway) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(g.pingDelay):
+		return g.pingErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ListAll lists nothing, as Razorpay's filters do for orders created
+// moments ago
+func (g *fakeGateway) ListAll(ctx context.Context, entity string, params map[string]interface{}, opts gateway.ListOptions, fn func(item map[string]interface{}) error) error {
+	return nil
+}
+
+func (g *fakeGateway) FetchMethods(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+// pay records a captured payment of amount against orderID
+func (g *fakeGateway) pay(paymentID, orderID string, amount int, currency string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.payments[paymentID] = map[string]interface{}{
+		"id":       paymentID,
+		"entity":   "payment",
+		"order_id": orderID,
+		"amount":   float64(amount),
+		"currency": currency,
+		"status":   "captured",
+	}
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// testConfig is the configuration Load returns with only the Razorpay keys
+// set, so tests run against the real defaults
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	t.Setenv("RAZORPAY_API_KEY", "rzp_test_key")
+	t.Setenv("RAZORPAY_SECRET_KEY", testSecret)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	return cfg
+}
+
+// newTestService returns a service over gw and a memory store, reading the
+// time from a fake clock, shut down when the test ends
+func newTestService(t *testing.T, gw gateway.Gateway, cfg config.Config, opts ...Option) (*Service, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))
+	s, err := New(gw, NewMemoryStore(), cfg, append([]Option{WithClock(clk)}, opts...)...)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s, clk
+}
+
+// testTenants loads tenants into a tenant store through a JSON file
+func testTenants(t *testing.T, tenants ...Tenant) *MemoryTenantStore {
+	t.Helper()
+	raw, err := json.Marshal(tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadTenants(path)
+	if err != nil {
+		t.Fatalf("load tenants: %v", err)
+	}
+	return store
+}
+
+// paymentSignature is the checkout signature Razorpay would send
+func paymentSignature(orderID, paymentID, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(orderID + "|" + paymentID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// createTestOrder creates an order of amount INR, failing the test on error
+func createTestOrder(t *testing.T, s *Service, amount int) map[string]interface{} {
+	t.Helper()
+	order, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: amount})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return order
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+func TestSignatureVerificationMetric(t *testing.T) {
+	tests := []struct {
+		result    string
+		signature func(orderID, paymentID string) string
+		wantErr   error
+	}{
+		{"valid", func(orderID, paymentID string) string { return paymentSignature(orderID, paymentID, testSecret) }, nil},
+		{"invalid", func(orderID, paymentID string) string { return paymentSignature(orderID, paymentID, "other") }, ErrSignatureMismatch},
+		{"malformed", func(string, string) string { return "not-a-signature" }, ErrSignatureMalformed},
+	}
+	counts := func() map[string]float64 {
+		c := make(map[string]float64)
+		for _, result := range []string{"valid", "invalid", "malformed"} {
+			c[result] = testutil.ToFloat64(metrics.SignatureVerifications.WithLabelValues(result))
+		}
+		return c
+	}
+	for _, tt := range tests {
+		t.Run(tt.result, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			ctx := context.Background()
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			before := counts()
+
+			// Once through the single verification path
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			gw.pay("pay_1", orderID, 500, "INR")
+			single := tt.signature(orderID, "pay_1")
+			_, err := s.VerifyPayment(ctx, PaymentVerificationRequest{
+				ServerOrderID:     orderID,
+				RazorpayPaymentID: "pay_1",
+				RazorpaySignature: single,
+				OrderToken:        order["order_token"].(string),
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify: err = %v, want %v", err, tt.wantErr)
+			}
+
+			// and once through the batch one
+			order = createTestOrder(t, s, 500)
+			orderID = order["id"].(string)
+			gw.pay("pay_2", orderID, 500, "INR")
+			batched := tt.signature(orderID, "pay_2")
+			if _, err := s.VerifyPaymentBatch(ctx, BatchVerificationRequest{Items: []BatchVerificationItem{{
+				OrderID:    orderID,
+				PaymentID:  "pay_2",
+				Signature:  batched,
+				OrderToken: order["order_token"].(string),
+			}}}); err != nil {
+				t.Fatal(err)
+			}
+
+			for result, n := range counts() {
+				want := 0.0
+				if result == tt.result {
+					want = 2
+				}
+				if n-before[result] != want {
+					t.Fatalf("signature_verifications_total{%s} rose by %v, want %v", result, n-before[result], want)
+				}
+			}
+			if strings.Contains(buf.String(), single) || strings.Contains(buf.String(), batched) {
+				t.Fatalf("log = %q, a signature was printed", buf.String())
+			}
+		})
+	}
+}
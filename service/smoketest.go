@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/razorpaysig"
+)
+
+// Smoke test step outcomes
+const (
+	StepPassed  = "passed"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+// smokeTestAmount is the order amount, in paise, used to prove keys work
+const smokeTestAmount = 100
+
+// ErrTenantsDisabled is returned when no tenant store is configured
+var ErrTenantsDisabled = errors.New("tenants are not configured")
+
+// SmokeTestStep is the result of one onboarding check
+type SmokeTestStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// SmokeTestReport is the stored outcome of a tenant smoke test
+type SmokeTestReport struct {
+	TenantID   string          `json:"tenant_id"`
+	LiveMode   bool            `json:"live_mode"`
+	Passed     bool            `json:"passed"`
+	OrderID    string          `json:"order_id,omitempty"`
+	Steps      []SmokeTestStep `json:"steps"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+}
+
+type smokeTestStore struct {
+	mu      sync.RWMutex
+	reports map[string]SmokeTestReport
+}
+
+func newSmokeTestStore() *smokeTestStore {
+	return &smokeTestStore{reports: make(map[string]SmokeTestReport)}
+}
+
+// RunSmokeTest proves a tenant's keys work end to end: it creates a 100
+// paise order, fetches it back and round-trips a payment signature with the
+// tenant's secret. Payment simulation is only ever attempted on test keys.
+func (s *Service) RunSmokeTest(ctx context.Context, tenantID string, simulatePayment bool) (SmokeTestReport, error) {
+	if s.tenants == nil {
+		return SmokeTestReport{}, ErrTenantsDisabled
+	}
+	tenant, err := s.tenants.Tenant(ctx, tenantID)
+	if err != nil {
+		return SmokeTestReport{}, err
+	}
+
+	report := SmokeTestReport{
+		TenantID:  tenant.ID,
+		LiveMode:  tenant.LiveMode(),
+		Passed:    true,
+		StartedAt: s.clock.Now(),
+	}
+	step := func(name string, fn func() (string, error)) bool {
+		start := time.Now()
+		detail, err := fn()
+		result := SmokeTestStep{Name: name, Status: StepPassed, Detail: detail}
+		if err != nil {
+			result.Status = StepFailed
+			result.Detail = err.Error()
+			report.Passed = false
+		}
+		result.DurationMS = time.Since(start).Milliseconds()
+		report.Steps = append(report.Steps, result)
+		return err == nil
+	}
+	skip := func(name, reason string) {
+		report.Steps = append(report.Steps, SmokeTestStep{Name: name, Status: StepSkipped, Detail: reason})
+	}
+
+	gw, err := s.newGateway(tenant)
+	if err != nil {
+		return SmokeTestReport{}, fmt.Errorf("build gateway for tenant %s: %w", tenant.ID, err)
+	}
+
+	created := step("create_order", func() (string, error) {
+		order, err := gw.CreateOrder(ctx, map[string]interface{}{
+			"amount":   smokeTestAmount,
+			"currency": "INR",
+			"receipt":  fmt.Sprintf("smoke_%d", s.clock.Now().Unix()),
+			"notes":    map[string]string{"purpose": "onboarding smoke test"},
+		})
+		if err != nil {
+			return "", err
+		}
+		report.OrderID, _ = order["id"].(string)
+		return report.OrderID, nil
+	})
+
+	if created {
+		step("fetch_order", func() (string, error) {
+			order, err := gw.FetchOrder(ctx, report.OrderID)
+			if err != nil {
+				return "", err
+			}
+			if amount, _ := intField(order, "amount"); amount != smokeTestAmount {
+				return "", fmt.Errorf("fetched order amount %d, want %d", amount, smokeTestAmount)
+			}
+			return "order visible via fetch", nil
+		})
+	} else {
+		skip("fetch_order", "no order was created")
+	}
+
+	step("signature", func() (string, error) {
+		const paymentID = "pay_smoketest"
+		signature := razorpaysig.SignPayment(report.OrderID, paymentID, tenant.KeySecret)
+		if !razorpaysig.VerifyPaymentSignature(report.OrderID, paymentID, signature, tenant.KeySecret) {
+			return "", fmt.Errorf("locally generated signature did not verify")
+		}
+		forged := razorpaysig.SignPayment(report.OrderID, paymentID, tenant.KeySecret+"x")
+		if razorpaysig.VerifyPaymentSignature(report.OrderID, paymentID, forged, tenant.KeySecret) {
+			return "", fmt.Errorf("signature from a different secret verified")
+		}
+		return "signature round trip ok", nil
+	})
+
+	switch {
+	case !simulatePayment:
+		skip("simulate_payment", "not requested")
+	case tenant.LiveMode():
+		step("simulate_payment", func() (string, error) {
+			return "", fmt.Errorf("refused: payment simulation never runs against live-mode keys")
+		})
+	default:
+		skip("simulate_payment", "the gateway offers no server-side payment simulation")
+	}
+
+	report.FinishedAt = s.clock.Now()
+
+	s.smokeTests.mu.Lock()
+	s.smokeTests.reports[tenant.ID] = report
+	s.smokeTests.mu.Unlock()
+
+	return report, nil
+}
+
+// SmokeTestResult returns the latest smoke test report for the tenant
+func (s *Service) SmokeTestResult(tenantID string) (SmokeTestReport, error) {
+	s.smokeTests.mu.RLock()
+	defer s.smokeTests.mu.RUnlock()
+
+	report, ok := s.smokeTests.reports[tenantID]
+	if !ok {
+		return SmokeTestReport{}, ErrNotFound
+	}
+	return report, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+func TestRunSmokeTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyID    string
+		simulate bool
+		// createErr fails the tenant's order creation
+		createErr error
+		passed    bool
+		// steps are the status of each step, in order
+		steps []string
+	}{
+		{
+			name: "test keys", keyID: "rzp_test_acme", passed: true,
+			steps: []string{StepPassed, StepPassed, StepPassed, StepSkipped},
+		},
+		{
+			name: "test keys, simulation asked", keyID: "rzp_test_acme", simulate: true, passed: true,
+			steps: []string{StepPassed, StepPassed, StepPassed, StepSkipped},
+		},
+		{
+			name: "live keys, simulation refused", keyID: "rzp_live_acme", simulate: true, passed: false,
+			steps: []string{StepPassed, StepPassed, StepPassed, StepFailed},
+		},
+		{
+			name: "keys rejected", keyID: "rzp_test_acme", createErr: &gateway.RequestError{Message: "Authentication failed"}, passed: false,
+			steps: []string{StepFailed, StepSkipped, StepPassed, StepSkipped},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantGateway := newFakeGateway()
+			tenantGateway.createErr = tt.createErr
+			var built Tenant
+			tenants := testTenants(t, Tenant{ID: "acme", KeyID: tt.keyID, KeySecret: "acme_secret"})
+			s, _ := newTestService(t, newFakeGateway(), testConfig(t), WithTenants(tenants, func(tenant Tenant) (gateway.Gateway, error) {
+				built = tenant
+				return tenantGateway, nil
+			}))
+
+			report, err := s.RunSmokeTest(context.Background(), "acme", tt.simulate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if built.KeyID != tt.keyID {
+				t.Fatalf("gateway built for key %q, want the tenant's %q", built.KeyID, tt.keyID)
+			}
+			if report.Passed != tt.passed || report.LiveMode != (tt.keyID == "rzp_live_acme") {
+				t.Fatalf("passed %v live %v, want passed %v", report.Passed, report.LiveMode, tt.passed)
+			}
+			if len(report.Steps) != len(tt.steps) {
+				t.Fatalf("steps = %+v", report.Steps)
+			}
+			for i, step := range report.Steps {
+				if step.Status != tt.steps[i] {
+					t.Fatalf("step %s = %s, want %s: %s", step.Name, step.Status, tt.steps[i], step.Detail)
+				}
+			}
+			if tt.createErr == nil && tenantGateway.orders[report.OrderID]["amount"] != smokeTestAmount {
+				t.Fatalf("smoke order = %v, want %d paise", tenantGateway.orders[report.OrderID], smokeTestAmount)
+			}
+
+			stored, err := s.SmokeTestResult("acme")
+			if err != nil || stored.Passed != report.Passed || len(stored.Steps) != len(report.Steps) {
+				t.Fatalf("stored report = %+v, %v", stored, err)
+			}
+		})
+	}
+}
+
+func TestRunSmokeTestRefused(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	if _, err := s.RunSmokeTest(context.Background(), "acme", false); !errors.Is(err, ErrTenantsDisabled) {
+		t.Fatalf("without tenants: err = %v, want ErrTenantsDisabled", err)
+	}
+
+	tenants := testTenants(t, Tenant{ID: "acme", KeyID: "rzp_test_acme", KeySecret: "acme_secret"})
+	s, _ = newTestService(t, newFakeGateway(), testConfig(t), WithTenants(tenants, func(Tenant) (gateway.Gateway, error) {
+		return newFakeGateway(), nil
+	}))
+	if _, err := s.RunSmokeTest(context.Background(), "globex", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown tenant: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.SmokeTestResult("acme"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("result before any run: err = %v, want ErrNotFound", err)
+	}
+}
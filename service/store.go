@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrOrderNotSaved is an order created on Razorpay that the store failed to
+// save, returned under the strict store write policy
+var ErrOrderNotSaved = errors.New("order could not be saved")
+
+// Order statuses tracked locally
+const (
+	OrderCreated  = "created"
+	OrderPaid     = "paid"
+	OrderFailed   = "failed"
+	OrderExpired  = "expired"
+	OrderRefunded = "refunded"
+	// OrderAbandoned orders had their checkout closed without paying; they
+	// can still be paid
+	OrderAbandoned = "abandoned"
+)
+
+// Timeline entry types
+const (
+	TimelineStatus   = "status"
+	TimelineNote     = "note"
+	TimelineOverride = "status_override"
+	TimelineRenotify = "renotify"
+	TimelineTag      = "tag"
+)
+
+// TimelineEntry is one event in an order's history
+type TimelineEntry struct {
+	At        time.Time `json:"at"`
+	Type      string    `json:"type"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+}
+
+// StatusOverride records an operator setting an order's status by hand
+type StatusOverride struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	Reference string    `json:"reference,omitempty"`
+	Author    string    `json:"author"`
+	Forced    bool      `json:"forced"`
+	At        time.Time `json:"at"`
+}
+
+// Order is the local record of an order created through this service
+type Order struct {
+	ID        string            `json:"id"`
+	Amount    int               `json:"amount"`
+	Currency  string            `json:"currency"`
+	Receipt   string            `json:"receipt"`
+	Status    string            `json:"status"`
+	Notes     map[string]string `json:"notes,omitempty"`
+	LineItems []LineItem        `json:"line_items,omitempty"`
+	PaymentID string            `json:"payment_id,omitempty"`
+	// FulfillmentURL is told once when the order is paid
+	FulfillmentURL string          `json:"fulfillment_url,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Timeline       []TimelineEntry `json:"timeline,omitempty"`
+	// Override is set once an operator changed the status by hand; such
+	// orders are left alone by automatic updates
+	Override *StatusOverride `json:"override,omitempty"`
+	// Credit is the store credit applied to the order, if any
+	Credit *OrderCredit `json:"credit,omitempty"`
+	// Brand is the brand the order was sold under, if any
+	Brand string `json:"brand,omitempty"`
+	// Tags are from TAG_VOCABULARY, sorted
+	Tags []string `json:"tags,omitempty"`
+	// Provider is the account that created the order, one of the
+	// gateway.Provider* names, when provider failover is enabled
+	Provider string `json:"provider,omitempty"`
+	// ClientBinding is set when the order was created with
+	// VERIFY_CLIENT_BINDING on
+	ClientBinding *ClientBinding `json:"client_binding,omitempty"`
+	// Archive is set on the stub left in the store once the order is
+	// archived
+	Archive *OrderArchive `json:"archive,omitempty"`
+	// Archived is set on orders read back from the archive
+	Archived bool `json:"archived,omitempty"`
+}
+
+// ClientBinding ties an order to the client that created it. Only a hash
+// of the client token is kept.
+type ClientBinding struct {
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OrderStore persists local order records
+type OrderStore interface {
+	// Save inserts or replaces the order
+	Save(ctx context.Context, order Order) error
+	// Get returns the order or ErrNotFound
+	Get(ctx context.Context, id string) (Order, error)
+	// GetByReceipt returns the order with the receipt or ErrNotFound
+	GetByReceipt(ctx context.Context, receipt string) (Order, error)
+	// Update applies fn to the stored order atomically and saves the result
+	// unless fn fails. It returns ErrNotFound for unknown orders.
+	Update(ctx context.Context, id string, fn func(*Order) error) (Order, error)
+	// Search returns up to limit orders matching q, newest first, after
+	// skipping skip of them
+	Search(ctx context.Context, q OrderQuery, skip, limit int) ([]Order, error)
+	// Archivable returns up to limit orders not yet archived and not
+	// updated since before, least recently updated first
+	Archivable(ctx context.Context, before time.Time, limit int) ([]Order, error)
+	// Expirable returns up to limit orders still awaiting payment created
+	// before before, oldest first. Overridden and archived orders are left
+	// out.
+	Expirable(ctx context.Context, before time.Time, limit int) ([]Order, error)
+}
+
+// OrderQuery selects orders by every condition set
+type OrderQuery struct {
+	// NoteKey and NoteValue match orders whose note NoteKey is NoteValue
+	NoteKey   string
+	NoteValue string
+	// Tags match orders carrying all of them
+	Tags []string
+}
+
+func (q OrderQuery) matches(order Order) bool {
+	if q.NoteKey != "" {
+		if v, ok := order.Notes[q.NoteKey]; !ok || v != q.NoteValue {
+			return false
+		}
+	}
+	for _, tag := range q.Tags {
+		if !slices.Contains(order.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryStore is an OrderStore kept in process memory
+type MemoryStore struct {
+	mu        sync.RWMutex
+	orders    map[string]Order
+	byReceipt map[string]string
+}
+
+// NewMemoryStore returns an empty in-memory OrderStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders:    make(map[string]Order),
+		byReceipt: make(map[string]string),
+	}
+}
+
+func (m *MemoryStore) Save(ctx context.Context, order Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.orders[order.ID] = order
+	if order.Receipt != "" {
+		m.byReceipt[order.Receipt] = order.ID
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetByReceipt(ctx context.Context, receipt string) (Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	order, ok := m.orders[m.byReceipt[receipt]]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return order, nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id string) (Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	order, ok := m.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return order, nil
+}
+
+func (m *MemoryStore) Update(ctx context.Context, id string, fn func(*Order) error) (Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order, ok := m.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	// Copy the slices so a failed fn cannot leave partial edits behind
+	order.Timeline = append([]TimelineEntry(nil), order.Timeline...)
+	order.Tags = append([]string(nil), order.Tags...)
+	if order.Credit != nil {
+		credit := *order.Credit
+		order.Credit = &credit
+	}
+	if err := fn(&order); err != nil {
+		return Order{}, err
+	}
+	m.orders[id] = order
+	return order, nil
+}
+
+// Search scans every order, so it costs the same with or without a match
+func (m *MemoryStore) Search(ctx context.Context, q OrderQuery, skip, limit int) ([]Order, error) {
+	m.mu.RLock()
+	var matches []Order
+	for _, order := range m.orders {
+		if q.matches(order) {
+			matches = append(matches, order)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if skip >= len(matches) {
+		return []Order{}, nil
+	}
+	matches = matches[skip:]
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (m *MemoryStore) Archivable(ctx context.Context, before time.Time, limit int) ([]Order, error) {
+	m.mu.RLock()
+	var due []Order
+	for _, order := range m.orders {
+		if order.Archive == nil && order.UpdatedAt.Before(before) {
+			due = append(due, order)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].UpdatedAt.Equal(due[j].UpdatedAt) {
+			return due[i].UpdatedAt.Before(due[j].UpdatedAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *MemoryStore) Expirable(ctx context.Context, before time.Time, limit int) ([]Order, error) {
+	m.mu.RLock()
+	var due []Order
+	for _, order := range m.orders {
+		if canTransition(order.Status, OrderExpired) && order.Override == nil && order.Archive == nil && order.CreatedAt.Before(before) {
+			due = append(due, order)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].CreatedAt.Equal(due[j].CreatedAt) {
+			return due[i].CreatedAt.Before(due[j].CreatedAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
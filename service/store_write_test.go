@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yash170603/golang_payment/config"
+)
+
+// unsavableStore fails every Save
+type unsavableStore struct {
+	OrderStore
+}
+
+func (unsavableStore) Save(ctx context.Context, o Order) error {
+	return errors.New("disk full")
+}
+
+func TestStoreWritePolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr error
+		wantLog string
+	}{
+		{config.StoreWriteBestEffort, nil, "Error saving order order_1"},
+		{config.StoreWriteStrict, ErrOrderNotSaved, "ERROR: order order_1 exists on Razorpay but could not be saved, it is orphaned"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.StoreWritePolicy = tt.policy
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, cfg)
+			s.store = unsavableStore{OrderStore: s.store}
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			order, err := s.CreateOrder(context.Background(), PaymentRequest{Amount: 500})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (order["id"] != "order_1" || order["order_token"] == nil) {
+				t.Fatalf("order = %v, want it returned with its token", order)
+			}
+			if tt.wantErr != nil && order != nil {
+				t.Fatalf("order = %v, want none returned", order)
+			}
+			if gw.created != 1 {
+				t.Fatalf("%d Razorpay orders, want 1", gw.created)
+			}
+			if !strings.Contains(buf.String(), tt.wantLog) || !strings.Contains(buf.String(), "disk full") {
+				t.Fatalf("log = %q, want %q with the cause", buf.String(), tt.wantLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+// Tenant is a merchant with its own Razorpay key pair
+type Tenant struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	KeyID     string `json:"key_id"`
+	KeySecret string `json:"key_secret"`
+	// DefaultCurrency and AllowedCurrencies override the configured ones
+	// for this merchant's orders when set
+	DefaultCurrency   string   `json:"default_currency,omitempty"`
+	AllowedCurrencies []string `json:"allowed_currencies,omitempty"`
+	// RateLimit caps the merchant's API requests per minute; zero falls
+	// back to MERCHANT_RATE_LIMIT
+	RateLimit int `json:"rate_limit,omitempty"`
+}
+
+// LiveMode reports whether the tenant's keys move real money
+func (t Tenant) LiveMode() bool {
+	return strings.HasPrefix(t.KeyID, "rzp_live_")
+}
+
+// TenantStore looks up merchants
+type TenantStore interface {
+	// Tenant returns the merchant or ErrNotFound
+	Tenant(ctx context.Context, id string) (Tenant, error)
+}
+
+// GatewayFactory builds a gateway authenticated as the tenant
+type GatewayFactory func(t Tenant) (gateway.Gateway, error)
+
+// WithTenants enables the per-tenant endpoints
+func WithTenants(tenants TenantStore, factory GatewayFactory) Option {
+	return func(s *Service) {
+		s.tenants = tenants
+		s.newGateway = factory
+	}
+}
+
+// MemoryTenantStore is a TenantStore loaded once from a JSON file
+type MemoryTenantStore struct {
+	tenants map[string]Tenant
+}
+
+// LoadTenants reads a JSON array of tenants from path
+func LoadTenants(path string) (*MemoryTenantStore, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Tenant
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	store := &MemoryTenantStore{tenants: make(map[string]Tenant, len(list))}
+	for _, t := range list {
+		if t.ID == "" || t.KeyID == "" || t.KeySecret == "" {
+			return nil, fmt.Errorf("tenant %q: id, key_id and key_secret are required", t.ID)
+		}
+		if err := checkCurrencies(t.DefaultCurrency, t.AllowedCurrencies); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", t.ID, err)
+		}
+		if t.RateLimit < 0 {
+			return nil, fmt.Errorf("tenant %q: rate_limit must not be negative", t.ID)
+		}
+		if _, dup := store.tenants[t.ID]; dup {
+			return nil, fmt.Errorf("duplicate tenant %q", t.ID)
+		}
+		store.tenants[t.ID] = t
+	}
+	return store, nil
+}
+
+// checkCurrencies rejects unknown currencies and a default that is not
+// itself allowed. Empty values are left to the configured ones.
+func checkCurrencies(def string, allowed []string) error {
+	for _, code := range append([]string{def}, allowed...) {
+		if _, ok := currencies[code]; code != "" && !ok {
+			return fmt.Errorf("unsupported currency %q", code)
+		}
+	}
+	if def != "" && len(allowed) > 0 && !slices.Contains(allowed, def) {
+		return fmt.Errorf("default currency %s is not in allowed_currencies", def)
+	}
+	return nil
+}
+
+// orderCurrency resolves the currency of a new order: requested, or the
+// default of the calling merchant, falling back to the configured default.
+// The result must be one the merchant, or the configuration, allows.
+func (s *Service) orderCurrency(ctx context.Context, requested string) (string, error) {
+	def, allowed, err := s.merchantCurrencies(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	currency := strings.ToUpper(requested)
+	if currency == "" {
+		currency = def
+	}
+	if !slices.Contains(allowed, currency) {
+		return "", invalidRequest("currency %s is not allowed, use one of %s", currency, strings.Join(allowed, ", "))
+	}
+	return currency, nil
+}
+
+// merchantCurrencies returns the default and allowed currencies of the
+// calling merchant, falling back to the configured ones
+func (s *Service) merchantCurrencies(ctx context.Context) (string, []string, error) {
+	def, allowed := s.cfg.DefaultCurrency, s.cfg.AllowedCurrencies
+	if id, ok := authctx.Tenant(ctx); ok && s.tenants != nil {
+		tenant, err := s.tenants.Tenant(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return "", nil, invalidRequest("unknown merchant %q", id)
+			}
+			return "", nil, err
+		}
+		if tenant.DefaultCurrency != "" {
+			def = tenant.DefaultCurrency
+		}
+		if len(tenant.AllowedCurrencies) > 0 {
+			allowed = tenant.AllowedCurrencies
+		}
+	}
+	return def, allowed, nil
+}
+
+// CheckMerchant refuses a merchant the tenant store does not know. Any
+// merchant passes when no tenants are configured.
+func (s *Service) CheckMerchant(ctx context.Context, id string) error {
+	if s.tenants == nil {
+		return nil
+	}
+	if _, err := s.tenants.Tenant(ctx, id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return invalidRequest("unknown merchant %q", id)
+		}
+		return err
+	}
+	return nil
+}
+
+// MerchantRateLimit returns the rate limit set on the merchant, or zero
+// when it has none or is unknown
+func (s *Service) MerchantRateLimit(ctx context.Context, id string) int {
+	if s.tenants == nil {
+		return 0
+	}
+	tenant, err := s.tenants.Tenant(ctx, id)
+	if err != nil {
+		return 0
+	}
+	return tenant.RateLimit
+}
+
+func (m *MemoryTenantStore) Tenant(ctx context.Context, id string) (Tenant, error) {
+	t, ok := m.tenants[id]
+	if !ok {
+		return Tenant{}, ErrNotFound
+	}
+	return t, nil
+}
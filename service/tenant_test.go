@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/gateway"
+)
+
+func TestOrderCurrencyPerMerchant(t *testing.T) {
+	tenants := testTenants(t,
+		Tenant{ID: "acme", KeyID: "rzp_test_acme", KeySecret: "acme_secret", DefaultCurrency: "USD", AllowedCurrencies: []string{"USD", "EUR"}},
+		Tenant{ID: "globex", KeyID: "rzp_test_globex", KeySecret: "globex_secret", AllowedCurrencies: []string{"INR", "SGD"}},
+		Tenant{ID: "initech", KeyID: "rzp_test_initech", KeySecret: "initech_secret"},
+	)
+	gw := newFakeGateway()
+	cfg := testConfig(t)
+	cfg.DefaultCurrency, cfg.AllowedCurrencies = "INR", []string{"INR", "GBP"}
+	s, _ := newTestService(t, gw, cfg, WithTenants(tenants, func(Tenant) (gateway.Gateway, error) { return gw, nil }))
+
+	tests := []struct {
+		name      string
+		tenant    string
+		requested string
+		// want is the order currency, empty when the request is refused
+		want string
+	}{
+		{"merchant default", "acme", "", "USD"},
+		{"merchant allows", "acme", "eur", "EUR"},
+		{"merchant refuses", "acme", "INR", ""},
+		{"allowed elsewhere only", "acme", "SGD", ""},
+		{"other merchant's set", "globex", "SGD", "SGD"},
+		{"default from config", "globex", "", "INR"},
+		{"refused by other merchant", "globex", "USD", ""},
+		{"nothing set", "initech", "GBP", "GBP"},
+		{"nothing set refuses", "initech", "USD", ""},
+		{"no merchant", "", "", "INR"},
+		{"unknown merchant", "umbrella", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.tenant != "" {
+				ctx = authctx.WithTenant(ctx, tt.tenant)
+			}
+			order, err := s.CreateOrder(ctx, PaymentRequest{Amount: 50000, Currency: tt.requested})
+			if tt.want == "" {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if order["currency"] != tt.want {
+				t.Fatalf("currency = %v, want %s", order["currency"], tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTenantsChecksCurrencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants string
+		wantErr string
+	}{
+		{"valid", `[{"id":"acme","key_id":"k","key_secret":"s","default_currency":"USD","allowed_currencies":["USD","EUR"]}]`, ""},
+		{"unknown default", `[{"id":"acme","key_id":"k","key_secret":"s","default_currency":"XYZ"}]`, `unsupported currency "XYZ"`},
+		{"unknown allowed", `[{"id":"acme","key_id":"k","key_secret":"s","allowed_currencies":["INR","XYZ"]}]`, `unsupported currency "XYZ"`},
+		{"default not allowed", `[{"id":"acme","key_id":"k","key_secret":"s","default_currency":"INR","allowed_currencies":["USD"]}]`, "not in allowed_currencies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenants.json")
+			if err := os.WriteFile(path, []byte(tt.tenants), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadTenants(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
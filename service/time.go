@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+// checkWindow checks w against the service clock with the configured skew
+// tolerance. Every token, session and record validity check goes through it.
+func (s *Service) checkWindow(w clock.Window) error {
+	return w.Check(s.clock.Now(), s.cfg.ClockSkewTolerance)
+}
+
+// TimeReport describes the service's view of the time, for diagnosing
+// clock skew between instances
+type TimeReport struct {
+	// ServerTime is the clock time-window checks use, which is frozen when
+	// FREEZE_TIME is set; SystemTime is the host's
+	ServerTime    time.Time `json:"server_time"`
+	SystemTime    time.Time `json:"system_time"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	SkewTolerance string    `json:"skew_tolerance"`
+	NTP           *NTPCheck `json:"ntp,omitempty"`
+}
+
+// NTPCheck is the system clock's estimated offset from the NTP reference;
+// positive when the system clock is slow
+type NTPCheck struct {
+	Server   string  `json:"server"`
+	OffsetMS float64 `json:"offset_ms,omitempty"`
+	// WithinTolerance is false when the offset exceeds the skew tolerance
+	WithinTolerance bool   `json:"within_tolerance"`
+	Error           string `json:"error,omitempty"`
+}
+
+// TimeReport reports the server time and uptime and, when NTP_SERVER is
+// set, the clock's offset from it. Uptime is measured on the monotonic
+// clock, so it is unaffected by the wall clock being stepped.
+func (s *Service) TimeReport(ctx context.Context) TimeReport {
+	report := TimeReport{
+		ServerTime:    s.clock.Now().UTC(),
+		SystemTime:    time.Now().UTC(),
+		UptimeSeconds: time.Since(s.started).Seconds(),
+		SkewTolerance: s.cfg.ClockSkewTolerance.String(),
+	}
+	if s.cfg.NTPServer == "" {
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	report.NTP = &NTPCheck{Server: s.cfg.NTPServer}
+	offset, err := clock.NTPOffset(ctx, s.cfg.NTPServer)
+	if err != nil {
+		report.NTP.Error = err.Error()
+		return report
+	}
+	report.NTP.OffsetMS = float64(offset) / float64(time.Millisecond)
+	report.NTP.WithinTolerance = offset.Abs() <= s.cfg.ClockSkewTolerance
+	return report
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokensHonourSkewTolerance(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ClockSkewTolerance = time.Minute
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	start := clk.Now()
+	orderToken, err := s.issueOrderToken(map[string]interface{}{"id": "order_1", "amount": 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusToken := s.issueStatusToken("order_1")
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		valid func() bool
+	}{
+		{"order token", cfg.OrderTokenTTL, func() bool {
+			_, err := s.verifyOrderToken(orderToken, "order_1")
+			return err == nil
+		}},
+		{"status token", cfg.StatusTokenTTL, func() bool { return s.validStatusToken(statusToken, "order_1") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, at := range []struct {
+				past  time.Duration
+				valid bool
+			}{
+				{0, true},
+				{time.Minute, true},
+				{time.Minute + time.Second, false},
+			} {
+				clk.Set(start.Add(tt.ttl + at.past))
+				if got := tt.valid(); got != at.valid {
+					t.Fatalf("%s past expiry: valid = %v, want %v", at.past, got, at.valid)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeReport(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ClockSkewTolerance = 90 * time.Second
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	clk.Advance(time.Hour)
+
+	report := s.TimeReport(context.Background())
+	if !report.ServerTime.Equal(clk.Now()) {
+		t.Fatalf("server time = %s, want the service clock's %s", report.ServerTime, clk.Now())
+	}
+	if time.Since(report.SystemTime).Abs() > time.Minute {
+		t.Fatalf("system time = %s, want the host's", report.SystemTime)
+	}
+	// Uptime is measured on the host's clock, not the fake one
+	if report.UptimeSeconds < 0 || report.UptimeSeconds > 60 {
+		t.Fatalf("uptime = %vs, want the seconds since the service started", report.UptimeSeconds)
+	}
+	if report.SkewTolerance != "1m30s" || report.NTP != nil {
+		t.Fatalf("report = %+v, want the tolerance and no NTP check", report)
+	}
+}
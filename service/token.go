@@ -0,0 +1,98 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+)
+
+// OrderToken is the payload bound into a signed order token
+type OrderToken struct {
+	OrderID   string
+	Amount    int
+	ExpiresAt time.Time
+}
+
+// issueOrderToken returns a compact token of the form
+// base64url("order_id|amount|expiry").base64url(hmac) binding the order's
+// ID and amount so the client cannot tamper with them before verification
+func (s *Service) issueOrderToken(order map[string]interface{}) (string, error) {
+	orderID, _ := order["id"].(string)
+	if orderID == "" {
+		return "", fmt.Errorf("order has no id")
+	}
+	amount, ok := intField(order, "amount")
+	if !ok {
+		return "", fmt.Errorf("order %s has no amount", orderID)
+	}
+
+	expiry := s.clock.Now().Add(s.cfg.OrderTokenTTL).Unix()
+	payload := fmt.Sprintf("%s|%d|%d", orderID, amount, expiry)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.signToken(purposeOrderToken, encoded)), nil
+}
+
+// verifyOrderToken checks the token signature and expiry and that it was
+// issued for orderID
+func (s *Service) verifyOrderToken(token, orderID string) (OrderToken, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return OrderToken{}, ErrTokenMalformed
+	}
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return OrderToken{}, ErrTokenMalformed
+	}
+	if !hmac.Equal(rawSig, s.signToken(purposeOrderToken, encoded)) {
+		return OrderToken{}, ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return OrderToken{}, ErrTokenMalformed
+	}
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 {
+		return OrderToken{}, ErrTokenMalformed
+	}
+	amount, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return OrderToken{}, ErrTokenMalformed
+	}
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return OrderToken{}, ErrTokenMalformed
+	}
+
+	t := OrderToken{OrderID: parts[0], Amount: amount, ExpiresAt: time.Unix(expiry, 0)}
+	if err := s.checkWindow(clock.Window{NotAfter: t.ExpiresAt}); err != nil {
+		return OrderToken{}, ErrTokenExpired
+	}
+	if !hmac.Equal([]byte(t.OrderID), []byte(orderID)) {
+		return OrderToken{}, ErrTokenOrder
+	}
+	return t, nil
+}
+
+// Token purposes, each deriving its own signing key
+const (
+	purposeOrderToken  = "order-token"
+	purposeStatusToken = "status-token"
+)
+
+// signToken MACs the encoded payload under a key derived from the secret
+// and purpose, so tokens of one kind can never pass for another or for
+// Razorpay payment signatures
+func (s *Service) signToken(purpose, encoded string) []byte {
+	key := hmac.New(sha256.New, []byte(s.cfg.SecretKey))
+	key.Write([]byte(purpose))
+	h := hmac.New(sha256.New, key.Sum(nil))
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
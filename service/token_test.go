@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyOrderToken(t *testing.T) {
+	cfg := testConfig(t)
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	token, err := s.issueOrderToken(map[string]interface{}{"id": "order_1", "amount": 500})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	encoded, sig, _ := strings.Cut(token, ".")
+	otherCfg := cfg
+	otherCfg.SecretKey = "another_secret"
+	other, _ := newTestService(t, newFakeGateway(), otherCfg)
+	foreign, _ := other.issueOrderToken(map[string]interface{}{"id": "order_1", "amount": 500})
+	tampered := base64.RawURLEncoding.EncodeToString([]byte("order_1|1|" + strings.Split(string(mustDecode(t, encoded)), "|")[2]))
+
+	tests := []struct {
+		name    string
+		token   string
+		orderID string
+		advance time.Duration
+		want    error
+	}{
+		{name: "valid", token: token, orderID: "order_1"},
+		{name: "within skew past expiry", token: token, orderID: "order_1", advance: cfg.OrderTokenTTL + cfg.ClockSkewTolerance/2},
+		{name: "expired", token: token, orderID: "order_1", advance: cfg.OrderTokenTTL + 2*cfg.ClockSkewTolerance, want: ErrTokenExpired},
+		{name: "other order", token: token, orderID: "order_2", want: ErrTokenOrder},
+		{name: "no signature", token: encoded, orderID: "order_1", want: ErrTokenMalformed},
+		{name: "signature not base64", token: encoded + ".***", orderID: "order_1", want: ErrTokenMalformed},
+		{name: "amount tampered", token: tampered + "." + sig, orderID: "order_1", want: ErrTokenSignature},
+		{name: "signed with another secret", token: foreign, orderID: "order_1", want: ErrTokenSignature},
+		{name: "status token", token: s.issueStatusToken("order_1"), orderID: "order_1", want: ErrTokenSignature},
+		{name: "empty", token: "", orderID: "order_1", want: ErrTokenMalformed},
+	}
+	start := clk.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Set(start.Add(tt.advance))
+			got, err := s.verifyOrderToken(tt.token, tt.orderID)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && (got.OrderID != "order_1" || got.Amount != 500) {
+				t.Fatalf("token = %+v, want order_1 for 500", got)
+			}
+			if tt.want != nil && !errors.Is(err, ErrInvalidOrderToken) {
+				t.Fatalf("err = %v does not wrap ErrInvalidOrderToken", err)
+			}
+		})
+	}
+}
+
+func TestStatusTokenNotAcceptedAsOrderToken(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	orderToken, err := s.issueOrderToken(map[string]interface{}{"id": "order_1", "amount": 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.validStatusToken(orderToken, "order_1") {
+		t.Fatal("order token accepted as a status token")
+	}
+	if !s.validStatusToken(s.issueStatusToken("order_1"), "order_1") {
+		t.Fatal("status token refused")
+	}
+}
+
+func TestVerifyPaymentChecksTokenAmount(t *testing.T) {
+	tests := []struct {
+		name string
+		// tokenAmount is the amount the presented token is issued for
+		tokenAmount int
+		// paid is the amount Razorpay reports for the payment
+		paid int
+		// unstored drops the order from the store before verifying
+		unstored bool
+		want     error
+	}{
+		{name: "matching", tokenAmount: 500, paid: 500},
+		{name: "token for a cheaper order", tokenAmount: 100, paid: 500, want: ErrTokenAmount},
+		{name: "token for a dearer order", tokenAmount: 900, paid: 500, want: ErrTokenAmount},
+		{name: "unstored order, matching", tokenAmount: 500, paid: 500, unstored: true},
+		{name: "unstored order, payment of another amount", tokenAmount: 100, paid: 500, unstored: true, want: ErrPaymentMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeGateway()
+			s, _ := newTestService(t, gw, testConfig(t))
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			if tt.unstored {
+				store := s.store.(*MemoryStore)
+				store.mu.Lock()
+				delete(store.orders, orderID)
+				store.mu.Unlock()
+			}
+			token, err := s.issueOrderToken(map[string]interface{}{"id": orderID, "amount": tt.tokenAmount})
+			if err != nil {
+				t.Fatal(err)
+			}
+			gw.pay("pay_1", orderID, tt.paid, "INR")
+
+			_, err = s.VerifyPayment(context.Background(), PaymentVerificationRequest{
+				ServerOrderID:     orderID,
+				RazorpayPaymentID: "pay_1",
+				RazorpaySignature: paymentSignature(orderID, "pay_1", testSecret),
+				OrderToken:        token,
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
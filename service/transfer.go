@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/yash170603/golang_payment/config"
+	"github.com/yash170603/golang_payment/money"
+)
+
+// ReversalRequest reverses part or all of a Route transfer
+type ReversalRequest struct {
+	// Amount in minor units; zero reverses whatever remains
+	Amount int               `json:"amount"`
+	Notes  map[string]string `json:"notes"`
+}
+
+// TransferReversal is a reversal a refund needs, and its outcome once
+// attempted
+type TransferReversal struct {
+	TransferID string `json:"transfer_id"`
+	Amount     int    `json:"amount"`
+	ReversalID string `json:"reversal_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReversalsRequiredError refuses a refund until the vendors' share of it
+// has been reversed
+type ReversalsRequiredError struct {
+	PaymentID string
+	Reversals []TransferReversal
+}
+
+func (e *ReversalsRequiredError) Error() string {
+	total := 0
+	for _, r := range e.Reversals {
+		total += r.Amount
+	}
+	return fmt.Sprintf("payment %s needs %d reversed across %d transfers before this refund", e.PaymentID, total, len(e.Reversals))
+}
+
+// ReverseTransfer reverses req.Amount of the transfer, or all that remains
+func (s *Service) ReverseTransfer(ctx context.Context, transferID string, req ReversalRequest) (map[string]interface{}, error) {
+	if req.Amount < 0 {
+		return nil, invalidRequest("amount must not be negative")
+	}
+
+	data := map[string]interface{}{}
+	if req.Amount > 0 {
+		data["amount"] = req.Amount
+	}
+	if len(req.Notes) > 0 {
+		data["notes"] = req.Notes
+	}
+	reversal, err := s.gateway.ReverseTransfer(ctx, transferID, data)
+	if err != nil {
+		return nil, fmt.Errorf("reverse transfer %s: %w", transferID, err)
+	}
+	s.logLedgerError(s.postReversal(ctx, reversal))
+	return reversal, nil
+}
+
+// TransferReversals returns the reversals made of the transfer
+func (s *Service) TransferReversals(ctx context.Context, transferID string) (map[string]interface{}, error) {
+	reversals, err := s.gateway.FetchTransferReversals(ctx, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch reversals of transfer %s: %w", transferID, err)
+	}
+	return reversals, nil
+}
+
+// refundReversals returns the transfer reversals refunding amount of the
+// payment calls for, none when the check is off or nothing is owed
+func (s *Service) refundReversals(ctx context.Context, paymentID string, amount int) ([]TransferReversal, error) {
+	if s.cfg.RefundTransferReversals == config.ReversalsOff {
+		return nil, nil
+	}
+	transfers, err := s.gateway.FetchPaymentTransfers(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch transfers of payment %s: %w", paymentID, err)
+	}
+	items, _ := transfers["items"].([]interface{})
+	if len(items) == 0 {
+		return nil, nil
+	}
+	payment, err := s.gateway.FetchPayment(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch payment %s: %w", paymentID, err)
+	}
+
+	paid, _ := intField(payment, "amount")
+	refunded, _ := intField(payment, "amount_refunded")
+	var linked []linkedTransfer
+	for _, raw := range items {
+		t, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if status, _ := t["status"].(string); status == "failed" {
+			continue
+		}
+		id, _ := t["id"].(string)
+		transferred, _ := intField(t, "amount")
+		reversed, _ := intField(t, "amount_reversed")
+		linked = append(linked, linkedTransfer{ID: id, Amount: transferred, Reversed: reversed})
+	}
+	return planReversals(paid, refunded, amount, linked), nil
+}
+
+// linkedTransfer is the part of a Route transfer reversal planning reads
+type linkedTransfer struct {
+	ID       string
+	Amount   int
+	Reversed int
+}
+
+// planReversals spreads a refund across the payment's transfers. Once
+// refunded+refund of paid is refunded, each transfer should have reversed
+// the same fraction of its amount. Shares are whole paise by
+// money.Shares, so they total the floor of the exact shares and never
+// exceed a transfer. What earlier refunds already reversed is subtracted,
+// and the result is trimmed so it never exceeds refund.
+func planReversals(paid, refunded, refund int, transfers []linkedTransfer) []TransferReversal {
+	if paid <= 0 || refund <= 0 {
+		return nil
+	}
+	cumulative := int64(refunded) + int64(refund)
+	if cumulative > int64(paid) {
+		cumulative = int64(paid)
+	}
+
+	parts := make([]int64, len(transfers))
+	for i, t := range transfers {
+		parts[i] = int64(t.Amount)
+	}
+	// The currency plays no part in the shares
+	shares, err := money.New(cumulative, "").Shares(int64(paid), parts...)
+	if err != nil {
+		return nil
+	}
+
+	var plan []TransferReversal
+	left := refund
+	for i, t := range transfers {
+		owed := int(shares[i].Amount) - t.Reversed
+		if rest := t.Amount - t.Reversed; owed > rest {
+			owed = rest
+		}
+		if owed > left {
+			owed = left
+		}
+		if owed <= 0 {
+			continue
+		}
+		plan = append(plan, TransferReversal{TransferID: t.ID, Amount: owed})
+		left -= owed
+	}
+	return plan
+}
+
+// reverseForRefund makes the reversals planned for a refund that has gone
+// through. Failures are recorded on the reversal and logged, since the
+// refund cannot be undone; they can be retried by hand.
+func (s *Service) reverseForRefund(ctx context.Context, refundID string, plan []TransferReversal) {
+	for i := range plan {
+		r := &plan[i]
+		reversal, err := s.gateway.ReverseTransfer(ctx, r.TransferID, map[string]interface{}{
+			"amount": r.Amount,
+			"notes":  map[string]string{"refund_id": refundID},
+		})
+		if err != nil {
+			r.Error = err.Error()
+			log.Printf("ERROR: refund %s went through but reversing %d of transfer %s failed: %v", refundID, r.Amount, r.TransferID, err)
+			continue
+		}
+		r.ReversalID, _ = reversal["id"].(string)
+		s.logLedgerError(s.postReversal(ctx, reversal))
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"testing"
+	"testing/quick"
+)
+
+func TestPlanReversals(t *testing.T) {
+	transfers := func() []linkedTransfer {
+		return []linkedTransfer{{ID: "trf_a", Amount: 3333}, {ID: "trf_b", Amount: 3333}, {ID: "trf_c", Amount: 1000}}
+	}
+	tests := []struct {
+		name           string
+		paid, refunded int
+		refund         int
+		reversed       []int
+		want           map[string]int
+	}{
+		{"full refund", 10000, 0, 10000, nil, map[string]int{"trf_a": 3333, "trf_b": 3333, "trf_c": 1000}},
+		// A third of 7666 transferred is 2555.33, the odd paisa to nobody
+		{"a third", 9999, 0, 3333, nil, map[string]int{"trf_a": 1111, "trf_b": 1111, "trf_c": 333}},
+		{"rest after a third", 9999, 3333, 6666, []int{1111, 1111, 333}, map[string]int{"trf_a": 2222, "trf_b": 2222, "trf_c": 667}},
+		{"nothing paid", 0, 0, 100, nil, map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linked := transfers()
+			for i, r := range tt.reversed {
+				linked[i].Reversed = r
+			}
+			got := map[string]int{}
+			for _, r := range planReversals(tt.paid, tt.refunded, tt.refund, linked) {
+				got[r.TransferID] = r.Amount
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("plan = %v, want %v", got, tt.want)
+			}
+			for id, amount := range tt.want {
+				if got[id] != amount {
+					t.Fatalf("plan = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanReversalsKeepEveryPaisa(t *testing.T) {
+	// Refunding a payment in parts reverses each transfer no more than its
+	// amount and never more than was refunded; refunding it all reverses
+	// every transfer in full.
+	property := func(amounts [3]uint16, cuts []uint16) bool {
+		paid := 0
+		linked := make([]linkedTransfer, len(amounts))
+		for i, a := range amounts {
+			linked[i] = linkedTransfer{ID: string(rune('a' + i)), Amount: int(a)}
+			paid += int(a)
+		}
+		paid += 100
+		refunded := 0
+		refund := func(n int) bool {
+			plan := planReversals(paid, refunded, n, linked)
+			total := 0
+			for _, r := range plan {
+				for i := range linked {
+					if linked[i].ID == r.TransferID {
+						linked[i].Reversed += r.Amount
+					}
+				}
+				total += r.Amount
+			}
+			refunded += n
+			return total <= n
+		}
+		for _, c := range cuts {
+			n := int(c) % (paid - refunded + 1)
+			if n > 0 && !refund(n) {
+				return false
+			}
+		}
+		if left := paid - refunded; left > 0 && !refund(left) {
+			return false
+		}
+		for _, t := range linked {
+			if t.Reversed != t.Amount {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
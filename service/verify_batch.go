@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/yash170603/golang_payment/authctx"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// MaxVerifyBatch is the most checkouts one batch verification may carry.
+// Each item costs a Razorpay call, so batches are kept small.
+const MaxVerifyBatch = 100
+
+// Batch item outcomes
+const (
+	BatchVerified      = "verified"
+	BatchInvalid       = "invalid"
+	BatchUnknownOrder  = "unknown_order"
+	BatchUpstreamError = "upstream_error"
+	// BatchNotProcessed marks items the batch deadline passed before
+	BatchNotProcessed = "not_processed"
+)
+
+// BatchVerificationItem is one completed offline checkout, carrying what
+// a single verification would: the order token and, when
+// VERIFY_CLIENT_BINDING is on, the client token the order was created with
+type BatchVerificationItem struct {
+	OrderID     string `json:"order_id" binding:"required"`
+	PaymentID   string `json:"razorpay_payment_id" binding:"required"`
+	Signature   string `json:"razorpay_signature" binding:"required"`
+	OrderToken  string `json:"order_token" binding:"required"`
+	ClientToken string `json:"client_token"`
+}
+
+// BatchVerificationRequest carries checkouts synced by an offline device
+type BatchVerificationRequest struct {
+	Items []BatchVerificationItem `json:"items" binding:"required,min=1,max=100,dive"`
+	// IdempotencyKey lets a device resend a batch whose response it lost
+	IdempotencyKey string `json:"-"`
+}
+
+// BatchVerificationResult is the outcome of one item, in request order
+type BatchVerificationResult struct {
+	OrderID     string `json:"order_id"`
+	PaymentID   string `json:"razorpay_payment_id"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	StatusToken string `json:"status_token,omitempty"`
+}
+
+// BatchVerification is the outcome of a batch. Complete is false when the
+// deadline passed and some items were not processed.
+type BatchVerification struct {
+	Complete bool                      `json:"complete"`
+	Results  []BatchVerificationResult `json:"results"`
+}
+
+// VerifyPaymentBatch verifies offline checkouts independently: each item
+// passes the checks of VerifyPayment, order token, session expiry, client
+// binding and signature, then the payment is confirmed with Razorpay
+// and recorded through the same replay-protected path as VerifyPayment.
+// Items still waiting when VerifyBatchTimeout passes are returned as
+// not_processed.
+func (s *Service) VerifyPaymentBatch(ctx context.Context, req BatchVerificationRequest) (BatchVerification, error) {
+	if len(req.Items) > MaxVerifyBatch {
+		return BatchVerification{}, invalidRequest("at most %d items per batch", MaxVerifyBatch)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.VerifyBatchTimeout)
+	defer cancel()
+
+	results := make([]BatchVerificationResult, len(req.Items))
+	for i, item := range req.Items {
+		results[i] = BatchVerificationResult{OrderID: item.OrderID, PaymentID: item.PaymentID, Status: BatchNotProcessed}
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.cfg.VerifyBatchConcurrency && w < len(req.Items); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				s.verifyBatchItem(ctx, req.Items[i], req.IdempotencyKey, &results[i])
+			}
+		}()
+	}
+
+	complete := true
+feed:
+	for i := range req.Items {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			complete = false
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	tenant, _ := authctx.Tenant(ctx)
+	for _, r := range results {
+		metrics.Verifications.WithLabelValues("batch_"+r.Status, metrics.Merchant(tenant)).Inc()
+	}
+	return BatchVerification{Complete: complete, Results: results}, nil
+}
+
+// verifyBatchItem fills in the outcome of one item
+func (s *Service) verifyBatchItem(ctx context.Context, item BatchVerificationItem, idempotencyKey string, result *BatchVerificationResult) {
+	_, err := s.checkVerification(ctx, PaymentVerificationRequest{
+		ServerOrderID:     item.OrderID,
+		RazorpayPaymentID: item.PaymentID,
+		RazorpaySignature: item.Signature,
+		OrderToken:        item.OrderToken,
+		ClientToken:       item.ClientToken,
+	})
+	switch {
+	case errors.Is(err, ErrInvalidOrderToken):
+		result.Status, result.Reason = BatchInvalid, "invalid order token"
+		return
+	case errors.Is(err, ErrSessionExpired):
+		result.Status, result.Reason = BatchInvalid, "checkout session expired"
+		return
+	case errors.Is(err, ErrClientBinding):
+		result.Status, result.Reason = BatchInvalid, "not from the order's client"
+		return
+	case errors.Is(err, ErrSignatureMalformed):
+		result.Status, result.Reason = BatchInvalid, "signature malformed"
+		return
+	case err != nil:
+		result.Status, result.Reason = BatchInvalid, "signature mismatch"
+		return
+	}
+
+	order, err := s.store.Get(ctx, item.OrderID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			result.Status = BatchUnknownOrder
+		} else {
+			result.Status, result.Reason = BatchUpstreamError, err.Error()
+		}
+		return
+	}
+
+	payment, err := s.gateway.FetchPayment(ctx, item.PaymentID)
+	var rejected *gateway.RequestError
+	switch {
+	case errors.As(err, &rejected):
+		result.Status, result.Reason = BatchInvalid, "payment not found"
+		return
+	case err != nil:
+		result.Status, result.Reason = BatchUpstreamError, err.Error()
+		return
+	}
+	if err := matchPayment(order, payment); err != nil {
+		result.Status, result.Reason = BatchInvalid, err.Error()
+		return
+	}
+	if status, _ := payment["status"].(string); status != "captured" && status != "authorized" {
+		result.Status, result.Reason = BatchInvalid, fmt.Sprintf("payment is %s", status)
+		return
+	}
+
+	// Keyed per payment, so a resent batch is a retry item by item
+	key := ""
+	if idempotencyKey != "" {
+		key = idempotencyKey + ":" + item.PaymentID
+	}
+	v, err := s.recordVerification(ctx, item.OrderID, item.PaymentID, key)
+	if err != nil {
+		result.Status, result.Reason = BatchInvalid, err.Error()
+		return
+	}
+	result.Status, result.StatusToken = BatchVerified, v.StatusToken
+}
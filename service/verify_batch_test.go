@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVerifyPaymentBatchRunsSingleVerificationChecks(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.VerifyClientBinding = true
+	cfg.ClientTokenTTL = time.Hour
+	gw := newFakeGateway()
+	s, _ := newTestService(t, gw, cfg)
+
+	tests := []struct {
+		name   string
+		edit   func(item *BatchVerificationItem)
+		status string
+		reason string
+	}{
+		{name: "valid", status: BatchVerified},
+		{
+			name:   "missing order token",
+			edit:   func(item *BatchVerificationItem) { item.OrderToken = "" },
+			status: BatchInvalid,
+			reason: "invalid order token",
+		},
+		{
+			name: "order token of another order",
+			edit: func(item *BatchVerificationItem) {
+				item.OrderToken = createTestOrder(t, s, 100)["order_token"].(string)
+			},
+			status: BatchInvalid,
+			reason: "invalid order token",
+		},
+		{
+			name:   "missing client token",
+			edit:   func(item *BatchVerificationItem) { item.ClientToken = "" },
+			status: BatchInvalid,
+			reason: "not from the order's client",
+		},
+		{
+			name: "client token of another order",
+			edit: func(item *BatchVerificationItem) {
+				item.ClientToken = createTestOrder(t, s, 100)["client_token"].(string)
+			},
+			status: BatchInvalid,
+			reason: "not from the order's client",
+		},
+		{
+			name: "signature mismatch",
+			edit: func(item *BatchVerificationItem) {
+				item.Signature = paymentSignature(item.OrderID, item.PaymentID, "other")
+			},
+			status: BatchInvalid,
+			reason: "signature mismatch",
+		},
+		{
+			name:   "signature malformed",
+			edit:   func(item *BatchVerificationItem) { item.Signature = "zz" },
+			status: BatchInvalid,
+			reason: "signature malformed",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := createTestOrder(t, s, 500)
+			orderID := order["id"].(string)
+			paymentID := "pay_batch_" + string(rune('a'+i))
+			gw.pay(paymentID, orderID, 500, "INR")
+			item := BatchVerificationItem{
+				OrderID:     orderID,
+				PaymentID:   paymentID,
+				Signature:   paymentSignature(orderID, paymentID, testSecret),
+				OrderToken:  order["order_token"].(string),
+				ClientToken: order["client_token"].(string),
+			}
+			if tt.edit != nil {
+				tt.edit(&item)
+			}
+
+			batch, err := s.VerifyPaymentBatch(context.Background(), BatchVerificationRequest{Items: []BatchVerificationItem{item}})
+			if err != nil {
+				t.Fatalf("VerifyPaymentBatch: %v", err)
+			}
+			got := batch.Results[0]
+			if got.Status != tt.status || got.Reason != tt.reason {
+				t.Fatalf("result = %s %q, want %s %q", got.Status, got.Reason, tt.status, tt.reason)
+			}
+			stored, err := s.store.Get(context.Background(), orderID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if paid := stored.Status == OrderPaid; paid != (tt.status == BatchVerified) {
+				t.Fatalf("order status = %s after a %s item", stored.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestVerifyPaymentBatchRefusesExpiredSession(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SessionTTL = 10 * time.Minute
+	gw := newFakeGateway()
+	s, clk := newTestService(t, gw, cfg)
+
+	session, err := s.CreateCheckoutSession(context.Background(), CheckoutSessionRequest{Amount: 500})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	gw.pay("pay_late", session.OrderID, 500, "INR")
+	// Past the session and the skew tolerance, within the order token
+	clk.Advance(15 * time.Minute)
+
+	batch, err := s.VerifyPaymentBatch(context.Background(), BatchVerificationRequest{Items: []BatchVerificationItem{{
+		OrderID:    session.OrderID,
+		PaymentID:  "pay_late",
+		Signature:  paymentSignature(session.OrderID, "pay_late", testSecret),
+		OrderToken: session.OrderToken,
+	}}})
+	if err != nil {
+		t.Fatalf("VerifyPaymentBatch: %v", err)
+	}
+	if got := batch.Results[0]; got.Status != BatchInvalid || got.Reason != "checkout session expired" {
+		t.Fatalf("result = %s %q, want invalid, checkout session expired", got.Status, got.Reason)
+	}
+}
+
+func TestVerifyPaymentBatchRejectsOversizedBatch(t *testing.T) {
+	s, _ := newTestService(t, newFakeGateway(), testConfig(t))
+	items := make([]BatchVerificationItem, MaxVerifyBatch+1)
+	if _, err := s.VerifyPaymentBatch(context.Background(), BatchVerificationRequest{Items: items}); err == nil {
+		t.Fatalf("batch of %d items accepted", len(items))
+	}
+}
@@ -0,0 +1,478 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/clock"
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/razorpaysig"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// Webhook intake errors
+var (
+	ErrWebhooksDisabled       = errors.New("webhooks are not configured")
+	ErrWebhookSignature       = errors.New("invalid webhook signature")
+	ErrWebhookQueueFull       = errors.New("webhook queue is full")
+	ErrWebhookShuttingDown    = errors.New("webhook intake is shutting down")
+	ErrWebhookStale           = errors.New("webhook event is older than the replay window")
+	ErrWebhookFromFuture      = errors.New("webhook event is dated in the future")
+	errWebhookPayloadMismatch = errors.New("webhook payload is missing the expected entity")
+)
+
+// ErrWebhookSignatureMalformed is a signature header that is not 64 hex
+// digits, so it could not have come from Razorpay
+var ErrWebhookSignatureMalformed = fmt.Errorf("%w: malformed", ErrWebhookSignature)
+
+// WebhookEvent is a verified Razorpay webhook delivery
+type WebhookEvent struct {
+	// ID is the X-Razorpay-Event-Id of the delivery, when sent
+	ID         string                     `json:"id,omitempty"`
+	Event      string                     `json:"event"`
+	AccountID  string                     `json:"account_id,omitempty"`
+	Payload    map[string]json.RawMessage `json:"payload"`
+	CreatedAt  int64                      `json:"created_at"`
+	ReceivedAt time.Time                  `json:"received_at"`
+	// Provider is the routed account the delivery was verified for, when
+	// orders are routed between accounts
+	Provider string `json:"provider,omitempty"`
+}
+
+// DeadLetter is a webhook event whose processing failed
+type DeadLetter struct {
+	Event    WebhookEvent `json:"event"`
+	Error    string       `json:"error"`
+	FailedAt time.Time    `json:"failed_at"`
+}
+
+// webhookEntity is the part of a payment, refund or dispute entity the
+// handlers read
+type webhookEntity struct {
+	ID        string `json:"id"`
+	OrderID   string `json:"order_id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int    `json:"amount"`
+	Status    string `json:"status"`
+}
+
+// webhookPool processes verified events on a fixed set of workers so
+// deliveries can be acknowledged as soon as they are queued
+type webhookPool struct {
+	queue chan WebhookEvent
+	seen  *seenEvents
+
+	mu         sync.RWMutex
+	closed     bool
+	letters    []DeadLetter
+	maxLetters int
+}
+
+func (s *Service) startWebhookPool() {
+	p := &webhookPool{
+		queue:      make(chan WebhookEvent, s.cfg.WebhookQueueSize),
+		seen:       newSeenEvents(s.cfg.WebhookDedupTTL),
+		maxLetters: s.cfg.WebhookDeadLetterMax,
+	}
+	// Workers drain the queue rather than stopping when cancelled, so
+	// queued events are processed once Shutdown closes it
+	for i := 0; i < s.cfg.WebhookWorkers; i++ {
+		s.runners.Add(fmt.Sprintf("webhook-worker-%d", i), runner.Func(func(context.Context) error {
+			for ev := range p.queue {
+				s.orderWebhook(ev)
+			}
+			return nil
+		}), runner.Restart(time.Second, time.Minute))
+	}
+	s.webhooks = p
+}
+
+// applyWebhook processes ev, dead-lettering it on failure
+func (s *Service) applyWebhook(ev WebhookEvent) {
+	ctx := context.Background()
+	if ev.Provider != "" {
+		ctx = gateway.WithAccount(ctx, ev.Provider)
+	}
+	if err := s.processWebhook(ctx, ev); err != nil {
+		log.Printf("Webhook %s (%s) failed: %v", ev.ID, ev.Event, err)
+		s.webhooks.deadLetter(DeadLetter{Event: ev, Error: err.Error(), FailedAt: s.clock.Now()})
+		return
+	}
+	s.publishEvent(ev.Event, ev)
+}
+
+// deadLetter records a failed event, dropping the oldest once maxLetters
+// are kept
+func (p *webhookPool) deadLetter(letter DeadLetter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if over := len(p.letters) + 1 - p.maxLetters; over > 0 {
+		log.Printf("Dropping %d oldest webhook dead letters, %d are kept", over, p.maxLetters)
+		p.letters = append(p.letters[:0], p.letters[over:]...)
+	}
+	p.letters = append(p.letters, letter)
+}
+
+// seenEvents remembers event IDs for a TTL, so redeliveries of an event
+// already queued are recognised. IDs are kept in memory, per instance.
+type seenEvents struct {
+	ttl time.Duration
+
+	mu  sync.Mutex
+	ids map[string]time.Time
+	// order lists the IDs as they were added, oldest first, for expiry
+	order []string
+}
+
+func newSeenEvents(ttl time.Duration) *seenEvents {
+	return &seenEvents{ttl: ttl, ids: make(map[string]time.Time)}
+}
+
+// add records id as seen at now, reporting false when it was already seen
+// within the TTL. Empty IDs are never recorded.
+func (e *seenEvents) add(id string, now time.Time) bool {
+	if id == "" || e.ttl <= 0 {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.order) > 0 {
+		oldest := e.order[0]
+		if at, ok := e.ids[oldest]; ok && now.Sub(at) < e.ttl {
+			break
+		}
+		delete(e.ids, oldest)
+		e.order = e.order[1:]
+	}
+	if _, ok := e.ids[id]; ok {
+		return false
+	}
+	e.ids[id] = now
+	e.order = append(e.order, id)
+	return true
+}
+
+// forget drops id, for a delivery that was not queued after all
+func (e *seenEvents) forget(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.ids, id)
+}
+
+// HandleWebhook verifies the delivery's signature over the raw body and
+// queues it for asynchronous processing. ErrWebhookQueueFull tells the
+// caller to make Razorpay redeliver later. A redelivery of an event queued
+// within WebhookDedupTTL is accepted without being queued again. When orders are routed between
+// accounts, the signature is checked with the webhook secret of the
+// account the event's order was created on.
+func (s *Service) HandleWebhook(body []byte, signature, eventID string) error {
+	return s.handleWebhook(s.webhookAccount(body), body, signature, eventID)
+}
+
+// HandleAccountWebhook is HandleWebhook for a delivery to the webhook URL
+// of one routed account, checked with that account's secret whatever the
+// event is about
+func (s *Service) HandleAccountWebhook(account string, body []byte, signature, eventID string) error {
+	if _, ok := s.webhookSecret(account); !ok {
+		return fmt.Errorf("%w: account %s", ErrNotFound, account)
+	}
+	return s.handleWebhook(account, body, signature, eventID)
+}
+
+// webhookSecret returns the webhook secret of a routed account or the
+// primary
+func (s *Service) webhookSecret(account string) (string, bool) {
+	if account == gateway.ProviderPrimary {
+		return s.cfg.WebhookSecret, true
+	}
+	acct, ok := s.account(account)
+	return acct.WebhookSecret, ok
+}
+
+// webhookAccount names the routed account that created the order body is
+// about. Events naming no order, and orders not recorded here, are taken
+// for the primary's; other accounts' such events need their own URL.
+func (s *Service) webhookAccount(body []byte) string {
+	if s.accounts == nil {
+		return gateway.ProviderPrimary
+	}
+	var probe struct {
+		Payload struct {
+			Order struct {
+				Entity struct {
+					ID string `json:"id"`
+				} `json:"entity"`
+			} `json:"order"`
+			Payment struct {
+				Entity struct {
+					OrderID string `json:"order_id"`
+				} `json:"entity"`
+			} `json:"payment"`
+		} `json:"payload"`
+	}
+	if json.Unmarshal(body, &probe) != nil {
+		return gateway.ProviderPrimary
+	}
+	orderID := probe.Payload.Order.Entity.ID
+	if orderID == "" {
+		orderID = probe.Payload.Payment.Entity.OrderID
+	}
+	if orderID == "" {
+		return gateway.ProviderPrimary
+	}
+	order, err := s.store.Get(context.Background(), orderID)
+	if _, routed := s.account(order.Provider); err != nil || !routed {
+		return gateway.ProviderPrimary
+	}
+	return order.Provider
+}
+
+// handleWebhook verifies and queues a delivery for account
+func (s *Service) handleWebhook(account string, body []byte, signature, eventID string) error {
+	secret, _ := s.webhookSecret(account)
+	if secret == "" {
+		return ErrWebhooksDisabled
+	}
+	switch err := razorpaysig.CheckWebhookSignature(body, signature, secret); {
+	case errors.Is(err, razorpaysig.ErrMalformed):
+		return ErrWebhookSignatureMalformed
+	case err != nil:
+		return ErrWebhookSignature
+	}
+
+	var ev WebhookEvent
+	if err := json.Unmarshal(body, &ev); err != nil || ev.Event == "" {
+		return invalidRequest("malformed webhook payload")
+	}
+	ev.ID = eventID
+	ev.ReceivedAt = s.clock.Now()
+	ev.Provider = ""
+	if s.accounts != nil {
+		ev.Provider = account
+	}
+	if err := s.checkWebhookTime(ev); err != nil {
+		return err
+	}
+
+	return s.webhooks.enqueue(ev)
+}
+
+// enqueue queues ev for the workers, unless it was queued already
+func (p *webhookPool) enqueue(ev WebhookEvent) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrWebhookShuttingDown
+	}
+	if !p.seen.add(ev.ID, ev.ReceivedAt) {
+		log.Printf("Skipping redelivered webhook %s (%s)", ev.ID, ev.Event)
+		return nil
+	}
+	select {
+	case p.queue <- ev:
+		return nil
+	default:
+		// Razorpay redelivers it, which must not be taken for a duplicate
+		p.seen.forget(ev.ID)
+		return ErrWebhookQueueFull
+	}
+}
+
+// checkWebhookTime refuses events whose created_at is outside
+// WebhookReplayWindow of now, give or take WebhookMaxClockSkew. Events
+// accepted only thanks to the skew are logged, as they point at one clock
+// or the other drifting.
+func (s *Service) checkWebhookTime(ev WebhookEvent) error {
+	if s.cfg.WebhookReplayWindow <= 0 || ev.CreatedAt == 0 {
+		return nil
+	}
+	created := time.Unix(ev.CreatedAt, 0)
+	window := clock.Window{NotBefore: created, NotAfter: created.Add(s.cfg.WebhookReplayWindow)}
+	switch err := window.Check(ev.ReceivedAt, s.cfg.WebhookMaxClockSkew); {
+	case errors.Is(err, clock.ErrNotYetValid):
+		log.Printf("Rejected webhook %s (%s) created %s ahead of our clock", ev.ID, ev.Event, created.Sub(ev.ReceivedAt))
+		return ErrWebhookFromFuture
+	case errors.Is(err, clock.ErrExpired):
+		log.Printf("Rejected webhook %s (%s) created %s ago", ev.ID, ev.Event, ev.ReceivedAt.Sub(created))
+		return ErrWebhookStale
+	}
+	if window.Check(ev.ReceivedAt, 0) != nil {
+		log.Printf("WARNING: accepted webhook %s (%s) within clock skew tolerance: created_at %s, received %s",
+			ev.ID, ev.Event, created.UTC().Format(time.RFC3339), ev.ReceivedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// applyCapture records the capture of a payment, as the webhook or the
+// Razorpay API reports it in raw
+func (s *Service) applyCapture(ctx context.Context, paymentID, orderID string, raw map[string]interface{}) error {
+	if err := s.postCapture(ctx, raw); err != nil {
+		return err
+	}
+	if orderID == "" {
+		return nil
+	}
+	s.sessions.markPaid(orderID, paymentID)
+	s.markOrderPaid(ctx, orderID, paymentID)
+	return nil
+}
+
+// processWebhook applies a verified event to local state
+func (s *Service) processWebhook(ctx context.Context, ev WebhookEvent) error {
+	switch ev.Event {
+	case "payment.captured", "order.paid":
+		var payment webhookEntity
+		if err := ev.entity("payment", &payment); err != nil {
+			return err
+		}
+		var raw map[string]interface{}
+		if err := ev.entity("payment", &raw); err != nil {
+			return err
+		}
+		if err := s.applyCapture(ctx, payment.ID, payment.OrderID, raw); err != nil {
+			return err
+		}
+
+	case "payment.authorized":
+		var payment authorizedPayment
+		if err := ev.entity("payment", &payment); err != nil {
+			return err
+		}
+		s.trackFunnel(func(f *funnelTracker, _ time.Time) {
+			f.attempted(payment.OrderID, payment.ID)
+		})
+		s.tagAuthorized(ctx, payment)
+		return s.applyCapturePolicy(ctx, payment)
+
+	case "payment.failed":
+		var payment failedPayment
+		if err := ev.entity("payment", &payment); err != nil {
+			return err
+		}
+		s.trackFunnel(func(f *funnelTracker, _ time.Time) {
+			f.failed(payment.OrderID, payment.ID, payment.ErrorCode, payment.ErrorReason)
+		})
+		s.releaseOrderCredit(ctx, payment.OrderID, "payment "+payment.ID+" failed")
+		s.recoverPayment(ctx, payment)
+
+	case "refund.processed":
+		var refund webhookEntity
+		if err := ev.entity("refund", &refund); err != nil {
+			return err
+		}
+		var raw map[string]interface{}
+		if err := ev.entity("refund", &raw); err != nil {
+			return err
+		}
+		if err := s.postRefund(ctx, raw); err != nil {
+			return err
+		}
+		data := map[string]interface{}{"payment_id": refund.PaymentID, "amount": refund.Amount}
+		// Refund events usually carry the refunded payment too
+		var payment struct {
+			Contact string `json:"contact"`
+		}
+		if ev.entity("payment", &payment) == nil && payment.Contact != "" {
+			data["contact"] = payment.Contact
+		}
+		s.notifier.Publish(notify.Event{
+			Type:    notify.EventRefundProcessed,
+			Subject: refund.ID,
+			Data:    data,
+		})
+
+	case "transfer.processed":
+		var transfer map[string]interface{}
+		if err := ev.entity("transfer", &transfer); err != nil {
+			return err
+		}
+		return s.postTransfer(ctx, transfer)
+
+	case "settlement.processed":
+		var settlement map[string]interface{}
+		if err := ev.entity("settlement", &settlement); err != nil {
+			return err
+		}
+		return s.postSettlement(ctx, settlement)
+
+	case "payment.dispute.created", "payment.dispute.under_review", "payment.dispute.action_required",
+		"payment.dispute.won", "payment.dispute.lost", "payment.dispute.closed":
+		var dispute webhookEntity
+		if err := ev.entity("dispute", &dispute); err != nil {
+			return err
+		}
+		state := dispute.Status
+		if state == "" {
+			state = "unknown"
+		}
+		metrics.Disputes.WithLabelValues(state).Inc()
+		if ev.Event != "payment.dispute.created" {
+			return nil
+		}
+		s.notifier.Publish(notify.Event{
+			Type:    notify.EventDisputeCreated,
+			Subject: dispute.ID,
+			Data:    map[string]interface{}{"payment_id": dispute.PaymentID, "amount": dispute.Amount},
+		})
+	}
+	return nil
+}
+
+// entity decodes payload.<name>.entity into v
+func (ev WebhookEvent) entity(name string, v interface{}) error {
+	raw, ok := ev.Payload[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", errWebhookPayloadMismatch, name)
+	}
+	var wrapper struct {
+		Entity json.RawMessage `json:"entity"`
+	}
+	if err := json.Unmarshal(raw, &wrapper); err != nil {
+		return err
+	}
+	return json.Unmarshal(wrapper.Entity, v)
+}
+
+// DeadLetters returns the webhook events whose processing failed
+func (s *Service) DeadLetters() []DeadLetter {
+	p := s.webhooks
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]DeadLetter(nil), p.letters...)
+}
+
+// Shutdown stops accepting webhooks and stops the background workers,
+// waiting for queued events to be processed, and abandons fulfillment
+// retries. When ctx is done first, the *runner.StopError names the
+// workers still running.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		close(s.fulfillments.stop)
+	})
+
+	p := s.webhooks
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	err := s.runners.Stop(ctx)
+	// Parked events are only held in memory
+	s.flushParked()
+	return err
+}
+
+// Runners reports the state of each background worker, the notification
+// channels' included
+func (s *Service) Runners() []runner.Status {
+	return append(s.runners.Status(), s.notifier.Runners()...)
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yash170603/golang_payment/gateway"
+	"github.com/yash170603/golang_payment/metrics"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// Stages of a payment's life its webhook events are put in order by.
+// Razorpay's created_at only has second resolution, too coarse to order
+// events sent for the same payment moments apart, so the stage an event
+// belongs to is what orders it.
+const (
+	stageNone = iota
+	stageAuthorized
+	// stageSettled is a capture or a failure
+	stageSettled
+	// stageFollowUp is a refund or dispute, which needs the capture first
+	stageFollowUp
+)
+
+const (
+	// webhookOrderRetention is how long the stage of a payment is
+	// remembered after its last event
+	webhookOrderRetention = time.Hour
+	// webhookOrderMaxPayments caps the payments whose stage is
+	// remembered; events for others are applied as they come
+	webhookOrderMaxPayments = 100000
+)
+
+// paymentStage is how far a payment's events have been applied, and the
+// events held back until its capture arrives
+type paymentStage struct {
+	stage    int
+	parked   []WebhookEvent
+	deadline time.Time
+	touched  time.Time
+}
+
+// webhookOrdering holds back webhook events that arrive before their
+// predecessor, such as a refund before the payment's capture
+type webhookOrdering struct {
+	mu       sync.Mutex
+	payments map[string]*paymentStage
+	parked   int
+}
+
+// webhookStage returns the payment an event is about and the event's
+// stage, or no payment for events that are not ordered
+func webhookStage(ev WebhookEvent) (string, int) {
+	var e webhookEntity
+	switch ev.Event {
+	case "payment.authorized":
+		if ev.entity("payment", &e) == nil {
+			return e.ID, stageAuthorized
+		}
+	case "payment.captured", "order.paid", "payment.failed":
+		if ev.entity("payment", &e) == nil {
+			return e.ID, stageSettled
+		}
+	case "refund.processed":
+		if ev.entity("refund", &e) == nil {
+			return e.PaymentID, stageFollowUp
+		}
+	case "payment.dispute.created", "payment.dispute.under_review", "payment.dispute.action_required",
+		"payment.dispute.won", "payment.dispute.lost", "payment.dispute.closed":
+		if ev.entity("dispute", &e) == nil {
+			return e.PaymentID, stageFollowUp
+		}
+	}
+	return "", stageNone
+}
+
+func (s *Service) startWebhookOrdering() {
+	s.ordering = &webhookOrdering{payments: make(map[string]*paymentStage)}
+	if s.cfg.WebhookReorderDelay <= 0 {
+		return
+	}
+	interval := max(s.cfg.WebhookReorderDelay/4, time.Second)
+	s.runners.Add("webhook-reorder-sweeper", runner.Every(interval, func() {
+		for paymentID, parked := range s.ordering.due(s.clock.Now()) {
+			s.resolvePayment(paymentID, parked)
+		}
+	}))
+}
+
+// orderWebhook applies a verified event in order with the other events of
+// its payment. An event older than the payment's stage is skipped when
+// applying it would act on a state the payment has left, like capturing
+// an authorization already captured, and applied otherwise, as applying
+// those again is harmless. A refund or dispute before the capture is
+// parked until the capture arrives, or WebhookReorderDelay passes.
+func (s *Service) orderWebhook(ev WebhookEvent) {
+	paymentID, stage := webhookStage(ev)
+	if s.cfg.WebhookReorderDelay <= 0 || paymentID == "" {
+		s.applyWebhook(ev)
+		return
+	}
+
+	o := s.ordering
+	o.mu.Lock()
+	st := o.payments[paymentID]
+	if st == nil {
+		if len(o.payments) >= webhookOrderMaxPayments {
+			o.mu.Unlock()
+			s.applyWebhook(ev)
+			return
+		}
+		st = &paymentStage{}
+		o.payments[paymentID] = st
+	}
+	now := s.clock.Now()
+	st.touched = now
+
+	// A failure shares the capture's stage but never follows it
+	if stage < st.stage || (ev.Event == "payment.failed" && st.stage >= stageSettled) {
+		o.mu.Unlock()
+		metrics.WebhookReordering.WithLabelValues("reordered").Inc()
+		if stage == stageAuthorized || ev.Event == "payment.failed" {
+			log.Printf("Skipping webhook %s (%s) for payment %s, which is already past it", ev.ID, ev.Event, paymentID)
+			return
+		}
+		s.applyWebhook(ev)
+		return
+	}
+
+	if stage == stageFollowUp && st.stage < stageSettled {
+		if o.parked >= s.cfg.WebhookReorderMaxParked {
+			o.mu.Unlock()
+			log.Printf("Webhook %s (%s) for payment %s arrived before its capture and no more can be parked; resolving now", ev.ID, ev.Event, paymentID)
+			s.resolvePayment(paymentID, []WebhookEvent{ev})
+			return
+		}
+		if len(st.parked) == 0 {
+			st.deadline = now.Add(s.cfg.WebhookReorderDelay)
+		}
+		st.parked = append(st.parked, ev)
+		o.parked++
+		o.mu.Unlock()
+		metrics.WebhookReordering.WithLabelValues("parked").Inc()
+		log.Printf("Parked webhook %s (%s) until payment %s is captured", ev.ID, ev.Event, paymentID)
+		return
+	}
+
+	// The stage moves on before the event is applied, so a predecessor
+	// processed meanwhile by another worker is taken for late
+	st.stage = max(st.stage, stage)
+	o.mu.Unlock()
+	s.applyWebhook(ev)
+	if stage == stageSettled {
+		for _, parked := range o.release(paymentID) {
+			s.applyWebhook(parked)
+		}
+	}
+}
+
+// release returns the events parked for a payment, in the order they were
+// created
+func (o *webhookOrdering) release(paymentID string) []WebhookEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st := o.payments[paymentID]
+	if st == nil || len(st.parked) == 0 {
+		return nil
+	}
+	parked := st.parked
+	st.parked = nil
+	o.parked -= len(parked)
+	sort.SliceStable(parked, func(i, j int) bool { return parked[i].CreatedAt < parked[j].CreatedAt })
+	return parked
+}
+
+// due takes out the parked events of the payments that waited long enough,
+// and forgets payments not heard of for webhookOrderRetention
+func (o *webhookOrdering) due(now time.Time) map[string][]WebhookEvent {
+	o.mu.Lock()
+	var ids []string
+	for id, st := range o.payments {
+		switch {
+		case len(st.parked) > 0 && !now.Before(st.deadline):
+			ids = append(ids, id)
+		case len(st.parked) == 0 && now.Sub(st.touched) > webhookOrderRetention:
+			delete(o.payments, id)
+		}
+	}
+	o.mu.Unlock()
+
+	due := make(map[string][]WebhookEvent, len(ids))
+	for _, id := range ids {
+		due[id] = o.release(id)
+	}
+	return due
+}
+
+// resolvePayment settles the state of a payment whose capture did not
+// arrive from the Razorpay API, then applies the events parked for it. A
+// captured or refunded payment is applied as captured first; otherwise,
+// or when Razorpay cannot be asked, the events are applied as they came.
+func (s *Service) resolvePayment(paymentID string, parked []WebhookEvent) {
+	ctx := context.Background()
+	if parked[0].Provider != "" {
+		ctx = gateway.WithAccount(ctx, parked[0].Provider)
+	}
+	metrics.WebhookReordering.WithLabelValues("force_resolved").Add(float64(len(parked)))
+
+	payment, err := s.gateway.FetchPayment(ctx, paymentID)
+	status, _ := payment["status"].(string)
+	switch {
+	case err != nil:
+		log.Printf("Fetching payment %s to resolve %d parked webhooks failed, applying them as they came: %v", paymentID, len(parked), err)
+	case status == "captured" || status == "refunded":
+		orderID, _ := payment["order_id"].(string)
+		if err := s.applyCapture(ctx, paymentID, orderID, payment); err != nil {
+			log.Printf("Applying capture of payment %s from Razorpay failed: %v", paymentID, err)
+		}
+		s.ordering.mu.Lock()
+		if st := s.ordering.payments[paymentID]; st != nil {
+			st.stage = max(st.stage, stageSettled)
+		}
+		s.ordering.mu.Unlock()
+	default:
+		log.Printf("Razorpay reports payment %s %s, applying %d parked webhooks as they came", paymentID, status, len(parked))
+	}
+	for _, ev := range parked {
+		s.applyWebhook(ev)
+	}
+	// Events parked while Razorpay was asked
+	for _, ev := range s.ordering.release(paymentID) {
+		s.applyWebhook(ev)
+	}
+}
+
+// flushParked applies every parked event as it came, on shutdown
+func (s *Service) flushParked() {
+	s.ordering.mu.Lock()
+	var ids []string
+	for id, st := range s.ordering.payments {
+		if len(st.parked) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	s.ordering.mu.Unlock()
+	for _, id := range ids {
+		for _, ev := range s.ordering.release(id) {
+			s.applyWebhook(ev)
+		}
+	}
+}
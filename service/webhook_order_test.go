@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yash170603/golang_payment/metrics"
+)
+
+// Recorded deliveries for pay_1 of order_1, and one for pay_2 of order_2,
+// by event
+var recordedWebhooks = map[string]string{
+	"authorized": `{"event":"payment.authorized","created_at":1772445600,"payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","amount":50000,"currency":"INR","status":"authorized"}}}}`,
+	"captured":   `{"event":"payment.captured","created_at":1772445601,"payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","amount":50000,"currency":"INR","status":"captured"}}}}`,
+	"failed":     `{"event":"payment.failed","created_at":1772445601,"payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","amount":50000,"currency":"INR","status":"failed"}}}}`,
+	"refund_1":   `{"event":"refund.processed","created_at":1772445700,"payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","amount":10000,"currency":"INR"}}}}`,
+	"refund_2":   `{"event":"refund.processed","created_at":1772445800,"payload":{"refund":{"entity":{"id":"rfnd_2","payment_id":"pay_1","amount":5000,"currency":"INR"}}}}`,
+	"dispute":    `{"event":"payment.dispute.created","created_at":1772445900,"payload":{"dispute":{"entity":{"id":"disp_1","payment_id":"pay_1","amount":35000,"currency":"INR","status":"open"}}}}`,
+
+	"refund_of_pay_2": `{"event":"refund.processed","created_at":1772445700,"payload":{"refund":{"entity":{"id":"rfnd_3","payment_id":"pay_2","amount":10000,"currency":"INR"}}}}`,
+}
+
+// orderingService applies webhooks in order, holding events back for up
+// to a minute, with order_1 created and pay_1 captured on the fake
+// gateway as the Razorpay API's truth
+func orderingService(t *testing.T, maxParked int) (*Service, *fakeGateway, func(time.Duration)) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookReorderDelay = time.Minute
+	cfg.WebhookReorderMaxParked = maxParked
+	gw := newFakeGateway()
+	s, clk := newTestService(t, gw, cfg)
+	createTestOrder(t, s, 50000)
+	gw.pay("pay_1", "order_1", 50000, "INR")
+	return s, gw, clk.Advance
+}
+
+// replay applies the recorded events named, in that order, as a webhook
+// worker would
+func replay(t *testing.T, s *Service, names ...string) {
+	t.Helper()
+	for i, name := range names {
+		var ev WebhookEvent
+		if err := json.Unmarshal([]byte(recordedWebhooks[name]), &ev); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ev.ID = fmt.Sprintf("evt_%d_%s", i, name)
+		s.orderWebhook(ev)
+	}
+}
+
+// sweep force-resolves what waited long enough, as the sweeper does
+func sweep(s *Service) {
+	for paymentID, parked := range s.ordering.due(s.clock.Now()) {
+		s.resolvePayment(paymentID, parked)
+	}
+}
+
+// ledgerKinds lists the ledger's transactions as "kind reference"
+func ledgerKinds(t *testing.T, s *Service) []string {
+	t.Helper()
+	txs, err := s.ledger.Transactions(context.Background(), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, tx := range txs {
+		kinds = append(kinds, tx.Kind+" "+tx.Reference)
+	}
+	return kinds
+}
+
+func reordering() map[string]float64 {
+	counts := make(map[string]float64)
+	for _, outcome := range []string{"reordered", "parked", "force_resolved"} {
+		counts[outcome] = testutil.ToFloat64(metrics.WebhookReordering.WithLabelValues(outcome))
+	}
+	return counts
+}
+
+func TestWebhookOrderingReplays(t *testing.T) {
+	captured := []string{"payment_captured pay_1", "refund rfnd_1", "refund rfnd_2"}
+	tests := []struct {
+		name     string
+		sequence []string
+		// resolve waits out the delay before checking
+		resolve     bool
+		wantLedger  []string
+		wantMetrics map[string]float64
+	}{
+		{"in order", []string{"authorized", "captured", "refund_1", "refund_2"}, false, captured, nil},
+		{"refunds before capture", []string{"refund_2", "refund_1", "captured"}, false, captured, map[string]float64{"parked": 2}},
+		{"refund between authorization and capture", []string{"authorized", "refund_1", "captured", "refund_2"}, false, captured, map[string]float64{"parked": 1}},
+		{"late authorization", []string{"captured", "authorized", "refund_1", "refund_2"}, false, captured, map[string]float64{"reordered": 1}},
+		{"late failure", []string{"captured", "failed", "refund_1", "refund_2"}, false, captured, map[string]float64{"reordered": 1}},
+		{"dispute before capture", []string{"dispute", "captured"}, false, []string{"payment_captured pay_1"}, map[string]float64{"parked": 1}},
+		{"capture never delivered", []string{"refund_1", "refund_2"}, true, captured, map[string]float64{"parked": 2, "force_resolved": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, advance := orderingService(t, 1000)
+			before := reordering()
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			replay(t, s, tt.sequence...)
+			if tt.resolve {
+				sweep(s)
+				if kinds := ledgerKinds(t, s); len(kinds) != 0 {
+					t.Fatalf("ledger = %v before the delay, want the refunds parked", kinds)
+				}
+				advance(time.Minute)
+				sweep(s)
+			}
+
+			if kinds := ledgerKinds(t, s); !reflect.DeepEqual(kinds, tt.wantLedger) {
+				t.Fatalf("ledger = %v, want %v", kinds, tt.wantLedger)
+			}
+			order, err := s.store.Get(context.Background(), "order_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Razorpay reports pay_1 captured on order_1
+			if order.Status != OrderPaid || order.PaymentID != "pay_1" {
+				t.Fatalf("order = %s %s, want paid by pay_1", order.Status, order.PaymentID)
+			}
+			after := reordering()
+			for outcome, n := range after {
+				if n-before[outcome] != tt.wantMetrics[outcome] {
+					t.Fatalf("webhook_reordering_total{%s} rose by %v, want %v", outcome, n-before[outcome], tt.wantMetrics[outcome])
+				}
+			}
+			if tt.wantMetrics["reordered"] > 0 && !strings.Contains(buf.String(), "already past it") {
+				t.Fatalf("log = %q, want the late event skipped", buf.String())
+			}
+		})
+	}
+}
+
+func TestWebhookOrderingUnresolved(t *testing.T) {
+	s, gw, advance := orderingService(t, 1000)
+	// Razorpay does not know the payment either
+	gw.mu.Lock()
+	delete(gw.payments, "pay_1")
+	gw.mu.Unlock()
+
+	replay(t, s, "refund_1")
+	advance(time.Minute)
+	sweep(s)
+	// Applied as it came, so not lost
+	if kinds := ledgerKinds(t, s); !reflect.DeepEqual(kinds, []string{"refund rfnd_1"}) {
+		t.Fatalf("ledger = %v, want the parked refund applied", kinds)
+	}
+	if order, _ := s.store.Get(context.Background(), "order_1"); order.Status == OrderPaid {
+		t.Fatal("order marked paid without a capture")
+	}
+}
+
+func TestWebhookOrderingBounded(t *testing.T) {
+	s, gw, _ := orderingService(t, 1)
+	createTestOrder(t, s, 50000)
+	gw.pay("pay_2", "order_2", 50000, "INR")
+	before := reordering()
+
+	// pay_1's refund takes the only slot; pay_2's is resolved at once
+	replay(t, s, "refund_1", "refund_of_pay_2")
+
+	if kinds := ledgerKinds(t, s); !reflect.DeepEqual(kinds, []string{"payment_captured pay_2", "refund rfnd_3"}) {
+		t.Fatalf("ledger = %v, want pay_2 resolved from Razorpay", kinds)
+	}
+	after := reordering()
+	if after["parked"]-before["parked"] != 1 || after["force_resolved"]-before["force_resolved"] != 1 {
+		t.Fatalf("parked %v, force-resolved %v, want 1 each", after["parked"]-before["parked"], after["force_resolved"]-before["force_resolved"])
+	}
+}
+
+func TestWebhookOrderingFlushedOnShutdown(t *testing.T) {
+	s, _, _ := orderingService(t, 1000)
+	replay(t, s, "refund_1")
+	drainWebhooks(t, s)
+	if kinds := ledgerKinds(t, s); !reflect.DeepEqual(kinds, []string{"refund rfnd_1"}) {
+		t.Fatalf("ledger = %v, want the parked refund applied on shutdown", kinds)
+	}
+}
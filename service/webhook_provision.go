@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+	"github.com/yash170603/golang_payment/runner"
+)
+
+// ErrWebhookURLUnset is returned for webhook provisioning and drift checks
+// when WEBHOOK_PUBLIC_URL is not configured
+var ErrWebhookURLUnset = errors.New("webhook public URL is not configured")
+
+// handledWebhookEvents are the events HandleWebhook acts on, subscribed to
+// unless WEBHOOK_EVENTS says otherwise
+var handledWebhookEvents = []string{
+	"order.paid",
+	"payment.authorized",
+	"payment.captured",
+	"payment.dispute.action_required",
+	"payment.dispute.closed",
+	"payment.dispute.created",
+	"payment.dispute.lost",
+	"payment.dispute.under_review",
+	"payment.dispute.won",
+	"payment.failed",
+	"refund.processed",
+	"settlement.processed",
+	"transfer.processed",
+}
+
+// WebhookDrift compares the Razorpay webhook pointing at this service with
+// what the service expects. The checksums cover the URL, active state and
+// events, so two reports can be compared at a glance.
+type WebhookDrift struct {
+	URL       string `json:"url"`
+	Found     bool   `json:"found"`
+	WebhookID string `json:"webhook_id,omitempty"`
+	Active    bool   `json:"active"`
+	// MissingEvents are expected but not subscribed; ExtraEvents are
+	// subscribed but not expected
+	MissingEvents    []string `json:"missing_events,omitempty"`
+	ExtraEvents      []string `json:"extra_events,omitempty"`
+	ExpectedChecksum string   `json:"expected_checksum"`
+	RemoteChecksum   string   `json:"remote_checksum,omitempty"`
+	Drifted          bool     `json:"drifted"`
+}
+
+// WebhookProvision is the outcome of provisioning: Action is "created" or
+// "updated"
+type WebhookProvision struct {
+	Action    string   `json:"action"`
+	WebhookID string   `json:"webhook_id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Checksum  string   `json:"checksum"`
+}
+
+// webhookChecksum is the SHA-256 of a webhook's comparable configuration;
+// events must be sorted
+func webhookChecksum(url string, active bool, events []string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%t\n%s", url, active, strings.Join(events, ","))))
+	return hex.EncodeToString(sum[:])
+}
+
+// webhookEvents returns the events the webhook should subscribe to, sorted
+func (s *Service) webhookEvents() []string {
+	events := handledWebhookEvents
+	if len(s.cfg.WebhookEvents) > 0 {
+		events = s.cfg.WebhookEvents
+	}
+	sorted := append([]string(nil), events...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// WebhookDrift reports how the remote webhook differs from the expected
+// one. The secret cannot be read back, so it is not compared.
+func (s *Service) WebhookDrift(ctx context.Context) (WebhookDrift, error) {
+	if s.cfg.WebhookPublicURL == "" {
+		return WebhookDrift{}, ErrWebhookURLUnset
+	}
+	remote, err := s.findWebhook(ctx)
+	if err != nil {
+		return WebhookDrift{}, err
+	}
+
+	expected := s.webhookEvents()
+	drift := WebhookDrift{
+		URL:              s.cfg.WebhookPublicURL,
+		ExpectedChecksum: webhookChecksum(s.cfg.WebhookPublicURL, true, expected),
+	}
+	if remote == nil {
+		drift.Drifted = true
+		return drift, nil
+	}
+	drift.Found = true
+	drift.WebhookID, _ = remote["id"].(string)
+	drift.Active, _ = remote["active"].(bool)
+
+	events := subscribedEvents(remote["events"])
+	sort.Strings(events)
+	drift.RemoteChecksum = webhookChecksum(s.cfg.WebhookPublicURL, drift.Active, events)
+
+	subscribed := map[string]bool{}
+	for _, e := range events {
+		subscribed[e] = true
+	}
+	for _, e := range expected {
+		if !subscribed[e] {
+			drift.MissingEvents = append(drift.MissingEvents, e)
+		}
+		delete(subscribed, e)
+	}
+	for e := range subscribed {
+		drift.ExtraEvents = append(drift.ExtraEvents, e)
+	}
+	sort.Strings(drift.ExtraEvents)
+
+	drift.Drifted = drift.RemoteChecksum != drift.ExpectedChecksum
+	return drift, nil
+}
+
+// ProvisionWebhook creates the webhook pointing at WEBHOOK_PUBLIC_URL, or
+// overwrites it when it exists, with the expected events, active, and the
+// webhook secret. Running it again leaves the same configuration.
+func (s *Service) ProvisionWebhook(ctx context.Context) (WebhookProvision, error) {
+	if s.cfg.WebhookPublicURL == "" {
+		return WebhookProvision{}, ErrWebhookURLUnset
+	}
+	remote, err := s.findWebhook(ctx)
+	if err != nil {
+		return WebhookProvision{}, err
+	}
+
+	events := s.webhookEvents()
+	data := map[string]interface{}{
+		"url":    s.cfg.WebhookPublicURL,
+		"secret": s.cfg.WebhookSecret,
+		"events": events,
+		"active": true,
+	}
+	result := WebhookProvision{
+		URL:      s.cfg.WebhookPublicURL,
+		Events:   events,
+		Checksum: webhookChecksum(s.cfg.WebhookPublicURL, true, events),
+	}
+	var webhook map[string]interface{}
+	if remote == nil {
+		result.Action = "created"
+		webhook, err = s.gateway.CreateWebhook(ctx, data)
+	} else {
+		result.Action = "updated"
+		id, _ := remote["id"].(string)
+		webhook, err = s.gateway.UpdateWebhook(ctx, id, data)
+	}
+	if err != nil {
+		return WebhookProvision{}, fmt.Errorf("provision webhook: %w", err)
+	}
+	result.WebhookID, _ = webhook["id"].(string)
+	log.Printf("Provisioned webhook %s for %s (%s)", result.WebhookID, result.URL, result.Action)
+	return result, nil
+}
+
+// findWebhook returns the remote webhook for WEBHOOK_PUBLIC_URL, or nil
+func (s *Service) findWebhook(ctx context.Context) (map[string]interface{}, error) {
+	webhooks, err := s.gateway.ListWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	items, _ := webhooks["items"].([]interface{})
+	for _, raw := range items {
+		if w, ok := raw.(map[string]interface{}); ok && w["url"] == s.cfg.WebhookPublicURL {
+			return w, nil
+		}
+	}
+	return nil, nil
+}
+
+// subscribedEvents reads a webhook's events, which Razorpay returns either
+// as a list or as a map of event to enabled
+func subscribedEvents(v interface{}) []string {
+	var events []string
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			if name, ok := e.(string); ok {
+				events = append(events, name)
+			}
+		}
+	case map[string]interface{}:
+		for name, enabled := range v {
+			if enabled == true || enabled == "1" || enabled == "true" {
+				events = append(events, name)
+			}
+		}
+	}
+	return events
+}
+
+// startWebhookDriftCheck compares the remote webhook with the expected one
+// every WebhookDriftCheckInterval, notifying once each time it drifts to a
+// new configuration
+func (s *Service) startWebhookDriftCheck() {
+	if s.cfg.WebhookPublicURL == "" || s.cfg.WebhookDriftCheckInterval <= 0 {
+		return
+	}
+	var last string
+	s.runners.Add("webhook-drift-check", runner.Every(s.cfg.WebhookDriftCheckInterval, func() {
+		last = s.checkWebhookDrift(last)
+	}))
+}
+
+// checkWebhookDrift notifies when the remote webhook has drifted and its
+// checksum differs from last, the one already notified. It returns the
+// checksum to compare the next check with.
+func (s *Service) checkWebhookDrift(last string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	drift, err := s.WebhookDrift(ctx)
+	if err != nil {
+		log.Printf("Webhook drift check failed: %v", err)
+		return last
+	}
+	if !drift.Drifted {
+		return ""
+	}
+	remote := drift.RemoteChecksum
+	if !drift.Found {
+		remote = "missing"
+	}
+	if remote == last {
+		return last
+	}
+	log.Printf("WARNING: Razorpay webhook for %s has drifted: found=%t active=%t missing=%v extra=%v",
+		drift.URL, drift.Found, drift.Active, drift.MissingEvents, drift.ExtraEvents)
+	s.notifier.Publish(notify.Event{
+		Type:    notify.EventWebhookDrift,
+		Subject: drift.URL,
+		Data: map[string]interface{}{
+			"found":          drift.Found,
+			"active":         drift.Active,
+			"missing_events": drift.MissingEvents,
+			"extra_events":   drift.ExtraEvents,
+		},
+	})
+	return remote
+}
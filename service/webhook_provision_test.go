@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yash170603/golang_payment/notify"
+)
+
+const testWebhookURL = "https://pay.example.com/api/v1/webhooks/razorpay"
+
+// webhooksGateway keeps webhooks in memory the way Razorpay's webhook API
+// does, recording what it was sent
+type webhooksGateway struct {
+	*fakeGateway
+
+	webhooks []map[string]interface{}
+	sent     []map[string]interface{}
+}
+
+func (g *webhooksGateway) ListWebhooks(ctx context.Context) (map[string]interface{}, error) {
+	items := make([]interface{}, len(g.webhooks))
+	for i, w := range g.webhooks {
+		items[i] = copyMap(w)
+	}
+	return map[string]interface{}{"items": items}, nil
+}
+
+func (g *webhooksGateway) CreateWebhook(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	g.sent = append(g.sent, data)
+	w := webhookOf(fmt.Sprintf("wh_%d", len(g.webhooks)+1), data)
+	g.webhooks = append(g.webhooks, w)
+	return copyMap(w), nil
+}
+
+func (g *webhooksGateway) UpdateWebhook(ctx context.Context, id string, data map[string]interface{}) (map[string]interface{}, error) {
+	g.sent = append(g.sent, data)
+	for i, w := range g.webhooks {
+		if w["id"] == id {
+			g.webhooks[i] = webhookOf(id, data)
+			return copyMap(g.webhooks[i]), nil
+		}
+	}
+	return nil, errors.New("webhook not found")
+}
+
+// webhookOf is the webhook Razorpay keeps for data, without the secret
+func webhookOf(id string, data map[string]interface{}) map[string]interface{} {
+	var events []interface{}
+	for _, e := range data["events"].([]string) {
+		events = append(events, e)
+	}
+	return map[string]interface{}{"id": id, "url": data["url"], "active": data["active"], "events": events}
+}
+
+func provisionService(t *testing.T, gw *webhooksGateway, opts ...Option) *Service {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookPublicURL = testWebhookURL
+	cfg.WebhookEvents = []string{"payment.captured", "order.paid", "refund.processed"}
+	s, _ := newTestService(t, gw, cfg, opts...)
+	return s
+}
+
+func TestProvisionWebhookIdempotent(t *testing.T) {
+	gw := &webhooksGateway{fakeGateway: newFakeGateway()}
+	gw.webhooks = []map[string]interface{}{{"id": "wh_other", "url": "https://other.example.com/hook", "active": true}}
+	s := provisionService(t, gw)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	var checksums []string
+	for i, want := range []string{"created", "updated", "updated"} {
+		result, err := s.ProvisionWebhook(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Action != want || result.WebhookID != "wh_2" {
+			t.Fatalf("provisioning %d = %s %s, want %s wh_2", i+1, result.Action, result.WebhookID, want)
+		}
+		checksums = append(checksums, result.Checksum)
+	}
+	if checksums[0] != checksums[1] || checksums[1] != checksums[2] {
+		t.Fatalf("checksums = %v, want one configuration", checksums)
+	}
+	if len(gw.webhooks) != 2 {
+		t.Fatalf("%d webhooks, want ours added beside the other", len(gw.webhooks))
+	}
+	for _, data := range gw.sent {
+		if data["secret"] != testWebhookSecret || data["url"] != testWebhookURL || data["active"] != true {
+			t.Fatalf("sent %v, want the URL, secret and active", data)
+		}
+		if events := data["events"]; !reflect.DeepEqual(events, []string{"order.paid", "payment.captured", "refund.processed"}) {
+			t.Fatalf("events = %v, want the configured events sorted", events)
+		}
+	}
+	if strings.Contains(buf.String(), testWebhookSecret) {
+		t.Fatalf("log = %q, the secret was printed", buf.String())
+	}
+
+	drift, err := s.WebhookDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.Drifted || drift.RemoteChecksum != drift.ExpectedChecksum || drift.ExpectedChecksum != checksums[0] {
+		t.Fatalf("drift = %+v after provisioning, want none", drift)
+	}
+}
+
+func TestWebhookDrift(t *testing.T) {
+	expected := []interface{}{"order.paid", "payment.captured", "refund.processed"}
+	tests := []struct {
+		name    string
+		remote  map[string]interface{}
+		want    WebhookDrift
+		drifted bool
+	}{
+		{"missing", nil, WebhookDrift{}, true},
+		{"in sync", map[string]interface{}{"active": true, "events": expected}, WebhookDrift{Found: true, Active: true}, false},
+		{
+			"events as a map",
+			map[string]interface{}{"active": true, "events": map[string]interface{}{"order.paid": true, "payment.captured": "1", "refund.processed": "true", "payment.failed": false}},
+			WebhookDrift{Found: true, Active: true},
+			false,
+		},
+		{"inactive", map[string]interface{}{"active": false, "events": expected}, WebhookDrift{Found: true}, true},
+		{
+			"events edited",
+			map[string]interface{}{"active": true, "events": []interface{}{"payment.captured", "payment.failed", "order.paid"}},
+			WebhookDrift{Found: true, Active: true, MissingEvents: []string{"refund.processed"}, ExtraEvents: []string{"payment.failed"}},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &webhooksGateway{fakeGateway: newFakeGateway()}
+			if tt.remote != nil {
+				tt.remote["id"], tt.remote["url"] = "wh_1", testWebhookURL
+				gw.webhooks = append(gw.webhooks, tt.remote)
+			}
+			s := provisionService(t, gw)
+
+			drift, err := s.WebhookDrift(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if drift.Drifted != tt.drifted || drift.Found != tt.want.Found || drift.Active != tt.want.Active ||
+				!reflect.DeepEqual(drift.MissingEvents, tt.want.MissingEvents) || !reflect.DeepEqual(drift.ExtraEvents, tt.want.ExtraEvents) {
+				t.Fatalf("drift = %+v, want %+v drifted %v", drift, tt.want, tt.drifted)
+			}
+		})
+	}
+}
+
+func TestWebhookProvisioningNeedsPublicURL(t *testing.T) {
+	s, _ := newTestService(t, &webhooksGateway{fakeGateway: newFakeGateway()}, testConfig(t))
+	if _, err := s.ProvisionWebhook(context.Background()); !errors.Is(err, ErrWebhookURLUnset) {
+		t.Fatalf("provision: err = %v, want ErrWebhookURLUnset", err)
+	}
+	if _, err := s.WebhookDrift(context.Background()); !errors.Is(err, ErrWebhookURLUnset) {
+		t.Fatalf("drift: err = %v, want ErrWebhookURLUnset", err)
+	}
+}
+
+func TestWebhookDriftNotifiedOncePerChange(t *testing.T) {
+	gw := &webhooksGateway{fakeGateway: newFakeGateway()}
+	ch := &recordingChannel{events: make(chan notify.Event, 10)}
+	n := notify.New(notify.Options{}, ch)
+	defer n.Shutdown(context.Background())
+	s := provisionService(t, gw, WithNotifier(n))
+	if _, err := s.ProvisionWebhook(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	edits := []struct {
+		name   string
+		edit   func(w map[string]interface{})
+		notify bool
+	}{
+		{"in sync", func(map[string]interface{}) {}, false},
+		{"deactivated", func(w map[string]interface{}) { w["active"] = false }, true},
+		{"still deactivated", func(map[string]interface{}) {}, false},
+		{"event dropped too", func(w map[string]interface{}) { w["events"] = []interface{}{"order.paid"} }, true},
+		{"restored", func(w map[string]interface{}) {
+			w["active"], w["events"] = true, []interface{}{"order.paid", "payment.captured", "refund.processed"}
+		}, false},
+		{"deactivated again", func(w map[string]interface{}) { w["active"] = false }, true},
+	}
+	var last string
+	for _, e := range edits {
+		e.edit(gw.webhooks[0])
+		last = s.checkWebhookDrift(last)
+
+		select {
+		case ev := <-ch.events:
+			if !e.notify {
+				t.Fatalf("%s: notified %+v, want nothing", e.name, ev)
+			}
+			if ev.Type != notify.EventWebhookDrift || ev.Subject != testWebhookURL {
+				t.Fatalf("%s: notified %+v, want the drift of %s", e.name, ev, testWebhookURL)
+			}
+		case <-time.After(50 * time.Millisecond):
+			if e.notify {
+				t.Fatalf("%s: no drift notification", e.name)
+			}
+		}
+	}
+}
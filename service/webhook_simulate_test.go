@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/yash170603/golang_payment/config"
+)
+
+func TestSimulateWebhook(t *testing.T) {
+	tests := []struct {
+		event string
+		// entities are the payload entities the event carries
+		entities []string
+		// paid is whether the event pays the order
+		paid bool
+	}{
+		{"payment.authorized", []string{"payment"}, false},
+		{"payment.captured", []string{"payment"}, true},
+		{"payment.failed", []string{"payment"}, false},
+		{"order.paid", []string{"order", "payment"}, true},
+		{"refund.processed", []string{"refund"}, false},
+		{"payment.dispute.created", []string{"dispute", "payment"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.WebhookSecret = testWebhookSecret
+			cfg.WebhookReorderDelay = 0
+			s, _ := newTestService(t, newFakeGateway(), cfg)
+			ctx := context.Background()
+			id := createTestOrder(t, s, 50000)["id"].(string)
+			sub, _ := s.SubscribeEvents(0, []string{tt.event})
+			defer s.UnsubscribeEvents(sub)
+
+			sim, err := s.SimulateWebhook(ctx, WebhookSimulationRequest{Event: tt.event, OrderID: id, PaymentID: "pay_1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainWebhooks(t, s)
+
+			var body struct {
+				Event    string   `json:"event"`
+				Contains []string `json:"contains"`
+				Payload  map[string]struct {
+					Entity map[string]interface{} `json:"entity"`
+				} `json:"payload"`
+			}
+			if err := json.Unmarshal(sim.Payload, &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Event != tt.event || len(body.Contains) != len(tt.entities) {
+				t.Fatalf("event %s containing %v, want %s containing %v", body.Event, body.Contains, tt.event, tt.entities)
+			}
+			for i, entity := range tt.entities {
+				if body.Contains[i] != entity || body.Payload[entity].Entity == nil {
+					t.Fatalf("payload = %s, want a %s entity", sim.Payload, entity)
+				}
+			}
+			if p := body.Payload["payment"].Entity; p != nil && (p["order_id"] != id || p["amount"] != float64(50000)) {
+				t.Fatalf("payment = %v, want order %s's amount, 50000", p, id)
+			}
+			if len(sub.C) != 1 {
+				t.Fatalf("%d %s events processed, want 1", len(sub.C), tt.event)
+			}
+
+			order, _ := s.store.Get(ctx, id)
+			if paid := order.Status == OrderPaid; paid != tt.paid {
+				t.Fatalf("status = %s, want paid %v", order.Status, tt.paid)
+			}
+		})
+	}
+}
+
+func TestSimulateWebhookRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		secret  string
+		event   string
+		wantErr error
+	}{
+		{"release mode", config.ModeRelease, testWebhookSecret, "payment.captured", ErrSimulationDisabled},
+		{"webhooks disabled", config.ModeDebug, "", "payment.captured", ErrWebhooksDisabled},
+		{"unsupported event", config.ModeDebug, testWebhookSecret, "payout.processed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Mode, cfg.WebhookSecret = tt.mode, tt.secret
+			s, _ := newTestService(t, newFakeGateway(), cfg)
+
+			_, err := s.SimulateWebhook(context.Background(), WebhookSimulationRequest{Event: tt.event})
+			if tt.wantErr == nil {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// deliver sends body to s as a webhook signed with testWebhookSecret
+func deliver(t *testing.T, s *Service, body, eventID string) error {
+	t.Helper()
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	return s.HandleWebhook([]byte(body), hex.EncodeToString(mac.Sum(nil)), eventID)
+}
+
+// drainWebhooks shuts s down, so every queued event has been processed
+func drainWebhooks(t *testing.T, s *Service) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWebhookRedeliveryProcessedOnce(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookDedupTTL = time.Hour
+	cfg.WebhookReorderDelay = 0
+	s, clk := newTestService(t, newFakeGateway(), cfg)
+	sub, _ := s.SubscribeEvents(0, []string{"test.ping"})
+	defer s.UnsubscribeEvents(sub)
+
+	deliveries := []struct {
+		id      string
+		advance time.Duration
+		// processed is whether the delivery is processed rather than skipped
+		processed bool
+	}{
+		{id: "evt_1", processed: true},
+		{id: "evt_1"},
+		{id: "evt_2", processed: true},
+		{id: "evt_1", advance: 30 * time.Minute},
+		{id: "evt_1", advance: 31 * time.Minute, processed: true},
+		{id: "", processed: true},
+		{id: "", processed: true},
+	}
+	want := 0
+	for i, d := range deliveries {
+		clk.Advance(d.advance)
+		if err := deliver(t, s, `{"event":"test.ping"}`, d.id); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+		if d.processed {
+			want++
+		}
+	}
+	drainWebhooks(t, s)
+
+	got := 0
+	for len(sub.C) > 0 {
+		<-sub.C
+		got++
+	}
+	if got != want {
+		t.Fatalf("%d events processed, want %d", got, want)
+	}
+}
+
+func TestWebhookDeadLettersCapped(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.WebhookSecret = testWebhookSecret
+	cfg.WebhookDeadLetterMax = 2
+	cfg.WebhookReorderDelay = 0
+	s, _ := newTestService(t, newFakeGateway(), cfg)
+
+	// Missing the payment entity, so processing fails
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		if err := deliver(t, s, `{"event":"payment.captured","payload":{}}`, id); err != nil {
+			t.Fatalf("deliver %s: %v", id, err)
+		}
+	}
+	drainWebhooks(t, s)
+
+	letters := s.DeadLetters()
+	if len(letters) != 2 || letters[0].Event.ID != "evt_2" || letters[1].Event.ID != "evt_3" {
+		t.Fatalf("dead letters = %+v, want evt_2 and evt_3", letters)
+	}
+}
+
+func TestWebhookQueueFullNotTakenForSeen(t *testing.T) {
+	// A pool without workers, its queue already full
+	p := &webhookPool{queue: make(chan WebhookEvent, 1), seen: newSeenEvents(time.Hour)}
+	p.queue <- WebhookEvent{}
+	ev := WebhookEvent{ID: "evt_1", Event: "test.ping", ReceivedAt: time.Now()}
+
+	if err := p.enqueue(ev); !errors.Is(err, ErrWebhookQueueFull) {
+		t.Fatalf("err = %v, want ErrWebhookQueueFull", err)
+	}
+	<-p.queue
+	if err := p.enqueue(ev); err != nil {
+		t.Fatalf("redelivery after a full queue: %v", err)
+	}
+	if got := <-p.queue; got.ID != "evt_1" {
+		t.Fatal("redelivery of an event never queued was skipped")
+	}
+}
+
+func TestSeenEvents(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// ids are added a minute apart; want is add's result for each
+		ids  []string
+		want []bool
+	}{
+		{"distinct", time.Hour, []string{"a", "b", "c"}, []bool{true, true, true}},
+		{"repeated", time.Hour, []string{"a", "b", "a"}, []bool{true, true, false}},
+		{"expired", 2 * time.Minute, []string{"a", "b", "a", "a"}, []bool{true, true, true, false}},
+		{"empty ID", time.Hour, []string{"", ""}, []bool{true, true}},
+		{"disabled", 0, []string{"a", "a"}, []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := newSeenEvents(tt.ttl)
+			for i, id := range tt.ids {
+				if got := seen.add(id, start.Add(time.Duration(i)*time.Minute)); got != tt.want[i] {
+					t.Fatalf("add %d (%q) = %v, want %v", i, id, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookTimeChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		// age is how long before our clock the event was created
+		age    time.Duration
+		want   error
+		warned bool
+	}{
+		{"fresh", time.Minute, nil, false},
+		{"future within skew", -20 * time.Second, nil, true},
+		{"future beyond skew", -31 * time.Second, ErrWebhookFromFuture, false},
+		{"at the window", time.Hour, nil, false},
+		{"stale within skew", time.Hour + 20*time.Second, nil, true},
+		{"stale beyond skew", time.Hour + 31*time.Second, ErrWebhookStale, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.WebhookSecret = testWebhookSecret
+			cfg.WebhookReorderDelay = 0
+			cfg.WebhookReplayWindow = time.Hour
+			cfg.WebhookMaxClockSkew = 30 * time.Second
+			s, clk := newTestService(t, newFakeGateway(), cfg)
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+			body := fmt.Sprintf(`{"event":"test.ping","created_at":%d}`, clk.Now().Add(-tt.age).Unix())
+			if err := deliver(t, s, body, "evt_1"); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if warned := strings.Contains(buf.String(), "within clock skew tolerance"); warned != tt.warned {
+				t.Fatalf("log = %q, want a skew warning %v", buf.String(), tt.warned)
+			}
+		})
+	}
+}